@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command mirrorproxy is a lightweight reverse proxy that forwards requests to
+// a service and replays a sample of them to a candidate revision, as
+// instructed by the operator.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/mirror"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	flService     string
+	flUpstream    string
+	flHTTPAddr    string
+	flControlAddr string
+)
+
+func init() {
+	defaultAddr := ":8080"
+	if v := os.Getenv("PORT"); v != "" {
+		defaultAddr = fmt.Sprintf(":%s", v)
+	}
+
+	flag.StringVar(&flService, "service", "", "name of the Cloud Run service the proxy is in front of")
+	flag.StringVar(&flUpstream, "upstream", "", "URL requests are forwarded to (e.g. the service's stable tag URL)")
+	flag.StringVar(&flHTTPAddr, "http-addr", defaultAddr, "address where to listen to proxied requests")
+	flag.StringVar(&flControlAddr, "control-addr", ":8081", "address where to listen to control requests from the operator")
+	flag.Parse()
+}
+
+func main() {
+	logger := logrus.New()
+	if flService == "" {
+		logger.Fatal("service must be specified")
+	}
+	upstream, err := url.Parse(flUpstream)
+	if err != nil || upstream.Host == "" {
+		logger.Fatalf("invalid upstream URL %q", flUpstream)
+	}
+
+	lg := logger.WithField("service", flService)
+	proxy := mirror.NewProxy(flService, upstream, logger)
+	go func() {
+		lg.WithField("addr", flControlAddr).Info("starting control server")
+		lg.Fatal(http.ListenAndServe(flControlAddr, proxy.ControlHandler()))
+	}()
+
+	lg.WithField("addr", flHTTPAddr).Info("starting proxy")
+	lg.Fatal(http.ListenAndServe(flHTTPAddr, proxy))
+}
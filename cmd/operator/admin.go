@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Actions of the admin API on a service.
+const (
+	pauseAction   = "pause"
+	resumeAction  = "resume"
+	promoteAction = "promote"
+	abortAction   = "abort"
+)
+
+var adminActions = map[string]bool{pauseAction: true, resumeAction: true, promoteAction: true, abortAction: true}
+
+// Actions of the admin API that are not applied to the rollout of a service,
+// but authorized like the others: getting the state of the services and
+// rolling them back (see makeRollbackHandler).
+const (
+	viewAction     = "view"
+	rollbackAction = "rollback"
+)
+
+// adminPolicyActions are the actions of the rules of -admin-authorization-file.
+var adminPolicyActions = []string{viewAction, pauseAction, resumeAction, promoteAction, abortAction, rollbackAction, pauseFleetAction, resumeFleetAction}
+
+// Principals of the requests to the admin API that do not carry an ID token.
+const (
+	adminTokenPrincipal = "admin-token"
+	anonymousPrincipal  = "anonymous"
+)
+
+// adminService is a managed service as returned by the admin API.
+type adminService struct {
+	kube.ServiceStatus
+	Namespace string `json:"namespace,omitempty"`
+	Strategy  string `json:"strategy,omitempty"`
+	Paused    bool   `json:"paused"`
+
+	// Diagnosis is the current diagnosis of the latest ready revision, only
+	// set for a single service.
+	Diagnosis *health.Report `json:"diagnosis,omitempty"`
+}
+
+// makeAdminHandler creates a request handler for the admin API:
+//
+//	GET  /services                                   managed services
+//	GET  /services/PROJECT/REGION/SERVICE            service and its diagnosis
+//	POST /services/PROJECT/REGION/SERVICE:ACTION     pause, resume, promote or abort
+//
+// The namespace of a Knative Serving service is set with the namespace query
+// parameter.
+func makeAdminHandler(logger *logrus.Logger, store *configStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		principal, err := authenticateAdmin(ctx, req.Header.Get("Authorization"))
+		if err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("admin API request rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		resource := strings.Trim(strings.TrimPrefix(req.URL.Path, "/services"), "/")
+		if resource == "" {
+			if req.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			svcs, err := getManagedServices(ctx, logger, store.Load())
+			if err != nil {
+				logger.Warn(err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			list := make([]adminService, 0, len(svcs))
+			for _, svc := range svcs {
+				service := svc.service
+				if !adminAllowed(principal, viewAction, service.Project, service.Region, service.Metadata.Name) {
+					continue
+				}
+				list = append(list, newAdminService(svc))
+			}
+			writeJSON(w, list)
+			return
+		}
+
+		parts := strings.Split(resource, "/")
+		if len(parts) != 3 {
+			http.Error(w, "path must be /services/PROJECT/REGION/SERVICE[:ACTION]", http.StatusNotFound)
+			return
+		}
+		project, region, name := parts[0], parts[1], parts[2]
+		var action string
+		if i := strings.LastIndex(name, ":"); i != -1 {
+			name, action = name[:i], name[i+1:]
+		}
+		if action != "" && !adminActions[action] {
+			http.Error(w, fmt.Sprintf("action must be %s, %s, %s or %s, got %q", pauseAction, resumeAction, promoteAction, abortAction, action), http.StatusNotFound)
+			return
+		}
+		if action == "" && req.Method != http.MethodGet || action != "" && req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		policyAction := action
+		if policyAction == "" {
+			policyAction = viewAction
+		}
+		if !adminAllowed(principal, policyAction, project, region, name) {
+			auditLogger(logger, principal, policyAction, project, region, name).Warn("admin action denied")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		svc, err := findManagedService(ctx, logger, store.Load(), project, region, req.URL.Query().Get("namespace"), name)
+		if err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if svc == nil {
+			http.Error(w, "service is not managed by the operator", http.StatusNotFound)
+			return
+		}
+		current, err := refreshService(ctx, *svc)
+		if err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.service = current
+
+		if action == "" {
+			result, err := diagnoseService(ctx, logger, *svc)
+			if err != nil {
+				logger.Warn(err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, result)
+			return
+		}
+
+		if err := handleAdminAction(ctx, logger, *svc, action, principal); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if svc.service, err = refreshService(ctx, *svc); err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, newAdminService(*svc))
+	}
+}
+
+// adminAPIEnabled determines if the admin API is served: its requests must be
+// authenticated with the admin token or an ID token, unless the access to the
+// API is explicitly left to the platform with -admin-allow-unauthenticated.
+func adminAPIEnabled() bool {
+	return flAdminToken != "" || flAdminAudience != "" || flAdminUnauthenticated
+}
+
+// authenticateAdmin returns the principal of the request to the admin API,
+// from its authorization header (or gRPC metadata):
+// the email of its Google ID token, if -admin-audience is set, or
+// adminTokenPrincipal for the admin token. With -admin-allow-unauthenticated,
+// the access to the API must be restricted otherwise, e.g. with Cloud Run IAM,
+// and the principal is anonymousPrincipal. Without any of them, all the
+// requests are rejected.
+func authenticateAdmin(ctx context.Context, header string) (string, error) {
+	if flAdminToken == "" && adminVerifier == nil {
+		if flAdminUnauthenticated {
+			return anonymousPrincipal, nil
+		}
+		return "", errors.New("authentication of the admin API is not configured")
+	}
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errors.New("no bearer token")
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	if flAdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(flAdminToken)) == 1 {
+		return adminTokenPrincipal, nil
+	}
+	if adminVerifier == nil {
+		return "", errors.New("invalid admin token")
+	}
+	return adminVerifier.Verify(ctx, token)
+}
+
+// adminAllowed determines if the principal may perform the action on the
+// service according to -admin-authorization-file. The admin token allows all
+// the actions.
+func adminAllowed(principal, action, project, region, name string) bool {
+	if adminPolicy == nil || principal == adminTokenPrincipal {
+		return true
+	}
+	return adminPolicy.Allows(principal, action, path.Join(project, region, name))
+}
+
+// auditLogger returns the logger of the audit entries of the action of the
+// principal on the service.
+func auditLogger(logger *logrus.Logger, principal, action, project, region, name string) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		"project":   project,
+		"service":   name,
+		"region":    region,
+		"action":    action,
+		"principal": principal,
+	})
+}
+
+// newAdminService returns the state of the managed service from its
+// annotations.
+func newAdminService(svc managedService) adminService {
+	status := serviceStatus(svc.service)
+	return adminService{
+		ServiceStatus: status,
+		Namespace:     svc.service.Namespace,
+		Strategy:      svc.strategyName,
+		Paused:        status.Phase == pausedPhase,
+	}
+}
+
+// diagnoseService returns the state of the service and the current diagnosis
+// of its latest ready revision.
+func diagnoseService(ctx context.Context, logger *logrus.Logger, svc managedService) (adminService, error) {
+	result := newAdminService(svc)
+	roll, err := newRollout(ctx, adminLogger(logger, svc), svc.service, svc.strategy)
+	if err != nil {
+		return result, err
+	}
+	report, err := roll.Verify()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to diagnose service")
+	}
+	result.Diagnosis = &report
+	return result, nil
+}
+
+// handleAdminAction applies the action of the principal to the rollout of the
+// service. Like a rollout cycle, the action holds the lock of the service.
+func handleAdminAction(ctx context.Context, logger *logrus.Logger, svc managedService, action, principal string) error {
+	lg := adminLogger(logger, svc).WithFields(logrus.Fields{"action": action, "principal": principal})
+	if !cycles.Begin() {
+		return errors.New("the operator is shutting down")
+	}
+	defer cycles.End()
+
+	roll, err := newRollout(ctx, lg, svc.service, svc.strategy)
+	if err != nil {
+		return err
+	}
+	fn := map[string]func() error{
+		pauseAction:   roll.Pause,
+		resumeAction:  roll.Resume,
+		promoteAction: roll.Promote,
+		abortAction:   roll.Abort,
+	}[action]
+
+	service := svc.service
+	key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+	locked, err := withServiceLock(ctx, lg, key, fn)
+	if err != nil {
+		lg.Errorf("admin action failed, error=%v", err)
+		return err
+	}
+	if !locked {
+		return errors.New("rollout of the service is being handled by another replica, try again later")
+	}
+	lg.Info("admin action applied")
+	return nil
+}
+
+// adminLogger returns the logger of the requests about the service.
+func adminLogger(logger *logrus.Logger, svc managedService) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		"project": svc.service.Project,
+		"service": svc.service.Metadata.Name,
+		"region":  svc.service.Region,
+	})
+}
+
+// writeJSON writes the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
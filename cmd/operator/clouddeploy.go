@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/storage/v1"
+)
+
+// cloudDeployVerifyInterval is the time between the diagnoses of a revision
+// whose health is still inconclusive in the Cloud Deploy verification mode.
+const cloudDeployVerifyInterval = 30 * time.Second
+
+// cloudDeployOutputEnv is set by Cloud Deploy to the Cloud Storage location
+// the results of custom target operations are written to.
+const cloudDeployOutputEnv = "CLOUD_DEPLOY_OUTPUT_GCS_PATH"
+
+// cloudDeployResults is the results file expected by Cloud Deploy from
+// custom target operations.
+type cloudDeployResults struct {
+	ResultStatus   string            `json:"resultStatus"`
+	FailureMessage string            `json:"failureMessage,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// runCloudDeployVerification diagnoses the latest revision of the targeted
+// services and returns an error if any of them is unhealthy, so the operator
+// can run as a Cloud Deploy verification or custom target: Cloud Deploy uses
+// the exit code of verifications and the results file, if requested, of
+// custom targets.
+//
+// Inconclusive diagnoses are repeated until they are conclusive or the
+// timeout is reached.
+func runCloudDeployVerification(ctx context.Context, logger *logrus.Logger, cfg *config.Config, timeout time.Duration) error {
+	verdicts, err := verifyServices(ctx, logger, cfg, timeout)
+	if outputPath := os.Getenv(cloudDeployOutputEnv); outputPath != "" {
+		results := cloudDeployResults{ResultStatus: "SUCCEEDED", Metadata: verdicts}
+		if err != nil {
+			results.ResultStatus = "FAILED"
+			results.FailureMessage = err.Error()
+		}
+		if werr := writeCloudDeployResults(ctx, outputPath, results); werr != nil {
+			return errors.Wrap(werr, "failed to write Cloud Deploy results")
+		}
+	}
+	return err
+}
+
+// verifyServices verifies the targeted services and returns the verdict of
+// each of them.
+func verifyServices(ctx context.Context, logger *logrus.Logger, cfg *config.Config, timeout time.Duration) (map[string]string, error) {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get targeted services")
+	}
+	if len(svcs) == 0 {
+		return nil, errors.New("no service matches the targets")
+	}
+
+	deadline := time.Now().Add(timeout)
+	verdicts := make(map[string]string)
+	var failed []string
+	for _, managed := range svcs {
+		svc := managed.service
+		lg := logger.WithFields(logrus.Fields{
+			"project": svc.Project,
+			"service": svc.Metadata.Name,
+			"region":  svc.Region,
+		})
+		roll, err := newRollout(ctx, lg, svc, managed.strategy)
+		if err != nil {
+			return nil, err
+		}
+
+		var report health.Report
+		for {
+			report, err = roll.Verify()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to verify service %q", svc.Metadata.Name)
+			}
+			if report.Status != health.Inconclusive.String() || time.Now().Add(cloudDeployVerifyInterval).After(deadline) {
+				break
+			}
+			lg.Infof("diagnosis of %s is inconclusive, retrying in %s", report.Candidate, cloudDeployVerifyInterval)
+			time.Sleep(cloudDeployVerifyInterval)
+		}
+
+		key := fmt.Sprintf("%s/%s", svc.Region, svc.Metadata.Name)
+		verdicts[key] = report.Status
+		lg = lg.WithFields(logrus.Fields{"revision": report.Candidate, "status": report.Status})
+		switch report.Status {
+		case health.Healthy.String():
+			lg.Info("revision is healthy")
+		case health.Inconclusive.String():
+			lg.Warn("diagnosis is still inconclusive")
+			failed = append(failed, fmt.Sprintf("%s: %s is inconclusive", key, report.Candidate))
+		default:
+			lg.WithField("failedChecks", report.FailedChecks()).Warn("revision is unhealthy")
+			failed = append(failed, fmt.Sprintf("%s: %s is unhealthy (%s)", key, report.Candidate, strings.Join(report.FailedChecks(), ", ")))
+		}
+	}
+	if len(failed) != 0 {
+		return verdicts, errors.Errorf("verification failed: %s", strings.Join(failed, "; "))
+	}
+	return verdicts, nil
+}
+
+// writeCloudDeployResults writes the results file in the Cloud Storage
+// location (gs://BUCKET/PATH) provided by Cloud Deploy.
+func writeCloudDeployResults(ctx context.Context, outputPath string, results cloudDeployResults) error {
+	path := strings.TrimPrefix(outputPath, "gs://")
+	if path == outputPath {
+		return errors.Errorf("output path %q is not a Cloud Storage location", outputPath)
+	}
+	parts := strings.SplitN(path, "/", 2)
+	object := "results.json"
+	if len(parts) == 2 && parts[1] != "" {
+		object = strings.TrimSuffix(parts[1], "/") + "/" + object
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal results")
+	}
+	service, err := storage.NewService(ctx, googleCredentials...)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize Cloud Storage client")
+	}
+	_, err = service.Objects.Insert(parts[0], &storage.Object{Name: object}).Media(bytes.NewReader(data)).Context(ctx).Do()
+	return errors.Wrapf(err, "failed to write %s to bucket %s", object, parts[0])
+}
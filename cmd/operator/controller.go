@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Phases of the services in the status of the RolloutStrategy resources.
+const (
+	stablePhase     = "Stable"
+	rollingOutPhase = "RollingOut"
+	rolledBackPhase = "RolledBack"
+	pausedPhase     = "Paused"
+	unhealthyPhase  = "Unhealthy"
+
+	// pendingPhase is the phase of the candidates of the members of release
+	// groups waiting for their dependencies (see the status mode).
+	pendingPhase = "Pending"
+)
+
+// The client of the Kubernetes API server is shared by the controller mode
+// and the Knative Serving clients, and initialized on first use.
+var (
+	kubeClient     *kube.Client
+	kubeClientErr  error
+	kubeClientOnce sync.Once
+)
+
+// sharedKubeClient returns the client of the Kubernetes API server.
+func sharedKubeClient(ctx context.Context) (*kube.Client, error) {
+	kubeClientOnce.Do(func() {
+		kubeClient, kubeClientErr = kubeClientFromFlags(ctx)
+	})
+	return kubeClient, kubeClientErr
+}
+
+// kubeClientFromFlags returns the client of the Kubernetes API server
+// configured by the flags.
+func kubeClientFromFlags(ctx context.Context) (*kube.Client, error) {
+	if flKubeAPIURL != "" {
+		return kube.NewClient(&http.Client{Timeout: 30 * time.Second}, flKubeAPIURL), nil
+	}
+	if flKubeconfig != "" {
+		return kube.NewKubeconfigClient(ctx, flKubeconfig, flKubeContext)
+	}
+	return kube.NewInClusterClient()
+}
+
+// runController reconciles the RolloutStrategy resources every interval until
+// stop is closed. A reconciliation in progress is completed first.
+func runController(ctx context.Context, logger *logrus.Logger, client *kube.Client, interval time.Duration, stop <-chan struct{}) {
+	logger.Info("reading the strategies from the RolloutStrategy resources")
+	for {
+		if err := reconcileStrategies(ctx, logger, client); err != nil {
+			logger.Warnf("reconciliation failed: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// reconcileStrategies handles the rollout of the services targeted by the
+// RolloutStrategy resources and updates their status with the state of the
+// managed services. The resources are named NAMESPACE/NAME in the logs.
+//
+// Invalid resources are reported in their Ready condition and ignored.
+func reconcileStrategies(ctx context.Context, logger *logrus.Logger, client *kube.Client) error {
+	resources, err := client.RolloutStrategies(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		cfg   config.Config
+		valid []kube.RolloutStrategy
+	)
+	for _, resource := range resources {
+		name := resource.Metadata.Namespace + "/" + resource.Metadata.Name
+		strategy, err := config.ParseStrategy(resource.Spec)
+		if err != nil {
+			logger.WithField("strategy", name).Warnf("invalid rollout strategy: %v", err)
+			status := resource.Status
+			status.ObservedGeneration = resource.Metadata.Generation
+			status.Services = nil
+			status.SetCondition(kube.Condition{
+				Type:               "Ready",
+				Status:             "False",
+				Reason:             "InvalidSpec",
+				Message:            err.Error(),
+				LastTransitionTime: time.Now().UTC(),
+			})
+			if err := client.UpdateRolloutStrategyStatus(ctx, resource.Metadata.Namespace, resource.Metadata.Name, status); err != nil {
+				logger.WithField("strategy", name).Warnf("%v", err)
+			}
+			continue
+		}
+		strategy.Name = name
+		cfg.Strategies = append(cfg.Strategies, strategy)
+		valid = append(valid, resource)
+	}
+	if len(cfg.Strategies) == 0 {
+		logger.Debug("no valid rollout strategy in the cluster")
+		return nil
+	}
+
+	errs := runRollouts(ctx, logger, &cfg)
+	if len(errs) != 0 {
+		logger.Warnf("there were %d errors: \n%s", len(errs), rolloutErrsToString(errs))
+	}
+
+	// The services are retrieved again to report their state after the
+	// rollout.
+	svcs, err := getManagedServices(ctx, logger, &cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get managed services")
+	}
+	servicesByStrategy := make(map[string][]kube.ServiceStatus)
+	for _, svc := range svcs {
+		servicesByStrategy[svc.strategy.Name] = append(servicesByStrategy[svc.strategy.Name], serviceStatus(svc.service))
+	}
+
+	for _, resource := range valid {
+		name := resource.Metadata.Namespace + "/" + resource.Metadata.Name
+		status := resource.Status
+		status.ObservedGeneration = resource.Metadata.Generation
+		status.Services = servicesByStrategy[name]
+		status.SetCondition(kube.Condition{
+			Type:               "Ready",
+			Status:             "True",
+			Reason:             "Reconciled",
+			Message:            fmt.Sprintf("%d services managed", len(status.Services)),
+			LastTransitionTime: time.Now().UTC(),
+		})
+		if err := client.UpdateRolloutStrategyStatus(ctx, resource.Metadata.Namespace, resource.Metadata.Name, status); err != nil {
+			logger.WithField("strategy", name).Warnf("%v", err)
+		}
+	}
+	return nil
+}
+
+// serviceStatus returns the rollout state of the service from the annotations
+// set by the operator.
+func serviceStatus(service *rollout.ServiceRecord) kube.ServiceStatus {
+	annotations := service.Metadata.Annotations
+	status := kube.ServiceStatus{
+		Project:     service.Project,
+		Region:      service.Region,
+		Name:        service.Metadata.Name,
+		Phase:       stablePhase,
+		Stable:      annotations[rollout.StableRevisionAnnotation],
+		Candidate:   annotations[rollout.CandidateRevisionAnnotation],
+		LastRollout: annotations[rollout.LastRolloutAnnotation],
+	}
+	if status.Candidate != "" {
+		status.CandidatePercent = candidateTraffic(service.Service, status.Candidate)
+	}
+	switch {
+	case annotations[rollout.PausedAnnotation] != "":
+		status.Phase = pausedPhase
+	case annotations[rollout.UnhealthySinceAnnotation] != "":
+		status.Phase = unhealthyPhase
+	case annotations[rollout.LastFailedCandidateRevisionAnnotation] != "" &&
+		annotations[rollout.LastFailedCandidateRevisionAnnotation] == service.Status.LatestReadyRevisionName:
+		status.Phase = rolledBackPhase
+	case status.Candidate != "":
+		status.Phase = rollingOutPhase
+	}
+	return status
+}
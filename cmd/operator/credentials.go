@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/credentials"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/impersonate"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/ratelimit"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// impersonationFlags are the service accounts impersonated by project. The
+// empty project is the service account impersonated in the other projects.
+type impersonationFlags map[string]string
+
+func (accounts impersonationFlags) Set(value string) error {
+	project, account := "", value
+	if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+		project, account = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if project == "" {
+			return errors.Errorf("project cannot be empty in %q", value)
+		}
+	}
+	if !strings.Contains(account, "@") {
+		return errors.Errorf("service account must be an email, got %q", account)
+	}
+	accounts[project] = account
+	return nil
+}
+
+func (accounts impersonationFlags) String() string {
+	var value string
+	for project, account := range accounts {
+		if project == "" {
+			value += " " + account
+		} else {
+			value += fmt.Sprintf(" %s=%s", project, account)
+		}
+	}
+	return value
+}
+
+// serviceAccountFor returns the service account impersonated to manage the
+// services of the target in the project, or an empty string to use the
+// operator's own identity.
+func serviceAccountFor(target config.Target, project string) string {
+	if target.ImpersonateServiceAccount != "" {
+		return target.ImpersonateServiceAccount
+	}
+	if account, ok := flImpersonateServiceAccounts[project]; ok {
+		return account
+	}
+	return flImpersonateServiceAccounts[""]
+}
+
+// googleCredentials and metricsCredentials are the options authenticating the
+// clients of the Google APIs, and of the Google metrics providers (Cloud
+// Monitoring, Cloud Trace and Google Sheets). They are empty to use the
+// application default credentials.
+var (
+	googleCredentials  []option.ClientOption
+	metricsCredentials []option.ClientOption
+
+	// googleTokenSource is the token source of googleCredentials, if any.
+	googleTokenSource oauth2.TokenSource
+)
+
+// initCredentials initializes the credentials from the -credentials-file and
+// -metrics-credentials-file flags. Without -credentials-file, an external
+// account file of Workload Identity Federation set in
+// GOOGLE_APPLICATION_CREDENTIALS is also used, since it is not supported by
+// the application default credentials of the Google API clients.
+func initCredentials() error {
+	// The token sources outlive the requests they are used for, so they are
+	// not tied to their context.
+	ctx := context.Background()
+	filename := flCredentialsFile
+	if env := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); filename == "" && env != "" && credentials.IsExternalAccount(env) {
+		filename = env
+	}
+	if filename != "" {
+		ts, err := credentials.TokenSource(ctx, filename, cloudPlatformScope)
+		if err != nil {
+			return err
+		}
+		googleTokenSource = ts
+		googleCredentials = []option.ClientOption{option.WithTokenSource(ts)}
+	}
+
+	metricsCredentials = googleCredentials
+	if flMetricsCredentialsFile != "" {
+		ts, err := credentials.TokenSource(ctx, flMetricsCredentialsFile, cloudPlatformScope)
+		if err != nil {
+			return err
+		}
+		metricsCredentials = []option.ClientOption{option.WithTokenSource(ts)}
+	}
+	return nil
+}
+
+// metricsServiceAccountFor returns the service account impersonated to query
+// the Google metrics providers for the services of the target in the
+// project. The -metrics-credentials-file identity is used as is.
+func metricsServiceAccountFor(target config.Target, project string) string {
+	if flMetricsCredentialsFile != "" {
+		return ""
+	}
+	return serviceAccountFor(target, project)
+}
+
+// apiCredentials identifies the options of the clients of an API for an
+// identity.
+type apiCredentials struct {
+	transport      *ratelimit.Transport
+	serviceAccount string
+}
+
+var (
+	apiOptionsMu    sync.Mutex
+	apiOptionsCache = make(map[apiCredentials][]option.ClientOption)
+)
+
+// apiOptions returns the options of the clients of the API using the
+// transport, authenticated with the credentials as is, or to impersonate the
+// service account if set. The rate limit of the transport is shared by all the
+// identities, and the credentials of a transport never change.
+func apiOptions(transport *ratelimit.Transport, creds []option.ClientOption, serviceAccount string) ([]option.ClientOption, error) {
+	apiOptionsMu.Lock()
+	defer apiOptionsMu.Unlock()
+	key := apiCredentials{transport: transport, serviceAccount: serviceAccount}
+	if opts, ok := apiOptionsCache[key]; ok {
+		return opts, nil
+	}
+
+	opts, err := clientOptions(creds, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := transport.ClientOption(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	apiOptionsCache[key] = []option.ClientOption{opt}
+	return apiOptionsCache[key], nil
+}
+
+// clientOptions returns the options of the clients of the APIs without rate
+// limit (e.g. Cloud Resource Manager): the credentials as is, or to
+// impersonate the service account if set.
+func clientOptions(creds []option.ClientOption, serviceAccount string) ([]option.ClientOption, error) {
+	if serviceAccount == "" {
+		return creds, nil
+	}
+	ts, err := impersonate.TokenSource(context.Background(), serviceAccount, []string{cloudPlatformScope}, creds...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to impersonate %s", serviceAccount)
+	}
+	return []option.ClientOption{option.WithTokenSource(ts)}, nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// annotationPrefix is the prefix of the annotations of the operator.
+const annotationPrefix = "rollout.cloud.run/"
+
+// serviceDescription is everything the operator knows about a managed
+// service.
+type serviceDescription struct {
+	fleetStatus
+	Traffic     []describedTraffic `json:"traffic"`
+	Annotations map[string]string  `json:"annotations,omitempty"`
+
+	// EffectiveStrategy is the strategy managing the service, after the
+	// precedence of the strategies and the profile of the configuration file
+	// are applied.
+	EffectiveStrategy interface{} `json:"effectiveStrategy"`
+	steps             []int64
+
+	// LastHealthReport is the last report of the candidate, or
+	// LastHealthReportText the report as set in the annotation if it has no
+	// data.
+	LastHealthReport     *health.Report `json:"lastHealthReport,omitempty"`
+	LastHealthReportText string         `json:"lastHealthReportText,omitempty"`
+
+	PendingGates []rolloutGate `json:"pendingGates"`
+}
+
+// describedTraffic is a traffic target of a service.
+type describedTraffic struct {
+	Revision string `json:"revision"`
+	Tag      string `json:"tag,omitempty"`
+	Percent  int64  `json:"percent"`
+	URL      string `json:"url,omitempty"`
+}
+
+// rolloutGate is a condition that holds the rollout of the service back
+// until it is met.
+type rolloutGate struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// describeService prints everything the operator knows about the targeted
+// services with the name (e.g. in several regions) in the output format.
+func describeService(ctx context.Context, logger *logrus.Logger, cfg *config.Config, name, output string, w io.Writer) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	var descriptions []serviceDescription
+	for _, svc := range svcs {
+		if svc.service.Metadata.Name != name {
+			continue
+		}
+		description, err := newServiceDescription(svc, time.Now())
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, description)
+	}
+	if len(descriptions) == 0 {
+		return errors.Errorf("service %q does not match the targets", name)
+	}
+
+	if ok, err := writeValues(w, output, descriptions); ok {
+		return errors.Wrap(err, "failed to print description")
+	}
+	switch output {
+	case jsonOutput:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(descriptions), "failed to print description")
+	case yamlOutput:
+		// The description is converted from JSON to have the same fields in
+		// both formats.
+		data, err := json.Marshal(descriptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to print description")
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return errors.Wrap(err, "failed to print description")
+		}
+		resetStyle(&node)
+		return errors.Wrap(yaml.NewEncoder(w).Encode(&node), "failed to print description")
+	}
+
+	for i, description := range descriptions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if err := printDescription(w, description); err != nil {
+			return errors.Wrap(err, "failed to print description")
+		}
+	}
+	return nil
+}
+
+// newServiceDescription describes the service from its traffic, annotations
+// and strategy at the time.
+func newServiceDescription(svc managedService, now time.Time) (serviceDescription, error) {
+	service := svc.service
+	annotations := service.Metadata.Annotations
+	result := serviceDescription{
+		fleetStatus: newFleetStatus(svc),
+		Annotations: make(map[string]string),
+		steps:       svc.strategy.Steps,
+	}
+
+	for _, target := range service.Spec.Traffic {
+		revision := target.RevisionName
+		if revision == "" && service.Status != nil {
+			revision = service.Status.LatestReadyRevisionName
+		}
+		traffic := describedTraffic{Revision: revision, Tag: target.Tag, Percent: target.Percent}
+		if service.Status != nil {
+			for _, status := range service.Status.Traffic {
+				if status.Tag != "" && status.Tag == target.Tag {
+					traffic.URL = status.Url
+				}
+			}
+		}
+		result.Traffic = append(result.Traffic, traffic)
+	}
+
+	for key, value := range annotations {
+		if strings.HasPrefix(key, annotationPrefix) {
+			result.Annotations[key] = value
+		}
+	}
+
+	// The strategy only has YAML field names, which the configuration file
+	// uses.
+	data, err := yaml.Marshal(svc.strategy)
+	if err != nil {
+		return serviceDescription{}, errors.Wrap(err, "failed to encode strategy")
+	}
+	var strategy map[string]interface{}
+	if err := yaml.Unmarshal(data, &strategy); err != nil {
+		return serviceDescription{}, errors.Wrap(err, "failed to decode strategy")
+	}
+	result.EffectiveStrategy = strategy
+
+	var report health.Report
+	if data := annotations[rollout.LastHealthReportJSONAnnotation]; data != "" && json.Unmarshal([]byte(data), &report) == nil {
+		result.LastHealthReport = &report
+	} else {
+		result.LastHealthReportText = annotations[rollout.LastHealthReportAnnotation]
+	}
+
+	result.PendingGates = pendingGates(svc, now)
+	return result, nil
+}
+
+// pendingGates returns the conditions the next step of the rollout of the
+// service waits for at the time.
+func pendingGates(svc managedService, now time.Time) []rolloutGate {
+	service := svc.service
+	annotations := service.Metadata.Annotations
+	gates := []rolloutGate{}
+
+	if paused := annotations[rollout.PausedAnnotation]; paused != "" {
+		gates = append(gates, rolloutGate{Name: "paused", Message: fmt.Sprintf("rollout paused since %s, resume it with the admin API", paused)})
+	}
+
+	stable := rollout.DetectStableRevisionName(service.Service)
+	if stable == "" {
+		return append(gates, rolloutGate{Name: "stable", Message: "no stable revision, a revision must serve 100% of the traffic"})
+	}
+	latest := service.Status.LatestReadyRevisionName
+	if failed := annotations[rollout.LastFailedCandidateRevisionAnnotation]; failed != "" && failed == latest {
+		return append(gates, rolloutGate{Name: "newRevision", Message: fmt.Sprintf("candidate %s failed its diagnosis, deploy a new revision to start a rollout", failed)})
+	}
+	candidate := rollout.DetectCandidateRevisionName(service.Service, stable)
+	if candidate == "" {
+		return gates
+	}
+
+	strategy := svc.strategy
+	if candidateTraffic(service.Service, candidate) == 0 {
+		if refused := annotations[rollout.AttestationRefusedAnnotation]; strategy.Attestation != nil && strings.HasPrefix(refused, candidate+": ") {
+			gates = append(gates, rolloutGate{Name: "attestation", Message: fmt.Sprintf("candidate refused traffic until its image is attested, %s", strings.TrimPrefix(refused, candidate+": "))})
+			return gates
+		}
+		if refused := annotations[rollout.VulnerabilitiesRefusedAnnotation]; strategy.VulnerabilityScan != nil && strings.HasPrefix(refused, candidate+": ") {
+			gates = append(gates, rolloutGate{Name: "vulnerabilities", Message: fmt.Sprintf("candidate refused traffic until its image passes the vulnerability scan, %s", strings.TrimPrefix(refused, candidate+": "))})
+			return gates
+		}
+		if shadowStarted, err := time.Parse(time.RFC3339, annotations[rollout.ShadowStartedAnnotation]); err == nil && strategy.Shadow != nil {
+			gates = append(gates, rolloutGate{Name: "shadow", Message: fmt.Sprintf("candidate receives shadow traffic until %s", shadowStarted.Add(strategy.Shadow.Duration).Format(time.RFC3339))})
+			return gates
+		}
+		var checks []string
+		if strategy.Attestation != nil {
+			checks = append(checks, "attestation")
+		}
+		if strategy.VulnerabilityScan != nil {
+			checks = append(checks, "vulnerability scan")
+		}
+		if strategy.Probe != nil {
+			checks = append(checks, "probe")
+		}
+		if strategy.WarmUp != nil {
+			checks = append(checks, "warm-up")
+		}
+		if strategy.Shadow != nil {
+			checks = append(checks, "shadow traffic")
+		}
+		if len(checks) != 0 {
+			gates = append(gates, rolloutGate{Name: "preTraffic", Message: fmt.Sprintf("candidate must pass its pre-traffic checks (%s) before receiving traffic", strings.Join(checks, ", "))})
+		}
+		return gates
+	}
+
+	if lastRollout, err := time.Parse(time.RFC3339, annotations[rollout.LastRolloutAnnotation]); err == nil {
+		if next := lastRollout.Add(strategy.TimeBetweenRollouts); next.After(now) {
+			gates = append(gates, rolloutGate{Name: "minWait", Message: fmt.Sprintf("next step not before %s (%s)", next.Format(time.RFC3339), next.Sub(now).Round(time.Second))})
+		}
+	}
+	if refused := annotations[rollout.VulnerabilitiesRefusedAnnotation]; strategy.VulnerabilityScan != nil && strings.HasPrefix(refused, candidate+": ") {
+		gates = append(gates, rolloutGate{Name: "vulnerabilities", Message: fmt.Sprintf("candidate refused promotion until its image passes the vulnerability scan, %s", strings.TrimPrefix(refused, candidate+": "))})
+	}
+	if len(strategy.HealthCriteria) != 0 {
+		gates = append(gates, rolloutGate{Name: "diagnosis", Message: fmt.Sprintf("candidate must be diagnosed healthy on %d health criteria", len(strategy.HealthCriteria))})
+	}
+	return gates
+}
+
+// printDescription prints the description of a service for humans.
+func printDescription(w io.Writer, d serviceDescription) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Service:\t%s\n", path.Join(d.Project, d.Region, d.Namespace, d.Service))
+	fmt.Fprintf(tw, "Strategy:\t%s\n", d.Strategy)
+	fmt.Fprintf(tw, "Phase:\t%s\n", d.Phase)
+	fmt.Fprintf(tw, "Stable:\t%s\n", orDash(d.Stable))
+	fmt.Fprintf(tw, "Candidate:\t%s (%d%%)\n", orDash(d.Candidate), d.CandidatePercent)
+	if d.LastChange != nil {
+		fmt.Fprintf(tw, "Last change:\t%s\n", d.LastChange.Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nTraffic:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  REVISION\tTAG\tPERCENT\tURL")
+	for _, t := range d.Traffic {
+		fmt.Fprintf(tw, "  %s\t%s\t%d%%\t%s\n", t.Revision, orDash(t.Tag), t.Percent, orDash(t.URL))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nPending gates:")
+	if len(d.PendingGates) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, gate := range d.PendingGates {
+		fmt.Fprintf(w, "  %s: %s\n", gate.Name, gate.Message)
+	}
+
+	// The reports are printed in their own section.
+	fmt.Fprintln(w, "\nAnnotations:")
+	var keys []string
+	for key := range d.Annotations {
+		if key != rollout.LastHealthReportAnnotation && key != rollout.LastHealthReportJSONAnnotation {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s: %s\n", key, d.Annotations[key])
+	}
+
+	fmt.Fprintln(w, "\nEffective strategy:")
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.EffectiveStrategy); err != nil {
+		return err
+	}
+	fmt.Fprint(w, indent(buf.String()))
+
+	fmt.Fprintln(w, "\nLast health report:")
+	report := d.LastHealthReportText
+	if d.LastHealthReport != nil {
+		rendered, err := health.RenderReport(config.TextReportFormat, *d.LastHealthReport, d.steps)
+		if err != nil {
+			return err
+		}
+		report = rendered
+	}
+	if report == "" {
+		report = "none"
+	}
+	fmt.Fprint(w, indent(report+"\n"))
+	return nil
+}
+
+// indent indents the lines of the text by two spaces.
+func indent(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// resetStyle removes the flow style of the nodes decoded from JSON.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// serviceDORA are the DORA metrics of a service, as printed by -dora.
+type serviceDORA struct {
+	Project           string  `json:"project" yaml:"project"`
+	Region            string  `json:"region" yaml:"region"`
+	Namespace         string  `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Service           string  `json:"service" yaml:"service"`
+	Window            string  `json:"window" yaml:"window"`
+	Deployments       int     `json:"deployments" yaml:"deployments"`
+	DeploymentsPerDay float64 `json:"deploymentsPerDay" yaml:"deploymentsPerDay"`
+	Rollbacks         int     `json:"rollbacks" yaml:"rollbacks"`
+	ChangeFailureRate float64 `json:"changeFailureRate" yaml:"changeFailureRate"`
+
+	// TimeToRestore is empty without rollback.
+	TimeToRestore string `json:"timeToRestore,omitempty" yaml:"timeToRestore,omitempty"`
+
+	timeToRestore time.Duration
+}
+
+// computeDORA computes the DORA metrics of the targeted services from the
+// history of their rollouts in the state store.
+func computeDORA(ctx context.Context, logger *logrus.Logger, cfg *config.Config, window time.Duration) ([]serviceDORA, error) {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get targeted services")
+	}
+	now := time.Now()
+	result := make([]serviceDORA, 0, len(svcs))
+	for _, svc := range svcs {
+		service := svc.service
+		rollouts, err := serviceHistory(ctx, path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name))
+		if err != nil {
+			return nil, err
+		}
+		dora := state.ComputeDORA(rollouts, now, window)
+		s := serviceDORA{
+			Project:           service.Project,
+			Region:            service.Region,
+			Namespace:         service.Namespace,
+			Service:           service.Metadata.Name,
+			Window:            window.String(),
+			Deployments:       dora.Deployments,
+			DeploymentsPerDay: dora.DeploymentsPerDay,
+			Rollbacks:         dora.Rollbacks,
+			ChangeFailureRate: dora.ChangeFailureRate,
+			timeToRestore:     dora.TimeToRestore,
+		}
+		if dora.Rollbacks != 0 {
+			s.TimeToRestore = dora.TimeToRestore.Round(time.Second).String()
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// printDORA prints the DORA metrics of the targeted services in the output
+// format.
+func printDORA(ctx context.Context, logger *logrus.Logger, cfg *config.Config, window time.Duration, output string, w io.Writer) error {
+	result, err := computeDORA(ctx, logger, cfg, window)
+	if err != nil {
+		return err
+	}
+	if ok, err := writeValues(w, output, result); ok {
+		return errors.Wrap(err, "failed to print DORA metrics")
+	}
+	switch output {
+	case jsonOutput:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(result), "failed to print DORA metrics")
+	case yamlOutput:
+		return errors.Wrap(yaml.NewEncoder(w).Encode(result), "failed to print DORA metrics")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tDEPLOYMENTS\tPER DAY\tROLLBACKS\tCHANGE FAILURE RATE\tTIME TO RESTORE")
+	for _, s := range result {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f\t%d\t%.0f%%\t%s\n", path.Join(s.Project, s.Region, s.Namespace, s.Service),
+			s.Deployments, s.DeploymentsPerDay, s.Rollbacks, s.ChangeFailureRate*100, orDash(s.TimeToRestore))
+	}
+	return errors.Wrap(tw.Flush(), "failed to print DORA metrics")
+}
+
+// reportDORA computes the DORA metrics of the targeted services every
+// interval, exposes them as metrics of the operator and logs them, until the
+// context is done.
+func reportDORA(ctx context.Context, logger *logrus.Logger, store *configStore, window, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		result, err := computeDORA(ctx, logger, store.Load(), window)
+		if err != nil {
+			logger.Warnf("could not compute DORA metrics: %v", err)
+		}
+		for _, s := range result {
+			labels := []string{s.Project, s.Region, s.Namespace, s.Service}
+			doraDeploymentFrequency.Set(s.DeploymentsPerDay, labels...)
+			doraChangeFailureRate.Set(s.ChangeFailureRate, labels...)
+			doraTimeToRestore.Set(s.timeToRestore.Seconds(), labels...)
+
+			logger.WithFields(logrus.Fields{
+				"event":             "doraReport",
+				"project":           s.Project,
+				"region":            s.Region,
+				"namespace":         s.Namespace,
+				"service":           s.Service,
+				"window":            s.Window,
+				"deployments":       s.Deployments,
+				"deploymentsPerDay": s.DeploymentsPerDay,
+				"rollbacks":         s.Rollbacks,
+				"changeFailureRate": s.ChangeFailureRate,
+				"timeToRestore":     s.TimeToRestore,
+			}).Info("DORA metrics")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
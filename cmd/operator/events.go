@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/event"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The latest revision of a changed service is checked every
+// eventReadyInterval until it is ready, for at most eventReadyTimeout.
+const (
+	eventReadyInterval = 5 * time.Second
+	eventReadyTimeout  = 2 * time.Minute
+)
+
+// makeEventHandler creates a request handler for the Cloud Audit Logs entries
+// of the changes to Cloud Run services, delivered by Eventarc or a Pub/Sub
+// push subscription. The rollout of a managed service with a new candidate is
+// handled right away, instead of at the next rollout cycle.
+//
+// The push requests must carry an ID token for -events-audience, since
+// anyone who can trigger the rollouts can skip the interval between the
+// traffic steps.
+func makeEventHandler(logger *logrus.Logger, store *configStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := authenticateEvent(req.Context(), req.Header.Get("Authorization")); err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("event rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, "could not read event", http.StatusBadRequest)
+			return
+		}
+		change, err := event.Parse(body)
+		if err != nil {
+			// Malformed events are not retried.
+			logger.Warnf("ignoring event: %v", err)
+			return
+		}
+		if change == nil {
+			return
+		}
+
+		lg := logger.WithFields(logrus.Fields{
+			"project": change.Project,
+			"service": change.Service,
+			"region":  change.Region,
+			"method":  change.Method,
+		})
+		ctx := req.Context()
+		if serviceListCache != nil {
+			// The service might be new or have new labels.
+			serviceListCache.Invalidate(change.Project, change.Region)
+		}
+		svc, err := findManagedService(ctx, logger, store.Load(), change.Project, change.Region, "", change.Service)
+		if err != nil {
+			lg.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if svc == nil || !inShard(*svc, flShardIndex, flShardCount) {
+			lg.Debug("service is not managed by this instance, ignoring event")
+			return
+		}
+		if err := handleServiceEvent(ctx, logger, lg, *svc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// authenticateEvent verifies the ID token of the push request, from its
+// authorization header, and that it was issued to one of
+// -events-service-accounts, if set.
+func authenticateEvent(ctx context.Context, header string) error {
+	if eventsVerifier == nil {
+		return errors.New("-events-audience is not set")
+	}
+	if !strings.HasPrefix(header, "Bearer ") {
+		return errors.New("no bearer token")
+	}
+	email, err := eventsVerifier.Verify(ctx, strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		return err
+	}
+	if flEventsServiceAccounts == "" {
+		return nil
+	}
+	for _, account := range strings.Split(flEventsServiceAccounts, ",") {
+		if strings.EqualFold(strings.TrimSpace(account), email) {
+			return nil
+		}
+	}
+	return errors.Errorf("service account %s may not push events", email)
+}
+
+// handleServiceEvent waits for the latest revision of the changed service to
+// be ready and handles the rollout of the service if it is a new candidate.
+//
+// The members of a release group are only handled with the other members, by
+// the rollout cycles.
+func handleServiceEvent(ctx context.Context, logger *logrus.Logger, lg *logrus.Entry, svc managedService) error {
+	if group := releaseGroupName(svc); group != "" {
+		lg.WithField("releaseGroup", group).Debug("service is in a release group, ignoring event")
+		return nil
+	}
+	deadline := time.Now().Add(eventReadyTimeout)
+	for {
+		record, err := refreshService(ctx, svc)
+		if err != nil {
+			return errors.Wrap(err, "failed to get changed service")
+		}
+		status := record.Status
+		if status.LatestCreatedRevisionName == status.LatestReadyRevisionName {
+			stable := rollout.DetectStableRevisionName(record.Service)
+			candidate := rollout.DetectCandidateRevisionName(record.Service, stable)
+			if candidate == "" || candidateTraffic(record.Service, candidate) != 0 {
+				lg.Debug("no new candidate, ignoring event")
+				return nil
+			}
+			lg.WithField("candidate", candidate).Info("new candidate deployed, handling rollout")
+			return handleRollout(ctx, logger, record, svc.strategy, nil)
+		}
+
+		if time.Now().Add(eventReadyInterval).After(deadline) {
+			// The revision might have failed, the next rollout cycle will
+			// pick it up if it becomes ready.
+			lg.Warnf("revision %q not ready after %s, ignoring event", status.LatestCreatedRevisionName, eventReadyTimeout)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(eventReadyInterval):
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Actions of the admin API on the whole fleet, authorized by the rules of
+// -admin-authorization-file that do not restrict the services.
+const (
+	pauseFleetAction  = "pause-fleet"
+	resumeFleetAction = "resume-fleet"
+)
+
+// fleetPauseState is the fleet-wide pause of the traffic changes, the kill
+// switch of the operator during major incidents. While paused, the rollouts
+// only diagnose the candidates and the job rollouts are skipped, but the
+// actions of the admin API still apply.
+//
+// The pause is set with -fleet-paused or with the admin API. With a state
+// store, it is saved in the store and every replica reads it at the start of
+// each cycle, so it applies to all the replicas and survives restarts.
+// Without a store, it only applies to the replica that set it, until it
+// restarts.
+type fleetPauseState struct {
+	mu     sync.Mutex
+	status fleetPauseStatus
+}
+
+// fleetPauseStatus is the state of the fleet-wide pause, as returned by the
+// admin API.
+type fleetPauseStatus struct {
+	Paused    bool       `json:"paused"`
+	Since     *time.Time `json:"since,omitempty"`
+	Principal string     `json:"principal,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+var fleetPause fleetPauseState
+
+// paused determines if the traffic changes are paused fleet-wide.
+func (f *fleetPauseState) paused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status.Paused
+}
+
+// get returns the state of the pause.
+func (f *fleetPauseState) get() fleetPauseStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// set pauses or resumes the traffic changes, on behalf of the principal. The
+// pause is saved in the state store, if any.
+func (f *fleetPauseState) set(ctx context.Context, logger *logrus.Logger, paused bool, principal, reason string) (fleetPauseStatus, error) {
+	status := fleetPauseStatus{Paused: paused}
+	if paused {
+		now := time.Now()
+		status.Since, status.Principal, status.Reason = &now, principal, reason
+	}
+	if stateStore != nil {
+		st := &state.State{}
+		if paused {
+			st.FleetPause = &state.FleetPause{Since: *status.Since, Principal: principal, Reason: reason}
+		}
+		if err := stateStore.Put(ctx, state.FleetKey, st); err != nil {
+			return f.get(), errors.Wrap(err, "failed to save the fleet-wide pause")
+		}
+	}
+	return f.apply(logger, status, principal), nil
+}
+
+// refresh reads the pause from the state store, if any, so a pause set by
+// another replica applies to the cycle. The current pause is kept if the
+// store cannot be read.
+func (f *fleetPauseState) refresh(ctx context.Context, logger *logrus.Logger) {
+	if stateStore == nil {
+		return
+	}
+	st, err := stateStore.Get(ctx, state.FleetKey)
+	if err != nil {
+		logger.Warnf("failed to read the fleet-wide pause, keeping the current one: %v", err)
+		return
+	}
+	status := fleetPauseStatus{}
+	if st != nil && st.FleetPause != nil {
+		since := st.FleetPause.Since
+		status = fleetPauseStatus{Paused: true, Since: &since, Principal: st.FleetPause.Principal, Reason: st.FleetPause.Reason}
+	}
+	f.apply(logger, status, status.Principal)
+}
+
+// apply replaces the state of the pause, logging its change, if any.
+func (f *fleetPauseState) apply(logger *logrus.Logger, status fleetPauseStatus, principal string) fleetPauseStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status.Paused == f.status.Paused {
+		return f.status
+	}
+	f.status = status
+	lg := logger.WithFields(logrus.Fields{"event": "fleetPause", "paused": status.Paused, "principal": principal})
+	if status.Paused {
+		lg.WithField("reason", status.Reason).Warn("traffic changes paused fleet-wide, the rollouts only observe the candidates")
+		fleetPaused.Set(1)
+	} else {
+		lg.Warn("traffic changes resumed fleet-wide")
+		fleetPaused.Set(0)
+	}
+	return f.status
+}
+
+// logCycle logs that the traffic changes of the rollout cycle are paused, if
+// they are.
+func (f *fleetPauseState) logCycle(logger *logrus.Logger) {
+	status := f.get()
+	if !status.Paused {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"event":     "fleetPause",
+		"since":     status.Since.Format(time.RFC3339),
+		"principal": status.Principal,
+		"reason":    status.Reason,
+	}).Warn("fleet-wide pause in effect, traffic changes suspended")
+}
+
+// makeFleetHandler creates a request handler for the fleet-wide pause in the
+// admin API:
+//
+//	GET  /fleet         state of the pause
+//	POST /fleet:pause   pause the traffic changes (optional reason parameter)
+//	POST /fleet:resume  resume the traffic changes
+func makeFleetHandler(logger *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		principal, err := authenticateAdmin(ctx, req.Header.Get("Authorization"))
+		if err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("admin API request rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		action := viewAction
+		switch strings.TrimPrefix(req.URL.Path, "/fleet") {
+		case "":
+		case ":pause":
+			action = pauseFleetAction
+		case ":resume":
+			action = resumeFleetAction
+		default:
+			http.Error(w, "path must be /fleet[:pause|:resume]", http.StatusNotFound)
+			return
+		}
+		if action == viewAction && req.Method != http.MethodGet || action != viewAction && req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !adminAllowed(principal, action, "", "", "") {
+			logger.WithFields(logrus.Fields{"action": action, "principal": principal}).Warn("admin action denied")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if action == viewAction {
+			fleetPause.refresh(ctx, logger)
+			writeJSON(w, fleetPause.get())
+			return
+		}
+		status, err := fleetPause.set(ctx, logger, action == pauseFleetAction, principal, req.URL.Query().Get("reason"))
+		if err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, status)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"path"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// releaseGroupName returns the release group of the service, if any.
+func releaseGroupName(svc managedService) string {
+	return svc.service.Metadata.Annotations[rollout.ReleaseGroupAnnotation]
+}
+
+// unitKey returns the key of the unit of the service: the release group of
+// the service in its project, or the service itself.
+func unitKey(svc managedService) string {
+	if group := releaseGroupName(svc); group != "" {
+		return path.Join(svc.service.Project, "releaseGroups", group)
+	}
+	return path.Join(svc.service.Project, svc.service.Region, svc.service.Namespace, svc.service.Metadata.Name)
+}
+
+// releaseGroupUnits splits the services into the units handled at once: a
+// service alone, or all the members of a release group, in the order of the
+// first member of the group.
+func releaseGroupUnits(svcs []managedService) [][]managedService {
+	var units [][]managedService
+	groups := make(map[string]int)
+	for _, svc := range svcs {
+		if releaseGroupName(svc) == "" {
+			units = append(units, []managedService{svc})
+			continue
+		}
+		key := unitKey(svc)
+		if i, ok := groups[key]; ok {
+			units[i] = append(units[i], svc)
+			continue
+		}
+		groups[key] = len(units)
+		units = append(units, []managedService{svc})
+	}
+	return units
+}
+
+// handleUnit handles the rollout of the services of the unit, and returns the
+// errors. skipped is the number of services skipped because the pass exceeded
+// -cycle-timeout.
+func handleUnit(ctx context.Context, logger *logrus.Logger, unit []managedService) (errs []error, skipped int) {
+	if ctx.Err() != nil {
+		for _, svc := range unit {
+			skipService(logger, svc.service)
+		}
+		return nil, len(unit)
+	}
+	if releaseGroupName(unit[0]) != "" {
+		return handleReleaseGroup(ctx, logger, unit), 0
+	}
+
+	svc := unit[0]
+	service, err := currentService(ctx, svc)
+	if err == nil {
+		err = handleRolloutWithTimeout(ctx, logger, service, svc.strategy, nil)
+	}
+	if err != nil {
+		logger.Debugf("rollout error for service %q: %+v", svc.service.Metadata.Name, err)
+		return []error{err}, 0
+	}
+	return nil, 0
+}
+
+// handleReleaseGroup handles the rollout of the members of a release group,
+// sequentially, so their candidates advance in lockstep and the candidates
+// of the dependents wait for those of their dependencies.
+//
+// The members handled before a member whose candidate is unhealthy are
+// handled again, so all the candidates of the group are rolled back in the
+// same cycle.
+func handleReleaseGroup(ctx context.Context, logger *logrus.Logger, members []managedService) (errs []error) {
+	name := releaseGroupName(members[0])
+	lg := logger.WithFields(logrus.Fields{"project": members[0].service.Project, "releaseGroup": name})
+
+	// The state of the group is derived from the current traffic of all
+	// the members, so the group is not handled if any is unknown.
+	records := make([]*rollout.ServiceRecord, len(members))
+	for i, svc := range members {
+		record, err := refreshService(ctx, svc)
+		if err != nil {
+			return []error{errors.Wrapf(err, "release group %q skipped", name)}
+		}
+		records[i] = record
+	}
+	group, err := rollout.NewReleaseGroup(name, records)
+	if err != nil {
+		return []error{err}
+	}
+
+	failedAt := -1
+	for i, svc := range members {
+		if err := handleRolloutWithTimeout(ctx, logger, records[i], svc.strategy, group); err != nil {
+			logger.Debugf("rollout error for service %q: %+v", svc.service.Metadata.Name, err)
+			errs = append(errs, err)
+		}
+		if failedAt == -1 && group.Failed() != "" {
+			failedAt = i
+		}
+	}
+	for i := 0; i < failedAt; i++ {
+		record, err := refreshService(ctx, members[i])
+		if err == nil {
+			err = handleRolloutWithTimeout(ctx, logger, record, members[i].strategy, group)
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to roll back release group %q", name))
+		}
+	}
+
+	lg.WithFields(logrus.Fields{
+		"event":        "releaseGroup",
+		"step":         group.Step(),
+		"failedMember": group.Failed(),
+		"members":      group.Members(),
+	}).Info("release group handled")
+	return errs
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rolloutapi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Phases of the gRPC API, by phase of the admin API.
+var apiPhases = map[string]rolloutapi.Phase{
+	stablePhase:     rolloutapi.PhaseStable,
+	rollingOutPhase: rolloutapi.PhaseRollingOut,
+	rolledBackPhase: rolloutapi.PhaseRolledBack,
+	pausedPhase:     rolloutapi.PhasePaused,
+	unhealthyPhase:  rolloutapi.PhaseUnhealthy,
+}
+
+// rolloutAPIServer implements the gRPC API with the same operations as the
+// admin API.
+type rolloutAPIServer struct {
+	logger *logrus.Logger
+	store  *configStore
+
+	// stop is closed when the operator shuts down, which ends the watches.
+	stop <-chan struct{}
+}
+
+// serveGRPC serves the gRPC API at -grpc-addr until stop is closed. The
+// requests in progress are then given -shutdown-timeout to complete.
+func serveGRPC(logger *logrus.Logger, store *configStore, stop <-chan struct{}) {
+	listener, err := net.Listen("tcp", flGRPCAddr)
+	if err != nil {
+		logger.Fatalf("failed to listen for gRPC requests: %v", err)
+	}
+	api := &rolloutAPIServer{logger: logger, store: store, stop: stop}
+	server := grpc.NewServer(grpc.UnaryInterceptor(api.authenticateUnary), grpc.StreamInterceptor(api.authenticateStream))
+	rolloutapi.RegisterServer(server, api)
+	go func() {
+		<-stop
+		timer := time.AfterFunc(flShutdownTimeout, server.Stop)
+		server.GracefulStop()
+		timer.Stop()
+	}()
+	logger.WithField("addr", flGRPCAddr).Info("starting gRPC server")
+	if err := server.Serve(listener); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// principalKey is the key of the principal of the gRPC requests in their
+// context.
+type principalKey struct{}
+
+// authenticateUnary rejects the requests that are not authenticated like the
+// requests to the admin API, and adds their principal to their context.
+func (s *rolloutAPIServer) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticateStream is the authenticateUnary of the streams.
+func (s *rolloutAPIServer) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream is a stream with the principal in its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *rolloutAPIServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization string
+	if values := md.Get("authorization"); len(values) != 0 {
+		authorization = values[0]
+	}
+	principal, err := authenticateAdmin(ctx, authorization)
+	if err != nil {
+		s.logger.WithField("method", method).Warnf("gRPC API request rejected: %v", err)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return context.WithValue(ctx, principalKey{}, principal), nil
+}
+
+// principal returns the principal of the request.
+func principal(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// authorize rejects the action of the principal of the request on the
+// service if -admin-authorization-file does not allow it.
+func (s *rolloutAPIServer) authorize(ctx context.Context, action string, ref *rolloutapi.RolloutRef) error {
+	if adminAllowed(principal(ctx), action, ref.Project, ref.Region, ref.Service) {
+		return nil
+	}
+	auditLogger(s.logger, principal(ctx), action, ref.Project, ref.Region, ref.Service).Warn("admin action denied")
+	return status.Error(codes.PermissionDenied, "forbidden")
+}
+
+// allowed returns the states the principal of the request may view.
+func allowed(ctx context.Context, states []*rolloutapi.RolloutState) []*rolloutapi.RolloutState {
+	var result []*rolloutapi.RolloutState
+	for _, state := range states {
+		if adminAllowed(principal(ctx), viewAction, state.Project, state.Region, state.Service) {
+			result = append(result, state)
+		}
+	}
+	return result
+}
+
+// ListRollouts implements rolloutapi.Server.
+func (s *rolloutAPIServer) ListRollouts(ctx context.Context) ([]*rolloutapi.RolloutState, error) {
+	svcs, err := getManagedServices(ctx, s.logger, s.store.Load())
+	if err != nil {
+		s.logger.Warn(err)
+		return nil, err
+	}
+	states := make([]*rolloutapi.RolloutState, 0, len(svcs))
+	for _, svc := range svcs {
+		states = append(states, newRolloutState(newAdminService(svc)))
+	}
+	return allowed(ctx, states), nil
+}
+
+// GetRollout implements rolloutapi.Server.
+func (s *rolloutAPIServer) GetRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.Rollout, error) {
+	if err := s.authorize(ctx, viewAction, ref); err != nil {
+		return nil, err
+	}
+	svc, err := s.findService(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	result, err := diagnoseService(ctx, s.logger, *svc)
+	if err != nil {
+		s.logger.Warn(err)
+		return nil, err
+	}
+	return &rolloutapi.Rollout{State: newRolloutState(result), Diagnosis: newAPIDiagnosis(result.Diagnosis)}, nil
+}
+
+// PauseRollout implements rolloutapi.Server.
+func (s *rolloutAPIServer) PauseRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control(ctx, ref, pauseAction)
+}
+
+// ResumeRollout implements rolloutapi.Server.
+func (s *rolloutAPIServer) ResumeRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control(ctx, ref, resumeAction)
+}
+
+// PromoteRollout implements rolloutapi.Server.
+func (s *rolloutAPIServer) PromoteRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control(ctx, ref, promoteAction)
+}
+
+// AbortRollout implements rolloutapi.Server.
+func (s *rolloutAPIServer) AbortRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control(ctx, ref, abortAction)
+}
+
+// control applies the admin action to the rollout of the service and returns
+// its new state.
+func (s *rolloutAPIServer) control(ctx context.Context, ref *rolloutapi.RolloutRef, action string) (*rolloutapi.RolloutState, error) {
+	if err := s.authorize(ctx, action, ref); err != nil {
+		return nil, err
+	}
+	svc, err := s.findService(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := handleAdminAction(ctx, s.logger, *svc, action, principal(ctx)); err != nil {
+		return nil, err
+	}
+	if svc.service, err = refreshService(ctx, *svc); err != nil {
+		s.logger.Warn(err)
+		return nil, err
+	}
+	return newRolloutState(newAdminService(*svc)), nil
+}
+
+// WatchRollouts implements rolloutapi.Server. The managed services are
+// retrieved every -grpc-watch-interval, and only the states that changed
+// since they were last sent are sent again.
+func (s *rolloutAPIServer) WatchRollouts(ctx context.Context, req *rolloutapi.WatchRolloutsRequest, send func(*rolloutapi.RolloutState) error) error {
+	sent := make(map[string]rolloutapi.RolloutState)
+	ticker := time.NewTicker(flGRPCWatchInterval)
+	defer ticker.Stop()
+	for {
+		svcs, err := getManagedServices(ctx, s.logger, s.store.Load())
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// The watch goes on, the services are retrieved again at the next
+			// interval.
+			s.logger.Warnf("failed to get managed services for watch: %v", err)
+		}
+		for _, svc := range svcs {
+			state := newRolloutState(newAdminService(svc))
+			service := svc.service
+			if !req.Matches(state) || !adminAllowed(principal(ctx), viewAction, service.Project, service.Region, service.Metadata.Name) {
+				continue
+			}
+			key := path.Join(state.Project, state.Region, state.Namespace, state.Service)
+			if previous, ok := sent[key]; ok && previous == *state {
+				continue
+			}
+			if err := send(state); err != nil {
+				return err
+			}
+			sent[key] = *state
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// findService returns the managed service of the reference, retrieved again
+// to get its current state.
+func (s *rolloutAPIServer) findService(ctx context.Context, ref *rolloutapi.RolloutRef) (*managedService, error) {
+	svc, err := findManagedService(ctx, s.logger, s.store.Load(), ref.Project, ref.Region, ref.Namespace, ref.Service)
+	if err != nil {
+		s.logger.Warn(err)
+		return nil, err
+	}
+	if svc == nil {
+		return nil, errors.Wrapf(rolloutapi.ErrNotFound, "service %s", path.Join(ref.Project, ref.Region, ref.Namespace, ref.Service))
+	}
+	if svc.service, err = refreshService(ctx, *svc); err != nil {
+		s.logger.Warn(err)
+		return nil, err
+	}
+	return svc, nil
+}
+
+// newRolloutState returns the state of the gRPC API of the managed service.
+func newRolloutState(svc adminService) *rolloutapi.RolloutState {
+	return &rolloutapi.RolloutState{
+		Project:          svc.Project,
+		Region:           svc.Region,
+		Namespace:        svc.Namespace,
+		Service:          svc.Name,
+		Strategy:         svc.Strategy,
+		Phase:            apiPhases[svc.Phase],
+		Stable:           svc.Stable,
+		Candidate:        svc.Candidate,
+		CandidatePercent: svc.CandidatePercent,
+		LastRollout:      svc.LastRollout,
+	}
+}
+
+// newAPIDiagnosis returns the diagnosis of the gRPC API of the health report.
+func newAPIDiagnosis(report *health.Report) *rolloutapi.Diagnosis {
+	if report == nil {
+		return nil
+	}
+	diagnosis := &rolloutapi.Diagnosis{
+		Status:      report.Status,
+		Message:     report.Message,
+		Window:      report.Window,
+		Candidate:   report.Candidate,
+		TrafficStep: report.TrafficStep,
+	}
+	for _, check := range report.Checks {
+		apiCheck := &rolloutapi.Check{
+			Criterion:     check.Criterion,
+			Metric:        string(check.Metric),
+			Percentile:    check.Percentile,
+			Operation:     check.Operation,
+			Threshold:     check.Threshold,
+			IsCriteriaMet: check.IsCriteriaMet,
+			Reason:        check.Reason,
+		}
+		if check.ActualValue != nil {
+			apiCheck.ActualValue = wrapperspb.Double(*check.ActualValue)
+		}
+		diagnosis.Checks = append(diagnosis.Checks, apiCheck)
+	}
+	return diagnosis
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2/google"
+)
+
+// readinessCheckTTL is the time the result of the readiness checks is reused,
+// so frequent probes do not call the APIs every time.
+const readinessCheckTTL = 30 * time.Second
+
+// readinessCheckTimeout is the maximum time each readiness check can take.
+const readinessCheckTimeout = 5 * time.Second
+
+// readinessEndpoints are the APIs the operator must reach to manage the
+// rollouts.
+var readinessEndpoints = map[string]string{
+	"Cloud Run API":        "https://run.googleapis.com/",
+	"Cloud Monitoring API": "https://monitoring.googleapis.com/",
+}
+
+// lastProgress is the Unix time, in nanoseconds, the operator last made
+// progress: completed a discovery of the services or a rollout cycle.
+var lastProgress = time.Now().UnixNano()
+
+// markProgress records that the operator made progress.
+func markProgress() {
+	atomic.StoreInt64(&lastProgress, time.Now().UnixNano())
+}
+
+// makeLivenessHandler creates a request handler that fails if the operator
+// made no progress for longer than maxStaleness, e.g. because it is wedged,
+// so the platform restarts it. Zero disables the check.
+func makeLivenessHandler(maxStaleness time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		since := time.Since(time.Unix(0, atomic.LoadInt64(&lastProgress)))
+		if maxStaleness > 0 && since > maxStaleness {
+			http.Error(w, fmt.Sprintf("no rollout cycle completed for %s", since.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// readinessChecker verifies the operator has credentials and can reach the
+// APIs it needs.
+type readinessChecker struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func newReadinessChecker() *readinessChecker {
+	return &readinessChecker{client: &http.Client{Timeout: readinessCheckTimeout}}
+}
+
+// check returns the result of the checks, reused for readinessCheckTTL.
+func (c *readinessChecker) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < readinessCheckTTL {
+		return c.err
+	}
+	c.err = c.run(ctx)
+	c.checkedAt = time.Now()
+	return c.err
+}
+
+func (c *readinessChecker) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	ts := googleTokenSource
+	if ts == nil {
+		creds, err := google.FindDefaultCredentials(ctx, cloudPlatformScope)
+		if err != nil {
+			return errors.Wrap(err, "failed to find credentials")
+		}
+		ts = creds.TokenSource
+	}
+	if _, err := ts.Token(); err != nil {
+		return errors.Wrap(err, "failed to get an access token")
+	}
+
+	var failed []string
+	for name, endpoint := range readinessEndpoints {
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create request to %s", name)
+		}
+		// Any response shows the API is reachable.
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		resp.Body.Close()
+	}
+	if len(failed) != 0 {
+		return errors.Errorf("unreachable APIs: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// makeReadinessHandler creates a request handler that fails if the operator
+// has no credentials or cannot reach the APIs.
+func makeReadinessHandler(logger *logrus.Logger, checker *readinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := checker.check(req.Context()); err != nil {
+			logger.Warnf("readiness check failed: %v", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
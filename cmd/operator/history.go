@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// printHistory prints the past rollouts of the targeted services, read from
+// the state store.
+func printHistory(ctx context.Context, logger *logrus.Logger, cfg *config.Config, w io.Writer) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	for i, svc := range svcs {
+		service := svc.service
+		key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+		rollouts, err := serviceHistory(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", key)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CANDIDATE\tSTART\tEND\tOUTCOME\tSTEPS")
+		for _, r := range rollouts {
+			end, outcome := "-", "inProgress"
+			if r.End != nil {
+				end, outcome = r.End.Format(time.RFC3339), r.Outcome
+			}
+			var steps []string
+			for _, step := range r.Steps {
+				s := fmt.Sprintf("%d%%", step.Percent)
+				if step.Duration != "" {
+					s += fmt.Sprintf(" (%s)", step.Duration)
+				}
+				steps = append(steps, s)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Candidate, r.Start.Format(time.RFC3339), end, outcome, strings.Join(steps, ", "))
+		}
+		if err := tw.Flush(); err != nil {
+			return errors.Wrap(err, "failed to print history")
+		}
+	}
+	return nil
+}
+
+// serviceHistory returns the past rollouts of the service with the key,
+// oldest first.
+func serviceHistory(ctx context.Context, key string) ([]state.Rollout, error) {
+	st, err := stateStore.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get rollout state of %s", key)
+	}
+	if st == nil {
+		return []state.Rollout{}, nil
+	}
+	rollouts := st.Rollouts()
+	if rollouts == nil {
+		rollouts = []state.Rollout{}
+	}
+	return rollouts, nil
+}
+
+// makeHistoryHandler creates a request handler that returns the past rollouts
+// of the service identified by the project, region, service and, for Knative
+// Serving, namespace query parameters. The requests are authenticated and
+// authorized like the requests to the admin API.
+func makeHistoryHandler(logger *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		principal, err := authenticateAdmin(req.Context(), req.Header.Get("Authorization"))
+		if err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("history request rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if stateStore == nil {
+			http.Error(w, "no state store is configured", http.StatusNotFound)
+			return
+		}
+		query := req.URL.Query()
+		project, region, service := query.Get("project"), query.Get("region"), query.Get("service")
+		if project == "" || region == "" || service == "" {
+			http.Error(w, "project, region and service are required", http.StatusBadRequest)
+			return
+		}
+		if !adminAllowed(principal, viewAction, project, region, service) {
+			auditLogger(logger, principal, viewAction, project, region, service).Warn("admin action denied")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		rollouts, err := serviceHistory(req.Context(), path.Join(project, region, query.Get("namespace"), service))
+		if err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rollouts)
+	}
+}
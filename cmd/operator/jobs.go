@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"path"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/jobrollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// runJobRollouts handles the rollout of the Cloud Run jobs targeted by the
+// strategies with a job canary configuration. A job targeted by several
+// strategies is managed by the one with the highest precedence.
+//
+// The jobs are handled sequentially, since a step of their rollout only
+// starts or checks an asynchronous operation.
+func runJobRollouts(ctx context.Context, logger *logrus.Logger, cfg *config.Config) (errs []error) {
+	if fleetPause.paused() {
+		logger.Debug("fleet-wide pause, job rollouts skipped")
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, strategy := range cfg.StrategiesByPrecedence() {
+		if strategy.JobCanary == nil {
+			continue
+		}
+		target := strategy.Target
+		projects, err := determineProjects(ctx, logger, target)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "cannot determine projects"))
+			continue
+		}
+		for _, project := range projects {
+			projectTarget := target
+			projectTarget.Project = project
+			regions, err := determineRegions(ctx, logger, projectTarget)
+			if err != nil {
+				errs = append(errs, errors.Wrap(err, "cannot determine regions"))
+				continue
+			}
+			for _, region := range regions {
+				if ctx.Err() != nil {
+					return append(errs, errors.Wrap(ctx.Err(), "job rollouts canceled"))
+				}
+				errs = append(errs, rolloutJobs(ctx, logger, projectTarget, *strategy.JobCanary, region, seen)...)
+			}
+		}
+	}
+	return errs
+}
+
+// rolloutJobs handles the rollout of the jobs of the target in the region,
+// except those already seen.
+func rolloutJobs(ctx context.Context, logger *logrus.Logger, target config.Target, canary config.JobCanary, region string, seen map[string]bool) (errs []error) {
+	client, err := newJobsClient(ctx, target, target.Project, region)
+	if err != nil {
+		return []error{err}
+	}
+	jobs, err := client.JobsWithLabelSelector(target.Project, target.LabelSelector)
+	if err != nil {
+		return []error{errors.Wrapf(err, "failed to get jobs with label %q in region %q", target.LabelSelector, region)}
+	}
+	for _, job := range jobs {
+		key := path.Join(target.Project, region, job.ID())
+		if seen[key] || !target.MatchesService(job.ID()) || job.Annotations[jobrollout.CanaryOfAnnotation] != "" {
+			continue
+		}
+		seen[key] = true
+
+		roll := jobrollout.New(ctx, client, job, target.Project, region, canary).WithLogger(logger).WithNotifier(notifier)
+		decision, err := roll.Rollout()
+		if err != nil {
+			logger.Debugf("rollout error for job %q: %+v", job.ID(), err)
+			errs = append(errs, errors.Wrapf(err, "rollout failed for job %q", job.ID()))
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"event":    "jobDecision",
+			"project":  target.Project,
+			"region":   region,
+			"job":      job.ID(),
+			"decision": decision,
+		}).Debug("job rollout cycle finished")
+	}
+	return errs
+}
+
+// newJobsClient initializes the client of the Cloud Run jobs of the region,
+// authenticated as the identity used in the project.
+func newJobsClient(ctx context.Context, target config.Target, project, region string) (runapi.JobsClient, error) {
+	opts, err := apiOptions(runAPITransport, googleCredentials, serviceAccountFor(target, project))
+	if err != nil {
+		return nil, err
+	}
+	client, err := runapi.NewAPIv2Client(ctx, region, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Run jobs client")
+	}
+	return client, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/lock"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultLockCollection is the Firestore collection of the leases if the
+// -lock location does not specify one.
+const defaultLockCollection = "rolloutLocks"
+
+// lockerFromFlags returns the locker at the -lock location.
+func lockerFromFlags(ctx context.Context) (lock.Locker, error) {
+	u, err := url.Parse(flLock)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid lock location")
+	}
+	holder := lock.NewHolderIdentity()
+	switch {
+	case u.Scheme == "firestore" && u.Host != "":
+		collection := strings.Trim(u.Path, "/")
+		if collection == "" {
+			collection = defaultLockCollection
+		}
+		return lock.NewFirestore(ctx, u.Host, collection, holder, flLockDuration, googleCredentials...)
+	case u.Scheme == "kubernetes" && u.Host != "":
+		client, err := sharedKubeClient(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Kubernetes client")
+		}
+		return lock.NewKubernetes(client, u.Host, holder, flLockDuration), nil
+	}
+	return nil, errors.Errorf("invalid lock location %q, must be firestore://PROJECT[/COLLECTION] or kubernetes://NAMESPACE", flLock)
+}
+
+// withServiceLock runs fn while holding the lease on the service with the
+// key, if locks are configured. It returns false without running fn if
+// another replica holds the lease.
+func withServiceLock(ctx context.Context, lg *logrus.Entry, key string, fn func() error) (bool, error) {
+	if serviceLocker == nil {
+		return true, fn()
+	}
+	acquired, err := serviceLocker.Acquire(ctx, key)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to acquire lock")
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer func() {
+		if err := serviceLocker.Release(ctx, key); err != nil {
+			lg.Warnf("could not release lock: %v", err)
+		}
+	}()
+	return true, fn()
+}
@@ -18,22 +18,93 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/adminauth"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/chaos"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/cloudtrace"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/configsource"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/custommetrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/format"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/httpjson"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/lock"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/sheets"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/prometheus"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/ratelimit"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/signature"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/stackdriver"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/tracing"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/metricsplugin"
 	sdlog "github.com/TV4/logrus-stackdriver-formatter"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
+// metricsRequestTimeout is the maximum time a request to an HTTP-based metrics
+// provider can take.
+const metricsRequestTimeout = 30 * time.Second
+
+// policyRequestTimeout is the maximum time the evaluation of the policy by the
+// policy engine can take.
+const policyRequestTimeout = 10 * time.Second
+
+// metricsPluginStartTimeout is the maximum time a launched metrics plugin can
+// take to start listening.
+const metricsPluginStartTimeout = 10 * time.Second
+
+type headerFlags map[string]string
+
+func (headers headerFlags) Set(header string) error {
+	parts := strings.SplitN(header, ":", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("header must have the form 'Key: Value', got %q", header)
+	}
+	headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+func (headers headerFlags) String() string {
+	var value string
+	for key, val := range headers {
+		value += fmt.Sprintf(" %s: %s", key, val)
+	}
+	return value
+}
+
+type envFlags map[string]string
+
+func (env envFlags) Set(variable string) error {
+	parts := strings.SplitN(variable, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.Errorf("environment variable must have the form 'NAME=value', got %q", variable)
+	}
+	env[parts[0]] = parts[1]
+	return nil
+}
+
+func (env envFlags) String() string {
+	var value string
+	for name, val := range env {
+		value += fmt.Sprintf(" %s=%s", name, val)
+	}
+	return value
+}
+
 type stepFlags []int64
 
 func (steps *stepFlags) Set(step string) error {
@@ -56,29 +127,328 @@ func (steps stepFlags) String() string {
 
 var (
 	flLoggingLevel       string
+	flLogFormat          string
 	flCLI                bool
 	flCLILoopIntervalSec int
+	flScheduleJitter     float64
 	flHTTPAddr           string
-	flProject            string
-	flLabelSelector      string
+	flShutdownTimeout    time.Duration
+	flMetricsAddr        string
+	flLivenessIntervals  int
+	flTracingExporter    string
+
+	// Configuration file flags.
+	flConfigFile           string
+	flConfigProfile        string
+	flConfigReloadInterval time.Duration
+	flConfigCanary         string
+	flPrintConfigSchema    bool
+	flValidate             bool
+	flPreflight            bool
+
+	flProject       string
+	flFolder        string
+	flOrganization  string
+	flProjectFilter string
+	flPlatform      string
+	flNamespace     string
+	flLabelSelector string
 
 	// Empty array means all regions.
 	flRegions       []string
 	flRegionsString string
 
+	flIncludeRegionsString string
+	flExcludeRegionsString string
+
+	flIncludeServicesString   string
+	flExcludeServicesString   string
+	flServiceNameRegex        string
+	flExcludeServiceNameRegex string
+
 	// Rollout strategy-related flags.
 	flSteps              stepFlags
 	flStepsString        string
 	flHealthOffsetMinute int
 	flTimeBeweenRollouts time.Duration
+	flMetricsTimeout     time.Duration
+	flRecordSamples      bool
+	flStuckAfter         time.Duration
+	flOnUnhealthy        string
+	flHealthyChecks      int
+	flTrafficSplitSkew   float64
+	flCompareWithStable  bool
+	flReportFormat       string
+	flProtocol           string
 	flMinRequestCount    int
 	flErrorRate          float64
 	flLatencyP99         float64
 	flLatencyP95         float64
 	flLatencyP50         float64
 
+	// Trace criteria flags.
+	flTraceOperation     string
+	flTraceMaxErrorRate  float64
+	flTraceLatencyP95    float64
+	flTraceRevisionLabel string
+
+	// Probe flags.
+	flProbePath         string
+	flProbeStatus       int
+	flProbeMaxLatency   time.Duration
+	flProbeBodyRegex    string
+	flProbeRequests     int
+	flProbeMinSuccess   float64
+	flProbeAuthenticate bool
+
+	// Warm-up flags.
+	flWarmUpRPS          int
+	flWarmUpDuration     time.Duration
+	flWarmUpMethod       string
+	flWarmUpPath         string
+	flWarmUpBody         string
+	flWarmUpHeaders      = headerFlags{}
+	flWarmUpAuthenticate bool
+
+	// Shadow traffic flags.
+	flShadowControlURL    string
+	flShadowSamplePercent float64
+	flShadowDuration      time.Duration
+
+	// Attestation and vulnerability scan flags.
+	flRequiredAttestors        string
+	flMaxVulnerabilitySeverity string
+	flIgnoredVulnerabilities   string
+
+	// Job canary flags.
+	flJobCanary            bool
+	flJobCanaryArgs        string
+	flJobCanaryEnv         = envFlags{}
+	flJobCanaryTimeout     time.Duration
+	flJobCanaryMaxDuration time.Duration
+
 	// Metrics provider flags.
-	flGoogleSheetsID string
+	flGoogleSheetsID            string
+	flPrometheusURL             string
+	flPrometheusRequestCountQry string
+	flPrometheusErrorRateQry    string
+	flPrometheusLatencyQry      string
+	flJSONRequestCountURL       string
+	flJSONRequestCountPath      string
+	flJSONErrorRateURL          string
+	flJSONErrorRatePath         string
+	flJSONLatencyURL            string
+	flJSONLatencyPath           string
+	flJSONHeaders               = headerFlags{}
+	flMetricsPluginAddr         string
+	flStateStore                string
+	flArchive                   string
+	flCustomMetrics             bool
+	flLock                      string
+	flLockDuration              time.Duration
+	flShardIndex                int
+	flShardCount                int
+	flMetricsPluginBinary       string
+	flMetricsCacheTTL           time.Duration
+
+	// Notification flags.
+	flSlackWebhookURL      string
+	flGoogleChatWebhookURL string
+	flTeamsWebhookURL      string
+	flPagerDutyRoutingKey  string
+	flOpsgenieAPIKey       string
+	flOpsgenieAPIURL       string
+	flJiraURL              string
+	flJiraEmail            string
+	flJiraAPIToken         string
+	flJiraProject          string
+	flJiraIssueType        string
+	flEmailFrom            string
+	flEmailTo              string
+	flSMTPAddr             string
+	flSMTPUsername         string
+	flSMTPPassword         string
+	flSendGridAPIKey       string
+	flWebhookURL           string
+	flWebhookTemplateFile  string
+	flWebhookSecret        string
+	flWebhookHeaders       = headerFlags{}
+	flWebhookMaxRetries    int
+	flCloudEventsURL       string
+	flCloudEventsTopic     string
+	flPubSubTopic          string
+	flBigQueryTable        string
+	flDecisionLogID        string
+	flGrafanaURL           string
+	flGrafanaAPIKey        string
+	flGrafanaDashboardUID  string
+	flGitHubRepo           string
+	flGitHubToken          string
+	flGitHubAPIURL         string
+	flGitHubPRComments     bool
+	flGitLabProject        string
+	flGitLabToken          string
+	flGitLabURL            string
+
+	// Single-shot flags.
+	flOnce        bool
+	flRunOnce     bool
+	flWait        bool
+	flWaitTimeout time.Duration
+	flProgress    string
+	flOut         string
+
+	// History flags.
+	flHistory bool
+
+	// DORA flags.
+	flDORA               bool
+	flDORAWindow         time.Duration
+	flDORAReportInterval time.Duration
+
+	// Status flags.
+	flStatus        bool
+	flWatch         bool
+	flWatchInterval time.Duration
+	flDescribe      string
+	flOutput        string
+	flFormat        string
+
+	// Rollback flags.
+	flRollbackTo string
+
+	// Plan flags.
+	flPlan        bool
+	flApply       bool
+	flAutoApprove bool
+
+	// Quarantine flags.
+	flQuarantineAfter   int
+	flReleaseQuarantine bool
+
+	// Admin API flags.
+	flAdminToken             string
+	flAdminAudience          string
+	flAdminAuthorizationFile string
+	flAdminUnauthenticated   bool
+	flGRPCAddr               string
+	flGRPCWatchInterval      time.Duration
+
+	// Kill switch flags.
+	flFleetPaused bool
+
+	// Trigger flags.
+	flTriggerSecret      string
+	flSlackSigningSecret string
+	flSignatureTolerance time.Duration
+
+	// Event flags.
+	flEventsAudience        string
+	flEventsServiceAccounts string
+
+	// Cloud Deploy verification flags.
+	flCloudDeployVerify        bool
+	flCloudDeployVerifyTimeout time.Duration
+
+	// Kubernetes flags.
+	flController  bool
+	flKubeAPIURL  string
+	flKubeconfig  string
+	flKubeContext string
+
+	// Cloud Run API and quota flags.
+	flRunAPIVersion         string
+	flReconciliationTimeout time.Duration
+	flRunAPIQPS             float64
+	flMonitoringAPIQPS      float64
+	flAPIMaxRetries         int
+	flConcurrency           int
+	flServiceTimeout        time.Duration
+	flServiceListTTL        time.Duration
+	flCycleTimeout          time.Duration
+
+	// Testing flags.
+	flChaos string
+
+	// runAPITransport and monitoringAPITransport are the transports of the
+	// Cloud Run and Cloud Monitoring clients (see apiOptions). The rate limit
+	// is shared by all the clients of an API.
+	runAPITransport        *ratelimit.Transport
+	monitoringAPITransport *ratelimit.Transport
+
+	// Policy flags.
+	flPolicyURL string
+
+	// Image flags.
+	flInspectImages bool
+
+	// Credentials flags.
+	flImpersonateServiceAccounts = impersonationFlags{}
+	flCredentialsFile            string
+	flMetricsCredentialsFile     string
+
+	// metricsCache is shared by the metrics providers of all the services.
+	metricsCache *metrics.Cache
+
+	// serviceListCache caches the lists of targeted services of every region.
+	// It is nil if -service-list-ttl is 0.
+	serviceListCache *runapi.ListCache
+
+	// chaosInjector injects faults in the Cloud Run clients and the metrics
+	// providers. It is nil unless -chaos is set.
+	chaosInjector *chaos.Injector
+
+	// notifier is alerted about the rollouts of all the services. It is nil
+	// if no notification target is configured.
+	notifier notify.Notifier
+
+	// stateStore persists the rollout state of the services. It is nil if the
+	// state is only kept in the annotations.
+	stateStore state.Store
+
+	// rolloutArchive records the outcome of every rollout cycle, if
+	// configured.
+	rolloutArchive archive.Archive
+
+	// customMetrics writes the state of the rollouts to Cloud Monitoring. It
+	// is nil unless -custom-metrics is set.
+	customMetrics *custommetrics.Writer
+
+	// serviceLocker ensures a single replica handles the rollout of a service
+	// at a time. It is nil if a single replica runs.
+	serviceLocker lock.Locker
+
+	// metricsPluginConn is the connection to the metrics plugin, if any.
+	metricsPluginConn *grpc.ClientConn
+
+	// tracer records the rollout cycles as traces. It is nil if no tracing
+	// exporter is configured.
+	tracer *tracing.Tracer
+
+	// policyEvaluator allows or denies the changes of the traffic. It is nil
+	// if no policy engine is configured.
+	policyEvaluator policy.Evaluator
+
+	// imageInspector reads the labels of the images of the candidates. It is
+	// nil unless -inspect-images is set.
+	imageInspector image.Inspector
+
+	// adminVerifier verifies the ID tokens of the callers of the admin API.
+	// It is nil if -admin-audience is not set.
+	adminVerifier *adminauth.Verifier
+
+	// adminPolicy authorizes the actions of the admin API. It is nil to allow
+	// all the actions of the authenticated callers.
+	adminPolicy *adminauth.Policy
+
+	// triggerVerifiers verify the signatures of the requests to /rollout. It
+	// is empty if the requests are not signed.
+	triggerVerifiers []*signature.Verifier
+
+	// eventsVerifier verifies the ID tokens of the push requests to /events.
+	// It is nil if -events-audience is not set, in which case the events are
+	// rejected.
+	eventsVerifier *adminauth.Verifier
 )
 
 func init() {
@@ -88,22 +458,199 @@ func init() {
 	}
 
 	flag.StringVar(&flLoggingLevel, "verbosity", "info", "the logging level (e.g. debug)")
+	flag.StringVar(&flLogFormat, "log-format", "", "format of the logs: text, json (one JSON object per line, with the fields of the entries at the top level) or empty for text in a terminal and Cloud Logging entries otherwise")
 	flag.BoolVar(&flCLI, "cli", false, "run as CLI application to manage rollout in intervals")
+	flag.BoolVar(&flOnce, "once", false, "handle the rollout of all the targeted services once and exit, e.g. in a Cloud Run job triggered by Cloud Scheduler")
+	flag.BoolVar(&flRunOnce, "run-once", false, "handle the rollout of the single targeted service once and exit")
+	flag.BoolVar(&flWait, "wait", false, "with -run-once, repeat the rollout every -cli-run-interval until the candidate is promoted (exit status 0) or rolled back (exit status 1)")
+	flag.DurationVar(&flWaitTimeout, "wait-timeout", time.Hour, "maximum time -wait blocks before failing with exit status 5")
+	flag.DurationVar(&flWaitTimeout, "timeout", time.Hour, "shorthand for -wait-timeout")
+	flag.StringVar(&flProgress, "progress-format", githubProgress, "format of the progress printed by -wait at each transition: github (GitHub Actions workflow commands) or json (one JSON object per line)")
+	flag.StringVar(&flOut, "out", "", "with -once or -run-once, file to write a JSON summary of the outcome of the rollouts to (e.g. summary.json)")
+	flag.BoolVar(&flHistory, "history", false, "print the past rollouts of the targeted services from the state store and exit")
+	flag.BoolVar(&flDORA, "dora", false, "print the DORA metrics (deployment frequency, change failure rate and time to restore) of the targeted services from the state store and exit")
+	flag.DurationVar(&flDORAWindow, "dora-window", 30*24*time.Hour, "time window of the rollouts the DORA metrics are computed from")
+	flag.DurationVar(&flDORAReportInterval, "dora-report-interval", 0, "interval at which the DORA metrics of the targeted services are logged and exposed as metrics of the operator, use 0 to disable")
+	flag.BoolVar(&flStatus, "status", false, "print the rollout state of the targeted services and exit")
+	flag.BoolVar(&flWatch, "watch", false, "with -status, keep printing the changes of the rollout state of the targeted services (e.g. traffic steps and diagnoses) until interrupted")
+	flag.DurationVar(&flWatchInterval, "watch-interval", 10*time.Second, "time between the checks of the rollout state of the services with -watch")
+	flag.StringVar(&flDescribe, "describe", "", "print everything the operator knows about the targeted services with this name (traffic, annotations, effective strategy, last health report and pending gates) and exit")
+	flag.StringVar(&flOutput, "output", tableOutput, "output format of -status, -describe, -dora, -plan and -apply: table (text for -describe), json or yaml")
+	flag.StringVar(&flOutput, "o", tableOutput, "shorthand for -output")
+	flag.StringVar(&flFormat, "format", "", "gcloud-style output format of -status, -describe, -dora, -plan and -apply, which takes precedence over -output: table, json, yaml or value(FIELD,...) to print the fields of the JSON output separated by tabs (e.g. value(service,candidatePercent))")
+	flag.StringVar(&flRollbackTo, "rollback-to", "", "redirect all the traffic of the single targeted service to this previous revision, make it stable and exit")
+	flag.BoolVar(&flPlan, "plan", false, "print the traffic changes the next rollout cycle of the targeted services would make, without making them, and exit")
+	flag.BoolVar(&flApply, "apply", false, "print the traffic changes the next rollout cycle of the targeted services would make, make them once confirmed and exit")
+	flag.BoolVar(&flAutoApprove, "auto-approve", false, "with -apply, make the traffic changes without asking for confirmation")
+	flag.IntVar(&flQuarantineAfter, "quarantine-after", 10, "number of consecutive operator errors of the rollout of a service after which it is quarantined (no longer handled until released), 0 to disable")
+	flag.BoolVar(&flReleaseQuarantine, "release-quarantine", false, "release the targeted services from quarantine in the state store and exit")
+	flag.StringVar(&flAdminToken, "admin-token", "", "bearer token required by the admin API (/services, /rollback, /history and /ui) in server mode, the API is disabled without a token, an audience or -admin-allow-unauthenticated")
+	flag.StringVar(&flAdminAudience, "admin-audience", "", "audience of the Google ID tokens required by the admin API (/services, /rollback, /history and /ui) in server mode, e.g. the URL of the operator, empty to disable the verification of ID tokens")
+	flag.BoolVar(&flAdminUnauthenticated, "admin-allow-unauthenticated", false, "serve the admin API (/services, /rollback, /fleet, /history and /ui) in server mode without -admin-token or -admin-audience, relying on the access control of the platform (e.g. Cloud Run IAM)")
+	flag.StringVar(&flTriggerSecret, "trigger-secret", "", "secret of the HMAC-SHA256 signatures required for the requests to /rollout in server mode (X-Rollout-Timestamp and X-Rollout-Signature headers), empty to not require signatures")
+	flag.StringVar(&flSlackSigningSecret, "slack-signing-secret", "", "signing secret of the Slack app whose requests (e.g. a slash command) may trigger /rollout in server mode, empty to not accept them")
+	flag.DurationVar(&flSignatureTolerance, "signature-tolerance", signature.DefaultTolerance, "maximum difference between the timestamp of a signed request and the time it is received; signed requests are only rejected when replayed to the same instance of the operator, which remembers the signatures it accepted in memory for this long")
+	flag.StringVar(&flEventsAudience, "events-audience", "", "audience of the ID tokens of the Eventarc or Pub/Sub push requests to /events in server mode, e.g. the URL of the operator, required to accept events")
+	flag.StringVar(&flEventsServiceAccounts, "events-service-accounts", "", "comma-separated emails of the service accounts allowed to push events to /events, empty to accept any valid ID token for -events-audience")
+	flag.BoolVar(&flFleetPaused, "fleet-paused", false, "pause the traffic changes of all the services (kill switch), the rollouts only diagnose the candidates until resumed with the admin API (/fleet:resume); with -state-store, the pause is saved for all the replicas")
+	flag.StringVar(&flAdminAuthorizationFile, "admin-authorization-file", "", "YAML file of the rules authorizing the principals of the ID tokens to perform the actions of the admin API on the services, empty to authorize all the actions of the authenticated callers")
+	flag.StringVar(&flGRPCAddr, "grpc-addr", "", "address where to serve the gRPC API in server mode (e.g. :9090), empty to disable it")
+	flag.DurationVar(&flGRPCWatchInterval, "grpc-watch-interval", 30*time.Second, "time between the checks of the watched rollouts for changes in the gRPC API")
+	flag.BoolVar(&flCloudDeployVerify, "cloud-deploy-verify", false, "diagnose the latest revision of the targeted services once and exit with a non-zero status if any is unhealthy, for Cloud Deploy verifications and custom targets")
+	flag.DurationVar(&flCloudDeployVerifyTimeout, "cloud-deploy-verify-timeout", 10*time.Minute, "maximum time inconclusive diagnoses are repeated in the Cloud Deploy verification mode")
+	flag.BoolVar(&flController, "controller", false, "read the strategies from the RolloutStrategy resources of a Kubernetes cluster and report the state of the managed services in their status, every -cli-run-interval")
+	flag.StringVar(&flKubeAPIURL, "kube-api-url", "", "URL of the Kubernetes API server for -controller and the kubernetes platform (e.g. http://localhost:8001 with kubectl proxy)")
+	flag.StringVar(&flKubeconfig, "kubeconfig", "", "path of the kubeconfig file of the Kubernetes cluster for -controller and the kubernetes platform, empty to use the cluster the operator runs in")
+	flag.StringVar(&flKubeContext, "kube-context", "", "context of the kubeconfig file, empty to use the current context")
 	flag.IntVar(&flCLILoopIntervalSec, "cli-run-interval", 60, "the time between each rollout process (in seconds)")
+	flag.Float64Var(&flScheduleJitter, "schedule-jitter", 0.1, "with -cli, fraction of -cli-run-interval by which the time between the rollout processes of a service randomly varies")
 	flag.StringVar(&flHTTPAddr, "http-addr", defaultAddr, "address where to listen to http requests (e.g. :8080)")
+	flag.StringVar(&flMetricsAddr, "metrics-addr", "", "with -cli, address where to serve the metrics of the operator on /metrics and its health checks on /healthz and /readyz (e.g. :9090), empty to disable")
+	flag.IntVar(&flLivenessIntervals, "liveness-intervals", 3, "with -cli, number of -cli-run-interval without any completed rollout cycle after which /healthz fails, 0 to disable")
+	flag.StringVar(&flTracingExporter, "tracing-exporter", "", "where to export the traces of the rollout cycles: cloudtrace://PROJECT for Cloud Trace or the http(s) URL of an OpenTelemetry (OTLP/HTTP) collector, empty to disable")
+	flag.DurationVar(&flShutdownTimeout, "shutdown-timeout", 10*time.Second, "maximum time to wait for the rollouts in progress to complete on SIGTERM before exiting")
+	flag.StringVar(&flConfigFile, "config", "", "location of a YAML configuration file with the rollout strategies, which replaces the strategy flags: a local path, gs://BUCKET/OBJECT, sm://PROJECT/SECRET[/VERSION] or an HTTPS URL")
+	flag.StringVar(&flConfigProfile, "config-profile", "", "profile of the configuration file to use (e.g. prod), empty to only use the shared settings")
+	flag.DurationVar(&flConfigReloadInterval, "config-reload-interval", 30*time.Second, "time between the checks of the configuration for changes, which are applied without restarting, use 0 to disable")
+	flag.StringVar(&flConfigCanary, "config-canary", "", "label selector of the services a changed configuration applies to first, until one of them completes a rollout under it (e.g. rollout-canary=true), empty to apply the changes fleet-wide right away")
+	flag.BoolVar(&flPrintConfigSchema, "print-config-schema", false, "print the JSON Schema of the configuration file and exit")
+	flag.BoolVar(&flValidate, "validate", false, "validate the configuration, lint its suspicious settings, check the operator has the permissions it needs and the APIs are enabled in the targeted projects, and exit with a non-zero status on problems")
+	flag.BoolVar(&flPreflight, "preflight", false, "check the operator has the permissions it needs (run.services.list, run.services.get, run.services.update, run.locations.list if no region is configured, monitoring.timeSeries.list and cloudtrace.traces.list with trace criteria) and the APIs are enabled in the targeted projects on startup, and fail fast otherwise (server and -cli modes); checking the APIs requires serviceusage.services.get")
 	flag.StringVar(&flProject, "project", "", "project in which the service is deployed")
+	flag.StringVar(&flFolder, "folder", "", "ID of a folder to look at the services in all of its projects, including those of its subfolders, instead of a single project")
+	flag.StringVar(&flOrganization, "organization", "", "ID of an organization to look at the services in all of its projects instead of a single project")
+	flag.StringVar(&flPlatform, "platform", string(config.ManagedPlatform), "platform of the services: managed for Cloud Run (fully managed) or kubernetes for Knative Serving on a Kubernetes cluster (e.g. Cloud Run for Anthos)")
+	flag.StringVar(&flNamespace, "namespace", "", "Kubernetes namespace of the services for the kubernetes platform")
+	flag.StringVar(&flProjectFilter, "project-filter", "", "filter of the projects discovered under -folder or -organization (e.g. labels.env:prod)")
 	flag.StringVar(&flLabelSelector, "label", "rollout-strategy=gradual", "filter services based on a label (e.g. team=backend)")
+	flag.StringVar(&flIncludeServicesString, "include-services", "", "names of the only services with the label that can be managed, separated by commas")
+	flag.StringVar(&flExcludeServicesString, "exclude-services", "", "names of the services with the label that must never be managed, separated by commas")
+	flag.StringVar(&flServiceNameRegex, "service-name-regex", "", "regular expression the names of the managed services must match")
+	flag.StringVar(&flExcludeServiceNameRegex, "exclude-service-name-regex", "", "regular expression the names of the managed services must not match")
 	flag.StringVar(&flRegionsString, "regions", "", "the Cloud Run regions where the services should be looked at")
+	flag.StringVar(&flIncludeRegionsString, "include-regions", "", "patterns of the regions retrieved from the API where the services should be looked at, separated by commas (e.g. us-*,europe-*), if -regions is not specified")
+	flag.StringVar(&flExcludeRegionsString, "exclude-regions", "", "patterns of the regions retrieved from the API where the services should not be looked at, separated by commas (e.g. asia-*), if -regions is not specified")
 	flag.Var(&flSteps, "step", "a percentage in traffic the candidate should go through")
 	flag.StringVar(&flStepsString, "steps", "5,20,50,80", "define steps in one flag separated by commas (e.g. 5,30,60)")
 	flag.IntVar(&flHealthOffsetMinute, "healthcheck-offset", 30, "use metrics from the last N minutes relative to current rollout process")
 	flag.DurationVar(&flTimeBeweenRollouts, "min-wait", 30*time.Minute, "minimum time to wait between rollout stages (in minutes), use 0 to disable")
+	flag.DurationVar(&flMetricsTimeout, "metrics-timeout", time.Minute, "maximum time the metrics query for a health criterion can take, use 0 to disable")
+	flag.BoolVar(&flRecordSamples, "record-samples", false, "store the raw metrics values and queries used for the last diagnosis in a service annotation")
+	flag.DurationVar(&flStuckAfter, "stuck-after", 0, "time after which a candidate kept at the same traffic step is flagged as stuck, use 0 to disable")
+	flag.IntVar(&flHealthyChecks, "consecutive-healthy-checks", 1, "number of consecutive rollout cycles the candidate must be diagnosed healthy at its current step before its traffic advances")
+	flag.StringVar(&flOnUnhealthy, "on-unhealthy", string(config.RollbackOnUnhealthy), "action on unhealthy candidates: rollback, notify (keep the traffic split and notify) or pause (also pause the rollout)")
+	flag.Float64Var(&flTrafficSplitSkew, "max-traffic-skew", 0, "maximum difference (in percentage points) between the share of requests served by the candidate and its traffic percent before the diagnosis is inconclusive, use 0 to disable")
+	flag.BoolVar(&flCompareWithStable, "compare-with-stable", false, "query the metrics of the stable revision when the candidate is unhealthy, and make the diagnosis inconclusive if the stable revision is equally degraded")
+	flag.StringVar(&flReportFormat, "report-format", string(config.TextReportFormat), "format of the health report annotation: text, markdown or html")
+	flag.StringVar(&flProtocol, "protocol", string(config.HTTPProtocol), "protocol of the services for the Cloud Monitoring metrics: http or grpc")
 	flag.IntVar(&flMinRequestCount, "min-requests", 100, "expected minimum requests before determining candidate's health")
 	flag.Float64Var(&flErrorRate, "max-error-rate", 1.0, "expected max server error rate (in percent)")
 	flag.Float64Var(&flLatencyP99, "latency-p99", 0, "expected max latency for 99th percentile of requests (set 0 to ignore)")
 	flag.Float64Var(&flLatencyP95, "latency-p95", 0, "expected max latency for 95th percentile of requests (set 0 to ignore)")
 	flag.Float64Var(&flLatencyP50, "latency-p50", 0, "expected max latency for 50th percentile of requests (set 0 to ignore)")
+	flag.StringVar(&flTraceOperation, "trace-operation", "", "name of the spans in Cloud Trace to evaluate the candidate's health, empty to disable trace criteria")
+	flag.Float64Var(&flTraceMaxErrorRate, "trace-max-error-rate", 1.0, "expected max rate of spans with errors (in percent)")
+	flag.Float64Var(&flTraceLatencyP95, "trace-latency-p95", 0, "expected max duration for 95th percentile of spans (set 0 to ignore)")
+	flag.StringVar(&flTraceRevisionLabel, "trace-revision-label", cloudtrace.DefaultRevisionLabel, "span label that holds the revision name")
+	flag.StringVar(&flProbePath, "probe-path", "", "path to probe in the candidate's tag URL before it gets traffic (e.g. /healthz), empty to disable")
+	flag.IntVar(&flProbeStatus, "probe-status", 200, "expected status code for probe requests")
+	flag.DurationVar(&flProbeMaxLatency, "probe-max-latency", 0, "expected max latency for each probe request, use 0 to ignore")
+	flag.StringVar(&flProbeBodyRegex, "probe-body-regex", "", "regular expression the body of probe responses must match")
+	flag.IntVar(&flProbeRequests, "probe-requests", 10, "number of probe requests sent to the candidate per rollout process")
+	flag.Float64Var(&flProbeMinSuccess, "probe-min-success", 100, "expected minimum percentage of successful probe requests")
+	flag.BoolVar(&flProbeAuthenticate, "probe-authenticate", false, "send an ID token with probe requests (for services that require authentication)")
+	flag.IntVar(&flWarmUpRPS, "warmup-rps", 0, "requests per second of synthetic load sent to the candidate's tag URL before it gets traffic, use 0 to disable")
+	flag.DurationVar(&flWarmUpDuration, "warmup-duration", time.Minute, "duration of the synthetic load")
+	flag.StringVar(&flWarmUpMethod, "warmup-method", "GET", "HTTP method of the synthetic requests")
+	flag.StringVar(&flWarmUpPath, "warmup-path", "/", "path of the synthetic requests")
+	flag.StringVar(&flWarmUpBody, "warmup-body", "", "body of the synthetic requests")
+	flag.Var(flWarmUpHeaders, "warmup-header", "a header of the synthetic requests (e.g. 'Content-Type: application/json')")
+	flag.BoolVar(&flWarmUpAuthenticate, "warmup-authenticate", false, "send an ID token with synthetic requests (for services that require authentication)")
+	flag.StringVar(&flShadowControlURL, "shadow-control-url", "", "control URL of the mirroring proxy used to send shadow traffic to the candidate before it gets traffic, empty to disable")
+	flag.Float64Var(&flShadowSamplePercent, "shadow-sample-percent", 10, "percentage of production requests mirrored to the candidate")
+	flag.StringVar(&flRequiredAttestors, "required-attestors", "", "comma-separated Binary Authorization attestors (projects/PROJECT/attestors/ATTESTOR) that must have attested the image of a new candidate before it receives traffic")
+	flag.StringVar(&flMaxVulnerabilitySeverity, "max-vulnerability-severity", "", "highest severity (MINIMAL, LOW, MEDIUM, HIGH or CRITICAL) of the vulnerabilities allowed in the image of a candidate to receive traffic and be promoted, empty to disable")
+	flag.StringVar(&flIgnoredVulnerabilities, "ignore-vulnerabilities", "", "comma-separated vulnerabilities (e.g. CVE-2020-1234) that never block a candidate")
+	flag.DurationVar(&flShadowDuration, "shadow-duration", 30*time.Minute, "time the candidate receives shadow traffic before being diagnosed")
+	flag.BoolVar(&flJobCanary, "job-canary", false, "also manage the Cloud Run jobs with the label selector, vetting their new images with canary executions")
+	flag.StringVar(&flJobCanaryArgs, "job-canary-args", "", "arguments of the canary executions of the jobs, separated by commas (e.g. --dataset=canary)")
+	flag.Var(flJobCanaryEnv, "job-canary-env", "an environment variable of the canary executions of the jobs (e.g. DRY_RUN=true)")
+	flag.DurationVar(&flJobCanaryTimeout, "job-canary-timeout", 0, "maximum time the tasks of a canary execution can run, use 0 for the timeout of the job")
+	flag.DurationVar(&flJobCanaryMaxDuration, "job-canary-max-duration", 0, "maximum time a canary execution can take to be healthy, use 0 to ignore")
 	flag.StringVar(&flGoogleSheetsID, "google-sheets", "", "ID of public Google sheets document to use as metrics provider")
+	flag.StringVar(&flPrometheusURL, "prometheus-url", "", "URL of the Prometheus server to use as metrics provider")
+	flag.StringVar(&flPrometheusRequestCountQry, "prometheus-request-count-query", prometheus.DefaultRequestCountQuery, "PromQL query template for request count")
+	flag.StringVar(&flPrometheusErrorRateQry, "prometheus-error-rate-query", prometheus.DefaultErrorRateQuery, "PromQL query template for error rate (between 0 and 1)")
+	flag.StringVar(&flPrometheusLatencyQry, "prometheus-latency-query", prometheus.DefaultLatencyQuery, "PromQL query template for latency (in milliseconds)")
+	flag.StringVar(&flJSONRequestCountURL, "json-request-count-url", "", "URL template of the HTTP JSON API that returns the request count")
+	flag.StringVar(&flJSONRequestCountPath, "json-request-count-path", "$.value", "JSONPath to the request count in the response")
+	flag.StringVar(&flJSONErrorRateURL, "json-error-rate-url", "", "URL template of the HTTP JSON API that returns the error rate (between 0 and 1)")
+	flag.StringVar(&flJSONErrorRatePath, "json-error-rate-path", "$.value", "JSONPath to the error rate in the response")
+	flag.StringVar(&flJSONLatencyURL, "json-latency-url", "", "URL template of the HTTP JSON API that returns the latency (in milliseconds)")
+	flag.StringVar(&flJSONLatencyPath, "json-latency-path", "$.value", "JSONPath to the latency in the response")
+	flag.Var(flJSONHeaders, "json-header", "a header template sent to the HTTP JSON API (e.g. 'Authorization: Bearer TOKEN')")
+	flag.StringVar(&flStateStore, "state-store", "", "location of a store that persists the rollout state of the services, which the annotations then only mirror: firestore://PROJECT[/COLLECTION]")
+	flag.StringVar(&flLock, "lock", "", "location of the leases that let a single replica of the operator handle the rollout of a service at a time: firestore://PROJECT[/COLLECTION] or kubernetes://NAMESPACE")
+	flag.DurationVar(&flLockDuration, "lock-duration", 10*time.Minute, "time after which the lease of a replica that stopped is taken over, must be longer than a rollout cycle")
+	flag.IntVar(&flShardIndex, "shard-index", 0, "index of the shard of services managed by this instance, from 0 to -shard-count minus 1")
+	flag.IntVar(&flShardCount, "shard-count", 1, "number of instances the services are split between, by a hash of their project and name")
+	flag.StringVar(&flArchive, "archive", "", "Cloud Storage location where the decision and the health report of every rollout cycle are archived: gs://BUCKET[/PREFIX]")
+	flag.BoolVar(&flCustomMetrics, "custom-metrics", false, "write the traffic percent and the diagnosis of the candidates and the number of rollbacks to Cloud Monitoring as custom metrics, every rollout cycle")
+	flag.StringVar(&flMetricsPluginAddr, "metrics-plugin-addr", "", "address of a gRPC metrics plugin to use as metrics provider (e.g. localhost:9000 or unix:///tmp/plugin.sock)")
+	flag.StringVar(&flMetricsPluginBinary, "metrics-plugin-binary", "", "path to a gRPC metrics plugin binary to launch and use as metrics provider")
+	flag.DurationVar(&flMetricsCacheTTL, "metrics-cache-ttl", 0, "time the results of metrics queries are reused, use 0 to only deduplicate concurrent identical queries")
+	flag.StringVar(&flSlackWebhookURL, "slack-webhook-url", "", "URL of a Slack incoming webhook alerted about rollouts and rollbacks")
+	flag.StringVar(&flGoogleChatWebhookURL, "google-chat-webhook-url", "", "URL of a Google Chat incoming webhook alerted about rollouts and rollbacks")
+	flag.StringVar(&flTeamsWebhookURL, "teams-webhook-url", "", "URL of a Microsoft Teams incoming webhook connector alerted about rollouts and rollbacks")
+	flag.StringVar(&flPagerDutyRoutingKey, "pagerduty-routing-key", "", "integration key of a PagerDuty service (Events API v2) paged when a candidate is rolled back")
+	flag.StringVar(&flOpsgenieAPIKey, "opsgenie-api-key", "", "API integration key used to create an Opsgenie alert when a candidate is rolled back")
+	flag.StringVar(&flOpsgenieAPIURL, "opsgenie-api-url", notify.DefaultOpsgenieURL, "URL of the Opsgenie API (e.g. https://api.eu.opsgenie.com)")
+	flag.StringVar(&flJiraURL, "jira-url", "", "URL of a Jira site (e.g. https://example.atlassian.net) to open an issue in when a candidate is rolled back")
+	flag.StringVar(&flJiraEmail, "jira-email", "", "email of the Jira account used to open the issues")
+	flag.StringVar(&flJiraAPIToken, "jira-api-token", "", "API token of the Jira account used to open the issues")
+	flag.StringVar(&flJiraProject, "jira-project", "", "key of the Jira project the issues are opened in (e.g. OPS)")
+	flag.StringVar(&flJiraIssueType, "jira-issue-type", "Bug", "type of the Jira issues")
+	flag.StringVar(&flEmailFrom, "email-from", "", "sender address of the emails about promotions and rollbacks")
+	flag.StringVar(&flEmailTo, "email-to", "", "comma-separated recipients of the emails about promotions and rollbacks")
+	flag.StringVar(&flSMTPAddr, "smtp-addr", "", "address (host:port) of the SMTP server used to send emails")
+	flag.StringVar(&flSMTPUsername, "smtp-username", "", "username to authenticate with the SMTP server")
+	flag.StringVar(&flSMTPPassword, "smtp-password", "", "password to authenticate with the SMTP server")
+	flag.StringVar(&flSendGridAPIKey, "sendgrid-api-key", "", "SendGrid API key used to send emails instead of an SMTP server")
+	flag.StringVar(&flWebhookURL, "webhook-url", "", "URL to POST a JSON payload to on every rollout event")
+	flag.StringVar(&flWebhookTemplateFile, "webhook-template-file", "", "path to a Go template of the webhook payload, the event is sent as JSON if empty")
+	flag.StringVar(&flWebhookSecret, "webhook-secret", "", "secret used to sign the webhook requests with HMAC-SHA256")
+	flag.Var(flWebhookHeaders, "webhook-header", "a header of the webhook requests (e.g. 'Authorization: Bearer TOKEN')")
+	flag.IntVar(&flWebhookMaxRetries, "webhook-max-retries", notify.DefaultWebhookMaxRetries, "maximum retries of failed webhook requests")
+	flag.StringVar(&flCloudEventsURL, "cloudevents-url", "", "URL to send the rollout events to as CloudEvents (e.g. a Knative broker)")
+	flag.StringVar(&flCloudEventsTopic, "cloudevents-topic", "", "Pub/Sub topic (projects/PROJECT/topics/TOPIC) to publish the rollout events to as CloudEvents")
+	flag.StringVar(&flPubSubTopic, "pubsub-topic", "", "Pub/Sub topic (projects/PROJECT/topics/TOPIC) to publish a message to for every rollout decision")
+	flag.StringVar(&flBigQueryTable, "bigquery-table", "", "BigQuery table (PROJECT.DATASET.TABLE) to append a row to for every rollout decision")
+	flag.StringVar(&flDecisionLogID, "decision-log-id", "", "ID of the Cloud Logging log to write a structured entry to for every traffic-changing action (e.g. rollout-decisions)")
+	flag.StringVar(&flGrafanaURL, "grafana-url", "", "URL of a Grafana instance to post an annotation to on every traffic change")
+	flag.StringVar(&flGrafanaAPIKey, "grafana-api-key", "", "API key (Editor role) used to create the Grafana annotations")
+	flag.StringVar(&flGrafanaDashboardUID, "grafana-dashboard-uid", "", "UID of the Grafana dashboard the annotations are added to, organization-wide annotations are created if empty")
+	flag.StringVar(&flGitHubRepo, "github-repo", "", "GitHub repository (OWNER/REPO) to set commit statuses in for the candidates' commits")
+	flag.StringVar(&flGitHubToken, "github-token", "", "GitHub token with the repo:status scope (repo to comment on pull requests) used to set the commit statuses")
+	flag.StringVar(&flGitHubAPIURL, "github-api-url", "https://api.github.com", "URL of the GitHub API (e.g. https://HOST/api/v3 for GitHub Enterprise Server)")
+	flag.BoolVar(&flGitHubPRComments, "github-pr-comments", false, "comment the final health report on the pull requests of the candidate's commit once it is promoted or rolled back")
+	flag.StringVar(&flGitLabProject, "gitlab-project", "", "ID or path (GROUP/PROJECT) of the GitLab project to comment the final health report on the merge requests of the candidate's commit")
+	flag.StringVar(&flGitLabToken, "gitlab-token", "", "GitLab access token with the api scope used to comment on merge requests")
+	flag.StringVar(&flGitLabURL, "gitlab-url", "https://gitlab.com", "URL of the GitLab instance")
+	flag.StringVar(&flRunAPIVersion, "run-api-version", "v1", "version of the Cloud Run Admin API used for the fully managed services: v1, or v2 to only update the traffic and annotations of the services")
+	flag.DurationVar(&flReconciliationTimeout, "traffic-reconciliation-timeout", 2*time.Minute, "maximum time to wait for the new traffic split to be applied after updating a service, use 0 to not wait")
+	flag.Float64Var(&flRunAPIQPS, "run-api-qps", 10, "maximum requests per second sent to the Cloud Run API, use 0 to disable")
+	flag.Float64Var(&flMonitoringAPIQPS, "monitoring-api-qps", 10, "maximum requests per second sent to the Cloud Monitoring API, use 0 to disable")
+	flag.IntVar(&flAPIMaxRetries, "api-max-retries", 5, "maximum retries of API requests that fail because of quota or transient errors")
+	flag.BoolVar(&flInspectImages, "inspect-images", false, "read the commit and the build of the candidates from the OCI labels of their container images")
+	flag.StringVar(&flPolicyURL, "policy-url", "", "URL of the Open Policy Agent document (Data API) evaluated before every change of the traffic, e.g. http://localhost:8181/v1/data/rollout")
+	flag.StringVar(&flCredentialsFile, "credentials-file", "", "credential file of the Google APIs: a service account key or an external account of Workload Identity Federation (default: application default credentials)")
+	flag.StringVar(&flMetricsCredentialsFile, "metrics-credentials-file", "", "credential file of the Cloud Monitoring, Cloud Trace and Google Sheets metrics providers (default: -credentials-file)")
+	flag.Var(flImpersonateServiceAccounts, "impersonate-service-account", "email of the service account impersonated to manage the services, or PROJECT=EMAIL to impersonate it in a project only (can be repeated)")
+	flag.IntVar(&flConcurrency, "concurrency", 10, "maximum number of services whose rollout is handled at the same time, use 0 for no limit")
+	flag.DurationVar(&flServiceTimeout, "service-timeout", 0, "maximum time the rollout cycle of a single service can take, use 0 for no timeout")
+	flag.DurationVar(&flServiceListTTL, "service-list-ttl", 0, "time the lists of targeted services of every region are reused between rollout cycles, use 0 to list them every cycle")
+	flag.DurationVar(&flCycleTimeout, "cycle-timeout", 0, "maximum time a reconcile pass over all the services can take, after which the remaining services are skipped, use 0 for no timeout")
+	flag.StringVar(&flChaos, "chaos", "", "for testing only: faults injected in the calls to the Cloud Run API and the metrics providers, e.g. latency=500ms,conflict=0.3,ratelimit=0.1,missingdata=0.5")
 	flag.Parse()
 
 	if flRegionsString != "" {
@@ -119,7 +666,15 @@ func main() {
 	}
 	logger.SetLevel(loggingLevel)
 
-	if !isatty.IsTerminal(os.Stdout.Fd()) {
+	if flLogFormat != "" && flLogFormat != "text" && flLogFormat != "json" {
+		logger.Fatalf("invalid log format %q, must be text or json", flLogFormat)
+	}
+	switch {
+	case flLogFormat == "json":
+		logger.Formatter = &logrus.JSONFormatter{
+			FieldMap: logrus.FieldMap{logrus.FieldKeyMsg: "message", logrus.FieldKeyLevel: "severity"},
+		}
+	case flLogFormat == "" && !isatty.IsTerminal(os.Stdout.Fd()):
 		serviceName := os.Getenv("K_SERVICE")
 		if serviceName == "" {
 			serviceName = "cloud-run-release-operator"
@@ -134,38 +689,520 @@ func main() {
 		logger.Fatalf("invalid flags: %v", err)
 	}
 
-	// Configuration.
-	target := config.NewTarget(flProject, flRegions, flLabelSelector)
-	healthCriteria := healthCriteriaFromFlags(flMinRequestCount, flErrorRate, flLatencyP99, flLatencyP95, flLatencyP50)
-	printHealthCriteria(logger, healthCriteria)
-	strategy := config.NewStrategy(target, flSteps, flHealthOffsetMinute, flTimeBeweenRollouts, healthCriteria)
-	cfg := &config.Config{Strategies: []config.Strategy{strategy}}
-	if err := cfg.Validate(); err != nil {
-		logger.Fatalf("invalid rollout configuration: %v", err)
+	if flPrintConfigSchema {
+		schema, err := config.JSONSchema()
+		if err != nil {
+			logger.Fatalf("failed to generate configuration schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
 	}
 
 	ctx := context.Background()
+
+	if err := initCredentials(); err != nil {
+		logger.Fatalf("failed to initialize credentials: %v", err)
+	}
+
+	// Configuration.
+	var (
+		cfg          *config.Config
+		configSource configsource.Source
+		configData   []byte
+	)
+	switch {
+	case flController:
+		// The strategies are read from the cluster on every reconciliation.
+		cfg = &config.Config{}
+	case flConfigFile != "":
+		configSource, err = configsource.New(ctx, flConfigFile, googleCredentials...)
+		if err != nil {
+			logger.Fatalf("invalid configuration location: %v", err)
+		}
+		configData, err = configSource.Read(ctx)
+		if err != nil {
+			logger.Fatalf("failed to read configuration: %v", err)
+		}
+		cfg, err = config.Load(configData, flConfigProfile)
+		if err != nil {
+			logger.Fatalf("invalid configuration %s: %v", flConfigFile, err)
+		}
+	default:
+		target := config.NewTarget(flProject, flRegions, flLabelSelector)
+		target.Folder = flFolder
+		target.Organization = flOrganization
+		target.ProjectFilter = flProjectFilter
+		target.Platform = config.Platform(flPlatform)
+		target.Namespace = flNamespace
+		if flIncludeRegionsString != "" {
+			target.IncludeRegions = strings.Split(flIncludeRegionsString, ",")
+		}
+		if flExcludeRegionsString != "" {
+			target.ExcludeRegions = strings.Split(flExcludeRegionsString, ",")
+		}
+		if flIncludeServicesString != "" {
+			target.IncludeServices = strings.Split(flIncludeServicesString, ",")
+		}
+		if flExcludeServicesString != "" {
+			target.ExcludeServices = strings.Split(flExcludeServicesString, ",")
+		}
+		target.ServiceNameRegex = flServiceNameRegex
+		target.ExcludeServiceNameRegex = flExcludeServiceNameRegex
+		healthCriteria := healthCriteriaFromFlags(flMinRequestCount, flErrorRate, flLatencyP99, flLatencyP95, flLatencyP50)
+		healthCriteria = append(healthCriteria, traceCriteriaFromFlags(flTraceOperation, flTraceMaxErrorRate, flTraceLatencyP95)...)
+		strategy := config.NewStrategy(target, flSteps, flHealthOffsetMinute, flTimeBeweenRollouts, healthCriteria)
+		strategy.MetricsTimeout = flMetricsTimeout
+		strategy.RecordSamples = flRecordSamples
+		strategy.StuckAfter = flStuckAfter
+		strategy.OnUnhealthy = config.UnhealthyAction(flOnUnhealthy)
+		strategy.ConsecutiveHealthyChecks = flHealthyChecks
+		strategy.TrafficSplitTolerance = flTrafficSplitSkew
+		strategy.CompareWithStable = flCompareWithStable
+		strategy.ReportFormat = config.ReportFormat(flReportFormat)
+		strategy.Protocol = config.Protocol(flProtocol)
+		strategy.Probe = probeFromFlags()
+		strategy.WarmUp = warmUpFromFlags()
+		strategy.Shadow = shadowFromFlags()
+		strategy.Attestation = attestationFromFlags()
+		strategy.VulnerabilityScan = vulnerabilityScanFromFlags()
+		strategy.JobCanary = jobCanaryFromFlags()
+		cfg = &config.Config{Strategies: []config.Strategy{strategy}}
+		if err := cfg.Validate(); err != nil {
+			logger.Fatalf("invalid rollout configuration: %v", err)
+		}
+	}
+	for i, strategy := range cfg.StrategiesByPrecedence() {
+		logger.WithField("strategy", strategyName(strategy, i)).Infof("targeting services with label %q", strategy.Target.LabelSelector)
+		printHealthCriteria(logger, strategy.HealthCriteria)
+	}
+
+	if flValidate {
+		warnings := cfg.Lint()
+		if flConfigFile != "" {
+			warnings, err = config.LintFile(configData, flConfigProfile)
+			if err != nil {
+				logger.Fatalf("invalid configuration %s: %v", flConfigFile, err)
+			}
+		}
+		if err := validateSetup(ctx, logger, cfg, warnings, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	metricsCache = metrics.NewCache(flMetricsCacheTTL)
+	if flServiceListTTL > 0 {
+		serviceListCache = runapi.NewListCache(flServiceListTTL)
+	}
+	if flChaos != "" {
+		faults, err := chaos.ParseFaults(flChaos)
+		if err != nil {
+			logger.Fatalf("invalid -chaos: %v", err)
+		}
+		logger.Warnf("injecting faults in the API calls and the metrics queries: %+v", faults)
+		chaosInjector = chaos.NewInjector(faults)
+	}
+
+	runAPITransport = ratelimit.NewTransport(nil, ratelimit.NewLimiter(flRunAPIQPS), flAPIMaxRetries)
+	if _, err := apiOptions(runAPITransport, googleCredentials, ""); err != nil {
+		logger.Fatalf("failed to initialize Cloud Run API transport: %v", err)
+	}
+	monitoringAPITransport = ratelimit.NewTransport(nil, ratelimit.NewLimiter(flMonitoringAPIQPS), flAPIMaxRetries)
+	if _, err := apiOptions(monitoringAPITransport, metricsCredentials, ""); err != nil {
+		logger.Fatalf("failed to initialize Cloud Monitoring API transport: %v", err)
+	}
+
+	notifier, err = notifierFromFlags(ctx)
+	if err != nil {
+		logger.Fatalf("invalid notification configuration: %v", err)
+	}
+
+	if flStateStore != "" {
+		stateStore, err = state.NewStore(ctx, flStateStore, googleCredentials...)
+		if err != nil {
+			logger.Fatalf("failed to initialize state store: %v", err)
+		}
+	}
+
+	if flLock != "" {
+		serviceLocker, err = lockerFromFlags(ctx)
+		if err != nil {
+			logger.Fatalf("failed to initialize locks: %v", err)
+		}
+	}
+
+	if flArchive != "" {
+		rolloutArchive, err = archive.NewGCS(ctx, flArchive, googleCredentials...)
+		if err != nil {
+			logger.Fatalf("failed to initialize rollout archive: %v", err)
+		}
+	}
+
+	if flCustomMetrics {
+		opts, err := apiOptions(monitoringAPITransport, metricsCredentials, "")
+		if err != nil {
+			logger.Fatalf("failed to initialize Cloud Monitoring API transport: %v", err)
+		}
+		customMetrics, err = custommetrics.NewWriter(ctx, opts...)
+		if err != nil {
+			logger.Fatalf("failed to initialize custom metrics: %v", err)
+		}
+	}
+
+	if flTracingExporter != "" {
+		exporter, err := tracing.NewExporter(ctx, flTracingExporter, googleCredentials...)
+		if err != nil {
+			logger.Fatalf("failed to initialize tracing: %v", err)
+		}
+		tracer = tracing.NewTracer(exporter, func(err error) { logger.Warn(err) })
+		defer tracer.Flush()
+	}
+
+	if flFleetPaused {
+		if _, err := fleetPause.set(ctx, logger, true, "-fleet-paused", ""); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if flPolicyURL != "" {
+		policyEvaluator = policy.NewOPA(&http.Client{Timeout: policyRequestTimeout}, flPolicyURL)
+	}
+
+	if flInspectImages {
+		imageInspector, err = image.NewRegistryInspector(ctx, googleCredentials...)
+		if err != nil {
+			logger.Fatalf("failed to initialize image inspector: %v", err)
+		}
+	}
+
+	if flTriggerSecret != "" {
+		triggerVerifiers = append(triggerVerifiers, signature.NewHMAC(flTriggerSecret, flSignatureTolerance))
+	}
+	if flSlackSigningSecret != "" {
+		triggerVerifiers = append(triggerVerifiers, signature.NewSlack(flSlackSigningSecret, flSignatureTolerance))
+	}
+
+	if flEventsAudience != "" {
+		eventsVerifier, err = adminauth.NewVerifier(ctx, flEventsAudience)
+		if err != nil {
+			logger.Fatalf("failed to initialize events authentication: %v", err)
+		}
+	}
+
+	if flAdminAudience != "" {
+		adminVerifier, err = adminauth.NewVerifier(ctx, flAdminAudience)
+		if err != nil {
+			logger.Fatalf("failed to initialize admin API authentication: %v", err)
+		}
+	}
+	if flAdminAuthorizationFile != "" {
+		data, err := ioutil.ReadFile(flAdminAuthorizationFile)
+		if err != nil {
+			logger.Fatalf("failed to read admin API authorization file: %v", err)
+		}
+		adminPolicy, err = adminauth.ParsePolicy(data, adminPolicyActions)
+		if err != nil {
+			logger.Fatalf("invalid admin API authorization file: %v", err)
+		}
+	}
+
+	if flMetricsPluginBinary != "" {
+		plugin, err := metricsplugin.Launch(ctx, flMetricsPluginBinary, metricsPluginStartTimeout)
+		if err != nil {
+			logger.Fatalf("failed to launch metrics plugin: %v", err)
+		}
+		defer plugin.Close()
+		metricsPluginConn = plugin.Conn
+	} else if flMetricsPluginAddr != "" {
+		metricsPluginConn, err = metricsplugin.Dial(ctx, flMetricsPluginAddr)
+		if err != nil {
+			logger.Fatalf("failed to connect to metrics plugin: %v", err)
+		}
+		defer metricsPluginConn.Close()
+	}
+
+	if flController {
+		client, err := sharedKubeClient(ctx)
+		if err != nil {
+			logger.Fatalf("failed to initialize Kubernetes client: %v", err)
+		}
+		stop := stopOnSignal(logger)
+		runController(ctx, logger, client, time.Duration(flCLILoopIntervalSec)*time.Second, stop)
+		drainCycles(logger, time.Now().Add(flShutdownTimeout))
+		return
+	}
+
+	if flRunOnce || flOnce {
+		// SIGTERM or SIGINT cancels the run, e.g. the wait of -run-once, so
+		// the summary is still written.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := stopOnSignal(logger)
+		go func() {
+			<-stop
+			cancel()
+		}()
+		summary = newRunSummary()
+		if flRunOnce {
+			interval := time.Duration(flCLILoopIntervalSec) * time.Second
+			err = runOnce(ctx, logger, cfg, flWait, interval, flWaitTimeout, flProgress)
+		} else {
+			err = reconcileOnce(ctx, logger, cfg)
+		}
+		if code := finishSingleShot(logger, err); code != 0 {
+			tracer.Flush()
+			os.Exit(code)
+		}
+		return
+	}
+
+	if flRollbackTo != "" {
+		if err := rollbackService(ctx, logger, cfg, flRollbackTo); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flStatus && flWatch {
+		if err := watchStatus(ctx, logger, cfg, flOutput, flWatchInterval, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flStatus {
+		if err := printStatus(ctx, logger, cfg, flOutput, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flDescribe != "" {
+		if err := describeService(ctx, logger, cfg, flDescribe, flOutput, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flPlan {
+		if err := printPlan(ctx, logger, cfg, flOutput, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flApply {
+		if err := applyPlan(ctx, logger, cfg, flOutput, flAutoApprove, os.Stdin, os.Stderr, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flHistory {
+		if err := printHistory(ctx, logger, cfg, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flDORA {
+		if err := printDORA(ctx, logger, cfg, flDORAWindow, flOutput, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flReleaseQuarantine {
+		if err := releaseQuarantine(ctx, logger, cfg, os.Stdout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if flCloudDeployVerify {
+		if err := runCloudDeployVerification(ctx, logger, cfg, flCloudDeployVerifyTimeout); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		logger.Info("verification succeeded")
+		return
+	}
+
+	if flPreflight {
+		if err := preflightCheck(ctx, logger, cfg); err != nil {
+			logger.Fatalf("%v", err)
+		}
+	}
+
+	store := newConfigStore(cfg)
+	if flConfigFile != "" && flConfigReloadInterval > 0 {
+		go watchConfig(ctx, logger, configSource, configData, flConfigProfile, flConfigReloadInterval, store)
+	}
+	if flDORAReportInterval > 0 {
+		go reportDORA(ctx, logger, store, flDORAWindow, flDORAReportInterval)
+	}
+
+	stop := stopOnSignal(logger)
 	if flCLI {
-		runDaemon(ctx, logger, cfg)
+		if flMetricsAddr != "" {
+			maxStaleness := time.Duration(flLivenessIntervals*flCLILoopIntervalSec) * time.Second
+			go serveHealthAndMetrics(logger, flMetricsAddr, maxStaleness)
+		}
+		runDaemon(ctx, logger, store, stop)
+		drainCycles(logger, time.Now().Add(flShutdownTimeout))
 	} else {
-		http.HandleFunc("/rollout", makeRolloutHandler(logger, cfg))
-		logger.WithField("addr", flHTTPAddr).Infof("starting server")
-		logger.Fatal(http.ListenAndServe(flHTTPAddr, nil))
+		http.HandleFunc("/rollout", makeRolloutHandler(logger, store))
+		http.HandleFunc("/events", makeEventHandler(logger, store))
+		if adminAPIEnabled() {
+			http.HandleFunc("/history", makeHistoryHandler(logger))
+			http.HandleFunc("/rollback", makeRollbackHandler(logger, store))
+			http.HandleFunc("/services", makeAdminHandler(logger, store))
+			http.HandleFunc("/services/", makeAdminHandler(logger, store))
+			http.HandleFunc("/fleet", makeFleetHandler(logger))
+			http.HandleFunc("/fleet:pause", makeFleetHandler(logger))
+			http.HandleFunc("/fleet:resume", makeFleetHandler(logger))
+			http.HandleFunc("/ui", makeUIHandler(logger, store))
+		} else {
+			logger.Info("admin API (/services, /rollback, /fleet, /history and /ui) disabled, set -admin-token, -admin-audience or -admin-allow-unauthenticated to enable it")
+		}
+		http.Handle("/metrics", telemetryRegistry.Handler())
+		http.HandleFunc("/healthz", makeLivenessHandler(0))
+		http.HandleFunc("/readyz", makeReadinessHandler(logger, newReadinessChecker()))
+		if flGRPCAddr != "" {
+			go serveGRPC(logger, store, stop)
+		}
+		serve(ctx, logger, stop)
 	}
 }
 
-func runDaemon(ctx context.Context, logger *logrus.Logger, cfg *config.Config) {
-	for {
-		// TODO(gvso): Handle all the strategies.
-		errs := runRollouts(ctx, logger, cfg.Strategies[0])
-		errsStr := rolloutErrsToString(errs)
-		if len(errs) != 0 {
-			logger.Warnf("there were %d errors: \n%s", len(errs), errsStr)
+// notifierFromFlags returns the notifier for the configured notification
+// targets, or nil if none is configured.
+func notifierFromFlags(ctx context.Context) (notify.Notifier, error) {
+	client := &http.Client{Timeout: notificationTimeout}
+	var notifiers []notify.Notifier
+	if flSlackWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewSlack(client, flSlackWebhookURL))
+	}
+	if flGoogleChatWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewGoogleChat(client, flGoogleChatWebhookURL))
+	}
+	if flTeamsWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewTeams(client, flTeamsWebhookURL))
+	}
+	if flPagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, notify.NewPagerDuty(client, flPagerDutyRoutingKey))
+	}
+	if flOpsgenieAPIKey != "" {
+		notifiers = append(notifiers, notify.NewOpsgenie(client, flOpsgenieAPIURL, flOpsgenieAPIKey))
+	}
+	if flJiraURL != "" {
+		if flJiraProject == "" {
+			return nil, errors.New("-jira-project is required with -jira-url")
+		}
+		notifiers = append(notifiers, notify.NewJira(client, flJiraURL, flJiraEmail, flJiraAPIToken, flJiraProject, flJiraIssueType))
+	}
+
+	if flWebhookURL != "" {
+		var payloadTemplate string
+		if flWebhookTemplateFile != "" {
+			data, err := ioutil.ReadFile(flWebhookTemplateFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read webhook template")
+			}
+			payloadTemplate = string(data)
+		}
+		webhook, err := notify.NewWebhook(client, flWebhookURL, payloadTemplate, flWebhookHeaders)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize webhook notifier")
+		}
+		webhook = webhook.WithRetries(flWebhookMaxRetries, notify.DefaultWebhookBackoff)
+		if flWebhookSecret != "" {
+			webhook = webhook.WithSecret(flWebhookSecret)
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	if flGrafanaURL != "" {
+		notifiers = append(notifiers, notify.NewGrafana(client, flGrafanaURL, flGrafanaAPIKey, flGrafanaDashboardUID))
+	}
+	if flGitHubRepo != "" {
+		github, err := notify.NewGitHub(client, flGitHubAPIURL, flGitHubToken, flGitHubRepo)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize GitHub notifier")
+		}
+		notifiers = append(notifiers, github)
+		if flGitHubPRComments {
+			comment, err := notify.NewGitHubComment(client, flGitHubAPIURL, flGitHubToken, flGitHubRepo)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to initialize GitHub comment notifier")
+			}
+			notifiers = append(notifiers, comment)
+		}
+	}
+	if flGitLabProject != "" {
+		notifiers = append(notifiers, notify.NewGitLabComment(client, flGitLabURL, flGitLabToken, flGitLabProject))
+	}
+	if flCloudEventsURL != "" {
+		notifiers = append(notifiers, notify.NewCloudEventsHTTP(client, flCloudEventsURL))
+	}
+	if flCloudEventsTopic != "" || flPubSubTopic != "" {
+		publisher, err := notify.NewAPIPublisher(ctx, googleCredentials...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Pub/Sub publisher")
+		}
+		if flCloudEventsTopic != "" {
+			notifiers = append(notifiers, notify.NewCloudEventsPubSub(publisher, flCloudEventsTopic))
+		}
+		if flPubSubTopic != "" {
+			notifiers = append(notifiers, notify.NewPubSub(publisher, flPubSubTopic))
+		}
+	}
+
+	if flBigQueryTable != "" {
+		bq, err := notify.NewBigQuery(ctx, flBigQueryTable, googleCredentials...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize BigQuery notifier")
 		}
+		notifiers = append(notifiers, bq)
+	}
 
-		duration := time.Duration(flCLILoopIntervalSec)
-		time.Sleep(duration * time.Second)
+	if flDecisionLogID != "" {
+		cl, err := notify.NewCloudLogging(ctx, flDecisionLogID, googleCredentials...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Cloud Logging notifier")
+		}
+		notifiers = append(notifiers, cl)
 	}
+
+	if flEmailTo != "" {
+		if flEmailFrom == "" {
+			return nil, errors.New("-email-to requires -email-from")
+		}
+		to := strings.Split(flEmailTo, ",")
+		switch {
+		case flSendGridAPIKey != "":
+			notifiers = append(notifiers, notify.NewSendGrid(client, flSendGridAPIKey, flEmailFrom, to))
+		case flSMTPAddr != "":
+			smtp, err := notify.NewSMTP(flSMTPAddr, flSMTPUsername, flSMTPPassword, flEmailFrom, to)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to initialize SMTP notifier")
+			}
+			notifiers = append(notifiers, smtp)
+		default:
+			return nil, errors.New("-email-to requires -smtp-addr or -sendgrid-api-key")
+		}
+	}
+
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	return notify.Multi(notifiers...), nil
+}
+
+// runDaemon handles the rollout of each targeted service every
+// -cli-run-interval, on its own schedule, until stop is closed.
+func runDaemon(ctx context.Context, logger *logrus.Logger, store *configStore, stop <-chan struct{}) {
+	interval := time.Duration(flCLILoopIntervalSec) * time.Second
+	newScheduler(logger, store, interval, flScheduleJitter, flConcurrency).run(ctx, stop)
 }
 
 func flagsAreValid() (bool, error) {
@@ -183,6 +1220,135 @@ func flagsAreValid() (bool, error) {
 		}
 	}
 
+	if flWait && !flRunOnce {
+		return false, errors.New("-wait requires -run-once")
+	}
+
+	if flController && (flConfigFile != "" || flRunOnce || flCloudDeployVerify) {
+		return false, errors.New("-controller cannot be used with -config, -run-once or -cloud-deploy-verify")
+	}
+
+	if flOnce && (flRunOnce || flController || flCLI) {
+		return false, errors.New("-once cannot be used with -run-once, -controller or -cli")
+	}
+
+	if flOut != "" && !flOnce && !flRunOnce {
+		return false, errors.New("-out can only be used with -once or -run-once")
+	}
+
+	if flOnce {
+		if err := shardFromCloudRunJob(); err != nil {
+			return false, err
+		}
+	}
+
+	if flValidate && flController {
+		return false, errors.New("-validate cannot be used with -controller")
+	}
+
+	if flRollbackTo != "" && (flRunOnce || flController) {
+		return false, errors.New("-rollback-to cannot be used with -run-once or -controller")
+	}
+
+	if flAdminAuthorizationFile != "" && flAdminAudience == "" {
+		return false, errors.New("-admin-authorization-file requires -admin-audience")
+	}
+
+	if flAdminUnauthenticated && (flAdminToken != "" || flAdminAudience != "") {
+		return false, errors.New("-admin-allow-unauthenticated cannot be used with -admin-token or -admin-audience")
+	}
+
+	if flGRPCAddr != "" && !adminAPIEnabled() {
+		return false, errors.New("-grpc-addr requires -admin-token, -admin-audience or -admin-allow-unauthenticated")
+	}
+
+	if flSignatureTolerance <= 0 {
+		return false, errors.Errorf("-signature-tolerance must be positive, got %s", flSignatureTolerance)
+	}
+
+	if flCLILoopIntervalSec <= 0 {
+		return false, errors.Errorf("-cli-run-interval must be positive, got %d", flCLILoopIntervalSec)
+	}
+
+	if flMetricsAddr != "" && !flCLI {
+		return false, errors.New("-metrics-addr can only be used with -cli, the metrics are served on /metrics in server mode")
+	}
+
+	if flLivenessIntervals < 0 {
+		return false, errors.Errorf("-liveness-intervals cannot be negative, got %d", flLivenessIntervals)
+	}
+
+	if flScheduleJitter < 0 || flScheduleJitter >= 1 {
+		return false, errors.Errorf("-schedule-jitter must be between 0 and 1 (excluded), got %v", flScheduleJitter)
+	}
+
+	if flConcurrency < 0 {
+		return false, errors.Errorf("-concurrency cannot be negative, got %d", flConcurrency)
+	}
+
+	if flServiceTimeout < 0 || flCycleTimeout < 0 || flServiceListTTL < 0 {
+		return false, errors.New("-service-timeout, -cycle-timeout and -service-list-ttl cannot be negative")
+	}
+
+	if flShardCount < 1 || flShardIndex < 0 || flShardIndex >= flShardCount {
+		return false, errors.Errorf("-shard-index must be between 0 and %d (-shard-count minus 1), got %d", flShardCount-1, flShardIndex)
+	}
+
+	if flLock != "" && flLockDuration < time.Second {
+		return false, errors.Errorf("-lock-duration must be at least 1s, got %s", flLockDuration)
+	}
+
+	if flFormat != "" {
+		flOutput = flFormat
+	}
+	if _, ok, err := format.ParseValue(flOutput); ok {
+		if err != nil {
+			return false, err
+		}
+	} else if flOutput != tableOutput && flOutput != jsonOutput && flOutput != yamlOutput {
+		return false, errors.Errorf("invalid -output %q, must be table, json, yaml or value(FIELD,...)", flOutput)
+	}
+
+	if flWatch && !flStatus {
+		return false, errors.New("-watch can only be used with -status")
+	}
+
+	if flWatchInterval <= 0 {
+		return false, errors.Errorf("-watch-interval must be positive, got %s", flWatchInterval)
+	}
+
+	if flProgress != githubProgress && flProgress != jsonProgress {
+		return false, errors.Errorf("invalid -progress-format %q, must be github or json", flProgress)
+	}
+
+	if flAutoApprove && !flApply {
+		return false, errors.New("-auto-approve can only be used with -apply")
+	}
+
+	if flHistory && flStateStore == "" {
+		return false, errors.New("-history requires -state-store")
+	}
+
+	if (flDORA || flDORAReportInterval > 0) && flStateStore == "" {
+		return false, errors.New("-dora and -dora-report-interval require -state-store")
+	}
+
+	if flDORAWindow <= 0 || flDORAReportInterval < 0 {
+		return false, errors.Errorf("-dora-window must be positive and -dora-report-interval cannot be negative, got %s and %s", flDORAWindow, flDORAReportInterval)
+	}
+
+	if flReleaseQuarantine && flStateStore == "" {
+		return false, errors.New("-release-quarantine requires -state-store, quarantines are released by restarting the operator otherwise")
+	}
+
+	if flQuarantineAfter < 0 {
+		return false, errors.Errorf("-quarantine-after cannot be negative, got %d", flQuarantineAfter)
+	}
+
+	if flRunAPIVersion != "v1" && flRunAPIVersion != "v2" {
+		return false, errors.Errorf("invalid -run-api-version %q, must be v1 or v2", flRunAPIVersion)
+	}
+
 	for _, region := range flRegions {
 		if region == "" {
 			return false, errors.New("region cannot be empty")
@@ -194,13 +1360,137 @@ func flagsAreValid() (bool, error) {
 
 // chooseMetricsProvider checks the CLI flags and determine which metrics
 // provider should be used for the rollout.
-func chooseMetricsProvider(ctx context.Context, logger *logrus.Entry, project, region, svcName string) (metrics.Provider, error) {
+func chooseMetricsProvider(ctx context.Context, logger *logrus.Entry, strategy config.Strategy, project, region, svcName string) (metrics.Provider, error) {
+	if metricsPluginConn != nil {
+		logger.Debug("using gRPC plugin as metrics provider")
+		return metricsplugin.NewProvider(metricsPluginConn, project, region, svcName), nil
+	}
 	if flGoogleSheetsID != "" {
 		logger.Debug("using Google Sheets as metrics provider")
-		return sheets.NewProvider(ctx, flGoogleSheetsID, "", region, svcName)
+		return sheets.NewProvider(ctx, flGoogleSheetsID, "", region, svcName, metricsCredentials...)
+	}
+	if flPrometheusURL != "" {
+		logger.Debug("using Prometheus as metrics provider")
+		queries := prometheus.Queries{
+			RequestCount: flPrometheusRequestCountQry,
+			ErrorRate:    flPrometheusErrorRateQry,
+			Latency:      flPrometheusLatencyQry,
+		}
+		client := &http.Client{Timeout: metricsRequestTimeout}
+		return prometheus.NewProvider(client, flPrometheusURL, queries, project, region, svcName)
+	}
+	if flJSONRequestCountURL != "" || flJSONErrorRateURL != "" || flJSONLatencyURL != "" {
+		logger.Debug("using HTTP JSON API as metrics provider")
+		queries := httpjson.Queries{
+			RequestCount: httpjson.Query{URL: flJSONRequestCountURL, JSONPath: flJSONRequestCountPath},
+			ErrorRate:    httpjson.Query{URL: flJSONErrorRateURL, JSONPath: flJSONErrorRatePath},
+			Latency:      httpjson.Query{URL: flJSONLatencyURL, JSONPath: flJSONLatencyPath},
+		}
+		client := &http.Client{Timeout: metricsRequestTimeout}
+		return httpjson.NewProvider(client, queries, flJSONHeaders, project, region, svcName)
 	}
 	logger.Debug("using Cloud Monitoring (Stackdriver) as metrics provider")
-	return stackdriver.NewProvider(ctx, project, region, svcName)
+	opts, err := apiOptions(monitoringAPITransport, metricsCredentials, metricsServiceAccountFor(strategy.Target, project))
+	if err != nil {
+		return nil, err
+	}
+	provider, err := stackdriver.NewProvider(ctx, project, region, svcName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if strategy.Protocol == config.GRPCProtocol {
+		provider = provider.WithGRPCMetrics()
+	}
+	return provider, nil
+}
+
+// probeFromFlags returns the probe configuration from the flags. If no probe
+// path was specified, nil is returned.
+func probeFromFlags() *config.Probe {
+	if flProbePath == "" {
+		return nil
+	}
+	return &config.Probe{
+		Path:              flProbePath,
+		ExpectedStatus:    flProbeStatus,
+		MaxLatency:        flProbeMaxLatency,
+		BodyRegex:         flProbeBodyRegex,
+		Requests:          flProbeRequests,
+		MinSuccessPercent: flProbeMinSuccess,
+		Authenticate:      flProbeAuthenticate,
+	}
+}
+
+// warmUpFromFlags returns the warm-up configuration from the flags. If the
+// requests per second are not positive, nil is returned.
+func warmUpFromFlags() *config.WarmUp {
+	if flWarmUpRPS <= 0 {
+		return nil
+	}
+	return &config.WarmUp{
+		RPS:          flWarmUpRPS,
+		Duration:     flWarmUpDuration,
+		Method:       flWarmUpMethod,
+		Path:         flWarmUpPath,
+		Body:         flWarmUpBody,
+		Headers:      flWarmUpHeaders,
+		Authenticate: flWarmUpAuthenticate,
+	}
+}
+
+// shadowFromFlags returns the shadow traffic configuration from the flags. If
+// no control URL was specified, nil is returned.
+func shadowFromFlags() *config.Shadow {
+	if flShadowControlURL == "" {
+		return nil
+	}
+	return &config.Shadow{
+		ControlURL:    flShadowControlURL,
+		SamplePercent: flShadowSamplePercent,
+		Duration:      flShadowDuration,
+	}
+}
+
+// attestationFromFlags returns the attestation configuration from the flags.
+// If no attestor was specified, nil is returned.
+func attestationFromFlags() *config.Attestation {
+	if flRequiredAttestors == "" {
+		return nil
+	}
+	return &config.Attestation{Attestors: strings.Split(flRequiredAttestors, ",")}
+}
+
+// vulnerabilityScanFromFlags returns the vulnerability scan configuration from
+// the flags. If no maximum severity was specified, nil is returned.
+func vulnerabilityScanFromFlags() *config.VulnerabilityScan {
+	if flMaxVulnerabilitySeverity == "" {
+		return nil
+	}
+	scan := &config.VulnerabilityScan{MaxSeverity: flMaxVulnerabilitySeverity}
+	if flIgnoredVulnerabilities != "" {
+		scan.Ignore = strings.Split(flIgnoredVulnerabilities, ",")
+	}
+	return scan
+}
+
+// jobCanaryFromFlags returns the job canary configuration from the flags. If
+// -job-canary is not set, nil is returned.
+func jobCanaryFromFlags() *config.JobCanary {
+	if !flJobCanary {
+		return nil
+	}
+	canary := &config.JobCanary{
+		Timeout:           flJobCanaryTimeout,
+		MinSuccessPercent: 100,
+		MaxDuration:       flJobCanaryMaxDuration,
+	}
+	if flJobCanaryArgs != "" {
+		canary.Args = strings.Split(flJobCanaryArgs, ",")
+	}
+	if len(flJobCanaryEnv) != 0 {
+		canary.Env = flJobCanaryEnv
+	}
+	return canary
 }
 
 // healthCriteriaFromFlags checks the metrics-related flags and return an array
@@ -224,6 +1514,21 @@ func healthCriteriaFromFlags(requestCount int, errorRate, latencyP99, latencyP95
 	return metrics
 }
 
+// traceCriteriaFromFlags returns the trace criteria from the flags. If no
+// operation was specified, nil is returned.
+func traceCriteriaFromFlags(operation string, errorRate, latencyP95 float64) []config.HealthCriterion {
+	if operation == "" {
+		return nil
+	}
+	criteria := []config.HealthCriterion{
+		{Metric: config.TraceErrorRateMetricsCheck, Operation: operation, Threshold: errorRate},
+	}
+	if latencyP95 > 0 {
+		criteria = append(criteria, config.HealthCriterion{Metric: config.TraceLatencyMetricsCheck, Operation: operation, Percentile: 95, Threshold: latencyP95})
+	}
+	return criteria
+}
+
 func printHealthCriteria(logger *logrus.Logger, healthCriteria []config.HealthCriterion) {
 	for _, criteria := range healthCriteria {
 		lg := logger.WithFields(logrus.Fields{
@@ -231,9 +1536,12 @@ func printHealthCriteria(logger *logrus.Logger, healthCriteria []config.HealthCr
 			"threshold":   criteria.Threshold,
 		})
 
-		if criteria.Metric == config.LatencyMetricsCheck {
+		if criteria.Metric == config.LatencyMetricsCheck || criteria.Metric == config.TraceLatencyMetricsCheck {
 			lg = lg.WithField("percentile", criteria.Percentile)
 		}
+		if criteria.Operation != "" {
+			lg = lg.WithField("operation", criteria.Operation)
+		}
 		lg.Debug("found health criterion")
 	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/shard"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// reconcileOnce handles the rollout of all the managed services once, e.g.
+// from a Cloud Run job triggered by Cloud Scheduler. An error is returned if
+// the rollout of any service failed. The outcomes of the rollouts are
+// recorded in the summary.
+func reconcileOnce(ctx context.Context, logger *logrus.Logger, cfg *config.Config) error {
+	errs := runRollouts(ctx, logger, cfg)
+	if len(errs) != 0 {
+		return errors.Errorf("there were %d errors: \n%s", len(errs), rolloutErrsToString(errs))
+	}
+	return nil
+}
+
+// shardFromCloudRunJob sets the shard flags, unless they are set, to the task
+// of the Cloud Run job the operator runs in, if any, so the services are split
+// between the tasks of the job.
+func shardFromCloudRunJob() error {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "shard-index" || f.Name == "shard-count" {
+			explicit = true
+		}
+	})
+	if explicit {
+		return nil
+	}
+
+	index, count, ok, err := shard.FromCloudRunJob(os.Getenv)
+	if err != nil || !ok {
+		return err
+	}
+	flShardIndex, flShardCount = index, count
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// planFormatVersion is the version of the format of the plans printed by
+// -plan and -apply. It only changes when a field is removed or changes
+// meaning, so wrappers (e.g. a Terraform provider) can rely on it.
+const planFormatVersion = "1"
+
+// plan is the traffic changes the next rollout cycle of the targeted services
+// intends to make, as printed by -plan and -apply.
+type plan struct {
+	FormatVersion string         `json:"formatVersion" yaml:"formatVersion"`
+	Changes       int            `json:"changes" yaml:"changes"`
+	Services      []plannedCycle `json:"services" yaml:"services"`
+	Errors        []string       `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// plannedCycle is the intended rollout cycle of a service. Applied is the
+// decision of the cycle once applied, which can differ from the planned one
+// if the metrics or the service changed in between.
+type plannedCycle struct {
+	Project   string          `json:"project" yaml:"project"`
+	Region    string          `json:"region" yaml:"region"`
+	Namespace string          `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Service   string          `json:"service" yaml:"service"`
+	Strategy  string          `json:"strategy" yaml:"strategy"`
+	Stable    string          `json:"stable,omitempty" yaml:"stable,omitempty"`
+	Candidate string          `json:"candidate,omitempty" yaml:"candidate,omitempty"`
+	Decision  string          `json:"decision" yaml:"decision"`
+	Changed   bool            `json:"changed" yaml:"changed"`
+	Before    []plannedTarget `json:"before" yaml:"before"`
+	After     []plannedTarget `json:"after" yaml:"after"`
+	Error     string          `json:"error,omitempty" yaml:"error,omitempty"`
+	Applied   string          `json:"applied,omitempty" yaml:"applied,omitempty"`
+}
+
+// plannedTarget is a traffic target of a service.
+type plannedTarget struct {
+	Revision string `json:"revision" yaml:"revision"`
+	Percent  int64  `json:"percent" yaml:"percent"`
+	Tag      string `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// planRollouts plans the next rollout cycle of the targeted services, without
+// changing them, notifying, archiving or saving any state. The members of a
+// release group are planned together, in their order of handling.
+func planRollouts(ctx context.Context, logger *logrus.Logger, cfg *config.Config) (*plan, []managedService, error) {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get targeted services")
+	}
+	// The rollouts change the services in place, so they are planned on
+	// copies, and the services can then be applied.
+	copies := make([]managedService, len(svcs))
+	for i, svc := range svcs {
+		record := *svc.service
+		if err := copyService(svc.service.Service, &record.Service); err != nil {
+			return nil, nil, err
+		}
+		copies[i] = svc
+		copies[i].service = &record
+	}
+
+	result := &plan{FormatVersion: planFormatVersion, Services: []plannedCycle{}}
+	for _, unit := range releaseGroupUnits(copies) {
+		var group *rollout.ReleaseGroup
+		if name := releaseGroupName(unit[0]); name != "" {
+			records := make([]*rollout.ServiceRecord, len(unit))
+			for i, svc := range unit {
+				records[i] = svc.service
+			}
+			if group, err = rollout.NewReleaseGroup(name, records); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+		}
+		for _, svc := range unit {
+			cycle := planRollout(ctx, logger, svc, group)
+			if cycle.Changed {
+				result.Changes++
+			}
+			if cycle.Error != "" {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", serviceKey(svc), cycle.Error))
+			}
+			result.Services = append(result.Services, cycle)
+		}
+	}
+	return result, svcs, nil
+}
+
+// planRollout plans the next rollout cycle of the service. The pre-traffic
+// checks of the strategy are not run, so the plan assumes they pass.
+func planRollout(ctx context.Context, logger *logrus.Logger, svc managedService, group *rollout.ReleaseGroup) plannedCycle {
+	service := svc.service
+	stable := rollout.DetectStableRevisionName(service.Service)
+	cycle := plannedCycle{
+		Project:   service.Project,
+		Region:    service.Region,
+		Namespace: service.Namespace,
+		Service:   service.Metadata.Name,
+		Strategy:  svc.strategyName,
+		Stable:    stable,
+	}
+	if service.Spec != nil {
+		cycle.Before = plannedTargets(service.Spec.Traffic)
+	}
+	if stable != "" {
+		cycle.Candidate = rollout.DetectCandidateRevisionName(service.Service, stable)
+	}
+	cycle.After = cycle.Before
+
+	strategy := svc.strategy
+	strategy.Probe, strategy.WarmUp, strategy.Shadow = nil, nil, nil
+	lg := logger.WithFields(logrus.Fields{"project": service.Project, "service": service.Metadata.Name, "region": service.Region})
+	roll, err := newRollout(ctx, lg, service, strategy)
+	if err != nil {
+		cycle.Decision, cycle.Error = archive.ErrorDecision, err.Error()
+		return cycle
+	}
+	if group != nil {
+		roll = roll.WithReleaseGroup(group)
+	}
+	res := roll.Plan()
+	cycle.Decision = res.Decision
+	if res.Err != nil {
+		cycle.Error = res.Err.Error()
+	}
+	cycle.Before, cycle.After, cycle.Changed = plannedTargets(res.Before), plannedTargets(res.After), res.Changed
+	return cycle
+}
+
+// copyService sets the copy to a deep copy of the service.
+func copyService(svc *run.Service, copied **run.Service) error {
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return errors.Wrap(err, "could not encode service")
+	}
+	return errors.Wrap(json.Unmarshal(data, copied), "could not decode service")
+}
+
+// plannedTargets returns the traffic targets.
+func plannedTargets(traffic []*run.TrafficTarget) []plannedTarget {
+	targets := []plannedTarget{}
+	for _, target := range traffic {
+		revision := target.RevisionName
+		if target.LatestRevision {
+			revision = "LATEST"
+		}
+		targets = append(targets, plannedTarget{Revision: revision, Percent: target.Percent, Tag: target.Tag})
+	}
+	return targets
+}
+
+// printPlan prints the plan of the next rollout cycle of the targeted
+// services and exits.
+func printPlan(ctx context.Context, logger *logrus.Logger, cfg *config.Config, output string, w io.Writer) error {
+	p, _, err := planRollouts(ctx, logger, cfg)
+	if err != nil {
+		return err
+	}
+	return writePlan(w, output, p)
+}
+
+// applyPlan plans the next rollout cycle of the targeted services and, once
+// the plan is confirmed on stdin (unless autoApprove is set), handles the
+// rollouts of the services with traffic changes. The plan is printed with the
+// applied decisions.
+func applyPlan(ctx context.Context, logger *logrus.Logger, cfg *config.Config, output string, autoApprove bool, in io.Reader, prompt, w io.Writer) error {
+	p, svcs, err := planRollouts(ctx, logger, cfg)
+	if err != nil {
+		return err
+	}
+	if p.Changes == 0 {
+		fmt.Fprintln(prompt, "No traffic changes.")
+		return writePlan(w, output, p)
+	}
+	if !autoApprove {
+		if err := writePlan(prompt, tableOutput, p); err != nil {
+			return err
+		}
+		fmt.Fprintf(prompt, "\nApply the traffic changes of %d services? Only 'yes' will be accepted: ", p.Changes)
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			return errors.New("apply canceled")
+		}
+	}
+
+	changed := make(map[string]bool)
+	for _, cycle := range p.Services {
+		if cycle.Changed {
+			changed[path.Join(cycle.Project, cycle.Region, cycle.Namespace, cycle.Service)] = true
+		}
+	}
+	summary = newRunSummary()
+	var errs []error
+	for _, unit := range releaseGroupUnits(svcs) {
+		for _, svc := range unit {
+			if changed[serviceKey(svc)] {
+				unitErrs, _ := handleUnit(ctx, logger, unit)
+				errs = append(errs, unitErrs...)
+				break
+			}
+		}
+	}
+	applied := make(map[string]string)
+	for _, outcome := range summary.Services {
+		applied[path.Join(outcome.Project, outcome.Region, outcome.Namespace, outcome.Service)] = outcome.Decision
+	}
+	for i, cycle := range p.Services {
+		p.Services[i].Applied = applied[path.Join(cycle.Project, cycle.Region, cycle.Namespace, cycle.Service)]
+	}
+	for _, err := range errs {
+		p.Errors = append(p.Errors, err.Error())
+	}
+	if err := writePlan(w, output, p); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("there were %d errors: \n%s", len(errs), rolloutErrsToString(errs))
+	}
+	return nil
+}
+
+// writePlan prints the plan in the output format.
+func writePlan(w io.Writer, output string, p *plan) error {
+	if ok, err := writeValues(w, output, p.Services); ok {
+		return errors.Wrap(err, "failed to print plan")
+	}
+	switch output {
+	case jsonOutput:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(p), "failed to print plan")
+	case yamlOutput:
+		return errors.Wrap(yaml.NewEncoder(w).Encode(p), "failed to print plan")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTRATEGY\tCANDIDATE\tDECISION\tBEFORE\tAFTER")
+	for _, cycle := range p.Services {
+		after := formatTargets(cycle.After)
+		if !cycle.Changed {
+			after = "(unchanged)"
+		}
+		decision := cycle.Decision
+		if cycle.Applied != "" {
+			decision += " (applied: " + cycle.Applied + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", path.Join(cycle.Project, cycle.Region, cycle.Namespace, cycle.Service),
+			cycle.Strategy, orDash(cycle.Candidate), decision, formatTargets(cycle.Before), after)
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "failed to print plan")
+	}
+	for _, err := range p.Errors {
+		fmt.Fprintf(w, "error: %s\n", err)
+	}
+	return nil
+}
+
+// formatTargets returns the traffic targets as text, e.g. stable-001=80%,
+// candidate-002=20%.
+func formatTargets(targets []plannedTarget) string {
+	if len(targets) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if target.Percent == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d%%", target.Revision, target.Percent))
+	}
+	return strings.Join(parts, ",")
+}
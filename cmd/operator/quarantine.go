@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The rollout of a service is retried after errorBackoffBase following its
+// first consecutive error, then after twice as long following every other
+// error, up to errorBackoffMax.
+const (
+	errorBackoffBase = time.Minute
+	errorBackoffMax  = time.Hour
+)
+
+// serviceErrors tracks the consecutive operator errors of the rollouts of the
+// services.
+var serviceErrors = &errorTracker{services: make(map[string]*errorStreak)}
+
+// errorTracker backs off the rollout of the services that fail on every
+// cycle (e.g. missing permissions or corrupted annotations), and quarantines
+// them after -quarantine-after consecutive errors: their rollout is no longer
+// handled until they are released with -release-quarantine. Retryable errors
+// (e.g. a quota blip or a concurrent modification) neither extend nor end the
+// streak, and the rollout is retried on the next cycle.
+//
+// The streaks of errors are kept in memory, so the back-off only applies to
+// the long-running modes. The quarantines are also kept in the state store, if
+// any, so they survive the restarts of the operator and apply to all its
+// replicas.
+type errorTracker struct {
+	mu       sync.Mutex
+	services map[string]*errorStreak
+}
+
+// errorStreak is the streak of consecutive errors of a service.
+type errorStreak struct {
+	errors      int64
+	retryAt     time.Time
+	quarantined bool
+
+	// checked is set once the quarantine of the service was read from the
+	// state store.
+	checked bool
+}
+
+// admit determines if the rollout of the service can be handled: it is not
+// quarantined, nor backing off after an error. The quarantine is read from
+// the state store the first time, and every time while the service is
+// quarantined, to find out if it was released.
+func (t *errorTracker) admit(ctx context.Context, lg *logrus.Entry, key string) (admitted, quarantined bool) {
+	t.mu.Lock()
+	streak := t.streak(key)
+	check := stateStore != nil && (!streak.checked || streak.quarantined)
+	t.mu.Unlock()
+
+	if check {
+		st, err := stateStore.Get(ctx, key)
+		if err != nil {
+			lg.Warnf("could not check quarantine: %v", err)
+		} else {
+			t.mu.Lock()
+			stored := st != nil && st.Quarantine != nil
+			if streak.quarantined && !stored {
+				lg.Info("service was released from quarantine")
+				*streak = errorStreak{}
+			}
+			streak.quarantined, streak.checked = stored, true
+			t.mu.Unlock()
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if streak.quarantined {
+		lg.Debug("service is quarantined, rollout skipped")
+		return false, true
+	}
+	if now := time.Now(); now.Before(streak.retryAt) {
+		lg.Debugf("backing off after %d consecutive errors, rollout skipped until %s", streak.errors, streak.retryAt.Format(time.RFC3339))
+		return false, false
+	}
+	return true, false
+}
+
+// succeeded ends the streak of errors of the service.
+func (t *errorTracker) succeeded(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	streak := t.streak(key)
+	streak.errors, streak.retryAt = 0, time.Time{}
+}
+
+// failed extends the streak of errors of the service, delays its next rollout
+// and quarantines it if the streak reaches -quarantine-after, unless the error
+// is retryable.
+func (t *errorTracker) failed(ctx context.Context, lg *logrus.Entry, service *rollout.ServiceRecord, key string, err error) {
+	if rollout.IsRetryable(err) {
+		lg.WithField("errorKind", rollout.ErrorKind(err)).Debug("retryable error, rollout retried on the next cycle")
+		return
+	}
+	t.mu.Lock()
+	streak := t.streak(key)
+	streak.errors++
+	backoff := errorBackoffBase
+	for i := int64(1); i < streak.errors && backoff < errorBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > errorBackoffMax {
+		backoff = errorBackoffMax
+	}
+	streak.retryAt = time.Now().Add(backoff)
+	quarantine := flQuarantineAfter > 0 && streak.errors >= int64(flQuarantineAfter) && !streak.quarantined
+	if quarantine {
+		streak.quarantined = true
+	}
+	errs := streak.errors
+	t.mu.Unlock()
+
+	if !quarantine {
+		lg.Debugf("rollout backing off for %s after %d consecutive errors", backoff, errs)
+		return
+	}
+	lg.Errorf("service quarantined after %d consecutive errors, its rollout is no longer handled until it is released, error=%v", errs, err)
+	if stateStore != nil {
+		if err := putQuarantine(ctx, key, &state.Quarantine{Since: time.Now(), Errors: errs, LastError: err.Error()}); err != nil {
+			lg.Warnf("could not store quarantine: %v", err)
+		}
+	}
+	if notifier != nil {
+		event := notify.Event{
+			Type:    notify.QuarantinedEvent,
+			Project: service.Project,
+			Region:  service.Region,
+			Service: service.Metadata.Name,
+			Report:  fmt.Sprintf("%d consecutive errors, last error (%s): %v", errs, rollout.ErrorKind(err), err),
+			Time:    time.Now(),
+		}
+		if err := notifier.Notify(ctx, event); err != nil {
+			lg.Warnf("could not send quarantine notification: %v", err)
+		}
+	}
+}
+
+// streak returns the streak of errors of the service. The lock must be held.
+func (t *errorTracker) streak(key string) *errorStreak {
+	streak, ok := t.services[key]
+	if !ok {
+		streak = &errorStreak{}
+		t.services[key] = streak
+	}
+	return streak
+}
+
+// putQuarantine sets the quarantine of the service in the state store, or
+// removes it if it is nil.
+func putQuarantine(ctx context.Context, key string, quarantine *state.Quarantine) error {
+	st, err := stateStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		st = &state.State{}
+	}
+	st.Quarantine = quarantine
+	return stateStore.Put(ctx, key, st)
+}
+
+// releaseQuarantine releases the targeted services from quarantine in the
+// state store and prints the released services.
+func releaseQuarantine(ctx context.Context, logger *logrus.Logger, cfg *config.Config, w io.Writer) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	var released int
+	for _, svc := range svcs {
+		service := svc.service
+		key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+		st, err := stateStore.Get(ctx, key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get state of %s", key)
+		}
+		if st == nil || st.Quarantine == nil {
+			continue
+		}
+		if err := putQuarantine(ctx, key, nil); err != nil {
+			return errors.Wrapf(err, "failed to release %s", key)
+		}
+		fmt.Fprintf(w, "released %s (quarantined since %s after %d errors, last error: %s)\n",
+			key, st.Quarantine.Since.Format(time.RFC3339), st.Quarantine.Errors, st.Quarantine.LastError)
+		released++
+	}
+	fmt.Fprintf(w, "%d services released from quarantine\n", released)
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/configsource"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// configStore holds the current configuration. It is replaced atomically when
+// the configuration changes, so each rollout cycle uses a consistent
+// configuration.
+type configStore struct {
+	value atomic.Value
+}
+
+// newConfigStore initializes a store with the configuration.
+func newConfigStore(cfg *config.Config) *configStore {
+	store := &configStore{}
+	store.value.Store(cfg)
+	return store
+}
+
+// Load returns the current configuration.
+func (s *configStore) Load() *config.Config {
+	return s.value.Load().(*config.Config)
+}
+
+// Store replaces the current configuration.
+func (s *configStore) Store(cfg *config.Config) {
+	s.value.Store(cfg)
+}
+
+// watchConfig reads the configuration from the source every interval until
+// the context is cancelled. data is the content the current configuration was
+// loaded from and profile is the profile of the file in use. Valid changes are
+// applied to the store, or to the canary services first with -config-canary,
+// and logged; invalid ones are logged and the current configuration is kept.
+func watchConfig(ctx context.Context, logger *logrus.Logger, source configsource.Source, data []byte, profile string, interval time.Duration, store *configStore) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		newData, err := source.Read(ctx)
+		if err != nil {
+			logger.Warnf("could not read configuration: %v", err)
+			continue
+		}
+		if bytes.Equal(newData, data) {
+			continue
+		}
+		data = newData
+		cfg, err := config.Load(data, profile)
+		if err != nil {
+			logger.Errorf("configuration not reloaded, invalid configuration: %v", err)
+			continue
+		}
+
+		changes := config.Diff(store.Load(), cfg)
+		if len(changes) == 0 {
+			store.Store(cfg)
+			strategyCanary.cancel(logger)
+			logger.Info("configuration changed, no setting changed")
+			continue
+		}
+		strategyCanary.start(logger, flConfigCanary, store, cfg)
+		for _, change := range changes {
+			logger.Infof("configuration changed: %s", change)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// rollbackService rolls the single targeted service back to the revision.
+func rollbackService(ctx context.Context, logger *logrus.Logger, cfg *config.Config, revision string) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	if len(svcs) != 1 {
+		return errors.Errorf("rollback manages exactly one service, %d match the targets", len(svcs))
+	}
+	return handleRollback(ctx, logger, svcs[0].service, svcs[0].strategy, revision)
+}
+
+// handleRollback redirects all the traffic of the service to the revision and
+// makes it the stable revision.
+func handleRollback(ctx context.Context, logger *logrus.Logger, service *rollout.ServiceRecord, strategy config.Strategy, revision string) error {
+	lg := logger.WithFields(logrus.Fields{
+		"project":  service.Project,
+		"service":  service.Metadata.Name,
+		"region":   service.Region,
+		"revision": revision,
+	})
+
+	if !cycles.Begin() {
+		return errors.New("the operator is shutting down")
+	}
+	defer cycles.End()
+
+	roll, err := newRollout(ctx, lg, service, strategy)
+	if err != nil {
+		return err
+	}
+	key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+	locked, err := withServiceLock(ctx, lg, key, func() error {
+		return roll.RollbackTo(revision)
+	})
+	if err != nil {
+		lg.Errorf("rollback failed, error=%v", err)
+		return errors.Wrap(err, "rollback failed")
+	}
+	if !locked {
+		return errors.New("rollout of the service is being handled by another replica, try again later")
+	}
+	lg.Info("service was successfully rolled back")
+	return nil
+}
+
+// makeRollbackHandler creates a request handler that rolls a managed service
+// back to a revision. The service is identified by the project, region,
+// service and, for Knative Serving, namespace query parameters and the
+// revision by the revision parameter. It is authenticated and authorized like
+// the admin API.
+func makeRollbackHandler(logger *logrus.Logger, store *configStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		principal, err := authenticateAdmin(ctx, req.Header.Get("Authorization"))
+		if err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("admin API request rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := req.URL.Query()
+		project, region, name, revision := query.Get("project"), query.Get("region"), query.Get("service"), query.Get("revision")
+		if project == "" || region == "" || name == "" || revision == "" {
+			http.Error(w, "project, region, service and revision are required", http.StatusBadRequest)
+			return
+		}
+		lg := auditLogger(logger, principal, rollbackAction, project, region, name).WithField("revision", revision)
+		if !adminAllowed(principal, rollbackAction, project, region, name) {
+			lg.Warn("admin action denied")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		svc, err := findManagedService(ctx, logger, store.Load(), project, region, query.Get("namespace"), name)
+		if err != nil {
+			logger.Warn(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if svc == nil {
+			http.Error(w, "service is not managed by the operator", http.StatusNotFound)
+			return
+		}
+		if err := handleRollback(ctx, logger, svc.service, svc.strategy, revision); err != nil {
+			lg.Errorf("admin action failed, error=%v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lg.Info("admin action applied")
+	}
+}
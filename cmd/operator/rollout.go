@@ -3,72 +3,192 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"path"
+	"strconv"
 	"sync"
+	"time"
 
-	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/attestation"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/cloudtrace"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/mirror"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/outcome"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/workpool"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/idtoken"
 )
 
-// runRollouts concurrently handles the rollout of the targeted services.
-func runRollouts(ctx context.Context, logger *logrus.Logger, strategy config.Strategy) []error {
-	svcs, err := getTargetedServices(ctx, logger, strategy.Target)
+// candidateRequestTimeout is the maximum time a single synthetic request to the
+// candidate can take.
+const candidateRequestTimeout = 30 * time.Second
+
+// notificationTimeout is the maximum time a request to a notification webhook
+// can take.
+const notificationTimeout = 10 * time.Second
+
+// runRollouts concurrently handles the rollout of the services targeted by
+// the strategies of the configuration.
+//
+// The pass is canceled after -cycle-timeout, if set: the rollouts in progress
+// fail with their context, and the services not handled yet are skipped, so a
+// slow dependency (e.g. a Cloud Monitoring outage) cannot hold up the pass
+// indefinitely.
+func runRollouts(ctx context.Context, logger *logrus.Logger, cfg *config.Config) (errs []error) {
+	if flCycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flCycleTimeout)
+		defer cancel()
+	}
+	ctx, span := startSpan(ctx, "cycle")
+	defer func() {
+		span.SetAttribute("errors", strconv.Itoa(len(errs)))
+		if len(errs) != 0 {
+			span.End(errors.Errorf("%d rollouts failed", len(errs)))
+			return
+		}
+		span.End(nil)
+	}()
+
+	fleetPause.refresh(ctx, logger)
+	fleetPause.logCycle(logger)
+	svcs, err := getManagedServices(ctx, logger, cfg)
 	if err != nil {
 		return []error{errors.Wrap(err, "failed to get targeted services")}
 	}
+	if flShardCount > 1 {
+		svcs = shardServices(svcs, flShardIndex, flShardCount)
+		logger.WithField("shard", flShardIndex).Debugf("%d services in shard", len(svcs))
+	}
 	if len(svcs) == 0 {
 		logger.Warn("no service matches the targets")
 	}
+	span.SetAttribute("services", strconv.Itoa(len(svcs)))
 
+	// The services are handled by a pool of workers, in an order that
+	// alternates between the regions, so a slow region does not hold up
+	// all the workers. The members of a release group are handled by the
+	// same worker.
+	units := releaseGroupUnits(interleaveRegions(svcs))
 	var (
-		errs []error
-		mu   sync.Mutex
-		wg   sync.WaitGroup
+		mu      sync.Mutex
+		skipped int
 	)
-	for _, svc := range svcs {
-		wg.Add(1)
-		go func(ctx context.Context, lg *logrus.Logger, svc *rollout.ServiceRecord, strategy config.Strategy) {
-			defer wg.Done()
-			err := handleRollout(ctx, lg, svc, strategy)
-			if err != nil {
-				lg.Debugf("rollout error for service %q: %+v", svc.Service.Metadata.Name, err)
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			}
-		}(ctx, logger, svc, strategy)
-	}
-	wg.Wait()
+	workpool.Run(len(units), flConcurrency, func(i int) {
+		unitErrs, unitSkipped := handleUnit(ctx, logger, units[i])
+		mu.Lock()
+		errs = append(errs, unitErrs...)
+		skipped += unitSkipped
+		mu.Unlock()
+	})
 
+	errs = append(errs, runJobRollouts(ctx, logger, cfg)...)
+
+	span.SetAttribute("skipped", strconv.Itoa(skipped))
+	if skipped != 0 {
+		logger.Warnf("reconcile pass exceeded -cycle-timeout of %s, %d services skipped", flCycleTimeout, skipped)
+		errs = append(errs, errors.Errorf("cycle timeout of %s exceeded, %d services skipped", flCycleTimeout, skipped))
+	}
 	return errs
 }
 
-// handleRollout manages the rollout process for a single service.
-func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.ServiceRecord, strategy config.Strategy) error {
+// skipService records that the rollout of the service was skipped because
+// the reconcile pass exceeded -cycle-timeout.
+func skipService(logger *logrus.Logger, service *rollout.ServiceRecord) {
+	logger.WithFields(logrus.Fields{
+		"project": service.Project,
+		"service": service.Metadata.Name,
+		"region":  service.Region,
+	}).Debug("cycle timeout exceeded, rollout skipped")
+	skippedServices.Inc()
+	if summary != nil {
+		summary.setOutcome(service, outcome.Skipped, "")
+	}
+}
+
+// handleRolloutWithTimeout manages the rollout process for a single service,
+// which is canceled after -service-timeout, if set.
+func handleRolloutWithTimeout(ctx context.Context, logger *logrus.Logger, service *rollout.ServiceRecord, strategy config.Strategy, group *rollout.ReleaseGroup) error {
+	if flServiceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flServiceTimeout)
+		defer cancel()
+	}
+	return handleRollout(ctx, logger, service, strategy, group)
+}
+
+// handleRollout manages the rollout process for a single service, unless it
+// is quarantined or backing off after errors (see errorTracker). The group is
+// the release group of the service, if handled with the other members.
+func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.ServiceRecord, strategy config.Strategy, group *rollout.ReleaseGroup) (err error) {
 	lg := logger.WithFields(logrus.Fields{
 		"project": service.Project,
 		"service": service.Metadata.Name,
 		"region":  service.Region,
 	})
+	if strategy.Name != "" {
+		lg = lg.WithField("strategy", strategy.Name)
+	}
 
-	client, err := runapi.NewAPIClient(ctx, service.Region)
-	if err != nil {
-		return errors.Wrap(err, "failed to initialize Cloud Run API client")
+	if !cycles.Begin() {
+		lg.Debug("shutting down, rollout skipped")
+		return nil
+	}
+	defer cycles.End()
+
+	key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+	if admitted, quarantined := serviceErrors.admit(ctx, lg, key); !admitted {
+		if quarantined && summary != nil {
+			summary.setOutcome(service, outcome.Quarantined, "")
+		}
+		return nil
 	}
-	metricsProvider, err := chooseMetricsProvider(ctx, lg, service.Project, service.Region, service.Metadata.Name)
+	defer func() {
+		if err != nil {
+			serviceErrors.failed(ctx, lg, service, key, err)
+		}
+	}()
+
+	ctx, span := startSpan(ctx, "rollout")
+	span.SetAttribute("project", service.Project)
+	span.SetAttribute("region", service.Region)
+	span.SetAttribute("service", service.Metadata.Name)
+	defer func() { span.End(err) }()
+
+	start := time.Now()
+	roll, err := newRollout(ctx, lg, service, strategy)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize metrics provider")
+		observeCycle(start, err)
+		return err
+	}
+	if group != nil {
+		roll = roll.WithReleaseGroup(group)
 	}
-	roll := rollout.New(ctx, metricsProvider, service, strategy).WithClient(client).WithLogger(lg.Logger)
 
-	changed, err := roll.Rollout()
+	var changed bool
+	locked, err := withServiceLock(ctx, lg, key, func() (err error) {
+		result := roll.Run()
+		changed, err = result.Changed, result.Err
+		observeCycle(start, err)
+		strategyCanary.record(logger, key, result.Decision)
+		return err
+	})
 	if err != nil {
-		lg.Errorf("rollout failed, error=%v", err)
+		lg.WithField("errorKind", rollout.ErrorKind(err)).Errorf("rollout failed, error=%v", err)
 		return errors.Wrap(err, "rollout failed")
 	}
+	if !locked {
+		lg.Debug("rollout handled by another replica")
+		return nil
+	}
 
+	serviceErrors.succeeded(key)
 	if changed {
 		lg.Info("service was successfully updated")
 	} else {
@@ -77,6 +197,145 @@ func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.
 	return nil
 }
 
+// newRollout initializes the rollout manager of a single service.
+func newRollout(ctx context.Context, lg *logrus.Entry, service *rollout.ServiceRecord, strategy config.Strategy) (*rollout.Rollout, error) {
+	client, err := newRunClient(ctx, strategy.Target, service.Project, service.Region)
+	if err != nil {
+		return nil, err
+	}
+	metricsProvider, err := chooseMetricsProvider(ctx, lg, strategy, service.Project, service.Region, service.Metadata.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize metrics provider")
+	}
+	if hasTraceCriteria(strategy.HealthCriteria) {
+		opts, err := clientOptions(metricsCredentials, metricsServiceAccountFor(strategy.Target, service.Project))
+		if err != nil {
+			return nil, err
+		}
+		traces, err := cloudtrace.NewProvider(ctx, service.Project, flTraceRevisionLabel, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Cloud Trace metrics provider")
+		}
+		metricsProvider = cloudtrace.WithSpans(metricsProvider, traces)
+	}
+	if chaosInjector != nil {
+		metricsProvider = chaosInjector.Provider(metricsProvider)
+	}
+	cacheID := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+	metricsProvider = metricsCache.Wrap(cacheID, metrics.Instrument(metricsProvider, observeMetricsQuery))
+	roll := rollout.New(ctx, metricsProvider, service, strategy).WithClient(client).WithLogger(lg.Logger).WithNotifier(notifier).
+		WithReconciliationTimeout(flReconciliationTimeout).WithFleetPause(fleetPause.paused())
+	if stateStore != nil {
+		roll = roll.WithStateStore(stateStore, cacheID)
+	}
+	roll = roll.WithArchive(telemetryArchive{archive: rolloutArchive})
+	if policyEvaluator != nil {
+		roll = roll.WithPolicy(policyEvaluator)
+	}
+	if imageInspector != nil {
+		roll = roll.WithImageInspector(imageInspector)
+	}
+	if strategy.Probe != nil {
+		client, err := newCandidateHTTPClient(ctx, strategy.Probe.Authenticate, service.Status.Url)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize HTTP client for probes")
+		}
+		prober, err := probe.New(client, *strategy.Probe)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize prober")
+		}
+		roll = roll.WithProber(prober)
+	}
+	if strategy.WarmUp != nil {
+		client, err := newCandidateHTTPClient(ctx, strategy.WarmUp.Authenticate, service.Status.Url)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize HTTP client for synthetic load")
+		}
+		roll = roll.WithLoadGenerator(loadgen.New(client, *strategy.WarmUp))
+	}
+	if strategy.Shadow != nil {
+		client := &http.Client{Timeout: candidateRequestTimeout}
+		roll = roll.WithMirrorController(mirror.NewHTTPController(client, strategy.Shadow.ControlURL))
+	}
+	if strategy.Attestation != nil {
+		verifier, err := sharedAttestationVerifier()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize attestation verifier")
+		}
+		roll = roll.WithAttestationVerifier(verifier)
+	}
+	if strategy.VulnerabilityScan != nil {
+		scanner, err := sharedVulnerabilityScanner()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize vulnerability scanner")
+		}
+		roll = roll.WithVulnerabilityScanner(scanner)
+	}
+	return roll, nil
+}
+
+// The verifier of the attestations is shared by the rollouts of all the
+// services, so the notes of the attestors are only looked up once, and
+// initialized on first use.
+var (
+	attestationVerifier     *attestation.BinaryAuthorization
+	attestationVerifierErr  error
+	attestationVerifierOnce sync.Once
+)
+
+// sharedAttestationVerifier returns the verifier of the attestations of the
+// images of the candidates. It is not bound to the context of the rollout
+// that first uses it, which can be canceled before the others.
+func sharedAttestationVerifier() (*attestation.BinaryAuthorization, error) {
+	attestationVerifierOnce.Do(func() {
+		attestationVerifier, attestationVerifierErr = attestation.NewBinaryAuthorization(context.Background(), googleCredentials...)
+	})
+	return attestationVerifier, attestationVerifierErr
+}
+
+// The scanner of the vulnerabilities is shared by the rollouts of all the
+// services too.
+var (
+	vulnerabilityScanner     *vulnerability.ContainerAnalysis
+	vulnerabilityScannerErr  error
+	vulnerabilityScannerOnce sync.Once
+)
+
+// sharedVulnerabilityScanner returns the scanner of the vulnerabilities of the
+// images of the candidates, not bound to the context of a rollout either.
+func sharedVulnerabilityScanner() (*vulnerability.ContainerAnalysis, error) {
+	vulnerabilityScannerOnce.Do(func() {
+		vulnerabilityScanner, vulnerabilityScannerErr = vulnerability.NewContainerAnalysis(context.Background(), googleCredentials...)
+	})
+	return vulnerabilityScanner, vulnerabilityScannerErr
+}
+
+// hasTraceCriteria determines if any of the health criteria is computed from
+// traces.
+func hasTraceCriteria(healthCriteria []config.HealthCriterion) bool {
+	for _, criterion := range healthCriteria {
+		if criterion.Metric == config.TraceErrorRateMetricsCheck || criterion.Metric == config.TraceLatencyMetricsCheck {
+			return true
+		}
+	}
+	return false
+}
+
+// newCandidateHTTPClient initializes a client to send synthetic requests to
+// the candidate. If authentication is required, requests include an ID token
+// with the service URL as audience.
+func newCandidateHTTPClient(ctx context.Context, authenticate bool, serviceURL string) (*http.Client, error) {
+	if !authenticate {
+		return &http.Client{Timeout: candidateRequestTimeout}, nil
+	}
+	client, err := idtoken.NewClient(ctx, serviceURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize authenticated HTTP client")
+	}
+	client.Timeout = candidateRequestTimeout
+	return client, nil
+}
+
 // rolloutErrsToString returns the string representation of all the errors found
 // during the rollout of all targeted services.
 func rolloutErrsToString(errs []error) (errsStr string) {
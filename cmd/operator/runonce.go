@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/outcome"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// Formats of the progress of -run-once -wait.
+const (
+	githubProgress = "github"
+	jsonProgress   = "json"
+)
+
+// Events of the progress of -run-once -wait.
+const (
+	noCandidateProgressEvent = "noCandidate"
+	startProgressEvent       = "start"
+	stepProgressEvent        = "step"
+	retryProgressEvent       = "retry"
+	promotedProgressEvent    = "promoted"
+	rolledBackProgressEvent  = "rolledBack"
+	timedOutProgressEvent    = "timedOut"
+)
+
+// waitProgress is a transition of the rollout of the candidate with -run-once
+// -wait, printed as a JSON line with -progress-format=json. Step is the
+// position of the candidate's traffic in the steps of the strategy, or 0 if
+// it is not at a step.
+type waitProgress struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Project   string    `json:"project"`
+	Region    string    `json:"region"`
+	Service   string    `json:"service"`
+	Candidate string    `json:"candidate"`
+	Percent   int64     `json:"percent"`
+	Step      int       `json:"step"`
+	Steps     int       `json:"steps"`
+	Diagnosis string    `json:"diagnosis,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// runOnce handles the rollout of the single targeted service once. If wait
+// is set, the rollout is repeated until the candidate is promoted or rolled
+// back, or the timeout is reached, which is recorded as the outcome of the
+// service in the summary, so CI pipelines can gate on the result. The wait is
+// interrupted when the context is canceled. Progress is printed at each
+// transition in the progress format: GitHub Actions workflow commands, or JSON
+// lines.
+func runOnce(ctx context.Context, logger *logrus.Logger, cfg *config.Config, wait bool, interval, timeout time.Duration, progressFormat string) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	if len(svcs) != 1 {
+		return errors.Errorf("run-once mode manages exactly one service, %d match the targets", len(svcs))
+	}
+	service, strategy := svcs[0].service, svcs[0].strategy
+	name := service.Metadata.Name
+	stable := rollout.DetectStableRevisionName(service.Service)
+	candidate := rollout.DetectCandidateRevisionName(service.Service, stable)
+	report := func(command, event, format string, args ...interface{}) {
+		if progressFormat != jsonProgress {
+			githubActionsCommand(command, format, args...)
+			return
+		}
+		printWaitProgress(service, strategy, candidate, event, fmt.Sprintf(format, args...))
+	}
+	if wait && candidate == "" {
+		report("notice", noCandidateProgressEvent, "service %s has no candidate to roll out", name)
+		return nil
+	}
+
+	client, err := newRunClient(ctx, strategy.Target, service.Project, service.Region)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	percent := candidateTraffic(service.Service, candidate)
+	if wait {
+		report("notice", startProgressEvent, "rolling out candidate %s of service %s from %d%% of the traffic", candidate, name, percent)
+	}
+	for {
+		if err := handleRollout(ctx, logger, service, strategy, nil); err != nil {
+			if !wait {
+				return err
+			}
+			report("warning", retryProgressEvent, "rollout of service %s failed, retrying: %v", name, err)
+		}
+		if !wait {
+			return nil
+		}
+
+		svc, err := client.Service(service.APINamespace(), name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get service %q", name)
+		}
+		namespace := service.Namespace
+		service = newServiceRecord(svc, service.Project, service.Region)
+		service.Namespace = namespace
+		switch {
+		case svc.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation] == candidate:
+			report("error", rolledBackProgressEvent, "candidate %s of service %s was rolled back: %s", candidate, name, svc.Metadata.Annotations[rollout.LastHealthReportAnnotation])
+			summary.setOutcome(service, outcome.RolledBack, "")
+			return nil
+		case svc.Metadata.Annotations[rollout.StableRevisionAnnotation] == candidate:
+			report("notice", promotedProgressEvent, "candidate %s of service %s was promoted to stable", candidate, name)
+			summary.setOutcome(service, outcome.Promoted, "")
+			return nil
+		case svc.Status.LatestReadyRevisionName != candidate:
+			return errors.Errorf("candidate %q was superseded by revision %q", candidate, svc.Status.LatestReadyRevisionName)
+		}
+		if p := candidateTraffic(svc, candidate); p != percent {
+			percent = p
+			report("notice", stepProgressEvent, "candidate %s of service %s now receives %d%% of the traffic", candidate, name, percent)
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			msg := fmt.Sprintf("candidate %s was neither promoted nor rolled back after %s", candidate, timeout)
+			report("error", timedOutProgressEvent, "%s", msg)
+			summary.setOutcome(service, outcome.TimedOut, msg)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "wait for the rollout of candidate %q interrupted", candidate)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// printWaitProgress prints the transition of the rollout of the candidate as
+// a JSON line, with the last diagnosis of the candidate, if any.
+func printWaitProgress(service *rollout.ServiceRecord, strategy config.Strategy, candidate, event, msg string) {
+	progress := waitProgress{
+		Time:      time.Now().UTC(),
+		Event:     event,
+		Project:   service.Project,
+		Region:    service.Region,
+		Service:   service.Metadata.Name,
+		Candidate: candidate,
+		Percent:   candidateTraffic(service.Service, candidate),
+		Steps:     len(strategy.Steps),
+		Message:   msg,
+	}
+	for i, step := range strategy.Steps {
+		if step == progress.Percent {
+			progress.Step = i + 1
+		}
+	}
+	var report health.Report
+	if data := service.Metadata.Annotations[rollout.LastHealthReportJSONAnnotation]; data != "" && json.Unmarshal([]byte(data), &report) == nil {
+		progress.Diagnosis = report.Status
+	}
+	data, _ := json.Marshal(progress)
+	fmt.Println(string(data))
+}
+
+// candidateTraffic returns the percentage of traffic assigned to the
+// candidate.
+func candidateTraffic(svc *run.Service, candidate string) int64 {
+	var percent int64
+	for _, target := range svc.Spec.Traffic {
+		if target.RevisionName == candidate {
+			percent += target.Percent
+		}
+	}
+	return percent
+}
+
+// githubActionsCommand prints a GitHub Actions workflow command (e.g. notice
+// or error) that creates an annotation in the workflow run.
+func githubActionsCommand(command, format string, args ...interface{}) {
+	msg := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(fmt.Sprintf(format, args...))
+	fmt.Printf("::%s::%s\n", command, msg)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// scheduler handles the rollout of each managed service on its own timer, so
+// the services are not all diagnosed at the same time and the time between
+// the rollout cycles of a service does not depend on the other services.
+//
+// The members of a release group are handled together, on the timer of the
+// group. The managed services are discovered every interval. A newly discovered
+// service is first handled after a random delay within the interval, then
+// every interval, give or take the jitter.
+type scheduler struct {
+	logger   *logrus.Logger
+	store    *configStore
+	interval time.Duration
+	jitter   float64
+
+	// slots limits the number of services handled at the same time. It is
+	// nil if there's no limit.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	services map[string]*scheduledUnit
+	random   *rand.Rand
+}
+
+// scheduledUnit is a service, or the members of a release group, handled on
+// its own timer. removed is closed when the unit is no longer managed, which
+// stops its timer: a unit that is discovered again gets a new timer.
+type scheduledUnit struct {
+	services []managedService
+	removed  chan struct{}
+}
+
+// newScheduler initializes a scheduler for the services targeted by the
+// configuration of the store. At most concurrency services are handled at
+// the same time, unless it is 0.
+func newScheduler(logger *logrus.Logger, store *configStore, interval time.Duration, jitter float64, concurrency int) *scheduler {
+	s := &scheduler{
+		logger:   logger,
+		store:    store,
+		interval: interval,
+		jitter:   jitter,
+		services: make(map[string]*scheduledUnit),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if concurrency > 0 {
+		s.slots = make(chan struct{}, concurrency)
+	}
+	return s
+}
+
+// run discovers the managed services every interval until stop is closed.
+// The context is the context of the rollouts, which is not canceled when the
+// scheduler stops so the rollouts in progress can complete.
+func (s *scheduler) run(ctx context.Context, stop <-chan struct{}) {
+	for {
+		s.discover(ctx, stop)
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// discover reads the fleet-wide pause, updates the managed services, starts
+// the timers of the new ones and stops the timers of the ones that are no
+// longer managed.
+func (s *scheduler) discover(ctx context.Context, stop <-chan struct{}) {
+	fleetPause.refresh(ctx, s.logger)
+	svcs, err := getManagedServices(ctx, s.logger, s.store.Load())
+	if err != nil {
+		s.logger.Warnf("failed to get targeted services: %v", err)
+		return
+	}
+	if flShardCount > 1 {
+		svcs = shardServices(svcs, flShardIndex, flShardCount)
+	}
+	if len(svcs) == 0 {
+		s.logger.Warn("no service matches the targets")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	services := make(map[string]*scheduledUnit, len(svcs))
+	for _, unit := range releaseGroupUnits(svcs) {
+		key := unitKey(unit[0])
+		if existing, ok := s.services[key]; ok {
+			existing.services = unit
+			services[key] = existing
+			continue
+		}
+		scheduled := &scheduledUnit{services: unit, removed: make(chan struct{})}
+		services[key] = scheduled
+		go s.schedule(ctx, stop, key, scheduled, time.Duration(s.random.Int63n(int64(s.interval))))
+	}
+	for key, scheduled := range s.services {
+		if _, ok := services[key]; !ok {
+			close(scheduled.removed)
+		}
+	}
+	s.services = services
+}
+
+// schedule handles the rollout of the service after the delay, then every
+// interval with jitter, until the service is no longer managed.
+func (s *scheduler) schedule(ctx context.Context, stop <-chan struct{}, key string, scheduled *scheduledUnit, delay time.Duration) {
+	lg := s.logger.WithField("service", key)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-scheduled.removed:
+			lg.Debug("service no longer managed")
+			return
+		case <-time.After(delay):
+		}
+
+		s.mu.Lock()
+		unit := scheduled.services
+		s.mu.Unlock()
+
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-scheduled.removed:
+				lg.Debug("service no longer managed")
+				return
+			}
+		}
+		if err := s.handle(ctx, unit); err != nil {
+			lg.Warnf("rollout failed: %v", err)
+		}
+		if s.slots != nil {
+			<-s.slots
+		}
+		delay = s.nextDelay()
+	}
+}
+
+// handle retrieves the current version of the service and handles its
+// rollout, or the rollout of the members of its release group.
+func (s *scheduler) handle(ctx context.Context, unit []managedService) error {
+	if len(unit) > 1 || releaseGroupName(unit[0]) != "" {
+		if errs := handleReleaseGroup(ctx, s.logger, unit); len(errs) != 0 {
+			return errors.New(rolloutErrsToString(errs))
+		}
+		return nil
+	}
+	svc := unit[0]
+	record, err := refreshService(ctx, svc)
+	if err != nil {
+		return err
+	}
+	return handleRolloutWithTimeout(ctx, s.logger, record, svc.strategy, nil)
+}
+
+// nextDelay returns the interval, randomly shortened or lengthened by up to
+// the jitter (a fraction of the interval).
+func (s *scheduler) nextDelay() time.Duration {
+	s.mu.Lock()
+	factor := 1 + s.jitter*(2*s.random.Float64()-1)
+	s.mu.Unlock()
+	return time.Duration(float64(s.interval) * factor)
+}
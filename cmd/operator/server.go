@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
 
-	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // makeRolloutHandler creates a request handler to perform a rollout process.
-func makeRolloutHandler(logger *logrus.Logger, cfg *config.Config) http.HandlerFunc {
+// If -trigger-secret or -slack-signing-secret is set, the requests must be
+// signed (see verifyTrigger).
+func makeRolloutHandler(logger *logrus.Logger, store *configStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		if err := verifyTrigger(req); err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("rollout trigger rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
 		ctx := req.Context()
-		// TODO(gvso): Handle all the strategies.
-		errs := runRollouts(ctx, logger, cfg.Strategies[0])
+		errs := runRollouts(ctx, logger, store.Load())
 		errsStr := rolloutErrsToString(errs)
 		if len(errs) != 0 {
 			msg := fmt.Sprintf("there were %d errors: \n%s", len(errs), errsStr)
@@ -23,3 +32,60 @@ func makeRolloutHandler(logger *logrus.Logger, cfg *config.Config) http.HandlerF
 		}
 	}
 }
+
+// verifyTrigger checks the signature of the request with the verifier of its
+// scheme, if any verifier is configured.
+func verifyTrigger(req *http.Request) error {
+	if len(triggerVerifiers) == 0 {
+		return nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return errors.Wrap(err, "could not read request")
+	}
+	for _, verifier := range triggerVerifiers {
+		if verifier.Signed(req.Header) {
+			return verifier.Verify(req.Header, body)
+		}
+	}
+	return errors.New("request is not signed")
+}
+
+// serve handles the requests at -http-addr until stop is closed. The requests
+// and the rollout cycles in progress are then given -shutdown-timeout to
+// complete.
+func serve(ctx context.Context, logger *logrus.Logger, stop <-chan struct{}) {
+	server := &http.Server{Addr: flHTTPAddr}
+	done := make(chan struct{})
+	go func() {
+		<-stop
+		deadline := time.Now().Add(flShutdownTimeout)
+		shutdownCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warnf("could not complete in-flight requests: %v", err)
+		}
+		drainCycles(logger, deadline)
+		close(done)
+	}()
+	logger.WithField("addr", flHTTPAddr).Infof("starting server")
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatal(err)
+	}
+	// ListenAndServe returns as soon as the shutdown begins.
+	<-done
+}
+
+// serveHealthAndMetrics serves the metrics of the operator on /metrics and its
+// health checks on /healthz and /readyz at the address, for the CLI mode which
+// does not handle requests otherwise.
+func serveHealthAndMetrics(logger *logrus.Logger, addr string, maxStaleness time.Duration) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", telemetryRegistry.Handler())
+	mux.HandleFunc("/healthz", makeLivenessHandler(maxStaleness))
+	mux.HandleFunc("/readyz", makeReadinessHandler(logger, newReadinessChecker()))
+	logger.WithField("addr", addr).Info("serving metrics and health checks")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Errorf("could not serve metrics and health checks: %v", err)
+	}
+}
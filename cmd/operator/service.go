@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"path"
 	"sync"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/resourcemanager"
 	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/shard"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/workpool"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
 	"github.com/pkg/errors"
@@ -13,18 +18,223 @@ import (
 	"google.golang.org/api/run/v1"
 )
 
-// getTargetedServices returned a list of service records that match the target
-// configuration.
-func getTargetedServices(ctx context.Context, logger *logrus.Logger, target config.Target) ([]*rollout.ServiceRecord, error) {
-	logger.Debug("querying Cloud Run API to get all targeted services")
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// managedService is a targeted service and the strategy that manages it.
+type managedService struct {
+	service  *rollout.ServiceRecord
+	strategy config.Strategy
+
+	// strategyName is the name of the strategy, or its position in the order
+	// of precedence if it has none.
+	strategyName string
+
+	// cached is set if the service comes from a cached list (see
+	// -service-list-ttl), so it might be outdated.
+	cached bool
+}
+
+// getManagedServices returns the services targeted by the strategies of the
+// configuration. A service targeted by several strategies is managed by the
+// one with the highest precedence.
+func getManagedServices(ctx context.Context, logger *logrus.Logger, cfg *config.Config) (_ []managedService, err error) {
+	ctx, span := startSpan(ctx, "discovery")
+	defer func() { span.End(err) }()
 
 	var (
-		retServices []*rollout.ServiceRecord
-		retError    error
+		managed []managedService
+		seen    = make(map[string]string)
+	)
+	for i, strategy := range cfg.StrategiesByPrecedence() {
+		name := strategyName(strategy, i)
+		svcs, err := getTargetedServices(ctx, logger, strategy.Target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get services targeted by strategy %q", name)
+		}
+		for _, svc := range svcs {
+			service := svc.service
+			key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+			if owner, ok := seen[key]; ok {
+				logger.WithFields(logrus.Fields{"service": key, "strategy": owner}).Debugf("service also targeted by strategy %q with lower precedence", name)
+				continue
+			}
+			seen[key] = name
+			svc.strategy, svc.strategyName = strategy, name
+			managed = append(managed, svc)
+		}
+	}
+	managed, err = strategyCanary.overlay(ctx, logger, cfg, managed)
+	if err != nil {
+		return nil, err
+	}
+	managedServices.Set(float64(len(managed)))
+	markProgress()
+	return managed, nil
+}
+
+// findManagedService returns the managed service with the name in the
+// project, region and namespace (empty for Cloud Run fully managed), or nil
+// if it is not managed.
+func findManagedService(ctx context.Context, logger *logrus.Logger, cfg *config.Config, project, region, namespace, name string) (*managedService, error) {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get targeted services")
+	}
+	for _, svc := range svcs {
+		service := svc.service
+		if service.Project == project && service.Region == region && service.Namespace == namespace && service.Metadata.Name == name {
+			return &svc, nil
+		}
+	}
+	return nil, nil
+}
+
+// currentService returns the managed service to handle the rollout of. A
+// service from a cached list is retrieved again if it has a candidate, since
+// the rollout of the others cannot change: their changes (e.g. a deployment)
+// invalidate the cached lists when the events are delivered, or are seen once
+// the lists expire.
+func currentService(ctx context.Context, svc managedService) (*rollout.ServiceRecord, error) {
+	service := svc.service
+	if !svc.cached {
+		return service, nil
+	}
+	stable := rollout.DetectStableRevisionName(service.Service)
+	if stable == "" || rollout.DetectCandidateRevisionName(service.Service, stable) == "" {
+		return service, nil
+	}
+	return refreshService(ctx, svc)
+}
+
+// refreshService retrieves the current version of the managed service, since
+// it might have changed since it was discovered.
+func refreshService(ctx context.Context, svc managedService) (*rollout.ServiceRecord, error) {
+	service := svc.service
+	client, err := newRunClient(ctx, svc.strategy.Target, service.Project, service.Region)
+	if err != nil {
+		return nil, err
+	}
+	current, err := client.Service(service.APINamespace(), service.Metadata.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get service %q", service.Metadata.Name)
+	}
+	return &rollout.ServiceRecord{Service: current, Project: service.Project, Region: service.Region, Namespace: service.Namespace}, nil
+}
+
+// shardServices returns the services in the shard with the index. The shard
+// of a service is determined by its project and name, so a service deployed
+// in several regions is managed by a single instance, or by its release
+// group, so the members of a group are managed by the same instance.
+func shardServices(svcs []managedService, index, count int) []managedService {
+	var sharded []managedService
+	for _, svc := range svcs {
+		if inShard(svc, index, count) {
+			sharded = append(sharded, svc)
+		}
+	}
+	return sharded
+}
+
+// inShard determines if the service is in the shard with the index.
+func inShard(svc managedService, index, count int) bool {
+	key := svc.service.Project + "/" + svc.service.Metadata.Name
+	if releaseGroupName(svc) != "" {
+		key = unitKey(svc)
+	}
+	return shard.Of(key, count) == index
+}
+
+// interleaveRegions orders the services so that consecutive services are in
+// different regions (and projects) as much as possible, keeping the order of
+// the services of each region.
+func interleaveRegions(svcs []managedService) []managedService {
+	regions := make([]string, len(svcs))
+	for i, svc := range svcs {
+		regions[i] = path.Join(svc.service.Project, svc.service.Region)
+	}
+	interleaved := make([]managedService, 0, len(svcs))
+	for _, i := range workpool.Interleave(regions) {
+		interleaved = append(interleaved, svcs[i])
+	}
+	return interleaved
+}
+
+// strategyName returns the name of the strategy or, if it has none, its
+// position in the order of precedence.
+func strategyName(strategy config.Strategy, i int) string {
+	if strategy.Name != "" {
+		return strategy.Name
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// getTargetedServices returns the services that match the target
+// configuration, without their strategy.
+func getTargetedServices(ctx context.Context, logger *logrus.Logger, target config.Target) ([]managedService, error) {
+	projects, err := determineProjects(ctx, logger, target)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot determine projects")
+	}
+
+	var retServices []managedService
+	for _, project := range projects {
+		projectTarget := target
+		projectTarget.Project = project
+		svcs, err := getProjectServices(ctx, logger, projectTarget)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get services in project %q", project)
+		}
+		retServices = append(retServices, svcs...)
+	}
+	return retServices, nil
+}
+
+// determineProjects gets the projects the label selector should be searched
+// at.
+//
+// If the target configuration specifies a folder or an organization instead of
+// a project, the projects under it are retrieved from the Cloud Resource
+// Manager API.
+func determineProjects(ctx context.Context, logger *logrus.Logger, target config.Target) ([]string, error) {
+	var parent string
+	switch {
+	case target.Folder != "":
+		parent = "folders/" + target.Folder
+	case target.Organization != "":
+		parent = "organizations/" + target.Organization
+	default:
+		return []string{target.Project}, nil
+	}
+
+	lg := logger.WithFields(logrus.Fields{"parent": parent, "projectFilter": target.ProjectFilter})
+	lg.Debug("retrieving projects from the Cloud Resource Manager API")
+	opts, err := clientOptions(googleCredentials, serviceAccountFor(target, ""))
+	if err != nil {
+		return nil, err
+	}
+	client, err := resourcemanager.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := client.Projects(ctx, parent, target.ProjectFilter)
+	if err != nil {
+		return nil, err
+	}
+	lg.WithField("n", len(projects)).Debug("finished retrieving projects from the API")
+	return projects, nil
+}
+
+// getProjectServices returns the services that match the target
+// configuration in the target's project, without their strategy.
+//
+// The regions are listed concurrently. A region whose services cannot be
+// listed is skipped, and recorded as such, so the services of the other
+// regions are still handled. An error is returned only if all the regions
+// fail.
+func getProjectServices(ctx context.Context, logger *logrus.Logger, target config.Target) ([]managedService, error) {
+	logger.WithField("project", target.Project).Debug("querying Cloud Run API to get all targeted services")
+
+	var (
+		retServices []managedService
 		mu          sync.Mutex
-		wg          sync.WaitGroup
 	)
 
 	regions, err := determineRegions(ctx, logger, target)
@@ -32,58 +242,121 @@ func getTargetedServices(ctx context.Context, logger *logrus.Logger, target conf
 		return nil, errors.Wrap(err, "cannot determine regions")
 	}
 
-	for _, region := range regions {
-		wg.Add(1)
+	skipped, err := workpool.Each(regions, func(region string) error {
+		svcs, cached, err := getServicesByRegionAndLabel(ctx, logger, target, region)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"project": target.Project, "region": region}).Warnf("region skipped: %v", err)
+			return err
+		}
 
-		go func(ctx context.Context, logger *logrus.Logger, region, labelSelector string) {
-			defer wg.Done()
-			svcs, err := getServicesByRegionAndLabel(ctx, logger, target.Project, region, target.LabelSelector)
-			if err != nil {
-				retError = err
-				cancel()
-				return
+		for _, svc := range svcs {
+			// The name filters apply to the name of the function
+			// backed by a service, if any.
+			name := svc.Metadata.Name
+			if function := runapi.FunctionName(svc); function != "" {
+				name = function
 			}
-
-			for _, svc := range svcs {
-				mu.Lock()
-				retServices = append(retServices, newServiceRecord(svc, target.Project, region))
-				mu.Unlock()
+			if !target.MatchesService(name) {
+				logger.WithFields(logrus.Fields{"region": region, "service": svc.Metadata.Name}).Debug("service excluded by the name filters")
+				continue
 			}
-
-		}(ctx, logger, region, target.LabelSelector)
+			record := newServiceRecord(svc, target.Project, region)
+			record.Namespace = target.Namespace
+			mu.Lock()
+			retServices = append(retServices, managedService{service: record, cached: cached})
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list services in all %d regions", len(regions))
 	}
-
-	wg.Wait()
-	return retServices, retError
+	for _, region := range skipped {
+		skippedRegions.Inc(target.Project, region)
+		if summary != nil {
+			summary.addSkippedRegion(path.Join(target.Project, region))
+		}
+	}
+	return retServices, nil
 }
 
 // getServicesByRegionAndLabel returns all the service records that match the
-// labelSelector in a specific region.
-func getServicesByRegionAndLabel(ctx context.Context, logger *logrus.Logger, project, region, labelSelector string) ([]*run.Service, error) {
+// labelSelector of the target in a specific region, from the service list
+// cache if enabled. cached is set if the services come from the cache.
+func getServicesByRegionAndLabel(ctx context.Context, logger *logrus.Logger, target config.Target, region string) (_ []*run.Service, cached bool, err error) {
 	lg := logger.WithFields(logrus.Fields{
 		"region":        region,
-		"labelSelector": labelSelector,
+		"labelSelector": target.LabelSelector,
 	})
 
+	ctx, span := startSpan(ctx, "ServicesWithLabelSelector")
+	span.SetAttribute("region", region)
+	defer func() { span.End(err) }()
+
 	lg.Debug("querying Cloud Run services")
-	runclient, err := runapi.NewAPIClient(ctx, region)
+	runclient, err := newRunClient(ctx, target, target.Project, region)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to initialize Cloud Run client")
+		return nil, false, err
+	}
+
+	namespace := target.Project
+	if target.Namespace != "" {
+		namespace = target.Namespace
+	}
+	var svcs []*run.Service
+	if serviceListCache != nil {
+		svcs, cached, err = serviceListCache.ServicesWithLabelSelector(runclient, target.Project, region, namespace, target.LabelSelector)
+	} else {
+		svcs, err = runclient.ServicesWithLabelSelector(namespace, target.LabelSelector)
 	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get services with label %q in region %q", target.LabelSelector, region)
+	}
+
+	lg.WithFields(logrus.Fields{"n": len(svcs), "cached": cached}).Debug("finished retrieving services from the API")
+	return svcs, cached, nil
+}
 
-	svcs, err := runclient.ServicesWithLabelSelector(project, labelSelector)
+// newRunClient initializes the client of the platform of the target: the
+// Cloud Run API (v1 or v2) of the region, authenticated as the identity used
+// in the project, or the Knative Serving API of the operator's cluster.
+func newRunClient(ctx context.Context, target config.Target, project, region string) (runapi.Client, error) {
+	if target.Platform == config.KubernetesPlatform {
+		client, err := sharedKubeClient(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Kubernetes client")
+		}
+		return instrumentRunClient(runapi.NewKnativeClient(ctx, client)), nil
+	}
+	opts, err := apiOptions(runAPITransport, googleCredentials, serviceAccountFor(target, project))
+	if err != nil {
+		return nil, err
+	}
+	var client runapi.Client
+	if flRunAPIVersion == "v2" {
+		client, err = runapi.NewAPIv2Client(ctx, region, opts...)
+	} else {
+		client, err = runapi.NewAPIClient(ctx, region, opts...)
+	}
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get services with label %q in region %q", labelSelector, region)
+		return nil, errors.Wrap(err, "failed to initialize Cloud Run client")
 	}
+	return instrumentRunClient(client), nil
+}
 
-	lg.WithField("n", len(svcs)).Debug("finished retrieving services from the API")
-	return svcs, nil
+// instrumentRunClient reports the calls to the client, and injects faults in
+// them if -chaos is set.
+func instrumentRunClient(client runapi.Client) runapi.Client {
+	if chaosInjector != nil {
+		client = chaosInjector.RunClient(client)
+	}
+	return runapi.Instrument(client, observeRunAPI)
 }
 
 // determineRegions gets the regions the label selector should be searched at.
 //
 // If the target configuration does not specify any regions, the entire list of
-// regions is retrieved from API.
+// regions is retrieved from API and filtered with the target's region patterns.
 func determineRegions(ctx context.Context, logger *logrus.Logger, target config.Target) ([]string, error) {
 	regions := target.Regions
 	if len(regions) != 0 {
@@ -95,11 +368,16 @@ func determineRegions(ctx context.Context, logger *logrus.Logger, target config.
 
 	lg := logrus.NewEntry(logger)
 	ctx = util.ContextWithLogger(ctx, lg)
-	regions, err := runapi.Regions(ctx, target.Project)
+	opts, err := apiOptions(runAPITransport, googleCredentials, serviceAccountFor(target, target.Project))
+	if err != nil {
+		return nil, err
+	}
+	regions, err = runapi.Regions(ctx, target.Project, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot get list of regions from Cloud Run API")
 	}
 
+	regions = target.FilterRegions(regions)
 	logger.WithField("n", len(regions)).Debug("finished retrieving regions from the API")
 	return regions, nil
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/drain"
+	"github.com/sirupsen/logrus"
+)
+
+// cycles tracks the rollout cycles in progress, so they can complete before
+// the operator exits instead of leaving a service half-updated.
+var cycles drain.Tracker
+
+// stopOnSignal returns a channel that is closed when the operator receives
+// SIGTERM (e.g. a Cloud Run instance or a pod is shut down) or SIGINT.
+func stopOnSignal(logger *logrus.Logger) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		sig := <-signals
+		logger.WithField("signal", sig.String()).Info("shutting down")
+		close(stop)
+	}()
+	return stop
+}
+
+// drainCycles waits for the rollout cycles in progress to complete, so their
+// updates, notifications, archive records and state are not lost, before
+// the operator exits.
+func drainCycles(logger *logrus.Logger, deadline time.Time) {
+	if cycles.Drain(deadline) {
+		logger.Info("in-flight rollouts completed")
+		return
+	}
+	logger.Warn("shutdown timeout reached before in-flight rollouts completed")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/format"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the status. The value(FIELD,...) format of gcloud is
+// supported as well (see writeValues).
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+	yamlOutput  = "yaml"
+)
+
+// writeValues prints the fields of the JSON output, if the output format is
+// value(FIELD,...), and determines if it is.
+func writeValues(w io.Writer, output string, v interface{}) (bool, error) {
+	fields, ok, err := format.ParseValue(output)
+	if !ok || err != nil {
+		return ok, err
+	}
+	return true, format.Values(w, v, fields)
+}
+
+// fleetStatus is the rollout state of a managed service.
+type fleetStatus struct {
+	Project          string     `json:"project" yaml:"project"`
+	Region           string     `json:"region" yaml:"region"`
+	Namespace        string     `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Service          string     `json:"service" yaml:"service"`
+	Strategy         string     `json:"strategy" yaml:"strategy"`
+	Phase            string     `json:"phase" yaml:"phase"`
+	Stable           string     `json:"stable,omitempty" yaml:"stable,omitempty"`
+	Candidate        string     `json:"candidate,omitempty" yaml:"candidate,omitempty"`
+	CandidatePercent int64      `json:"candidatePercent" yaml:"candidatePercent"`
+	LastDiagnosis    string     `json:"lastDiagnosis,omitempty" yaml:"lastDiagnosis,omitempty"`
+	LastDiagnosisAt  *time.Time `json:"lastDiagnosisAt,omitempty" yaml:"lastDiagnosisAt,omitempty"`
+	LastChange       *time.Time `json:"lastChange,omitempty" yaml:"lastChange,omitempty"`
+
+	// ReleaseGroup is the release group of the service, if any, and
+	// DependencyChain the members it depends on, in the order they are
+	// rolled out.
+	ReleaseGroup    string   `json:"releaseGroup,omitempty" yaml:"releaseGroup,omitempty"`
+	DependencyChain []string `json:"dependencyChain,omitempty" yaml:"dependencyChain,omitempty"`
+}
+
+// printStatus prints the rollout state of the targeted services in the
+// output format.
+func printStatus(ctx context.Context, logger *logrus.Logger, cfg *config.Config, output string, w io.Writer) error {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to get targeted services")
+	}
+	statuses := make([]fleetStatus, 0, len(svcs))
+	for _, svc := range svcs {
+		statuses = append(statuses, newFleetStatus(svc))
+	}
+	setReleaseGroups(logger, svcs, statuses)
+	return writeStatuses(w, output, statuses)
+}
+
+// setReleaseGroups sets the release group and the dependency chain in the
+// statuses of the members of release groups, and marks their candidates
+// waiting for their dependencies as pending.
+func setReleaseGroups(logger *logrus.Logger, svcs []managedService, statuses []fleetStatus) {
+	groups := make(map[string]*rollout.ReleaseGroup)
+	for _, unit := range releaseGroupUnits(svcs) {
+		name := releaseGroupName(unit[0])
+		if name == "" {
+			continue
+		}
+		records := make([]*rollout.ServiceRecord, len(unit))
+		for i, svc := range unit {
+			records[i] = svc.service
+		}
+		group, err := rollout.NewReleaseGroup(name, records)
+		if err != nil {
+			logger.Warnf("release group of project %q: %v", unit[0].service.Project, err)
+			continue
+		}
+		groups[unitKey(unit[0])] = group
+	}
+
+	for i, svc := range svcs {
+		statuses[i].ReleaseGroup = releaseGroupName(svc)
+		group, ok := groups[unitKey(svc)]
+		if !ok {
+			continue
+		}
+		member, _ := group.Member(path.Join(svc.service.Region, svc.service.Metadata.Name))
+		statuses[i].DependencyChain = member.Chain
+		if member.Pending && statuses[i].Phase == rollingOutPhase {
+			statuses[i].Phase = pendingPhase
+		}
+	}
+}
+
+// writeStatuses prints the rollout state of the services in the output
+// format.
+func writeStatuses(w io.Writer, output string, statuses []fleetStatus) error {
+	if ok, err := writeValues(w, output, statuses); ok {
+		return errors.Wrap(err, "failed to print status")
+	}
+	switch output {
+	case jsonOutput:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(statuses), "failed to print status")
+	case yamlOutput:
+		return errors.Wrap(yaml.NewEncoder(w).Encode(statuses), "failed to print status")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTRATEGY\tPHASE\tSTABLE\tCANDIDATE\tPERCENT\tDIAGNOSIS\tLAST CHANGE\tRELEASE GROUP")
+	for _, s := range statuses {
+		lastChange := "-"
+		if s.LastChange != nil {
+			lastChange = time.Since(*s.LastChange).Round(time.Second).String() + " ago"
+		}
+		group := orDash(s.ReleaseGroup)
+		if len(s.DependencyChain) != 0 {
+			// e.g. shop (after db > backend)
+			group += " (after " + strings.Join(s.DependencyChain, " > ") + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d%%\t%s\t%s\t%s\n", path.Join(s.Project, s.Region, s.Namespace, s.Service),
+			s.Strategy, s.Phase, orDash(s.Stable), orDash(s.Candidate), s.CandidatePercent, orDash(s.LastDiagnosis), lastChange, group)
+	}
+	return errors.Wrap(tw.Flush(), "failed to print status")
+}
+
+// newFleetStatus returns the rollout state of the service from its
+// annotations.
+func newFleetStatus(svc managedService) fleetStatus {
+	service := svc.service
+	status := serviceStatus(service)
+	result := fleetStatus{
+		Project:          status.Project,
+		Region:           status.Region,
+		Namespace:        service.Namespace,
+		Service:          status.Name,
+		Strategy:         svc.strategyName,
+		Phase:            status.Phase,
+		Stable:           status.Stable,
+		Candidate:        status.Candidate,
+		CandidatePercent: status.CandidatePercent,
+	}
+	var report health.Report
+	if data := service.Metadata.Annotations[rollout.LastHealthReportJSONAnnotation]; data != "" && json.Unmarshal([]byte(data), &report) == nil {
+		result.LastDiagnosis = report.Status
+		if !report.LastUpdate.IsZero() {
+			result.LastDiagnosisAt = &report.LastUpdate
+		}
+	}
+	if lastRollout, err := time.Parse(time.RFC3339, status.LastRollout); err == nil {
+		result.LastChange = &lastRollout
+	}
+	return result
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
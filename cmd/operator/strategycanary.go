@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/configcanary"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// strategyCanaryState is the canary of a configuration change (see
+// -config-canary): the services with labels matching the selector are managed
+// by the new configuration, and the others by the current one, until one of
+// these services completes a rollout under the new configuration. The new
+// configuration is then applied fleet-wide, so a bad strategy edit does not
+// destabilize every service at once.
+//
+// A rollout is complete when the candidate is promoted after its traffic was
+// shifted at least once under the new configuration. The canary only applies
+// to the replica that reloaded the configuration, until it restarts.
+type strategyCanaryState struct {
+	mu       sync.Mutex
+	selector string
+	store    *configStore
+	config   *config.Config
+	since    time.Time
+
+	// rolled is the progress of the canary services.
+	rolled configcanary.Progress
+}
+
+var strategyCanary strategyCanaryState
+
+// start applies the configuration to the canary services only, replacing the
+// configuration of a canary in progress. It applies the configuration
+// fleet-wide right away if no canary is configured.
+func (s *strategyCanaryState) start(logger *logrus.Logger, selector string, store *configStore, cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if selector == "" {
+		store.Store(cfg)
+		return
+	}
+	lg := logger.WithFields(logrus.Fields{"event": "strategyCanary", "selector": selector})
+	if s.config != nil {
+		lg.Warn("configuration changed during its canary, canary restarted with the new configuration")
+	}
+	s.selector, s.store, s.config, s.since, s.rolled = selector, store, cfg, time.Now(), make(configcanary.Progress)
+	strategyCanaryInProgress.Set(1)
+	lg.Info("configuration applied to the canary services, it is applied fleet-wide once one of them completes a rollout")
+}
+
+// cancel drops the configuration of the canary in progress, if any, e.g. once
+// the configuration is reverted.
+func (s *strategyCanaryState) cancel(logger *logrus.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config == nil {
+		return
+	}
+	logger.WithFields(logrus.Fields{"event": "strategyCanary", "since": s.since.Format(time.RFC3339)}).Info("configuration reverted, canary canceled")
+	s.config, s.rolled = nil, nil
+	strategyCanaryInProgress.Set(0)
+}
+
+// overlay replaces the strategy of the canary services discovered with the
+// current configuration by the one of the new configuration. The canary
+// services only targeted by the new configuration are added, and those no
+// longer targeted by it are dropped.
+func (s *strategyCanaryState) overlay(ctx context.Context, logger *logrus.Logger, cfg *config.Config, svcs []managedService) ([]managedService, error) {
+	s.mu.Lock()
+	canaryCfg, selector := s.config, s.selector
+	s.mu.Unlock()
+	if canaryCfg == nil || cfg == canaryCfg {
+		return svcs, nil
+	}
+
+	canarySvcs, err := getManagedServices(ctx, logger, canaryCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services targeted by the configuration in canary")
+	}
+	var (
+		managed  []managedService
+		canaries []string
+	)
+	for _, choice := range configcanary.Select(selector, canaryServices(svcs), canaryServices(canarySvcs)) {
+		if !choice.Canary {
+			managed = append(managed, svcs[choice.Index])
+			continue
+		}
+		svc := canarySvcs[choice.Index]
+		managed = append(managed, svc)
+		canaries = append(canaries, serviceKey(svc))
+	}
+	if len(canaries) == 0 {
+		logger.WithFields(logrus.Fields{"event": "strategyCanary", "selector": selector}).Warn("no service targeted by the configuration in canary matches -config-canary, configuration not applied fleet-wide")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config != canaryCfg {
+		return managed, nil
+	}
+	for _, key := range canaries {
+		s.rolled.Track(key)
+	}
+	return managed, nil
+}
+
+// canaryServices returns the keys and labels of the services.
+func canaryServices(svcs []managedService) []configcanary.Service {
+	services := make([]configcanary.Service, len(svcs))
+	for i, svc := range svcs {
+		services[i] = configcanary.Service{Key: serviceKey(svc), Labels: svc.service.Metadata.Labels}
+	}
+	return services
+}
+
+// record takes the decision of the rollout cycle of the service into account,
+// and applies the configuration fleet-wide if it completes the rollout of a
+// canary service.
+func (s *strategyCanaryState) record(logger *logrus.Logger, key, decision string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config == nil {
+		return
+	}
+	switch s.rolled.Record(key, decision) {
+	case configcanary.RolledBack:
+		logger.WithFields(logrus.Fields{"event": "strategyCanary", "service": key}).Warn("candidate of a canary service rolled back, configuration not applied fleet-wide")
+	case configcanary.Completed:
+		logger.WithFields(logrus.Fields{
+			"event":   "strategyCanary",
+			"service": key,
+			"since":   s.since.Format(time.RFC3339),
+		}).Info("canary service completed a rollout, configuration applied fleet-wide")
+		s.store.Store(s.config)
+		s.config, s.rolled = nil, nil
+		strategyCanaryInProgress.Set(0)
+	}
+}
+
+// serviceKey returns the key of the managed service, as used for the locks
+// and the error tracking.
+func serviceKey(svc managedService) string {
+	service := svc.service
+	return path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/outcome"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// summary collects the outcomes of the rollouts in the single-shot modes. It
+// is nil in the other modes.
+var summary *runSummary
+
+// runSummary is the machine-readable summary of a single-shot run, written
+// to the -out file.
+type runSummary struct {
+	ExitCode int              `json:"exitCode"`
+	Services []serviceOutcome `json:"services"`
+	Errors   []string         `json:"errors,omitempty"`
+
+	// SkippedRegions are the regions (PROJECT/REGION) whose services could
+	// not be listed, so their rollouts were not handled.
+	SkippedRegions []string `json:"skippedRegions,omitempty"`
+
+	mu    sync.Mutex
+	index map[string]int
+}
+
+// serviceOutcome is the outcome of the last rollout cycle of a service.
+type serviceOutcome struct {
+	Project          string `json:"project"`
+	Region           string `json:"region"`
+	Namespace        string `json:"namespace,omitempty"`
+	Service          string `json:"service"`
+	Stable           string `json:"stable,omitempty"`
+	Candidate        string `json:"candidate,omitempty"`
+	CandidatePercent int64  `json:"candidatePercent"`
+	Decision         string `json:"decision"`
+	Diagnosis        string `json:"diagnosis,omitempty"`
+	Outcome          string `json:"outcome"`
+	Error            string `json:"error,omitempty"`
+	ErrorKind        string `json:"errorKind,omitempty"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{Services: []serviceOutcome{}, index: make(map[string]int)}
+}
+
+// record sets the outcome of the service from the record of its rollout
+// cycle, replacing the outcome of its previous cycles. It does nothing for a
+// nil summary.
+func (s *runSummary) record(record archive.Record) {
+	if s == nil {
+		return
+	}
+	entry := serviceOutcome{
+		Project:          record.Project,
+		Region:           record.Region,
+		Namespace:        record.Namespace,
+		Service:          record.Service,
+		Stable:           record.Stable,
+		Candidate:        record.Candidate,
+		CandidatePercent: record.CandidatePercent,
+		Decision:         record.Decision,
+		Outcome:          outcome.Of(record),
+		Error:            record.Error,
+		ErrorKind:        record.ErrorKind,
+	}
+	if record.Report != nil {
+		entry.Diagnosis = record.Report.Status
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := path.Join(record.Project, record.Region, record.Namespace, record.Service)
+	if i, ok := s.index[key]; ok {
+		s.Services[i] = entry
+		return
+	}
+	s.index[key] = len(s.Services)
+	s.Services = append(s.Services, entry)
+}
+
+// setOutcome overrides the outcome of the service, e.g. once its candidate
+// is found rolled back.
+func (s *runSummary) setOutcome(service *rollout.ServiceRecord, outcome, errMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+	i, ok := s.index[key]
+	if !ok {
+		i = len(s.Services)
+		s.index[key] = i
+		s.Services = append(s.Services, serviceOutcome{
+			Project:   service.Project,
+			Region:    service.Region,
+			Namespace: service.Namespace,
+			Service:   service.Metadata.Name,
+		})
+	}
+	s.Services[i].Outcome, s.Services[i].Error = outcome, errMsg
+}
+
+// addError records an error of the run, e.g. the services could not be
+// listed or the rollout of a service failed.
+func (s *runSummary) addError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Errors = append(s.Errors, err.Error())
+}
+
+// addSkippedRegion records a region whose services could not be listed.
+func (s *runSummary) addSkippedRegion(region string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.SkippedRegions {
+		if r == region {
+			return
+		}
+	}
+	s.SkippedRegions = append(s.SkippedRegions, region)
+}
+
+// exitCode returns the exit code of the run: the highest exit code of the
+// outcomes and errors, or 0 if all the rollouts are successful.
+func (s *runSummary) exitCode() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	outcomes := make([]string, len(s.Services))
+	for i, service := range s.Services {
+		outcomes[i] = service.Outcome
+	}
+	return outcome.ExitCode(outcomes, len(s.Errors) != 0 || len(s.SkippedRegions) != 0)
+}
+
+// write writes the summary as JSON to the file.
+func (s *runSummary) write(filename string) error {
+	code := s.exitCode()
+	s.mu.Lock()
+	s.ExitCode = code
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode summary")
+	}
+	return errors.Wrapf(ioutil.WriteFile(filename, append(data, '\n'), 0644), "failed to write summary to %s", filename)
+}
+
+// finishSingleShot records the error of a single-shot mode, if any, writes
+// the summary to the -out file, if set, and returns the exit code of the run.
+func finishSingleShot(logger *logrus.Logger, err error) int {
+	if err != nil {
+		logger.Error(err)
+		summary.addError(err)
+	}
+	if flOut != "" {
+		if err := summary.write(flOut); err != nil {
+			logger.Error(err)
+			return outcome.ExitOperatorError
+		}
+	}
+	return summary.exitCode()
+}
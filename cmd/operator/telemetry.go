@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/telemetry"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/tracing"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+)
+
+// The metrics of the operator itself, served on /metrics in server mode.
+var (
+	telemetryRegistry = telemetry.NewRegistry()
+
+	cycleDuration = telemetryRegistry.NewHistogram("rollout_operator_cycle_duration_seconds",
+		"Duration of the rollout cycles of the services, by result (success or error).", telemetry.DefaultBuckets, "result")
+	lastCycleTime = telemetryRegistry.NewGauge("rollout_operator_last_cycle_timestamp_seconds",
+		"Unix time of the last successful rollout cycle of a service.")
+	fleetPaused = telemetryRegistry.NewGauge("rollout_operator_fleet_paused",
+		"1 while the traffic changes are paused fleet-wide, 0 otherwise.")
+	strategyCanaryInProgress = telemetryRegistry.NewGauge("rollout_operator_strategy_canary",
+		"1 while a configuration change only applies to the canary services (see -config-canary), 0 otherwise.")
+	managedServices = telemetryRegistry.NewGauge("rollout_operator_managed_services",
+		"Number of services managed by the operator, as of the last discovery.")
+	decisions = telemetryRegistry.NewCounter("rollout_operator_decisions_total",
+		"Decisions of the rollout cycles (e.g. rollForward, promotion or rollback).", "decision")
+	diagnoses = telemetryRegistry.NewCounter("rollout_operator_diagnoses_total",
+		"Diagnoses of the candidates, by result (e.g. healthy or unhealthy).", "status")
+	cycleErrors = telemetryRegistry.NewCounter("rollout_operator_errors_total",
+		"Failed rollout cycles, by kind of error (transient, conflict, permission, config or unknown).", "kind")
+	skippedServices = telemetryRegistry.NewCounter("rollout_operator_skipped_services_total",
+		"Services whose rollout was skipped because the reconcile pass exceeded -cycle-timeout.")
+	skippedRegions = telemetryRegistry.NewCounter("rollout_operator_skipped_regions_total",
+		"Regions skipped by the discovery of the services because their services could not be listed.", "project", "region")
+	apiErrors = telemetryRegistry.NewCounter("rollout_operator_api_errors_total",
+		"Failed calls to the Cloud Run (or Knative Serving) API and to the metrics providers.", "api", "method")
+	metricsQueryDuration = telemetryRegistry.NewHistogram("rollout_operator_metrics_query_duration_seconds",
+		"Duration of the queries sent to the metrics providers (e.g. Cloud Monitoring).", telemetry.DefaultBuckets, "method")
+
+	// The DORA metrics of the services, updated by the periodic DORA reports.
+	doraDeploymentFrequency = telemetryRegistry.NewGauge("rollout_operator_dora_deployments_per_day",
+		"Candidates promoted per day over -dora-window.", "project", "region", "namespace", "service")
+	doraChangeFailureRate = telemetryRegistry.NewGauge("rollout_operator_dora_change_failure_rate",
+		"Ratio of the rollouts finished over -dora-window that were rolled back.", "project", "region", "namespace", "service")
+	doraTimeToRestore = telemetryRegistry.NewGauge("rollout_operator_dora_time_to_restore_seconds",
+		"Mean time from the start of the rollouts rolled back over -dora-window to their rollback.", "project", "region", "namespace", "service")
+)
+
+// startSpan starts a span in the trace of the context, or a new trace, if
+// tracing is enabled.
+func startSpan(ctx context.Context, name string) (context.Context, *tracing.Span) {
+	if tracer != nil {
+		ctx = tracing.ContextWithTracer(ctx, tracer)
+	}
+	return tracing.Start(ctx, name)
+}
+
+// observeCycle records the duration and the result of a rollout cycle, and
+// the kind of its error, if any.
+func observeCycle(start time.Time, err error) {
+	markProgress()
+	result := "success"
+	if err != nil {
+		result = "error"
+		cycleErrors.Inc(rollout.ErrorKind(err))
+	} else {
+		lastCycleTime.Set(float64(time.Now().Unix()))
+	}
+	cycleDuration.Observe(time.Since(start).Seconds(), result)
+}
+
+// observeRunAPI records the failed calls to the Cloud Run API.
+func observeRunAPI(method string, _ time.Duration, err error) {
+	if err != nil {
+		apiErrors.Inc("run", method)
+	}
+}
+
+// observeMetricsQuery records the duration of the queries sent to the metrics
+// providers, and the failed ones.
+func observeMetricsQuery(method string, duration time.Duration, err error) {
+	metricsQueryDuration.Observe(duration.Seconds(), method)
+	if err != nil {
+		apiErrors.Inc("metrics", method)
+	}
+}
+
+// telemetryArchive counts the decisions and the diagnoses of the rollout
+// cycles, adds them to the summary of the single-shot modes and writes them as
+// custom metrics, if enabled, before archiving them in the configured archive,
+// if any.
+type telemetryArchive struct {
+	archive archive.Archive
+}
+
+// Record counts the decision and the diagnosis of the record.
+func (a telemetryArchive) Record(ctx context.Context, record archive.Record) error {
+	decisions.Inc(record.Decision)
+	if record.Report != nil {
+		diagnoses.Inc(record.Report.Status)
+	}
+	summary.record(record)
+	if customMetrics != nil {
+		if err := customMetrics.Write(ctx, record); err != nil {
+			util.LoggerFrom(ctx).Warnf("could not write custom metrics: %v", err)
+		}
+	}
+	if a.archive == nil {
+		return nil
+	}
+	return a.archive.Record(ctx, record)
+}
+
+// Locate returns the location of the record in the configured archive, or an
+// empty location if there is none.
+func (a telemetryArchive) Locate(record archive.Record) string {
+	if a.archive == nil {
+		return ""
+	}
+	return a.archive.Locate(record)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// uiHistorySize is the number of past rollouts shown for each service.
+const uiHistorySize = 5
+
+var uiTemplate = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cloud Run Release Operator</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #202124; }
+section { border: 1px solid #dadce0; border-radius: 8px; padding: 1em 1.5em; margin-bottom: 1.5em; }
+h2 { margin: 0 0 .5em; font-size: 1.2em; }
+table { border-collapse: collapse; margin: .5em 0; }
+th, td { text-align: left; padding: .2em 1em .2em 0; }
+.phase { font-size: .8em; padding: .1em .5em; border-radius: 4px; background: #e8eaed; }
+.RollingOut { background: #d2e3fc; } .RolledBack { background: #fad2cf; } .Paused { background: #feefc3; }
+.bar { display: inline-block; width: 200px; height: .8em; background: #e8eaed; vertical-align: middle; }
+.bar span { display: block; height: 100%; background: #1a73e8; }
+pre { background: #f1f3f4; padding: .5em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Cloud Run Release Operator</h1>
+{{- if .Error}}
+<p><strong>Error:</strong> {{.Error}}</p>
+{{- end}}
+{{- range .Services}}
+<section>
+<h2>{{.Project}}/{{.Region}}/{{if .Namespace}}{{.Namespace}}/{{end}}{{.Name}} <span class="phase {{.Phase}}">{{.Phase}}</span></h2>
+<p><strong>Strategy:</strong> {{.Strategy}}
+{{- if .Stable}} &middot; <strong>Stable:</strong> <code>{{.Stable}}</code>{{end}}
+{{- if .Candidate}} &middot; <strong>Candidate:</strong> <code>{{.Candidate}}</code>{{end}}
+{{- if .LastRollout}} &middot; <strong>Last rollout:</strong> {{.LastRollout}}{{end}}</p>
+<table>
+<tr><th>Revision</th><th>Tag</th><th>Traffic</th><th></th></tr>
+{{- range .Traffic}}
+<tr><td><code>{{.Revision}}</code></td><td>{{.Tag}}</td><td><span class="bar"><span style="width: {{.Percent}}%"></span></span></td><td>{{.Percent}}%</td></tr>
+{{- end}}
+</table>
+{{- if .Report}}
+<h3>Latest health report</h3>
+{{.Report}}
+{{- else if .TextReport}}
+<h3>Latest health report</h3>
+<pre>{{.TextReport}}</pre>
+{{- end}}
+{{- if .History}}
+<h3>Recent rollouts</h3>
+<table>
+<tr><th>Candidate</th><th>Start</th><th>End</th><th>Outcome</th><th>Steps</th></tr>
+{{- range .History}}
+<tr><td><code>{{.Candidate}}</code></td><td>{{.Start.Format "2006-01-02 15:04"}}</td><td>{{if .End}}{{.End.Format "2006-01-02 15:04"}}{{end}}</td><td>{{if .Outcome}}{{.Outcome}}{{else}}inProgress{{end}}</td><td>{{range $i, $step := .Steps}}{{if $i}} &rarr; {{end}}{{$step.Percent}}%{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</section>
+{{- else}}
+<p>No service is managed by the operator.</p>
+{{- end}}
+<p><em>Generated at {{.Time}}</em></p>
+</body>
+</html>
+`))
+
+// uiService is a managed service as shown in the web UI.
+type uiService struct {
+	kube.ServiceStatus
+	Namespace string
+	Strategy  string
+	Traffic   []uiTraffic
+
+	// Report is the last health report of the candidate rendered in HTML, or
+	// TextReport the report as set in the annotation if it has no data.
+	Report     template.HTML
+	TextReport string
+
+	History []state.Rollout
+}
+
+// uiTraffic is a traffic target of a service.
+type uiTraffic struct {
+	Revision string
+	Tag      string
+	Percent  int64
+}
+
+// makeUIHandler creates a request handler that renders a read-only web page
+// with the rollout state of the managed services.
+func makeUIHandler(logger *logrus.Logger, store *configStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		principal, err := authenticateAdmin(req.Context(), req.Header.Get("Authorization"))
+		if err != nil {
+			logger.WithField("path", req.URL.Path).Warnf("UI request rejected: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		data := struct {
+			Services []uiService
+			Error    string
+			Time     string
+		}{Time: time.Now().Format(time.RFC3339)}
+
+		ctx := req.Context()
+		svcs, err := getManagedServices(ctx, logger, store.Load())
+		if err != nil {
+			logger.Warn(err)
+			data.Error = err.Error()
+		}
+		for _, svc := range svcs {
+			service := svc.service
+			if !adminAllowed(principal, viewAction, service.Project, service.Region, service.Metadata.Name) {
+				continue
+			}
+			data.Services = append(data.Services, newUIService(ctx, logger, svc))
+		}
+
+		var buf bytes.Buffer
+		if err := uiTemplate.Execute(&buf, data); err != nil {
+			logger.Warn(errors.Wrap(err, "failed to render UI"))
+			http.Error(w, "failed to render page", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+// newUIService returns the state of the service shown in the web UI.
+func newUIService(ctx context.Context, logger *logrus.Logger, svc managedService) uiService {
+	service := svc.service
+	annotations := service.Metadata.Annotations
+	result := uiService{
+		ServiceStatus: serviceStatus(service),
+		Namespace:     service.Namespace,
+		Strategy:      svc.strategyName,
+	}
+
+	traffic := service.Spec.Traffic
+	if service.Status != nil && len(service.Status.Traffic) != 0 {
+		traffic = service.Status.Traffic
+	}
+	for _, target := range traffic {
+		if target.Percent == 0 {
+			continue
+		}
+		revision := target.RevisionName
+		if revision == "" {
+			revision = service.Status.LatestReadyRevisionName
+		}
+		result.Traffic = append(result.Traffic, uiTraffic{Revision: revision, Tag: target.Tag, Percent: target.Percent})
+	}
+
+	var report health.Report
+	if data := annotations[rollout.LastHealthReportJSONAnnotation]; data != "" && json.Unmarshal([]byte(data), &report) == nil {
+		rendered, err := health.RenderReport(config.HTMLReportFormat, report, svc.strategy.Steps)
+		if err == nil {
+			result.Report = template.HTML(rendered)
+		}
+	}
+	if result.Report == "" {
+		result.TextReport = annotations[rollout.LastHealthReportAnnotation]
+	}
+
+	if stateStore != nil {
+		key := path.Join(service.Project, service.Region, service.Namespace, service.Metadata.Name)
+		rollouts, err := serviceHistory(ctx, key)
+		if err != nil {
+			logger.Warn(err)
+		}
+		if len(rollouts) > uiHistorySize {
+			rollouts = rollouts[len(rollouts)-uiHistorySize:]
+		}
+		// Most recent first.
+		for j := len(rollouts) - 1; j >= 0; j-- {
+			result.History = append(result.History, rollouts[j])
+		}
+	}
+	return result
+}
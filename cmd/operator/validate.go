@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/resourcemanager"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/serviceusage"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// validateSetup checks that the operator can manage the services targeted by
+// the configuration, which was already parsed and validated (see
+// checkAccess). It prints the problems found, including the suspicious
+// settings of the configuration (lint warnings), and fails if there is any.
+func validateSetup(ctx context.Context, logger *logrus.Logger, cfg *config.Config, warnings []error, w io.Writer) error {
+	var problems int
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "warning: %v\n", warning)
+		problems++
+	}
+	for _, problem := range checkAccess(ctx, logger, cfg) {
+		fmt.Fprintf(w, "error: %s\n", problem.message)
+		problems++
+	}
+
+	if problems != 0 {
+		return errors.Errorf("found %d problems", problems)
+	}
+	fmt.Fprintln(w, "configuration is valid")
+	return nil
+}
+
+// accessProblem is a problem found by checkAccess.
+type accessProblem struct {
+	message string
+
+	// checkFailed is set if the access could not be checked (e.g. the
+	// Service Usage API is not enabled), as opposed to found missing.
+	checkFailed bool
+}
+
+// checkAccess checks that the APIs the operator uses are enabled and that it
+// has the permissions it needs in every project targeted by the
+// configuration, as the service account impersonated in the project, if any.
+func checkAccess(ctx context.Context, logger *logrus.Logger, cfg *config.Config) []accessProblem {
+	var problems []accessProblem
+	checked := make(map[string]bool)
+	for i, strategy := range cfg.StrategiesByPrecedence() {
+		name := strategyName(strategy, i)
+		projects, err := determineProjects(ctx, logger, strategy.Target)
+		if err != nil {
+			problems = append(problems, accessProblem{message: fmt.Sprintf("strategy %s: %v", name, err), checkFailed: true})
+			continue
+		}
+		apis, permissions := requiredAccess(strategy)
+		for _, project := range projects {
+			// Strategies targeting the same project usually need the same
+			// access, which is only reported once.
+			account := serviceAccountFor(strategy.Target, project)
+			key := project + "/" + account + "/" + strings.Join(permissions, ",")
+			if checked[key] {
+				continue
+			}
+			checked[key] = true
+			problems = append(problems, checkProjectAccess(ctx, project, account, apis, permissions)...)
+		}
+	}
+	return problems
+}
+
+// checkProjectAccess checks that the APIs are enabled in the project and
+// that the identity has the permissions in it.
+func checkProjectAccess(ctx context.Context, project, serviceAccount string, apis, permissions []string) []accessProblem {
+	// The access is checked for the identity that manages the services,
+	// which can be an impersonated service account.
+	opts, err := clientOptions(googleCredentials, serviceAccount)
+	if err != nil {
+		return []accessProblem{{message: fmt.Sprintf("project %s: %v", project, err), checkFailed: true}}
+	}
+	crm, err := resourcemanager.NewClient(ctx, opts...)
+	if err != nil {
+		return []accessProblem{{message: fmt.Sprintf("project %s: %v", project, err), checkFailed: true}}
+	}
+	usage, err := serviceusage.NewClient(ctx, opts...)
+	if err != nil {
+		return []accessProblem{{message: fmt.Sprintf("project %s: %v", project, err), checkFailed: true}}
+	}
+
+	var problems []accessProblem
+	disabled, err := usage.DisabledAPIs(ctx, project, apis)
+	if err != nil {
+		problems = append(problems, accessProblem{message: fmt.Sprintf("project %s: %v", project, err), checkFailed: true})
+	} else if len(disabled) != 0 {
+		problems = append(problems, accessProblem{message: fmt.Sprintf("project %s: APIs not enabled: %s", project, strings.Join(disabled, ", "))})
+	}
+
+	missing, err := crm.MissingPermissions(ctx, project, permissions)
+	if err != nil {
+		problems = append(problems, accessProblem{message: fmt.Sprintf("project %s: %v", project, err), checkFailed: true})
+	} else if len(missing) != 0 {
+		problems = append(problems, accessProblem{message: fmt.Sprintf("project %s: missing permissions: %s", project, strings.Join(missing, ", "))})
+	}
+	return problems
+}
+
+// preflightCheck checks the access of the operator before it starts managing
+// the services (see checkAccess), so a missing permission or a disabled API
+// fails the startup instead of the rollouts. The problems that could not be
+// checked only cause warnings.
+func preflightCheck(ctx context.Context, logger *logrus.Logger, cfg *config.Config) error {
+	logger.Debug("checking permissions and APIs of the targeted projects")
+	var report []string
+	for _, problem := range checkAccess(ctx, logger, cfg) {
+		if problem.checkFailed {
+			logger.Warnf("preflight check skipped: %s", problem.message)
+			continue
+		}
+		report = append(report, problem.message)
+	}
+	if len(report) != 0 {
+		return errors.Errorf("preflight check failed, fix the access of the operator or use -preflight=false:\n  %s", strings.Join(report, "\n  "))
+	}
+	return nil
+}
+
+// requiredAccess returns the APIs that must be enabled, and the permissions
+// the operator needs, in the projects targeted by the strategy.
+func requiredAccess(strategy config.Strategy) (apis, permissions []string) {
+	if strategy.Target.Platform != config.KubernetesPlatform {
+		apis = append(apis, "run.googleapis.com")
+		permissions = append(permissions, "run.services.list", "run.services.get", "run.services.update")
+		if len(strategy.Target.Regions) == 0 {
+			permissions = append(permissions, "run.locations.list")
+		}
+	}
+	if usesCloudMonitoring() {
+		apis = append(apis, "monitoring.googleapis.com")
+		permissions = append(permissions, "monitoring.timeSeries.list")
+	}
+	for _, criterion := range strategy.HealthCriteria {
+		if criterion.Metric == config.TraceErrorRateMetricsCheck || criterion.Metric == config.TraceLatencyMetricsCheck {
+			apis = append(apis, "cloudtrace.googleapis.com")
+			permissions = append(permissions, "cloudtrace.traces.list")
+			break
+		}
+	}
+	return apis, permissions
+}
+
+// usesCloudMonitoring determines if the metrics come from Cloud Monitoring,
+// as opposed to another metrics provider (see chooseMetricsProvider).
+func usesCloudMonitoring() bool {
+	return flMetricsPluginAddr == "" && flMetricsPluginBinary == "" && flGoogleSheetsID == "" && flPrometheusURL == "" &&
+		flJSONRequestCountURL == "" && flJSONErrorRateURL == "" && flJSONLatencyURL == ""
+}
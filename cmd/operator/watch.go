@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// statusChange is a change of the rollout state of a managed service.
+type statusChange struct {
+	Time        time.Time `json:"time" yaml:"time"`
+	fleetStatus `yaml:",inline"`
+	Changes     []string `json:"changes" yaml:"changes"`
+}
+
+// watchStatus prints the rollout state of the targeted services, then the
+// changes of their state (e.g. traffic steps and diagnoses) every interval,
+// until the context is done.
+func watchStatus(ctx context.Context, logger *logrus.Logger, cfg *config.Config, output string, interval time.Duration, w io.Writer) error {
+	var previous map[string]fleetStatus
+	for {
+		current, err := fleetStatuses(ctx, logger, cfg)
+		switch {
+		case err != nil:
+			// The services are retrieved again in the next interval.
+			logger.Warnf("failed to get targeted services: %v", err)
+		case previous == nil && output == tableOutput:
+			// The initial state is printed as a table, like -status.
+			if err := writeStatuses(w, output, sortedStatuses(current)); err != nil {
+				return err
+			}
+			previous = current
+		default:
+			for _, change := range statusChanges(previous, current, time.Now()) {
+				if err := printStatusChange(w, output, change); err != nil {
+					return err
+				}
+			}
+			previous = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fleetStatuses returns the rollout state of the targeted services by their
+// key.
+func fleetStatuses(ctx context.Context, logger *logrus.Logger, cfg *config.Config) (map[string]fleetStatus, error) {
+	svcs, err := getManagedServices(ctx, logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]fleetStatus, 0, len(svcs))
+	for _, svc := range svcs {
+		list = append(list, newFleetStatus(svc))
+	}
+	setReleaseGroups(logger, svcs, list)
+	statuses := make(map[string]fleetStatus, len(svcs))
+	for _, status := range list {
+		statuses[path.Join(status.Project, status.Region, status.Namespace, status.Service)] = status
+	}
+	return statuses, nil
+}
+
+// sortedStatuses returns the rollout states sorted by service.
+func sortedStatuses(statuses map[string]fleetStatus) []fleetStatus {
+	var keys []string
+	for key := range statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]fleetStatus, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, statuses[key])
+	}
+	return result
+}
+
+// statusChanges compares the rollout state of the services to their previous
+// state and returns the changes, sorted by service.
+func statusChanges(previous, current map[string]fleetStatus, now time.Time) []statusChange {
+	var keys []string
+	for key := range current {
+		keys = append(keys, key)
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []statusChange
+	for _, key := range keys {
+		before, managed := previous[key]
+		after, ok := current[key]
+		if !ok {
+			changes = append(changes, statusChange{Time: now, fleetStatus: before, Changes: []string{"no longer managed"}})
+			continue
+		}
+		if !managed {
+			changes = append(changes, statusChange{Time: now, fleetStatus: after, Changes: []string{fmt.Sprintf("managed by strategy %s, %s", after.Strategy, after.Phase)}})
+			continue
+		}
+		if diff := diffStatus(before, after); len(diff) != 0 {
+			changes = append(changes, statusChange{Time: now, fleetStatus: after, Changes: diff})
+		}
+	}
+	return changes
+}
+
+// diffStatus describes the differences between two states of a service.
+func diffStatus(before, after fleetStatus) []string {
+	var diff []string
+	if after.Candidate != before.Candidate && after.Candidate != "" {
+		diff = append(diff, fmt.Sprintf("new candidate %s", after.Candidate))
+	}
+	if after.Stable != before.Stable {
+		diff = append(diff, fmt.Sprintf("stable %s -> %s", orDash(before.Stable), orDash(after.Stable)))
+	}
+	if after.Phase != before.Phase {
+		diff = append(diff, fmt.Sprintf("phase %s -> %s", before.Phase, after.Phase))
+	}
+	if after.CandidatePercent != before.CandidatePercent {
+		diff = append(diff, fmt.Sprintf("candidate traffic %d%% -> %d%%", before.CandidatePercent, after.CandidatePercent))
+	}
+	if after.LastDiagnosisAt != nil && (before.LastDiagnosisAt == nil || !after.LastDiagnosisAt.Equal(*before.LastDiagnosisAt)) {
+		diff = append(diff, fmt.Sprintf("diagnosed %s", orDash(after.LastDiagnosis)))
+	}
+	if after.Strategy != before.Strategy {
+		diff = append(diff, fmt.Sprintf("strategy %s -> %s", before.Strategy, after.Strategy))
+	}
+	return diff
+}
+
+// printStatusChange prints a change in the output format: a line of text for
+// the table output, a line of values for value(FIELD,...), or a JSON or YAML
+// document.
+func printStatusChange(w io.Writer, output string, change statusChange) error {
+	if ok, err := writeValues(w, output, change); ok {
+		return errors.Wrap(err, "failed to print status change")
+	}
+	var err error
+	switch output {
+	case jsonOutput:
+		err = json.NewEncoder(w).Encode(change)
+	case yamlOutput:
+		fmt.Fprintln(w, "---")
+		err = yaml.NewEncoder(w).Encode(change)
+	default:
+		_, err = fmt.Fprintf(w, "%s  %s  %s\n", change.Time.Format("15:04:05"),
+			path.Join(change.Project, change.Region, change.Namespace, change.Service), strings.Join(change.Changes, ", "))
+	}
+	return errors.Wrap(err, "failed to print status change")
+}
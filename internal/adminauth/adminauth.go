@@ -0,0 +1,49 @@
+// Package adminauth authenticates the callers of the admin API with Google ID
+// tokens and authorizes their actions on the managed services.
+package adminauth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+)
+
+// googleIssuers are the issuers of the Google ID tokens.
+var googleIssuers = map[string]bool{"accounts.google.com": true, "https://accounts.google.com": true}
+
+// Verifier verifies the Google ID tokens of the callers of the admin API.
+type Verifier struct {
+	validator *idtoken.Validator
+	audience  string
+}
+
+// NewVerifier initializes a verifier of the ID tokens issued for the
+// audience, e.g. the URL of the operator.
+func NewVerifier(ctx context.Context, audience string, opts ...option.ClientOption) (*Verifier, error) {
+	validator, err := idtoken.NewValidator(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize ID token validator")
+	}
+	return &Verifier{validator: validator, audience: audience}, nil
+}
+
+// Verify checks the signature, expiration, issuer and audience of the ID
+// token and returns the verified email of its principal (a user or a service
+// account).
+func (v *Verifier) Verify(ctx context.Context, token string) (string, error) {
+	payload, err := v.validator.Validate(ctx, token, v.audience)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid ID token")
+	}
+	if !googleIssuers[payload.Issuer] {
+		return "", errors.Errorf("invalid ID token issuer %q", payload.Issuer)
+	}
+	email, _ := payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); email == "" || !verified {
+		return "", errors.New("ID token has no verified email")
+	}
+	return strings.ToLower(email), nil
+}
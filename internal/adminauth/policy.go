@@ -0,0 +1,115 @@
+package adminauth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// AnyAction matches all the actions in a rule.
+const AnyAction = "*"
+
+// Policy is the authorization map of the admin API: which principals may
+// perform which actions on which services. An action is allowed if any rule
+// allows it.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule allows the principals to perform the actions on the services.
+type Rule struct {
+	// Principals are the emails of the users and service accounts, or
+	// patterns of emails (e.g. *@example.com).
+	Principals []string `yaml:"principals"`
+
+	// Actions are the names of the actions (e.g. pause), or AnyAction.
+	Actions []string `yaml:"actions"`
+
+	// Services are the services as PROJECT/REGION/SERVICE, each part being a
+	// pattern (e.g. myproject/*/checkout). Empty means all the services.
+	Services []string `yaml:"services"`
+}
+
+// ParsePolicy parses the YAML authorization policy and checks that its
+// actions are among the known actions.
+func ParsePolicy(data []byte, actions []string) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse authorization policy")
+	}
+	if len(policy.Rules) == 0 {
+		return nil, errors.New("authorization policy must have at least one rule")
+	}
+
+	known := map[string]bool{AnyAction: true}
+	for _, action := range actions {
+		known[action] = true
+	}
+	for i, rule := range policy.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if len(rule.Principals) == 0 {
+			return nil, errors.Errorf("%s.principals: at least one principal must be specified", field)
+		}
+		for j, principal := range rule.Principals {
+			if _, err := path.Match(strings.ToLower(principal), ""); err != nil {
+				return nil, errors.Errorf("%s.principals[%d]: invalid pattern %q", field, j, principal)
+			}
+		}
+		if len(rule.Actions) == 0 {
+			return nil, errors.Errorf("%s.actions: at least one action must be specified", field)
+		}
+		for j, action := range rule.Actions {
+			if !known[action] {
+				return nil, errors.Errorf("%s.actions[%d]: invalid action %q, must be one of %s or %s", field, j, action, strings.Join(actions, ", "), AnyAction)
+			}
+		}
+		for j, service := range rule.Services {
+			if _, err := path.Match(service, ""); err != nil || strings.Count(service, "/") != 2 {
+				return nil, errors.Errorf("%s.services[%d]: service must be a PROJECT/REGION/SERVICE pattern, got %q", field, j, service)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Allows determines if the principal may perform the action on the service,
+// identified as PROJECT/REGION/SERVICE.
+func (p *Policy) Allows(principal, action, service string) bool {
+	for _, rule := range p.Rules {
+		if rule.allows(principal, action, service) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) allows(principal, action, service string) bool {
+	if !matchesAny(r.Principals, strings.ToLower(principal), true) {
+		return false
+	}
+	var actionOK bool
+	for _, a := range r.Actions {
+		if a == AnyAction || a == action {
+			actionOK = true
+			break
+		}
+	}
+	return actionOK && (len(r.Services) == 0 || matchesAny(r.Services, service, false))
+}
+
+// matchesAny determines if the value matches any of the patterns, which are
+// validated, so the matching error is ignored.
+func matchesAny(patterns []string, value string, lower bool) bool {
+	for _, pattern := range patterns {
+		if lower {
+			pattern = strings.ToLower(pattern)
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
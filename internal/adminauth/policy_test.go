@@ -0,0 +1,107 @@
+package adminauth_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/adminauth"
+	"github.com/stretchr/testify/assert"
+)
+
+var actions = []string{"view", "pause", "resume", "promote", "abort", "rollback"}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		shouldErr bool
+	}{
+		{
+			name: "valid policy",
+			data: `
+rules:
+- principals: ["*@example.com"]
+  actions: [view]
+- principals: [jane@example.com, deployer@myproject.iam.gserviceaccount.com]
+  actions: ["*"]
+  services: [myproject/*/checkout]
+`,
+		},
+		{
+			name:      "no rules",
+			data:      "rules: []",
+			shouldErr: true,
+		},
+		{
+			name:      "no principals",
+			data:      "rules: [{actions: [pause]}]",
+			shouldErr: true,
+		},
+		{
+			name:      "no actions",
+			data:      "rules: [{principals: [jane@example.com]}]",
+			shouldErr: true,
+		},
+		{
+			name:      "unknown action",
+			data:      "rules: [{principals: [jane@example.com], actions: [delete]}]",
+			shouldErr: true,
+		},
+		{
+			name:      "service without region",
+			data:      "rules: [{principals: [jane@example.com], actions: [pause], services: [myproject/checkout]}]",
+			shouldErr: true,
+		},
+		{
+			name:      "invalid pattern",
+			data:      "rules: [{principals: [\"[jane@example.com\"], actions: [pause]}]",
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			_, err := adminauth.ParsePolicy([]byte(test.data), actions)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	policy, err := adminauth.ParsePolicy([]byte(`
+rules:
+- principals: ["*@example.com"]
+  actions: [view]
+- principals: [Jane@example.com]
+  actions: [pause, resume, promote]
+  services: [myproject/*/checkout]
+- principals: [oncall@myproject.iam.gserviceaccount.com]
+  actions: ["*"]
+`), actions)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tests := []struct {
+		principal string
+		action    string
+		service   string
+		expected  bool
+	}{
+		{"john@example.com", "view", "myproject/us-east1/checkout", true},
+		{"john@example.com", "pause", "myproject/us-east1/checkout", false},
+		{"john@example.org", "view", "myproject/us-east1/checkout", false},
+		{"jane@example.com", "promote", "myproject/us-east1/checkout", true},
+		{"jane@example.com", "promote", "myproject/us-east1/cart", false},
+		{"jane@example.com", "promote", "otherproject/us-east1/checkout", false},
+		{"jane@example.com", "abort", "myproject/us-east1/checkout", false},
+		{"oncall@myproject.iam.gserviceaccount.com", "rollback", "otherproject/europe-west1/cart", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, policy.Allows(test.principal, test.action, test.service), "%s %s %s", test.principal, test.action, test.service)
+	}
+}
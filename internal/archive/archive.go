@@ -0,0 +1,127 @@
+// Package archive keeps the decision and the health report of every rollout
+// cycle, for long-term release forensics beyond the last health report set in
+// the annotations of the services.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+)
+
+// Decisions of a rollout cycle.
+const (
+	NoCandidateDecision = "noCandidate"
+	UnchangedDecision   = "unchanged"
+	RollForwardDecision = "rollForward"
+	PromotionDecision   = "promotion"
+	RollbackDecision    = "rollback"
+	PausedDecision      = "paused"
+	DeniedDecision      = "denied"
+	ErrorDecision       = "error"
+)
+
+// timeFormat is the format of the time in the object names, with a fixed
+// width so the objects are sorted by time.
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Archive represents a store of the records of the rollout cycles.
+type Archive interface {
+	Record(ctx context.Context, record Record) error
+
+	// Locate returns where the record is, or will be, archived, so it can be
+	// referred to before it is written (e.g. from a truncated health report).
+	Locate(record Record) string
+}
+
+// Record is the outcome of a rollout cycle of a service.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Project   string    `json:"project"`
+	Region    string    `json:"region"`
+	Namespace string    `json:"namespace,omitempty"`
+	Service   string    `json:"service"`
+
+	Stable           string `json:"stable,omitempty"`
+	Candidate        string `json:"candidate,omitempty"`
+	CandidatePercent int64  `json:"candidatePercent"`
+	Decision         string `json:"decision"`
+
+	// Report is the health report of the candidate and RenderedReport the
+	// report set in the annotation of the service, if the candidate was
+	// diagnosed.
+	Report         *health.Report `json:"report,omitempty"`
+	RenderedReport string         `json:"renderedReport,omitempty"`
+
+	// Samples are the raw metrics values and queries of the diagnosis, if
+	// they are recorded (see config.Strategy.RecordSamples).
+	Samples json.RawMessage `json:"samples,omitempty"`
+
+	// Denial is the reason the policy denied the change of the traffic, if
+	// it did.
+	Denial string `json:"denial,omitempty"`
+
+	// Error is the error of the cycle, if any, and ErrorKind its kind (e.g.
+	// transient or config, see rollout.ErrorKind).
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"errorKind,omitempty"`
+}
+
+// GCS archives the records as objects of a Cloud Storage bucket, named
+// [PREFIX/]PROJECT/SERVICE/TIME.json. Lifecycle rules of the bucket can be
+// used to delete or change the storage class of older records.
+type GCS struct {
+	service *storage.Service
+	bucket  string
+	prefix  string
+}
+
+// NewGCS initializes an archive in the bucket (gs://BUCKET[/PREFIX]).
+func NewGCS(ctx context.Context, location string, opts ...option.ClientOption) (*GCS, error) {
+	if !strings.HasPrefix(location, "gs://") {
+		return nil, errors.Errorf("location must have the form gs://BUCKET[/PREFIX], got %q", location)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(location, "gs://"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.Errorf("location must have the form gs://BUCKET[/PREFIX], got %q", location)
+	}
+	var prefix string
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+	service, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Storage client")
+	}
+	return &GCS{service: service, bucket: parts[0], prefix: prefix}, nil
+}
+
+// Record writes the record as a new object.
+func (g *GCS) Record(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal record")
+	}
+	name := g.objectName(record)
+	object := &storage.Object{Name: name, ContentType: "application/json"}
+	_, err = g.service.Objects.Insert(g.bucket, object).Media(bytes.NewReader(data)).Context(ctx).Do()
+	return errors.Wrapf(err, "failed to write gs://%s/%s", g.bucket, name)
+}
+
+// Locate returns the gs:// URL of the object of the record.
+func (g *GCS) Locate(record Record) string {
+	return "gs://" + g.bucket + "/" + g.objectName(record)
+}
+
+// objectName returns the name of the object of the record.
+func (g *GCS) objectName(record Record) string {
+	return path.Join(g.prefix, record.Project, record.Service, record.Time.UTC().Format(timeFormat)+".json")
+}
@@ -0,0 +1,69 @@
+package archive_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestGCS(t *testing.T) {
+	var (
+		metadata struct{ Name string }
+		record   archive.Record
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upload/storage/v1/b/mybucket/o" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		assert.Nil(t, err)
+		parts := multipart.NewReader(r.Body, params["boundary"])
+		part, err := parts.NextPart()
+		assert.Nil(t, err)
+		assert.Nil(t, json.NewDecoder(part).Decode(&metadata))
+		part, err = parts.NextPart()
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadAll(part)
+		assert.Nil(t, json.Unmarshal(data, &record))
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	gcs, err := archive.NewGCS(ctx, "gs://mybucket/rollouts/", option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	expected := archive.Record{
+		Time:             time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 40,
+		Decision:         archive.RollForwardDecision,
+		Report:           &health.Report{Status: "healthy", Checks: []health.CheckReport{}},
+		RenderedReport:   "status: healthy",
+	}
+	assert.Nil(t, gcs.Record(ctx, expected))
+	assert.Equal(t, "rollouts/myproject/mysvc/2020-06-01T12:00:00.000000000Z.json", metadata.Name)
+	assert.Equal(t, expected, record)
+	assert.Equal(t, "gs://mybucket/rollouts/myproject/mysvc/2020-06-01T12:00:00.000000000Z.json", gcs.Locate(expected))
+
+	for _, location := range []string{"mybucket", "gs://", "gs:///prefix"} {
+		_, err := archive.NewGCS(ctx, location)
+		assert.NotNil(t, err, location)
+	}
+}
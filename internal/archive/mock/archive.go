@@ -0,0 +1,34 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+)
+
+// Archive is a mock implementation of archive.Archive that records the
+// records.
+type Archive struct {
+	RecordFn func(ctx context.Context, record archive.Record) error
+	Records  []archive.Record
+
+	LocateFn func(record archive.Record) string
+}
+
+// Record records the record and invokes the mock implementation, if any.
+func (a *Archive) Record(ctx context.Context, record archive.Record) error {
+	a.Records = append(a.Records, record)
+	if a.RecordFn == nil {
+		return nil
+	}
+	return a.RecordFn(ctx, record)
+}
+
+// Locate invokes the mock implementation, if any, or returns an empty
+// location.
+func (a *Archive) Locate(record archive.Record) string {
+	if a.LocateFn == nil {
+		return ""
+	}
+	return a.LocateFn(record)
+}
@@ -0,0 +1,112 @@
+// Package attestation verifies that the container images of the candidates
+// were attested by the Binary Authorization attestors, before they receive
+// any traffic.
+package attestation
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	binaryauthorization "google.golang.org/api/binaryauthorization/v1"
+	containeranalysis "google.golang.org/api/containeranalysis/v1beta1"
+	"google.golang.org/api/option"
+)
+
+// Verifier represents a client that checks the attestations of images.
+type Verifier interface {
+	// Missing returns the attestors, among the ones passed (in the form
+	// projects/PROJECT/attestors/ATTESTOR), that did not attest the image.
+	// The image must be pinned to its digest, e.g.
+	// us-docker.pkg.dev/myproject/myrepo/app@sha256:...
+	Missing(ctx context.Context, image string, attestors []string) ([]string, error)
+}
+
+// attestationKind is the kind of the occurrences of the attestations.
+const attestationKind = "ATTESTATION"
+
+// BinaryAuthorization looks up the attestations of the images in Container
+// Analysis, under the notes of the Binary Authorization attestors.
+//
+// Like the enforcement of Binary Authorization at deployment, an image is
+// attested if there is an attestation occurrence for it under the note of the
+// attestor. The signatures of the attestations are not verified again.
+type BinaryAuthorization struct {
+	attestors   *binaryauthorization.Service
+	occurrences *containeranalysis.Service
+
+	// notes caches the notes of the attestors, which rarely change.
+	mu    sync.Mutex
+	notes map[string]string
+}
+
+// NewBinaryAuthorization initializes a client for the Binary Authorization
+// and Container Analysis APIs.
+func NewBinaryAuthorization(ctx context.Context, opts ...option.ClientOption) (*BinaryAuthorization, error) {
+	attestors, err := binaryauthorization.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Binary Authorization API")
+	}
+	occurrences, err := containeranalysis.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Container Analysis API")
+	}
+	return &BinaryAuthorization{attestors: attestors, occurrences: occurrences, notes: make(map[string]string)}, nil
+}
+
+// Missing implements Verifier.
+func (b *BinaryAuthorization) Missing(ctx context.Context, image string, attestors []string) ([]string, error) {
+	// Container Analysis identifies the images by their URL.
+	resourceURL := "https://" + image
+
+	var missing []string
+	for _, attestor := range attestors {
+		note, err := b.note(ctx, attestor)
+		if err != nil {
+			return nil, err
+		}
+
+		attested := false
+		call := b.occurrences.Projects.Notes.Occurrences.List(note).Filter(`resourceUrl="` + resourceURL + `"`)
+		err = call.Pages(ctx, func(resp *containeranalysis.ListNoteOccurrencesResponse) error {
+			for _, occurrence := range resp.Occurrences {
+				if occurrence.Kind == attestationKind && occurrence.Resource != nil && occurrence.Resource.Uri == resourceURL {
+					attested = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list attestations of note %s", note)
+		}
+		if !attested {
+			missing = append(missing, attestor)
+		}
+	}
+	return missing, nil
+}
+
+// note returns the name of the note of the attestor, in the form
+// projects/PROJECT/notes/NOTE.
+func (b *BinaryAuthorization) note(ctx context.Context, attestor string) (string, error) {
+	b.mu.Lock()
+	note, ok := b.notes[attestor]
+	b.mu.Unlock()
+	if ok {
+		return note, nil
+	}
+
+	resp, err := b.attestors.Projects.Attestors.Get(attestor).Context(ctx).Do()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get attestor %s", attestor)
+	}
+	if resp.UserOwnedGrafeasNote == nil || resp.UserOwnedGrafeasNote.NoteReference == "" {
+		return "", errors.Errorf("attestor %s has no note", attestor)
+	}
+	note = resp.UserOwnedGrafeasNote.NoteReference
+
+	b.mu.Lock()
+	b.notes[attestor] = note
+	b.mu.Unlock()
+	return note, nil
+}
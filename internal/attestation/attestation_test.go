@@ -0,0 +1,65 @@
+package attestation_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/attestation"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+const image = "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc"
+
+func TestBinaryAuthorization_Missing(t *testing.T) {
+	attestorGets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/myproject/attestors/built-by-ci":
+			attestorGets++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"userOwnedGrafeasNote": map[string]string{"noteReference": "projects/myproject/notes/built-by-ci"},
+			})
+		case "/v1/projects/myproject/attestors/qa":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"userOwnedGrafeasNote": map[string]string{"noteReference": "projects/myproject/notes/qa"},
+			})
+		case "/v1beta1/projects/myproject/notes/built-by-ci/occurrences":
+			assert.Equal(t, `resourceUrl="https://`+image+`"`, r.URL.Query().Get("filter"))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"occurrences": []map[string]interface{}{
+					{"kind": "ATTESTATION", "resource": map[string]string{"uri": "https://" + image}},
+				},
+			})
+		case "/v1beta1/projects/myproject/notes/qa/occurrences":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"occurrences": []map[string]interface{}{
+					{"kind": "ATTESTATION", "resource": map[string]string{"uri": "https://us-docker.pkg.dev/myproject/myrepo/app@sha256:other"}},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	verifier, err := attestation.NewBinaryAuthorization(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	attestors := []string{"projects/myproject/attestors/built-by-ci", "projects/myproject/attestors/qa"}
+	missing, err := verifier.Missing(ctx, image, attestors)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"projects/myproject/attestors/qa"}, missing)
+
+	missing, err = verifier.Missing(ctx, image, attestors[:1])
+	assert.Nil(t, err)
+	assert.Empty(t, missing)
+	assert.Equal(t, 1, attestorGets, "the note of the attestor must be cached")
+
+	_, err = verifier.Missing(ctx, image, []string{"projects/myproject/attestors/unknown"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,17 @@
+package mock
+
+import (
+	"context"
+)
+
+// Verifier is a mock implementation of attestation.Verifier.
+type Verifier struct {
+	MissingFn      func(ctx context.Context, image string, attestors []string) ([]string, error)
+	MissingInvoked bool
+}
+
+// Missing invokes the mock implementation and marks the function as invoked.
+func (v *Verifier) Missing(ctx context.Context, image string, attestors []string) ([]string, error) {
+	v.MissingInvoked = true
+	return v.MissingFn(ctx, image, attestors)
+}
@@ -0,0 +1,258 @@
+// Package chaos injects faults in the calls to the Cloud Run API and in the
+// queries of the metrics providers, to validate that the operator recovers
+// from them (e.g. in the end-to-end tests). It must not be used in
+// production.
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/run/v1"
+)
+
+// Faults are the faults to inject. The rates are the probabilities, between
+// 0 and 1, for every call to fail with the fault.
+type Faults struct {
+	// Latency is added to every call.
+	Latency time.Duration
+
+	// ConflictRate is the rate of the updates of services rejected with a
+	// 409 error, as if the services were modified concurrently.
+	ConflictRate float64
+
+	// RateLimitRate is the rate of the calls rejected with a 429 error, to
+	// both the Cloud Run API and the metrics providers.
+	RateLimitRate float64
+
+	// MissingDataRate is the rate of the metrics queries that return no data
+	// (metrics.ErrMissingRevisionData), as if the metrics were partial.
+	MissingDataRate float64
+}
+
+// ParseFaults parses faults from a comma-separated list of key=value pairs,
+// e.g. "latency=500ms,conflict=0.3,ratelimit=0.1,missingdata=0.5".
+func ParseFaults(spec string) (Faults, error) {
+	var faults Faults
+	for _, pair := range strings.Split(spec, ",") {
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return Faults{}, errors.Errorf("invalid fault %q, must be key=value", pair)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if key == "latency" {
+			latency, err := time.ParseDuration(value)
+			if err != nil || latency < 0 {
+				return Faults{}, errors.Errorf("invalid latency %q", value)
+			}
+			faults.Latency = latency
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Faults{}, errors.Errorf("invalid rate %q for %q, must be between 0 and 1", value, key)
+		}
+		switch key {
+		case "conflict":
+			faults.ConflictRate = rate
+		case "ratelimit":
+			faults.RateLimitRate = rate
+		case "missingdata":
+			faults.MissingDataRate = rate
+		default:
+			return Faults{}, errors.Errorf("unknown fault %q, must be latency, conflict, ratelimit or missingdata", key)
+		}
+	}
+	return faults, nil
+}
+
+// Injector injects faults in the clients it wraps.
+type Injector struct {
+	faults Faults
+	sleep  func(time.Duration)
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewInjector initializes an injector of the faults.
+func NewInjector(faults Faults) *Injector {
+	return &Injector{
+		faults: faults,
+		sleep:  time.Sleep,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// WithRand updates the source of randomness of the injector, e.g. to inject
+// the same faults in every run of a test.
+func (i *Injector) WithRand(r *rand.Rand) *Injector {
+	i.rand = r
+	return i
+}
+
+// WithSleep updates the function used to add latency to the calls.
+func (i *Injector) WithSleep(sleep func(time.Duration)) *Injector {
+	i.sleep = sleep
+	return i
+}
+
+// delay adds the latency to the call.
+func (i *Injector) delay() {
+	if i.faults.Latency > 0 {
+		i.sleep(i.faults.Latency)
+	}
+}
+
+// hit determines if the call fails with the rate.
+func (i *Injector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rand.Float64() < rate
+}
+
+// apiError returns the error of an API for the status code.
+func apiError(code int, method string) error {
+	return &googleapi.Error{Code: code, Message: "chaos: injected " + http.StatusText(code) + " in " + method}
+}
+
+// RunClient returns a client that injects the faults in the calls to the
+// client.
+func (i *Injector) RunClient(client runapi.Client) runapi.Client {
+	return &runClient{client: client, injector: i}
+}
+
+type runClient struct {
+	client   runapi.Client
+	injector *Injector
+}
+
+// fail returns the error injected in the call to the method, if any.
+func (c *runClient) fail(method string) error {
+	c.injector.delay()
+	if c.injector.hit(c.injector.faults.RateLimitRate) {
+		return apiError(http.StatusTooManyRequests, method)
+	}
+	return nil
+}
+
+func (c *runClient) Service(namespace, serviceID string) (*run.Service, error) {
+	if err := c.fail("Service"); err != nil {
+		return nil, err
+	}
+	return c.client.Service(namespace, serviceID)
+}
+
+func (c *runClient) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	if err := c.fail("ReplaceService"); err != nil {
+		return nil, err
+	}
+	if c.injector.hit(c.injector.faults.ConflictRate) {
+		return nil, apiError(http.StatusConflict, "ReplaceService")
+	}
+	return c.client.ReplaceService(namespace, serviceID, svc)
+}
+
+func (c *runClient) Revision(namespace, revisionID string) (*run.Revision, error) {
+	if err := c.fail("Revision"); err != nil {
+		return nil, err
+	}
+	return c.client.Revision(namespace, revisionID)
+}
+
+func (c *runClient) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	if err := c.fail("ServicesWithLabelSelector"); err != nil {
+		return nil, err
+	}
+	return c.client.ServicesWithLabelSelector(namespace, labelSelector)
+}
+
+// Provider returns a provider that injects the faults in the queries sent to
+// the provider.
+//
+// If the provider implements metrics.SpanProvider, so does the returned
+// provider.
+func (i *Injector) Provider(provider metrics.Provider) metrics.Provider {
+	p := &faultyProvider{provider: provider, injector: i}
+	if spans, ok := provider.(metrics.SpanProvider); ok {
+		return &faultySpanProvider{faultyProvider: p, spans: spans}
+	}
+	return p
+}
+
+type faultyProvider struct {
+	provider metrics.Provider
+	injector *Injector
+}
+
+// fail returns the error injected in the query of the method, if any.
+func (p *faultyProvider) fail(method string) error {
+	p.injector.delay()
+	if p.injector.hit(p.injector.faults.RateLimitRate) {
+		return apiError(http.StatusTooManyRequests, method)
+	}
+	if p.injector.hit(p.injector.faults.MissingDataRate) {
+		return metrics.ErrMissingRevisionData
+	}
+	return nil
+}
+
+func (p *faultyProvider) SetCandidateRevision(revisionName string) {
+	p.provider.SetCandidateRevision(revisionName)
+}
+
+func (p *faultyProvider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	if err := p.fail("RequestCount"); err != nil {
+		return 0, err
+	}
+	return p.provider.RequestCount(ctx, offset)
+}
+
+func (p *faultyProvider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	if err := p.fail("Latency"); err != nil {
+		return 0, err
+	}
+	return p.provider.Latency(ctx, offset, alignReduceType)
+}
+
+func (p *faultyProvider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	if err := p.fail("ErrorRate"); err != nil {
+		return 0, err
+	}
+	return p.provider.ErrorRate(ctx, offset)
+}
+
+type faultySpanProvider struct {
+	*faultyProvider
+	spans metrics.SpanProvider
+}
+
+func (p *faultySpanProvider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	if err := p.fail("SpanErrorRate"); err != nil {
+		return 0, err
+	}
+	return p.spans.SpanErrorRate(ctx, offset, operation)
+}
+
+func (p *faultySpanProvider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+	if err := p.fail("SpanLatency"); err != nil {
+		return 0, err
+	}
+	return p.spans.SpanLatency(ctx, offset, operation, alignReduceType)
+}
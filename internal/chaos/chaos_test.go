@@ -0,0 +1,111 @@
+package chaos_test
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/chaos"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/run/v1"
+)
+
+func TestParseFaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		expected  chaos.Faults
+		shouldErr bool
+	}{
+		{name: "empty", spec: ""},
+		{
+			name:     "all faults",
+			spec:     "latency=500ms, conflict=0.3,ratelimit=0.1,missingdata=1",
+			expected: chaos.Faults{Latency: 500 * time.Millisecond, ConflictRate: 0.3, RateLimitRate: 0.1, MissingDataRate: 1},
+		},
+		{name: "missing value", spec: "conflict", shouldErr: true},
+		{name: "rate out of range", spec: "conflict=1.5", shouldErr: true},
+		{name: "invalid latency", spec: "latency=fast", shouldErr: true},
+		{name: "unknown fault", spec: "outage=0.5", shouldErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			faults, err := chaos.ParseFaults(test.spec)
+			if test.shouldErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, faults)
+		})
+	}
+}
+
+func TestInjector_RunClient(t *testing.T) {
+	var replaced int
+	client := &runMocker.RunAPI{}
+	client.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+		return &run.Service{Metadata: &run.ObjectMeta{Name: serviceID}}, nil
+	}
+	client.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		replaced++
+		return svc, nil
+	}
+
+	var slept time.Duration
+	injector := chaos.NewInjector(chaos.Faults{Latency: time.Second, ConflictRate: 1}).
+		WithRand(rand.New(rand.NewSource(1))).
+		WithSleep(func(d time.Duration) { slept += d })
+	faulty := injector.RunClient(client)
+
+	svc, err := faulty.Service("myproject", "mysvc")
+	assert.Nil(t, err)
+	assert.Equal(t, "mysvc", svc.Metadata.Name)
+
+	_, err = faulty.ReplaceService("myproject", "mysvc", svc)
+	assert.True(t, runapi.IsConflict(err), "expected conflict, got %v", err)
+	assert.Equal(t, 0, replaced)
+	assert.Equal(t, 2*time.Second, slept)
+
+	faulty = chaos.NewInjector(chaos.Faults{RateLimitRate: 1}).RunClient(client)
+	_, err = faulty.Service("myproject", "mysvc")
+	if assert.IsType(t, &googleapi.Error{}, err) {
+		assert.Equal(t, http.StatusTooManyRequests, err.(*googleapi.Error).Code)
+	}
+}
+
+func TestInjector_Provider(t *testing.T) {
+	spansMock := &metricsMocker.Spans{}
+	spansMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 10, nil
+	}
+	spansMock.SpanErrorRateFn = func(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+		return 0.01, nil
+	}
+
+	provider := chaos.NewInjector(chaos.Faults{}).Provider(spansMock)
+	count, err := provider.RequestCount(context.TODO(), time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), count)
+
+	provider = chaos.NewInjector(chaos.Faults{MissingDataRate: 1}).Provider(spansMock)
+	_, err = provider.RequestCount(context.TODO(), time.Minute)
+	assert.Equal(t, metrics.ErrMissingRevisionData, err)
+
+	spans, ok := provider.(metrics.SpanProvider)
+	if assert.True(t, ok, "span provider must stay a span provider") {
+		_, err = spans.SpanErrorRate(context.TODO(), time.Minute, "checkout")
+		assert.Equal(t, metrics.ErrMissingRevisionData, err)
+	}
+
+	_, ok = chaos.NewInjector(chaos.Faults{}).Provider(&metricsMocker.Metrics{}).(metrics.SpanProvider)
+	assert.False(t, ok)
+}
@@ -0,0 +1,220 @@
+// Package cloudtrace provides health metrics computed from the spans stored in
+// Cloud Trace, useful when a regression is in a downstream call rather than in
+// the HTTP status codes of the service.
+package cloudtrace
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/option"
+)
+
+// DefaultRevisionLabel is the default span label that holds the revision name.
+const DefaultRevisionLabel = "g.co/r/cloud_run_revision/revision_name"
+
+// Span labels that indicate an error.
+const (
+	statusCodeLabel   = "/http/status_code"
+	errorMessageLabel = "/error/message"
+	errorLabel        = "error"
+)
+
+// maxTraces is the maximum number of traces fetched per query to bound the
+// cost of evaluating a criterion.
+const maxTraces = 1000
+
+// span is the information needed from a Cloud Trace span.
+type span struct {
+	duration time.Duration
+	failed   bool
+}
+
+// Provider gets span metrics from Cloud Trace.
+type Provider struct {
+	client        *cloudtrace.Service
+	project       string
+	revisionLabel string
+	revision      string
+}
+
+// NewProvider initializes the provider for Cloud Trace. The revision label is
+// the span label that identifies the revision that created the span.
+func NewProvider(ctx context.Context, project, revisionLabel string, opts ...option.ClientOption) (*Provider, error) {
+	client, err := cloudtrace.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize Cloud Trace client")
+	}
+	return &Provider{
+		client:        client,
+		project:       project,
+		revisionLabel: revisionLabel,
+	}, nil
+}
+
+// SetCandidateRevision sets the candidate revision name for which the provider
+// should get metrics.
+func (p *Provider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+}
+
+// SpanErrorRate returns the rate of spans for the operation with errors.
+func (p *Provider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	spans, err := p.spans(ctx, offset, operation)
+	if err != nil {
+		return 0, err
+	}
+	var failed int
+	for _, span := range spans {
+		if span.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(spans)), nil
+}
+
+// SpanLatency returns the duration of the spans for the operation, in
+// milliseconds.
+func (p *Provider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+	var percentile float64
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		percentile = 99
+	case metrics.Align95Reduce95:
+		percentile = 95
+	case metrics.Align50Reduce50:
+		percentile = 50
+	default:
+		return 0, errors.Errorf("unsupported align reduce type %v", alignReduceType)
+	}
+
+	spans, err := p.spans(ctx, offset, operation)
+	if err != nil {
+		return 0, err
+	}
+	durations := make([]float64, 0, len(spans))
+	for _, span := range spans {
+		durations = append(durations, float64(span.duration)/float64(time.Millisecond))
+	}
+	sort.Float64s(durations)
+
+	// Nearest-rank percentile.
+	rank := int(math.Ceil(percentile / 100 * float64(len(durations))))
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1], nil
+}
+
+// spans returns the spans with the operation name created by the candidate
+// revision during the offset.
+//
+// If no span is found, metrics.ErrMissingRevisionData is returned.
+func (p *Provider) spans(ctx context.Context, offset time.Duration, operation string) ([]span, error) {
+	endTime := time.Now()
+	startTime := endTime.Add(-offset)
+	filter := p.filter(operation)
+	util.LoggerFrom(ctx).WithField("filter", filter).Debug("querying Cloud Trace")
+
+	var spans []span
+	var traces int
+	call := p.client.Projects.Traces.List(p.project).
+		StartTime(startTime.Format(time.RFC3339Nano)).
+		EndTime(endTime.Format(time.RFC3339Nano)).
+		Filter(filter).
+		View("COMPLETE")
+	err := call.Pages(ctx, func(resp *cloudtrace.ListTracesResponse) error {
+		for _, trace := range resp.Traces {
+			for _, s := range trace.Spans {
+				if s.Name != operation {
+					continue
+				}
+				span, err := newSpan(s)
+				if err != nil {
+					return err
+				}
+				spans = append(spans, span)
+			}
+		}
+
+		traces += len(resp.Traces)
+		if traces >= maxTraces {
+			return errStopPaging
+		}
+		return nil
+	})
+	if err != nil && err != errStopPaging {
+		return nil, errors.Wrap(err, "error when querying for traces")
+	}
+	metrics.RecordQuery(ctx, metrics.Query{Query: filter, Start: startTime, End: endTime})
+
+	if len(spans) == 0 {
+		return nil, errors.Wrapf(metrics.ErrMissingRevisionData, "no spans for operation %q", operation)
+	}
+	return spans, nil
+}
+
+// errStopPaging stops listing traces once enough traces were retrieved.
+var errStopPaging = errors.New("enough traces")
+
+// filter returns the Cloud Trace filter for the spans of the operation in the
+// candidate revision.
+func (p *Provider) filter(operation string) string {
+	return fmt.Sprintf("+span:%q +%s:%q", operation, p.revisionLabel, p.revision)
+}
+
+func newSpan(s *cloudtrace.TraceSpan) (span, error) {
+	start, err := time.Parse(time.RFC3339Nano, s.StartTime)
+	if err != nil {
+		return span{}, errors.Wrapf(err, "invalid start time for span %d", s.SpanId)
+	}
+	end, err := time.Parse(time.RFC3339Nano, s.EndTime)
+	if err != nil {
+		return span{}, errors.Wrapf(err, "invalid end time for span %d", s.SpanId)
+	}
+	return span{duration: end.Sub(start), failed: isFailed(s.Labels)}, nil
+}
+
+// isFailed determines if a span had an error based on its labels.
+func isFailed(labels map[string]string) bool {
+	if _, ok := labels[errorMessageLabel]; ok {
+		return true
+	}
+	if labels[errorLabel] == "true" {
+		return true
+	}
+	code, err := strconv.Atoi(labels[statusCodeLabel])
+	return err == nil && code >= 500
+}
+
+// WithSpans returns a metrics provider that gets the span metrics from the
+// Cloud Trace provider and the other metrics from the given provider.
+func WithSpans(provider metrics.Provider, traces *Provider) metrics.Provider {
+	return &combinedProvider{Provider: provider, traces: traces}
+}
+
+type combinedProvider struct {
+	metrics.Provider
+	traces *Provider
+}
+
+func (p *combinedProvider) SetCandidateRevision(revisionName string) {
+	p.Provider.SetCandidateRevision(revisionName)
+	p.traces.SetCandidateRevision(revisionName)
+}
+
+func (p *combinedProvider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	return p.traces.SpanErrorRate(ctx, offset, operation)
+}
+
+func (p *combinedProvider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+	return p.traces.SpanLatency(ctx, offset, operation, alignReduceType)
+}
@@ -0,0 +1,76 @@
+package cloudtrace_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/cloudtrace"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func span(name string, duration time.Duration, labels map[string]string) map[string]interface{} {
+	start := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	return map[string]interface{}{
+		"name":      name,
+		"startTime": start.Format(time.RFC3339Nano),
+		"endTime":   start.Add(duration).Format(time.RFC3339Nano),
+		"labels":    labels,
+	}
+}
+
+func TestProvider(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/projects/myproject/traces", r.URL.Path)
+		filter := r.URL.Query().Get("filter")
+		filters = append(filters, filter)
+
+		var traces []map[string]interface{}
+		if filter == `+span:"db.query" +rev:"test-002"` {
+			traces = []map[string]interface{}{
+				{"spans": []map[string]interface{}{
+					span("/root", time.Second, nil),
+					span("db.query", 100*time.Millisecond, nil),
+					span("db.query", 300*time.Millisecond, map[string]string{"/http/status_code": "503"}),
+				}},
+				{"spans": []map[string]interface{}{
+					span("db.query", 200*time.Millisecond, map[string]string{"/http/status_code": "404"}),
+					span("db.query", 400*time.Millisecond, map[string]string{"/error/message": "timeout"}),
+				}},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"traces": traces})
+	}))
+	defer server.Close()
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	provider, err := cloudtrace.NewProvider(ctx, "myproject", "rev", option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	assert.Nil(t, err)
+	provider.SetCandidateRevision("test-002")
+	offset := 30 * time.Minute
+
+	rate, err := provider.SpanErrorRate(ctx, offset, "db.query")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, rate)
+
+	latency, err := provider.SpanLatency(ctx, offset, "db.query", metrics.Align95Reduce95)
+	assert.Nil(t, err)
+	assert.Equal(t, 400.0, latency)
+
+	latency, err = provider.SpanLatency(ctx, offset, "db.query", metrics.Align50Reduce50)
+	assert.Nil(t, err)
+	assert.Equal(t, 200.0, latency)
+
+	_, err = provider.SpanErrorRate(ctx, offset, "cache.get")
+	assert.True(t, errors.Is(err, metrics.ErrMissingRevisionData))
+	assert.Equal(t, `+span:"cache.get" +rev:"test-002"`, filters[len(filters)-1])
+}
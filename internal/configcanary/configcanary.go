@@ -0,0 +1,110 @@
+// Package configcanary decides which services are managed by a configuration
+// in canary (see -config-canary) and when the canary is complete, so a
+// configuration change is applied fleet-wide only once it rolled out a
+// candidate on a canary service.
+package configcanary
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+)
+
+// Service is a service discovered with one of the configurations.
+type Service struct {
+	Key    string
+	Labels map[string]string
+}
+
+// Choice is a managed service: the service at Index in the services
+// discovered with the configuration in canary if Canary is set, or else with
+// the current configuration.
+type Choice struct {
+	Canary bool
+	Index  int
+}
+
+// Select returns the managed services: the canary services, whose labels
+// match the selector, are managed by the configuration in canary if it
+// targets them, and dropped otherwise. The other services are managed by the
+// current configuration. The services are in the order of the current
+// configuration, followed by the canary services it does not target.
+func Select(selector string, current, canary []Service) []Choice {
+	canaries := make(map[string]int)
+	for i, svc := range canary {
+		if runapi.MatchesLabelSelector(svc.Labels, selector) {
+			canaries[svc.Key] = i
+		}
+	}
+
+	var managed []Choice
+	for i, svc := range current {
+		if j, ok := canaries[svc.Key]; ok {
+			managed = append(managed, Choice{Canary: true, Index: j})
+			delete(canaries, svc.Key)
+			continue
+		}
+		if runapi.MatchesLabelSelector(svc.Labels, selector) {
+			continue
+		}
+		managed = append(managed, Choice{Index: i})
+	}
+	for i, svc := range canary {
+		if j, ok := canaries[svc.Key]; ok && j == i {
+			managed = append(managed, Choice{Canary: true, Index: i})
+		}
+	}
+	return managed
+}
+
+// Outcome is the effect of a rollout decision on the canary.
+type Outcome int
+
+// Outcomes of the rollout decisions.
+const (
+	// Ignored means the decision does not change the canary, e.g. it is not
+	// about a canary service.
+	Ignored Outcome = iota
+	// Shifted means the traffic of the candidate of a canary service was
+	// shifted under the configuration in canary.
+	Shifted
+	// RolledBack means the candidate of a canary service was rolled back, so
+	// its next candidate must be shifted again.
+	RolledBack
+	// Completed means a canary service completed a rollout under the
+	// configuration in canary, which can be applied fleet-wide.
+	Completed
+)
+
+// Progress is the progress of the canary services: whether the traffic of
+// their candidate was shifted under the configuration in canary.
+type Progress map[string]bool
+
+// Track adds the canary service, if not tracked yet.
+func (p Progress) Track(key string) {
+	if _, ok := p[key]; !ok {
+		p[key] = false
+	}
+}
+
+// Record takes the rollout decision of the service into account. A rollout
+// is complete when the candidate is promoted after its traffic was shifted at
+// least once under the configuration in canary.
+func (p Progress) Record(key, decision string) Outcome {
+	shifted, ok := p[key]
+	if !ok {
+		return Ignored
+	}
+	switch decision {
+	case archive.RollForwardDecision:
+		p[key] = true
+		return Shifted
+	case archive.RollbackDecision:
+		p[key] = false
+		return RolledBack
+	case archive.PromotionDecision:
+		if shifted {
+			return Completed
+		}
+	}
+	return Ignored
+}
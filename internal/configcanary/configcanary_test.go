@@ -0,0 +1,111 @@
+package configcanary_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/configcanary"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	canaryLabels := map[string]string{"canary": "true"}
+	tests := []struct {
+		name     string
+		current  []configcanary.Service
+		canary   []configcanary.Service
+		expected []configcanary.Choice
+	}{
+		{
+			name:    "no canary service",
+			current: []configcanary.Service{{Key: "a"}, {Key: "b"}},
+			canary:  []configcanary.Service{{Key: "a"}, {Key: "b"}},
+			expected: []configcanary.Choice{
+				{Index: 0},
+				{Index: 1},
+			},
+		},
+		{
+			name:    "canary service managed by the configuration in canary",
+			current: []configcanary.Service{{Key: "a"}, {Key: "b", Labels: canaryLabels}, {Key: "c"}},
+			canary:  []configcanary.Service{{Key: "b", Labels: canaryLabels}, {Key: "a"}},
+			expected: []configcanary.Choice{
+				{Index: 0},
+				{Canary: true, Index: 0},
+				{Index: 2},
+			},
+		},
+		{
+			name:    "canary service no longer targeted",
+			current: []configcanary.Service{{Key: "a"}, {Key: "b", Labels: canaryLabels}},
+			canary:  []configcanary.Service{{Key: "a"}},
+			expected: []configcanary.Choice{
+				{Index: 0},
+			},
+		},
+		{
+			name:    "canary service only targeted by the configuration in canary",
+			current: []configcanary.Service{{Key: "a"}},
+			canary:  []configcanary.Service{{Key: "a"}, {Key: "b", Labels: canaryLabels}},
+			expected: []configcanary.Choice{
+				{Index: 0},
+				{Canary: true, Index: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, configcanary.Select("canary=true", test.current, test.canary))
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		decisions []string
+		expected  []configcanary.Outcome
+	}{
+		{
+			name:      "promotion after a traffic shift",
+			decisions: []string{archive.RollForwardDecision, archive.RollForwardDecision, archive.PromotionDecision},
+			expected:  []configcanary.Outcome{configcanary.Shifted, configcanary.Shifted, configcanary.Completed},
+		},
+		{
+			name:      "promotion without traffic shift",
+			decisions: []string{archive.PromotionDecision},
+			expected:  []configcanary.Outcome{configcanary.Ignored},
+		},
+		{
+			name:      "promotion after a rollback",
+			decisions: []string{archive.RollForwardDecision, archive.RollbackDecision, archive.PromotionDecision},
+			expected:  []configcanary.Outcome{configcanary.Shifted, configcanary.RolledBack, configcanary.Ignored},
+		},
+		{
+			name:      "other decisions",
+			decisions: []string{"unchanged", "error", archive.RollForwardDecision, "unchanged", archive.PromotionDecision},
+			expected: []configcanary.Outcome{configcanary.Ignored, configcanary.Ignored, configcanary.Shifted,
+				configcanary.Ignored, configcanary.Completed},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			progress := make(configcanary.Progress)
+			progress.Track("canary")
+			var outcomes []configcanary.Outcome
+			for _, decision := range test.decisions {
+				outcomes = append(outcomes, progress.Record("canary", decision))
+			}
+			assert.Equal(tt, test.expected, outcomes)
+		})
+	}
+
+	progress := make(configcanary.Progress)
+	progress.Track("canary")
+	progress.Record("canary", archive.RollForwardDecision)
+	progress.Track("canary")
+	assert.Equal(t, configcanary.Completed, progress.Record("canary", archive.PromotionDecision), "tracking again keeps the progress")
+	assert.Equal(t, configcanary.Ignored, progress.Record("other", archive.RollForwardDecision), "not a canary service")
+}
@@ -0,0 +1,150 @@
+// Package configsource reads the configuration file from the local file
+// system, Cloud Storage, Secret Manager or an HTTP(S) URL, so the operator can
+// be reconfigured without rebuilding its container.
+package configsource
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+	"google.golang.org/api/storage/v1"
+)
+
+// Source represents a location the configuration file is read from.
+type Source interface {
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// New returns the source for the location, which is one of
+// gs://BUCKET/OBJECT, sm://PROJECT/SECRET[/VERSION], an http:// or https://
+// URL, or a local path. The options are used by the Google Cloud clients.
+func New(ctx context.Context, location string, opts ...option.ClientOption) (Source, error) {
+	switch {
+	case strings.HasPrefix(location, "gs://"):
+		return NewGCS(ctx, location, opts...)
+	case strings.HasPrefix(location, "sm://"):
+		return NewSecretManager(ctx, location, opts...)
+	case strings.HasPrefix(location, "https://"), strings.HasPrefix(location, "http://"):
+		return NewHTTP(http.DefaultClient, location), nil
+	default:
+		return NewFile(location), nil
+	}
+}
+
+// File reads the configuration from a local file.
+type File struct {
+	path string
+}
+
+// NewFile initializes a source for the local file.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Read implements Source.
+func (f *File) Read(ctx context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(f.path)
+	return data, errors.Wrapf(err, "failed to read %s", f.path)
+}
+
+// GCS reads the configuration from a Cloud Storage object.
+type GCS struct {
+	service *storage.Service
+	bucket  string
+	object  string
+}
+
+// NewGCS initializes a source for the object (gs://BUCKET/OBJECT).
+func NewGCS(ctx context.Context, location string, opts ...option.ClientOption) (*GCS, error) {
+	parts := strings.SplitN(strings.TrimPrefix(location, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("location must have the form gs://BUCKET/OBJECT, got %q", location)
+	}
+	service, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Storage client")
+	}
+	return &GCS{service: service, bucket: parts[0], object: parts[1]}, nil
+}
+
+// Read implements Source.
+func (g *GCS) Read(ctx context.Context) ([]byte, error) {
+	resp, err := g.service.Objects.Get(g.bucket, g.object).Context(ctx).Download()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download gs://%s/%s", g.bucket, g.object)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Wrapf(err, "failed to read gs://%s/%s", g.bucket, g.object)
+}
+
+// SecretManager reads the configuration from a Secret Manager secret version.
+type SecretManager struct {
+	service *secretmanager.Service
+	name    string
+}
+
+// NewSecretManager initializes a source for the secret version
+// (sm://PROJECT/SECRET/VERSION). If the version is omitted, the latest
+// version is read.
+func NewSecretManager(ctx context.Context, location string, opts ...option.ClientOption) (*SecretManager, error) {
+	parts := strings.Split(strings.TrimPrefix(location, "sm://"), "/")
+	if len(parts) == 2 {
+		parts = append(parts, "latest")
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, errors.Errorf("location must have the form sm://PROJECT/SECRET[/VERSION], got %q", location)
+	}
+	service, err := secretmanager.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Secret Manager client")
+	}
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", parts[0], parts[1], parts[2])
+	return &SecretManager{service: service, name: name}, nil
+}
+
+// Read implements Source.
+func (s *SecretManager) Read(ctx context.Context) ([]byte, error) {
+	resp, err := s.service.Projects.Secrets.Versions.Access(s.name).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to access secret %s", s.name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	return data, errors.Wrapf(err, "failed to decode secret %s", s.name)
+}
+
+// HTTP reads the configuration from a URL.
+type HTTP struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTP initializes a source for the URL.
+func NewHTTP(client *http.Client, url string) *HTTP {
+	return &HTTP{client: client, url: url}
+}
+
+// Read implements Source.
+func (h *HTTP) Read(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s", h.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s returned status %d", h.url, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Wrapf(err, "failed to read %s", h.url)
+}
@@ -0,0 +1,100 @@
+package configsource_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/configsource"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configsource")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("strategies: []"), 0644))
+
+	source, err := configsource.New(context.Background(), path)
+	assert.Nil(t, err)
+	data, err := source.Read(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "strategies: []", string(data))
+
+	_, err = configsource.NewFile(filepath.Join(dir, "missing.yaml")).Read(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("strategies: []"))
+	}))
+	defer server.Close()
+
+	source, err := configsource.New(context.Background(), server.URL+"/config.yaml")
+	assert.Nil(t, err)
+	data, err := source.Read(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "strategies: []", string(data))
+
+	_, err = configsource.NewHTTP(server.Client(), server.URL+"/missing.yaml").Read(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestGCS(t *testing.T) {
+	_, err := configsource.NewGCS(context.Background(), "gs://bucket")
+	assert.NotNil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/b/bucket/o/path/config.yaml", r.URL.Path)
+		assert.Equal(t, "media", r.URL.Query().Get("alt"))
+		w.Write([]byte("strategies: []"))
+	}))
+	defer server.Close()
+
+	source, err := configsource.NewGCS(context.Background(), "gs://bucket/path/config.yaml",
+		option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+	data, err := source.Read(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "strategies: []", string(data))
+}
+
+func TestSecretManager(t *testing.T) {
+	_, err := configsource.NewSecretManager(context.Background(), "sm://project")
+	assert.NotNil(t, err)
+
+	tests := []struct {
+		location string
+		path     string
+	}{
+		{"sm://myproject/config", "/v1/projects/myproject/secrets/config/versions/latest:access"},
+		{"sm://myproject/config/3", "/v1/projects/myproject/secrets/config/versions/3:access"},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, test.path, r.URL.Path)
+			fmt.Fprintf(w, `{"payload": {"data": %q}}`, base64.StdEncoding.EncodeToString([]byte("strategies: []")))
+		}))
+
+		source, err := configsource.NewSecretManager(context.Background(), test.location,
+			option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		assert.Nil(t, err)
+		data, err := source.Read(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "strategies: []", string(data))
+		server.Close()
+	}
+}
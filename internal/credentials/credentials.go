@@ -0,0 +1,273 @@
+// Package credentials authenticates the Google API clients with a credential
+// file, including the external account files of Workload Identity Federation,
+// so the operator can run outside of Google Cloud (e.g. on GitHub Actions or
+// on-premises) without a long-lived service account key.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// externalAccountType is the type of the credential files of Workload
+// Identity Federation.
+const externalAccountType = "external_account"
+
+// tokenLifetime is the lifetime of the access tokens of the impersonated
+// service account.
+const tokenLifetime = time.Hour
+
+// TokenSource returns a token source of access tokens with the scopes for the
+// credential file: a service account key, user credentials or an external
+// account.
+func TokenSource(ctx context.Context, filename string, scopes ...string) (oauth2.TokenSource, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read credential file %s", filename)
+	}
+	var file struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "invalid credential file %s", filename)
+	}
+	if file.Type == externalAccountType {
+		ts, err := ExternalAccountTokenSource(ctx, data, scopes)
+		return ts, errors.Wrapf(err, "invalid credential file %s", filename)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, data, scopes...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid credential file %s", filename)
+	}
+	return creds.TokenSource, nil
+}
+
+// IsExternalAccount determines if the credential file is an external account.
+func IsExternalAccount(filename string) bool {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	var file struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &file) == nil && file.Type == externalAccountType
+}
+
+// ExternalAccount is the configuration of an external account.
+type ExternalAccount struct {
+	Audience                       string           `json:"audience"`
+	SubjectTokenType               string           `json:"subject_token_type"`
+	TokenURL                       string           `json:"token_url"`
+	ServiceAccountImpersonationURL string           `json:"service_account_impersonation_url"`
+	CredentialSource               CredentialSource `json:"credential_source"`
+}
+
+// CredentialSource is where the token of the external identity (the subject
+// token) is read from: a file, or a URL (e.g. the OIDC token endpoint of
+// GitHub Actions).
+type CredentialSource struct {
+	File    string            `json:"file"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Format  struct {
+		// Type is "text" (the default) or "json", in which case the token is
+		// the SubjectTokenFieldName field of the JSON object.
+		Type                  string `json:"type"`
+		SubjectTokenFieldName string `json:"subject_token_field_name"`
+	} `json:"format"`
+}
+
+// ExternalAccountTokenSource returns a token source of access tokens with the
+// scopes for the external account file. The token of the external identity is
+// exchanged with the Security Token Service, then for a token of the
+// impersonated service account, if any. The tokens are reused until they
+// expire.
+func ExternalAccountTokenSource(ctx context.Context, data []byte, scopes []string) (oauth2.TokenSource, error) {
+	var account ExternalAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, errors.Wrap(err, "failed to parse external account")
+	}
+	source := account.CredentialSource
+	switch {
+	case account.Audience == "":
+		return nil, errors.New("audience must be specified")
+	case account.TokenURL == "":
+		return nil, errors.New("token_url must be specified")
+	case (source.File == "") == (source.URL == ""):
+		return nil, errors.New("credential_source must have either a file or a url")
+	case source.Format.Type != "" && source.Format.Type != "text" && source.Format.Type != "json":
+		return nil, errors.Errorf("invalid credential_source format %q, must be text or json", source.Format.Type)
+	case source.Format.Type == "json" && source.Format.SubjectTokenFieldName == "":
+		return nil, errors.New("subject_token_field_name must be specified for the json format")
+	}
+	return oauth2.ReuseTokenSource(nil, &externalAccountTokenSource{
+		ctx:     ctx,
+		client:  http.DefaultClient,
+		account: account,
+		scopes:  scopes,
+	}), nil
+}
+
+type externalAccountTokenSource struct {
+	ctx     context.Context
+	client  *http.Client
+	account ExternalAccount
+	scopes  []string
+}
+
+// Token implements oauth2.TokenSource.
+func (ts *externalAccountTokenSource) Token() (*oauth2.Token, error) {
+	subjectToken, err := ts.subjectToken()
+	if err != nil {
+		return nil, err
+	}
+	token, err := ts.exchange(subjectToken)
+	if err != nil {
+		return nil, err
+	}
+	if ts.account.ServiceAccountImpersonationURL == "" {
+		return token, nil
+	}
+	return ts.impersonate(token)
+}
+
+// subjectToken reads the token of the external identity.
+func (ts *externalAccountTokenSource) subjectToken() (string, error) {
+	source := ts.account.CredentialSource
+	var data []byte
+	if source.File != "" {
+		var err error
+		data, err = ioutil.ReadFile(source.File)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read subject token")
+		}
+	} else {
+		req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create subject token request")
+		}
+		for key, value := range source.Headers {
+			req.Header.Set(key, value)
+		}
+		data, err = ts.do(req)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get subject token")
+		}
+	}
+
+	if source.Format.Type != "json" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", errors.Wrap(err, "failed to parse subject token")
+	}
+	token, ok := fields[source.Format.SubjectTokenFieldName].(string)
+	if !ok || token == "" {
+		return "", errors.Errorf("subject token has no %q field", source.Format.SubjectTokenFieldName)
+	}
+	return token, nil
+}
+
+// exchange exchanges the token of the external identity for a federated
+// access token with the Security Token Service.
+func (ts *externalAccountTokenSource) exchange(subjectToken string) (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {ts.account.Audience},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {ts.account.SubjectTokenType},
+		"scope":                {strings.Join(ts.scopes, " ")},
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.account.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create token exchange request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	data, err := ts.do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to exchange subject token")
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token exchange response")
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("token exchange response has no access token")
+	}
+	return &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// impersonate gets an access token of the service account impersonated by
+// the federated identity.
+func (ts *externalAccountTokenSource) impersonate(token *oauth2.Token) (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    ts.scopes,
+		"lifetime": fmt.Sprintf("%ds", int(tokenLifetime.Seconds())),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode impersonation request")
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.account.ServiceAccountImpersonationURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create impersonation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+	data, err := ts.do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to impersonate service account")
+	}
+
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+		ExpireTime  string `json:"expireTime"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to parse impersonation response")
+	}
+	expiry, err := time.Parse(time.RFC3339, resp.ExpireTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid expiration time of access token")
+	}
+	return &oauth2.Token{AccessToken: resp.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// do sends the request and returns the body of a successful response.
+func (ts *externalAccountTokenSource) do(req *http.Request) ([]byte, error) {
+	resp, err := ts.client.Do(req.WithContext(ts.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
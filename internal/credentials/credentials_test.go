@@ -0,0 +1,149 @@
+package credentials_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+func TestExternalAccountTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oidc":
+			if r.Header.Get("Authorization") != "Bearer request-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"value": "oidc-token"}`)
+		case "/v1/token":
+			r.ParseForm()
+			if r.Form.Get("subject_token") != "oidc-token" || r.Form.Get("audience") != "//iam.googleapis.com/pool" || r.Form.Get("scope") != scope {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "federated-token", "token_type": "Bearer", "expires_in": 3600}`)
+		case "/v1/projects/-/serviceAccounts/operator@myproject.iam.gserviceaccount.com:generateAccessToken":
+			if r.Header.Get("Authorization") != "Bearer federated-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"accessToken": "sa-token", "expireTime": expiry.Format(time.RFC3339)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	account := func(impersonationURL string) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":                              "external_account",
+			"audience":                          "//iam.googleapis.com/pool",
+			"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+			"token_url":                         server.URL + "/v1/token",
+			"service_account_impersonation_url": impersonationURL,
+			"credential_source": map[string]interface{}{
+				"url":     server.URL + "/oidc",
+				"headers": map[string]string{"Authorization": "Bearer request-token"},
+				"format":  map[string]string{"type": "json", "subject_token_field_name": "value"},
+			},
+		})
+		return data
+	}
+
+	ctx := context.Background()
+	ts, err := credentials.ExternalAccountTokenSource(ctx, account(""), []string{scope})
+	assert.Nil(t, err)
+	token, err := ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "federated-token", token.AccessToken)
+
+	ts, err = credentials.ExternalAccountTokenSource(ctx, account(server.URL+"/v1/projects/-/serviceAccounts/operator@myproject.iam.gserviceaccount.com:generateAccessToken"), []string{scope})
+	assert.Nil(t, err)
+	token, err = ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "sa-token", token.AccessToken)
+	assert.True(t, expiry.Equal(token.Expiry))
+
+	ts, err = credentials.ExternalAccountTokenSource(ctx, account(server.URL+"/unknown"), []string{scope})
+	assert.Nil(t, err)
+	_, err = ts.Token()
+	assert.NotNil(t, err)
+}
+
+func TestExternalAccountTokenSource_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("subject_token") != "file-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "federated-token", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	data := fmt.Sprintf(`{"type": "external_account", "audience": "//iam.googleapis.com/pool", "token_url": %q, "credential_source": {"file": %q}}`, server.URL, tokenFile)
+	ts, err := credentials.ExternalAccountTokenSource(context.Background(), []byte(data), []string{scope})
+	assert.Nil(t, err)
+	token, err := ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "federated-token", token.AccessToken)
+}
+
+func TestExternalAccountTokenSource_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "no audience", data: `{"token_url": "https://sts.googleapis.com/v1/token", "credential_source": {"file": "token"}}`},
+		{name: "no token url", data: `{"audience": "//iam.googleapis.com/pool", "credential_source": {"file": "token"}}`},
+		{name: "no credential source", data: `{"audience": "//iam.googleapis.com/pool", "token_url": "https://sts.googleapis.com/v1/token"}`},
+		{name: "file and url", data: `{"audience": "//iam.googleapis.com/pool", "token_url": "https://sts.googleapis.com/v1/token", "credential_source": {"file": "token", "url": "http://localhost"}}`},
+		{name: "json format without field", data: `{"audience": "//iam.googleapis.com/pool", "token_url": "https://sts.googleapis.com/v1/token", "credential_source": {"file": "token", "format": {"type": "json"}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			_, err := credentials.ExternalAccountTokenSource(context.Background(), []byte(test.data), nil)
+			assert.NotNil(tt, err)
+		})
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	external := filepath.Join(dir, "external.json")
+	assert.Nil(t, ioutil.WriteFile(external, []byte(`{"type": "external_account", "audience": "//iam.googleapis.com/pool", "token_url": "https://sts.googleapis.com/v1/token", "credential_source": {"file": "token"}}`), 0600))
+	_, err = credentials.TokenSource(context.Background(), external, scope)
+	assert.Nil(t, err)
+	assert.True(t, credentials.IsExternalAccount(external))
+
+	user := filepath.Join(dir, "user.json")
+	assert.Nil(t, ioutil.WriteFile(user, []byte(`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`), 0600))
+	_, err = credentials.TokenSource(context.Background(), user, scope)
+	assert.Nil(t, err)
+	assert.False(t, credentials.IsExternalAccount(user))
+
+	_, err = credentials.TokenSource(context.Background(), filepath.Join(dir, "missing.json"), scope)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,128 @@
+// Package custommetrics writes the state of the rollouts to Cloud Monitoring
+// as custom metrics, so the progress of the candidates can be charted next to
+// the metrics of the services, and stuck rollouts alerted on.
+package custommetrics
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/pkg/errors"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+// Custom metrics written for every rollout cycle with a candidate.
+const (
+	// CandidatePercentMetric is the percent of the traffic of the candidate
+	// after the cycle.
+	CandidatePercentMetric = "custom.googleapis.com/rollout/candidate_percent"
+
+	// DiagnosisMetric is the diagnosis of the candidate: 1 if healthy, 0 if
+	// inconclusive and -1 if unhealthy. It is only written for the cycles that
+	// diagnosed the candidate.
+	DiagnosisMetric = "custom.googleapis.com/rollout/diagnosis"
+
+	// RollbacksMetric is the number of rollbacks of the service since the
+	// operator started.
+	RollbacksMetric = "custom.googleapis.com/rollout/rollbacks_total"
+)
+
+// diagnosisValues are the values of DiagnosisMetric, by status of the
+// health report.
+var diagnosisValues = map[string]int64{
+	"healthy":      1,
+	"inconclusive": 0,
+	"unhealthy":    -1,
+}
+
+// Writer writes the custom metrics of the rollout cycles to the projects of
+// the services.
+type Writer struct {
+	service *monitoring.Service
+	start   time.Time
+
+	mu        sync.Mutex
+	rollbacks map[string]int64
+}
+
+// NewWriter initializes a writer of custom metrics.
+func NewWriter(ctx context.Context, opts ...option.ClientOption) (*Writer, error) {
+	service, err := monitoring.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Monitoring client")
+	}
+	return &Writer{service: service, start: time.Now(), rollbacks: make(map[string]int64)}, nil
+}
+
+// Write writes the custom metrics of the rollout cycle, labeled with the
+// service, its region and the candidate revision. Cycles without candidate
+// are ignored.
+func (w *Writer) Write(ctx context.Context, record archive.Record) error {
+	if record.Candidate == "" {
+		return nil
+	}
+	series := w.timeSeries(record)
+	req := &monitoring.CreateTimeSeriesRequest{TimeSeries: series}
+	_, err := w.service.Projects.TimeSeries.Create("projects/"+record.Project, req).Context(ctx).Do()
+	return errors.Wrapf(err, "failed to write custom metrics to project %s", record.Project)
+}
+
+// timeSeries returns the points of the custom metrics of the record.
+func (w *Writer) timeSeries(record archive.Record) []*monitoring.TimeSeries {
+	w.mu.Lock()
+	key := path.Join(record.Project, record.Region, record.Namespace, record.Service)
+	if record.Decision == archive.RollbackDecision {
+		w.rollbacks[key]++
+	}
+	rollbacks := w.rollbacks[key]
+	w.mu.Unlock()
+
+	end := record.Time.UTC().Format(time.RFC3339Nano)
+	resource := &monitoring.MonitoredResource{
+		Type:   "global",
+		Labels: map[string]string{"project_id": record.Project},
+	}
+	serviceLabels := map[string]string{"service": record.Service, "region": record.Region}
+	if record.Namespace != "" {
+		serviceLabels["namespace"] = record.Namespace
+	}
+	revisionLabels := map[string]string{"revision": record.Candidate}
+	for key, value := range serviceLabels {
+		revisionLabels[key] = value
+	}
+
+	gauge := func(metric string, value int64) *monitoring.TimeSeries {
+		return &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: metric, Labels: revisionLabels},
+			Resource:   resource,
+			MetricKind: "GAUGE",
+			ValueType:  "INT64",
+			Points: []*monitoring.Point{{
+				Interval: &monitoring.TimeInterval{EndTime: end},
+				Value:    &monitoring.TypedValue{Int64Value: &value},
+			}},
+		}
+	}
+
+	series := []*monitoring.TimeSeries{gauge(CandidatePercentMetric, record.CandidatePercent)}
+	if record.Report != nil {
+		if value, ok := diagnosisValues[record.Report.Status]; ok {
+			series = append(series, gauge(DiagnosisMetric, value))
+		}
+	}
+	series = append(series, &monitoring.TimeSeries{
+		Metric:     &monitoring.Metric{Type: RollbacksMetric, Labels: serviceLabels},
+		Resource:   resource,
+		MetricKind: "CUMULATIVE",
+		ValueType:  "INT64",
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{StartTime: w.start.UTC().Format(time.RFC3339Nano), EndTime: end},
+			Value:    &monitoring.TypedValue{Int64Value: &rollbacks},
+		}},
+	})
+	return series
+}
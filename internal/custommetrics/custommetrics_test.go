@@ -0,0 +1,86 @@
+package custommetrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/custommetrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/stretchr/testify/assert"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+func TestWriter_Write(t *testing.T) {
+	var paths []string
+	var requests []monitoring.CreateTimeSeriesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req monitoring.CreateTimeSeriesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		paths = append(paths, r.URL.Path)
+		requests = append(requests, req)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	writer, err := custommetrics.NewWriter(context.TODO(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	record := archive.Record{
+		Time:             time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC),
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 50,
+		Decision:         archive.RollForwardDecision,
+		Report:           &health.Report{Status: "healthy"},
+	}
+	assert.Nil(t, writer.Write(context.TODO(), record))
+
+	record.Decision, record.CandidatePercent, record.Report = archive.RollbackDecision, 0, &health.Report{Status: "unhealthy"}
+	assert.Nil(t, writer.Write(context.TODO(), record))
+
+	// Cycles without candidate are not written.
+	assert.Nil(t, writer.Write(context.TODO(), archive.Record{Project: "myproject", Service: "mysvc", Decision: archive.NoCandidateDecision}))
+
+	if !assert.Len(t, requests, 2) {
+		return
+	}
+	assert.Equal(t, "/v3/projects/myproject/timeSeries", paths[0])
+
+	values := func(req monitoring.CreateTimeSeriesRequest) map[string]int64 {
+		values := make(map[string]int64)
+		for _, series := range req.TimeSeries {
+			values[series.Metric.Type] = *series.Points[0].Value.Int64Value
+		}
+		return values
+	}
+	assert.Equal(t, map[string]int64{
+		custommetrics.CandidatePercentMetric: 50,
+		custommetrics.DiagnosisMetric:        1,
+		custommetrics.RollbacksMetric:        0,
+	}, values(requests[0]))
+	assert.Equal(t, map[string]int64{
+		custommetrics.CandidatePercentMetric: 0,
+		custommetrics.DiagnosisMetric:        -1,
+		custommetrics.RollbacksMetric:        1,
+	}, values(requests[1]))
+
+	series := requests[0].TimeSeries[0]
+	assert.Equal(t, map[string]string{"service": "mysvc", "region": "us-east1", "revision": "mysvc-002"}, series.Metric.Labels)
+	assert.Equal(t, "global", series.Resource.Type)
+	assert.Equal(t, "myproject", series.Resource.Labels["project_id"])
+	assert.Equal(t, "2020-06-01T10:00:00Z", series.Points[0].Interval.EndTime)
+
+	rollbacks := requests[1].TimeSeries[2]
+	assert.Equal(t, "CUMULATIVE", rollbacks.MetricKind)
+	assert.Equal(t, map[string]string{"service": "mysvc", "region": "us-east1"}, rollbacks.Metric.Labels)
+	assert.NotEmpty(t, rollbacks.Points[0].Interval.StartTime)
+}
@@ -0,0 +1,54 @@
+// Package drain tracks the work in progress, so it can complete before the
+// operator exits instead of leaving a service half-updated.
+package drain
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker counts the work in progress, e.g. the rollout cycles. Once it is
+// draining, no new work can begin. The zero value is ready to use.
+type Tracker struct {
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// Begin records the start of some work. It returns false if the tracker is
+// draining, in which case the work must not start.
+func (t *Tracker) Begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+// End records the end of some work.
+func (t *Tracker) End() {
+	t.wg.Done()
+}
+
+// Drain prevents new work from beginning and waits for the work in progress
+// to end, until the deadline. It returns false if the deadline was reached
+// first.
+func (t *Tracker) Drain(deadline time.Time) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
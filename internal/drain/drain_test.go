@@ -0,0 +1,45 @@
+package drain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/drain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	var tracker drain.Tracker
+	assert.True(t, tracker.Begin())
+	ended := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(ended)
+		tracker.End()
+	}()
+
+	assert.True(t, tracker.Drain(time.Now().Add(time.Minute)))
+	select {
+	case <-ended:
+	default:
+		t.Error("drain returned before the work in progress ended")
+	}
+	assert.False(t, tracker.Begin(), "work began while draining")
+}
+
+func TestTracker_Deadline(t *testing.T) {
+	var tracker drain.Tracker
+	assert.True(t, tracker.Begin())
+	defer tracker.End()
+
+	start := time.Now()
+	assert.False(t, tracker.Drain(start.Add(20*time.Millisecond)))
+	assert.True(t, time.Since(start) < time.Minute)
+}
+
+func TestTracker_Idle(t *testing.T) {
+	var tracker drain.Tracker
+	assert.True(t, tracker.Begin())
+	tracker.End()
+	assert.True(t, tracker.Drain(time.Now().Add(time.Minute)))
+}
@@ -0,0 +1,101 @@
+// Package event extracts the Cloud Run service changed by an operation from
+// its Cloud Audit Logs entry, delivered by Eventarc or by a Pub/Sub push
+// subscription of a log sink.
+package event
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// serviceMethods are the suffixes of the audit logged methods that can
+// create a revision of a service, in the v1 and v2 Cloud Run Admin APIs.
+var serviceMethods = []string{
+	"Services.CreateService",
+	"Services.ReplaceService",
+	"Services.UpdateService",
+}
+
+// ServiceChange identifies a service changed by an operation.
+type ServiceChange struct {
+	Project string
+	Region  string
+	Service string
+	Method  string
+}
+
+// logEntry is the subset of a Cloud Audit Logs entry used by the operator.
+type logEntry struct {
+	ProtoPayload struct {
+		MethodName   string `json:"methodName"`
+		ResourceName string `json:"resourceName"`
+	} `json:"protoPayload"`
+	Resource struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+}
+
+// pushEnvelope is the body of the requests of a Pub/Sub push subscription.
+type pushEnvelope struct {
+	Message *struct {
+		Data []byte `json:"data"`
+	} `json:"message"`
+}
+
+// Parse returns the service changed by the operation of the log entry in the
+// body. The body is either the entry itself, as delivered by Eventarc, or a
+// Pub/Sub push message with the entry as data. Nil is returned if the entry
+// is not about an operation that can create a revision of a service.
+func Parse(body []byte) (*ServiceChange, error) {
+	var envelope pushEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, errors.Wrap(err, "invalid event")
+	}
+	if envelope.Message != nil {
+		body = envelope.Message.Data
+	}
+	var entry logEntry
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return nil, errors.Wrap(err, "invalid audit log entry")
+	}
+
+	method := entry.ProtoPayload.MethodName
+	if !isServiceMethod(method) {
+		return nil, nil
+	}
+	labels := entry.Resource.Labels
+	change := &ServiceChange{
+		Project: labels["project_id"],
+		Region:  labels["location"],
+		Service: labels["service_name"],
+		Method:  method,
+	}
+
+	// The resource name is namespaces/PROJECT/services/SERVICE in the v1 API
+	// and projects/PROJECT/locations/REGION/services/SERVICE in the v2 API.
+	parts := strings.Split(entry.ProtoPayload.ResourceName, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "namespaces" && parts[2] == "services":
+		change.Service = parts[3]
+		if change.Project == "" {
+			change.Project = parts[1]
+		}
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "locations" && parts[4] == "services":
+		change.Project, change.Region, change.Service = parts[1], parts[3], parts[5]
+	}
+	if change.Project == "" || change.Region == "" || change.Service == "" {
+		return nil, errors.Errorf("could not determine the service of resource %q", entry.ProtoPayload.ResourceName)
+	}
+	return change, nil
+}
+
+func isServiceMethod(method string) bool {
+	for _, suffix := range serviceMethods {
+		if strings.HasSuffix(method, suffix) {
+			return true
+		}
+	}
+	return false
+}
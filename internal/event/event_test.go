@@ -0,0 +1,81 @@
+package event_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	const v1Entry = `{
+		"protoPayload": {
+			"methodName": "google.cloud.run.v1.Services.ReplaceService",
+			"resourceName": "namespaces/myproject/services/mysvc"
+		},
+		"resource": {
+			"type": "cloud_run_revision",
+			"labels": {"project_id": "myproject", "location": "us-east1", "service_name": "mysvc"}
+		}
+	}`
+	const v2Entry = `{
+		"protoPayload": {
+			"methodName": "google.cloud.run.v2.Services.UpdateService",
+			"resourceName": "projects/myproject/locations/us-east1/services/mysvc"
+		},
+		"resource": {"type": "cloud_run_revision"}
+	}`
+
+	tests := []struct {
+		name      string
+		body      string
+		expected  *event.ServiceChange
+		shouldErr bool
+	}{
+		{
+			name: "Eventarc v1",
+			body: v1Entry,
+			expected: &event.ServiceChange{Project: "myproject", Region: "us-east1", Service: "mysvc",
+				Method: "google.cloud.run.v1.Services.ReplaceService"},
+		},
+		{
+			name: "Eventarc v2",
+			body: v2Entry,
+			expected: &event.ServiceChange{Project: "myproject", Region: "us-east1", Service: "mysvc",
+				Method: "google.cloud.run.v2.Services.UpdateService"},
+		},
+		{
+			name: "Pub/Sub push",
+			body: `{"message": {"data": "` + base64.StdEncoding.EncodeToString([]byte(v1Entry)) + `"}, "subscription": "projects/myproject/subscriptions/run-audit"}`,
+			expected: &event.ServiceChange{Project: "myproject", Region: "us-east1", Service: "mysvc",
+				Method: "google.cloud.run.v1.Services.ReplaceService"},
+		},
+		{
+			name: "other method",
+			body: `{"protoPayload": {"methodName": "google.cloud.run.v1.Services.DeleteService", "resourceName": "namespaces/myproject/services/mysvc"}}`,
+		},
+		{
+			name:      "unknown service",
+			body:      `{"protoPayload": {"methodName": "google.cloud.run.v1.Services.ReplaceService", "resourceName": "namespaces/myproject/services/mysvc"}}`,
+			shouldErr: true,
+		},
+		{
+			name:      "invalid",
+			body:      `not json`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			change, err := event.Parse([]byte(test.body))
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, change)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package format prints the output of the CLI modes in the value(FIELD,...)
+// format of gcloud, so the scripts written around gcloud can parse it.
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseValue returns the fields of a value(FIELD,...) format, e.g.
+// value(service,candidatePercent). ok is false if the format is not a value
+// format.
+func ParseValue(format string) (fields []string, ok bool, err error) {
+	if !strings.HasPrefix(format, "value(") {
+		return nil, false, nil
+	}
+	if !strings.HasSuffix(format, ")") {
+		return nil, true, errors.Errorf("invalid format %q, missing closing parenthesis", format)
+	}
+	for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(format, "value("), ")"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, true, errors.Errorf("invalid format %q, empty field", format)
+		}
+		fields = append(fields, field)
+	}
+	return fields, true, nil
+}
+
+// Values prints the fields of the value, or of each element if it is a list,
+// on a line, separated by tabs. The fields are the names of the JSON output,
+// with dots for the nested fields (e.g. traffic.percent). The elements of a
+// list are separated by semicolons, and a missing field is empty.
+func Values(w io.Writer, v interface{}, fields []string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "could not encode output")
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return errors.Wrap(err, "could not decode output")
+	}
+	items, ok := decoded.([]interface{})
+	if !ok {
+		items = []interface{}{decoded}
+	}
+
+	for _, item := range items {
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i] = formatValue(lookup(item, strings.Split(field, ".")))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return errors.Wrap(err, "could not print output")
+		}
+	}
+	return nil
+}
+
+// lookup returns the value at the path in the decoded JSON value. The path is
+// looked up in every element of a list.
+func lookup(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return lookup(v[path[0]], path[1:])
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			if value := lookup(elem, path); value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// formatValue returns the decoded JSON value as text: lists are separated by
+// semicolons and objects are printed as key=value pairs, like gcloud.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, elem := range v {
+			values[i] = formatValue(elem)
+		}
+		return strings.Join(values, ";")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		values := make([]string, 0, len(v))
+		for key, value := range v {
+			values = append(values, key+"="+formatValue(value))
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(v)
+}
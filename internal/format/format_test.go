@@ -0,0 +1,66 @@
+package format_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/format"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		expected  []string
+		isValue   bool
+		shouldErr bool
+	}{
+		{name: "json", format: "json"},
+		{name: "fields", format: "value(service, candidatePercent)", expected: []string{"service", "candidatePercent"}, isValue: true},
+		{name: "nested field", format: "value(before.percent)", expected: []string{"before.percent"}, isValue: true},
+		{name: "missing parenthesis", format: "value(service", isValue: true, shouldErr: true},
+		{name: "empty field", format: "value(service,)", isValue: true, shouldErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, ok, err := format.ParseValue(test.format)
+			if test.shouldErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.isValue, ok)
+			assert.Equal(t, test.expected, fields)
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	type target struct {
+		Revision string `json:"revision"`
+		Percent  int64  `json:"percent"`
+	}
+	type status struct {
+		Service   string            `json:"service"`
+		Percent   int64             `json:"percent"`
+		Ratio     float64           `json:"ratio"`
+		Candidate string            `json:"candidate,omitempty"`
+		Traffic   []target          `json:"traffic"`
+		Labels    map[string]string `json:"labels"`
+	}
+	statuses := []status{
+		{Service: "checkout", Percent: 20, Ratio: 0.25, Candidate: "checkout-002",
+			Traffic: []target{{"checkout-001", 80}, {"checkout-002", 20}}, Labels: map[string]string{"team": "a", "env": "prod"}},
+		{Service: "frontend", Traffic: []target{{"frontend-001", 100}}},
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, format.Values(&b, statuses, []string{"service", "percent", "ratio", "candidate", "traffic.revision", "labels", "unknown"}))
+	assert.Equal(t, "checkout\t20\t0.25\tcheckout-002\tcheckout-001;checkout-002\tenv=prod,team=a\t\n"+
+		"frontend\t0\t0\t\tfrontend-001\t\t\n", b.String())
+
+	b.Reset()
+	assert.Nil(t, format.Values(&b, statuses[0], []string{"service"}))
+	assert.Equal(t, "checkout\n", b.String(), "a single value is printed on a line")
+}
@@ -0,0 +1,219 @@
+// Package httpjson provides a generic metrics provider implementation that
+// sends a configurable HTTP request per metrics and extracts a scalar from the
+// JSON response, so any metrics backend with a query API (e.g. Grafana or
+// Mimir) can be used.
+//
+// The URL and header values are Go templates that receive the following
+// fields:
+//
+//	.Project, .Region, .Service, .Revision
+//	.Window          the offset as a duration string (e.g. 30m0s)
+//	.WindowSeconds   the offset in seconds
+//	.Start, .End     the interval as Unix timestamps
+//	.Percentile      the latency percentile (e.g. 99), only for latency
+//
+// The scalar is extracted with a JSONPath expression (e.g. $.data.value) that
+// supports fields and array indexes.
+package httpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+)
+
+// Query is the configuration of the request for a metrics.
+type Query struct {
+	URL      string
+	JSONPath string
+}
+
+// Queries holds the queries for each metrics. A query with an empty URL is not
+// configured, and using its metrics results in an error.
+type Queries struct {
+	RequestCount Query
+	ErrorRate    Query
+	Latency      Query
+}
+
+// queryData is the data passed to the templates.
+type queryData struct {
+	Project       string
+	Region        string
+	Service       string
+	Revision      string
+	Window        string
+	WindowSeconds int64
+	Start         int64
+	End           int64
+	Percentile    float64
+}
+
+// compiledQuery is a query with its parsed templates and path.
+type compiledQuery struct {
+	url  *template.Template
+	path []pathElement
+}
+
+// Provider is a generic metrics provider for HTTP JSON APIs.
+type Provider struct {
+	client   *http.Client
+	headers  map[string]*template.Template
+	project  string
+	region   string
+	service  string
+	revision string
+
+	requestCount *compiledQuery
+	errorRate    *compiledQuery
+	latency      *compiledQuery
+}
+
+// NewProvider initializes the generic HTTP JSON provider. The headers (e.g. an
+// Authorization header) are sent with every request.
+func NewProvider(client *http.Client, queries Queries, headers map[string]string, project, region, serviceName string) (*Provider, error) {
+	p := &Provider{
+		client:  client,
+		headers: make(map[string]*template.Template),
+		project: project,
+		region:  region,
+		service: serviceName,
+	}
+
+	var err error
+	if p.requestCount, err = compileQuery("request-count", queries.RequestCount); err != nil {
+		return nil, errors.Wrap(err, "invalid request count query")
+	}
+	if p.errorRate, err = compileQuery("error-rate", queries.ErrorRate); err != nil {
+		return nil, errors.Wrap(err, "invalid error rate query")
+	}
+	if p.latency, err = compileQuery("latency", queries.Latency); err != nil {
+		return nil, errors.Wrap(err, "invalid latency query")
+	}
+	if p.requestCount == nil && p.errorRate == nil && p.latency == nil {
+		return nil, errors.New("at least one query must be configured")
+	}
+
+	for key, value := range headers {
+		tmpl, err := template.New(key).Parse(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse header %q", key)
+		}
+		p.headers[key] = tmpl
+	}
+	return p, nil
+}
+
+func compileQuery(name string, query Query) (*compiledQuery, error) {
+	if query.URL == "" {
+		return nil, nil
+	}
+	url, err := template.New(name).Parse(query.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse URL template")
+	}
+	path, err := parsePath(query.JSONPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSONPath")
+	}
+	return &compiledQuery{url: url, path: path}, nil
+}
+
+// SetCandidateRevision sets the candidate revision name for which the provider
+// should get metrics.
+func (p *Provider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+}
+
+// RequestCount returns the number of requests for the given offset.
+func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	value, err := p.query(ctx, p.requestCount, p.data(offset, 0))
+	return int64(value), errors.Wrap(err, "failed to query request count")
+}
+
+// Latency returns the latency for the given offset, in milliseconds.
+func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	var percentile float64
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		percentile = 99
+	case metrics.Align95Reduce95:
+		percentile = 95
+	case metrics.Align50Reduce50:
+		percentile = 50
+	default:
+		return 0, errors.Errorf("unsupported align reduce type %v", alignReduceType)
+	}
+
+	value, err := p.query(ctx, p.latency, p.data(offset, percentile))
+	return value, errors.Wrap(err, "failed to query latency")
+}
+
+// ErrorRate returns the rate of errors for the given offset.
+func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	value, err := p.query(ctx, p.errorRate, p.data(offset, 0))
+	return value, errors.Wrap(err, "failed to query error rate")
+}
+
+func (p *Provider) data(offset time.Duration, percentile float64) queryData {
+	end := time.Now()
+	return queryData{
+		Project:       p.project,
+		Region:        p.region,
+		Service:       p.service,
+		Revision:      p.revision,
+		Window:        offset.String(),
+		WindowSeconds: int64(offset.Seconds()),
+		Start:         end.Add(-offset).Unix(),
+		End:           end.Unix(),
+		Percentile:    percentile,
+	}
+}
+
+// query sends the request for the query and extracts the scalar from the
+// response.
+func (p *Provider) query(ctx context.Context, query *compiledQuery, data queryData) (float64, error) {
+	if query == nil {
+		return 0, errors.New("no query configured for the metrics")
+	}
+
+	var url bytes.Buffer
+	if err := query.url.Execute(&url, data); err != nil {
+		return 0, errors.Wrap(err, "failed to execute URL template")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+	for key, tmpl := range p.headers {
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil {
+			return 0, errors.Wrapf(err, "failed to execute header %q template", key)
+		}
+		req.Header.Set(key, value.String())
+	}
+
+	util.LoggerFrom(ctx).WithField("host", req.URL.Host).Debug("querying metrics HTTP API")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var doc interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return 0, errors.Wrap(err, "failed to decode response")
+	}
+	metrics.RecordQuery(ctx, metrics.Query{Query: url.String(), Start: time.Unix(data.Start, 0), End: time.Unix(data.End, 0)})
+	return extractScalar(doc, query.path)
+}
@@ -0,0 +1,114 @@
+package httpjson_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/httpjson"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-002", r.Header.Get("Authorization"))
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/count":
+			assert.Equal(t, "mysvc", query.Get("service"))
+			assert.Equal(t, "1800", query.Get("window"))
+			fmt.Fprint(w, `{"data":{"result":[{"value":[1596000000,"1500"]}]}}`)
+		case "/errors":
+			fmt.Fprint(w, `{"rate":0.02}`)
+		case "/latency":
+			if query.Get("p") == "99" {
+				fmt.Fprint(w, `{"latency":{"p99":"not a number"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"latency":{"p50":250.5}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	queries := httpjson.Queries{
+		RequestCount: httpjson.Query{
+			URL:      server.URL + "/count?service={{.Service}}&window={{.WindowSeconds}}",
+			JSONPath: "$.data.result[0].value[1]",
+		},
+		ErrorRate: httpjson.Query{URL: server.URL + "/errors?rev={{.Revision}}", JSONPath: "$.rate"},
+		Latency:   httpjson.Query{URL: server.URL + "/latency?p={{.Percentile}}", JSONPath: "$.latency.p50"},
+	}
+	headers := map[string]string{"Authorization": "Bearer {{.Revision}}"}
+	provider, err := httpjson.NewProvider(server.Client(), queries, headers, "myproject", "us-east1", "mysvc")
+	assert.Nil(t, err)
+	provider.SetCandidateRevision("test-002")
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	offset := 30 * time.Minute
+
+	count, err := provider.RequestCount(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), count)
+
+	rate, err := provider.ErrorRate(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.02, rate)
+
+	latency, err := provider.Latency(ctx, offset, metrics.Align50Reduce50)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.5, latency)
+
+	_, err = provider.Latency(ctx, offset, metrics.Align99Reduce99)
+	assert.NotNil(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		queries   httpjson.Queries
+		shouldErr bool
+	}{
+		{
+			name:    "only one query",
+			queries: httpjson.Queries{ErrorRate: httpjson.Query{URL: "http://metrics/{{.Service}}", JSONPath: "$.values[2].rate"}},
+		},
+		{
+			name:      "no queries",
+			shouldErr: true,
+		},
+		{
+			name:      "invalid URL template",
+			queries:   httpjson.Queries{ErrorRate: httpjson.Query{URL: "http://metrics/{{.Service", JSONPath: "$.rate"}},
+			shouldErr: true,
+		},
+		{
+			name:      "path without root",
+			queries:   httpjson.Queries{ErrorRate: httpjson.Query{URL: "http://metrics", JSONPath: "rate"}},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid array index",
+			queries:   httpjson.Queries{ErrorRate: httpjson.Query{URL: "http://metrics", JSONPath: "$.values[x]"}},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			_, err := httpjson.NewProvider(http.DefaultClient, test.queries, nil, "myproject", "us-east1", "mysvc")
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
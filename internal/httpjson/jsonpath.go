@@ -0,0 +1,97 @@
+package httpjson
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pathElement is either a field name or an array index.
+type pathElement struct {
+	field   string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses a simple JSONPath expression such as
+// $.data.result[0].value[1].
+//
+// Only the root ($), dot-notation fields and array indexes are supported.
+func parsePath(path string) ([]pathElement, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.Errorf("path must start with $, got %q", path)
+	}
+	rest := path[1:]
+
+	var elements []pathElement
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			field := rest[:end]
+			if field == "" {
+				return nil, errors.Errorf("empty field name in path %q", path)
+			}
+			elements = append(elements, pathElement{field: field})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, errors.Errorf("unclosed bracket in path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, errors.Errorf("invalid array index %q in path %q", rest[1:end], path)
+			}
+			elements = append(elements, pathElement{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, errors.Errorf("unexpected character %q in path %q", rest[0], path)
+		}
+	}
+	return elements, nil
+}
+
+// extractScalar returns the number found at the path in the decoded JSON
+// document. Numeric strings are also accepted.
+func extractScalar(doc interface{}, path []pathElement) (float64, error) {
+	current := doc
+	for _, element := range path {
+		if element.isIndex {
+			array, ok := current.([]interface{})
+			if !ok {
+				return 0, errors.Errorf("cannot index %T with [%d]", current, element.index)
+			}
+			if element.index >= len(array) {
+				return 0, errors.Errorf("index %d out of range, length is %d", element.index, len(array))
+			}
+			current = array[element.index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return 0, errors.Errorf("cannot get field %q of %T", element.field, current)
+		}
+		value, ok := object[element.field]
+		if !ok {
+			return 0, errors.Errorf("field %q not found", element.field)
+		}
+		current = value
+	}
+
+	switch value := current.(type) {
+	case float64:
+		return value, nil
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, errors.Wrapf(err, "failed to parse %q as number", value)
+	default:
+		return 0, errors.Errorf("value must be a number or a numeric string, got %T", current)
+	}
+}
@@ -0,0 +1,42 @@
+package httpjson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractScalar(t *testing.T) {
+	doc := `{"data":{"result":[{"value":[1596000000,"12.5"]}],"count":3,"name":"svc"}}`
+	tests := []struct {
+		path      string
+		expected  float64
+		shouldErr bool
+	}{
+		{path: "$.data.result[0].value[1]", expected: 12.5},
+		{path: "$.data.count", expected: 3},
+		{path: "$.data.result[0].value[0]", expected: 1596000000},
+		{path: "$.data.name", shouldErr: true},
+		{path: "$.data.result[1]", shouldErr: true},
+		{path: "$.data.missing", shouldErr: true},
+		{path: "$.data[0]", shouldErr: true},
+		{path: "$.data", shouldErr: true},
+	}
+
+	var decoded interface{}
+	assert.Nil(t, json.Unmarshal([]byte(doc), &decoded))
+	for _, test := range tests {
+		t.Run(test.path, func(tt *testing.T) {
+			path, err := parsePath(test.path)
+			assert.Nil(tt, err)
+			value, err := extractScalar(decoded, path)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+				assert.Equal(tt, test.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package image reads the metadata of the container images of the
+// candidates, from the OCI labels set when they are built, so the rollouts
+// can link back to the commit and the build of each candidate.
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Labels of the images the metadata is read from, as defined by the OCI image
+// specification.
+const (
+	RevisionLabel = "org.opencontainers.image.revision"
+	SourceLabel   = "org.opencontainers.image.source"
+	URLLabel      = "org.opencontainers.image.url"
+)
+
+// Metadata is the metadata of a container image.
+type Metadata struct {
+	// Image is the name of the image (without tag or digest) and Digest its
+	// digest, e.g. sha256:...
+	Image  string
+	Digest string
+
+	// CommitSHA is the commit the image was built from (RevisionLabel),
+	// Source its repository (SourceLabel) and BuildURL the link to its build
+	// (URLLabel), if set.
+	CommitSHA string
+	Source    string
+	BuildURL  string
+
+	Labels map[string]string
+}
+
+// Reference returns the image pinned to its digest, e.g.
+// us-docker.pkg.dev/myproject/myrepo/app@sha256:...
+func (m Metadata) Reference() string {
+	return m.Image + "@" + m.Digest
+}
+
+// Inspector represents a client that reads the metadata of container images.
+type Inspector interface {
+	// Inspect returns the metadata of the image. The digest, if known (e.g.
+	// from the revision), takes precedence over the tag of the image.
+	Inspect(ctx context.Context, image, digest string) (*Metadata, error)
+}
+
+// Media types of the manifests.
+const (
+	ociIndexType              = "application/vnd.oci.image.index.v1+json"
+	ociManifestType           = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestListType    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifestType        = "application/vnd.docker.distribution.manifest.v2+json"
+	acceptedManifestTypes     = ociIndexType + ", " + ociManifestType + ", " + dockerManifestListType + ", " + dockerManifestType
+	dockerContentDigestHeader = "Docker-Content-Digest"
+)
+
+// RegistryInspector reads the metadata of the images with the Docker Registry
+// HTTP API V2, as implemented by Artifact Registry and Container Registry.
+type RegistryInspector struct {
+	client *http.Client
+
+	// scheme is the scheme of the registry URLs, only changed in tests.
+	scheme string
+}
+
+// NewRegistryInspector initializes an inspector with an HTTP client that
+// authenticates with the options.
+func NewRegistryInspector(ctx context.Context, opts ...option.ClientOption) (*RegistryInspector, error) {
+	opts = append([]option.ClientOption{option.WithScopes("https://www.googleapis.com/auth/cloud-platform")}, opts...)
+	client, _, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the registry")
+	}
+	return NewRegistryInspectorWithClient(client, "https"), nil
+}
+
+// NewRegistryInspectorWithClient initializes an inspector with the HTTP client,
+// for the registries at the scheme (http or https).
+func NewRegistryInspectorWithClient(client *http.Client, scheme string) *RegistryInspector {
+	return &RegistryInspector{client: client, scheme: scheme}
+}
+
+// manifest is the subset of an image manifest or index used by the
+// inspector.
+type manifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Inspect reads the manifest of the image, then its configuration, which holds
+// the labels. For an index of images for several platforms, the image for
+// linux/amd64 is used, the platform of Cloud Run.
+func (i *RegistryInspector) Inspect(ctx context.Context, image, digest string) (*Metadata, error) {
+	registry, repository, reference, err := parseImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if digest != "" {
+		reference = digest
+	}
+	base := fmt.Sprintf("%s://%s/v2/%s", i.scheme, registry, repository)
+
+	var m manifest
+	header, err := i.get(ctx, base+"/manifests/"+reference, acceptedManifestTypes, &m)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get manifest of image %s", image)
+	}
+	if digest == "" {
+		digest = header.Get(dockerContentDigestHeader)
+	}
+	if len(m.Manifests) != 0 {
+		platform := m.Manifests[0].Digest
+		for _, entry := range m.Manifests {
+			if entry.Platform.OS == "linux" && entry.Platform.Architecture == "amd64" {
+				platform = entry.Digest
+				break
+			}
+		}
+		if _, err := i.get(ctx, base+"/manifests/"+platform, acceptedManifestTypes, &m); err != nil {
+			return nil, errors.Wrapf(err, "failed to get manifest of image %s for linux/amd64", image)
+		}
+	}
+	if m.Config.Digest == "" {
+		return nil, errors.Errorf("manifest of image %s has no configuration", image)
+	}
+
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if _, err := i.get(ctx, base+"/blobs/"+m.Config.Digest, "", &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to get configuration of image %s", image)
+	}
+	labels := config.Config.Labels
+	return &Metadata{
+		Image:     registry + "/" + repository,
+		Digest:    digest,
+		CommitSHA: labels[RevisionLabel],
+		Source:    labels[SourceLabel],
+		BuildURL:  labels[URLLabel],
+		Labels:    labels,
+	}, nil
+}
+
+// get decodes the JSON response to the GET request, and returns its headers.
+func (i *RegistryInspector) get(ctx context.Context, url, accept string, v interface{}) (http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := i.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.Header, errors.Wrap(json.Unmarshal(body, v), "failed to decode response")
+}
+
+// parseImage splits the image into its registry, repository and reference
+// (tag or digest, latest if none), e.g. us-docker.pkg.dev,
+// myproject/myrepo/app and v1 for us-docker.pkg.dev/myproject/myrepo/app:v1.
+func parseImage(image string) (registry, repository, reference string, err error) {
+	slash := strings.Index(image, "/")
+	if slash == -1 || !strings.ContainsAny(image[:slash], ".:") {
+		return "", "", "", errors.Errorf("image %q has no registry", image)
+	}
+	registry, repository, reference = image[:slash], image[slash+1:], "latest"
+	if at := strings.Index(repository, "@"); at != -1 {
+		repository, reference = repository[:at], repository[at+1:]
+	} else if colon := strings.LastIndex(repository, ":"); colon != -1 {
+		repository, reference = repository[:colon], repository[colon+1:]
+	}
+	if repository == "" || reference == "" {
+		return "", "", "", errors.Errorf("invalid image %q", image)
+	}
+	return registry, repository, reference, nil
+}
@@ -0,0 +1,63 @@
+package image_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRegistry(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myproject/myrepo/app/manifests/v1":
+			assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json")
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			w.Write([]byte(`{"manifests": [
+				{"digest": "sha256:arm", "platform": {"os": "linux", "architecture": "arm64"}},
+				{"digest": "sha256:amd", "platform": {"os": "linux", "architecture": "amd64"}}
+			]}`))
+		case "/v2/myproject/myrepo/app/manifests/sha256:amd", "/v2/myproject/myrepo/app/manifests/sha256:pinned":
+			w.Write([]byte(`{"config": {"digest": "sha256:config"}}`))
+		case "/v2/myproject/myrepo/app/blobs/sha256:config":
+			w.Write([]byte(`{"config": {"Labels": {
+				"org.opencontainers.image.revision": "abc123",
+				"org.opencontainers.image.url": "https://console.cloud.google.com/cloud-build/builds/42"
+			}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestRegistryInspector_Inspect(t *testing.T) {
+	server := newRegistry(t)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	inspector := image.NewRegistryInspectorWithClient(server.Client(), "http")
+
+	metadata, err := inspector.Inspect(context.TODO(), host+"/myproject/myrepo/app:v1", "")
+	assert.Nil(t, err)
+	if assert.NotNil(t, metadata) {
+		assert.Equal(t, host+"/myproject/myrepo/app@sha256:index", metadata.Reference())
+		assert.Equal(t, "abc123", metadata.CommitSHA, "the labels of the linux/amd64 image must be read")
+		assert.Equal(t, "https://console.cloud.google.com/cloud-build/builds/42", metadata.BuildURL)
+		assert.Empty(t, metadata.Source)
+	}
+
+	metadata, err = inspector.Inspect(context.TODO(), host+"/myproject/myrepo/app:v2", "sha256:pinned")
+	assert.Nil(t, err, "the digest must take precedence over the tag")
+	if assert.NotNil(t, metadata) {
+		assert.Equal(t, "sha256:pinned", metadata.Digest)
+	}
+
+	_, err = inspector.Inspect(context.TODO(), host+"/myproject/myrepo/other", "")
+	assert.NotNil(t, err)
+
+	_, err = inspector.Inspect(context.TODO(), "nginx", "")
+	assert.Contains(t, err.Error(), "has no registry")
+}
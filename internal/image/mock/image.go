@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+)
+
+// Inspector is a mock implementation of image.Inspector.
+type Inspector struct {
+	InspectFn      func(ctx context.Context, image, digest string) (*image.Metadata, error)
+	InspectInvoked bool
+}
+
+// Inspect invokes the mock implementation and marks the function as invoked.
+func (i *Inspector) Inspect(ctx context.Context, image, digest string) (*image.Metadata, error) {
+	i.InspectInvoked = true
+	return i.InspectFn(ctx, image, digest)
+}
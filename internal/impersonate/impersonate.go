@@ -0,0 +1,59 @@
+// Package impersonate gets the access tokens of a service account impersonated
+// by the operator with the IAM Service Account Credentials API, so the
+// operator's own identity only needs the Service Account Token Creator role on
+// it instead of access to every project.
+package impersonate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// tokenLifetime is the lifetime of the access tokens, the longest allowed by
+// default.
+const tokenLifetime = time.Hour
+
+// tokenSource gets the access tokens of a service account.
+type tokenSource struct {
+	ctx     context.Context
+	service *iamcredentials.Service
+	name    string
+	scopes  []string
+}
+
+// TokenSource returns a token source of access tokens with the scopes for the
+// service account (its email). The tokens are reused until they expire.
+func TokenSource(ctx context.Context, serviceAccount string, scopes []string, opts ...option.ClientOption) (oauth2.TokenSource, error) {
+	service, err := iamcredentials.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the IAM Service Account Credentials API")
+	}
+	return oauth2.ReuseTokenSource(nil, &tokenSource{
+		ctx:     ctx,
+		service: service,
+		name:    "projects/-/serviceAccounts/" + serviceAccount,
+		scopes:  scopes,
+	}), nil
+}
+
+// Token implements oauth2.TokenSource.
+func (ts *tokenSource) Token() (*oauth2.Token, error) {
+	resp, err := ts.service.Projects.ServiceAccounts.GenerateAccessToken(ts.name, &iamcredentials.GenerateAccessTokenRequest{
+		Scope:    ts.scopes,
+		Lifetime: fmt.Sprintf("%ds", int(tokenLifetime.Seconds())),
+	}).Context(ts.ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get an access token of %s", ts.name)
+	}
+	expiry, err := time.Parse(time.RFC3339, resp.ExpireTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid expiration time of access token")
+	}
+	return &oauth2.Token{AccessToken: resp.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
@@ -0,0 +1,53 @@
+package impersonate_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/impersonate"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/-/serviceAccounts/operator@myproject.iam.gserviceaccount.com:generateAccessToken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(map[string]string{"accessToken": "token", "expireTime": expiry.Format(time.RFC3339)})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := []option.ClientOption{option.WithEndpoint(server.URL + "/"), option.WithoutAuthentication()}
+	ts, err := impersonate.TokenSource(ctx, "operator@myproject.iam.gserviceaccount.com", []string{"https://www.googleapis.com/auth/cloud-platform"}, opts...)
+	assert.Nil(t, err)
+
+	token, err := ts.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.True(t, expiry.Equal(token.Expiry))
+
+	// The token is reused until it expires.
+	_, err = ts.Token()
+	assert.Nil(t, err)
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, "3600s", requests[0]["lifetime"])
+		assert.Equal(t, []interface{}{"https://www.googleapis.com/auth/cloud-platform"}, requests[0]["scope"])
+	}
+
+	ts, err = impersonate.TokenSource(ctx, "other@myproject.iam.gserviceaccount.com", nil, opts...)
+	assert.Nil(t, err)
+	_, err = ts.Token()
+	assert.NotNil(t, err)
+}
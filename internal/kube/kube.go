@@ -0,0 +1,206 @@
+// Package kube is a minimal client of the Kubernetes API for the
+// RolloutStrategy custom resources and the Knative Serving resources.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// API group, version and resource of the RolloutStrategy custom resources.
+const (
+	Group    = "rollout.cloud.run"
+	Version  = "v1alpha1"
+	Resource = "rolloutstrategies"
+)
+
+// Files mounted in the pods for the service account.
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ObjectMeta is the subset of the metadata of the objects used by the
+// operator.
+type ObjectMeta struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Generation int64  `json:"generation"`
+}
+
+// RolloutStrategy is a strategy declared as a cluster resource. The spec has
+// the fields of a strategy of the configuration file.
+type RolloutStrategy struct {
+	Metadata ObjectMeta            `json:"metadata"`
+	Spec     json.RawMessage       `json:"spec"`
+	Status   RolloutStrategyStatus `json:"status"`
+}
+
+// RolloutStrategyStatus is the observed state of a RolloutStrategy.
+type RolloutStrategyStatus struct {
+	ObservedGeneration int64           `json:"observedGeneration,omitempty"`
+	Conditions         []Condition     `json:"conditions,omitempty"`
+	Services           []ServiceStatus `json:"services,omitempty"`
+}
+
+// Condition is a condition of the status, as in the Kubernetes API
+// conventions.
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// ServiceStatus is the rollout state of a service managed by the strategy.
+type ServiceStatus struct {
+	Project          string `json:"project"`
+	Region           string `json:"region"`
+	Name             string `json:"name"`
+	Phase            string `json:"phase"`
+	Stable           string `json:"stable,omitempty"`
+	Candidate        string `json:"candidate,omitempty"`
+	CandidatePercent int64  `json:"candidatePercent"`
+	LastRollout      string `json:"lastRollout,omitempty"`
+}
+
+// SetCondition adds or replaces the condition with the same type. The last
+// transition time is kept if the status of the condition did not change.
+func (s *RolloutStrategyStatus) SetCondition(condition Condition) {
+	for i, existing := range s.Conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		s.Conditions[i] = condition
+		return
+	}
+	s.Conditions = append(s.Conditions, condition)
+}
+
+// StatusError is an unsuccessful response of the API server.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.Code, e.Message)
+}
+
+// Client is a client of the Kubernetes API.
+type Client struct {
+	client    *http.Client
+	host      string
+	tokenFile string
+}
+
+// NewClient initializes a client for the API server at the URL (e.g. the
+// address of kubectl proxy). Requests are not authenticated.
+func NewClient(client *http.Client, url string) *Client {
+	return &Client{client: client, host: strings.TrimSuffix(url, "/")}
+}
+
+// NewInClusterClient initializes a client for the API server of the cluster
+// the operator runs in, authenticated as the pod's service account.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the cluster CA certificate")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("invalid cluster CA certificate in %s", serviceAccountCAFile)
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return &Client{
+		client:    client,
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountTokenFile,
+	}, nil
+}
+
+// RolloutStrategies returns the RolloutStrategy resources of all the
+// namespaces.
+func (c *Client) RolloutStrategies(ctx context.Context) ([]RolloutStrategy, error) {
+	var list struct {
+		Items []RolloutStrategy `json:"items"`
+	}
+	path := fmt.Sprintf("/apis/%s/%s/%s", Group, Version, Resource)
+	if err := c.Do(ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, errors.Wrap(err, "failed to list rollout strategies")
+	}
+	return list.Items, nil
+}
+
+// UpdateRolloutStrategyStatus replaces the status of the RolloutStrategy.
+func (c *Client) UpdateRolloutStrategyStatus(ctx context.Context, namespace, name string, status RolloutStrategyStatus) error {
+	path := fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s/%s/status", Group, Version, namespace, Resource, name)
+	patch := map[string]interface{}{"status": status}
+	err := c.Do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+	return errors.Wrapf(err, "failed to update status of rollout strategy %s/%s", namespace, name)
+}
+
+// Do sends a request to the API server with the JSON encoding of the body, if
+// not nil, and decodes the JSON response in v, if not nil.
+func (c *Client) Do(ctx context.Context, method, path, contentType string, body, v interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+	}
+	req, err := http.NewRequest(method, c.host+path, &reqBody)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.tokenFile != "" {
+		// The token is read on every request since it is rotated.
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read service account token")
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "failed to decode response")
+}
@@ -0,0 +1,116 @@
+package kube_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var patch map[string]kube.RolloutStrategyStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/rollout.cloud.run/v1alpha1/rolloutstrategies":
+			w.Write([]byte(`{"items": [{
+				"metadata": {"name": "backend", "namespace": "team-a", "generation": 2},
+				"spec": {"steps": [5, 50]}
+			}]}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/apis/rollout.cloud.run/v1alpha1/namespaces/team-a/rolloutstrategies/backend/status":
+			assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &patch))
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := kube.NewClient(server.Client(), server.URL+"/")
+	strategies, err := client.RolloutStrategies(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, strategies, 1) {
+		assert.Equal(t, kube.ObjectMeta{Name: "backend", Namespace: "team-a", Generation: 2}, strategies[0].Metadata)
+		assert.JSONEq(t, `{"steps": [5, 50]}`, string(strategies[0].Spec))
+	}
+
+	status := kube.RolloutStrategyStatus{
+		ObservedGeneration: 2,
+		Services:           []kube.ServiceStatus{{Project: "myproject", Region: "us-east1", Name: "api", Phase: "Stable"}},
+	}
+	assert.Nil(t, client.UpdateRolloutStrategyStatus(ctx, "team-a", "backend", status))
+	assert.Equal(t, status, patch["status"])
+
+	err = client.UpdateRolloutStrategyStatus(ctx, "team-a", "missing", status)
+	assert.NotNil(t, err)
+}
+
+func TestRolloutStrategyStatus_SetCondition(t *testing.T) {
+	created := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	status := kube.RolloutStrategyStatus{}
+	status.SetCondition(kube.Condition{Type: "Ready", Status: "True", LastTransitionTime: created})
+	status.SetCondition(kube.Condition{Type: "Ready", Status: "True", Message: "2 services", LastTransitionTime: created.Add(time.Hour)})
+	assert.Equal(t, []kube.Condition{{Type: "Ready", Status: "True", Message: "2 services", LastTransitionTime: created}}, status.Conditions)
+
+	status.SetCondition(kube.Condition{Type: "Ready", Status: "False", LastTransitionTime: created.Add(2 * time.Hour)})
+	assert.Equal(t, []kube.Condition{{Type: "Ready", Status: "False", LastTransitionTime: created.Add(2 * time.Hour)}}, status.Conditions)
+}
+
+func TestNewKubeconfigClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items": []}`))
+	}))
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	kubeconfig := fmt.Sprintf(`
+current-context: dev
+contexts:
+- name: dev
+  context: {cluster: dev-cluster, user: dev-user}
+- name: prod
+  context: {cluster: prod-cluster, user: dev-user}
+clusters:
+- name: dev-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: dev-user
+  user:
+    token: secret
+`, server.URL, base64.StdEncoding.EncodeToString(ca))
+	dir, err := ioutil.TempDir("", "kube")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(kubeconfig), 0600))
+
+	ctx := context.Background()
+	client, err := kube.NewKubeconfigClient(ctx, path, "")
+	assert.Nil(t, err)
+	_, err = client.RolloutStrategies(ctx)
+	assert.Nil(t, err)
+
+	_, err = kube.NewKubeconfigClient(ctx, path, "prod")
+	assert.NotNil(t, err)
+	_, err = kube.NewKubeconfigClient(ctx, path, "staging")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"gopkg.in/yaml.v3"
+)
+
+// kubeconfig is the subset of the kubeconfig file used by the operator.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string                 `yaml:"token"`
+			ClientCertificateData string                 `yaml:"client-certificate-data"`
+			ClientKeyData         string                 `yaml:"client-key-data"`
+			AuthProvider          map[string]interface{} `yaml:"auth-provider"`
+			Exec                  map[string]interface{} `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// NewKubeconfigClient initializes a client for the cluster of the context of
+// the kubeconfig file (the current context if empty).
+//
+// Users are authenticated with a static token or a client certificate. Users
+// authenticated by a plugin (e.g. gke-gcloud-auth-plugin for GKE clusters)
+// are authenticated with the Google application default credentials instead.
+func NewKubeconfigClient(ctx context.Context, path, contextName string) (*Client, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read kubeconfig")
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "invalid kubeconfig")
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	var clusterName, userName string
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("context %q not found in kubeconfig", contextName)
+	}
+
+	tlsConfig := &tls.Config{}
+	server := ""
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		server = c.Cluster.Server
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := pemData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cluster CA certificate")
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, errors.Errorf("invalid CA certificate of cluster %q", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if server == "" {
+		return nil, errors.Errorf("cluster %q not found in kubeconfig", clusterName)
+	}
+
+	var transport http.RoundTripper = &http.Transport{TLSClientConfig: tlsConfig}
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		switch {
+		case u.User.Token != "":
+			transport = &oauth2.Transport{
+				Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: u.User.Token}),
+				Base:   transport,
+			}
+		case u.User.ClientCertificateData != "":
+			cert, err := pemData(u.User.ClientCertificateData, "")
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid client certificate")
+			}
+			key, err := pemData(u.User.ClientKeyData, "")
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid client key")
+			}
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid client certificate")
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		case u.User.AuthProvider != nil || u.User.Exec != nil:
+			source, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get Google application default credentials")
+			}
+			transport = &oauth2.Transport{Source: source, Base: transport}
+		}
+	}
+
+	return &Client{
+		client: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		host:   strings.TrimSuffix(server, "/"),
+	}, nil
+}
+
+// pemData returns the base64-encoded data or, if empty, the content of the
+// file. It returns nil if both are empty.
+func pemData(data, path string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path != "" {
+		return ioutil.ReadFile(path)
+	}
+	return nil, nil
+}
@@ -0,0 +1,193 @@
+// Package loadgen generates synthetic load against a revision's tag URL.
+//
+// The result of a load run implements metrics.Provider, so the same health
+// criteria used for real traffic can be evaluated against the synthetic
+// traffic.
+package loadgen
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Generator represents a synthetic load generator.
+type Generator interface {
+	// Generate sends load to the given base URL and blocks until the load run
+	// finishes.
+	Generate(ctx context.Context, url string) (*Result, error)
+}
+
+// Sample is the outcome of a single synthetic request.
+type Sample struct {
+	Latency    time.Duration
+	StatusCode int
+
+	// Failed is true if no response was received (e.g. connection error).
+	Failed bool
+}
+
+// Result holds the samples of a load run.
+type Result struct {
+	Samples []Sample
+}
+
+// HTTPGenerator is a load generator that sends HTTP requests at a constant
+// rate.
+type HTTPGenerator struct {
+	client *http.Client
+	warmUp config.WarmUp
+}
+
+// New initializes a load generator for the warm-up configuration.
+func New(client *http.Client, warmUp config.WarmUp) *HTTPGenerator {
+	return &HTTPGenerator{
+		client: client,
+		warmUp: warmUp,
+	}
+}
+
+// Generate sends requests to the path relative to the base URL at the
+// configured rate for the configured duration.
+//
+// If the context is done before the duration elapses, the generation stops and
+// the samples collected so far are returned along with the error.
+func (g *HTTPGenerator) Generate(ctx context.Context, baseURL string) (*Result, error) {
+	url := strings.TrimSuffix(baseURL, "/") + g.warmUp.Path
+	logger := util.LoggerFrom(ctx).WithFields(logrus.Fields{
+		"url":      url,
+		"rps":      g.warmUp.RPS,
+		"duration": g.warmUp.Duration,
+	})
+	logger.Debug("generating synthetic load")
+
+	var (
+		result Result
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	ticker := time.NewTicker(time.Second / time.Duration(g.warmUp.RPS))
+	defer ticker.Stop()
+	timer := time.NewTimer(g.warmUp.Duration)
+	defer timer.Stop()
+
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			err = errors.Wrap(ctx.Err(), "load generation was interrupted")
+			break loop
+		case <-timer.C:
+			break loop
+		case <-ticker.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sample := g.send(ctx, url)
+				mu.Lock()
+				result.Samples = append(result.Samples, sample)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	logger.WithField("requests", len(result.Samples)).Debug("finished generating synthetic load")
+	return &result, err
+}
+
+// send sends a single request built from the warm-up request template.
+func (g *HTTPGenerator) send(ctx context.Context, url string) Sample {
+	var body io.Reader
+	if g.warmUp.Body != "" {
+		body = strings.NewReader(g.warmUp.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, g.warmUp.Method, url, body)
+	if err != nil {
+		return Sample{Failed: true}
+	}
+	for key, value := range g.warmUp.Headers {
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return Sample{Latency: time.Since(start), Failed: true}
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	return Sample{Latency: time.Since(start), StatusCode: resp.StatusCode}
+}
+
+// SetCandidateRevision is a no-op since the samples are always for the
+// candidate revision.
+func (r *Result) SetCandidateRevision(revisionName string) {}
+
+// RequestCount returns the number of requests sent.
+func (r *Result) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	return int64(len(r.Samples)), nil
+}
+
+// Latency returns the latency percentile of the requests, in milliseconds.
+// Failed requests are not considered.
+// It returns 0 if no request received a response.
+func (r *Result) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	var percentile float64
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		percentile = 99
+	case metrics.Align95Reduce95:
+		percentile = 95
+	case metrics.Align50Reduce50:
+		percentile = 50
+	default:
+		return 0, errors.Errorf("unsupported align reduce type %v", alignReduceType)
+	}
+
+	var latencies []float64
+	for _, sample := range r.Samples {
+		if sample.Failed {
+			continue
+		}
+		latencies = append(latencies, float64(sample.Latency)/float64(time.Millisecond))
+	}
+	if len(latencies) == 0 {
+		return 0, nil
+	}
+	sort.Float64s(latencies)
+
+	// Nearest-rank method.
+	rank := int(math.Ceil(percentile / 100 * float64(len(latencies))))
+	return latencies[rank-1], nil
+}
+
+// ErrorRate returns the rate of requests that failed or got a 5xx response.
+// It returns 0 if no request was sent.
+func (r *Result) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	if len(r.Samples) == 0 {
+		return 0, nil
+	}
+
+	var errorCount int
+	for _, sample := range r.Samples {
+		if sample.Failed || sample.StatusCode >= 500 {
+			errorCount++
+		}
+	}
+	return float64(errorCount) / float64(len(r.Samples)), nil
+}
@@ -0,0 +1,88 @@
+package loadgen_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	warmUp := config.WarmUp{
+		RPS:      50,
+		Duration: 200 * time.Millisecond,
+		Method:   http.MethodPost,
+		Path:     "/api",
+		Body:     "{}",
+		Headers:  map[string]string{"Content-Type": "application/json"},
+	}
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	result, err := loadgen.New(server.Client(), warmUp).Generate(ctx, server.URL)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, result.Samples)
+	assert.Equal(t, int(atomic.LoadInt32(&requests)), len(result.Samples))
+	for _, sample := range result.Samples {
+		assert.Equal(t, http.StatusOK, sample.StatusCode)
+	}
+}
+
+func TestResult_Metrics(t *testing.T) {
+	result := &loadgen.Result{
+		Samples: []loadgen.Sample{
+			{Latency: 100 * time.Millisecond, StatusCode: 200},
+			{Latency: 200 * time.Millisecond, StatusCode: 200},
+			{Latency: 300 * time.Millisecond, StatusCode: 503},
+			{Latency: 400 * time.Millisecond, StatusCode: 200},
+			{Latency: time.Second, Failed: true},
+		},
+	}
+	ctx := context.Background()
+
+	count, err := result.RequestCount(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), count)
+
+	rate, err := result.ErrorRate(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.4, rate)
+
+	latencyTests := []struct {
+		alignReduce metrics.AlignReduce
+		expected    float64
+	}{
+		{metrics.Align50Reduce50, 200},
+		{metrics.Align95Reduce95, 400},
+		{metrics.Align99Reduce99, 400},
+	}
+	for _, test := range latencyTests {
+		latency, err := result.Latency(ctx, time.Minute, test.alignReduce)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, latency)
+	}
+
+	empty := &loadgen.Result{}
+	latency, err := empty.Latency(ctx, time.Minute, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, latency)
+	rate, err = empty.ErrorRate(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, rate)
+}
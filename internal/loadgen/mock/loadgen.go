@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen"
+)
+
+// Generator is a mock implementation of loadgen.Generator.
+type Generator struct {
+	GenerateFn      func(ctx context.Context, url string) (*loadgen.Result, error)
+	GenerateInvoked bool
+}
+
+// Generate invokes the mock implementation and marks the function as invoked.
+func (g *Generator) Generate(ctx context.Context, url string) (*loadgen.Result, error) {
+	g.GenerateInvoked = true
+	return g.GenerateFn(ctx, url)
+}
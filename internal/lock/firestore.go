@@ -0,0 +1,124 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/firestore/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Firestore keeps the lease on each service in a document of a Firestore
+// collection, with the holder of the lease and its expiration time. The
+// documents are updated with preconditions, so only one of the replicas
+// competing for an expired lease gets it.
+type Firestore struct {
+	service    *firestore.Service
+	collection string
+	holder     string
+	duration   time.Duration
+}
+
+// NewFirestore initializes a locker for the collection of the (default)
+// database of the project. The leases are taken for the holder and last for
+// the duration.
+func NewFirestore(ctx context.Context, project, collection, holder string, duration time.Duration, opts ...option.ClientOption) (*Firestore, error) {
+	service, err := firestore.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Firestore API")
+	}
+	return &Firestore{
+		service:    service,
+		collection: fmt.Sprintf("projects/%s/databases/(default)/documents/%s", project, collection),
+		holder:     holder,
+		duration:   duration,
+	}, nil
+}
+
+// Acquire takes or renews the lease on the service.
+func (f *Firestore) Acquire(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	doc := &firestore.Document{Fields: map[string]firestore.Value{
+		"holder":  {StringValue: f.holder},
+		"expires": {TimestampValue: now.Add(f.duration).UTC().Format(time.RFC3339Nano)},
+	}}
+	patch := f.service.Projects.Databases.Documents.Patch(f.document(key), doc).Context(ctx)
+
+	current, err := f.service.Projects.Databases.Documents.Get(f.document(key)).Context(ctx).Do()
+	switch {
+	case isStatus(err, http.StatusNotFound):
+		patch = patch.CurrentDocumentExists(false)
+	case err != nil:
+		return false, errors.Wrapf(err, "failed to get lease on %s", key)
+	default:
+		holder, expires := current.Fields["holder"].StringValue, current.Fields["expires"].TimestampValue
+		if holder != f.holder {
+			expiration, err := time.Parse(time.RFC3339Nano, expires)
+			if err == nil && now.Before(expiration) {
+				return false, nil
+			}
+		}
+		patch = patch.CurrentDocumentUpdateTime(current.UpdateTime)
+	}
+
+	if _, err := patch.Do(); err != nil {
+		if isPreconditionFailure(err) {
+			// Another replica took the lease in the meantime.
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to take lease on %s", key)
+	}
+	return true, nil
+}
+
+// Release deletes the lease on the service, if held by this replica.
+func (f *Firestore) Release(ctx context.Context, key string) error {
+	current, err := f.service.Projects.Databases.Documents.Get(f.document(key)).Context(ctx).Do()
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get lease on %s", key)
+	}
+	if current.Fields["holder"].StringValue != f.holder {
+		return nil
+	}
+	_, err = f.service.Projects.Databases.Documents.Delete(f.document(key)).CurrentDocumentUpdateTime(current.UpdateTime).Context(ctx).Do()
+	if err != nil && !isPreconditionFailure(err) {
+		return errors.Wrapf(err, "failed to release lease on %s", key)
+	}
+	return nil
+}
+
+// document returns the name of the document of the service. The slashes of
+// the key are replaced by tildes since document IDs cannot contain slashes.
+func (f *Firestore) document(key string) string {
+	return f.collection + "/" + strings.Replace(key, "/", "~", -1)
+}
+
+// isStatus determines if the error is an API error with the status code.
+func isStatus(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
+}
+
+// isPreconditionFailure determines if the update of a document failed because
+// it was created or modified since it was read.
+func isPreconditionFailure(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(apiErr.Body, "FAILED_PRECONDITION")
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/pkg/errors"
+)
+
+// leaseTimeFormat is the format of the times of the Lease resources.
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// lease is the subset of the Lease resource used by the operator.
+type lease struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Metadata   leaseMeta `json:"metadata"`
+	Spec       leaseSpec `json:"spec"`
+}
+
+type leaseMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int64  `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+// Kubernetes keeps the lease on each service in a Lease resource of a
+// namespace, as the Kubernetes controllers do for their leader election. The
+// resources are updated with their resource version, so only one of the
+// replicas competing for an expired lease gets it.
+type Kubernetes struct {
+	client    *kube.Client
+	namespace string
+	holder    string
+	duration  time.Duration
+}
+
+// NewKubernetes initializes a locker for the namespace. The leases are taken
+// for the holder and last for the duration.
+func NewKubernetes(client *kube.Client, namespace, holder string, duration time.Duration) *Kubernetes {
+	return &Kubernetes{client: client, namespace: namespace, holder: holder, duration: duration}
+}
+
+// Acquire takes or renews the lease on the service.
+func (k *Kubernetes) Acquire(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	current, err := k.get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		l := k.newLease(key, now)
+		l.Spec.AcquireTime = l.Spec.RenewTime
+		err := k.client.Do(ctx, http.MethodPost, k.path(""), "application/json", l, nil)
+		return k.result(err, key)
+	}
+
+	if current.Spec.HolderIdentity != k.holder && current.Spec.HolderIdentity != "" {
+		renewed, err := time.Parse(leaseTimeFormat, current.Spec.RenewTime)
+		expiration := renewed.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second)
+		if err == nil && now.Before(expiration) {
+			return false, nil
+		}
+	}
+	l := k.newLease(key, now)
+	l.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	l.Spec.AcquireTime = current.Spec.AcquireTime
+	if current.Spec.HolderIdentity != k.holder {
+		l.Spec.AcquireTime = l.Spec.RenewTime
+	}
+	err = k.client.Do(ctx, http.MethodPut, k.path(l.Metadata.Name), "application/json", l, nil)
+	return k.result(err, key)
+}
+
+// Release clears the holder of the lease on the service, if held by this
+// replica.
+func (k *Kubernetes) Release(ctx context.Context, key string) error {
+	current, err := k.get(ctx, key)
+	if err != nil || current == nil || current.Spec.HolderIdentity != k.holder {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	err = k.client.Do(ctx, http.MethodPut, k.path(current.Metadata.Name), "application/json", current, nil)
+	if statusErr, ok := err.(*kube.StatusError); ok && statusErr.Code == http.StatusConflict {
+		return nil
+	}
+	return errors.Wrapf(err, "failed to release lease on %s", key)
+}
+
+// get returns the lease on the service, or nil if there is none.
+func (k *Kubernetes) get(ctx context.Context, key string) (*lease, error) {
+	var l lease
+	err := k.client.Do(ctx, http.MethodGet, k.path(leaseName(key)), "", nil, &l)
+	if statusErr, ok := err.(*kube.StatusError); ok && statusErr.Code == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get lease on %s", key)
+	}
+	return &l, nil
+}
+
+// result interprets the response to the creation or update of a lease. A
+// conflict means another replica took the lease in the meantime.
+func (k *Kubernetes) result(err error, key string) (bool, error) {
+	if statusErr, ok := err.(*kube.StatusError); ok && statusErr.Code == http.StatusConflict {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to take lease on %s", key)
+	}
+	return true, nil
+}
+
+// newLease returns a lease on the service held by this replica.
+func (k *Kubernetes) newLease(key string, now time.Time) *lease {
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMeta{Name: leaseName(key), Namespace: k.namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       k.holder,
+			LeaseDurationSeconds: int64(k.duration / time.Second),
+			RenewTime:            now.UTC().Format(leaseTimeFormat),
+		},
+	}
+}
+
+// path returns the path of the lease, or of the collection of leases if the
+// name is empty.
+func (k *Kubernetes) path(name string) string {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", k.namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// leaseName returns the name of the Lease resource of the service. The
+// slashes of the key are replaced by dots since names cannot contain slashes.
+func leaseName(key string) string {
+	return "rollout." + strings.Replace(key, "/", ".", -1)
+}
@@ -0,0 +1,39 @@
+// Package lock ensures that a single replica of the operator handles the
+// rollout of a service at a time, so several replicas can run for
+// availability without making conflicting updates.
+//
+// A replica holds a lease on the service while it handles its rollout. The
+// lease expires after a duration, so the services of a replica that stopped
+// without releasing its leases are eventually taken over by other replicas.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// Locker represents a store of the leases on the services.
+type Locker interface {
+	// Acquire takes the lease on the service with the key, or renews it if
+	// it is already held by this replica. False is returned if another
+	// replica holds the lease.
+	Acquire(ctx context.Context, key string) (bool, error)
+
+	// Release gives up the lease on the service, if held by this replica.
+	Release(ctx context.Context, key string) error
+}
+
+// NewHolderIdentity returns an identity for the leases of this replica: its
+// host name, made unique with a random suffix since replicas can share a host
+// name (e.g. Cloud Run instances).
+func NewHolderIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "operator"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
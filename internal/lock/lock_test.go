@@ -0,0 +1,177 @@
+package lock_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/lock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+// fakeFirestore serves a single document, honoring the preconditions on its
+// existence and update time.
+type fakeFirestore struct {
+	mu       sync.Mutex
+	document map[string]interface{}
+	version  int
+}
+
+func (f *fakeFirestore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.EscapedPath() != "/v1/projects/myproject/databases/(default)/documents/rolloutLocks/myproject~us-east1~myservice" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	updateTime := fmt.Sprintf("2020-06-01T12:00:%02dZ", f.version)
+	query := r.URL.Query()
+	if (query.Get("currentDocument.exists") == "false" && f.document != nil) ||
+		(query.Get("currentDocument.updateTime") != "" && query.Get("currentDocument.updateTime") != updateTime) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"code": 400, "message": "precondition failed", "status": "FAILED_PRECONDITION"}}`))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if f.document == nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+			return
+		}
+		f.document["updateTime"] = updateTime
+		json.NewEncoder(w).Encode(f.document)
+	case http.MethodPatch:
+		f.document = nil
+		json.NewDecoder(r.Body).Decode(&f.document)
+		f.version++
+		json.NewEncoder(w).Encode(f.document)
+	case http.MethodDelete:
+		f.document = nil
+		f.version++
+		w.Write([]byte(`{}`))
+	}
+}
+
+func TestFirestore(t *testing.T) {
+	server := httptest.NewServer(&fakeFirestore{})
+	defer server.Close()
+
+	ctx := context.Background()
+	const key = "myproject/us-east1/myservice"
+	newLocker := func(holder string, duration time.Duration) *lock.Firestore {
+		locker, err := lock.NewFirestore(ctx, "myproject", "rolloutLocks", holder, duration,
+			option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		assert.Nil(t, err)
+		return locker
+	}
+	a, b := newLocker("replica-a", time.Hour), newLocker("replica-b", -time.Second)
+
+	acquired, err := a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	acquired, err = a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "renewal")
+	acquired, err = b.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, acquired, "held by another replica")
+
+	assert.Nil(t, b.Release(ctx, key))
+	acquired, err = b.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, acquired, "release by another replica")
+
+	assert.Nil(t, a.Release(ctx, key))
+	acquired, err = b.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "released")
+
+	// The lease of replica b is already expired.
+	acquired, err = a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "expired")
+
+	_, err = a.Acquire(ctx, "other")
+	assert.NotNil(t, err)
+}
+
+func TestKubernetes(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		stored  map[string]interface{}
+		version int
+	)
+	const path = "/apis/coordination.k8s.io/v1/namespaces/operator/leases"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == path+"/rollout.myproject.us-east1.myservice":
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(stored)
+			return
+		case r.Method == http.MethodPost && r.URL.Path == path:
+			if stored != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		case r.Method == http.MethodPut && r.URL.Path == path+"/rollout.myproject.us-east1.myservice":
+			metadata := body["metadata"].(map[string]interface{})
+			if metadata["resourceVersion"] != strconv.Itoa(version) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		version++
+		body["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(version)
+		stored = body
+		json.NewEncoder(w).Encode(stored)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	const key = "myproject/us-east1/myservice"
+	client := kube.NewClient(server.Client(), server.URL)
+	a := lock.NewKubernetes(client, "operator", "replica-a", time.Hour)
+	b := lock.NewKubernetes(client, "operator", "replica-b", time.Hour)
+
+	acquired, err := a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	acquired, err = a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "renewal")
+	acquired, err = b.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, acquired, "held by another replica")
+
+	assert.Nil(t, b.Release(ctx, key))
+	assert.Equal(t, "replica-a", stored["spec"].(map[string]interface{})["holderIdentity"])
+	assert.Nil(t, a.Release(ctx, key))
+	acquired, err = b.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "released")
+
+	// The lease of replica b expires.
+	stored["spec"].(map[string]interface{})["renewTime"] = "2020-06-01T12:00:00.000000Z"
+	acquired, err = a.Acquire(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "expired")
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// Cache deduplicates identical metrics queries and caches their results, so
+// the same query is sent at most once per TTL to the metrics backend.
+//
+// A cache is meant to be shared by the providers of all the services, across
+// rollout processes.
+type Cache struct {
+	ttl   time.Duration
+	clock clockwork.Clock
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+// cacheKey identifies a query.
+type cacheKey struct {
+	id              string
+	revision        string
+	method          string
+	offset          time.Duration
+	alignReduceType AlignReduce
+	operation       string
+}
+
+// cacheEntry is the result of a query. The done channel is closed once the
+// query finishes.
+type cacheEntry struct {
+	done    chan struct{}
+	value   float64
+	err     error
+	queries []Query
+	expires time.Time
+}
+
+// NewCache initializes a cache whose results expire after the TTL. With a zero
+// TTL, only concurrent identical queries are deduplicated.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		clock:   clockwork.NewRealClock(),
+		entries: make(map[cacheKey]*cacheEntry),
+	}
+}
+
+// WithClock updates the clock used by the cache.
+func (c *Cache) WithClock(clock clockwork.Clock) *Cache {
+	c.clock = clock
+	return c
+}
+
+// Wrap returns a provider that uses the cache for the queries sent to the
+// given provider. The id must identify the queried resource (e.g. the
+// project, region and name of the service).
+//
+// If the provider implements SpanProvider, so does the returned provider.
+func (c *Cache) Wrap(id string, provider Provider) Provider {
+	cached := &cachedProvider{cache: c, id: id, provider: provider}
+	if spans, ok := provider.(SpanProvider); ok {
+		return &cachedSpanProvider{cachedProvider: cached, spans: spans}
+	}
+	return cached
+}
+
+// get returns the cached result for the key or executes the query. Failed
+// queries are not cached, but concurrent callers waiting for the query get
+// the same error.
+//
+// The queries recorded by the provider are recorded again for every caller.
+func (c *Cache) get(ctx context.Context, key cacheKey, query func(context.Context) (float64, error)) (float64, error) {
+	c.mu.Lock()
+	now := c.clock.Now()
+	for k, entry := range c.entries {
+		if isDone(entry) && !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if entry, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		<-entry.done
+		RecordQuery(ctx, entry.queries...)
+		return entry.value, entry.err
+	}
+	entry := &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	recorder := NewRecorder()
+	entry.value, entry.err = query(ContextWithRecorder(ctx, recorder))
+	entry.queries = recorder.Queries()
+	RecordQuery(ctx, entry.queries...)
+
+	c.mu.Lock()
+	entry.expires = c.clock.Now().Add(c.ttl)
+	if entry.err != nil || c.ttl <= 0 {
+		delete(c.entries, key)
+	}
+	close(entry.done)
+	c.mu.Unlock()
+	return entry.value, entry.err
+}
+
+func isDone(entry *cacheEntry) bool {
+	select {
+	case <-entry.done:
+		return true
+	default:
+		return false
+	}
+}
+
+type cachedProvider struct {
+	cache    *Cache
+	id       string
+	provider Provider
+	revision string
+}
+
+func (p *cachedProvider) key(method string, offset time.Duration) cacheKey {
+	return cacheKey{id: p.id, revision: p.revision, method: method, offset: offset}
+}
+
+func (p *cachedProvider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+	p.provider.SetCandidateRevision(revisionName)
+}
+
+func (p *cachedProvider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	value, err := p.cache.get(ctx, p.key("RequestCount", offset), func(ctx context.Context) (float64, error) {
+		count, err := p.provider.RequestCount(ctx, offset)
+		return float64(count), err
+	})
+	return int64(value), err
+}
+
+func (p *cachedProvider) Latency(ctx context.Context, offset time.Duration, alignReduceType AlignReduce) (float64, error) {
+	key := p.key("Latency", offset)
+	key.alignReduceType = alignReduceType
+	return p.cache.get(ctx, key, func(ctx context.Context) (float64, error) {
+		return p.provider.Latency(ctx, offset, alignReduceType)
+	})
+}
+
+func (p *cachedProvider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	return p.cache.get(ctx, p.key("ErrorRate", offset), func(ctx context.Context) (float64, error) {
+		return p.provider.ErrorRate(ctx, offset)
+	})
+}
+
+type cachedSpanProvider struct {
+	*cachedProvider
+	spans SpanProvider
+}
+
+func (p *cachedSpanProvider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	key := p.key("SpanErrorRate", offset)
+	key.operation = operation
+	return p.cache.get(ctx, key, func(ctx context.Context) (float64, error) {
+		return p.spans.SpanErrorRate(ctx, offset, operation)
+	})
+}
+
+func (p *cachedSpanProvider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType AlignReduce) (float64, error) {
+	key := p.key("SpanLatency", offset)
+	key.operation = operation
+	key.alignReduceType = alignReduceType
+	return p.cache.get(ctx, key, func(ctx context.Context) (float64, error) {
+		return p.spans.SpanLatency(ctx, offset, operation, alignReduceType)
+	})
+}
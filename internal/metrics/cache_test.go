@@ -0,0 +1,104 @@
+package metrics_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return 0.01, nil
+	}
+	metricsMock.LatencyFn = func(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return 0, errors.New("backend unavailable")
+	}
+
+	clock := clockwork.NewFakeClock()
+	cache := metrics.NewCache(time.Minute).WithClock(clock)
+	provider := cache.Wrap("myproject/us-east1/mysvc", metricsMock)
+	provider.SetCandidateRevision("test-002")
+	ctx := context.Background()
+
+	// Concurrent identical queries are sent once.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rate, err := provider.ErrorRate(ctx, 30*time.Minute)
+			assert.Nil(t, err)
+			assert.Equal(t, 0.01, rate)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+
+	// Results are cached until the TTL, per revision.
+	provider.ErrorRate(ctx, 30*time.Minute)
+	assert.Equal(t, 1, calls)
+	other := cache.Wrap("myproject/us-east1/mysvc", metricsMock)
+	other.SetCandidateRevision("test-003")
+	other.ErrorRate(ctx, 30*time.Minute)
+	assert.Equal(t, 2, calls)
+	clock.Advance(time.Minute)
+	provider.ErrorRate(ctx, 30*time.Minute)
+	assert.Equal(t, 3, calls)
+
+	// Errors are not cached.
+	_, err := provider.Latency(ctx, 30*time.Minute, metrics.Align99Reduce99)
+	assert.NotNil(t, err)
+	provider.Latency(ctx, 30*time.Minute, metrics.Align99Reduce99)
+	assert.Equal(t, 5, calls)
+}
+
+func TestCache_Wrap(t *testing.T) {
+	cache := metrics.NewCache(time.Minute)
+
+	_, ok := cache.Wrap("svc", &metricsMocker.Metrics{}).(metrics.SpanProvider)
+	assert.False(t, ok)
+	_, ok = cache.Wrap("svc", &metricsMocker.Spans{}).(metrics.SpanProvider)
+	assert.True(t, ok)
+}
+
+// TestCache_RecordQuery tests that the queries recorded by the provider are
+// recorded for cached results.
+func TestCache_RecordQuery(t *testing.T) {
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		metrics.RecordQuery(ctx, metrics.Query{Query: "request_count"})
+		return 100, nil
+	}
+
+	provider := metrics.NewCache(time.Minute).Wrap("svc", metricsMock)
+	provider.SetCandidateRevision("test-002")
+	for i := 0; i < 2; i++ {
+		recorder := metrics.NewRecorder()
+		ctx := metrics.ContextWithRecorder(context.Background(), recorder)
+		_, err := provider.RequestCount(ctx, 30*time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, []metrics.Query{{Query: "request_count"}}, recorder.Queries())
+	}
+}
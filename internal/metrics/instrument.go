@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/tracing"
+)
+
+// Observer is called after every query of an instrumented provider with the
+// name of the method, the duration of the query and its error, if any.
+type Observer func(method string, duration time.Duration, err error)
+
+// Instrument returns a provider that reports the queries sent to the given
+// provider to the observer, and records them as spans in the trace of the
+// context, if any.
+//
+// If the provider implements SpanProvider, so does the returned provider.
+func Instrument(provider Provider, observe Observer) Provider {
+	instrumented := &instrumentedProvider{provider: provider, observe: observe}
+	if spans, ok := provider.(SpanProvider); ok {
+		return &instrumentedSpanProvider{instrumentedProvider: instrumented, spans: spans}
+	}
+	return instrumented
+}
+
+type instrumentedProvider struct {
+	provider Provider
+	observe  Observer
+}
+
+func (p *instrumentedProvider) SetCandidateRevision(revisionName string) {
+	p.provider.SetCandidateRevision(revisionName)
+}
+
+func (p *instrumentedProvider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "metrics/RequestCount")
+	start := time.Now()
+	count, err := p.provider.RequestCount(ctx, offset)
+	p.observe("RequestCount", time.Since(start), err)
+	span.End(err)
+	return count, err
+}
+
+func (p *instrumentedProvider) Latency(ctx context.Context, offset time.Duration, alignReduceType AlignReduce) (float64, error) {
+	ctx, span := tracing.Start(ctx, "metrics/Latency")
+	start := time.Now()
+	latency, err := p.provider.Latency(ctx, offset, alignReduceType)
+	p.observe("Latency", time.Since(start), err)
+	span.End(err)
+	return latency, err
+}
+
+func (p *instrumentedProvider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	ctx, span := tracing.Start(ctx, "metrics/ErrorRate")
+	start := time.Now()
+	rate, err := p.provider.ErrorRate(ctx, offset)
+	p.observe("ErrorRate", time.Since(start), err)
+	span.End(err)
+	return rate, err
+}
+
+type instrumentedSpanProvider struct {
+	*instrumentedProvider
+	spans SpanProvider
+}
+
+func (p *instrumentedSpanProvider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	ctx, span := tracing.Start(ctx, "metrics/SpanErrorRate")
+	start := time.Now()
+	rate, err := p.spans.SpanErrorRate(ctx, offset, operation)
+	p.observe("SpanErrorRate", time.Since(start), err)
+	span.End(err)
+	return rate, err
+}
+
+func (p *instrumentedSpanProvider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType AlignReduce) (float64, error) {
+	ctx, span := tracing.Start(ctx, "metrics/SpanLatency")
+	start := time.Now()
+	latency, err := p.spans.SpanLatency(ctx, offset, operation, alignReduceType)
+	p.observe("SpanLatency", time.Since(start), err)
+	span.End(err)
+	return latency, err
+}
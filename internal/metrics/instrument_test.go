@@ -0,0 +1,45 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	spansMock := &metricsMocker.Spans{}
+	spansMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 10, nil
+	}
+	spansMock.SpanErrorRateFn = func(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+		return 0, errors.New("query failed")
+	}
+
+	var observed []string
+	var errs []error
+	provider := metrics.Instrument(spansMock, func(method string, duration time.Duration, err error) {
+		observed = append(observed, method)
+		errs = append(errs, err)
+	})
+
+	count, err := provider.RequestCount(context.TODO(), time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), count)
+
+	spans, ok := provider.(metrics.SpanProvider)
+	if assert.True(t, ok, "span provider must stay a span provider") {
+		_, err = spans.SpanErrorRate(context.TODO(), time.Minute, "checkout")
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, []string{"RequestCount", "SpanErrorRate"}, observed)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[1])
+
+	_, ok = metrics.Instrument(&metricsMocker.Metrics{}, func(string, time.Duration, error) {}).(metrics.SpanProvider)
+	assert.False(t, ok)
+}
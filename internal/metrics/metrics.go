@@ -19,6 +19,12 @@ const (
 	Align50Reduce50
 )
 
+// ErrMissingRevisionData is returned by providers when the metrics cannot be
+// attributed to the candidate revision (e.g. the data was not ingested yet or
+// the returned series are not filtered by revision). Callers should not
+// evaluate such metrics since they might represent the entire service.
+var ErrMissingRevisionData = errors.New("no metrics data for the candidate revision")
+
 // Provider represents a metrics Provider such as Stackdriver.
 type Provider interface {
 	// Sets the candidate revision name for which the provider should get
@@ -41,6 +47,17 @@ type Provider interface {
 	ErrorRate(ctx context.Context, offset time.Duration) (float64, error)
 }
 
+// SpanProvider is implemented by providers that get metrics from the traces of
+// the candidate revision. The operation is the name of the spans to consider.
+type SpanProvider interface {
+	// Returns the rate of spans with errors.
+	SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error)
+
+	// Returns the span duration after applying the specified series aligner
+	// and cross series reducer. The result is in milliseconds.
+	SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType AlignReduce) (float64, error)
+}
+
 // PercentileToAlignReduce takes a percentile value maps it to a AlignReduce
 // value.
 //
@@ -22,6 +22,18 @@ type Metrics struct {
 	ErrorRateInvoked bool
 }
 
+// Spans is a mock implementation of metrics.Metrics that also implements
+// metrics.SpanProvider.
+type Spans struct {
+	Metrics
+
+	SpanErrorRateFn      func(ctx context.Context, offset time.Duration, operation string) (float64, error)
+	SpanErrorRateInvoked bool
+
+	SpanLatencyFn      func(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error)
+	SpanLatencyInvoked bool
+}
+
 // Query is a mock implementation of metrics.Query.
 type Query struct{}
 
@@ -51,6 +63,20 @@ func (m *Metrics) ErrorRate(ctx context.Context, offset time.Duration) (float64,
 	return m.ErrorRateFn(ctx, offset)
 }
 
+// SpanErrorRate invokes the mock implementation and marks the function as
+// invoked.
+func (m *Spans) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	m.SpanErrorRateInvoked = true
+	return m.SpanErrorRateFn(ctx, offset, operation)
+}
+
+// SpanLatency invokes the mock implementation and marks the function as
+// invoked.
+func (m *Spans) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+	m.SpanLatencyInvoked = true
+	return m.SpanLatencyFn(ctx, offset, operation, alignReduceType)
+}
+
 // Query returns an empty string to comply with the interface.
 func (q Query) Query() string {
 	return ""
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Query is a query sent by a provider to the metrics backend.
+type Query struct {
+	Query string    `json:"query"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Recorder collects the queries sent by providers, so the data used for a
+// diagnosis can be audited.
+type Recorder struct {
+	mu      sync.Mutex
+	queries []Query
+}
+
+type contextKeyRecorder struct{}
+
+// NewRecorder initializes an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Queries returns the recorded queries.
+func (r *Recorder) Queries() []Query {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Query(nil), r.queries...)
+}
+
+func (r *Recorder) add(queries ...Query) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, queries...)
+}
+
+// ContextWithRecorder returns a copy of the parent context that includes the
+// recorder.
+func ContextWithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, contextKeyRecorder{}, recorder)
+}
+
+// RecordQuery adds the query to the recorder in the context, if any.
+// Providers should call it for every query answered by the backend, including
+// queries that returned no data.
+func RecordQuery(ctx context.Context, queries ...Query) {
+	if recorder, ok := ctx.Value(contextKeyRecorder{}).(*Recorder); ok {
+		recorder.add(queries...)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -43,8 +44,8 @@ type Provider struct {
 }
 
 // NewProvider initializes a connection to Google Sheets
-func NewProvider(ctx context.Context, sheetsID, sheetName, region, serviceName string) (*Provider, error) {
-	client, err := sheets.NewService(ctx)
+func NewProvider(ctx context.Context, sheetsID, sheetName, region, serviceName string, opts ...option.ClientOption) (*Provider, error) {
+	client, err := sheets.NewService(ctx, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize Google Sheets client")
 	}
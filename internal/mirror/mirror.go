@@ -0,0 +1,83 @@
+// Package mirror controls the replay of a sample of production requests to a
+// candidate revision (shadow traffic).
+//
+// The operator does not proxy requests itself. Instead, it instructs a
+// mirroring proxy (see Proxy) deployed in front of the service.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Controller represents a client that starts and stops the mirroring of
+// requests for a service.
+type Controller interface {
+	// Start starts replaying the given percentage of the service's requests to
+	// the target URL.
+	Start(ctx context.Context, service, targetURL string, percent float64) error
+
+	// Stop stops replaying the service's requests.
+	Stop(ctx context.Context, service string) error
+}
+
+// Mirror is the mirroring configuration for a service.
+type Mirror struct {
+	Target  string  `json:"target"`
+	Percent float64 `json:"percent"`
+}
+
+// HTTPController instructs a mirroring proxy through its control API.
+type HTTPController struct {
+	client     *http.Client
+	controlURL string
+}
+
+// NewHTTPController initializes a controller for the proxy at the control URL.
+func NewHTTPController(client *http.Client, controlURL string) *HTTPController {
+	return &HTTPController{
+		client:     client,
+		controlURL: strings.TrimSuffix(controlURL, "/"),
+	}
+}
+
+// Start configures the proxy to mirror requests for the service.
+func (c *HTTPController) Start(ctx context.Context, service, targetURL string, percent float64) error {
+	body, err := json.Marshal(Mirror{Target: targetURL, Percent: percent})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal mirror configuration")
+	}
+	return c.do(ctx, http.MethodPut, service, body)
+}
+
+// Stop configures the proxy to stop mirroring requests for the service.
+func (c *HTTPController) Stop(ctx context.Context, service string) error {
+	return c.do(ctx, http.MethodDelete, service, nil)
+}
+
+func (c *HTTPController) do(ctx context.Context, method, service string, body []byte) error {
+	url := fmt.Sprintf("%s/mirrors/%s", c.controlURL, service)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request to mirroring proxy failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("mirroring proxy returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
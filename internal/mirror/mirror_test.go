@@ -0,0 +1,71 @@
+package mirror_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/mirror"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	mirrored := make(chan string, 10)
+	candidate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mirrored <- r.URL.RequestURI() + " " + string(body)
+		w.Write([]byte("candidate"))
+	}))
+	defer candidate.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	proxy := mirror.NewProxy("mysvc", upstreamURL, logger)
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+	controlServer := httptest.NewServer(proxy.ControlHandler())
+	defer controlServer.Close()
+
+	send := func() string {
+		resp, err := http.Post(proxyServer.URL+"/api?q=1", "text/plain", nil)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Without a mirror, requests are only forwarded.
+	assert.Equal(t, "upstream", send())
+
+	ctx := context.Background()
+	controller := mirror.NewHTTPController(controlServer.Client(), controlServer.URL)
+	assert.NotNil(t, controller.Start(ctx, "othersvc", candidate.URL, 100))
+	assert.Nil(t, controller.Start(ctx, "mysvc", candidate.URL, 100))
+
+	assert.Equal(t, "upstream", send())
+	select {
+	case req := <-mirrored:
+		assert.Equal(t, "/api?q=1 ", req)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	assert.Nil(t, controller.Stop(ctx, "mysvc"))
+	assert.Equal(t, "upstream", send())
+	select {
+	case <-mirrored:
+		t.Fatal("request was mirrored after stopping")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
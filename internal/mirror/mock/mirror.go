@@ -0,0 +1,24 @@
+package mock
+
+import "context"
+
+// Controller is a mock implementation of mirror.Controller.
+type Controller struct {
+	StartFn      func(ctx context.Context, service, targetURL string, percent float64) error
+	StartInvoked bool
+
+	StopFn      func(ctx context.Context, service string) error
+	StopInvoked bool
+}
+
+// Start invokes the mock implementation and marks the function as invoked.
+func (c *Controller) Start(ctx context.Context, service, targetURL string, percent float64) error {
+	c.StartInvoked = true
+	return c.StartFn(ctx, service, targetURL, percent)
+}
+
+// Stop invokes the mock implementation and marks the function as invoked.
+func (c *Controller) Stop(ctx context.Context, service string) error {
+	c.StopInvoked = true
+	return c.StopFn(ctx, service)
+}
@@ -0,0 +1,136 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxMirroredBodyBytes limits the size of request bodies that are mirrored.
+// Requests with larger bodies are forwarded but not mirrored.
+const maxMirroredBodyBytes = 1 << 20
+
+// mirrorRequestTimeout is the maximum time a mirrored request can take.
+const mirrorRequestTimeout = 30 * time.Second
+
+// Proxy is a reverse proxy for a single service that replays a sample of the
+// requests to a mirror target. Responses from the mirror target are discarded.
+//
+// The mirror is configured through the control API:
+//
+//	PUT    /mirrors/{service}  (body: Mirror)
+//	DELETE /mirrors/{service}
+type Proxy struct {
+	service  string
+	upstream *httputil.ReverseProxy
+	client   *http.Client
+	logger   *logrus.Logger
+
+	mu     sync.RWMutex
+	mirror *Mirror
+}
+
+// NewProxy initializes a proxy that forwards requests to the upstream URL.
+func NewProxy(service string, upstream *url.URL, logger *logrus.Logger) *Proxy {
+	reverseProxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := reverseProxy.Director
+	reverseProxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = upstream.Host
+	}
+
+	return &Proxy{
+		service:  service,
+		upstream: reverseProxy,
+		client:   &http.Client{Timeout: mirrorRequestTimeout},
+		logger:   logger,
+	}
+}
+
+// ControlHandler returns the handler for the control API.
+func (p *Proxy) ControlHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		service := strings.TrimPrefix(req.URL.Path, "/mirrors/")
+		if service != p.service {
+			http.Error(w, "unknown service", http.StatusNotFound)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodPut:
+			var mirror Mirror
+			if err := json.NewDecoder(req.Body).Decode(&mirror); err != nil {
+				http.Error(w, "invalid mirror configuration", http.StatusBadRequest)
+				return
+			}
+			if _, err := url.Parse(mirror.Target); err != nil || mirror.Percent < 0 || mirror.Percent > 100 {
+				http.Error(w, "invalid mirror configuration", http.StatusBadRequest)
+				return
+			}
+			p.mu.Lock()
+			p.mirror = &mirror
+			p.mu.Unlock()
+			p.logger.WithFields(logrus.Fields{"target": mirror.Target, "percent": mirror.Percent}).Info("started mirroring")
+		case http.MethodDelete:
+			p.mu.Lock()
+			p.mirror = nil
+			p.mu.Unlock()
+			p.logger.Info("stopped mirroring")
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// ServeHTTP forwards the request to the upstream and, if sampled, replays it
+// to the mirror target.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.RLock()
+	mirror := p.mirror
+	p.mu.RUnlock()
+
+	if mirror != nil && rand.Float64()*100 < mirror.Percent {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxMirroredBodyBytes))
+		if err == nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			go p.replay(req.Clone(context.Background()), body, mirror.Target)
+		} else {
+			p.logger.Debugf("request not mirrored: %v", err)
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	p.upstream.ServeHTTP(w, req)
+}
+
+// replay sends a copy of the request to the mirror target.
+func (p *Proxy) replay(req *http.Request, body []byte, target string) {
+	targetURL, err := url.Parse(strings.TrimSuffix(target, "/") + req.URL.RequestURI())
+	if err != nil {
+		p.logger.Debugf("invalid mirror URL: %v", err)
+		return
+	}
+
+	req.URL = targetURL
+	req.Host = targetURL.Host
+	req.RequestURI = ""
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.logger.Debugf("mirrored request failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// BigQuery appends a row per rollout decision to a BigQuery table, so release
+// velocity and canary failure rates can be analyzed with SQL.
+//
+// The table columns are timestamp (TIMESTAMP), type, project, region, service,
+// stable, candidate (STRING), previousPercent, candidatePercent (INTEGER),
+// diagnosis (STRING) and checks, a repeated record of criterion (STRING), value,
+// threshold (FLOAT), met (BOOLEAN) and reason (STRING).
+type BigQuery struct {
+	service *bigquery.Service
+	project string
+	dataset string
+	table   string
+}
+
+// NewBigQuery initializes a notifier that inserts the rows in the table
+// (PROJECT.DATASET.TABLE).
+func NewBigQuery(ctx context.Context, table string, opts ...option.ClientOption) (*BigQuery, error) {
+	parts := strings.Split(table, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, errors.Errorf("table must have the form PROJECT.DATASET.TABLE, got %q", table)
+	}
+	service, err := bigquery.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize BigQuery client")
+	}
+	return &BigQuery{service: service, project: parts[0], dataset: parts[1], table: parts[2]}, nil
+}
+
+// Notify implements Notifier.
+func (b *BigQuery) Notify(ctx context.Context, event Event) error {
+	var checks []map[string]interface{}
+	for _, check := range event.Checks {
+		row := map[string]interface{}{
+			"criterion": check.Criterion,
+			"threshold": check.Threshold,
+			"met":       check.IsCriteriaMet,
+		}
+		if check.ActualValue != nil {
+			row["value"] = *check.ActualValue
+		}
+		if check.Reason != "" {
+			row["reason"] = check.Reason
+		}
+		checks = append(checks, row)
+	}
+
+	row := map[string]bigquery.JsonValue{
+		"timestamp":        event.Time.UTC().Format(time.RFC3339Nano),
+		"type":             string(event.Type),
+		"project":          event.Project,
+		"region":           event.Region,
+		"service":          event.Service,
+		"stable":           event.Stable,
+		"candidate":        event.Candidate,
+		"previousPercent":  event.PreviousPercent,
+		"candidatePercent": event.CandidatePercent,
+		"diagnosis":        event.Diagnosis,
+		"checks":           checks,
+	}
+	req := &bigquery.TableDataInsertAllRequest{
+		Rows: []*bigquery.TableDataInsertAllRequestRows{{
+			// The insert ID lets BigQuery deduplicate retried requests.
+			InsertId: fmt.Sprintf("%s/%s/%s/%s/%s/%d", event.Project, event.Region, event.Service, event.Candidate, event.Type, event.Time.UnixNano()),
+			Json:     row,
+		}},
+	}
+	resp, err := b.service.Tabledata.InsertAll(b.project, b.dataset, b.table, req).Context(ctx).Do()
+	if err != nil {
+		return errors.Wrap(err, "failed to insert row in BigQuery")
+	}
+	for _, insertErr := range resp.InsertErrors {
+		for _, e := range insertErr.Errors {
+			return errors.Errorf("failed to insert row in BigQuery: %s: %s", e.Reason, e.Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CloudEvents types of the events.
+var cloudEventTypes = map[EventType]string{
+	CandidateDetectedEvent:      "run.cloud.rollout.CandidateDetected",
+	ShadowStartedEvent:          "run.cloud.rollout.ShadowStarted",
+	StepAdvancedEvent:           "run.cloud.rollout.StepAdvanced",
+	PromotionEvent:              "run.cloud.rollout.Promoted",
+	RollbackEvent:               "run.cloud.rollout.RolledBack",
+	InconclusiveEvent:           "run.cloud.rollout.DiagnosisInconclusive",
+	PolicyDeniedEvent:           "run.cloud.rollout.PolicyDenied",
+	QuarantinedEvent:            "run.cloud.rollout.Quarantined",
+	StuckEvent:                  "run.cloud.rollout.Stuck",
+	UnhealthyEvent:              "run.cloud.rollout.Unhealthy",
+	AttestationRefusedEvent:     "run.cloud.rollout.AttestationRefused",
+	VulnerabilitiesRefusedEvent: "run.cloud.rollout.VulnerabilitiesRefused",
+}
+
+// CloudEvent is an event in the CloudEvents v1.0 JSON format.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Event     `json:"data"`
+}
+
+// NewCloudEvent returns the CloudEvent of the event. The source is the
+// service's resource name and the subject is the candidate.
+func NewCloudEvent(event Event) (CloudEvent, error) {
+	eventType, ok := cloudEventTypes[event.Type]
+	if !ok {
+		return CloudEvent{}, errors.Errorf("no CloudEvents type for event %q", event.Type)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return CloudEvent{}, errors.Wrap(err, "failed to generate event ID")
+	}
+
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          fmt.Sprintf("//run.googleapis.com/projects/%s/locations/%s/services/%s", event.Project, event.Region, event.Service),
+		Type:            eventType,
+		Subject:         event.Candidate,
+		Time:            event.Time,
+		DataContentType: "application/json",
+		Data:            event,
+	}, nil
+}
+
+// attributes returns the context attributes of the event as Pub/Sub message
+// attributes, following the CloudEvents Pub/Sub protocol binding.
+func (ce CloudEvent) attributes() map[string]string {
+	return map[string]string{
+		"ce-specversion": ce.SpecVersion,
+		"ce-id":          ce.ID,
+		"ce-source":      ce.Source,
+		"ce-type":        ce.Type,
+		"ce-subject":     ce.Subject,
+		"ce-time":        ce.Time.Format(time.RFC3339Nano),
+		"content-type":   ce.DataContentType,
+	}
+}
+
+// CloudEventsHTTP sends the events as CloudEvents to an HTTP endpoint (e.g. a
+// Knative broker) in structured content mode.
+type CloudEventsHTTP struct {
+	client *http.Client
+	url    string
+}
+
+// NewCloudEventsHTTP initializes a notifier that sends the CloudEvents to the
+// URL.
+func NewCloudEventsHTTP(client *http.Client, url string) *CloudEventsHTTP {
+	return &CloudEventsHTTP{client: client, url: url}
+}
+
+// Notify implements Notifier.
+func (c *CloudEventsHTTP) Notify(ctx context.Context, event Event) error {
+	ce, err := NewCloudEvent(event)
+	if err != nil {
+		return err
+	}
+	return postJSONWithHeaders(ctx, c.client, c.url, map[string]string{
+		"Content-Type": "application/cloudevents+json; charset=utf-8",
+	}, ce)
+}
+
+// CloudEventsPubSub publishes the events as CloudEvents to a Pub/Sub topic in
+// binary content mode: the message data is the event and the message
+// attributes are the CloudEvents context attributes, so Eventarc triggers and
+// subscriptions can filter on them.
+type CloudEventsPubSub struct {
+	publisher Publisher
+	topic     string
+}
+
+// NewCloudEventsPubSub initializes a notifier that publishes the CloudEvents
+// to the topic (projects/PROJECT/topics/TOPIC).
+func NewCloudEventsPubSub(publisher Publisher, topic string) *CloudEventsPubSub {
+	return &CloudEventsPubSub{publisher: publisher, topic: topic}
+}
+
+// Notify implements Notifier.
+func (c *CloudEventsPubSub) Notify(ctx context.Context, event Event) error {
+	ce, err := NewCloudEvent(event)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ce.Data)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+	return c.publisher.Publish(ctx, c.topic, data, ce.attributes())
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// DefaultSendGridURL is the endpoint of the SendGrid API to send emails.
+const DefaultSendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// email is the message sent for an event.
+type email struct {
+	from    string
+	to      []string
+	subject string
+	body    string
+	html    bool
+}
+
+// newEmail returns the summary email for the event, or false if no email is
+// sent for this type of event.
+func newEmail(from string, to []string, event Event) (email, bool) {
+	if event.Type != PromotionEvent && event.Type != RollbackEvent {
+		return email{}, false
+	}
+
+	details := []string{
+		event.Title(),
+		fmt.Sprintf("Project: %s", event.Project),
+		fmt.Sprintf("Region: %s", event.Region),
+		fmt.Sprintf("Stable revision: %s", event.Stable),
+		fmt.Sprintf("Candidate revision: %s", event.Candidate),
+		fmt.Sprintf("Revisions: %s", event.ConsoleURL()),
+	}
+	if event.Image != "" {
+		details = append(details, fmt.Sprintf("Image: %s", event.Image))
+	}
+	if event.CommitSHA != "" {
+		details = append(details, fmt.Sprintf("Commit: %s", event.CommitSHA))
+	}
+	if event.BuildURL != "" {
+		details = append(details, fmt.Sprintf("Build: %s", event.BuildURL))
+	}
+	if len(event.FailedChecks) != 0 {
+		details = append(details, "Failed checks: "+strings.Join(event.FailedChecks, ", "))
+	}
+
+	isHTML := event.ReportFormat == config.HTMLReportFormat
+	var body string
+	if isHTML {
+		for _, line := range details {
+			body += "<p>" + html.EscapeString(line) + "</p>\n"
+		}
+		// The HTML report is already escaped.
+		body += event.Report
+	} else {
+		body = strings.Join(details, "\n")
+		if event.Report != "" {
+			body += "\n\n" + event.Report
+		}
+	}
+
+	return email{
+		from:    from,
+		to:      to,
+		subject: "[cloud-run-release-operator] " + event.Title(),
+		body:    body,
+		html:    isHTML,
+	}, true
+}
+
+func (e email) contentType() string {
+	if e.html {
+		return "text/html"
+	}
+	return "text/plain"
+}
+
+// SMTP emails a summary of promotions and rollbacks through an SMTP server.
+// Other events are ignored.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+
+	// sendMail is replaced in tests.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTP initializes a notifier that sends the emails through the SMTP server
+// at the address (host:port). If the username is empty, no authentication is
+// used.
+func NewSMTP(addr, username, password, from string, to []string) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid SMTP server address %q", addr)
+	}
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTP{addr: addr, auth: auth, from: from, to: to, sendMail: smtp.SendMail}, nil
+}
+
+// Notify implements Notifier.
+func (s *SMTP) Notify(ctx context.Context, event Event) error {
+	e, ok := newEmail(s.from, s.to, event)
+	if !ok {
+		return nil
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", e.contentType())
+	fmt.Fprintf(&msg, "\r\n%s\r\n", strings.ReplaceAll(e.body, "\n", "\r\n"))
+
+	if err := s.sendMail(s.addr, s.auth, e.from, e.to, msg.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	return nil
+}
+
+// SendGrid emails a summary of promotions and rollbacks through the SendGrid
+// API. Other events are ignored.
+type SendGrid struct {
+	client *http.Client
+	url    string
+	apiKey string
+	from   string
+	to     []string
+}
+
+// NewSendGrid initializes a notifier that sends the emails with the SendGrid
+// API key.
+func NewSendGrid(client *http.Client, apiKey, from string, to []string) *SendGrid {
+	return &SendGrid{client: client, url: DefaultSendGridURL, apiKey: apiKey, from: from, to: to}
+}
+
+// WithURL updates the endpoint of the SendGrid API.
+func (s *SendGrid) WithURL(url string) *SendGrid {
+	s.url = url
+	return s
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+// Notify implements Notifier.
+func (s *SendGrid) Notify(ctx context.Context, event Event) error {
+	e, ok := newEmail(s.from, s.to, event)
+	if !ok {
+		return nil
+	}
+
+	var personalization sendGridPersonalization
+	for _, to := range e.to {
+		personalization.To = append(personalization.To, sendGridAddress{Email: to})
+	}
+	mail := sendGridMail{
+		Personalizations: []sendGridPersonalization{personalization},
+		From:             sendGridAddress{Email: e.from},
+		Subject:          e.subject,
+		Content:          []sendGridContent{{Type: e.contentType(), Value: e.body}},
+	}
+	return postJSONWithHeaders(ctx, s.client, s.url, map[string]string{
+		"Authorization": "Bearer " + s.apiKey,
+	}, mail)
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTP(t *testing.T) {
+	notifier, err := NewSMTP("smtp.example.com:587", "user", "pass", "operator@example.com", []string{"a@example.com", "b@example.com"})
+	assert.Nil(t, err)
+
+	var (
+		sentAddr string
+		sentAuth smtp.Auth
+		sentTo   []string
+		sentMsg  string
+	)
+	notifier.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentAddr, sentAuth, sentTo, sentMsg = addr, a, to, string(msg)
+		return nil
+	}
+
+	event := Event{
+		Type:         RollbackEvent,
+		Project:      "myproject",
+		Region:       "us-east1",
+		Service:      "mysvc",
+		Stable:       "mysvc-001",
+		Candidate:    "mysvc-002",
+		Report:       "status: unhealthy",
+		Time:         time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		FailedChecks: []string{"error-rate-percent: 10.00 (needs 5.00)"},
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, "smtp.example.com:587", sentAddr)
+	assert.NotNil(t, sentAuth)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, sentTo)
+	expected := "From: operator@example.com\r\n" +
+		"To: a@example.com, b@example.com\r\n" +
+		"Subject: [cloud-run-release-operator] Service mysvc: candidate mysvc-002 was rolled back to mysvc-001\r\n" +
+		"Date: Mon, 01 Jun 2020 00:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Service mysvc: candidate mysvc-002 was rolled back to mysvc-001\r\n" +
+		"Project: myproject\r\n" +
+		"Region: us-east1\r\n" +
+		"Stable revision: mysvc-001\r\n" +
+		"Candidate revision: mysvc-002\r\n" +
+		"Revisions: https://console.cloud.google.com/run/detail/us-east1/mysvc/revisions?project=myproject\r\n" +
+		"Failed checks: error-rate-percent: 10.00 (needs 5.00)\r\n" +
+		"\r\n" +
+		"status: unhealthy\r\n"
+	assert.Equal(t, expected, sentMsg)
+
+	// Only promotions and rollbacks are emailed.
+	sentMsg = ""
+	event.Type = StepAdvancedEvent
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, "", sentMsg)
+
+	_, err = NewSMTP("smtp.example.com", "", "", "operator@example.com", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader is the header with the HMAC-SHA256 signature of the body of
+// the webhook requests, in the form "sha256=<hex digest>".
+const SignatureHeader = "X-Rollout-Signature"
+
+// Default retries of the webhook requests.
+const (
+	DefaultWebhookMaxRetries = 3
+	DefaultWebhookBackoff    = time.Second
+)
+
+// templateFuncs are the functions available to the payload templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, so strings can be safely embedded in the payload.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Webhook posts a JSON payload to an arbitrary endpoint on every event.
+//
+// By default, the payload is the JSON encoding of the event. Optionally, the
+// payload is a Go template that receives the event (e.g. `{"text": {{json
+// .Title}}}`).
+type Webhook struct {
+	client     *http.Client
+	url        string
+	payload    *template.Template
+	headers    map[string]string
+	secret     []byte
+	maxRetries int
+	backoff    time.Duration
+	clock      clockwork.Clock
+}
+
+// NewWebhook initializes a notifier for the URL. If the payload template is
+// empty, the event is sent as JSON.
+func NewWebhook(client *http.Client, url, payloadTemplate string, headers map[string]string) (*Webhook, error) {
+	w := &Webhook{
+		client:     client,
+		url:        url,
+		headers:    headers,
+		maxRetries: DefaultWebhookMaxRetries,
+		backoff:    DefaultWebhookBackoff,
+		clock:      clockwork.NewRealClock(),
+	}
+	if payloadTemplate != "" {
+		tmpl, err := template.New("payload").Funcs(templateFuncs).Parse(payloadTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse payload template")
+		}
+		w.payload = tmpl
+	}
+	return w, nil
+}
+
+// WithSecret signs the requests with the secret. The signature is sent in the
+// SignatureHeader header.
+func (w *Webhook) WithSecret(secret string) *Webhook {
+	w.secret = []byte(secret)
+	return w
+}
+
+// WithRetries updates the maximum retries of requests that fail with a
+// network error or a 5xx or 429 status, and the initial backoff between them.
+func (w *Webhook) WithRetries(maxRetries int, backoff time.Duration) *Webhook {
+	w.maxRetries = maxRetries
+	w.backoff = backoff
+	return w
+}
+
+// WithClock updates the clock used to wait between retries.
+func (w *Webhook) WithClock(clock clockwork.Clock) *Webhook {
+	w.clock = clock
+	return w
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	body, err := w.body(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.send(ctx, body)
+		if err == nil || !retry || attempt >= w.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "webhook retries canceled")
+		case <-w.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// body returns the payload of the event.
+func (w *Webhook) body(event Event) ([]byte, error) {
+	if w.payload == nil {
+		body, err := json.Marshal(event)
+		return body, errors.Wrap(err, "failed to marshal event")
+	}
+
+	var buf bytes.Buffer
+	if err := w.payload.Execute(&buf, event); err != nil {
+		return nil, errors.Wrap(err, "failed to execute payload template")
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.Errorf("payload template produced invalid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// send sends a single request and determines if a failed request should be
+// retried.
+func (w *Webhook) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+	if len(w.secret) != 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, errors.Wrap(err, "request to webhook failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, errors.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
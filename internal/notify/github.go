@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+)
+
+// GitHub sets a commit status on the commit the candidate was built from as
+// the rollout progresses, so the release is visible in the pull request. The
+// status is pending while the candidate receives a part of the traffic,
+// success when it is promoted and failure when it is rolled back. Events whose
+// commit is unknown and inconclusive diagnoses are ignored.
+type GitHub struct {
+	client *http.Client
+	apiURL string
+	token  string
+	repo   string
+}
+
+// NewGitHub initializes a notifier for the repository (OWNER/REPO). The API
+// URL is https://api.github.com or, for GitHub Enterprise Server,
+// https://HOST/api/v3.
+func NewGitHub(client *http.Client, apiURL, token, repo string) (*GitHub, error) {
+	parts := strings.Split(repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("repository must have the form OWNER/REPO, got %q", repo)
+	}
+	return &GitHub{client: client, apiURL: strings.TrimSuffix(apiURL, "/"), token: token, repo: repo}, nil
+}
+
+type githubStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+// Notify implements Notifier.
+func (g *GitHub) Notify(ctx context.Context, event Event) error {
+	if event.CommitSHA == "" {
+		return nil
+	}
+
+	var state, description string
+	switch event.Type {
+	case CandidateDetectedEvent, StepAdvancedEvent:
+		state = "pending"
+		description = fmt.Sprintf("%s is serving %d%% of the traffic", event.Candidate, event.CandidatePercent)
+	case ShadowStartedEvent:
+		state = "pending"
+		description = fmt.Sprintf("%s is receiving shadow traffic", event.Candidate)
+	case PromotionEvent:
+		state = "success"
+		description = fmt.Sprintf("%s is serving all the traffic", event.Candidate)
+	case RollbackEvent:
+		state = "failure"
+		description = fmt.Sprintf("%s was rolled back", event.Candidate)
+		if len(event.FailedChecks) > 0 {
+			description += ": " + strings.Join(event.FailedChecks, ", ")
+		}
+	default:
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/statuses/%s", g.apiURL, g.repo, event.CommitSHA)
+	return postJSONWithHeaders(ctx, g.client, url, map[string]string{
+		"Authorization": "token " + g.token,
+		"Accept":        "application/vnd.github.v3+json",
+	}, githubStatus{
+		State:     state,
+		TargetURL: event.ConsoleURL(),
+		// GitHub rejects descriptions longer than 140 characters.
+		Description: truncate(description, 140),
+		Context:     "cloud-run-release-operator/" + event.Service,
+	})
+}
+
+// GitHubComment posts the final health report of the candidate as a comment on
+// the pull requests associated with its commit when it is promoted or rolled
+// back, so developers get feedback on the canary analysis of their change.
+type GitHubComment struct {
+	client *http.Client
+	apiURL string
+	token  string
+	repo   string
+}
+
+// NewGitHubComment initializes a notifier for the repository (OWNER/REPO).
+func NewGitHubComment(client *http.Client, apiURL, token, repo string) (*GitHubComment, error) {
+	g, err := NewGitHub(client, apiURL, token, repo)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubComment{client: g.client, apiURL: g.apiURL, token: g.token, repo: g.repo}, nil
+}
+
+// Notify implements Notifier.
+func (g *GitHubComment) Notify(ctx context.Context, event Event) error {
+	if event.CommitSHA == "" || !isCompletionEvent(event) {
+		return nil
+	}
+	body, err := reviewComment(event)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Authorization": "token " + g.token,
+		// Listing the pull requests of a commit requires the groot preview.
+		"Accept": "application/vnd.github.groot-preview+json",
+	}
+	var pulls []struct {
+		Number int `json:"number"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/commits/%s/pulls", g.apiURL, g.repo, event.CommitSHA)
+	if err := getJSON(ctx, g.client, url, headers, &pulls); err != nil {
+		return errors.Wrapf(err, "failed to list pull requests of commit %s", event.CommitSHA)
+	}
+	for _, pull := range pulls {
+		url := fmt.Sprintf("%s/repos/%s/issues/%d/comments", g.apiURL, g.repo, pull.Number)
+		if err := postJSONWithHeaders(ctx, g.client, url, headers, map[string]string{"body": body}); err != nil {
+			return errors.Wrapf(err, "failed to comment on pull request #%d", pull.Number)
+		}
+	}
+	return nil
+}
+
+// isCompletionEvent determines if the rollout of the candidate is complete.
+func isCompletionEvent(event Event) bool {
+	return event.Type == PromotionEvent || event.Type == RollbackEvent
+}
+
+// reviewComment returns the Markdown comment posted on pull and merge
+// requests.
+func reviewComment(event Event) (string, error) {
+	report, err := health.RenderReport(config.MarkdownReportFormat, health.Report{
+		Status:      event.Diagnosis,
+		Checks:      event.Checks,
+		Candidate:   event.Candidate,
+		TrafficStep: event.CandidatePercent,
+		LastUpdate:  event.Time,
+	}, event.Steps)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("### %s\n\n%s\n\n[View in Cloud Console](%s)", event.Title(), report, event.ConsoleURL()), nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GitLabComment posts the final health report of the candidate as a note on
+// the merge requests associated with its commit when it is promoted or rolled
+// back.
+type GitLabComment struct {
+	client  *http.Client
+	url     string
+	token   string
+	project string
+}
+
+// NewGitLabComment initializes a notifier for the project, identified by its
+// ID or path (e.g. group/project), of the GitLab instance at the URL.
+func NewGitLabComment(client *http.Client, gitlabURL, token, project string) *GitLabComment {
+	return &GitLabComment{client: client, url: strings.TrimSuffix(gitlabURL, "/"), token: token, project: project}
+}
+
+// Notify implements Notifier.
+func (g *GitLabComment) Notify(ctx context.Context, event Event) error {
+	if event.CommitSHA == "" || !isCompletionEvent(event) {
+		return nil
+	}
+	body, err := reviewComment(event)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"PRIVATE-TOKEN": g.token}
+	projectURL := fmt.Sprintf("%s/api/v4/projects/%s", g.url, url.PathEscape(g.project))
+	var mergeRequests []struct {
+		IID int `json:"iid"`
+	}
+	if err := getJSON(ctx, g.client, fmt.Sprintf("%s/repository/commits/%s/merge_requests", projectURL, event.CommitSHA), headers, &mergeRequests); err != nil {
+		return errors.Wrapf(err, "failed to list merge requests of commit %s", event.CommitSHA)
+	}
+	for _, mr := range mergeRequests {
+		notesURL := fmt.Sprintf("%s/merge_requests/%d/notes", projectURL, mr.IID)
+		if err := postJSONWithHeaders(ctx, g.client, notesURL, headers, map[string]string{"body": body}); err != nil {
+			return errors.Wrapf(err, "failed to comment on merge request !%d", mr.IID)
+		}
+	}
+	return nil
+}
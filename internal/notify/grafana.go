@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Grafana posts an annotation to Grafana on every traffic change, so
+// dashboards show markers where canary steps and rollbacks occurred.
+// Inconclusive diagnoses are ignored since they do not change the traffic.
+type Grafana struct {
+	client       *http.Client
+	url          string
+	apiKey       string
+	dashboardUID string
+}
+
+// NewGrafana initializes a notifier for the Grafana instance at the URL. If
+// the dashboard UID is empty, organization-wide annotations are created.
+func NewGrafana(client *http.Client, url, apiKey, dashboardUID string) *Grafana {
+	return &Grafana{client: client, url: strings.TrimSuffix(url, "/"), apiKey: apiKey, dashboardUID: dashboardUID}
+}
+
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// Notify implements Notifier.
+func (g *Grafana) Notify(ctx context.Context, event Event) error {
+	if isRepeated(event) {
+		return nil
+	}
+	return postJSONWithHeaders(ctx, g.client, g.url+"/api/annotations", map[string]string{
+		"Authorization": "Bearer " + g.apiKey,
+	}, grafanaAnnotation{
+		DashboardUID: g.dashboardUID,
+		// Grafana expects epoch milliseconds.
+		Time: event.Time.UnixNano() / 1e6,
+		Tags: []string{
+			"cloud-run-release-operator",
+			string(event.Type),
+			fmt.Sprintf("service:%s", event.Service),
+			fmt.Sprintf("revision:%s", event.Candidate),
+			fmt.Sprintf("percent:%d", event.CandidatePercent),
+		},
+		Text: event.Title(),
+	})
+}
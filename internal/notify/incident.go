@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Default endpoints of the incident management APIs.
+const (
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	DefaultOpsgenieURL  = "https://api.opsgenie.com"
+)
+
+// PagerDuty triggers a PagerDuty alert when a candidate is rolled back. Other
+// events are ignored.
+type PagerDuty struct {
+	client     *http.Client
+	url        string
+	routingKey string
+}
+
+// NewPagerDuty initializes a notifier for the PagerDuty service with the Events
+// API v2 integration key.
+func NewPagerDuty(client *http.Client, routingKey string) *PagerDuty {
+	return &PagerDuty{client: client, url: DefaultPagerDutyURL, routingKey: routingKey}
+}
+
+// WithURL updates the endpoint of the PagerDuty Events API.
+func (p *PagerDuty) WithURL(url string) *PagerDuty {
+	p.url = url
+	return p
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp"`
+	Component     string `json:"component"`
+	CustomDetails Event  `json:"custom_details"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Notify implements Notifier.
+func (p *PagerDuty) Notify(ctx context.Context, event Event) error {
+	if event.Type != RollbackEvent {
+		return nil
+	}
+	return postJSON(ctx, p.client, p.url, pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    incidentKey(event),
+		Payload: pagerDutyPayload{
+			// The summary is limited to 1024 characters.
+			Summary:       truncate(incidentSummary(event), 1024),
+			Source:        fmt.Sprintf("%s/%s", event.Project, event.Region),
+			Severity:      "error",
+			Timestamp:     event.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+			Component:     event.Service,
+			CustomDetails: event,
+		},
+		Links: []pagerDutyLink{{Href: event.ConsoleURL(), Text: "Cloud Run revisions"}},
+	})
+}
+
+// Opsgenie creates an Opsgenie alert when a candidate is rolled back. Other
+// events are ignored.
+type Opsgenie struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+// NewOpsgenie initializes a notifier for the Opsgenie API at the URL (e.g.
+// DefaultOpsgenieURL or the EU instance) with the API integration key.
+func NewOpsgenie(client *http.Client, url, apiKey string) *Opsgenie {
+	return &Opsgenie{client: client, url: strings.TrimSuffix(url, "/"), apiKey: apiKey}
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Details     map[string]string `json:"details"`
+	Entity      string            `json:"entity"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+}
+
+// Notify implements Notifier.
+func (o *Opsgenie) Notify(ctx context.Context, event Event) error {
+	if event.Type != RollbackEvent {
+		return nil
+	}
+	description := incidentSummary(event) + "\n\n" + event.ConsoleURL()
+	if event.Report != "" {
+		description += "\n\n" + event.Report
+	}
+	return postJSONWithHeaders(ctx, o.client, o.url+"/v2/alerts", map[string]string{
+		"Authorization": "GenieKey " + o.apiKey,
+	}, opsgenieAlert{
+		// The message is limited to 130 characters.
+		Message:     truncate(event.Title(), 130),
+		Alias:       incidentKey(event),
+		Description: description,
+		Details: map[string]string{
+			"project":   event.Project,
+			"region":    event.Region,
+			"service":   event.Service,
+			"stable":    event.Stable,
+			"candidate": event.Candidate,
+			"console":   event.ConsoleURL(),
+		},
+		Entity:   event.Service,
+		Source:   "cloud-run-release-operator",
+		Priority: "P2",
+	})
+}
+
+// incidentKey identifies the alerts of the candidate, so repeated
+// notifications for the same rollback are grouped in a single incident.
+func incidentKey(event Event) string {
+	return fmt.Sprintf("%s/%s/%s/%s", event.Project, event.Region, event.Service, event.Candidate)
+}
+
+// incidentSummary describes the rollback and the failing criteria.
+func incidentSummary(event Event) string {
+	summary := event.Title()
+	if len(event.FailedChecks) != 0 {
+		summary += ", failed checks: " + strings.Join(event.FailedChecks, ", ")
+	}
+	return summary
+}
+
+// truncate shortens the string to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
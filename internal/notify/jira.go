@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jiraLabel is set on the issues opened by the operator.
+const jiraLabel = "cloud-run-release-operator"
+
+// Jira opens a Jira issue when a candidate is rolled back, so failed releases
+// enter the triage workflow. If an unresolved issue was already opened for the
+// service, the rollback is added to it as a comment instead. Other events are
+// ignored.
+type Jira struct {
+	client    *http.Client
+	url       string
+	auth      string
+	project   string
+	issueType string
+}
+
+// NewJira initializes a notifier that opens issues of the type in the project
+// (e.g. OPS) of the Jira site at the URL, authenticating with the email and
+// API token of an account.
+func NewJira(client *http.Client, jiraURL, email, apiToken, project, issueType string) *Jira {
+	return &Jira{
+		client:    client,
+		url:       strings.TrimSuffix(jiraURL, "/"),
+		auth:      "Basic " + base64.StdEncoding.EncodeToString([]byte(email+":"+apiToken)),
+		project:   project,
+		issueType: issueType,
+	}
+}
+
+type jiraIssue struct {
+	Fields jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Project     jiraKey  `json:"project"`
+	IssueType   jiraName `json:"issuetype"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels"`
+}
+
+type jiraKey struct {
+	Key string `json:"key"`
+}
+
+type jiraName struct {
+	Name string `json:"name"`
+}
+
+// Notify implements Notifier.
+func (j *Jira) Notify(ctx context.Context, event Event) error {
+	if event.Type != RollbackEvent {
+		return nil
+	}
+	headers := map[string]string{"Authorization": j.auth}
+	serviceLabel := "cloud-run-service-" + event.Service
+
+	jql := fmt.Sprintf("project = %q AND labels = %q AND labels = %q AND statusCategory != Done ORDER BY created DESC", j.project, jiraLabel, serviceLabel)
+	var result struct {
+		Issues []jiraKey `json:"issues"`
+	}
+	searchURL := fmt.Sprintf("%s/rest/api/2/search?maxResults=1&fields=key&jql=%s", j.url, url.QueryEscape(jql))
+	if err := getJSON(ctx, j.client, searchURL, headers, &result); err != nil {
+		return errors.Wrap(err, "failed to search Jira issues")
+	}
+
+	description := jiraDescription(event)
+	if len(result.Issues) != 0 {
+		key := result.Issues[0].Key
+		commentURL := fmt.Sprintf("%s/rest/api/2/issue/%s/comment", j.url, key)
+		err := postJSONWithHeaders(ctx, j.client, commentURL, headers, map[string]string{"body": description})
+		return errors.Wrapf(err, "failed to comment on Jira issue %s", key)
+	}
+	err := postJSONWithHeaders(ctx, j.client, j.url+"/rest/api/2/issue", headers, jiraIssue{
+		Fields: jiraFields{
+			Project:   jiraKey{Key: j.project},
+			IssueType: jiraName{Name: j.issueType},
+			// The summary is limited to 255 characters.
+			Summary:     truncate(event.Title(), 255),
+			Description: description,
+			Labels:      []string{jiraLabel, serviceLabel},
+		},
+	})
+	return errors.Wrap(err, "failed to open Jira issue")
+}
+
+// jiraDescription describes the rollback in Jira's wiki markup.
+func jiraDescription(event Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", incidentSummary(event))
+	fmt.Fprintf(&b, "* Project: %s\n* Region: %s\n* Service: %s\n", event.Project, event.Region, event.Service)
+	fmt.Fprintf(&b, "* Stable revision: %s\n* Candidate revision: %s\n", event.Stable, event.Candidate)
+	if event.Image != "" {
+		fmt.Fprintf(&b, "* Image: %s\n", event.Image)
+	}
+	if event.CommitSHA != "" {
+		fmt.Fprintf(&b, "* Commit: %s\n", event.CommitSHA)
+	}
+	if event.BuildURL != "" {
+		fmt.Fprintf(&b, "* Build: [%s]\n", event.BuildURL)
+	}
+	fmt.Fprintf(&b, "\n[Cloud Run revisions|%s]", event.ConsoleURL())
+	if event.Report != "" {
+		fmt.Fprintf(&b, "\n\n{noformat}\n%s\n{noformat}", event.Report)
+	}
+	return b.String()
+}
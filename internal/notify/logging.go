@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+)
+
+// DecisionRecordVersion is the version of the schema of the decision records.
+// Fields are only added to the schema; removing or changing a field requires a
+// new version.
+const DecisionRecordVersion = 1
+
+// DecisionRecord is the payload of the log entry written for every
+// traffic-changing action.
+type DecisionRecord struct {
+	SchemaVersion    int                  `json:"schemaVersion"`
+	Action           EventType            `json:"action"`
+	Project          string               `json:"project"`
+	Region           string               `json:"region"`
+	Service          string               `json:"service"`
+	Stable           string               `json:"stable"`
+	Candidate        string               `json:"candidate"`
+	PreviousPercent  int64                `json:"previousPercent"`
+	CandidatePercent int64                `json:"candidatePercent"`
+	Diagnosis        string               `json:"diagnosis"`
+	Checks           []health.CheckReport `json:"checks"`
+	FailedChecks     []string             `json:"failedChecks"`
+}
+
+// CloudLogging writes a structured log entry to a dedicated log in the
+// service's project for every traffic-changing action, so Cloud Logging sinks,
+// log-based metrics and alerts can be built on the decisions. Inconclusive
+// diagnoses are ignored since they do not change the traffic.
+type CloudLogging struct {
+	service *logging.Service
+	logID   string
+}
+
+// NewCloudLogging initializes a notifier that writes the entries to the log
+// with the given ID.
+func NewCloudLogging(ctx context.Context, logID string, opts ...option.ClientOption) (*CloudLogging, error) {
+	service, err := logging.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Logging client")
+	}
+	return &CloudLogging{service: service, logID: logID}, nil
+}
+
+// Notify implements Notifier.
+func (c *CloudLogging) Notify(ctx context.Context, event Event) error {
+	if isRepeated(event) {
+		return nil
+	}
+
+	record := DecisionRecord{
+		SchemaVersion:    DecisionRecordVersion,
+		Action:           event.Type,
+		Project:          event.Project,
+		Region:           event.Region,
+		Service:          event.Service,
+		Stable:           event.Stable,
+		Candidate:        event.Candidate,
+		PreviousPercent:  event.PreviousPercent,
+		CandidatePercent: event.CandidatePercent,
+		Diagnosis:        event.Diagnosis,
+		Checks:           event.Checks,
+		FailedChecks:     event.FailedChecks,
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal decision record")
+	}
+
+	severity := "NOTICE"
+	if event.Type == RollbackEvent || event.Type == QuarantinedEvent || event.Type == StuckEvent || event.Type == UnhealthyEvent ||
+		event.Type == AttestationRefusedEvent || event.Type == VulnerabilitiesRefusedEvent {
+		severity = "WARNING"
+	}
+	entry := &logging.LogEntry{
+		LogName: fmt.Sprintf("projects/%s/logs/%s", event.Project, url.PathEscape(c.logID)),
+		Resource: &logging.MonitoredResource{
+			Type: "cloud_run_revision",
+			Labels: map[string]string{
+				"project_id":         event.Project,
+				"location":           event.Region,
+				"service_name":       event.Service,
+				"configuration_name": event.Service,
+				"revision_name":      event.Candidate,
+			},
+		},
+		Labels: map[string]string{
+			"action":  string(event.Type),
+			"service": event.Service,
+		},
+		Severity:    severity,
+		Timestamp:   event.Time.UTC().Format(time.RFC3339Nano),
+		JsonPayload: payload,
+	}
+	_, err = c.service.Entries.Write(&logging.WriteLogEntriesRequest{Entries: []*logging.LogEntry{entry}}).Context(ctx).Do()
+	return errors.Wrap(err, "failed to write decision log entry")
+}
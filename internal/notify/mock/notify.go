@@ -0,0 +1,23 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+)
+
+// Notifier is a mock implementation of notify.Notifier that records the
+// events.
+type Notifier struct {
+	NotifyFn func(ctx context.Context, event notify.Event) error
+	Events   []notify.Event
+}
+
+// Notify records the event and invokes the mock implementation, if any.
+func (n *Notifier) Notify(ctx context.Context, event notify.Event) error {
+	n.Events = append(n.Events, event)
+	if n.NotifyFn == nil {
+		return nil
+	}
+	return n.NotifyFn(ctx, event)
+}
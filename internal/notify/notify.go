@@ -0,0 +1,232 @@
+// Package notify sends alerts about rollouts and rollbacks to chat platforms.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+)
+
+// EventType is the kind of change made to a service.
+type EventType string
+
+// Types of events.
+const (
+	// CandidateDetectedEvent is sent when a new candidate is first assigned
+	// traffic or, if there are pre-traffic checks, tagged for them.
+	CandidateDetectedEvent EventType = "candidate-detected"
+	// ShadowStartedEvent is sent when a sample of the production requests
+	// starts being mirrored to the candidate, before it receives any traffic.
+	ShadowStartedEvent EventType = "shadow-started"
+	// StepAdvancedEvent is sent when the candidate receives more traffic.
+	StepAdvancedEvent EventType = "step-advanced"
+	// PromotionEvent is sent when the candidate becomes the stable revision.
+	PromotionEvent EventType = "promotion"
+	// RollbackEvent is sent when all the traffic is redirected to the stable
+	// revision because the candidate is unhealthy.
+	RollbackEvent EventType = "rollback"
+	// InconclusiveEvent is sent when the candidate's diagnosis is
+	// inconclusive, so the service is kept unchanged. It is sent on every
+	// rollout process until the diagnosis is conclusive.
+	InconclusiveEvent EventType = "diagnosis-inconclusive"
+	// PolicyDeniedEvent is sent when the policy denies a change of the
+	// traffic, so the service is kept unchanged. The report is the reason. It
+	// is sent on every rollout process until the policy allows the change.
+	PolicyDeniedEvent EventType = "policy-denied"
+	// QuarantinedEvent is sent when the rollout of the service is no longer
+	// handled after too many consecutive operator errors. The report is the
+	// last error.
+	QuarantinedEvent EventType = "quarantined"
+	// StuckEvent is sent once when the candidate is kept at the same traffic
+	// step for longer than the configured delay (e.g. because its diagnoses
+	// are inconclusive). The report explains since when.
+	StuckEvent EventType = "stuck"
+	// UnhealthyEvent is sent once when an unhealthy candidate is kept at its
+	// traffic, instead of being rolled back, for a human to decide (see the
+	// onUnhealthy setting of the strategy). The report is the diagnosis.
+	UnhealthyEvent EventType = "unhealthy"
+	// AttestationRefusedEvent is sent once when a new candidate gets no
+	// traffic because its image lacks the required attestations. The report
+	// is the reason.
+	AttestationRefusedEvent EventType = "attestation-refused"
+	// VulnerabilitiesRefusedEvent is sent once when a candidate is refused
+	// its first traffic or its promotion because its image has
+	// vulnerabilities more severe than allowed. The report is the reason.
+	VulnerabilitiesRefusedEvent EventType = "vulnerabilities-refused"
+)
+
+// Event is the payload shared by all the notifiers. PreviousPercent is the
+// candidate's traffic before the event.
+type Event struct {
+	Type             EventType `json:"type"`
+	Project          string    `json:"project"`
+	Region           string    `json:"region"`
+	Service          string    `json:"service"`
+	Stable           string    `json:"stable"`
+	Candidate        string    `json:"candidate"`
+	CandidatePercent int64     `json:"candidatePercent"`
+	PreviousPercent  int64     `json:"previousPercent"`
+	Report           string    `json:"report,omitempty"`
+	Time             time.Time `json:"time"`
+
+	// ReportFormat is the format of the report when it is the health report
+	// of the service, rendered as configured in the strategy.
+	ReportFormat config.ReportFormat `json:"reportFormat,omitempty"`
+
+	// Diagnosis is the status of the last diagnosis and Checks its results.
+	Diagnosis string               `json:"diagnosis,omitempty"`
+	Checks    []health.CheckReport `json:"checks,omitempty"`
+
+	// FailedChecks summarizes the health criteria the candidate did not meet.
+	FailedChecks []string `json:"failedChecks,omitempty"`
+
+	// CommitSHA is the commit the candidate was built from, if known.
+	CommitSHA string `json:"commitSha,omitempty"`
+
+	// Image is the container image of the candidate pinned to its digest,
+	// and BuildURL the link to the build of the image, if known.
+	Image    string `json:"image,omitempty"`
+	BuildURL string `json:"buildUrl,omitempty"`
+
+	// Steps are the traffic percentages of the rollout strategy.
+	Steps []int64 `json:"steps,omitempty"`
+
+	// ReleaseGroup is the release group of the service, if any.
+	ReleaseGroup string `json:"releaseGroup,omitempty"`
+}
+
+// ConsoleURL returns the link to the service's revisions in the Cloud Console.
+func (e Event) ConsoleURL() string {
+	return fmt.Sprintf("https://console.cloud.google.com/run/detail/%s/%s/revisions?project=%s", e.Region, e.Service, e.Project)
+}
+
+// Title returns a one-line summary of the event.
+func (e Event) Title() string {
+	switch e.Type {
+	case CandidateDetectedEvent:
+		return fmt.Sprintf("Service %s: new candidate %s receives %d%% of the traffic", e.Service, e.Candidate, e.CandidatePercent)
+	case ShadowStartedEvent:
+		return fmt.Sprintf("Service %s: candidate %s receives shadow traffic", e.Service, e.Candidate)
+	case StepAdvancedEvent:
+		return fmt.Sprintf("Service %s: candidate %s now receives %d%% of the traffic", e.Service, e.Candidate, e.CandidatePercent)
+	case PromotionEvent:
+		return fmt.Sprintf("Service %s: candidate %s was promoted to stable", e.Service, e.Candidate)
+	case RollbackEvent:
+		return fmt.Sprintf("Service %s: candidate %s was rolled back to %s", e.Service, e.Candidate, e.Stable)
+	case InconclusiveEvent:
+		return fmt.Sprintf("Service %s: diagnosis of candidate %s is inconclusive", e.Service, e.Candidate)
+	case PolicyDeniedEvent:
+		return fmt.Sprintf("Service %s: change of the traffic of candidate %s was denied by policy", e.Service, e.Candidate)
+	case QuarantinedEvent:
+		return fmt.Sprintf("Service %s: rollout was quarantined after repeated operator errors", e.Service)
+	case StuckEvent:
+		return fmt.Sprintf("Service %s: candidate %s is stuck at %d%% of the traffic", e.Service, e.Candidate, e.CandidatePercent)
+	case UnhealthyEvent:
+		return fmt.Sprintf("Service %s: candidate %s is unhealthy at %d%% of the traffic", e.Service, e.Candidate, e.CandidatePercent)
+	case AttestationRefusedEvent:
+		return fmt.Sprintf("Service %s: candidate %s was refused traffic, its image is not attested", e.Service, e.Candidate)
+	case VulnerabilitiesRefusedEvent:
+		if e.CandidatePercent == 0 {
+			return fmt.Sprintf("Service %s: candidate %s was refused traffic, its image has vulnerabilities", e.Service, e.Candidate)
+		}
+		return fmt.Sprintf("Service %s: candidate %s was refused promotion, its image has vulnerabilities", e.Service, e.Candidate)
+	default:
+		return fmt.Sprintf("Service %s: %s of candidate %s", e.Service, e.Type, e.Candidate)
+	}
+}
+
+// isRepeated determines if the event is sent on every rollout process while
+// the service is kept unchanged, as opposed to a change of the service.
+func isRepeated(event Event) bool {
+	return event.Type == InconclusiveEvent || event.Type == PolicyDeniedEvent
+}
+
+// Notifier represents a destination for rollout alerts.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Multi returns a notifier that sends the events to all the notifiers.
+func Multi(notifiers ...Notifier) Notifier {
+	return multiNotifier(notifiers)
+}
+
+type multiNotifier []Notifier
+
+// Notify sends the event to all the notifiers, even if some of them fail.
+func (m multiNotifier) Notify(ctx context.Context, event Event) error {
+	var msgs []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, event); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.Errorf("failed to send %d notification(s): %s", len(msgs), strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// postJSON sends the payload to the webhook.
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	return postJSONWithHeaders(ctx, client, url, nil, payload)
+}
+
+// postJSONWithHeaders sends the payload to the webhook with additional
+// headers (e.g. for authentication).
+func postJSONWithHeaders(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request to webhook failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// getJSON sends a GET request to the API and decodes the JSON response in v.
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("request returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "failed to decode response")
+}
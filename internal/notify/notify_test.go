@@ -0,0 +1,829 @@
+package notify_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestNotifiers(t *testing.T) {
+	event := notify.Event{
+		Type:      notify.RollbackEvent,
+		Project:   "myproject",
+		Region:    "us-east1",
+		Service:   "mysvc",
+		Stable:    "mysvc-001",
+		Candidate: "mysvc-002",
+		Report:    "status: unhealthy",
+		Time:      time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	title := "Service mysvc: candidate mysvc-002 was rolled back to mysvc-001"
+	chatText := "*" + title + "*\nproject: myproject, region: us-east1, stable: mysvc-001\n```\nstatus: unhealthy\n```"
+
+	tests := []struct {
+		name     string
+		notifier func(client *http.Client, url string) notify.Notifier
+		expected map[string]interface{}
+	}{
+		{
+			name: "slack",
+			notifier: func(client *http.Client, url string) notify.Notifier {
+				return notify.NewSlack(client, url)
+			},
+			expected: map[string]interface{}{"text": chatText},
+		},
+		{
+			name: "google chat",
+			notifier: func(client *http.Client, url string) notify.Notifier {
+				return notify.NewGoogleChat(client, url)
+			},
+			expected: map[string]interface{}{"text": chatText},
+		},
+		{
+			name: "teams",
+			notifier: func(client *http.Client, url string) notify.Notifier {
+				return notify.NewTeams(client, url)
+			},
+			expected: map[string]interface{}{
+				"@type":      "MessageCard",
+				"@context":   "https://schema.org/extensions",
+				"summary":    title,
+				"themeColor": "D50200",
+				"title":      title,
+				"text":       "Project: myproject, region: us-east1, stable: mysvc-001\n\nstatus: unhealthy",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var payload map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, http.MethodPost, r.Method)
+				assert.Equal(tt, "application/json", r.Header.Get("Content-Type"))
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Nil(tt, json.Unmarshal(body, &payload))
+			}))
+			defer server.Close()
+
+			err := test.notifier(server.Client(), server.URL).Notify(context.Background(), event)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, payload)
+		})
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var requests int
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid webhook", http.StatusNotFound)
+	}))
+	defer failing.Close()
+
+	notifier := notify.Multi(
+		notify.NewGoogleChat(ok.Client(), failing.URL),
+		notify.NewTeams(ok.Client(), ok.URL),
+	)
+	err := notifier.Notify(context.Background(), notify.Event{Type: notify.PromotionEvent})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "webhook returned status 404: invalid webhook")
+	// A failing notifier does not prevent the others from being notified.
+	assert.Equal(t, 1, requests)
+}
+
+func TestIncidentNotifiers(t *testing.T) {
+	event := notify.Event{
+		Type:         notify.RollbackEvent,
+		Project:      "myproject",
+		Region:       "us-east1",
+		Service:      "mysvc",
+		Stable:       "mysvc-001",
+		Candidate:    "mysvc-002",
+		Time:         time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		FailedChecks: []string{"error-rate-percent: 10.00 (needs 5.00)"},
+	}
+	summary := "Service mysvc: candidate mysvc-002 was rolled back to mysvc-001, failed checks: error-rate-percent: 10.00 (needs 5.00)"
+	consoleURL := "https://console.cloud.google.com/run/detail/us-east1/mysvc/revisions?project=myproject"
+
+	t.Run("pagerduty", func(tt *testing.T) {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(tt, json.Unmarshal(body, &payload))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		notifier := notify.NewPagerDuty(server.Client(), "routing-key").WithURL(server.URL)
+		assert.Nil(tt, notifier.Notify(context.Background(), event))
+		assert.Equal(tt, "routing-key", payload["routing_key"])
+		assert.Equal(tt, "trigger", payload["event_action"])
+		assert.Equal(tt, "myproject/us-east1/mysvc/mysvc-002", payload["dedup_key"])
+		details := payload["payload"].(map[string]interface{})
+		assert.Equal(tt, summary, details["summary"])
+		assert.Equal(tt, "error", details["severity"])
+		assert.Equal(tt, "2020-06-01T00:00:00.000Z", details["timestamp"])
+		links := payload["links"].([]interface{})
+		assert.Equal(tt, consoleURL, links[0].(map[string]interface{})["href"])
+	})
+
+	t.Run("opsgenie", func(tt *testing.T) {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(tt, "/v2/alerts", r.URL.Path)
+			assert.Equal(tt, "GenieKey api-key", r.Header.Get("Authorization"))
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(tt, json.Unmarshal(body, &payload))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		notifier := notify.NewOpsgenie(server.Client(), server.URL+"/", "api-key")
+		assert.Nil(tt, notifier.Notify(context.Background(), event))
+		assert.Equal(tt, "Service mysvc: candidate mysvc-002 was rolled back to mysvc-001", payload["message"])
+		assert.Equal(tt, "myproject/us-east1/mysvc/mysvc-002", payload["alias"])
+		assert.Equal(tt, summary+"\n\n"+consoleURL, payload["description"])
+		assert.Equal(tt, "P2", payload["priority"])
+	})
+
+	t.Run("other events are ignored", func(tt *testing.T) {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+		defer server.Close()
+
+		event := event
+		event.Type = notify.PromotionEvent
+		assert.Nil(tt, notify.NewPagerDuty(server.Client(), "key").WithURL(server.URL).Notify(context.Background(), event))
+		assert.Nil(tt, notify.NewOpsgenie(server.Client(), server.URL, "key").Notify(context.Background(), event))
+		assert.Equal(tt, 0, requests)
+	})
+}
+
+func TestSendGrid(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer api-key", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &payload))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := notify.NewSendGrid(server.Client(), "api-key", "operator@example.com", []string{"a@example.com"}).
+		WithURL(server.URL)
+	event := notify.Event{
+		Type:         notify.PromotionEvent,
+		Project:      "myproject",
+		Region:       "us-east1",
+		Service:      "mysvc",
+		Stable:       "mysvc-001",
+		Candidate:    "mysvc-002",
+		Report:       "<p><strong>Status:</strong> healthy</p>",
+		ReportFormat: config.HTMLReportFormat,
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+
+	expected := map[string]interface{}{
+		"personalizations": []interface{}{
+			map[string]interface{}{"to": []interface{}{map[string]interface{}{"email": "a@example.com"}}},
+		},
+		"from":    map[string]interface{}{"email": "operator@example.com"},
+		"subject": "[cloud-run-release-operator] Service mysvc: candidate mysvc-002 was promoted to stable",
+		"content": []interface{}{
+			map[string]interface{}{
+				"type": "text/html",
+				"value": "<p>Service mysvc: candidate mysvc-002 was promoted to stable</p>\n" +
+					"<p>Project: myproject</p>\n" +
+					"<p>Region: us-east1</p>\n" +
+					"<p>Stable revision: mysvc-001</p>\n" +
+					"<p>Candidate revision: mysvc-002</p>\n" +
+					"<p>Revisions: https://console.cloud.google.com/run/detail/us-east1/mysvc/revisions?project=myproject</p>\n" +
+					"<p><strong>Status:</strong> healthy</p>",
+			},
+		},
+	}
+	assert.Equal(t, expected, payload)
+}
+
+func TestWebhook(t *testing.T) {
+	event := notify.Event{
+		Type:             notify.StepAdvancedEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 20,
+		Time:             time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name          string
+		template      string
+		secret        string
+		statuses      []int
+		expectedBody  string
+		expectedCalls int
+		shouldErr     bool
+	}{
+		{
+			name:          "default payload",
+			statuses:      []int{http.StatusOK},
+			expectedBody:  `{"type":"step-advanced","project":"myproject","region":"us-east1","service":"mysvc","stable":"mysvc-001","candidate":"mysvc-002","candidatePercent":20,"previousPercent":0,"time":"2020-06-01T00:00:00Z"}`,
+			expectedCalls: 1,
+		},
+		{
+			name:          "templated payload with signature",
+			template:      `{"text": {{json .Title}}, "percent": {{.CandidatePercent}}}`,
+			secret:        "secret",
+			statuses:      []int{http.StatusOK},
+			expectedBody:  `{"text": "Service mysvc: candidate mysvc-002 now receives 20% of the traffic", "percent": 20}`,
+			expectedCalls: 1,
+		},
+		{
+			name:          "server errors are retried",
+			statuses:      []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK},
+			expectedCalls: 3,
+		},
+		{
+			name:          "retries are exhausted",
+			statuses:      []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			expectedCalls: 3,
+			shouldErr:     true,
+		},
+		{
+			name:          "client errors are not retried",
+			statuses:      []int{http.StatusBadRequest, http.StatusOK},
+			expectedCalls: 1,
+			shouldErr:     true,
+		},
+		{
+			name:      "invalid JSON payload",
+			template:  `{"text": {{.Title}}}`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "value", r.Header.Get("X-Custom"))
+				body, _ := ioutil.ReadAll(r.Body)
+				if test.expectedBody != "" {
+					assert.Equal(tt, test.expectedBody, string(body))
+				}
+				if test.secret != "" {
+					mac := hmac.New(sha256.New, []byte(test.secret))
+					mac.Write(body)
+					assert.Equal(tt, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(notify.SignatureHeader))
+				} else {
+					assert.Equal(tt, "", r.Header.Get(notify.SignatureHeader))
+				}
+				w.WriteHeader(test.statuses[calls])
+				calls++
+			}))
+			defer server.Close()
+
+			webhook, err := notify.NewWebhook(server.Client(), server.URL, test.template, map[string]string{"X-Custom": "value"})
+			assert.Nil(tt, err)
+			webhook = webhook.WithRetries(2, time.Millisecond)
+			if test.secret != "" {
+				webhook = webhook.WithSecret(test.secret)
+			}
+
+			err = webhook.Notify(context.Background(), event)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+			assert.Equal(tt, test.expectedCalls, calls)
+		})
+	}
+
+	_, err := notify.NewWebhook(http.DefaultClient, "http://example.com", "{{.Title", nil)
+	assert.NotNil(t, err)
+}
+
+type fakePublisher struct {
+	topic      string
+	data       []byte
+	attributes map[string]string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error {
+	p.topic, p.data, p.attributes = topic, data, attributes
+	return nil
+}
+
+func TestCloudEvents(t *testing.T) {
+	event := notify.Event{
+		Type:             notify.InconclusiveEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 20,
+		Time:             time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	eventJSON := `{"type":"diagnosis-inconclusive","project":"myproject","region":"us-east1","service":"mysvc","stable":"mysvc-001","candidate":"mysvc-002","candidatePercent":20,"previousPercent":0,"time":"2020-06-01T00:00:00Z"}`
+	source := "//run.googleapis.com/projects/myproject/locations/us-east1/services/mysvc"
+
+	t.Run("http", func(tt *testing.T) {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(tt, "application/cloudevents+json; charset=utf-8", r.Header.Get("Content-Type"))
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(tt, json.Unmarshal(body, &payload))
+		}))
+		defer server.Close()
+
+		assert.Nil(tt, notify.NewCloudEventsHTTP(server.Client(), server.URL).Notify(context.Background(), event))
+		assert.Len(tt, payload["id"], 32)
+		delete(payload, "id")
+		var data map[string]interface{}
+		json.Unmarshal([]byte(eventJSON), &data)
+		expected := map[string]interface{}{
+			"specversion":     "1.0",
+			"source":          source,
+			"type":            "run.cloud.rollout.DiagnosisInconclusive",
+			"subject":         "mysvc-002",
+			"time":            "2020-06-01T00:00:00Z",
+			"datacontenttype": "application/json",
+			"data":            data,
+		}
+		assert.Equal(tt, expected, payload)
+	})
+
+	t.Run("pubsub", func(tt *testing.T) {
+		publisher := &fakePublisher{}
+		err := notify.NewCloudEventsPubSub(publisher, "projects/myproject/topics/rollouts").Notify(context.Background(), event)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "projects/myproject/topics/rollouts", publisher.topic)
+		assert.Equal(tt, eventJSON, string(publisher.data))
+		assert.Len(tt, publisher.attributes["ce-id"], 32)
+		delete(publisher.attributes, "ce-id")
+		expected := map[string]string{
+			"ce-specversion": "1.0",
+			"ce-source":      source,
+			"ce-type":        "run.cloud.rollout.DiagnosisInconclusive",
+			"ce-subject":     "mysvc-002",
+			"ce-time":        "2020-06-01T00:00:00Z",
+			"content-type":   "application/json",
+		}
+		assert.Equal(tt, expected, publisher.attributes)
+	})
+
+	t.Run("event types", func(tt *testing.T) {
+		types := map[notify.EventType]string{
+			notify.CandidateDetectedEvent: "run.cloud.rollout.CandidateDetected",
+			notify.StepAdvancedEvent:      "run.cloud.rollout.StepAdvanced",
+			notify.PromotionEvent:         "run.cloud.rollout.Promoted",
+			notify.RollbackEvent:          "run.cloud.rollout.RolledBack",
+		}
+		for eventType, expected := range types {
+			ce, err := notify.NewCloudEvent(notify.Event{Type: eventType})
+			assert.Nil(tt, err)
+			assert.Equal(tt, expected, ce.Type)
+		}
+		_, err := notify.NewCloudEvent(notify.Event{Type: "unknown"})
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestPubSub(t *testing.T) {
+	publisher := &fakePublisher{}
+	event := notify.Event{
+		Type:             notify.StepAdvancedEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 50,
+		Time:             time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	err := notify.NewPubSub(publisher, "projects/myproject/topics/rollouts").Notify(context.Background(), event)
+	assert.Nil(t, err)
+	assert.Equal(t, "projects/myproject/topics/rollouts", publisher.topic)
+	assert.Equal(t, `{"type":"step-advanced","project":"myproject","region":"us-east1","service":"mysvc","stable":"mysvc-001","candidate":"mysvc-002","candidatePercent":50,"previousPercent":0,"time":"2020-06-01T00:00:00Z"}`, string(publisher.data))
+	expected := map[string]string{
+		"type":             "step-advanced",
+		"project":          "myproject",
+		"region":           "us-east1",
+		"service":          "mysvc",
+		"candidate":        "mysvc-002",
+		"candidatePercent": "50",
+	}
+	assert.Equal(t, expected, publisher.attributes)
+}
+
+func TestBigQuery(t *testing.T) {
+	value := 10.0
+	event := notify.Event{
+		Type:             notify.RollbackEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 0,
+		PreviousPercent:  20,
+		Time:             time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		Diagnosis:        "unhealthy",
+		Checks: []health.CheckReport{
+			{Criterion: "error-rate-percent", Threshold: 5, ActualValue: &value},
+			{Criterion: "request-latency[p99]", Threshold: 750, Reason: "no metrics data for the candidate revision"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		response  string
+		shouldErr bool
+	}{
+		{
+			name:     "row inserted",
+			response: `{}`,
+		},
+		{
+			name:      "insert errors",
+			response:  `{"insertErrors": [{"index": 0, "errors": [{"reason": "invalid", "message": "no such field"}]}]}`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var req map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "/projects/myproject/datasets/mydataset/tables/mytable/insertAll", r.URL.Path)
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Nil(tt, json.Unmarshal(body, &req))
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			bq, err := notify.NewBigQuery(context.Background(), "myproject.mydataset.mytable",
+				option.WithEndpoint(server.URL), option.WithoutAuthentication())
+			assert.Nil(tt, err)
+			err = bq.Notify(context.Background(), event)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+
+			expected := map[string]interface{}{
+				"insertId": "myproject/us-east1/mysvc/mysvc-002/rollback/1590969600000000000",
+				"json": map[string]interface{}{
+					"timestamp":        "2020-06-01T00:00:00Z",
+					"type":             "rollback",
+					"project":          "myproject",
+					"region":           "us-east1",
+					"service":          "mysvc",
+					"stable":           "mysvc-001",
+					"candidate":        "mysvc-002",
+					"previousPercent":  float64(20),
+					"candidatePercent": float64(0),
+					"diagnosis":        "unhealthy",
+					"checks": []interface{}{
+						map[string]interface{}{"criterion": "error-rate-percent", "value": float64(10), "threshold": float64(5), "met": false},
+						map[string]interface{}{"criterion": "request-latency[p99]", "threshold": float64(750), "met": false, "reason": "no metrics data for the candidate revision"},
+					},
+				},
+			}
+			assert.Equal(tt, []interface{}{expected}, req["rows"])
+		})
+	}
+
+	_, err := notify.NewBigQuery(context.Background(), "mydataset.mytable")
+	assert.NotNil(t, err)
+}
+
+func TestCloudLogging(t *testing.T) {
+	var (
+		requests int
+		req      map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v2/entries:write", r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &req))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	notifier, err := notify.NewCloudLogging(context.Background(), "rollout/decisions",
+		option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	assert.Nil(t, err)
+	event := notify.Event{
+		Type:             notify.RollbackEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Stable:           "mysvc-001",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 0,
+		PreviousPercent:  20,
+		Time:             time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		Diagnosis:        "unhealthy",
+		FailedChecks:     []string{"error-rate-percent: 10.00 (needs 5.00)"},
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+
+	expected := map[string]interface{}{
+		"logName": "projects/myproject/logs/rollout%2Fdecisions",
+		"resource": map[string]interface{}{
+			"type": "cloud_run_revision",
+			"labels": map[string]interface{}{
+				"project_id":         "myproject",
+				"location":           "us-east1",
+				"service_name":       "mysvc",
+				"configuration_name": "mysvc",
+				"revision_name":      "mysvc-002",
+			},
+		},
+		"labels":    map[string]interface{}{"action": "rollback", "service": "mysvc"},
+		"severity":  "WARNING",
+		"timestamp": "2020-06-01T00:00:00Z",
+		"jsonPayload": map[string]interface{}{
+			"schemaVersion":    float64(1),
+			"action":           "rollback",
+			"project":          "myproject",
+			"region":           "us-east1",
+			"service":          "mysvc",
+			"stable":           "mysvc-001",
+			"candidate":        "mysvc-002",
+			"previousPercent":  float64(20),
+			"candidatePercent": float64(0),
+			"diagnosis":        "unhealthy",
+			"checks":           nil,
+			"failedChecks":     []interface{}{"error-rate-percent: 10.00 (needs 5.00)"},
+		},
+	}
+	assert.Equal(t, []interface{}{expected}, req["entries"])
+
+	// Inconclusive diagnoses do not change the traffic.
+	event.Type = notify.InconclusiveEvent
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, 1, requests)
+}
+
+func TestGrafana(t *testing.T) {
+	var (
+		requests int
+		payload  map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/api/annotations", r.URL.Path)
+		assert.Equal(t, "Bearer api-key", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &payload))
+	}))
+	defer server.Close()
+
+	notifier := notify.NewGrafana(server.Client(), server.URL+"/", "api-key", "dashboard")
+	event := notify.Event{
+		Type:             notify.StepAdvancedEvent,
+		Service:          "mysvc",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 40,
+		Time:             time.Date(2020, 6, 1, 0, 0, 1, 0, time.UTC),
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	expected := map[string]interface{}{
+		"dashboardUID": "dashboard",
+		"time":         float64(1590969601000),
+		"tags":         []interface{}{"cloud-run-release-operator", "step-advanced", "service:mysvc", "revision:mysvc-002", "percent:40"},
+		"text":         "Service mysvc: candidate mysvc-002 now receives 40% of the traffic",
+	}
+	assert.Equal(t, expected, payload)
+
+	event.Type = notify.InconclusiveEvent
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, 1, requests)
+}
+
+func TestGitHub(t *testing.T) {
+	_, err := notify.NewGitHub(http.DefaultClient, "https://api.github.com", "token", "owner")
+	assert.NotNil(t, err)
+
+	var (
+		requests int
+		payload  map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/repos/owner/repo/statuses/abc123", r.URL.Path)
+		assert.Equal(t, "token gh-token", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &payload))
+	}))
+	defer server.Close()
+
+	notifier, err := notify.NewGitHub(server.Client(), server.URL+"/", "gh-token", "owner/repo")
+	assert.Nil(t, err)
+	event := notify.Event{
+		Type:             notify.StepAdvancedEvent,
+		Project:          "myproject",
+		Region:           "us-east1",
+		Service:          "mysvc",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 40,
+		CommitSHA:        "abc123",
+	}
+
+	tests := []struct {
+		eventType    notify.EventType
+		failedChecks []string
+		state        string
+		description  string
+	}{
+		{notify.StepAdvancedEvent, nil, "pending", "mysvc-002 is serving 40% of the traffic"},
+		{notify.PromotionEvent, nil, "success", "mysvc-002 is serving all the traffic"},
+		{notify.RollbackEvent, []string{"error-rate-percent"}, "failure", "mysvc-002 was rolled back: error-rate-percent"},
+	}
+	for _, test := range tests {
+		event.Type = test.eventType
+		event.FailedChecks = test.failedChecks
+		assert.Nil(t, notifier.Notify(context.Background(), event))
+		expected := map[string]interface{}{
+			"state":       test.state,
+			"target_url":  event.ConsoleURL(),
+			"description": test.description,
+			"context":     "cloud-run-release-operator/mysvc",
+		}
+		assert.Equal(t, expected, payload, test.eventType)
+	}
+
+	event.Type = notify.InconclusiveEvent
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	event.Type = notify.StepAdvancedEvent
+	event.CommitSHA = ""
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, len(tests), requests)
+}
+
+func TestGitHubComment(t *testing.T) {
+	var comments []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token gh-token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/repos/owner/repo/commits/abc123/pulls":
+			w.Write([]byte(`[{"number": 7}]`))
+		case "/repos/owner/repo/issues/7/comments":
+			var payload map[string]string
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &payload))
+			comments = append(comments, payload["body"])
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	notifier, err := notify.NewGitHubComment(server.Client(), server.URL, "gh-token", "owner/repo")
+	assert.Nil(t, err)
+	event := notify.Event{
+		Type:             notify.StepAdvancedEvent,
+		Service:          "mysvc",
+		Candidate:        "mysvc-002",
+		CandidatePercent: 40,
+		Diagnosis:        "healthy",
+		CommitSHA:        "abc123",
+		Steps:            []int64{10, 40},
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Empty(t, comments)
+
+	event.Type = notify.PromotionEvent
+	event.CandidatePercent = 100
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "### Service mysvc: candidate mysvc-002 was promoted to stable")
+	assert.Contains(t, comments[0], "**Status:** healthy")
+	assert.Contains(t, comments[0], "✓ 10% → ✓ 40% → **100%**")
+}
+
+func TestGitLabComment(t *testing.T) {
+	var comments []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gl-token", r.Header.Get("PRIVATE-TOKEN"))
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fproject/repository/commits/abc123/merge_requests":
+			w.Write([]byte(`[{"iid": 3}, {"iid": 4}]`))
+		case "/api/v4/projects/group%2Fproject/merge_requests/3/notes", "/api/v4/projects/group%2Fproject/merge_requests/4/notes":
+			var payload map[string]string
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(body, &payload))
+			comments = append(comments, payload["body"])
+		default:
+			t.Errorf("unexpected request to %s", r.URL.EscapedPath())
+		}
+	}))
+	defer server.Close()
+
+	notifier := notify.NewGitLabComment(server.Client(), server.URL+"/", "gl-token", "group/project")
+	event := notify.Event{
+		Type:      notify.RollbackEvent,
+		Service:   "mysvc",
+		Candidate: "mysvc-002",
+		Diagnosis: "unhealthy",
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Empty(t, comments)
+
+	event.CommitSHA = "abc123"
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Len(t, comments, 2)
+	assert.Contains(t, comments[0], "**Status:** unhealthy")
+}
+
+func TestJira(t *testing.T) {
+	var (
+		existing string
+		created  map[string]interface{}
+		comments []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "me@example.com", user)
+		assert.Equal(t, "api-token", pass)
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/rest/api/2/search":
+			assert.Equal(t, `project = "OPS" AND labels = "cloud-run-release-operator" AND labels = "cloud-run-service-mysvc" AND statusCategory != Done ORDER BY created DESC`, r.URL.Query().Get("jql"))
+			if existing == "" {
+				w.Write([]byte(`{"issues": []}`))
+				return
+			}
+			fmt.Fprintf(w, `{"issues": [{"key": %q}]}`, existing)
+		case "/rest/api/2/issue":
+			assert.Nil(t, json.Unmarshal(body, &created))
+			w.Write([]byte(`{"key": "OPS-1"}`))
+		case "/rest/api/2/issue/OPS-1/comment":
+			var payload map[string]string
+			assert.Nil(t, json.Unmarshal(body, &payload))
+			comments = append(comments, payload["body"])
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	notifier := notify.NewJira(server.Client(), server.URL+"/", "me@example.com", "api-token", "OPS", "Bug")
+	event := notify.Event{
+		Type:         notify.StepAdvancedEvent,
+		Project:      "myproject",
+		Region:       "us-east1",
+		Service:      "mysvc",
+		Stable:       "mysvc-001",
+		Candidate:    "mysvc-002",
+		FailedChecks: []string{"error-rate-percent: 10.00 (needs 5.00)"},
+	}
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Nil(t, created)
+
+	event.Type = notify.RollbackEvent
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	fields := created["fields"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"key": "OPS"}, fields["project"])
+	assert.Equal(t, map[string]interface{}{"name": "Bug"}, fields["issuetype"])
+	assert.Equal(t, "Service mysvc: candidate mysvc-002 was rolled back to mysvc-001", fields["summary"])
+	assert.Equal(t, []interface{}{"cloud-run-release-operator", "cloud-run-service-mysvc"}, fields["labels"])
+	assert.Contains(t, fields["description"], "failed checks: error-rate-percent: 10.00 (needs 5.00)")
+	assert.Contains(t, fields["description"], "* Candidate revision: mysvc-002")
+
+	existing = "OPS-1"
+	assert.Nil(t, notifier.Notify(context.Background(), event))
+	assert.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "* Candidate revision: mysvc-002")
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+// Publisher represents a client that publishes messages to Pub/Sub topics.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error
+}
+
+// APIPublisher publishes messages through the Pub/Sub API.
+type APIPublisher struct {
+	service *pubsub.Service
+}
+
+// NewAPIPublisher initializes a client for the Pub/Sub API.
+func NewAPIPublisher(ctx context.Context, opts ...option.ClientOption) (*APIPublisher, error) {
+	service, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Pub/Sub client")
+	}
+	return &APIPublisher{service: service}, nil
+}
+
+// Publish publishes a message to the topic (projects/PROJECT/topics/TOPIC).
+func (p *APIPublisher) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error {
+	req := &pubsub.PublishRequest{
+		Messages: []*pubsub.PubsubMessage{{
+			Data:       base64.StdEncoding.EncodeToString(data),
+			Attributes: attributes,
+		}},
+	}
+	_, err := p.service.Projects.Topics.Publish(topic, req).Context(ctx).Do()
+	return errors.Wrapf(err, "failed to publish message to %q", topic)
+}
+
+// PubSub publishes a message per rollout decision to a Pub/Sub topic. The
+// message data is the JSON encoding of the event and the message attributes
+// include the event type, the service and the candidate's traffic, so
+// subscriptions can filter on them (e.g. attributes.candidatePercent = "50").
+type PubSub struct {
+	publisher Publisher
+	topic     string
+}
+
+// NewPubSub initializes a notifier that publishes the events to the topic
+// (projects/PROJECT/topics/TOPIC).
+func NewPubSub(publisher Publisher, topic string) *PubSub {
+	return &PubSub{publisher: publisher, topic: topic}
+}
+
+// Notify implements Notifier.
+func (p *PubSub) Notify(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+	return p.publisher.Publish(ctx, p.topic, data, map[string]string{
+		"type":             string(event.Type),
+		"project":          event.Project,
+		"region":           event.Region,
+		"service":          event.Service,
+		"candidate":        event.Candidate,
+		"candidatePercent": strconv.FormatInt(event.CandidatePercent, 10),
+	})
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Slack sends the events to a Slack incoming webhook.
+type Slack struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// NewSlack initializes a notifier for the Slack incoming webhook.
+func NewSlack(client *http.Client, webhookURL string) *Slack {
+	return &Slack{client: client, webhookURL: webhookURL}
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, event Event) error {
+	if !isChatEvent(event) {
+		return nil
+	}
+	return postJSON(ctx, s.client, s.webhookURL, map[string]string{
+		"text": chatText(event),
+	})
+}
+
+// GoogleChat sends the events to a Google Chat incoming webhook.
+type GoogleChat struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// NewGoogleChat initializes a notifier for the Google Chat incoming webhook.
+func NewGoogleChat(client *http.Client, webhookURL string) *GoogleChat {
+	return &GoogleChat{client: client, webhookURL: webhookURL}
+}
+
+// Notify implements Notifier.
+func (g *GoogleChat) Notify(ctx context.Context, event Event) error {
+	if !isChatEvent(event) {
+		return nil
+	}
+	return postJSON(ctx, g.client, g.webhookURL, map[string]string{
+		"text": chatText(event),
+	})
+}
+
+// Teams sends the events to a Microsoft Teams incoming webhook connector.
+type Teams struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// NewTeams initializes a notifier for the Microsoft Teams connector.
+func NewTeams(client *http.Client, webhookURL string) *Teams {
+	return &Teams{client: client, webhookURL: webhookURL}
+}
+
+// teamsMessageCard is the legacy actionable message card accepted by Teams
+// connectors.
+type teamsMessageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// Notify implements Notifier.
+func (t *Teams) Notify(ctx context.Context, event Event) error {
+	if !isChatEvent(event) {
+		return nil
+	}
+	color := "2EB886"
+	if event.Type == RollbackEvent || event.Type == QuarantinedEvent || event.Type == StuckEvent || event.Type == UnhealthyEvent ||
+		event.Type == AttestationRefusedEvent || event.Type == VulnerabilitiesRefusedEvent {
+		color = "D50200"
+	}
+	text := fmt.Sprintf("Project: %s, region: %s, stable: %s", event.Project, event.Region, event.Stable)
+	if event.Report != "" {
+		text += "\n\n" + event.Report
+	}
+	return postJSON(ctx, t.client, t.webhookURL, teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    event.Title(),
+		ThemeColor: color,
+		Title:      event.Title(),
+		Text:       text,
+	})
+}
+
+// isChatEvent determines if the event is posted to chat platforms.
+// Inconclusive diagnoses and policy denials are not, since they are repeated
+// on every rollout process.
+func isChatEvent(event Event) bool {
+	return !isRepeated(event)
+}
+
+// chatText returns the message used by chat platforms that only accept text.
+func chatText(event Event) string {
+	text := fmt.Sprintf("*%s*\nproject: %s, region: %s, stable: %s", event.Title(), event.Project, event.Region, event.Stable)
+	if event.Report != "" {
+		text += "\n```\n" + event.Report + "\n```"
+	}
+	return text
+}
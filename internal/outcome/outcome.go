@@ -0,0 +1,81 @@
+// Package outcome defines the outcomes of the rollouts in the single-shot
+// modes (-once and -run-once) and the exit codes they map to, so CI pipelines
+// can branch on the outcome of the rollouts.
+package outcome
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+)
+
+// Outcomes of the rollout of a service.
+const (
+	Stable       = "stable"
+	RollingOut   = "rollingOut"
+	Promoted     = "promoted"
+	Paused       = "paused"
+	Denied       = "denied"
+	RolledBack   = "rolledBack"
+	Inconclusive = "inconclusive"
+	TimedOut     = "timedOut"
+	Quarantined  = "quarantined"
+	Skipped      = "skipped"
+	Error        = "error"
+)
+
+// Exit codes of the single-shot modes. When several apply, the highest one
+// is used.
+const (
+	ExitRolledBack    = 2
+	ExitInconclusive  = 3
+	ExitOperatorError = 4
+	ExitTimedOut      = 5
+)
+
+// exitCodes are the exit codes of the outcomes that are not successful.
+var exitCodes = map[string]int{
+	RolledBack:   ExitRolledBack,
+	Inconclusive: ExitInconclusive,
+	Quarantined:  ExitOperatorError,
+	Skipped:      ExitOperatorError,
+	Error:        ExitOperatorError,
+	TimedOut:     ExitTimedOut,
+}
+
+// Of returns the outcome of the rollout cycle of the record.
+func Of(record archive.Record) string {
+	switch record.Decision {
+	case archive.ErrorDecision:
+		return Error
+	case archive.RollbackDecision:
+		return RolledBack
+	case archive.PromotionDecision:
+		return Promoted
+	case archive.NoCandidateDecision:
+		return Stable
+	case archive.PausedDecision:
+		return Paused
+	case archive.DeniedDecision:
+		return Denied
+	}
+	if record.Report != nil && record.Report.Status == health.Inconclusive.String() {
+		return Inconclusive
+	}
+	return RollingOut
+}
+
+// ExitCode returns the exit code of a run: the highest exit code of the
+// outcomes, at least ExitOperatorError if the run failed (e.g. the services
+// of a region could not be listed), or 0 if all the rollouts are successful.
+func ExitCode(outcomes []string, failed bool) int {
+	code := 0
+	if failed {
+		code = ExitOperatorError
+	}
+	for _, outcome := range outcomes {
+		if c := exitCodes[outcome]; c > code {
+			code = c
+		}
+	}
+	return code
+}
@@ -0,0 +1,102 @@
+package outcome_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/outcome"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   archive.Record
+		expected string
+	}{
+		{
+			name:     "promotion",
+			record:   archive.Record{Decision: archive.PromotionDecision},
+			expected: outcome.Promoted,
+		},
+		{
+			name:     "rollback",
+			record:   archive.Record{Decision: archive.RollbackDecision},
+			expected: outcome.RolledBack,
+		},
+		{
+			name:     "no candidate",
+			record:   archive.Record{Decision: archive.NoCandidateDecision},
+			expected: outcome.Stable,
+		},
+		{
+			name:     "error",
+			record:   archive.Record{Decision: archive.ErrorDecision},
+			expected: outcome.Error,
+		},
+		{
+			name:     "inconclusive diagnosis",
+			record:   archive.Record{Decision: archive.UnchangedDecision, Report: &health.Report{Status: health.Inconclusive.String()}},
+			expected: outcome.Inconclusive,
+		},
+		{
+			name:     "roll forward",
+			record:   archive.Record{Decision: archive.RollForwardDecision},
+			expected: outcome.RollingOut,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, outcome.Of(test.record))
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []string
+		failed   bool
+		expected int
+	}{
+		{
+			name:     "successful rollouts",
+			outcomes: []string{outcome.Promoted, outcome.RollingOut, outcome.Stable},
+			expected: 0,
+		},
+		{
+			name:     "no rollout",
+			expected: 0,
+		},
+		{
+			name:     "rollback",
+			outcomes: []string{outcome.Promoted, outcome.RolledBack},
+			expected: outcome.ExitRolledBack,
+		},
+		{
+			name:     "failed run",
+			outcomes: []string{outcome.Promoted},
+			failed:   true,
+			expected: outcome.ExitOperatorError,
+		},
+		{
+			name:     "wait timed out",
+			outcomes: []string{outcome.TimedOut},
+			expected: outcome.ExitTimedOut,
+		},
+		{
+			name:     "timeout wins over the other outcomes",
+			outcomes: []string{outcome.RolledBack, outcome.TimedOut, outcome.Inconclusive, outcome.Skipped},
+			failed:   true,
+			expected: outcome.ExitTimedOut,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, outcome.ExitCode(test.outcomes, test.failed))
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+)
+
+// Evaluator is a mock implementation of policy.Evaluator.
+type Evaluator struct {
+	EvaluateFn      func(ctx context.Context, input policy.Input) (policy.Decision, error)
+	EvaluateInvoked bool
+}
+
+// Evaluate invokes the mock implementation and marks the function as invoked.
+func (e *Evaluator) Evaluate(ctx context.Context, input policy.Input) (policy.Decision, error) {
+	e.EvaluateInvoked = true
+	return e.EvaluateFn(ctx, input)
+}
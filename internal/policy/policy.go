@@ -0,0 +1,187 @@
+// Package policy evaluates the changes of the traffic of the services against
+// the guardrails of the organization (e.g. no promotions on Fridays) before
+// they are applied.
+//
+// The policies are written in Rego and evaluated by an Open Policy Agent
+// server (e.g. a sidecar loading the policy bundle), through its Data API.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Evaluator represents a policy engine that allows or denies the actions of
+// the operator.
+type Evaluator interface {
+	Evaluate(ctx context.Context, input Input) (Decision, error)
+}
+
+// Input is the planned action and its context, the input document of the
+// policy.
+type Input struct {
+	// Action is the decision of the rollout cycle: rollForward, promotion or
+	// rollback.
+	Action string `json:"action"`
+
+	// Manual is set if the action was requested by a user (e.g. through the
+	// admin API) rather than decided by the operator.
+	Manual bool `json:"manual"`
+
+	Project   string            `json:"project"`
+	Region    string            `json:"region"`
+	Namespace string            `json:"namespace,omitempty"`
+	Service   string            `json:"service"`
+	Labels    map[string]string `json:"labels"`
+
+	Stable    string `json:"stable"`
+	Candidate string `json:"candidate"`
+
+	// CurrentPercent and TargetPercent are the traffic of the candidate
+	// before and after the action.
+	CurrentPercent int64 `json:"currentPercent"`
+	TargetPercent  int64 `json:"targetPercent"`
+
+	// Diagnosis is the status of the candidate's last diagnosis and
+	// FailedChecks the health criteria it did not meet, if it was diagnosed.
+	Diagnosis    string   `json:"diagnosis,omitempty"`
+	FailedChecks []string `json:"failedChecks,omitempty"`
+
+	// Steps are the traffic percentages of the rollout strategy.
+	Steps []int64 `json:"steps"`
+
+	Time time.Time `json:"time"`
+}
+
+// Decision is the result of the evaluation of the policy. Reasons explain why
+// the action is denied.
+type Decision struct {
+	Allowed bool
+	Reasons []string
+}
+
+// OPA evaluates a policy document of an Open Policy Agent server.
+type OPA struct {
+	client *http.Client
+	url    string
+}
+
+// NewOPA initializes an evaluator of the policy document at the URL of the
+// Data API (e.g. http://localhost:8181/v1/data/rollout).
+//
+// The document is either a boolean, true to allow the action, or an object
+// with an optional allow boolean and an optional deny set of messages, like:
+//
+//	package rollout
+//
+//	deny[msg] {
+//	  input.action == "promotion"
+//	  time.weekday(time.now_ns()) == "Friday"
+//	  msg := "no promotions on Fridays"
+//	}
+//
+// The action is allowed if allow is not false and there is no deny message.
+func NewOPA(client *http.Client, url string) *OPA {
+	return &OPA{client: client, url: url}
+}
+
+// Evaluate implements Evaluator.
+func (o *OPA) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	body, err := json.Marshal(map[string]Input{"input": input})
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "failed to marshal policy input")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "request to policy engine failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "failed to read policy engine response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, errors.Errorf("policy engine returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Result *json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return Decision{}, errors.Wrap(err, "failed to parse policy engine response")
+	}
+	if result.Result == nil {
+		return Decision{}, errors.Errorf("policy document %s is undefined", o.url)
+	}
+	return parseDecision(*result.Result)
+}
+
+// parseDecision returns the decision of the policy document.
+func parseDecision(data []byte) (Decision, error) {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		decision := Decision{Allowed: allowed}
+		if !allowed {
+			decision.Reasons = []string{"denied by policy"}
+		}
+		return decision, nil
+	}
+
+	var document struct {
+		Allow *bool           `json:"allow"`
+		Deny  json.RawMessage `json:"deny"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return Decision{}, errors.Errorf("invalid policy document %s, must be a boolean or an object", string(data))
+	}
+	reasons, err := denyMessages(document.Deny)
+	if err != nil {
+		return Decision{}, err
+	}
+	if document.Allow != nil && !*document.Allow && len(reasons) == 0 {
+		reasons = []string{"not allowed by policy"}
+	}
+	return Decision{Allowed: len(reasons) == 0, Reasons: reasons}, nil
+}
+
+// denyMessages returns the messages of the deny set, or of the deny object
+// (partial object rules) sorted by key.
+func denyMessages(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var messages []string
+	if err := json.Unmarshal(data, &messages); err == nil {
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		return messages, nil
+	}
+	var object map[string]string
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, errors.Errorf("invalid deny %s, must be a set or an object of messages", string(data))
+	}
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		messages = append(messages, object[key])
+	}
+	return messages, nil
+}
@@ -0,0 +1,104 @@
+package policy_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOPA_Evaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		response  string
+		expected  policy.Decision
+		shouldErr bool
+	}{
+		{
+			name:     "boolean allow",
+			response: `{"result": true}`,
+			expected: policy.Decision{Allowed: true},
+		},
+		{
+			name:     "boolean deny",
+			response: `{"result": false}`,
+			expected: policy.Decision{Allowed: false, Reasons: []string{"denied by policy"}},
+		},
+		{
+			name:     "no deny messages",
+			response: `{"result": {"deny": []}}`,
+			expected: policy.Decision{Allowed: true},
+		},
+		{
+			name:     "deny messages",
+			response: `{"result": {"allow": true, "deny": ["no promotions on Fridays", "tier-0 services need an approval above 10%"]}}`,
+			expected: policy.Decision{Allowed: false, Reasons: []string{"no promotions on Fridays", "tier-0 services need an approval above 10%"}},
+		},
+		{
+			name:     "deny object",
+			response: `{"result": {"deny": {"tier0": "tier-0 services need an approval above 10%", "friday": "no promotions on Fridays"}}}`,
+			expected: policy.Decision{Allowed: false, Reasons: []string{"no promotions on Fridays", "tier-0 services need an approval above 10%"}},
+		},
+		{
+			name:     "not allowed",
+			response: `{"result": {"allow": false}}`,
+			expected: policy.Decision{Allowed: false, Reasons: []string{"not allowed by policy"}},
+		},
+		{
+			name:      "undefined document",
+			response:  `{}`,
+			shouldErr: true,
+		},
+		{
+			name:      "invalid document",
+			response:  `{"result": "yes"}`,
+			shouldErr: true,
+		},
+		{
+			name:      "server error",
+			status:    http.StatusInternalServerError,
+			response:  `{"code": "internal_error"}`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var input map[string]map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "/v1/data/rollout", r.URL.Path)
+				json.NewDecoder(r.Body).Decode(&input)
+				if test.status != 0 {
+					w.WriteHeader(test.status)
+				}
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			opa := policy.NewOPA(http.DefaultClient, server.URL+"/v1/data/rollout")
+			decision, err := opa.Evaluate(context.Background(), policy.Input{
+				Action:         "promotion",
+				Service:        "checkout",
+				Labels:         map[string]string{"tier": "0"},
+				CurrentPercent: 50,
+				TargetPercent:  100,
+				Time:           time.Date(2020, 7, 3, 12, 0, 0, 0, time.UTC),
+			})
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, decision)
+			assert.Equal(tt, "promotion", input["input"]["action"])
+			assert.Equal(tt, map[string]interface{}{"tier": "0"}, input["input"]["labels"])
+			assert.Equal(tt, float64(100), input["input"]["targetPercent"])
+		})
+	}
+}
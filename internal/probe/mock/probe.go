@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe"
+)
+
+// Prober is a mock implementation of probe.Prober.
+type Prober struct {
+	ProbeFn      func(ctx context.Context, url string) (probe.Result, error)
+	ProbeInvoked bool
+}
+
+// Probe invokes the mock implementation and marks the function as invoked.
+func (p *Prober) Probe(ctx context.Context, url string) (probe.Result, error) {
+	p.ProbeInvoked = true
+	return p.ProbeFn(ctx, url)
+}
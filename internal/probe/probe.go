@@ -0,0 +1,125 @@
+// Package probe sends synthetic requests to a revision's tag URL and checks the
+// responses against the expected status code, latency and body.
+package probe
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Prober represents a client that sends synthetic requests to a URL.
+type Prober interface {
+	// Probe sends the configured requests to the given base URL and returns
+	// the aggregated result.
+	Probe(ctx context.Context, url string) (Result, error)
+}
+
+// Result is the outcome of probing a URL.
+type Result struct {
+	Total     int
+	Succeeded int
+}
+
+// SuccessPercent returns the percentage of probe requests that succeeded.
+func (r Result) SuccessPercent() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Succeeded) / float64(r.Total) * 100
+}
+
+// HTTPProber is a prober that sends HTTP GET requests.
+type HTTPProber struct {
+	client    *http.Client
+	probe     config.Probe
+	bodyRegex *regexp.Regexp
+}
+
+// New initializes a prober for the probe configuration.
+func New(client *http.Client, probe config.Probe) (*HTTPProber, error) {
+	var bodyRegex *regexp.Regexp
+	if probe.BodyRegex != "" {
+		re, err := regexp.Compile(probe.BodyRegex)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile body regex")
+		}
+		bodyRegex = re
+	}
+
+	return &HTTPProber{
+		client:    client,
+		probe:     probe,
+		bodyRegex: bodyRegex,
+	}, nil
+}
+
+// Probe sends the configured number of requests to the path relative to the
+// base URL.
+//
+// Failed requests (e.g. connection errors) count as unsuccessful probes and do
+// not return an error. An error is only returned if the context is done.
+func (p *HTTPProber) Probe(ctx context.Context, baseURL string) (Result, error) {
+	url := strings.TrimSuffix(baseURL, "/") + p.probe.Path
+	logger := util.LoggerFrom(ctx).WithField("url", url)
+
+	var result Result
+	for i := 0; i < p.probe.Requests; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, errors.Wrap(err, "probing was interrupted")
+		}
+
+		result.Total++
+		if err := p.probeOnce(ctx, url); err != nil {
+			logger.WithField("attempt", i).Debugf("probe failed: %v", err)
+			continue
+		}
+		result.Succeeded++
+	}
+
+	logger.WithFields(logrus.Fields{
+		"total":     result.Total,
+		"succeeded": result.Succeeded,
+	}).Debug("finished probing")
+	return result, nil
+}
+
+// probeOnce sends a single request and returns an error if the response does
+// not meet the expectations.
+func (p *HTTPProber) probeOnce(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+	latency := time.Since(start)
+
+	if resp.StatusCode != p.probe.ExpectedStatus {
+		return errors.Errorf("expected status %d, got %d", p.probe.ExpectedStatus, resp.StatusCode)
+	}
+	if p.probe.MaxLatency > 0 && latency > p.probe.MaxLatency {
+		return errors.Errorf("latency %v exceeded max of %v", latency, p.probe.MaxLatency)
+	}
+	if p.bodyRegex != nil && !p.bodyRegex.Match(body) {
+		return errors.Errorf("body does not match %q", p.probe.BodyRegex)
+	}
+	return nil
+}
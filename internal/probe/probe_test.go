@@ -0,0 +1,86 @@
+package probe_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/healthz":
+			fmt.Fprint(w, `{"status": "ok"}`)
+		case "/flaky":
+			if requests%2 == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		probe    config.Probe
+		expected probe.Result
+	}{
+		{
+			name:     "all requests succeed",
+			probe:    config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 4},
+			expected: probe.Result{Total: 4, Succeeded: 4},
+		},
+		{
+			name:     "body matches regex",
+			probe:    config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 2, BodyRegex: `"status":\s*"ok"`},
+			expected: probe.Result{Total: 2, Succeeded: 2},
+		},
+		{
+			name:     "body does not match regex",
+			probe:    config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 2, BodyRegex: "unavailable"},
+			expected: probe.Result{Total: 2, Succeeded: 0},
+		},
+		{
+			name:     "unexpected status code",
+			probe:    config.Probe{Path: "/missing", ExpectedStatus: 200, Requests: 3},
+			expected: probe.Result{Total: 3, Succeeded: 0},
+		},
+		{
+			name:     "some requests fail",
+			probe:    config.Probe{Path: "/flaky", ExpectedStatus: 200, Requests: 4},
+			expected: probe.Result{Total: 4, Succeeded: 2},
+		},
+	}
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			requests = 0
+			prober, err := probe.New(server.Client(), test.probe)
+			assert.Nil(tt, err)
+
+			result, err := prober.Probe(ctx, server.URL+"/")
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, result)
+		})
+	}
+}
+
+func TestResult_SuccessPercent(t *testing.T) {
+	assert.Equal(t, 0.0, probe.Result{}.SuccessPercent())
+	assert.Equal(t, 50.0, probe.Result{Total: 4, Succeeded: 2}.SuccessPercent())
+	assert.Equal(t, 100.0, probe.Result{Total: 3, Succeeded: 3}.SuccessPercent())
+}
@@ -0,0 +1,269 @@
+// Package prometheus provides a metrics provider implementation that queries a
+// Prometheus-compatible HTTP API with PromQL.
+//
+// Queries are Go templates that receive the following fields:
+//
+//	.Project, .Region, .Service, .Revision
+//	.Window     the offset as a PromQL duration (e.g. 1800s)
+//	.Quantile   the latency quantile (e.g. 0.99), only for latency queries
+//
+// The request count query must return the number of requests, the error rate
+// query the rate of errors (between 0 and 1) and the latency query the latency
+// in milliseconds.
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+)
+
+// Default queries, which work for services instrumented with the conventional
+// http_requests_total and http_request_duration_seconds metrics labeled by
+// revision.
+const (
+	DefaultRequestCountQuery = `sum(increase(http_requests_total{service="{{.Service}}",revision="{{.Revision}}"}[{{.Window}}]))`
+	DefaultErrorRateQuery    = `sum(rate(http_requests_total{service="{{.Service}}",revision="{{.Revision}}",code=~"5.."}[{{.Window}}])) / sum(rate(http_requests_total{service="{{.Service}}",revision="{{.Revision}}"}[{{.Window}}]))`
+	DefaultLatencyQuery      = `histogram_quantile({{.Quantile}}, sum(rate(http_request_duration_seconds_bucket{service="{{.Service}}",revision="{{.Revision}}"}[{{.Window}}])) by (le)) * 1000`
+)
+
+// Queries holds the query templates for each metrics.
+type Queries struct {
+	RequestCount string
+	ErrorRate    string
+	Latency      string
+}
+
+// queryData is the data passed to the query templates.
+type queryData struct {
+	Project  string
+	Region   string
+	Service  string
+	Revision string
+	Window   string
+	Quantile float64
+
+	// offset is the window used to record the query.
+	offset time.Duration
+}
+
+// Provider is a metrics provider for Prometheus.
+type Provider struct {
+	client   *http.Client
+	endpoint string
+	project  string
+	region   string
+	service  string
+	revision string
+
+	requestCount *template.Template
+	errorRate    *template.Template
+	latency      *template.Template
+}
+
+// NewProvider initializes the provider for Prometheus. Empty queries are
+// replaced with the default ones.
+func NewProvider(client *http.Client, endpoint string, queries Queries, project, region, serviceName string) (*Provider, error) {
+	if endpoint == "" {
+		return nil, errors.New("Prometheus endpoint cannot be empty")
+	}
+	if queries.RequestCount == "" {
+		queries.RequestCount = DefaultRequestCountQuery
+	}
+	if queries.ErrorRate == "" {
+		queries.ErrorRate = DefaultErrorRateQuery
+	}
+	if queries.Latency == "" {
+		queries.Latency = DefaultLatencyQuery
+	}
+
+	requestCount, err := template.New("request-count").Parse(queries.RequestCount)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse request count query")
+	}
+	errorRate, err := template.New("error-rate").Parse(queries.ErrorRate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse error rate query")
+	}
+	latency, err := template.New("latency").Parse(queries.Latency)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse latency query")
+	}
+
+	return &Provider{
+		client:       client,
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		project:      project,
+		region:       region,
+		service:      serviceName,
+		requestCount: requestCount,
+		errorRate:    errorRate,
+		latency:      latency,
+	}, nil
+}
+
+// SetCandidateRevision sets the candidate revision name for which the provider
+// should get metrics.
+func (p *Provider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+}
+
+// RequestCount returns the number of requests for the given offset.
+func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	value, err := p.query(ctx, p.requestCount, p.data(offset, 0))
+	if errors.Is(err, metrics.ErrMissingRevisionData) {
+		// No series means no requests were made.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query request count")
+	}
+	if math.IsNaN(value) {
+		return 0, nil
+	}
+	return int64(math.Round(value)), nil
+}
+
+// Latency returns the latency for the given offset, in milliseconds.
+// It returns 0 if no request was made during the interval.
+func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	var quantile float64
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		quantile = 0.99
+	case metrics.Align95Reduce95:
+		quantile = 0.95
+	case metrics.Align50Reduce50:
+		quantile = 0.50
+	default:
+		return 0, errors.Errorf("unsupported align reduce type %v", alignReduceType)
+	}
+
+	value, err := p.query(ctx, p.latency, p.data(offset, quantile))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query latency")
+	}
+	// histogram_quantile returns NaN if there were no requests.
+	if math.IsNaN(value) {
+		return 0, nil
+	}
+	return value, nil
+}
+
+// ErrorRate returns the rate of errors for the given offset.
+// It returns 0 if no request was made during the interval.
+func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	value, err := p.query(ctx, p.errorRate, p.data(offset, 0))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query error rate")
+	}
+	// Dividing by zero requests results in NaN.
+	if math.IsNaN(value) {
+		return 0, nil
+	}
+	return value, nil
+}
+
+func (p *Provider) data(offset time.Duration, quantile float64) queryData {
+	return queryData{
+		Project:  p.project,
+		Region:   p.region,
+		Service:  p.service,
+		Revision: p.revision,
+		Window:   fmt.Sprintf("%.0fs", offset.Seconds()),
+		Quantile: quantile,
+		offset:   offset,
+	}
+}
+
+// queryResponse is the response of the Prometheus instant query API.
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// query executes the templated query and returns its scalar result.
+//
+// The query must result in a single sample. If it results in no samples,
+// metrics.ErrMissingRevisionData is returned.
+func (p *Provider) query(ctx context.Context, tmpl *template.Template, data queryData) (float64, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return 0, errors.Wrap(err, "failed to execute query template")
+	}
+	promQL := buf.String()
+	logger := util.LoggerFrom(ctx).WithField("query", promQL)
+	logger.Debug("querying Prometheus API")
+
+	now := time.Now()
+	params := url.Values{}
+	params.Set("query", promQL)
+	params.Set("time", strconv.FormatInt(now.Unix(), 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "request to Prometheus failed")
+	}
+	defer resp.Body.Close()
+
+	var result queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, errors.Wrapf(err, "failed to decode response with status %d", resp.StatusCode)
+	}
+	if result.Status != "success" {
+		return 0, errors.Errorf("query failed (%s): %s", result.ErrorType, result.Error)
+	}
+	metrics.RecordQuery(ctx, metrics.Query{Query: promQL, Start: now.Add(-data.offset), End: now})
+	return parseSample(result)
+}
+
+// parseSample returns the value of the single sample in the response.
+func parseSample(resp queryResponse) (float64, error) {
+	var value []interface{}
+	switch resp.Data.ResultType {
+	case "vector":
+		if len(resp.Data.Result) == 0 {
+			return 0, errors.Wrap(metrics.ErrMissingRevisionData, "query returned no samples")
+		}
+		if len(resp.Data.Result) > 1 {
+			return 0, errors.Errorf("query must return a single sample, got %d", len(resp.Data.Result))
+		}
+		value = resp.Data.Result[0].Value
+	default:
+		return 0, errors.Errorf("unsupported result type %q", resp.Data.ResultType)
+	}
+
+	// A sample has the form [<unix_time>, "<value>"].
+	if len(value) != 2 {
+		return 0, errors.Errorf("invalid sample %v", value)
+	}
+	str, ok := value[1].(string)
+	if !ok {
+		return 0, errors.Errorf("invalid sample value %v of type %T", value[1], value[1])
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	return f, errors.Wrap(err, "failed to parse sample value")
+}
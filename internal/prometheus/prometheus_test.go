@@ -0,0 +1,94 @@
+package prometheus_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/prometheus"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func vector(value string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1596000000,%q]}]}}`, value)
+}
+
+func TestProvider(t *testing.T) {
+	responses := map[string]string{
+		`count{rev="test-002",window="1800s"}`: vector("1500"),
+		`errors{rev="test-002"}`:               vector("0.02"),
+		`latency{rev="test-002",q="0.99"}`:     vector("NaN"),
+		`latency{rev="test-002",q="0.5"}`:      vector("250.5"),
+	}
+	var lastQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		lastQuery = r.URL.Query().Get("query")
+		resp, ok := responses[lastQuery]
+		if !ok {
+			resp = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+		}
+		fmt.Fprint(w, resp)
+	}))
+	defer server.Close()
+
+	queries := prometheus.Queries{
+		RequestCount: `count{rev="{{.Revision}}",window="{{.Window}}"}`,
+		ErrorRate:    `errors{rev="{{.Revision}}"}`,
+		Latency:      `latency{rev="{{.Revision}}",q="{{.Quantile}}"}`,
+	}
+	provider, err := prometheus.NewProvider(server.Client(), server.URL, queries, "myproject", "us-east1", "mysvc")
+	assert.Nil(t, err)
+	provider.SetCandidateRevision("test-002")
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	offset := 30 * time.Minute
+
+	count, err := provider.RequestCount(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), count)
+
+	rate, err := provider.ErrorRate(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.02, rate)
+
+	latency, err := provider.Latency(ctx, offset, metrics.Align50Reduce50)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.5, latency)
+
+	// NaN quantiles mean no requests.
+	latency, err = provider.Latency(ctx, offset, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, latency)
+
+	// No samples for the revision.
+	_, err = provider.Latency(ctx, offset, metrics.Align95Reduce95)
+	assert.True(t, errors.Is(err, metrics.ErrMissingRevisionData))
+
+	provider.SetCandidateRevision("test-003")
+	count, err = provider.RequestCount(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, `count{rev="test-003",window="1800s"}`, lastQuery)
+}
+
+func TestProvider_QueryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	}))
+	defer server.Close()
+
+	provider, err := prometheus.NewProvider(server.Client(), server.URL, prometheus.Queries{}, "myproject", "us-east1", "mysvc")
+	assert.Nil(t, err)
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	_, err = provider.ErrorRate(ctx, time.Minute)
+	assert.NotNil(t, err)
+}
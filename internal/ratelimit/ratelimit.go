@@ -0,0 +1,242 @@
+// Package ratelimit limits the rate of requests sent to Google APIs and retries
+// the requests rejected because of quota or transient errors.
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// cloudPlatformScope is the OAuth scope used to authenticate the requests.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Default backoff between retries.
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 32 * time.Second
+)
+
+// quotaErrorReasons are substrings of the body of 403 responses that indicate
+// the request was rejected because of quota.
+var quotaErrorReasons = [][]byte{
+	[]byte("rateLimitExceeded"),
+	[]byte("userRateLimitExceeded"),
+	[]byte("RESOURCE_EXHAUSTED"),
+}
+
+// Limiter spaces out requests so that at most a number of requests per second
+// is sent. A limiter is meant to be shared by all the clients of an API.
+type Limiter struct {
+	interval time.Duration
+	clock    clockwork.Clock
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewLimiter initializes a limiter for the given requests per second. A
+// non-positive value disables the limit.
+func NewLimiter(qps float64) *Limiter {
+	var interval time.Duration
+	if qps > 0 {
+		interval = time.Duration(float64(time.Second) / qps)
+	}
+	return &Limiter{interval: interval, clock: clockwork.NewRealClock()}
+}
+
+// WithClock updates the clock used by the limiter.
+func (l *Limiter) WithClock(clock clockwork.Clock) *Limiter {
+	l.clock = clock
+	return l
+}
+
+// Wait blocks until a request can be sent or the context is done. A nil
+// limiter never blocks.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil || l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, l.clock, wait)
+}
+
+// Transport is an http.RoundTripper that waits for the limiter before sending
+// each request and retries the requests that fail with 429, 503 or quota
+// errors using exponential backoff. The Retry-After header is honored.
+type Transport struct {
+	base           http.RoundTripper
+	limiter        *Limiter
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	clock          clockwork.Clock
+}
+
+// NewTransport initializes a transport that sends the requests using the base
+// transport. If base is nil, http.DefaultTransport is used.
+func NewTransport(base http.RoundTripper, limiter *Limiter, maxRetries int) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:           base,
+		limiter:        limiter,
+		maxRetries:     maxRetries,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		clock:          clockwork.NewRealClock(),
+	}
+}
+
+// WithBackoff updates the initial and maximum backoff between retries.
+func (t *Transport) WithBackoff(initial, max time.Duration) *Transport {
+	t.initialBackoff = initial
+	t.maxBackoff = max
+	return t
+}
+
+// WithClock updates the clock used by the transport.
+func (t *Transport) WithClock(clock clockwork.Clock) *Transport {
+	t.clock = clock
+	return t
+}
+
+// ClientOption returns the option to use the transport in a Google API client.
+// The requests are authenticated with the default credentials, unless other
+// credentials are given in the options (e.g. option.WithTokenSource).
+func (t *Transport) ClientOption(ctx context.Context, opts ...option.ClientOption) (option.ClientOption, error) {
+	opts = append([]option.ClientOption{option.WithScopes(cloudPlatformScope)}, opts...)
+	authenticated, err := htransport.NewTransport(ctx, t, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize authenticated transport")
+	}
+	return option.WithHTTPClient(&http.Client{Transport: authenticated}), nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(ctx)
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to get request body for retry")
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		// Requests whose body cannot be sent again are not retried.
+		if attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		retry, err := shouldRetry(resp)
+		if err != nil {
+			return nil, err
+		}
+		if !retry {
+			return resp, nil
+		}
+
+		delay := t.backoff(attempt, resp.Header.Get("Retry-After"))
+		resp.Body.Close()
+		if err := sleep(ctx, t.clock, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt. The Retry-After
+// value takes precedence over the exponential backoff.
+func (t *Transport) backoff(attempt int, retryAfter string) time.Duration {
+	if retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			if delay := date.Sub(t.clock.Now()); delay > 0 {
+				return delay
+			}
+			return 0
+		}
+	}
+
+	delay := t.initialBackoff
+	for i := 0; i < attempt && delay < t.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > t.maxBackoff {
+		delay = t.maxBackoff
+	}
+	// Add jitter so that the clients that were throttled at the same time do
+	// not retry at the same time.
+	if delay > 1 {
+		delay += time.Duration(rand.Int63n(int64(delay) / 2))
+	}
+	return delay
+}
+
+// shouldRetry determines if the response indicates a quota or transient error.
+func shouldRetry(resp *http.Response) (bool, error) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true, nil
+	case http.StatusForbidden:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return false, errors.Wrap(err, "failed to read response body")
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		for _, reason := range quotaErrorReasons {
+			if bytes.Contains(body, reason) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, clock clockwork.Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
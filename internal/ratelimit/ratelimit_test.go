@@ -0,0 +1,144 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/ratelimit"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name             string
+		responses        []int
+		body             string
+		maxRetries       int
+		expectedStatus   int
+		expectedRequests int
+	}{
+		{
+			name:             "transient errors are retried",
+			responses:        []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			maxRetries:       3,
+			expectedStatus:   http.StatusOK,
+			expectedRequests: 3,
+		},
+		{
+			name:             "quota errors are retried",
+			responses:        []int{http.StatusForbidden, http.StatusOK},
+			body:             `{"error": {"status": "RESOURCE_EXHAUSTED"}}`,
+			maxRetries:       3,
+			expectedStatus:   http.StatusOK,
+			expectedRequests: 2,
+		},
+		{
+			name:             "permission errors are not retried",
+			responses:        []int{http.StatusForbidden, http.StatusOK},
+			body:             `{"error": {"status": "PERMISSION_DENIED"}}`,
+			maxRetries:       3,
+			expectedStatus:   http.StatusForbidden,
+			expectedRequests: 1,
+		},
+		{
+			name:             "client errors are not retried",
+			responses:        []int{http.StatusBadRequest, http.StatusOK},
+			maxRetries:       3,
+			expectedStatus:   http.StatusBadRequest,
+			expectedRequests: 1,
+		},
+		{
+			name:             "retries are exhausted",
+			responses:        []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			maxRetries:       1,
+			expectedStatus:   http.StatusTooManyRequests,
+			expectedRequests: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Equal(tt, "request", string(body))
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.responses[requests])
+				fmt.Fprint(w, test.body)
+				requests++
+			}))
+			defer server.Close()
+
+			transport := ratelimit.NewTransport(nil, ratelimit.NewLimiter(0), test.maxRetries)
+			client := &http.Client{Transport: transport}
+			resp, err := client.Post(server.URL, "text/plain", strings.NewReader("request"))
+			assert.Nil(tt, err)
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(tt, test.expectedStatus, resp.StatusCode)
+			assert.Equal(tt, test.body, string(body))
+			assert.Equal(tt, test.expectedRequests, requests)
+		})
+	}
+}
+
+func TestTransport_backoff(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	transport := ratelimit.NewTransport(nil, nil, 5).WithBackoff(10*time.Millisecond, 20*time.Millisecond)
+	client := &http.Client{Transport: transport}
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, requests)
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+}
+
+func TestLimiter(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	limiter := ratelimit.NewLimiter(2).WithClock(clock)
+	ctx := context.Background()
+
+	// The first request is not delayed.
+	assert.Nil(t, limiter.Wait(ctx))
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Wait(ctx)
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(499 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("request was sent before the interval")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	<-done
+
+	// A canceled context stops the wait.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.NotNil(t, limiter.Wait(ctx))
+
+	// A nil limiter never blocks.
+	var unlimited *ratelimit.Limiter
+	assert.Nil(t, unlimited.Wait(context.Background()))
+}
@@ -0,0 +1,121 @@
+// Package resourcemanager discovers the projects under a folder or an
+// organization, and tests the permissions on them, with the Cloud Resource
+// Manager API.
+package resourcemanager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	crmv1 "google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+	"google.golang.org/api/option"
+)
+
+// Client lists the projects under a folder or an organization and tests the
+// permissions of the caller on them.
+type Client struct {
+	projects *crmv1.Service
+	folders  *crmv2.Service
+}
+
+// NewClient initializes a client for the Cloud Resource Manager API.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (*Client, error) {
+	projects, err := crmv1.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Cloud Resource Manager API")
+	}
+	folders, err := crmv2.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Cloud Resource Manager API")
+	}
+	return &Client{projects: projects, folders: folders}, nil
+}
+
+// Projects returns the IDs of the active projects under the parent
+// (folders/ID or organizations/ID) and its subfolders that match the filter.
+//
+// The filter uses the syntax of the projects.list method (e.g.
+// labels.env:prod) and might be empty.
+func (c *Client) Projects(ctx context.Context, parent, filter string) ([]string, error) {
+	parentType, parentID, err := splitParent(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "parent.type:" + parentType + " parent.id:" + parentID + " lifecycleState:ACTIVE"
+	if filter != "" {
+		query += " " + filter
+	}
+	var projects []string
+	err = c.projects.Projects.List().Filter(query).Pages(ctx, func(resp *crmv1.ListProjectsResponse) error {
+		for _, project := range resp.Projects {
+			projects = append(projects, project.ProjectId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list projects under %s", parent)
+	}
+
+	var subfolders []string
+	err = c.folders.Folders.List().Parent(parent).Pages(ctx, func(resp *crmv2.ListFoldersResponse) error {
+		for _, folder := range resp.Folders {
+			if folder.LifecycleState == "ACTIVE" {
+				subfolders = append(subfolders, folder.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list folders under %s", parent)
+	}
+	for _, folder := range subfolders {
+		folderProjects, err := c.Projects(ctx, folder, filter)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, folderProjects...)
+	}
+	return projects, nil
+}
+
+// splitParent returns the type (folder or organization) and the ID of the
+// parent resource name.
+func splitParent(parent string) (string, string, error) {
+	parts := strings.Split(parent, "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", errors.Errorf("invalid parent %q, must be folders/ID or organizations/ID", parent)
+	}
+	switch parts[0] {
+	case "folders":
+		return "folder", parts[1], nil
+	case "organizations":
+		return "organization", parts[1], nil
+	default:
+		return "", "", errors.Errorf("invalid parent %q, must be folders/ID or organizations/ID", parent)
+	}
+}
+
+// MissingPermissions returns the permissions, among the ones passed, the
+// caller does not have on the project.
+func (c *Client) MissingPermissions(ctx context.Context, project string, permissions []string) ([]string, error) {
+	resp, err := c.projects.Projects.TestIamPermissions(project, &crmv1.TestIamPermissionsRequest{
+		Permissions: permissions,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to test permissions on project %s", project)
+	}
+	granted := make(map[string]bool)
+	for _, permission := range resp.Permissions {
+		granted[permission] = true
+	}
+	var missing []string
+	for _, permission := range permissions {
+		if !granted[permission] {
+			missing = append(missing, permission)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,79 @@
+package resourcemanager_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/resourcemanager"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestProjects(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case "/v1/projects":
+			filter := r.URL.Query().Get("filter")
+			filters = append(filters, filter)
+			projects := map[string][]map[string]string{
+				"parent.type:organization parent.id:1 lifecycleState:ACTIVE labels.env:prod": {{"projectId": "root-project"}},
+				"parent.type:folder parent.id:2 lifecycleState:ACTIVE labels.env:prod":       {{"projectId": "team-a"}, {"projectId": "team-b"}},
+				"parent.type:folder parent.id:3 lifecycleState:ACTIVE labels.env:prod":       {{"projectId": "team-c"}},
+			}
+			resp = map[string]interface{}{"projects": projects[filter]}
+		case "/v2/folders":
+			folders := map[string][]map[string]string{
+				"organizations/1": {
+					{"name": "folders/2", "lifecycleState": "ACTIVE"},
+					{"name": "folders/4", "lifecycleState": "DELETE_REQUESTED"},
+				},
+				"folders/2": {{"name": "folders/3", "lifecycleState": "ACTIVE"}},
+			}
+			resp = map[string]interface{}{"folders": folders[r.URL.Query().Get("parent")]}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := resourcemanager.NewClient(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	projects, err := client.Projects(ctx, "organizations/1", "labels.env:prod")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"root-project", "team-a", "team-b", "team-c"}, projects)
+	assert.Len(t, filters, 3)
+
+	_, err = client.Projects(ctx, "projects/1", "")
+	assert.NotNil(t, err)
+}
+
+func TestMissingPermissions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/myproject:testIamPermissions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"permissions": {"run.services.list"}})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := resourcemanager.NewClient(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	missing, err := client.MissingPermissions(ctx, "myproject", []string{"run.services.list", "run.services.update"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"run.services.update"}, missing)
+
+	_, err = client.MissingPermissions(ctx, "other", []string{"run.services.list"})
+	assert.NotNil(t, err)
+}
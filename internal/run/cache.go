@@ -0,0 +1,104 @@
+package run
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// ListCache caches the services listed with a label selector, so the
+// services of a region are listed at most once per TTL instead of every
+// rollout cycle. The lists of a region can be invalidated when one of its
+// services changes (e.g. on an event of Eventarc).
+//
+// The cached services are only as current as their list, so they must be
+// retrieved again before they are updated.
+type ListCache struct {
+	ttl   time.Duration
+	clock clockwork.Clock
+
+	mu      sync.Mutex
+	entries map[listKey]listEntry
+}
+
+// listKey identifies a list of services.
+type listKey struct {
+	project       string
+	region        string
+	namespace     string
+	labelSelector string
+}
+
+// listEntry is a list of services, encoded so every caller gets its own
+// copy of the services.
+type listEntry struct {
+	services []byte
+	expires  time.Time
+}
+
+// NewListCache initializes a cache whose lists expire after the TTL.
+func NewListCache(ttl time.Duration) *ListCache {
+	return &ListCache{
+		ttl:     ttl,
+		clock:   clockwork.NewRealClock(),
+		entries: make(map[listKey]listEntry),
+	}
+}
+
+// WithClock updates the clock used by the cache.
+func (c *ListCache) WithClock(clock clockwork.Clock) *ListCache {
+	c.clock = clock
+	return c
+}
+
+// ServicesWithLabelSelector returns the services of the project and region
+// that match the label selector, from the cache if they were listed less than
+// the TTL ago, or from the client. cached is set if the services come from
+// the cache. Failed lists are not cached.
+func (c *ListCache) ServicesWithLabelSelector(client Client, project, region, namespace, labelSelector string) (svcs []*run.Service, cached bool, err error) {
+	key := listKey{project: project, region: region, namespace: namespace, labelSelector: labelSelector}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Before(entry.expires) {
+		if err := json.Unmarshal(entry.services, &svcs); err != nil {
+			return nil, false, errors.Wrap(err, "could not decode cached services")
+		}
+		return svcs, true, nil
+	}
+
+	svcs, err = client.ServicesWithLabelSelector(namespace, labelSelector)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := json.Marshal(svcs)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not encode services")
+	}
+	c.mu.Lock()
+	c.entries[key] = listEntry{services: data, expires: c.clock.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	// The caller gets a copy, so the cached services cannot be modified.
+	var copies []*run.Service
+	if err := json.Unmarshal(data, &copies); err != nil {
+		return nil, false, errors.Wrap(err, "could not decode services")
+	}
+	return copies, false, nil
+}
+
+// Invalidate discards the lists of the services of the project and region,
+// so they are listed again by the next call.
+func (c *ListCache) Invalidate(project, region string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.project == project && key.region == region {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestListCache(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	cache := runapi.NewListCache(time.Minute).WithClock(clock)
+
+	var calls int
+	var listErr error
+	client := &runMocker.RunAPI{}
+	client.ServicesWithLabelSelectorFn = func(namespace string, labelSelector string) ([]*run.Service, error) {
+		calls++
+		return []*run.Service{{Metadata: &run.ObjectMeta{Name: "mysvc"}}}, listErr
+	}
+
+	svcs, cached, err := cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "rollout-strategy=gradual")
+	assert.Nil(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, "mysvc", svcs[0].Metadata.Name)
+
+	// Modifying the returned services does not modify the cached ones.
+	svcs[0].Metadata.Name = "modified"
+	svcs, cached, err = cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "rollout-strategy=gradual")
+	assert.Nil(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, "mysvc", svcs[0].Metadata.Name)
+	assert.Equal(t, 1, calls)
+
+	// Other regions and selectors are listed separately.
+	_, cached, _ = cache.ServicesWithLabelSelector(client, "myproject", "europe-west1", "myproject", "rollout-strategy=gradual")
+	assert.False(t, cached)
+	_, cached, _ = cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "team=payments")
+	assert.False(t, cached)
+	assert.Equal(t, 3, calls)
+
+	cache.Invalidate("myproject", "us-east1")
+	_, cached, _ = cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "rollout-strategy=gradual")
+	assert.False(t, cached)
+	_, cached, _ = cache.ServicesWithLabelSelector(client, "myproject", "europe-west1", "myproject", "rollout-strategy=gradual")
+	assert.True(t, cached, "list of another region invalidated")
+
+	clock.Advance(time.Minute)
+	_, cached, _ = cache.ServicesWithLabelSelector(client, "myproject", "europe-west1", "myproject", "rollout-strategy=gradual")
+	assert.False(t, cached, "expired list")
+
+	// Failed lists are not cached.
+	listErr = errors.New("quota exceeded")
+	cache.Invalidate("myproject", "us-east1")
+	_, _, err = cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "rollout-strategy=gradual")
+	assert.NotNil(t, err)
+	listErr = nil
+	_, cached, err = cache.ServicesWithLabelSelector(client, "myproject", "us-east1", "myproject", "rollout-strategy=gradual")
+	assert.Nil(t, err)
+	assert.False(t, cached)
+}
@@ -0,0 +1,42 @@
+package run
+
+import (
+	"google.golang.org/api/run/v1"
+)
+
+// Cloud Functions (2nd gen) are backed by Cloud Run services, created and
+// updated by Cloud Functions with the following label and annotation. The
+// annotations of Cloud Functions are reserved: they are kept as is when the
+// traffic of the services is updated.
+const (
+	// FunctionManagedByLabel is set to FunctionManagedByValue in the services
+	// backing a function.
+	FunctionManagedByLabel = "goog-managed-by"
+	FunctionManagedByValue = "cloudfunctions"
+
+	// FunctionIDAnnotation is the name of the function backed by the service,
+	// which can differ from the name of the service (e.g. in case).
+	FunctionIDAnnotation = "cloudfunctions.googleapis.com/function-id"
+)
+
+// IsFunction determines if the service backs a Cloud Functions (2nd gen)
+// function.
+func IsFunction(svc *run.Service) bool {
+	if svc.Metadata == nil {
+		return false
+	}
+	return svc.Metadata.Labels[FunctionManagedByLabel] == FunctionManagedByValue ||
+		svc.Metadata.Annotations[FunctionIDAnnotation] != ""
+}
+
+// FunctionName returns the name of the function backed by the service, or an
+// empty string if the service does not back a function.
+func FunctionName(svc *run.Service) string {
+	if !IsFunction(svc) {
+		return ""
+	}
+	if name := svc.Metadata.Annotations[FunctionIDAnnotation]; name != "" {
+		return name
+	}
+	return svc.Metadata.Name
+}
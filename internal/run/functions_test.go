@@ -0,0 +1,45 @@
+package run_test
+
+import (
+	"testing"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestFunctionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *run.ObjectMeta
+		expected string
+	}{
+		{
+			name:     "service",
+			metadata: &run.ObjectMeta{Name: "api", Labels: map[string]string{"team": "web"}},
+			expected: "",
+		},
+		{
+			name: "function",
+			metadata: &run.ObjectMeta{
+				Name:        "my-function",
+				Labels:      map[string]string{runapi.FunctionManagedByLabel: runapi.FunctionManagedByValue},
+				Annotations: map[string]string{runapi.FunctionIDAnnotation: "my_function"},
+			},
+			expected: "my_function",
+		},
+		{
+			name:     "function without name annotation",
+			metadata: &run.ObjectMeta{Name: "my-function", Labels: map[string]string{runapi.FunctionManagedByLabel: runapi.FunctionManagedByValue}},
+			expected: "my-function",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := &run.Service{Metadata: test.metadata}
+			assert.Equal(tt, test.expected != "", runapi.IsFunction(svc))
+			assert.Equal(tt, test.expected, runapi.FunctionName(svc))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package run
+
+import (
+	"time"
+
+	"google.golang.org/api/run/v1"
+)
+
+// Observer is called after every call of an instrumented client with the name
+// of the method, the duration of the call and its error, if any.
+type Observer func(method string, duration time.Duration, err error)
+
+// Instrument returns a client that reports the calls to the given client to
+// the observer.
+func Instrument(client Client, observe Observer) Client {
+	return &instrumentedClient{client: client, observe: observe}
+}
+
+type instrumentedClient struct {
+	client  Client
+	observe Observer
+}
+
+func (c *instrumentedClient) Service(namespace, serviceID string) (*run.Service, error) {
+	start := time.Now()
+	svc, err := c.client.Service(namespace, serviceID)
+	c.observe("Service", time.Since(start), err)
+	return svc, err
+}
+
+func (c *instrumentedClient) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	start := time.Now()
+	svc, err := c.client.ReplaceService(namespace, serviceID, svc)
+	c.observe("ReplaceService", time.Since(start), err)
+	return svc, err
+}
+
+func (c *instrumentedClient) Revision(namespace, revisionID string) (*run.Revision, error) {
+	start := time.Now()
+	revision, err := c.client.Revision(namespace, revisionID)
+	c.observe("Revision", time.Since(start), err)
+	return revision, err
+}
+
+func (c *instrumentedClient) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	start := time.Now()
+	svcs, err := c.client.ServicesWithLabelSelector(namespace, labelSelector)
+	c.observe("ServicesWithLabelSelector", time.Since(start), err)
+	return svcs, err
+}
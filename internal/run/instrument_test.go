@@ -0,0 +1,39 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestInstrument(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+		return &run.Service{Metadata: &run.ObjectMeta{Name: serviceID}}, nil
+	}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return nil, errors.New("permission denied")
+	}
+
+	var methods []string
+	var errs []error
+	client := runapi.Instrument(runclient, func(method string, duration time.Duration, err error) {
+		methods = append(methods, method)
+		errs = append(errs, err)
+	})
+
+	svc, err := client.Service("myproject", "mysvc")
+	assert.Nil(t, err)
+	assert.Equal(t, "mysvc", svc.Metadata.Name)
+	_, err = client.ReplaceService("myproject", "mysvc", svc)
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{"Service", "ReplaceService"}, methods)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[1])
+}
@@ -0,0 +1,227 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JobsClient manages the Cloud Run jobs of a region.
+type JobsClient interface {
+	JobsWithLabelSelector(project, labelSelector string) ([]*Job, error)
+	Job(project, jobID string) (*Job, error)
+
+	// UpdateJob replaces the job, or creates it if it does not exist. The
+	// update is rejected if the job changed since it was retrieved.
+	UpdateJob(project, jobID string, job *Job) error
+
+	// RunJob starts an execution of the job with the arguments and the
+	// environment variables of its container overridden, if set, and returns
+	// the name of the execution.
+	RunJob(project, jobID string, args []string, env map[string]string, timeout time.Duration) (string, error)
+
+	Execution(name string) (*Execution, error)
+}
+
+// Job is the subset of the v2 Job resource used by the operator. The template
+// is kept as is, so the fields unknown to the operator are preserved when the
+// job is updated.
+type Job struct {
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Template    json.RawMessage   `json:"template,omitempty"`
+	Etag        string            `json:"etag,omitempty"`
+
+	// Reconciling is set while an update of the job is in progress.
+	Reconciling bool `json:"reconciling,omitempty"`
+}
+
+// ID returns the name of the job in its region.
+func (job *Job) ID() string {
+	return shortName(job.Name)
+}
+
+// Image returns the image of the first container of the job.
+func (job *Job) Image() (string, error) {
+	var template struct {
+		Template struct {
+			Containers []struct {
+				Image string `json:"image"`
+			} `json:"containers"`
+		} `json:"template"`
+	}
+	if err := json.Unmarshal(job.Template, &template); err != nil {
+		return "", errors.Wrapf(err, "failed to decode template of job %q", job.ID())
+	}
+	if len(template.Template.Containers) == 0 {
+		return "", errors.Errorf("job %q has no container", job.ID())
+	}
+	return template.Template.Containers[0].Image, nil
+}
+
+// SetImage changes the image of the first container of the job, keeping the
+// rest of its template.
+func (job *Job) SetImage(image string) error {
+	var template map[string]interface{}
+	if err := json.Unmarshal(job.Template, &template); err != nil {
+		return errors.Wrapf(err, "failed to decode template of job %q", job.ID())
+	}
+	task, _ := template["template"].(map[string]interface{})
+	containers, _ := task["containers"].([]interface{})
+	if len(containers) == 0 {
+		return errors.Errorf("job %q has no container", job.ID())
+	}
+	container, ok := containers[0].(map[string]interface{})
+	if !ok {
+		return errors.Errorf("invalid container in template of job %q", job.ID())
+	}
+	container["image"] = image
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode template of job %q", job.ID())
+	}
+	job.Template = data
+	return nil
+}
+
+// Execution is the subset of the v2 Execution resource used by the operator.
+// The completion time is empty while the execution is running.
+type Execution struct {
+	Name           string `json:"name"`
+	TaskCount      int64  `json:"taskCount,omitempty"`
+	SucceededCount int64  `json:"succeededCount,omitempty"`
+	FailedCount    int64  `json:"failedCount,omitempty"`
+	CancelledCount int64  `json:"cancelledCount,omitempty"`
+	StartTime      string `json:"startTime,omitempty"`
+	CompletionTime string `json:"completionTime,omitempty"`
+}
+
+// Duration returns the time the execution took, or 0 if it is not completed.
+func (e *Execution) Duration() time.Duration {
+	start, err := time.Parse(time.RFC3339Nano, e.StartTime)
+	if err != nil {
+		return 0
+	}
+	end, err := time.Parse(time.RFC3339Nano, e.CompletionTime)
+	if err != nil {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// JobsWithLabelSelector gets the jobs filtered by a label selector. Like
+// services, the jobs are filtered by the client (see MatchesLabelSelector).
+func (a *APIv2) JobsWithLabelSelector(project, labelSelector string) ([]*Job, error) {
+	var (
+		jobs      []*Job
+		pageToken string
+	)
+	for {
+		var resp struct {
+			Jobs          []*Job `json:"jobs"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		path := fmt.Sprintf("/v2/projects/%s/locations/%s/jobs", project, a.region)
+		if pageToken != "" {
+			path += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		if err := a.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, errors.Wrap(err, "failed to list jobs")
+		}
+		for _, job := range resp.Jobs {
+			if MatchesLabelSelector(job.Labels, labelSelector) {
+				jobs = append(jobs, job)
+			}
+		}
+		if resp.NextPageToken == "" {
+			return jobs, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Job retrieves information about a job.
+func (a *APIv2) Job(project, jobID string) (*Job, error) {
+	var job Job
+	if err := a.do(http.MethodGet, a.jobPath(project, jobID), nil, &job); err != nil {
+		return nil, errors.Wrapf(err, "failed to get job %q", jobID)
+	}
+	return &job, nil
+}
+
+// UpdateJob replaces the job, or creates it if it does not exist.
+func (a *APIv2) UpdateJob(project, jobID string, job *Job) error {
+	update := Job{
+		Name:        "projects/" + project + "/locations/" + a.region + "/jobs/" + jobID,
+		Labels:      job.Labels,
+		Annotations: job.Annotations,
+		Template:    job.Template,
+		Etag:        job.Etag,
+	}
+	// The update is a long-running operation: the job is reconciling until
+	// it is done.
+	path := a.jobPath(project, jobID) + "?allowMissing=true"
+	return errors.Wrapf(a.do(http.MethodPatch, path, update, nil), "failed to update job %q", jobID)
+}
+
+// RunJob starts an execution of the job.
+func (a *APIv2) RunJob(project, jobID string, args []string, env map[string]string, timeout time.Duration) (string, error) {
+	type envVar struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	var override struct {
+		Args []string `json:"args,omitempty"`
+		Env  []envVar `json:"env,omitempty"`
+	}
+	override.Args = args
+	for name, value := range env {
+		override.Env = append(override.Env, envVar{Name: name, Value: value})
+	}
+	sort.Slice(override.Env, func(i, j int) bool { return override.Env[i].Name < override.Env[j].Name })
+
+	var req struct {
+		Overrides struct {
+			ContainerOverrides []interface{} `json:"containerOverrides,omitempty"`
+			Timeout            string        `json:"timeout,omitempty"`
+		} `json:"overrides"`
+	}
+	if len(override.Args) != 0 || len(override.Env) != 0 {
+		req.Overrides.ContainerOverrides = []interface{}{override}
+	}
+	if timeout > 0 {
+		req.Overrides.Timeout = fmt.Sprintf("%.0fs", timeout.Seconds())
+	}
+
+	// The operation is not waited for: its metadata is the execution.
+	var op struct {
+		Metadata Execution `json:"metadata"`
+	}
+	if err := a.do(http.MethodPost, a.jobPath(project, jobID)+":run", req, &op); err != nil {
+		return "", errors.Wrapf(err, "failed to run job %q", jobID)
+	}
+	if op.Metadata.Name == "" {
+		return "", errors.Errorf("no execution started for job %q", jobID)
+	}
+	return op.Metadata.Name, nil
+}
+
+// Execution retrieves information about an execution, by its full name.
+func (a *APIv2) Execution(name string) (*Execution, error) {
+	var execution Execution
+	if err := a.do(http.MethodGet, "/v2/"+name, nil, &execution); err != nil {
+		return nil, errors.Wrapf(err, "failed to get execution %q", shortName(name))
+	}
+	return &execution, nil
+}
+
+func (a *APIv2) jobPath(project, jobID string) string {
+	return fmt.Sprintf("/v2/projects/%s/locations/%s/jobs/%s", project, a.region, jobID)
+}
@@ -0,0 +1,99 @@
+package run_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestAPIv2_Jobs(t *testing.T) {
+	const jobsPath = "/v2/projects/myproject/locations/us-east1/jobs"
+	var (
+		allowMissing string
+		updated      map[string]interface{}
+		run          map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == jobsPath:
+			w.Write([]byte(`{"jobs": [
+				{"name": "projects/myproject/locations/us-east1/jobs/etl", "labels": {"team": "data"}},
+				{"name": "projects/myproject/locations/us-east1/jobs/report", "labels": {"team": "finance"}}
+			]}`))
+		case r.Method == http.MethodGet && r.URL.Path == jobsPath+"/etl":
+			w.Write([]byte(`{
+				"name": "projects/myproject/locations/us-east1/jobs/etl",
+				"etag": "\"abc\"",
+				"template": {"taskCount": 2, "template": {"containers": [{"image": "gcr.io/myproject/etl:v1", "args": ["--all"]}], "maxRetries": 3}}
+			}`))
+		case r.Method == http.MethodPatch && r.URL.Path == jobsPath+"/etl-canary":
+			allowMissing = r.URL.Query().Get("allowMissing")
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&updated))
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/operations/123"}`))
+		case r.Method == http.MethodPost && r.URL.Path == jobsPath+"/etl-canary:run":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&run))
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/operations/456", "metadata": {"name": "projects/myproject/locations/us-east1/jobs/etl-canary/executions/etl-canary-xyz"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == jobsPath+"/etl-canary/executions/etl-canary-xyz":
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/jobs/etl-canary/executions/etl-canary-xyz",
+				"taskCount": 2, "succeededCount": 1, "failedCount": 1,
+				"startTime": "2020-06-01T10:00:00Z", "completionTime": "2020-06-01T10:05:30Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := runapi.NewAPIv2Client(context.Background(), "us-east1",
+		option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	jobs, err := client.JobsWithLabelSelector("myproject", "team=data")
+	assert.Nil(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, "etl", jobs[0].ID())
+	}
+
+	job, err := client.Job("myproject", "etl")
+	assert.Nil(t, err)
+	image, err := job.Image()
+	assert.Nil(t, err)
+	assert.Equal(t, "gcr.io/myproject/etl:v1", image)
+
+	assert.Nil(t, job.SetImage("gcr.io/myproject/etl:v2"))
+	assert.Nil(t, client.UpdateJob("myproject", "etl-canary", job))
+	assert.Equal(t, "true", allowMissing)
+	assert.Equal(t, "projects/myproject/locations/us-east1/jobs/etl-canary", updated["name"])
+	assert.Equal(t, map[string]interface{}{
+		"taskCount": 2.0,
+		"template": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"image": "gcr.io/myproject/etl:v2", "args": []interface{}{"--all"}}},
+			"maxRetries": 3.0,
+		},
+	}, updated["template"], "the template must be preserved")
+
+	name, err := client.RunJob("myproject", "etl-canary", []string{"--canary"}, map[string]string{"DATASET": "canary"}, 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "projects/myproject/locations/us-east1/jobs/etl-canary/executions/etl-canary-xyz", name)
+	assert.Equal(t, map[string]interface{}{
+		"containerOverrides": []interface{}{map[string]interface{}{
+			"args": []interface{}{"--canary"},
+			"env":  []interface{}{map[string]interface{}{"name": "DATASET", "value": "canary"}},
+		}},
+		"timeout": "600s",
+	}, run["overrides"])
+
+	execution, err := client.Execution(name)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), execution.SucceededCount)
+	assert.Equal(t, 5*time.Minute+30*time.Second, execution.Duration())
+
+	_, err = client.Job("myproject", "missing")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// knativeServingAPI is the path of the Knative Serving API in the Kubernetes
+// API server.
+const knativeServingAPI = "/apis/serving.knative.dev/v1"
+
+// Knative is a client for Knative Serving on Kubernetes (e.g. Cloud Run for
+// Anthos on GKE). The Knative resources have the same schema as the Cloud Run
+// API ones, so the traffic is split through the spec of the Knative Service.
+type Knative struct {
+	ctx    context.Context
+	client *kube.Client
+}
+
+// NewKnativeClient initializes a client for the Knative Serving API of the
+// cluster.
+func NewKnativeClient(ctx context.Context, client *kube.Client) *Knative {
+	return &Knative{ctx: ctx, client: client}
+}
+
+// Service retrieves information about a service.
+func (k *Knative) Service(namespace, serviceID string) (*run.Service, error) {
+	var svc run.Service
+	err := k.client.Do(k.ctx, http.MethodGet, knativePath(namespace, "services", serviceID), "", nil, &svc)
+	return &svc, errors.Wrapf(err, "failed to get service %s/%s", namespace, serviceID)
+}
+
+// ReplaceService replaces an existing service. The update is rejected if the
+// service was changed since it was retrieved.
+func (k *Knative) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	var updated run.Service
+	err := k.client.Do(k.ctx, http.MethodPut, knativePath(namespace, "services", serviceID), "application/json", svc, &updated)
+	return &updated, errors.Wrapf(err, "failed to replace service %s/%s", namespace, serviceID)
+}
+
+// Revision retrieves information about a revision.
+func (k *Knative) Revision(namespace, revisionID string) (*run.Revision, error) {
+	var revision run.Revision
+	err := k.client.Do(k.ctx, http.MethodGet, knativePath(namespace, "revisions", revisionID), "", nil, &revision)
+	return &revision, errors.Wrapf(err, "failed to get revision %s/%s", namespace, revisionID)
+}
+
+// ServicesWithLabelSelector gets services filtered by a label selector.
+func (k *Knative) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	var list run.ListServicesResponse
+	path := knativePath(namespace, "services", "") + "?labelSelector=" + url.QueryEscape(labelSelector)
+	if err := k.client.Do(k.ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, errors.Wrap(err, "failed to filter services by label selector")
+	}
+	return list.Items, nil
+}
+
+// knativePath returns the path of the resource, or of the collection if the
+// name is empty.
+func knativePath(namespace, resource, name string) string {
+	path := fmt.Sprintf("%s/namespaces/%s/%s", knativeServingAPI, namespace, resource)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
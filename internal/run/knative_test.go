@@ -0,0 +1,59 @@
+package run_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestKnative(t *testing.T) {
+	var replaced run.Service
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/serving.knative.dev/v1/namespaces/default/services":
+			assert.Equal(t, "team=backend", r.URL.Query().Get("labelSelector"))
+			w.Write([]byte(`{"items": [{"metadata": {"name": "api", "namespace": "default"}}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/serving.knative.dev/v1/namespaces/default/services/api":
+			w.Write([]byte(`{"metadata": {"name": "api"}, "spec": {"traffic": [{"revisionName": "api-001", "percent": 100}]}}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/apis/serving.knative.dev/v1/namespaces/default/services/api":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&replaced))
+			json.NewEncoder(w).Encode(replaced)
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/serving.knative.dev/v1/namespaces/default/revisions/api-002":
+			w.Write([]byte(`{"metadata": {"name": "api-002"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := runapi.NewKnativeClient(context.Background(), kube.NewClient(server.Client(), server.URL))
+
+	svcs, err := client.ServicesWithLabelSelector("default", "team=backend")
+	assert.Nil(t, err)
+	if assert.Len(t, svcs, 1) {
+		assert.Equal(t, "api", svcs[0].Metadata.Name)
+	}
+
+	svc, err := client.Service("default", "api")
+	assert.Nil(t, err)
+	assert.Equal(t, []*run.TrafficTarget{{RevisionName: "api-001", Percent: 100}}, svc.Spec.Traffic)
+
+	svc.Spec.Traffic = []*run.TrafficTarget{{RevisionName: "api-001", Percent: 95}, {RevisionName: "api-002", Percent: 5}}
+	_, err = client.ReplaceService("default", "api", svc)
+	assert.Nil(t, err)
+	assert.Equal(t, svc.Spec.Traffic, replaced.Spec.Traffic)
+
+	revision, err := client.Revision("default", "api-002")
+	assert.Nil(t, err)
+	assert.Equal(t, "api-002", revision.Metadata.Name)
+
+	_, err = client.Service("default", "missing")
+	assert.NotNil(t, err)
+}
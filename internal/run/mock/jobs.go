@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+)
+
+// JobsAPI represents a mock implementation of run.JobsClient.
+type JobsAPI struct {
+	JobsWithLabelSelectorFn      func(project, labelSelector string) ([]*runapi.Job, error)
+	JobsWithLabelSelectorInvoked bool
+
+	JobFn      func(project, jobID string) (*runapi.Job, error)
+	JobInvoked bool
+
+	UpdateJobFn      func(project, jobID string, job *runapi.Job) error
+	UpdateJobInvoked bool
+
+	RunJobFn      func(project, jobID string, args []string, env map[string]string, timeout time.Duration) (string, error)
+	RunJobInvoked bool
+
+	ExecutionFn      func(name string) (*runapi.Execution, error)
+	ExecutionInvoked bool
+}
+
+// JobsWithLabelSelector invokes the mock implementation and marks the function as invoked.
+func (a *JobsAPI) JobsWithLabelSelector(project, labelSelector string) ([]*runapi.Job, error) {
+	a.JobsWithLabelSelectorInvoked = true
+	return a.JobsWithLabelSelectorFn(project, labelSelector)
+}
+
+// Job invokes the mock implementation and marks the function as invoked.
+func (a *JobsAPI) Job(project, jobID string) (*runapi.Job, error) {
+	a.JobInvoked = true
+	return a.JobFn(project, jobID)
+}
+
+// UpdateJob invokes the mock implementation and marks the function as invoked.
+func (a *JobsAPI) UpdateJob(project, jobID string, job *runapi.Job) error {
+	a.UpdateJobInvoked = true
+	return a.UpdateJobFn(project, jobID, job)
+}
+
+// RunJob invokes the mock implementation and marks the function as invoked.
+func (a *JobsAPI) RunJob(project, jobID string, args []string, env map[string]string, timeout time.Duration) (string, error) {
+	a.RunJobInvoked = true
+	return a.RunJobFn(project, jobID, args, env, timeout)
+}
+
+// Execution invokes the mock implementation and marks the function as invoked.
+func (a *JobsAPI) Execution(name string) (*runapi.Execution, error) {
+	a.ExecutionInvoked = true
+	return a.ExecutionFn(name)
+}
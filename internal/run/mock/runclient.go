@@ -9,6 +9,12 @@ type RunAPI struct {
 
 	ReplaceServiceFn      func(namespace, serviceID string, svc *run.Service) (*run.Service, error)
 	ReplaceServiceInvoked bool
+
+	RevisionFn      func(namespace, revisionID string) (*run.Revision, error)
+	RevisionInvoked bool
+
+	ServicesWithLabelSelectorFn      func(namespace string, labelSelector string) ([]*run.Service, error)
+	ServicesWithLabelSelectorInvoked bool
 }
 
 // Service invokes the mock implementation and marks the function as invoked.
@@ -22,3 +28,15 @@ func (a *RunAPI) ReplaceService(namespace, serviceID string, svc *run.Service) (
 	a.ReplaceServiceInvoked = true
 	return a.ReplaceServiceFn(namespace, serviceID, svc)
 }
+
+// Revision invokes the mock implementation and marks the function as invoked.
+func (a *RunAPI) Revision(namespace, revisionID string) (*run.Revision, error) {
+	a.RevisionInvoked = true
+	return a.RevisionFn(namespace, revisionID)
+}
+
+// ServicesWithLabelSelector invokes the mock implementation and marks the function as invoked.
+func (a *RunAPI) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	a.ServicesWithLabelSelectorInvoked = true
+	return a.ServicesWithLabelSelectorFn(namespace, labelSelector)
+}
@@ -0,0 +1,385 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/run/v1"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// v2Endpoint is the global endpoint of the Cloud Run Admin API v2.
+const v2Endpoint = "https://run.googleapis.com/"
+
+// v2UpdateMask are the fields of the services updated by APIv2, so concurrent
+// changes to the other fields (e.g. a new image) are never overwritten.
+const v2UpdateMask = "traffic,annotations"
+
+// APIv2 is a client for the Cloud Run Admin API v2 (projects.locations.services).
+//
+// The services and revisions are converted to the Knative representation of
+// the v1 API used by the rollout. Only the traffic and the annotations of the
+// services are updated, with a field mask, and the update is rejected if the
+// service changed since it was retrieved (the resource version is the etag).
+//
+// Since the revisions are nested in the services in the v2 API, the client
+// remembers the service of the revisions referenced by the services it
+// retrieved. A client is meant to be used for a single rollout cycle.
+type APIv2 struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	region   string
+
+	mu               sync.Mutex
+	revisionServices map[string]string
+}
+
+// NewAPIv2Client initializes a client for the Cloud Run Admin API v2 for the
+// services of the region.
+func NewAPIv2Client(ctx context.Context, region string, opts ...option.ClientOption) (*APIv2, error) {
+	opts = append([]option.ClientOption{option.WithScopes("https://www.googleapis.com/auth/cloud-platform")}, opts...)
+	client, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Cloud Run Admin API v2")
+	}
+	if endpoint == "" {
+		endpoint = v2Endpoint
+	}
+	return &APIv2{
+		ctx:              ctx,
+		client:           client,
+		endpoint:         strings.TrimSuffix(endpoint, "/"),
+		region:           region,
+		revisionServices: make(map[string]string),
+	}, nil
+}
+
+// v2Service is the subset of the v2 Service resource used by the operator.
+type v2Service struct {
+	Name                  string                  `json:"name,omitempty"`
+	Generation            string                  `json:"generation,omitempty"`
+	Labels                map[string]string       `json:"labels,omitempty"`
+	Annotations           map[string]string       `json:"annotations,omitempty"`
+	Traffic               []v2TrafficTarget       `json:"traffic,omitempty"`
+	LatestReadyRevision   string                  `json:"latestReadyRevision,omitempty"`
+	LatestCreatedRevision string                  `json:"latestCreatedRevision,omitempty"`
+	TrafficStatuses       []v2TrafficTargetStatus `json:"trafficStatuses,omitempty"`
+	URI                   string                  `json:"uri,omitempty"`
+	Etag                  string                  `json:"etag,omitempty"`
+}
+
+// Types of the traffic targets.
+const (
+	v2TrafficTypeRevision = "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION"
+	v2TrafficTypeLatest   = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+)
+
+type v2TrafficTarget struct {
+	Type     string `json:"type,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Percent  int64  `json:"percent,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+type v2TrafficTargetStatus struct {
+	Type     string `json:"type,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Percent  int64  `json:"percent,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+// v2Revision is the subset of the v2 Revision resource used by the operator.
+type v2Revision struct {
+	Name        string            `json:"name"`
+	Service     string            `json:"service,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Service retrieves information about a service.
+func (a *APIv2) Service(namespace, serviceID string) (*run.Service, error) {
+	var svc v2Service
+	if err := a.do(http.MethodGet, a.servicePath(namespace, serviceID), nil, &svc); err != nil {
+		return nil, errors.Wrapf(err, "failed to get service %q", serviceID)
+	}
+	a.rememberRevisions(svc)
+	return svc.toV1(namespace), nil
+}
+
+// ReplaceService updates the traffic and the annotations of an existing
+// service, and returns the updated service.
+func (a *APIv2) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	update := v2Service{
+		Annotations: svc.Metadata.Annotations,
+		Etag:        svc.Metadata.ResourceVersion,
+	}
+	for _, target := range svc.Spec.Traffic {
+		t := v2TrafficTarget{Type: v2TrafficTypeRevision, Revision: target.RevisionName, Percent: target.Percent, Tag: target.Tag}
+		if target.LatestRevision {
+			t.Type, t.Revision = v2TrafficTypeLatest, ""
+		}
+		update.Traffic = append(update.Traffic, t)
+	}
+
+	path := a.servicePath(namespace, serviceID) + "?updateMask=" + url.QueryEscape(v2UpdateMask)
+	// The update is a long-running operation, but the new traffic is part of
+	// the service as soon as the operation starts.
+	if err := a.do(http.MethodPatch, path, update, nil); err != nil {
+		return nil, errors.Wrapf(err, "failed to update service %q", serviceID)
+	}
+	return a.Service(namespace, serviceID)
+}
+
+// Revision retrieves information about a revision.
+func (a *APIv2) Revision(namespace, revisionID string) (*run.Revision, error) {
+	var revision v2Revision
+	service, err := a.revisionService(namespace, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s/revisions/%s", a.servicePath(namespace, service), revisionID)
+	if err := a.do(http.MethodGet, path, nil, &revision); err != nil {
+		return nil, errors.Wrapf(err, "failed to get revision %q", revisionID)
+	}
+	return &run.Revision{Metadata: &run.ObjectMeta{
+		Name:        shortName(revision.Name),
+		Namespace:   namespace,
+		Labels:      revision.Labels,
+		Annotations: revision.Annotations,
+	}}, nil
+}
+
+// revisionService returns the name of the service of the revision, since the
+// revisions are nested in the services in the v2 API.
+//
+// The revisions the rollout looks up are usually referenced by the service
+// retrieved beforehand. Otherwise, the revisions of all the services are
+// listed (with the "-" wildcard) until the revision is found, and its service
+// field is used.
+func (a *APIv2) revisionService(namespace, revisionID string) (string, error) {
+	if service, ok := a.rememberedService(revisionID); ok {
+		return service, nil
+	}
+
+	var pageToken string
+	for {
+		var resp struct {
+			Revisions     []v2Revision `json:"revisions"`
+			NextPageToken string       `json:"nextPageToken"`
+		}
+		path := a.servicePath(namespace, "-") + "/revisions"
+		if pageToken != "" {
+			path += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		if err := a.do(http.MethodGet, path, nil, &resp); err != nil {
+			return "", errors.Wrap(err, "failed to list revisions")
+		}
+		a.mu.Lock()
+		for _, revision := range resp.Revisions {
+			a.revisionServices[shortName(revision.Name)] = shortName(revision.Service)
+		}
+		a.mu.Unlock()
+		if service, ok := a.rememberedService(revisionID); ok {
+			return service, nil
+		}
+		if resp.NextPageToken == "" {
+			return "", errors.Errorf("no service found for revision %q", revisionID)
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// rememberedService returns the service of the revision, if known.
+func (a *APIv2) rememberedService(revisionID string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	service, ok := a.revisionServices[revisionID]
+	return service, ok && service != ""
+}
+
+// rememberRevisions remembers the service of the revisions referenced by the
+// service.
+func (a *APIv2) rememberRevisions(svc v2Service) {
+	service := shortName(svc.Name)
+	revisions := []string{svc.LatestReadyRevision, svc.LatestCreatedRevision}
+	for _, target := range svc.Traffic {
+		revisions = append(revisions, target.Revision)
+	}
+	for _, status := range svc.TrafficStatuses {
+		revisions = append(revisions, status.Revision)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, revision := range revisions {
+		if revision != "" {
+			a.revisionServices[shortName(revision)] = service
+		}
+	}
+}
+
+// ServicesWithLabelSelector gets services filtered by a label selector. The
+// v2 API does not filter by label, so the services are filtered by the client.
+// Only equality (key=value), inequality (key!=value) and existence (key)
+// requirements are supported.
+func (a *APIv2) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	svcs, err := a.services(namespace)
+	if err != nil {
+		return nil, err
+	}
+	var matching []*run.Service
+	for _, svc := range svcs {
+		if MatchesLabelSelector(svc.Labels, labelSelector) {
+			matching = append(matching, svc.toV1(namespace))
+		}
+	}
+	return matching, nil
+}
+
+// services returns all the services of the project in the region.
+func (a *APIv2) services(project string) ([]v2Service, error) {
+	var (
+		svcs      []v2Service
+		pageToken string
+	)
+	for {
+		var resp struct {
+			Services      []v2Service `json:"services"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		path := fmt.Sprintf("/v2/projects/%s/locations/%s/services", project, a.region)
+		if pageToken != "" {
+			path += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		if err := a.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, errors.Wrap(err, "failed to list services")
+		}
+		svcs = append(svcs, resp.Services...)
+		for _, svc := range resp.Services {
+			a.rememberRevisions(svc)
+		}
+		if resp.NextPageToken == "" {
+			return svcs, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+func (a *APIv2) servicePath(project, serviceID string) string {
+	return fmt.Sprintf("/v2/projects/%s/locations/%s/services/%s", project, a.region, serviceID)
+}
+
+// do sends a request to the API with the JSON encoding of the body, if not
+// nil, and decodes the JSON response in v, if not nil.
+func (a *APIv2) do(method, path string, body, v interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+	}
+	req, err := http.NewRequest(method, a.endpoint+path, &reqBody)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(a.ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "failed to decode response")
+}
+
+// toV1 converts the service to the Knative representation of the v1 API.
+func (svc v2Service) toV1(namespace string) *run.Service {
+	generation, _ := strconv.ParseInt(svc.Generation, 10, 64)
+	v1 := &run.Service{
+		Metadata: &run.ObjectMeta{
+			Name:            shortName(svc.Name),
+			Namespace:       namespace,
+			Labels:          svc.Labels,
+			Annotations:     svc.Annotations,
+			Generation:      generation,
+			ResourceVersion: svc.Etag,
+		},
+		Spec: &run.ServiceSpec{},
+		Status: &run.ServiceStatus{
+			LatestReadyRevisionName:   shortName(svc.LatestReadyRevision),
+			LatestCreatedRevisionName: shortName(svc.LatestCreatedRevision),
+			Url:                       svc.URI,
+		},
+	}
+	for _, target := range svc.Traffic {
+		v1.Spec.Traffic = append(v1.Spec.Traffic, &run.TrafficTarget{
+			RevisionName:   target.Revision,
+			LatestRevision: target.Type == v2TrafficTypeLatest,
+			Percent:        target.Percent,
+			Tag:            target.Tag,
+		})
+	}
+	for _, status := range svc.TrafficStatuses {
+		v1.Status.Traffic = append(v1.Status.Traffic, &run.TrafficTarget{
+			RevisionName:   status.Revision,
+			LatestRevision: status.Type == v2TrafficTypeLatest,
+			Percent:        status.Percent,
+			Tag:            status.Tag,
+			Url:            status.URI,
+		})
+	}
+	return v1
+}
+
+// shortName returns the last segment of the resource name.
+func shortName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// MatchesLabelSelector determines if the labels meet all the requirements of
+// the label selector.
+func MatchesLabelSelector(labels map[string]string, labelSelector string) bool {
+	for _, requirement := range strings.Split(labelSelector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		switch {
+		case requirement == "":
+		case strings.Contains(requirement, "!="):
+			parts := strings.SplitN(requirement, "!=", 2)
+			if labels[strings.TrimSpace(parts[0])] == strings.TrimSpace(parts[1]) {
+				return false
+			}
+		case strings.Contains(requirement, "="):
+			parts := strings.SplitN(strings.Replace(requirement, "==", "=", 1), "=", 2)
+			value, ok := labels[strings.TrimSpace(parts[0])]
+			if !ok || value != strings.TrimSpace(parts[1]) {
+				return false
+			}
+		default:
+			if _, ok := labels[requirement]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package run_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/run/v1"
+)
+
+func TestAPIv2(t *testing.T) {
+	const servicesPath = "/v2/projects/myproject/locations/us-east1/services"
+	var (
+		updateMask     string
+		updated        map[string]interface{}
+		revisionsLists int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == servicesPath:
+			w.Write([]byte(`{"services": [
+				{"name": "projects/myproject/locations/us-east1/services/api", "labels": {"team": "backend"}},
+				{"name": "projects/myproject/locations/us-east1/services/api-v2", "labels": {"team": "backend", "env": "test"}},
+				{"name": "projects/myproject/locations/us-east1/services/web", "labels": {"team": "frontend"}}
+			]}`))
+		case r.Method == http.MethodGet && r.URL.Path == servicesPath+"/api":
+			w.Write([]byte(`{
+				"name": "projects/myproject/locations/us-east1/services/api",
+				"annotations": {"rollout.cloud.run/stableRevision": "api-001"},
+				"etag": "\"abc\"",
+				"traffic": [{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION", "revision": "api-001", "percent": 100}],
+				"latestReadyRevision": "projects/myproject/locations/us-east1/services/api/revisions/api-002",
+				"trafficStatuses": [{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION", "revision": "api-001", "percent": 100, "tag": "stable", "uri": "https://stable---api.a.run.app"}],
+				"uri": "https://api.a.run.app"
+			}`))
+		case r.Method == http.MethodPatch && r.URL.Path == servicesPath+"/api":
+			updateMask = r.URL.Query().Get("updateMask")
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&updated))
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/operations/123"}`))
+		case r.Method == http.MethodGet && r.URL.Path == servicesPath+"/-/revisions":
+			revisionsLists++
+			if r.URL.Query().Get("pageToken") == "" {
+				w.Write([]byte(`{"revisions": [
+					{"name": "projects/myproject/locations/us-east1/services/web/revisions/web-001", "service": "projects/myproject/locations/us-east1/services/web"}
+				], "nextPageToken": "next"}`))
+				return
+			}
+			w.Write([]byte(`{"revisions": [
+				{"name": "projects/myproject/locations/us-east1/services/api-v2/revisions/custom-name", "service": "projects/myproject/locations/us-east1/services/api-v2"}
+			]}`))
+		case r.Method == http.MethodGet && r.URL.Path == servicesPath+"/api/revisions/api-002":
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/services/api/revisions/api-002", "labels": {"team": "backend"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == servicesPath+"/api-v2/revisions/custom-name":
+			w.Write([]byte(`{"name": "projects/myproject/locations/us-east1/services/api-v2/revisions/custom-name", "labels": {"team": "backend"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := runapi.NewAPIv2Client(context.Background(), "us-east1",
+		option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	svcs, err := client.ServicesWithLabelSelector("myproject", "team=backend,env!=test")
+	assert.Nil(t, err)
+	if assert.Len(t, svcs, 1) {
+		assert.Equal(t, "api", svcs[0].Metadata.Name)
+	}
+
+	svc, err := client.Service("myproject", "api")
+	assert.Nil(t, err)
+	assert.Equal(t, `"abc"`, svc.Metadata.ResourceVersion)
+	assert.Equal(t, "api-002", svc.Status.LatestReadyRevisionName)
+	assert.Equal(t, "https://api.a.run.app", svc.Status.Url)
+	assert.Equal(t, []*run.TrafficTarget{{RevisionName: "api-001", Percent: 100}}, svc.Spec.Traffic)
+	assert.Equal(t, []*run.TrafficTarget{{RevisionName: "api-001", Percent: 100, Tag: "stable", Url: "https://stable---api.a.run.app"}}, svc.Status.Traffic)
+
+	svc.Spec.Traffic = []*run.TrafficTarget{{RevisionName: "api-001", Percent: 95}, {LatestRevision: true, Percent: 5}}
+	_, err = client.ReplaceService("myproject", "api", svc)
+	assert.Nil(t, err)
+	assert.Equal(t, "traffic,annotations", updateMask)
+	assert.Equal(t, map[string]interface{}{
+		"annotations": map[string]interface{}{"rollout.cloud.run/stableRevision": "api-001"},
+		"etag":        `"abc"`,
+		"traffic": []interface{}{
+			map[string]interface{}{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION", "revision": "api-001", "percent": float64(95)},
+			map[string]interface{}{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST", "percent": float64(5)},
+		},
+	}, updated)
+
+	// The service of the revisions referenced by the retrieved services is
+	// known, the others are looked up in the list of revisions.
+	revision, err := client.Revision("myproject", "api-002")
+	assert.Nil(t, err)
+	assert.Equal(t, "api-002", revision.Metadata.Name)
+	assert.Equal(t, map[string]string{"team": "backend"}, revision.Metadata.Labels)
+	assert.Equal(t, 0, revisionsLists)
+
+	revision, err = client.Revision("myproject", "custom-name")
+	assert.Nil(t, err)
+	assert.Equal(t, "custom-name", revision.Metadata.Name)
+	assert.Equal(t, 2, revisionsLists)
+	_, err = client.Revision("myproject", "custom-name")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, revisionsLists)
+
+	_, err = client.Revision("myproject", "other-001")
+	assert.NotNil(t, err)
+	_, err = client.Service("myproject", "missing")
+	assert.NotNil(t, err)
+}
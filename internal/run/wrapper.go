@@ -3,17 +3,46 @@ package run
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
 	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/run/v1"
 )
 
 // Client represents a wrapper around the Cloud Run package.
+//
+// The namespace is the project for Cloud Run (fully managed) and the
+// Kubernetes namespace for Knative Serving.
 type Client interface {
 	Service(namespace, serviceID string) (*run.Service, error)
 	ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error)
+	Revision(namespace, revisionID string) (*run.Revision, error)
+	ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error)
+}
+
+// ErrConflict is returned when the service was modified since it was
+// retrieved, in a way that invalidates the update.
+var ErrConflict = errors.New("the service was modified concurrently")
+
+// IsConflict determines if the update of a service failed because the service
+// was modified since it was retrieved, i.e. its resource version (or etag) is
+// outdated.
+func IsConflict(err error) bool {
+	if errors.Cause(err) == ErrConflict {
+		return true
+	}
+	switch err := errors.Cause(err).(type) {
+	case *googleapi.Error:
+		return err.Code == http.StatusConflict || err.Code == http.StatusPreconditionFailed
+	case *kube.StatusError:
+		return err.Code == http.StatusConflict
+	}
+	return false
 }
 
 // API is a wrapper for the Cloud Run package.
@@ -22,16 +51,17 @@ type API struct {
 	Region string
 }
 
-// regions are the available regions.
-//
-// TODO: caching regions might be unnecessary if we are querying them once during
-// the lifespan of the process.
-var regions = []string{}
+// regions are the available regions, by project.
+var (
+	regions   = make(map[string][]string)
+	regionsMu sync.Mutex
+)
 
 // NewAPIClient initializes an instance of APIService.
-func NewAPIClient(ctx context.Context, region string) (*API, error) {
+func NewAPIClient(ctx context.Context, region string, opts ...option.ClientOption) (*API, error) {
 	regionalEndpoint := fmt.Sprintf("https://%s-run.googleapis.com/", region)
-	client, err := run.NewService(ctx, option.WithEndpoint(regionalEndpoint))
+	opts = append([]option.ClientOption{option.WithEndpoint(regionalEndpoint)}, opts...)
+	client, err := run.NewService(ctx, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize client for the Cloud Run API")
 	}
@@ -54,6 +84,12 @@ func (a *API) ReplaceService(namespace, serviceID string, svc *run.Service) (*ru
 	return a.Client.Namespaces.Services.ReplaceService(serviceName, svc).Do()
 }
 
+// Revision retrieves information about a revision.
+func (a *API) Revision(namespace, revisionID string) (*run.Revision, error) {
+	revisionName := fmt.Sprintf("namespaces/%s/revisions/%s", namespace, revisionID)
+	return a.Client.Namespaces.Revisions.Get(revisionName).Do()
+}
+
 // ServicesWithLabelSelector gets services filtered by a label selector.
 func (a *API) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
 	parent := fmt.Sprintf("namespaces/%s", namespace)
@@ -67,28 +103,36 @@ func (a *API) ServicesWithLabelSelector(namespace string, labelSelector string)
 }
 
 // Regions gets the supported regions for the project.
-func Regions(ctx context.Context, project string) ([]string, error) {
+func Regions(ctx context.Context, project string, opts ...option.ClientOption) ([]string, error) {
 	logger := util.LoggerFrom(ctx)
-	if len(regions) != 0 {
+	regionsMu.Lock()
+	cached, ok := regions[project]
+	regionsMu.Unlock()
+	if ok {
 		logger.Debug("using cached regions, skip querying from API")
-		return regions, nil
+		return cached, nil
 	}
 
-	client, err := run.NewService(ctx)
+	client, err := run.NewService(ctx, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize client for the Cloud Run API")
 	}
 
 	name := fmt.Sprintf("projects/%s", project)
-	resp, err := client.Projects.Locations.List(name).Do()
+	var projectRegions []string
+	err = client.Projects.Locations.List(name).Pages(ctx, func(resp *run.ListLocationsResponse) error {
+		for _, location := range resp.Locations {
+			projectRegions = append(projectRegions, location.LocationId)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get locations")
 	}
-
-	for _, location := range resp.Locations {
-		regions = append(regions, location.LocationId)
-	}
-	return regions, nil
+	regionsMu.Lock()
+	regions[project] = projectRegions
+	regionsMu.Unlock()
+	return projectRegions, nil
 }
 
 // generateServiceName returns the name of the specified service. It returns the
@@ -0,0 +1,43 @@
+// Package serviceusage checks the APIs enabled in a project with the Service
+// Usage API.
+package serviceusage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	serviceusage "google.golang.org/api/serviceusage/v1"
+)
+
+// Client checks the APIs enabled in the projects.
+type Client struct {
+	services *serviceusage.Service
+}
+
+// NewClient initializes a client for the Service Usage API.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (*Client, error) {
+	services, err := serviceusage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Service Usage API")
+	}
+	return &Client{services: services}, nil
+}
+
+// DisabledAPIs returns the APIs (e.g. run.googleapis.com), among the ones
+// passed, that are not enabled in the project.
+func (c *Client) DisabledAPIs(ctx context.Context, project string, apis []string) ([]string, error) {
+	var disabled []string
+	for _, api := range apis {
+		name := fmt.Sprintf("projects/%s/services/%s", project, api)
+		service, err := c.services.Services.Get(name).Context(ctx).Do()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the state of %s in project %s", api, project)
+		}
+		if service.State != "ENABLED" {
+			disabled = append(disabled, api)
+		}
+	}
+	return disabled, nil
+}
@@ -0,0 +1,40 @@
+package serviceusage_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/serviceusage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestDisabledAPIs(t *testing.T) {
+	states := map[string]string{
+		"/v1/projects/myproject/services/run.googleapis.com":        "ENABLED",
+		"/v1/projects/myproject/services/monitoring.googleapis.com": "DISABLED",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, ok := states[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": state})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := serviceusage.NewClient(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	disabled, err := client.DisabledAPIs(ctx, "myproject", []string{"run.googleapis.com", "monitoring.googleapis.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"monitoring.googleapis.com"}, disabled)
+
+	_, err = client.DisabledAPIs(ctx, "other", []string{"run.googleapis.com"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,47 @@
+// Package shard splits the managed services between several instances of
+// the operator, so that each service is managed by exactly one of them.
+package shard
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Of returns the shard, between 0 and shards-1, of the key.
+//
+// The shard is computed with jump consistent hashing (Lamping and Veach,
+// https://arxiv.org/abs/1406.2294): when the number of shards grows, the only
+// keys that change shard are the ones that move to the new shards.
+func Of(key string, shards int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	k := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// FromCloudRunJob returns the shard of the task of the Cloud Run job the
+// operator runs in, read from its environment with getenv (e.g. os.Getenv),
+// so the services are split between the tasks of the job. ok is false if the
+// operator does not run in a Cloud Run job.
+func FromCloudRunJob(getenv func(key string) string) (index, count int, ok bool, err error) {
+	taskCount := getenv("CLOUD_RUN_TASK_COUNT")
+	if taskCount == "" {
+		return 0, 0, false, nil
+	}
+	if count, err = strconv.Atoi(taskCount); err != nil {
+		return 0, 0, false, errors.Wrap(err, "invalid CLOUD_RUN_TASK_COUNT")
+	}
+	if index, err = strconv.Atoi(getenv("CLOUD_RUN_TASK_INDEX")); err != nil {
+		return 0, 0, false, errors.Wrap(err, "invalid CLOUD_RUN_TASK_INDEX")
+	}
+	return index, count, true, nil
+}
@@ -0,0 +1,80 @@
+package shard_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/shard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOf(t *testing.T) {
+	const keys = 10000
+	counts := make([]int, 4)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("myproject/service-%d", i)
+		s := shard.Of(key, 4)
+		assert.Equal(t, s, shard.Of(key, 4), "deterministic")
+		if !assert.True(t, s >= 0 && s < 4, "shard %d out of range", s) {
+			return
+		}
+		counts[s]++
+
+		// Growing the number of shards only moves keys to the new shard.
+		if next := shard.Of(key, 5); next != s {
+			assert.Equal(t, 4, next, key)
+		}
+		assert.Equal(t, 0, shard.Of(key, 1))
+	}
+	for s, count := range counts {
+		assert.InDelta(t, keys/4, count, keys/20, "shard %d", s)
+	}
+}
+
+func TestFromCloudRunJob(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectedIndex int
+		expectedCount int
+		expectedOK    bool
+		shouldErr     bool
+	}{
+		{
+			name: "not in a job",
+			env:  map[string]string{},
+		},
+		{
+			name:          "task of a job",
+			env:           map[string]string{"CLOUD_RUN_TASK_COUNT": "4", "CLOUD_RUN_TASK_INDEX": "2"},
+			expectedIndex: 2,
+			expectedCount: 4,
+			expectedOK:    true,
+		},
+		{
+			name:      "invalid task count",
+			env:       map[string]string{"CLOUD_RUN_TASK_COUNT": "four", "CLOUD_RUN_TASK_INDEX": "2"},
+			shouldErr: true,
+		},
+		{
+			name:      "missing task index",
+			env:       map[string]string{"CLOUD_RUN_TASK_COUNT": "4"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			getenv := func(key string) string { return test.env[key] }
+			index, count, ok, err := shard.FromCloudRunJob(getenv)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expectedIndex, index)
+			assert.Equal(tt, test.expectedCount, count)
+			assert.Equal(tt, test.expectedOK, ok)
+		})
+	}
+}
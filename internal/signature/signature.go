@@ -0,0 +1,158 @@
+// Package signature verifies the signatures of the incoming webhook requests,
+// so the endpoints that trigger the operator cannot be called by anyone who
+// knows their URL, and rejects the signed requests that are replayed.
+//
+// The replay protection only holds per process: the signatures accepted by a
+// Verifier are remembered in memory, so a request replayed to another
+// instance of the operator within the tolerance is accepted.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+)
+
+// Headers of the requests signed with the generic scheme (see NewHMAC).
+const (
+	SignatureHeader = "X-Rollout-Signature"
+	TimestampHeader = "X-Rollout-Timestamp"
+)
+
+// Headers of the requests signed by Slack (see NewSlack).
+const (
+	SlackSignatureHeader = "X-Slack-Signature"
+	SlackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// DefaultTolerance is the default maximum difference between the time a
+// request was signed and the time it is received.
+const DefaultTolerance = 5 * time.Minute
+
+// scheme is how the requests are signed.
+type scheme struct {
+	signatureHeader string
+	timestampHeader string
+
+	// prefix is the prefix of the signature, before the hex digest.
+	prefix string
+
+	// base returns the signed content of the request.
+	base func(timestamp string, body []byte) []byte
+}
+
+var (
+	hmacScheme = scheme{
+		signatureHeader: SignatureHeader,
+		timestampHeader: TimestampHeader,
+		prefix:          "sha256=",
+		base: func(timestamp string, body []byte) []byte {
+			return append([]byte(timestamp+"."), body...)
+		},
+	}
+	slackScheme = scheme{
+		signatureHeader: SlackSignatureHeader,
+		timestampHeader: SlackTimestampHeader,
+		prefix:          "v0=",
+		base: func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		},
+	}
+)
+
+// Verifier verifies the signatures of the requests and remembers the
+// signatures it accepted while they are within the tolerance, so each signed
+// request is only accepted once by this verifier.
+type Verifier struct {
+	scheme    scheme
+	secret    []byte
+	tolerance time.Duration
+	clock     clockwork.Clock
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewHMAC initializes a verifier of the requests signed with the secret: the
+// TimestampHeader is the Unix time of the request, in seconds, and the
+// SignatureHeader is "sha256=" followed by the hex digest of the
+// HMAC-SHA256 of the timestamp, a dot and the body.
+func NewHMAC(secret string, tolerance time.Duration) *Verifier {
+	return newVerifier(hmacScheme, secret, tolerance)
+}
+
+// NewSlack initializes a verifier of the requests signed by Slack (e.g. the
+// slash commands and the interactive components of a Slack app) with the
+// signing secret of the app.
+func NewSlack(signingSecret string, tolerance time.Duration) *Verifier {
+	return newVerifier(slackScheme, signingSecret, tolerance)
+}
+
+func newVerifier(scheme scheme, secret string, tolerance time.Duration) *Verifier {
+	return &Verifier{
+		scheme:    scheme,
+		secret:    []byte(secret),
+		tolerance: tolerance,
+		clock:     clockwork.NewRealClock(),
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// WithClock updates the clock used to check the timestamps.
+func (v *Verifier) WithClock(clock clockwork.Clock) *Verifier {
+	v.clock = clock
+	return v
+}
+
+// Signed determines if the request carries a signature of the scheme of the
+// verifier, so it can be told apart from the requests of other schemes.
+func (v *Verifier) Signed(header http.Header) bool {
+	return header.Get(v.scheme.signatureHeader) != ""
+}
+
+// Verify checks the signature and the timestamp of the request with the body,
+// and that the request was not already accepted.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	signature := header.Get(v.scheme.signatureHeader)
+	if signature == "" {
+		return errors.Errorf("missing %s header", v.scheme.signatureHeader)
+	}
+	timestamp := header.Get(v.scheme.timestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid %s header %q", v.scheme.timestampHeader, timestamp)
+	}
+	now := v.clock.Now()
+	signedAt := time.Unix(seconds, 0)
+	if diff := now.Sub(signedAt); diff > v.tolerance || diff < -v.tolerance {
+		return errors.Errorf("request timestamp %s is more than %s away from the current time", signedAt.UTC().Format(time.RFC3339), v.tolerance)
+	}
+
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(v.scheme.base(timestamp, body))
+	expected := v.scheme.prefix + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return errors.New("invalid signature")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for sig, expiry := range v.seen {
+		if now.After(expiry) {
+			delete(v.seen, sig)
+		}
+	}
+	if _, ok := v.seen[expected]; ok {
+		return errors.New("request was already received")
+	}
+	v.seen[expected] = signedAt.Add(v.tolerance)
+	return nil
+}
@@ -0,0 +1,143 @@
+package signature_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/signature"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	clock := clockwork.NewFakeClockAt(time.Unix(1600000000, 0))
+	body := `{"service": "checkout"}`
+	now := strconv.FormatInt(clock.Now().Unix(), 10)
+	old := strconv.FormatInt(clock.Now().Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		slack     bool
+		header    map[string]string
+		shouldErr bool
+	}{
+		{
+			name: "valid signature",
+			header: map[string]string{
+				signature.TimestampHeader: now,
+				signature.SignatureHeader: "sha256=" + sign("secret", now+"."+body),
+			},
+		},
+		{
+			name:  "valid Slack signature",
+			slack: true,
+			header: map[string]string{
+				signature.SlackTimestampHeader: now,
+				signature.SlackSignatureHeader: "v0=" + sign("secret", "v0:"+now+":"+body),
+			},
+		},
+		{
+			name:      "missing signature",
+			header:    map[string]string{signature.TimestampHeader: now},
+			shouldErr: true,
+		},
+		{
+			name: "invalid timestamp",
+			header: map[string]string{
+				signature.TimestampHeader: "yesterday",
+				signature.SignatureHeader: "sha256=" + sign("secret", "yesterday."+body),
+			},
+			shouldErr: true,
+		},
+		{
+			name: "wrong secret",
+			header: map[string]string{
+				signature.TimestampHeader: now,
+				signature.SignatureHeader: "sha256=" + sign("other", now+"."+body),
+			},
+			shouldErr: true,
+		},
+		{
+			name: "signature of another timestamp",
+			header: map[string]string{
+				signature.TimestampHeader: now,
+				signature.SignatureHeader: "sha256=" + sign("secret", old+"."+body),
+			},
+			shouldErr: true,
+		},
+		{
+			name: "timestamp out of tolerance",
+			header: map[string]string{
+				signature.TimestampHeader: old,
+				signature.SignatureHeader: "sha256=" + sign("secret", old+"."+body),
+			},
+			shouldErr: true,
+		},
+		{
+			name:  "generic signature for Slack",
+			slack: true,
+			header: map[string]string{
+				signature.TimestampHeader: now,
+				signature.SignatureHeader: "sha256=" + sign("secret", now+"."+body),
+			},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			verifier := signature.NewHMAC("secret", signature.DefaultTolerance)
+			if test.slack {
+				verifier = signature.NewSlack("secret", signature.DefaultTolerance)
+			}
+			verifier.WithClock(clock)
+			header := make(http.Header)
+			for key, value := range test.header {
+				header.Set(key, value)
+			}
+			err := verifier.Verify(header, []byte(body))
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	clock := clockwork.NewFakeClockAt(time.Unix(1600000000, 0))
+	verifier := signature.NewHMAC("secret", time.Minute).WithClock(clock)
+	body := []byte("{}")
+	header := func(timestamp time.Time) http.Header {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		h := make(http.Header)
+		h.Set(signature.TimestampHeader, ts)
+		h.Set(signature.SignatureHeader, "sha256="+sign("secret", ts+".{}"))
+		return h
+	}
+
+	first := header(clock.Now())
+	assert.True(t, verifier.Signed(first))
+	assert.Nil(t, verifier.Verify(first, body))
+	assert.NotNil(t, verifier.Verify(first, body), "replayed request")
+
+	clock.Advance(time.Second)
+	assert.Nil(t, verifier.Verify(header(clock.Now()), body), "new request")
+
+	// The replayed request is out of the tolerance once it is forgotten.
+	clock.Advance(2 * time.Minute)
+	assert.NotNil(t, verifier.Verify(first, body))
+	assert.False(t, verifier.Signed(make(http.Header)))
+}
@@ -3,12 +3,15 @@ package stackdriver
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/jonboulle/clockwork"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
 
 	// TODO: Migrate to cloud.google.com/go/monitoring/apiv3/v2 once RPC for MQL
 	// query is added (https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.timeSeries/query).
@@ -22,20 +25,88 @@ type query string
 type Provider struct {
 	metricsClient *monitoring.Service
 	project       string
+	serviceName   string
+	revision      string
 
 	// query is used to filter the metrics for the wanted resource.
 	query
+	semantics
+
+	// requestCounts holds the request count time series retrieved for
+	// requestCountsRevision, by offset, until they expire.
+	mu                    sync.Mutex
+	clock                 clockwork.Clock
+	requestCounts         map[time.Duration]requestCountResult
+	requestCountsRevision string
 }
 
-// Metric types.
-const (
-	requestLatencies = "run.googleapis.com/request_latencies"
-	requestCount     = "run.googleapis.com/request_count"
-)
+// requestCountsTTL is the time the request count time series are reused for:
+// long enough for the request count and the error rate of a diagnosis, short
+// enough for the next diagnosis to get fresh series.
+const requestCountsTTL = 30 * time.Second
+
+// requestCountResult is the result of a request count query.
+type requestCountResult struct {
+	timeSeries []*monitoring.TimeSeries
+	query      metrics.Query
+	expires    time.Time
+}
+
+// semantics are the metrics queried for the requests served by the services,
+// which depend on their protocol.
+type semantics struct {
+	requestCount     string
+	requestLatencies string
+
+	// latencyAligner is the per series aligner applied to the latency
+	// distribution before the percentile reducer. If empty, the percentile
+	// aligner is used.
+	latencyAligner string
+
+	// statusLabel is the label of the request count with the status of the
+	// responses, and serverErrors are the statuses counted as errors.
+	statusLabel  string
+	serverErrors map[string]bool
+
+	// metricLabels determines if the service and revision are metric labels
+	// instead of resource labels.
+	metricLabels bool
+}
+
+// httpSemantics are the metrics of the requests reported by Cloud Run.
+var httpSemantics = semantics{
+	requestCount:     "run.googleapis.com/request_count",
+	requestLatencies: "run.googleapis.com/request_latencies",
+	statusLabel:      "response_code_class",
+	serverErrors:     map[string]bool{"5xx": true},
+}
+
+// grpcSemantics are the metrics of the RPCs exported by the OpenCensus gRPC
+// server views. Cloud Run reports a 200 response code for RPCs regardless of
+// their status, so its own metrics cannot be used for error rates.
+//
+// The server latency is a cumulative distribution, so it is aligned as a delta
+// before the percentile is computed. The errors are the statuses that map to
+// 5xx HTTP response codes.
+var grpcSemantics = semantics{
+	requestCount:     "custom.googleapis.com/opencensus/grpc.io/server/completed_rpcs",
+	requestLatencies: "custom.googleapis.com/opencensus/grpc.io/server/server_latency",
+	latencyAligner:   "ALIGN_DELTA",
+	statusLabel:      "grpc_server_status",
+	serverErrors: map[string]bool{
+		"UNKNOWN":           true,
+		"DEADLINE_EXCEEDED": true,
+		"UNIMPLEMENTED":     true,
+		"INTERNAL":          true,
+		"UNAVAILABLE":       true,
+		"DATA_LOSS":         true,
+	},
+	metricLabels: true,
+}
 
 // NewProvider initializes the provider for Cloud Monitoring.
-func NewProvider(ctx context.Context, project string, region string, serviceName string) (*Provider, error) {
-	client, err := monitoring.NewService(ctx)
+func NewProvider(ctx context.Context, project string, region string, serviceName string, opts ...option.ClientOption) (*Provider, error) {
+	client, err := monitoring.NewService(ctx, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize Cloud Metics client")
 	}
@@ -43,67 +114,66 @@ func NewProvider(ctx context.Context, project string, region string, serviceName
 	return &Provider{
 		metricsClient: client,
 		project:       project,
+		serviceName:   serviceName,
 		query:         newQuery(project, region, serviceName),
+		semantics:     httpSemantics,
+		clock:         clockwork.NewRealClock(),
 	}, nil
 }
 
+// WithGRPCMetrics makes the provider get the metrics of gRPC services from the
+// OpenCensus gRPC server views, exported with the service_name and
+// revision_name metric labels set to the K_SERVICE and K_REVISION environment
+// variables of the service.
+func (p *Provider) WithGRPCMetrics() *Provider {
+	var q query
+	p.query = q.addFilter("metric.labels.service_name", p.serviceName)
+	p.semantics = grpcSemantics
+	return p
+}
+
 // SetCandidateRevision sets the candidate revision name for which the provider
 // should get metrics.
 func (p *Provider) SetCandidateRevision(revisionName string) {
-	p.query = p.query.addFilter("resource.labels.revision_name", revisionName)
+	p.revision = revisionName
 }
 
 // RequestCount count returns the number of requests for the given offset.
 func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
-	query := p.addFilter("metric.type", requestCount)
-	endTime := time.Now()
-	endTimeString := endTime.Format(time.RFC3339Nano)
-	startTime := endTime.Add(-1 * offset)
-	startTimeString := startTime.Format(time.RFC3339Nano)
-	offsetString := fmt.Sprintf("%fs", offset.Seconds())
-
-	req := p.metricsClient.Projects.TimeSeries.List("projects/" + p.project).
-		Filter(string(query)).
-		IntervalStartTime(startTimeString).
-		IntervalEndTime(endTimeString).
-		AggregationAlignmentPeriod(offsetString).
-		AggregationPerSeriesAligner("ALIGN_DELTA").
-		AggregationGroupByFields("resource.labels.service_name").
-		AggregationCrossSeriesReducer("REDUCE_SUM")
-
-	logger := util.LoggerFrom(ctx).WithFields(logrus.Fields{
-		"intervalStartTime": startTimeString,
-		"intervalEndTime":   endTimeString,
-		"metrics":           "request-count",
-	})
-	logger.Debug("querying Cloud Monitoring API")
-	timeSeries, err := makeRequestForTimeSeries(logger, req)
+	timeSeries, err := p.requestCountSeries(ctx, offset)
 	if err != nil {
-		return 0, errors.Wrap(err, "error when querying for time series")
+		return 0, err
 	}
 
 	// This happens when no request was made during the given offset.
 	if len(timeSeries) == 0 {
 		return 0, nil
 	}
-	// The request count is aggregated for the entire service, so only one time
-	// series and a point is returned. There's no need for a loop.
-	series := timeSeries[0]
-	if len(series.Points) == 0 {
-		return 0, errors.New("no data point was retrieved")
+	if err := p.verifyRevision(timeSeries); err != nil {
+		return 0, err
 	}
-	return *(series.Points[0].Value.Int64Value), nil
+	var count int64
+	for _, series := range timeSeries {
+		if len(series.Points) == 0 {
+			return 0, errors.New("no data point was retrieved")
+		}
+		count += *(series.Points[0].Value.Int64Value)
+	}
+	return count, nil
 }
 
 // Latency returns the latency for the resource for the given offset.
 // It returns 0 if no request was made during the interval.
 func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
-	query := p.query.addFilter("metric.type", requestLatencies)
+	query := p.revisionQuery().addFilter("metric.type", p.requestLatencies)
 	endTime := time.Now()
 	endTimeString := endTime.Format(time.RFC3339Nano)
 	startTime := endTime.Add(-1 * offset)
 	startTimeString := startTime.Format(time.RFC3339Nano)
 	aligner, reducer := alignerAndReducer(alignReduceType)
+	if p.latencyAligner != "" {
+		aligner = p.latencyAligner
+	}
 	offsetString := fmt.Sprintf("%fs", offset.Seconds())
 
 	req := p.metricsClient.Projects.TimeSeries.List("projects/" + p.project).
@@ -112,7 +182,7 @@ func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduc
 		IntervalEndTime(endTimeString).
 		AggregationAlignmentPeriod(offsetString).
 		AggregationPerSeriesAligner(aligner).
-		AggregationGroupByFields("resource.labels.service_name").
+		AggregationGroupByFields(p.groupByFields(p.label("service_name"))...).
 		AggregationCrossSeriesReducer(reducer)
 
 	logger := util.LoggerFrom(ctx).WithFields(logrus.Fields{
@@ -127,10 +197,15 @@ func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduc
 	if err != nil {
 		return 0, errors.Wrap(err, "error when querying for time series")
 	}
+	metrics.RecordQuery(ctx, recordedQuery(query, aligner, reducer, startTime, endTime))
 
-	// This happens when no request was made during the given offset.
+	// This happens when no request was made during the given offset or the
+	// data for the revision was not ingested yet.
 	if len(timeSeries) == 0 {
-		return 0, nil
+		return 0, p.missingData()
+	}
+	if err := p.verifyRevision(timeSeries); err != nil {
+		return 0, err
 	}
 	// The request count is aggregated for the entire service, so only one time
 	// series and a point is returned. There's no need for a loop.
@@ -144,7 +219,38 @@ func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduc
 // ErrorRate returns the rate of 5xx errors for the resource in the given offset.
 // It returns 0 if no request was made during the interval.
 func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
-	query := p.query.addFilter("metric.type", requestCount)
+	timeSeries, err := p.requestCountSeries(ctx, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	// This happens when no request was made during the given offset or the
+	// data for the revision was not ingested yet.
+	if len(timeSeries) == 0 {
+		return 0, p.missingData()
+	}
+	if err := p.verifyRevision(timeSeries); err != nil {
+		return 0, err
+	}
+	return p.calculateErrorResponseRate(timeSeries)
+}
+
+// requestCountSeries returns the request count time series grouped by response
+// status for the given offset.
+//
+// Both the request count and the error rate are computed from these series, so
+// they are only retrieved once per offset for a diagnosis (see
+// requestCountsTTL).
+func (p *Provider) requestCountSeries(ctx context.Context, offset time.Duration) ([]*monitoring.TimeSeries, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if result, ok := p.requestCounts[offset]; ok && p.requestCountsRevision == p.revision && now.Before(result.expires) {
+		metrics.RecordQuery(ctx, result.query)
+		return result.timeSeries, nil
+	}
+
+	query := p.revisionQuery().addFilter("metric.type", p.requestCount)
 	endTime := time.Now()
 	endTimeString := endTime.Format(time.RFC3339Nano)
 	startTime := endTime.Add(-1 * offset)
@@ -157,25 +263,99 @@ func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64
 		IntervalEndTime(endTimeString).
 		AggregationAlignmentPeriod(offsetString).
 		AggregationPerSeriesAligner("ALIGN_DELTA").
-		AggregationGroupByFields("metric.labels.response_code_class").
+		AggregationGroupByFields(p.groupByFields("metric.labels." + p.statusLabel)...).
 		AggregationCrossSeriesReducer("REDUCE_SUM")
 
 	logger := util.LoggerFrom(ctx).WithFields(logrus.Fields{
 		"intervalStartTime": startTimeString,
 		"intervalEndTime":   endTimeString,
-		"metrics":           "error-rate",
+		"metrics":           "request-count",
 	})
 	logger.Debug("querying Cloud Monitoring API")
 	timeSeries, err := makeRequestForTimeSeries(logger, req)
 	if err != nil {
-		return 0, errors.Wrap(err, "error when querying for time series")
+		return nil, errors.Wrap(err, "error when querying for time series")
 	}
 
-	// This happens when no request was made during the given offset.
-	if len(timeSeries) == 0 {
-		return 0, nil
+	recorded := recordedQuery(query, "ALIGN_DELTA", "REDUCE_SUM", startTime, endTime)
+	metrics.RecordQuery(ctx, recorded)
+	if p.requestCountsRevision != p.revision {
+		p.requestCounts = make(map[time.Duration]requestCountResult)
+		p.requestCountsRevision = p.revision
+	}
+	for o, result := range p.requestCounts {
+		if !now.Before(result.expires) {
+			delete(p.requestCounts, o)
+		}
+	}
+	p.requestCounts[offset] = requestCountResult{timeSeries: timeSeries, query: recorded, expires: now.Add(requestCountsTTL)}
+	return timeSeries, nil
+}
+
+// revisionQuery returns the query filtered by the candidate revision, if set.
+func (p *Provider) revisionQuery() query {
+	if p.revision == "" {
+		return p.query
+	}
+	return p.query.addFilter(p.label("revision_name"), p.revision)
+}
+
+// label returns the field of the service or revision label in the filters.
+func (s semantics) label(name string) string {
+	if s.metricLabels {
+		return "metric.labels." + name
+	}
+	return "resource.labels." + name
+}
+
+// groupByFields returns the fields to group the time series by. If the
+// candidate revision is set, the revision name is included so the returned
+// series can be verified to belong to the revision.
+func (p *Provider) groupByFields(fields ...string) []string {
+	if p.revision == "" {
+		return fields
+	}
+	return append(fields, p.label("revision_name"))
+}
+
+// missingData returns the error for an empty time series response.
+//
+// If no candidate revision is set, nil is returned to preserve the behavior of
+// considering an empty response as no requests.
+func (p *Provider) missingData() error {
+	if p.revision == "" {
+		return nil
+	}
+	return errors.Wrapf(metrics.ErrMissingRevisionData, "no time series for revision %q", p.revision)
+}
+
+// verifyRevision checks that all the time series belong to the candidate
+// revision, so service-wide values are never evaluated as the candidate's.
+func (p *Provider) verifyRevision(timeSeries []*monitoring.TimeSeries) error {
+	if p.revision == "" {
+		return nil
+	}
+	for _, series := range timeSeries {
+		var revision string
+		if p.metricLabels && series.Metric != nil {
+			revision = series.Metric.Labels["revision_name"]
+		} else if !p.metricLabels && series.Resource != nil {
+			revision = series.Resource.Labels["revision_name"]
+		}
+		if revision != p.revision {
+			return errors.Wrapf(metrics.ErrMissingRevisionData, "time series for revision %q found, expected %q", revision, p.revision)
+		}
+	}
+	return nil
+}
+
+// recordedQuery returns the description of the query for the recorder.
+func recordedQuery(q query, aligner, reducer string, start, end time.Time) metrics.Query {
+	return metrics.Query{
+		Query: fmt.Sprintf("%s aligner=%s reducer=%s", q, aligner, reducer),
+		Start: start,
+		End:   end,
 	}
-	return calculateErrorResponseRate(timeSeries)
 }
 
 func makeRequestForTimeSeries(logger *logrus.Entry, req *monitoring.ProjectsTimeSeriesListCall) ([]*monitoring.TimeSeries, error) {
@@ -193,20 +373,20 @@ func makeRequestForTimeSeries(logger *logrus.Entry, req *monitoring.ProjectsTime
 	return resp.TimeSeries, nil
 }
 
-// calculateErrorResponseRate calculates the percentage of 5xx error response.
+// calculateErrorResponseRate calculates the percentage of server error
+// responses (e.g. 5xx).
 //
 // It gets all the server responses and calculates the error rate by performing
-// the operation (5xx responses / all responses). Then, it divides the number of
-// error responses by the total.
-func calculateErrorResponseRate(timeSeries []*monitoring.TimeSeries) (float64, error) {
+// the operation (error responses / all responses). Then, it divides the number
+// of error responses by the total.
+func (s semantics) calculateErrorResponseRate(timeSeries []*monitoring.TimeSeries) (float64, error) {
 	var errorResponseCount, totalResponses int64
 	for _, series := range timeSeries {
 		// Because the interval and the series aligner are the same, only one
 		// point is returned per time series.
-		switch series.Metric.Labels["response_code_class"] {
-		case "5xx":
+		if s.serverErrors[series.Metric.Labels[s.statusLabel]] {
 			errorResponseCount += *(series.Points[0].Value.Int64Value)
-		default:
+		} else {
 			totalResponses += *(series.Points[0].Value.Int64Value)
 		}
 	}
@@ -1,9 +1,21 @@
 package stackdriver
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
 )
 
 func TestQuery_addFilter(t *testing.T) {
@@ -37,3 +49,144 @@ func TestQuery_addFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestProvider_verifyRevision(t *testing.T) {
+	seriesFor := func(revision string) *monitoring.TimeSeries {
+		return &monitoring.TimeSeries{
+			Resource: &monitoring.MonitoredResource{Labels: map[string]string{"revision_name": revision}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		revision   string
+		timeSeries []*monitoring.TimeSeries
+		shouldErr  bool
+	}{
+		{
+			name:       "no revision set",
+			timeSeries: []*monitoring.TimeSeries{{}},
+		},
+		{
+			name:       "series for the revision",
+			revision:   "test-002",
+			timeSeries: []*monitoring.TimeSeries{seriesFor("test-002"), seriesFor("test-002")},
+		},
+		{
+			name:       "series for another revision",
+			revision:   "test-002",
+			timeSeries: []*monitoring.TimeSeries{seriesFor("test-002"), seriesFor("test-001")},
+			shouldErr:  true,
+		},
+		{
+			name:       "series without revision label",
+			revision:   "test-002",
+			timeSeries: []*monitoring.TimeSeries{{}},
+			shouldErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			p := &Provider{revision: test.revision}
+			err := p.verifyRevision(test.timeSeries)
+			if test.shouldErr {
+				assert.True(tt, errors.Is(err, metrics.ErrMissingRevisionData))
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestProvider_revisionQuery(t *testing.T) {
+	p := &Provider{query: newQuery("myproject", "us-east1", "mysvc")}
+	assert.Equal(t, string(p.query), string(p.revisionQuery()))
+	assert.Nil(t, p.missingData())
+	assert.Equal(t, []string{"resource.labels.service_name"}, p.groupByFields("resource.labels.service_name"))
+
+	p.SetCandidateRevision("test-002")
+	p.SetCandidateRevision("test-003")
+	assert.Equal(t, string(p.query)+` AND resource.labels.revision_name="test-003"`, string(p.revisionQuery()))
+	assert.True(t, errors.Is(p.missingData(), metrics.ErrMissingRevisionData))
+	assert.Equal(t, []string{"resource.labels.service_name", "resource.labels.revision_name"}, p.groupByFields("resource.labels.service_name"))
+}
+
+// TestProvider_requestCountSeries tests that the request count and the error
+// rate are computed from a single query.
+func TestProvider_requestCountSeries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		series := `{"resource":{"labels":{"revision_name":"test-002"}},"metric":{"labels":{"response_code_class":%q}},"points":[{"value":{"int64Value":%q}}]}`
+		fmt.Fprintf(w, `{"timeSeries":[%s,%s]}`, fmt.Sprintf(series, "2xx", "95"), fmt.Sprintf(series, "5xx", "5"))
+	}))
+	defer server.Close()
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	provider, err := NewProvider(ctx, "myproject", "us-east1", "mysvc", option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	assert.Nil(t, err)
+	clock := clockwork.NewFakeClock()
+	provider.clock = clock
+	provider.SetCandidateRevision("test-002")
+
+	count, err := provider.RequestCount(ctx, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), count)
+	rate, err := provider.ErrorRate(ctx, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.05, rate)
+	assert.Equal(t, 1, requests)
+
+	// The series are retrieved again for the next diagnosis.
+	clock.Advance(requestCountsTTL)
+	_, err = provider.RequestCount(ctx, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests)
+
+	// A different revision is queried again.
+	provider.SetCandidateRevision("test-003")
+	_, err = provider.ErrorRate(ctx, 30*time.Minute)
+	assert.True(t, errors.Is(err, metrics.ErrMissingRevisionData))
+	assert.Equal(t, 3, requests)
+}
+
+// TestProvider_GRPCMetrics tests that the metrics of gRPC services are
+// computed from the gRPC server metrics, by status.
+func TestProvider_GRPCMetrics(t *testing.T) {
+	var filters, aligners []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = append(filters, r.URL.Query().Get("filter"))
+		aligners = append(aligners, r.URL.Query().Get("aggregation.perSeriesAligner"))
+		if r.URL.Query().Get("aggregation.crossSeriesReducer") == "REDUCE_PERCENTILE_99" {
+			fmt.Fprint(w, `{"timeSeries":[{"metric":{"labels":{"revision_name":"test-002"}},"points":[{"value":{"doubleValue":250}}]}]}`)
+			return
+		}
+		series := `{"metric":{"labels":{"revision_name":"test-002","grpc_server_status":%q}},"points":[{"value":{"int64Value":%q}}]}`
+		fmt.Fprintf(w, `{"timeSeries":[%s,%s,%s]}`, fmt.Sprintf(series, "OK", "90"),
+			fmt.Sprintf(series, "NOT_FOUND", "6"), fmt.Sprintf(series, "UNAVAILABLE", "4"))
+	}))
+	defer server.Close()
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	provider, err := NewProvider(ctx, "myproject", "us-east1", "mysvc", option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	assert.Nil(t, err)
+	provider = provider.WithGRPCMetrics()
+	provider.SetCandidateRevision("test-002")
+
+	count, err := provider.RequestCount(ctx, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), count)
+	rate, err := provider.ErrorRate(ctx, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.04, rate, "client errors must not be counted")
+	latency, err := provider.Latency(ctx, 30*time.Minute, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.0, latency)
+
+	assert.Equal(t, []string{
+		`metric.labels.service_name="mysvc" AND metric.labels.revision_name="test-002" AND metric.type="custom.googleapis.com/opencensus/grpc.io/server/completed_rpcs"`,
+		`metric.labels.service_name="mysvc" AND metric.labels.revision_name="test-002" AND metric.type="custom.googleapis.com/opencensus/grpc.io/server/server_latency"`,
+	}, filters)
+	assert.Equal(t, []string{"ALIGN_DELTA", "ALIGN_DELTA"}, aligners)
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"time"
+)
+
+// DORA are the DORA metrics of the rollouts of a service finished within a
+// window of time.
+type DORA struct {
+	Window time.Duration
+
+	// Deployments is the number of candidates promoted, and
+	// DeploymentsPerDay the deployment frequency over the window.
+	Deployments       int
+	DeploymentsPerDay float64
+
+	// Rollbacks is the number of candidates rolled back, and
+	// ChangeFailureRate the ratio of the finished rollouts that were rolled
+	// back, between 0 and 1.
+	Rollbacks         int
+	ChangeFailureRate float64
+
+	// TimeToRestore is the mean time from the start of the rollouts of the
+	// candidates rolled back to their rollback, which restored the stable
+	// revision. It is 0 without rollback.
+	TimeToRestore time.Duration
+}
+
+// ComputeDORA computes the DORA metrics of the rollouts finished within the
+// window before now. Rollouts in progress are ignored.
+func ComputeDORA(rollouts []Rollout, now time.Time, window time.Duration) DORA {
+	dora := DORA{Window: window}
+	since := now.Add(-window)
+	var restore time.Duration
+	for _, r := range rollouts {
+		if r.End == nil || r.End.Before(since) || r.End.After(now) {
+			continue
+		}
+		switch r.Outcome {
+		case PromotedOutcome:
+			dora.Deployments++
+		case RolledBackOutcome:
+			dora.Rollbacks++
+			restore += r.End.Sub(r.Start)
+		}
+	}
+
+	if days := window.Hours() / 24; days > 0 {
+		dora.DeploymentsPerDay = float64(dora.Deployments) / days
+	}
+	if finished := dora.Deployments + dora.Rollbacks; finished != 0 {
+		dora.ChangeFailureRate = float64(dora.Rollbacks) / float64(finished)
+	}
+	if dora.Rollbacks != 0 {
+		dora.TimeToRestore = restore / time.Duration(dora.Rollbacks)
+	}
+	return dora
+}
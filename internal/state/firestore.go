@@ -0,0 +1,151 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/firestore/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Firestore is a store that keeps the state of each service in a document of a
+// Firestore collection. The fields of the state are the fields of the
+// document.
+type Firestore struct {
+	service    *firestore.Service
+	collection string
+}
+
+// NewFirestore initializes a store for the collection of the (default)
+// database of the project.
+func NewFirestore(ctx context.Context, project, collection string, opts ...option.ClientOption) (*Firestore, error) {
+	service, err := firestore.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Firestore API")
+	}
+	return &Firestore{
+		service:    service,
+		collection: fmt.Sprintf("projects/%s/databases/(default)/documents/%s", project, collection),
+	}, nil
+}
+
+// Get returns the state of the service, or nil if the service has no state
+// yet.
+func (f *Firestore) Get(ctx context.Context, key string) (*State, error) {
+	doc, err := f.service.Projects.Databases.Documents.Get(f.document(key)).Context(ctx).Do()
+	if err != nil {
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get state of %s", key)
+	}
+
+	fields := make(map[string]interface{})
+	for name, value := range doc.Fields {
+		fields[name] = fromValue(value)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal document fields")
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrapf(err, "invalid state of %s", key)
+	}
+	return &state, nil
+}
+
+// Put replaces the state of the service.
+func (f *Firestore) Put(ctx context.Context, key string, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal state")
+	}
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return errors.Wrap(err, "failed to unmarshal state")
+	}
+
+	doc := &firestore.Document{Fields: make(map[string]firestore.Value)}
+	for name, value := range fields {
+		doc.Fields[name] = *toValue(value)
+	}
+	// The document is replaced, including the fields that are no longer set.
+	_, err = f.service.Projects.Databases.Documents.Patch(f.document(key), doc).Context(ctx).Do()
+	return errors.Wrapf(err, "failed to put state of %s", key)
+}
+
+// document returns the name of the document of the service. The slashes of
+// the key are replaced by tildes since document IDs cannot contain slashes.
+func (f *Firestore) document(key string) string {
+	return f.collection + "/" + strings.Replace(key, "/", "~", -1)
+}
+
+// toValue converts a value decoded from JSON (with numbers) to a Firestore
+// value.
+func toValue(v interface{}) *firestore.Value {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		fields := make(map[string]firestore.Value)
+		for name, value := range v {
+			fields[name] = *toValue(value)
+		}
+		return &firestore.Value{MapValue: &firestore.MapValue{Fields: fields}}
+	case []interface{}:
+		values := make([]*firestore.Value, 0, len(v))
+		for _, value := range v {
+			values = append(values, toValue(value))
+		}
+		return &firestore.Value{ArrayValue: &firestore.ArrayValue{Values: values}}
+	case string:
+		return &firestore.Value{StringValue: v, ForceSendFields: []string{"StringValue"}}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &firestore.Value{IntegerValue: i, ForceSendFields: []string{"IntegerValue"}}
+		}
+		f, _ := v.Float64()
+		return &firestore.Value{DoubleValue: f, ForceSendFields: []string{"DoubleValue"}}
+	case bool:
+		return &firestore.Value{BooleanValue: v, ForceSendFields: []string{"BooleanValue"}}
+	}
+	return &firestore.Value{NullValue: "NULL_VALUE"}
+}
+
+// fromValue converts a Firestore value to a value that can be encoded in
+// JSON. Zero values cannot be told apart and are converted to nil, which is
+// fine since the fields of the state are omitted when empty.
+func fromValue(v firestore.Value) interface{} {
+	switch {
+	case v.MapValue != nil:
+		fields := make(map[string]interface{})
+		for name, value := range v.MapValue.Fields {
+			fields[name] = fromValue(value)
+		}
+		return fields
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, value := range v.ArrayValue.Values {
+			values = append(values, fromValue(*value))
+		}
+		return values
+	case v.StringValue != "":
+		return v.StringValue
+	case v.TimestampValue != "":
+		return v.TimestampValue
+	case v.IntegerValue != 0:
+		return v.IntegerValue
+	case v.DoubleValue != 0:
+		return v.DoubleValue
+	case v.BooleanValue:
+		return true
+	}
+	return nil
+}
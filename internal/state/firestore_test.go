@@ -0,0 +1,93 @@
+package state_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestFirestore(t *testing.T) {
+	const document = "/v1/projects/myproject/databases/(default)/documents/rolloutState/myproject~us-east1~myservice"
+	var stored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != document {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			stored, _ = ioutil.ReadAll(r.Body)
+			w.Write(stored)
+		case http.MethodGet:
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+				return
+			}
+			w.Write(stored)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, err := state.NewFirestore(ctx, "myproject", "rolloutState",
+		option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	st, err := store.Get(ctx, "myproject/us-east1/myservice")
+	assert.Nil(t, err)
+	assert.Nil(t, st)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	expected := &state.State{
+		Stable:        "myservice-001",
+		Candidate:     "myservice-002",
+		LastRollout:   now.Format(time.RFC3339),
+		FailureStreak: 2,
+		Steps: []state.Step{
+			{Candidate: "myservice-002", Time: now},
+			{Candidate: "myservice-002", Percent: 10, Time: now.Add(time.Minute)},
+		},
+		Quarantine: &state.Quarantine{Since: now, Errors: 10, LastError: "permission denied"},
+		FleetPause: &state.FleetPause{Since: now, Principal: "jane@example.com", Reason: "INC-1234"},
+	}
+	assert.Nil(t, store.Put(ctx, "myproject/us-east1/myservice", expected))
+	st, err = store.Get(ctx, "myproject/us-east1/myservice")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, st)
+
+	_, err = store.Get(ctx, "other")
+	assert.NotNil(t, err)
+}
+
+func TestState_AddStep(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := &state.State{}
+	st.AddStep(state.Step{Candidate: "myservice-002", Percent: 10, Time: now})
+	st.AddStep(state.Step{Candidate: "myservice-002", Percent: 10, Time: now.Add(time.Minute)})
+	st.AddStep(state.Step{Candidate: "myservice-002", Percent: 0, Time: now.Add(time.Minute), Outcome: state.RolledBackOutcome})
+	assert.Equal(t, []state.Step{
+		{Candidate: "myservice-002", Percent: 10, Time: now},
+		{Candidate: "myservice-002", Percent: 0, Time: now.Add(time.Minute), Outcome: state.RolledBackOutcome},
+	}, st.Steps)
+
+	for i := 0; i < 200; i++ {
+		st.AddStep(state.Step{Candidate: "myservice-003", Percent: int64(i % 2), Time: now})
+	}
+	assert.Len(t, st.Steps, 100)
+}
+
+func TestNewStore(t *testing.T) {
+	ctx := context.Background()
+	for _, location := range []string{"gs://bucket/state", "firestore://", "firestore:///collection"} {
+		_, err := state.NewStore(ctx, location)
+		assert.NotNil(t, err, location)
+	}
+}
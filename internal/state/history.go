@@ -0,0 +1,51 @@
+package state
+
+import (
+	"time"
+)
+
+// Rollout is the rollout of a candidate, built from the history of the steps.
+type Rollout struct {
+	Candidate string     `json:"candidate"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+
+	// Outcome is empty while the rollout is in progress.
+	Outcome string `json:"outcome,omitempty"`
+
+	Steps []RolloutStep `json:"steps"`
+}
+
+// RolloutStep is a traffic step of a rollout.
+type RolloutStep struct {
+	Percent int64     `json:"percent"`
+	Start   time.Time `json:"start"`
+
+	// Duration is the time the candidate stayed at the step, empty for the
+	// current step of a rollout in progress.
+	Duration string `json:"duration,omitempty"`
+}
+
+// Rollouts groups the steps of the history by rollout, oldest first. The
+// last step of a finished rollout is its outcome.
+func (s *State) Rollouts() []Rollout {
+	var rollouts []Rollout
+	for _, step := range s.Steps {
+		n := len(rollouts)
+		if n == 0 || rollouts[n-1].Candidate != step.Candidate || rollouts[n-1].Outcome != "" {
+			rollouts = append(rollouts, Rollout{Candidate: step.Candidate, Start: step.Time})
+			n++
+		}
+		current := &rollouts[n-1]
+		if len(current.Steps) != 0 {
+			previous := &current.Steps[len(current.Steps)-1]
+			previous.Duration = step.Time.Sub(previous.Start).String()
+		}
+		if step.Outcome != "" {
+			end := step.Time
+			current.End, current.Outcome = &end, step.Outcome
+		}
+		current.Steps = append(current.Steps, RolloutStep{Percent: step.Percent, Start: step.Time})
+	}
+	return rollouts
+}
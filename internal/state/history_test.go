@@ -0,0 +1,87 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState_Rollouts(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	st := &state.State{Steps: []state.Step{
+		{Candidate: "mysvc-002", Percent: 10, Time: at(0)},
+		{Candidate: "mysvc-002", Percent: 50, Time: at(10)},
+		{Candidate: "mysvc-002", Percent: 100, Time: at(30), Outcome: state.PromotedOutcome},
+		{Candidate: "mysvc-003", Percent: 10, Time: at(60)},
+		{Candidate: "mysvc-003", Time: at(65), Outcome: state.RolledBackOutcome},
+		{Candidate: "mysvc-004", Percent: 10, Time: at(90)},
+	}}
+
+	end1, end2 := at(30), at(65)
+	assert.Equal(t, []state.Rollout{
+		{
+			Candidate: "mysvc-002",
+			Start:     at(0),
+			End:       &end1,
+			Outcome:   state.PromotedOutcome,
+			Steps: []state.RolloutStep{
+				{Percent: 10, Start: at(0), Duration: "10m0s"},
+				{Percent: 50, Start: at(10), Duration: "20m0s"},
+				{Percent: 100, Start: at(30)},
+			},
+		},
+		{
+			Candidate: "mysvc-003",
+			Start:     at(60),
+			End:       &end2,
+			Outcome:   state.RolledBackOutcome,
+			Steps: []state.RolloutStep{
+				{Percent: 10, Start: at(60), Duration: "5m0s"},
+				{Percent: 0, Start: at(65)},
+			},
+		},
+		{
+			Candidate: "mysvc-004",
+			Start:     at(90),
+			Steps:     []state.RolloutStep{{Percent: 10, Start: at(90)}},
+		},
+	}, st.Rollouts())
+
+	assert.Nil(t, (&state.State{}).Rollouts())
+}
+
+func TestComputeDORA(t *testing.T) {
+	now := time.Date(2020, 6, 10, 12, 0, 0, 0, time.UTC)
+	rollout := func(outcome string, start time.Time, duration time.Duration) state.Rollout {
+		end := start.Add(duration)
+		return state.Rollout{Start: start, End: &end, Outcome: outcome}
+	}
+	day := 24 * time.Hour
+	rollouts := []state.Rollout{
+		// Finished before the window.
+		rollout(state.PromotedOutcome, now.Add(-20*day), time.Hour),
+		rollout(state.PromotedOutcome, now.Add(-6*day), time.Hour),
+		rollout(state.RolledBackOutcome, now.Add(-5*day), 10*time.Minute),
+		rollout(state.PromotedOutcome, now.Add(-4*day), time.Hour),
+		rollout(state.RolledBackOutcome, now.Add(-3*day), 30*time.Minute),
+		rollout(state.PromotedOutcome, now.Add(-2*day), time.Hour),
+		// In progress.
+		{Start: now.Add(-time.Hour)},
+	}
+
+	assert.Equal(t, state.DORA{
+		Window:            7 * day,
+		Deployments:       3,
+		DeploymentsPerDay: 3.0 / 7,
+		Rollbacks:         2,
+		ChangeFailureRate: 0.4,
+		TimeToRestore:     20 * time.Minute,
+	}, state.ComputeDORA(rollouts, now, 7*day))
+
+	assert.Equal(t, state.DORA{Window: day}, state.ComputeDORA(nil, now, day))
+}
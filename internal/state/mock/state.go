@@ -0,0 +1,28 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+)
+
+// Store is a mock implementation of state.Store.
+type Store struct {
+	GetFn      func(ctx context.Context, key string) (*state.State, error)
+	GetInvoked bool
+
+	PutFn      func(ctx context.Context, key string, state *state.State) error
+	PutInvoked bool
+}
+
+// Get invokes the mock implementation and marks the function as invoked.
+func (s *Store) Get(ctx context.Context, key string) (*state.State, error) {
+	s.GetInvoked = true
+	return s.GetFn(ctx, key)
+}
+
+// Put invokes the mock implementation and marks the function as invoked.
+func (s *Store) Put(ctx context.Context, key string, state *state.State) error {
+	s.PutInvoked = true
+	return s.PutFn(ctx, key, state)
+}
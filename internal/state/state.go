@@ -0,0 +1,131 @@
+// Package state persists the rollout state of the services outside of the
+// services themselves.
+//
+// The annotations of a service are size-limited, can be edited by users and
+// are lost if the service is recreated. With a store, the state is read from
+// the store and the annotations are only a mirror of it.
+package state
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// Outcomes of the rollout of a candidate.
+const (
+	PromotedOutcome   = "promoted"
+	RolledBackOutcome = "rolledBack"
+)
+
+// maxSteps is the number of steps kept in the history of a service.
+const maxSteps = 100
+
+// Store represents a persistent store of the rollout state of the services.
+type Store interface {
+	// Get returns the state of the service, or nil if the service has no
+	// state yet.
+	Get(ctx context.Context, key string) (*State, error)
+
+	// Put replaces the state of the service.
+	Put(ctx context.Context, key string, state *State) error
+}
+
+// FleetKey is the key of the state of the fleet, which only holds the
+// fleet-wide pause. It cannot be the key of a service, which starts with a
+// project ID.
+const FleetKey = "_fleet"
+
+// defaultCollection is the Firestore collection used if the location of the
+// store does not specify one.
+const defaultCollection = "rolloutState"
+
+// NewStore initializes the store at the location. The only supported location
+// is a Firestore collection: firestore://PROJECT[/COLLECTION]. The options are
+// used by the Firestore client.
+func NewStore(ctx context.Context, location string, opts ...option.ClientOption) (Store, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid state store location")
+	}
+	if u.Scheme != "firestore" || u.Host == "" {
+		return nil, errors.Errorf("invalid state store location %q, must be firestore://PROJECT[/COLLECTION]", location)
+	}
+	collection := strings.Trim(u.Path, "/")
+	if collection == "" {
+		collection = defaultCollection
+	}
+	return NewFirestore(ctx, u.Host, collection, opts...)
+}
+
+// State is the rollout state of a service.
+//
+// All the fields are omitted when empty, so a stored state only has the
+// fields that are set.
+type State struct {
+	Stable              string `json:"stable,omitempty"`
+	Candidate           string `json:"candidate,omitempty"`
+	LastFailedCandidate string `json:"lastFailedCandidate,omitempty"`
+	LastRollout         string `json:"lastRollout,omitempty"`
+
+	// HealthyStreak is the number of consecutive healthy diagnoses of the
+	// candidate at its current step, as a decimal string.
+	HealthyStreak string `json:"healthyStreak,omitempty"`
+
+	// FailureStreak is the number of consecutive candidates rolled back.
+	FailureStreak int64 `json:"failureStreak,omitempty"`
+
+	// Steps is the history of the traffic of the candidates, oldest first.
+	Steps []Step `json:"steps,omitempty"`
+
+	// Quarantine is set while the service is quarantined after too many
+	// consecutive operator errors, so its rollout is not handled.
+	Quarantine *Quarantine `json:"quarantine,omitempty"`
+
+	// FleetPause is set in the state of the fleet (see FleetKey) while the
+	// traffic changes of all the services are paused.
+	FleetPause *FleetPause `json:"fleetPause,omitempty"`
+}
+
+// Step is a change of the traffic of a candidate.
+type Step struct {
+	Candidate string    `json:"candidate,omitempty"`
+	Percent   int64     `json:"percent,omitempty"`
+	Time      time.Time `json:"time,omitempty"`
+
+	// Outcome is set for the last step of the rollout of the candidate.
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// Quarantine is the quarantine of a service.
+type Quarantine struct {
+	Since     time.Time `json:"since,omitempty"`
+	Errors    int64     `json:"errors,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// FleetPause is the fleet-wide pause of the traffic changes.
+type FleetPause struct {
+	Since     time.Time `json:"since,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// AddStep appends the step to the history, unless it is the same as the last
+// step. Only the most recent steps are kept.
+func (s *State) AddStep(step Step) {
+	if n := len(s.Steps); n != 0 {
+		last := s.Steps[n-1]
+		if last.Candidate == step.Candidate && last.Percent == step.Percent && last.Outcome == step.Outcome {
+			return
+		}
+	}
+	s.Steps = append(s.Steps, step)
+	if len(s.Steps) > maxSteps {
+		s.Steps = s.Steps[len(s.Steps)-maxSteps:]
+	}
+}
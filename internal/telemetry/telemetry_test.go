@@ -0,0 +1,46 @@
+package telemetry_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := telemetry.NewRegistry()
+	decisions := registry.NewCounter("rollout_operator_decisions_total", "Decisions.", "decision")
+	services := registry.NewGauge("rollout_operator_services", "Services.")
+	durations := registry.NewHistogram("rollout_operator_cycle_duration_seconds", "Durations.", []float64{1, 10})
+
+	decisions.Inc("rollback")
+	decisions.Inc("promotion")
+	decisions.Add(2, "rollback")
+	services.Set(3)
+	services.Set(4)
+	durations.Observe(0.5)
+	durations.Observe(5)
+	durations.Observe(20)
+
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP rollout_operator_decisions_total Decisions.
+# TYPE rollout_operator_decisions_total counter
+rollout_operator_decisions_total{decision="promotion"} 1
+rollout_operator_decisions_total{decision="rollback"} 3
+# HELP rollout_operator_services Services.
+# TYPE rollout_operator_services gauge
+rollout_operator_services 4
+# HELP rollout_operator_cycle_duration_seconds Durations.
+# TYPE rollout_operator_cycle_duration_seconds histogram
+rollout_operator_cycle_duration_seconds_bucket{le="1"} 1
+rollout_operator_cycle_duration_seconds_bucket{le="10"} 2
+rollout_operator_cycle_duration_seconds_bucket{le="+Inf"} 3
+rollout_operator_cycle_duration_seconds_sum 25.5
+rollout_operator_cycle_duration_seconds_count 3
+`, w.Body.String())
+
+	assert.Panics(t, func() { decisions.Inc() })
+}
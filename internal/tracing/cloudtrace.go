@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/option"
+)
+
+// unknownCode is the gRPC code of the status of the failed spans.
+const unknownCode = 2
+
+// CloudTrace exports the spans to Cloud Trace.
+type CloudTrace struct {
+	service *cloudtrace.Service
+	project string
+}
+
+// NewCloudTrace initializes an exporter to Cloud Trace in the project.
+func NewCloudTrace(ctx context.Context, project string, opts ...option.ClientOption) (*CloudTrace, error) {
+	service, err := cloudtrace.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Trace client")
+	}
+	return &CloudTrace{service: service, project: project}, nil
+}
+
+// Export writes the spans to Cloud Trace.
+func (c *CloudTrace) Export(ctx context.Context, spans []SpanData) error {
+	req := &cloudtrace.BatchWriteSpansRequest{}
+	for _, span := range spans {
+		s := &cloudtrace.Span{
+			Name:         "projects/" + c.project + "/traces/" + span.TraceID + "/spans/" + span.SpanID,
+			SpanId:       span.SpanID,
+			ParentSpanId: span.ParentID,
+			DisplayName:  &cloudtrace.TruncatableString{Value: span.Name},
+			StartTime:    span.Start.UTC().Format(time.RFC3339Nano),
+			EndTime:      span.End.UTC().Format(time.RFC3339Nano),
+			Attributes: &cloudtrace.Attributes{AttributeMap: map[string]cloudtrace.AttributeValue{
+				"g.co/agent": {StringValue: &cloudtrace.TruncatableString{Value: ServiceName}},
+			}},
+		}
+		for key, value := range span.Attributes {
+			s.Attributes.AttributeMap[key] = cloudtrace.AttributeValue{StringValue: &cloudtrace.TruncatableString{Value: value}}
+		}
+		if span.Error != "" {
+			s.Status = &cloudtrace.Status{Code: unknownCode, Message: span.Error}
+		}
+		req.Spans = append(req.Spans, s)
+	}
+	_, err := c.service.Projects.Traces.BatchWrite("projects/"+c.project, req).Context(ctx).Do()
+	return errors.Wrap(err, "failed to write spans to Cloud Trace")
+}
@@ -0,0 +1,185 @@
+// Package tracing records the work of the operator (rollout cycles, metrics
+// queries, diagnoses and service updates) as spans, exported to Cloud Trace or
+// to an OpenTelemetry (OTLP) collector, to debug slow or failed cycles.
+//
+// The tracer is carried by the context: without a tracer, spans are not
+// recorded and the functions of the package are no-ops.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// exportTimeout is the maximum time the export of the spans of a trace can
+// take.
+const exportTimeout = 30 * time.Second
+
+// ServiceName is the name of the operator in the exported spans.
+const ServiceName = "cloud-run-release-operator"
+
+// Exporter represents a backend the spans are sent to.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// SpanData is a finished span.
+type SpanData struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+
+	// Error is the error of the operation, if it failed.
+	Error string
+}
+
+// Tracer records the spans and exports the spans of a trace when its root
+// span ends.
+type Tracer struct {
+	exporter Exporter
+	onError  func(error)
+
+	mu      sync.Mutex
+	pending map[string][]SpanData
+	wg      sync.WaitGroup
+}
+
+// NewTracer initializes a tracer exporting to the exporter. The errors of the
+// exports are passed to onError.
+func NewTracer(exporter Exporter, onError func(error)) *Tracer {
+	return &Tracer{exporter: exporter, onError: onError, pending: make(map[string][]SpanData)}
+}
+
+// NewExporter initializes the exporter at the location: cloudtrace://PROJECT
+// for Cloud Trace, or the http(s) URL of an OTLP collector (e.g.
+// http://localhost:4318). The options are used by the Cloud Trace client.
+func NewExporter(ctx context.Context, location string, opts ...option.ClientOption) (Exporter, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid tracing exporter")
+	}
+	switch u.Scheme {
+	case "cloudtrace":
+		if u.Host == "" {
+			return nil, errors.Errorf("invalid tracing exporter %q, must be cloudtrace://PROJECT", location)
+		}
+		return NewCloudTrace(ctx, u.Host, opts...)
+	case "http", "https":
+		return NewOTLP(strings.TrimSuffix(location, "/")), nil
+	default:
+		return nil, errors.Errorf("invalid tracing exporter %q, must be cloudtrace://PROJECT or the http(s) URL of an OTLP collector", location)
+	}
+}
+
+// Flush waits for the exports in progress to complete. It does nothing for a
+// nil tracer.
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	t.wg.Wait()
+}
+
+func (t *Tracer) end(span SpanData) {
+	t.mu.Lock()
+	spans := append(t.pending[span.TraceID], span)
+	if span.ParentID != "" {
+		t.pending[span.TraceID] = spans
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, span.TraceID)
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.Export(ctx, spans); err != nil && t.onError != nil {
+			t.onError(errors.Wrap(err, "failed to export spans"))
+		}
+	}()
+}
+
+// Span is a span in progress. A nil span, returned without a tracer, ignores
+// all the calls.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+}
+
+type contextKeyTracer struct{}
+
+type contextKeySpan struct{}
+
+// ContextWithTracer returns a copy of the parent context that includes the
+// tracer.
+func ContextWithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, contextKeyTracer{}, tracer)
+}
+
+// Start starts a span, child of the span of the context if any, and returns
+// a copy of the context that includes it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	tracer, ok := ctx.Value(contextKeyTracer{}).(*Tracer)
+	if !ok || tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: tracer, data: SpanData{Name: name, SpanID: newID(8), Start: time.Now()}}
+	if parent, ok := ctx.Value(contextKeySpan{}).(*Span); ok && parent.tracer == tracer {
+		span.data.TraceID, span.data.ParentID = parent.data.TraceID, parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, contextKeySpan{}, span), span
+}
+
+// SetAttribute sets an attribute of the span (e.g. the name of the service).
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// End ends the span, marked as failed if the error is not nil. The spans of
+// a trace are exported when its root span ends.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.End = time.Now()
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.end(data)
+}
+
+// newID returns a random hex identifier of n bytes.
+func newID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,141 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/tracing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+type exporterMock struct {
+	mu     sync.Mutex
+	traces [][]tracing.SpanData
+}
+
+func (e *exporterMock) Export(ctx context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.traces = append(e.traces, spans)
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	exporter := &exporterMock{}
+	tracer := tracing.NewTracer(exporter, func(err error) { t.Error(err) })
+	ctx := tracing.ContextWithTracer(context.Background(), tracer)
+
+	ctx, root := tracing.Start(ctx, "cycle")
+	childCtx, child := tracing.Start(ctx, "rollout")
+	child.SetAttribute("service", "mysvc")
+	_, query := tracing.Start(childCtx, "metrics/RequestCount")
+	query.End(errors.New("query failed"))
+	child.End(nil)
+	assert.Empty(t, exporter.traces, "spans must be exported with their root")
+	root.End(nil)
+	tracer.Flush()
+
+	if assert.Len(t, exporter.traces, 1) {
+		spans := exporter.traces[0]
+		assert.Equal(t, []string{"metrics/RequestCount", "rollout", "cycle"}, []string{spans[0].Name, spans[1].Name, spans[2].Name})
+		assert.Equal(t, spans[1].SpanID, spans[0].ParentID)
+		assert.Equal(t, spans[2].SpanID, spans[1].ParentID)
+		assert.Empty(t, spans[2].ParentID)
+		for _, span := range spans {
+			assert.Equal(t, spans[2].TraceID, span.TraceID)
+			assert.Len(t, span.TraceID, 32)
+			assert.Len(t, span.SpanID, 16)
+		}
+		assert.Equal(t, "query failed", spans[0].Error)
+		assert.Equal(t, map[string]string{"service": "mysvc"}, spans[1].Attributes)
+	}
+
+	// Without a tracer, spans are no-ops.
+	_, span := tracing.Start(context.Background(), "cycle")
+	assert.Nil(t, span)
+	span.SetAttribute("service", "mysvc")
+	span.End(nil)
+}
+
+func TestOTLP(t *testing.T) {
+	var body struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID, SpanID, Name string
+					Attributes            []struct{ Key string }
+					Status                struct {
+						Code    int
+						Message string
+					}
+				}
+			}
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	exporter, err := tracing.NewExporter(context.Background(), server.URL)
+	assert.Nil(t, err)
+	err = exporter.Export(context.Background(), []tracing.SpanData{{
+		TraceID:    "0af7651916cd43dd8448eb211c80319c",
+		SpanID:     "b7ad6b7169203331",
+		Name:       "rollout",
+		Attributes: map[string]string{"service": "mysvc"},
+		Error:      "rollout failed",
+	}})
+	assert.Nil(t, err)
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "rollout", spans[0].Name)
+		assert.Equal(t, "b7ad6b7169203331", spans[0].SpanID)
+		assert.Equal(t, "service", spans[0].Attributes[0].Key)
+		assert.Equal(t, 2, spans[0].Status.Code)
+		assert.Equal(t, "rollout failed", spans[0].Status.Message)
+	}
+
+	for _, location := range []string{"cloudtrace://", "jaeger://localhost"} {
+		_, err := tracing.NewExporter(context.Background(), location)
+		assert.NotNil(t, err, location)
+	}
+}
+
+func TestCloudTrace(t *testing.T) {
+	var body struct {
+		Spans []struct {
+			Name, SpanId string
+			DisplayName  struct{ Value string }
+			Status       *struct{ Message string }
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/projects/myproject/traces:batchWrite", r.URL.Path)
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	exporter, err := tracing.NewCloudTrace(context.Background(), "myproject", option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+	err = exporter.Export(context.Background(), []tracing.SpanData{
+		{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331", Name: "cycle"},
+		{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "00f067aa0ba902b7", ParentID: "b7ad6b7169203331", Name: "ReplaceService", Error: "permission denied"},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, body.Spans, 2) {
+		assert.Equal(t, "projects/myproject/traces/0af7651916cd43dd8448eb211c80319c/spans/b7ad6b7169203331", body.Spans[0].Name)
+		assert.Equal(t, "cycle", body.Spans[0].DisplayName.Value)
+		assert.Nil(t, body.Spans[0].Status)
+		assert.Equal(t, "permission denied", body.Spans[1].Status.Message)
+	}
+}
@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
+)
+
+// Scanner is a mock implementation of vulnerability.Scanner.
+type Scanner struct {
+	ScanFn      func(ctx context.Context, image string) (*vulnerability.Report, error)
+	ScanInvoked bool
+}
+
+// Scan invokes the mock implementation and marks the function as invoked.
+func (s *Scanner) Scan(ctx context.Context, image string) (*vulnerability.Report, error) {
+	s.ScanInvoked = true
+	return s.ScanFn(ctx, image)
+}
@@ -0,0 +1,152 @@
+// Package vulnerability reads the vulnerabilities found in the container
+// images of the candidates by the scans of Container Analysis, so candidates
+// with severe vulnerabilities can be kept from rolling out.
+package vulnerability
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
+	containeranalysis "google.golang.org/api/containeranalysis/v1beta1"
+	"google.golang.org/api/option"
+)
+
+// Statuses of the scan of an image, as defined by Container Analysis. An
+// image without discovery occurrence was not scanned (yet).
+const (
+	PendingStatus  = "PENDING"
+	ScanningStatus = "SCANNING"
+	FinishedStatus = "FINISHED_SUCCESS"
+)
+
+// Exceeds determines if the severity is higher than the maximum severity. An
+// unknown severity does not exceed any.
+func Exceeds(severity, max string) bool {
+	return rank(severity) > rank(max)
+}
+
+// rank returns the rank of the severity, 0 if unknown.
+func rank(severity string) int {
+	for i, s := range config.Severities {
+		if s == severity {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Vulnerability is a vulnerability found in an image.
+type Vulnerability struct {
+	// ID is the identifier of the vulnerability, e.g. CVE-2020-1234.
+	ID string
+
+	// Severity is the effective severity, e.g. HIGH.
+	Severity string
+
+	// Packages are the affected packages of the image.
+	Packages []string
+}
+
+// Report is the result of the scan of an image.
+type Report struct {
+	// Status is the status of the scan, empty if the image was not scanned.
+	Status string
+
+	Vulnerabilities []Vulnerability
+}
+
+// Scanner represents a client that reads the results of the scans of images.
+type Scanner interface {
+	// Scan returns the result of the scan of the image, pinned to its digest,
+	// e.g. us-docker.pkg.dev/myproject/myrepo/app@sha256:...
+	Scan(ctx context.Context, image string) (*Report, error)
+}
+
+// Kinds of the occurrences read by the scanner.
+const (
+	vulnerabilityKind = "VULNERABILITY"
+	discoveryKind     = "DISCOVERY"
+)
+
+// ContainerAnalysis reads the vulnerability occurrences of the images in the
+// project of their repository, as found by the scans of Artifact Registry and
+// Container Registry.
+type ContainerAnalysis struct {
+	occurrences *containeranalysis.Service
+}
+
+// NewContainerAnalysis initializes a client for the Container Analysis API.
+func NewContainerAnalysis(ctx context.Context, opts ...option.ClientOption) (*ContainerAnalysis, error) {
+	occurrences, err := containeranalysis.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize client for the Container Analysis API")
+	}
+	return &ContainerAnalysis{occurrences: occurrences}, nil
+}
+
+// Scan implements Scanner.
+func (c *ContainerAnalysis) Scan(ctx context.Context, image string) (*Report, error) {
+	// The project is the first part of the path of the images in Artifact
+	// Registry (LOCATION-docker.pkg.dev/PROJECT/REPOSITORY/IMAGE) and
+	// Container Registry (gcr.io/PROJECT/IMAGE).
+	parts := strings.SplitN(image, "/", 3)
+	if len(parts) < 3 {
+		return nil, errors.Errorf("image %q is not in Artifact Registry or Container Registry", image)
+	}
+	resourceURL := "https://" + image
+
+	report := &Report{}
+	vulnerabilities := make(map[string]int)
+	call := c.occurrences.Projects.Occurrences.List("projects/" + parts[1]).
+		Filter(`resourceUrl="` + resourceURL + `" AND (kind="` + vulnerabilityKind + `" OR kind="` + discoveryKind + `")`)
+	err := call.Pages(ctx, func(resp *containeranalysis.ListOccurrencesResponse) error {
+		for _, occurrence := range resp.Occurrences {
+			if occurrence.Resource == nil || occurrence.Resource.Uri != resourceURL {
+				continue
+			}
+			switch {
+			case occurrence.Kind == discoveryKind && occurrence.Discovered != nil && occurrence.Discovered.Discovered != nil:
+				report.Status = occurrence.Discovered.Discovered.AnalysisStatus
+			case occurrence.Kind == vulnerabilityKind && occurrence.Vulnerability != nil:
+				addVulnerability(report, vulnerabilities, occurrence)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list vulnerabilities of image %s", image)
+	}
+	return report, nil
+}
+
+// addVulnerability adds the vulnerability of the occurrence to the report,
+// merging the occurrences of the same vulnerability in several packages.
+// vulnerabilities is the index of the vulnerabilities of the report by ID.
+func addVulnerability(report *Report, vulnerabilities map[string]int, occurrence *containeranalysis.Occurrence) {
+	details := occurrence.Vulnerability
+	// The note of a vulnerability is named after it, e.g.
+	// projects/goog-vulnz/notes/CVE-2020-1234.
+	id := occurrence.NoteName[strings.LastIndex(occurrence.NoteName, "/")+1:]
+	severity := details.EffectiveSeverity
+	if severity == "" {
+		severity = details.Severity
+	}
+
+	i, ok := vulnerabilities[id]
+	if !ok {
+		i = len(report.Vulnerabilities)
+		vulnerabilities[id] = i
+		report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{ID: id, Severity: severity})
+	}
+	vulnerability := &report.Vulnerabilities[i]
+	if rank(severity) > rank(vulnerability.Severity) {
+		vulnerability.Severity = severity
+	}
+	for _, issue := range details.PackageIssue {
+		if issue.AffectedLocation != nil && issue.AffectedLocation.Package != "" {
+			vulnerability.Packages = append(vulnerability.Packages, issue.AffectedLocation.Package)
+		}
+	}
+}
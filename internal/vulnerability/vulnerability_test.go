@@ -0,0 +1,86 @@
+package vulnerability_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+const image = "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc"
+
+func TestContainerAnalysis_Scan(t *testing.T) {
+	resource := map[string]string{"uri": "https://" + image}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta1/projects/myproject/occurrences" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Contains(t, r.URL.Query().Get("filter"), `resourceUrl="https://`+image+`"`)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"occurrences": []map[string]interface{}{
+				{
+					"kind":       "DISCOVERY",
+					"resource":   resource,
+					"discovered": map[string]interface{}{"discovered": map[string]string{"analysisStatus": "FINISHED_SUCCESS"}},
+				},
+				{
+					"kind":     "VULNERABILITY",
+					"noteName": "projects/goog-vulnz/notes/CVE-2020-1234",
+					"resource": resource,
+					"vulnerability": map[string]interface{}{
+						"severity":          "MEDIUM",
+						"effectiveSeverity": "HIGH",
+						"packageIssue":      []map[string]interface{}{{"affectedLocation": map[string]string{"package": "openssl"}}},
+					},
+				},
+				{
+					"kind":     "VULNERABILITY",
+					"noteName": "projects/goog-vulnz/notes/CVE-2020-1234",
+					"resource": resource,
+					"vulnerability": map[string]interface{}{
+						"severity":     "LOW",
+						"packageIssue": []map[string]interface{}{{"affectedLocation": map[string]string{"package": "libssl"}}},
+					},
+				},
+				{
+					"kind":          "VULNERABILITY",
+					"noteName":      "projects/goog-vulnz/notes/CVE-2020-5678",
+					"resource":      map[string]string{"uri": "https://us-docker.pkg.dev/myproject/myrepo/app@sha256:other"},
+					"vulnerability": map[string]interface{}{"severity": "CRITICAL"},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	scanner, err := vulnerability.NewContainerAnalysis(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	assert.Nil(t, err)
+
+	report, err := scanner.Scan(ctx, image)
+	assert.Nil(t, err)
+	assert.Equal(t, &vulnerability.Report{
+		Status: vulnerability.FinishedStatus,
+		Vulnerabilities: []vulnerability.Vulnerability{
+			{ID: "CVE-2020-1234", Severity: "HIGH", Packages: []string{"openssl", "libssl"}},
+		},
+	}, report)
+
+	_, err = scanner.Scan(ctx, "app@sha256:abc")
+	assert.NotNil(t, err)
+	_, err = scanner.Scan(ctx, "gcr.io/otherproject/app@sha256:abc")
+	assert.NotNil(t, err)
+}
+
+func TestExceeds(t *testing.T) {
+	assert.True(t, vulnerability.Exceeds("CRITICAL", "HIGH"))
+	assert.False(t, vulnerability.Exceeds("HIGH", "HIGH"))
+	assert.False(t, vulnerability.Exceeds("LOW", "MEDIUM"))
+	assert.False(t, vulnerability.Exceeds("SEVERITY_UNSPECIFIED", "MINIMAL"))
+}
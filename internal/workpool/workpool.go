@@ -0,0 +1,86 @@
+// Package workpool runs the handling of the managed services with a bounded
+// number of workers, in an order that spreads the load between the regions.
+package workpool
+
+import (
+	"sort"
+	"sync"
+)
+
+// Interleave returns the order in which to handle the items of the groups,
+// as indexes in groups: it alternates between the groups, in the order of
+// their first item, and keeps the order of the items within each group.
+func Interleave(groups []string) []int {
+	var (
+		keys    []string
+		byGroup = make(map[string][]int)
+	)
+	for i, group := range groups {
+		if _, ok := byGroup[group]; !ok {
+			keys = append(keys, group)
+		}
+		byGroup[group] = append(byGroup[group], i)
+	}
+
+	order := make([]int, 0, len(groups))
+	for len(order) < len(groups) {
+		for _, key := range keys {
+			if queue := byGroup[key]; len(queue) != 0 {
+				order = append(order, queue[0])
+				byGroup[key] = queue[1:]
+			}
+		}
+	}
+	return order
+}
+
+// Run calls fn for each index from 0 to n-1, in order, with at most workers
+// calls at the same time, or n if workers is 0. It returns when all the calls
+// returned.
+func Run(n, workers int, fn func(i int)) {
+	if workers == 0 || workers > n {
+		workers = n
+	}
+	var (
+		wg    sync.WaitGroup
+		queue = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// Each calls fn for each key at the same time, e.g. to list the services in
+// each region, and tolerates partial failures: it returns the sorted keys for
+// which fn failed, and the error of the first of them only if fn failed for
+// all the keys.
+func Each(keys []string, fn func(key string) error) (failed []string, err error) {
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+	Run(len(keys), 0, func(i int) {
+		if err := fn(keys[i]); err != nil {
+			mu.Lock()
+			failed = append(failed, keys[i])
+			errs[keys[i]] = err
+			mu.Unlock()
+		}
+	})
+	sort.Strings(failed)
+	if len(failed) != 0 && len(failed) == len(keys) {
+		return failed, errs[failed[0]]
+	}
+	return failed, nil
+}
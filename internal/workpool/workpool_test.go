@@ -0,0 +1,163 @@
+package workpool_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/workpool"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []string
+		expected []int
+	}{
+		{
+			name:     "no items",
+			expected: []int{},
+		},
+		{
+			name:     "single group",
+			groups:   []string{"us-east1", "us-east1", "us-east1"},
+			expected: []int{0, 1, 2},
+		},
+		{
+			name:     "groups of the same size",
+			groups:   []string{"us-east1", "us-east1", "europe-west1", "europe-west1"},
+			expected: []int{0, 2, 1, 3},
+		},
+		{
+			name:     "groups of different sizes",
+			groups:   []string{"us-east1", "europe-west1", "us-east1", "us-east1", "asia-east1"},
+			expected: []int{0, 1, 4, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, workpool.Interleave(test.groups))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		n           int
+		workers     int
+		maxInFlight int
+	}{
+		{
+			name:        "bounded workers",
+			n:           20,
+			workers:     3,
+			maxInFlight: 3,
+		},
+		{
+			name:        "no limit",
+			n:           5,
+			workers:     0,
+			maxInFlight: 5,
+		},
+		{
+			name:        "more workers than items",
+			n:           2,
+			workers:     10,
+			maxInFlight: 2,
+		},
+		{
+			name:    "no items",
+			workers: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var (
+				mu               sync.Mutex
+				calls            = make([]int, test.n)
+				inFlight, maxRun int
+			)
+			workpool.Run(test.n, test.workers, func(i int) {
+				mu.Lock()
+				calls[i]++
+				inFlight++
+				if inFlight > maxRun {
+					maxRun = inFlight
+				}
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			})
+
+			for i, count := range calls {
+				assert.Equal(tt, 1, count, "calls for index %d", i)
+			}
+			assert.LessOrEqual(tt, maxRun, test.maxInFlight)
+		})
+	}
+}
+
+func TestEach(t *testing.T) {
+	tests := []struct {
+		name           string
+		keys           []string
+		failing        map[string]bool
+		expectedFailed []string
+		expectedErr    string
+	}{
+		{
+			name: "no failure",
+			keys: []string{"us-east1", "europe-west1"},
+		},
+		{
+			name:           "some keys failed",
+			keys:           []string{"us-east1", "europe-west1", "asia-east1"},
+			failing:        map[string]bool{"us-east1": true, "asia-east1": true},
+			expectedFailed: []string{"asia-east1", "us-east1"},
+		},
+		{
+			name:           "all keys failed",
+			keys:           []string{"us-east1", "europe-west1"},
+			failing:        map[string]bool{"us-east1": true, "europe-west1": true},
+			expectedFailed: []string{"europe-west1", "us-east1"},
+			expectedErr:    "europe-west1 unavailable",
+		},
+		{
+			name: "no keys",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var (
+				mu    sync.Mutex
+				calls []string
+			)
+			failed, err := workpool.Each(test.keys, func(key string) error {
+				mu.Lock()
+				calls = append(calls, key)
+				mu.Unlock()
+				if test.failing[key] {
+					return errors.Errorf("%s unavailable", key)
+				}
+				return nil
+			})
+			assert.ElementsMatch(tt, test.keys, calls)
+			assert.Equal(tt, test.expectedFailed, failed)
+			if test.expectedErr == "" {
+				assert.Nil(tt, err)
+				return
+			}
+			assert.EqualError(tt, err, test.expectedErr)
+		})
+	}
+}
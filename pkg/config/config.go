@@ -1,9 +1,14 @@
 package config
 
 import (
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // MetricsCheck is the metrics check type.
@@ -14,6 +19,85 @@ const (
 	RequestCountMetricsCheck MetricsCheck = "request-count"
 	LatencyMetricsCheck      MetricsCheck = "request-latency"
 	ErrorRateMetricsCheck    MetricsCheck = "error-rate-percent"
+
+	// Trace metrics checks are computed from the spans of an operation (e.g.
+	// a downstream call) in Cloud Trace.
+	TraceErrorRateMetricsCheck MetricsCheck = "trace-error-rate-percent"
+	TraceLatencyMetricsCheck   MetricsCheck = "trace-latency"
+
+	// ProbeSuccessRateMetricsCheck is computed from the synthetic requests
+	// sent to the candidate's tag URL, not from a metrics provider. Its
+	// threshold comes from the strategy's probe configuration.
+	ProbeSuccessRateMetricsCheck MetricsCheck = "probe-success-percent"
+
+	// TrafficSplitSkewMetricsCheck is the difference, in percentage points,
+	// between the share of the requests served by the candidate and the share
+	// of the traffic assigned to it. It is computed from the request counts of
+	// the candidate and stable revisions, and its threshold comes from the
+	// strategy's traffic split tolerance.
+	TrafficSplitSkewMetricsCheck MetricsCheck = "traffic-split-skew-percent"
+
+	// Job metrics checks are computed from the canary executions of Cloud Run
+	// jobs. Their thresholds come from the strategy's job canary
+	// configuration.
+	JobSuccessRateMetricsCheck MetricsCheck = "job-success-percent"
+	JobDurationMetricsCheck    MetricsCheck = "job-duration-seconds"
+)
+
+// ReportFormat is the format of the human-readable health report.
+type ReportFormat string
+
+// Supported report formats.
+const (
+	TextReportFormat     ReportFormat = "text"
+	MarkdownReportFormat ReportFormat = "markdown"
+	HTMLReportFormat     ReportFormat = "html"
+)
+
+// Protocol is the protocol of the requests served by the targeted services,
+// which determines the metrics used to diagnose them.
+type Protocol string
+
+// Supported protocols.
+const (
+	// HTTPProtocol uses the request metrics reported by Cloud Run.
+	HTTPProtocol Protocol = "http"
+
+	// GRPCProtocol uses the gRPC server metrics exported by the services: the
+	// error rate is derived from the gRPC status codes and the latency from
+	// the gRPC server latency distribution.
+	GRPCProtocol Protocol = "grpc"
+)
+
+// UnhealthyAction is what the operator does when a candidate is unhealthy.
+type UnhealthyAction string
+
+// Supported actions on unhealthy candidates.
+const (
+	// RollbackOnUnhealthy redirects all the traffic to the stable revision.
+	RollbackOnUnhealthy UnhealthyAction = "rollback"
+
+	// NotifyOnUnhealthy keeps the traffic split and notifies once, so a human
+	// decides. The candidate keeps being diagnosed, and advances again if it
+	// becomes healthy.
+	NotifyOnUnhealthy UnhealthyAction = "notify"
+
+	// PauseOnUnhealthy keeps the traffic split, notifies and pauses the
+	// rollout, until it is resumed, promoted or aborted by a human.
+	PauseOnUnhealthy UnhealthyAction = "pause"
+)
+
+// Platform is the platform the targeted services run on.
+type Platform string
+
+// Supported platforms.
+const (
+	// ManagedPlatform is Cloud Run (fully managed).
+	ManagedPlatform Platform = "managed"
+
+	// KubernetesPlatform is Knative Serving on a Kubernetes cluster (e.g.
+	// Cloud Run for Anthos on GKE).
+	KubernetesPlatform Platform = "kubernetes"
 )
 
 // Target is the configuration to filter services.
@@ -26,31 +110,245 @@ const (
 //   "labelSelector": "team=backend"
 // }
 type Target struct {
-	Project       string
-	Regions       []string
-	LabelSelector string
+	Project       string   `yaml:"project"`
+	Regions       []string `yaml:"regions"`
+	LabelSelector string   `yaml:"labelSelector"`
+
+	// Folder and Organization (numeric IDs) replace the project: the services
+	// are looked at in every active project under the folder or organization,
+	// including its subfolders, so new projects are picked up automatically.
+	Folder       string `yaml:"folder"`
+	Organization string `yaml:"organization"`
+
+	// ProjectFilter restricts the discovered projects with a Cloud Resource
+	// Manager filter (e.g. labels.env:prod).
+	ProjectFilter string `yaml:"projectFilter"`
+
+	// IncludeRegions and ExcludeRegions are patterns (e.g. us-*) that filter
+	// the regions retrieved from the Cloud Run API when no regions are
+	// specified. A region is looked at if it matches any of the included
+	// patterns (or none is specified) and none of the excluded patterns.
+	IncludeRegions []string `yaml:"includeRegions"`
+	ExcludeRegions []string `yaml:"excludeRegions"`
+
+	// IncludeServices and ExcludeServices are the names of the services that
+	// can and cannot be managed, among those with the label. An empty allowlist
+	// allows all the services.
+	IncludeServices []string `yaml:"includeServices"`
+	ExcludeServices []string `yaml:"excludeServices"`
+
+	// ServiceNameRegex and ExcludeServiceNameRegex are regular expressions the
+	// names of the managed services must match and must not match, if set.
+	ServiceNameRegex        string `yaml:"serviceNameRegex"`
+	ExcludeServiceNameRegex string `yaml:"excludeServiceNameRegex"`
+
+	// Platform is the platform of the services. Empty means ManagedPlatform.
+	//
+	// For KubernetesPlatform, the services are looked at in the namespace of
+	// the operator's cluster, and the only region is the location of the
+	// cluster, used for the metrics and the notifications.
+	Platform  Platform `yaml:"platform"`
+	Namespace string   `yaml:"namespace"`
+
+	// ImpersonateServiceAccount is the email of the service account the
+	// operator impersonates to manage the targeted services, instead of
+	// using its own identity. It overrides -impersonate-service-account.
+	ImpersonateServiceAccount string `yaml:"impersonateServiceAccount"`
 }
 
 // HealthCriterion is a metrics threshold that should be met to consider a
 // candidate healthy.
 type HealthCriterion struct {
-	Metric     MetricsCheck
-	Percentile float64
-	Threshold  float64
+	Metric     MetricsCheck `yaml:"metric"`
+	Percentile float64      `yaml:"percentile"`
+	Threshold  float64      `yaml:"threshold"`
+
+	// Operation is the name of the spans for trace metrics checks.
+	Operation string `yaml:"operation"`
+}
+
+// Probe is the configuration for the synthetic requests sent to the
+// candidate's tag URL before the candidate receives any real traffic.
+//
+// A probe request succeeds if the response has the expected status code, it
+// did not take longer than the max latency (if set) and its body matches the
+// regular expression (if set).
+type Probe struct {
+	Path              string        `yaml:"path"`
+	ExpectedStatus    int           `yaml:"expectedStatus"`
+	MaxLatency        time.Duration `yaml:"maxLatency"`
+	BodyRegex         string        `yaml:"bodyRegex"`
+	Requests          int           `yaml:"requests"`
+	MinSuccessPercent float64       `yaml:"minSuccessPercent"`
+
+	// Authenticate sends requests with an ID token for the service. This is
+	// needed for services that do not allow unauthenticated invocations.
+	Authenticate bool `yaml:"authenticate"`
+}
+
+// WarmUp is the configuration for the synthetic load sent to the candidate's
+// tag URL before the candidate receives any real traffic.
+//
+// The health criteria of the strategy are evaluated against the synthetic
+// traffic, which is useful for services with too little traffic to get a
+// conclusive diagnosis.
+type WarmUp struct {
+	RPS      int           `yaml:"rps"`
+	Duration time.Duration `yaml:"duration"`
+
+	// Request template.
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Body    string            `yaml:"body"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Authenticate sends requests with an ID token for the service.
+	Authenticate bool `yaml:"authenticate"`
+}
+
+// Shadow is the configuration to mirror a sample of production requests to the
+// candidate's tag URL before the candidate receives any real traffic.
+//
+// The requests are replayed by a mirroring proxy in front of the service. The
+// health criteria of the strategy are evaluated with the candidate's metrics
+// once the duration has elapsed.
+type Shadow struct {
+	ControlURL    string        `yaml:"controlURL"`
+	SamplePercent float64       `yaml:"samplePercent"`
+	Duration      time.Duration `yaml:"duration"`
+}
+
+// Attestation is the configuration to require Binary Authorization
+// attestations of the container image of a new candidate before it receives
+// any traffic.
+//
+// A candidate whose image was not attested by all the attestors is kept
+// without traffic, and checked again in the next rollout processes.
+type Attestation struct {
+	// Attestors are the names of the attestors, in the form
+	// projects/PROJECT/attestors/ATTESTOR.
+	Attestors []string `yaml:"attestors"`
+}
+
+// VulnerabilityScan is the configuration to keep the candidates whose image
+// has vulnerabilities more severe than allowed, as found by the scans of
+// Container Analysis, from receiving traffic and from being promoted.
+type VulnerabilityScan struct {
+	// MaxSeverity is the highest severity allowed, one of Severities.
+	MaxSeverity string `yaml:"maxSeverity"`
+
+	// Ignore are the identifiers of the vulnerabilities that never block a
+	// candidate, e.g. CVE-2020-1234.
+	Ignore []string `yaml:"ignore"`
+}
+
+// Severities are the severities of the vulnerabilities, in increasing order.
+var Severities = []string{"MINIMAL", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// JobCanary is the configuration for the canary executions of the Cloud Run
+// jobs with the target's labels.
+//
+// A job is updated to a new image only once a copy of the job with the image,
+// run with the canary arguments and environment variables (e.g. to process a
+// canary dataset or to enable a dry-run flag), succeeded.
+type JobCanary struct {
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Timeout time.Duration     `yaml:"timeout"`
+
+	// MinSuccessPercent is the minimum percent of the tasks of the canary
+	// execution that must succeed, and MaxDuration the maximum time the
+	// execution can take, if set.
+	MinSuccessPercent float64       `yaml:"minSuccessPercent"`
+	MaxDuration       time.Duration `yaml:"maxDuration"`
 }
 
 // Strategy is a rollout configuration for the targeted services.
 type Strategy struct {
-	Target              Target
-	Steps               []int64
-	HealthCriteria      []HealthCriterion
-	HealthOffsetMinute  int
-	TimeBetweenRollouts time.Duration
+	// Name identifies the strategy in the logs. It is optional.
+	Name string `yaml:"name"`
+
+	// Priority determines which strategy manages a service targeted by several
+	// strategies. See Config.StrategiesByPrecedence.
+	Priority int `yaml:"priority"`
+
+	Target              Target            `yaml:"target"`
+	Steps               []int64           `yaml:"steps"`
+	HealthCriteria      []HealthCriterion `yaml:"healthCriteria"`
+	HealthOffsetMinute  int               `yaml:"healthOffsetMinute"`
+	TimeBetweenRollouts time.Duration     `yaml:"timeBetweenRollouts"`
+
+	// MetricsTimeout is the maximum time the query for the metrics of a health
+	// criterion can take. Zero means no timeout.
+	MetricsTimeout time.Duration `yaml:"metricsTimeout"`
+
+	// StuckAfter is the time after which a candidate kept at the same traffic
+	// step (e.g. because its diagnoses are inconclusive) is flagged as stuck.
+	// Zero disables the detection.
+	StuckAfter time.Duration `yaml:"stuckAfter"`
+
+	// ConsecutiveHealthyChecks is the number of consecutive rollout cycles the
+	// candidate must be diagnosed healthy at its current step before its
+	// traffic advances. Zero or one means a single healthy diagnosis.
+	ConsecutiveHealthyChecks int `yaml:"consecutiveHealthyChecks"`
+
+	// TrafficSplitTolerance is the maximum difference, in percentage points,
+	// between the share of the requests actually served by the candidate and
+	// the share of the traffic assigned to it. A larger skew (e.g. because of
+	// routing anomalies or client-side stickiness) makes the diagnosis
+	// inconclusive. Zero disables the verification.
+	TrafficSplitTolerance float64 `yaml:"trafficSplitTolerance"`
+
+	// CompareWithStable determines if the metrics of an unhealthy candidate
+	// are compared with those of the stable revision in the same window. If
+	// the stable revision is equally degraded, the diagnosis is inconclusive.
+	CompareWithStable bool `yaml:"compareWithStable"`
+
+	// RecordSamples determines if the raw metrics values and queries used for
+	// the last diagnosis are stored in an annotation, for auditing.
+	RecordSamples bool `yaml:"recordSamples"`
+
+	// ReportFormat is the format of the health report annotation. Empty means
+	// TextReportFormat.
+	ReportFormat ReportFormat `yaml:"reportFormat"`
+
+	// Protocol is the protocol of the services, for the Cloud Monitoring
+	// metrics. Empty means HTTPProtocol.
+	Protocol Protocol `yaml:"protocol"`
+
+	// OnUnhealthy is the action on unhealthy candidates. Empty means
+	// RollbackOnUnhealthy.
+	OnUnhealthy UnhealthyAction `yaml:"onUnhealthy"`
+
+	// Probe is optional. If set, new candidates are tagged and probed before
+	// receiving any traffic.
+	Probe *Probe `yaml:"probe"`
+
+	// WarmUp is optional. If set, new candidates are tagged and diagnosed
+	// based on synthetic load before receiving any traffic.
+	WarmUp *WarmUp `yaml:"warmUp"`
+
+	// Shadow is optional. If set, new candidates are tagged and diagnosed
+	// based on mirrored production requests before receiving any traffic.
+	Shadow *Shadow `yaml:"shadow"`
+
+	// JobCanary is optional. If set, the Cloud Run jobs of the target are
+	// managed too, and their new images vetted by canary executions.
+	JobCanary *JobCanary `yaml:"jobCanary"`
+
+	// Attestation is optional. If set, new candidates receive traffic only
+	// once their image is attested.
+	Attestation *Attestation `yaml:"attestation"`
+
+	// VulnerabilityScan is optional. If set, candidates receive traffic and
+	// are promoted only if their image has no vulnerability more severe than
+	// allowed.
+	VulnerabilityScan *VulnerabilityScan `yaml:"vulnerabilityScan"`
 }
 
 // Config contains the configuration for the application.
 type Config struct {
-	Strategies []Strategy
+	Strategies []Strategy `yaml:"strategies"`
 }
 
 // NewTarget initializes a target to filter services by label.
@@ -73,75 +371,444 @@ func NewStrategy(target Target, steps []int64, healthOffset int, timeBetweenRoll
 	}
 }
 
+// FieldError is an invalid value of a configuration field.
+type FieldError struct {
+	// Field is the path of the field, e.g. strategies[0].steps[1].
+	Field string
+
+	// Line is the line of the field in the configuration file, or 0 if the
+	// configuration was not loaded from a file.
+	Line    int
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func fieldErrorf(field, format string, args ...interface{}) error {
+	return &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// inField prefixes the path of a field error with the path of its parent.
+func inField(parent string, err error) error {
+	fieldErr, ok := err.(*FieldError)
+	if !ok {
+		return err
+	}
+	field := parent
+	if fieldErr.Field != "" {
+		if !strings.HasPrefix(fieldErr.Field, "[") {
+			field += "."
+		}
+		field += fieldErr.Field
+	}
+	return &FieldError{Field: field, Line: fieldErr.Line, Message: fieldErr.Message}
+}
+
+// FilterRegions returns the discovered regions that match the include and
+// exclude patterns of the target.
+func (target Target) FilterRegions(regions []string) []string {
+	var filtered []string
+	for _, region := range regions {
+		if (len(target.IncludeRegions) == 0 || matchesAny(target.IncludeRegions, region)) &&
+			!matchesAny(target.ExcludeRegions, region) {
+			filtered = append(filtered, region)
+		}
+	}
+	return filtered
+}
+
+// MatchesService determines if the service with the label can be managed
+// according to the name filters of the target.
+func (target Target) MatchesService(name string) bool {
+	if len(target.IncludeServices) != 0 && !contains(target.IncludeServices, name) {
+		return false
+	}
+	if contains(target.ExcludeServices, name) {
+		return false
+	}
+	// The regular expressions are validated, so the errors are ignored.
+	if target.ServiceNameRegex != "" {
+		if ok, _ := regexp.MatchString(target.ServiceNameRegex, name); !ok {
+			return false
+		}
+	}
+	if target.ExcludeServiceNameRegex != "" {
+		if ok, _ := regexp.MatchString(target.ExcludeServiceNameRegex, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny determines if the region matches any of the patterns. The
+// patterns are validated, so the matching error is ignored.
+func matchesAny(patterns []string, region string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, region); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StrategiesByPrecedence returns the strategies from the highest to the
+// lowest precedence. A service targeted by several strategies is managed by
+// the one with the highest precedence: the one with the highest priority or,
+// for equal priorities, the first one in the configuration.
+func (config Config) StrategiesByPrecedence() []Strategy {
+	strategies := make([]Strategy, len(config.Strategies))
+	copy(strategies, config.Strategies)
+	sort.SliceStable(strategies, func(i, j int) bool {
+		return strategies[i].Priority > strategies[j].Priority
+	})
+	return strategies
+}
+
 // Validate checks if the configuration is valid.
 func (config Config) Validate() error {
+	if len(config.Strategies) == 0 {
+		return fieldErrorf("strategies", "at least one strategy must be specified")
+	}
+	names := make(map[string]int)
 	for i, strategy := range config.Strategies {
-		err := strategy.Validate()
-		if err != nil {
-			return errors.Wrapf(err, "invalid strategy at index %d", i)
+		field := fmt.Sprintf("strategies[%d]", i)
+		if err := strategy.Validate(); err != nil {
+			return inField(field, err)
+		}
+		if strategy.Name == "" {
+			continue
+		}
+		if j, ok := names[strategy.Name]; ok {
+			return fieldErrorf(field+".name", "name %q is already used by the strategy at index %d", strategy.Name, j)
 		}
+		names[strategy.Name] = i
 	}
 	return nil
 }
 
-// Validate checks if the strategy is valid.
+// Validate checks if the strategy is valid. The error is a *FieldError.
 func (strategy Strategy) Validate() error {
+	if err := validateTarget(strategy.Target); err != nil {
+		return inField("target", err)
+	}
+
 	if strategy.HealthOffsetMinute <= 0 {
-		return errors.Errorf("health check offset must be positive, got %d", strategy.HealthOffsetMinute)
+		return fieldErrorf("healthOffsetMinute", "health check offset must be positive, got %d", strategy.HealthOffsetMinute)
+	}
+	if strategy.TimeBetweenRollouts < 0 {
+		return fieldErrorf("timeBetweenRollouts", "time between rollouts cannot be negative, got %s", strategy.TimeBetweenRollouts)
+	}
+	if strategy.MetricsTimeout < 0 {
+		return fieldErrorf("metricsTimeout", "metrics timeout cannot be negative, got %s", strategy.MetricsTimeout)
+	}
+	if strategy.StuckAfter < 0 {
+		return fieldErrorf("stuckAfter", "stuck detection delay cannot be negative, got %s", strategy.StuckAfter)
+	}
+	if strategy.ConsecutiveHealthyChecks < 0 {
+		return fieldErrorf("consecutiveHealthyChecks", "number of consecutive healthy checks cannot be negative, got %d", strategy.ConsecutiveHealthyChecks)
+	}
+	if strategy.TrafficSplitTolerance < 0 || strategy.TrafficSplitTolerance > 100 {
+		return fieldErrorf("trafficSplitTolerance", "traffic split tolerance must be between 0 and 100, got %.2f", strategy.TrafficSplitTolerance)
+	}
+
+	switch strategy.ReportFormat {
+	case "", TextReportFormat, MarkdownReportFormat, HTMLReportFormat:
+	default:
+		return fieldErrorf("reportFormat", "invalid report format %q, must be one of %q, %q or %q",
+			strategy.ReportFormat, TextReportFormat, MarkdownReportFormat, HTMLReportFormat)
+	}
+
+	switch strategy.Protocol {
+	case "", HTTPProtocol, GRPCProtocol:
+	default:
+		return fieldErrorf("protocol", "invalid protocol %q, must be %q or %q", strategy.Protocol, HTTPProtocol, GRPCProtocol)
+	}
+
+	switch strategy.OnUnhealthy {
+	case "", RollbackOnUnhealthy, NotifyOnUnhealthy, PauseOnUnhealthy:
+	default:
+		return fieldErrorf("onUnhealthy", "invalid action %q, must be one of %q, %q or %q",
+			strategy.OnUnhealthy, RollbackOnUnhealthy, NotifyOnUnhealthy, PauseOnUnhealthy)
 	}
 
 	if len(strategy.Steps) == 0 {
-		return errors.New("steps cannot be empty")
+		return fieldErrorf("steps", "steps cannot be empty")
 	}
 
 	// Steps must be in ascending order and not greater than 100.
 	var previous int64
-	for _, step := range strategy.Steps {
+	for i, step := range strategy.Steps {
 		if step <= previous || step > 100 {
-			return errors.New("steps must be in ascending order and not greater than 100")
+			return fieldErrorf(fmt.Sprintf("steps[%d]", i), "steps must be in ascending order and not greater than 100, got %d after %d", step, previous)
 		}
 		previous = step
 	}
 
+	seen := make(map[HealthCriterion]int)
 	for i, criterion := range strategy.HealthCriteria {
+		field := fmt.Sprintf("healthCriteria[%d]", i)
 		if err := validateHealthCriterion(criterion); err != nil {
-			return errors.Wrapf(err, "invalid metrics criterion at index %d", i)
+			return inField(field, err)
+		}
+		key := HealthCriterion{Metric: criterion.Metric, Percentile: criterion.Percentile, Operation: criterion.Operation}
+		if j, ok := seen[key]; ok {
+			return fieldErrorf(field, "duplicate of the criterion at index %d", j)
+		}
+		seen[key] = i
+	}
+	if strategy.Probe != nil {
+		if err := validateProbe(*strategy.Probe); err != nil {
+			return inField("probe", err)
+		}
+	}
+	if strategy.WarmUp != nil {
+		if err := validateWarmUp(*strategy.WarmUp); err != nil {
+			return inField("warmUp", err)
+		}
+	}
+	if strategy.Shadow != nil {
+		if err := validateShadow(*strategy.Shadow); err != nil {
+			return inField("shadow", err)
 		}
 	}
-	return validateTarget(strategy.Target)
+	if strategy.Attestation != nil {
+		if err := validateAttestation(*strategy.Attestation); err != nil {
+			return inField("attestation", err)
+		}
+	}
+	if strategy.VulnerabilityScan != nil {
+		if err := validateVulnerabilityScan(*strategy.VulnerabilityScan); err != nil {
+			return inField("vulnerabilityScan", err)
+		}
+	}
+	if strategy.JobCanary != nil {
+		if strategy.Target.Platform == KubernetesPlatform {
+			return fieldErrorf("jobCanary", "jobs are not supported on platform %q", KubernetesPlatform)
+		}
+		if err := validateJobCanary(*strategy.JobCanary); err != nil {
+			return inField("jobCanary", err)
+		}
+	}
+	return nil
 }
 
 func validateHealthCriterion(criterion HealthCriterion) error {
 	threshold := criterion.Threshold
 	if threshold < 0 {
-		return errors.Errorf("threshold cannot be negative, criterion %q", criterion.Metric)
+		return fieldErrorf("threshold", "threshold cannot be negative for %q", criterion.Metric)
+	}
+
+	switch criterion.Metric {
+	case TraceErrorRateMetricsCheck, TraceLatencyMetricsCheck:
+		if criterion.Operation == "" {
+			return fieldErrorf("operation", "operation must be specified for %q", criterion.Metric)
+		}
+	default:
+		if criterion.Operation != "" {
+			return fieldErrorf("operation", "operation only applies to trace metrics, not %q", criterion.Metric)
+		}
 	}
 
 	switch criterion.Metric {
-	case ErrorRateMetricsCheck:
+	case ErrorRateMetricsCheck, TraceErrorRateMetricsCheck:
 		if threshold > 100 {
-			return errors.Errorf("threshold must be greater than 0 and less than 100 for %q", criterion.Metric)
+			return fieldErrorf("threshold", "threshold must be between 0 and 100 for %q, got %.2f", criterion.Metric, threshold)
 		}
-	case LatencyMetricsCheck:
+	case LatencyMetricsCheck, TraceLatencyMetricsCheck:
 		percentile := criterion.Percentile
 		if percentile != 99 && percentile != 95 && percentile != 50 {
-			return errors.Errorf("invalid percentile for %.2f", criterion.Percentile)
+			return fieldErrorf("percentile", "invalid percentile %.2f, must be 50, 95 or 99", criterion.Percentile)
+		}
+		if threshold == 0 {
+			return fieldErrorf("threshold", "latency threshold must be positive")
 		}
-	case RequestCountMetricsCheck:
 		return nil
+	case RequestCountMetricsCheck:
+		if threshold != math.Trunc(threshold) {
+			return fieldErrorf("threshold", "request count threshold must be a whole number, got %v", threshold)
+		}
 	default:
-		return errors.Errorf("invalid metric criteria %q", criterion.Metric)
+		return fieldErrorf("metric", "invalid metric criteria %q", criterion.Metric)
 	}
 
+	if criterion.Percentile != 0 {
+		return fieldErrorf("percentile", "percentile only applies to latency metrics, not %q", criterion.Metric)
+	}
+	return nil
+}
+
+func validateProbe(probe Probe) error {
+	if !strings.HasPrefix(probe.Path, "/") {
+		return fieldErrorf("path", "path must start with /, got %q", probe.Path)
+	}
+	if probe.ExpectedStatus < 100 || probe.ExpectedStatus > 599 {
+		return fieldErrorf("expectedStatus", "invalid expected status code %d", probe.ExpectedStatus)
+	}
+	if probe.MaxLatency < 0 {
+		return fieldErrorf("maxLatency", "max latency cannot be negative")
+	}
+	if probe.Requests <= 0 {
+		return fieldErrorf("requests", "number of requests must be positive, got %d", probe.Requests)
+	}
+	if probe.MinSuccessPercent < 0 || probe.MinSuccessPercent > 100 {
+		return fieldErrorf("minSuccessPercent", "min success percent must be between 0 and 100, got %.2f", probe.MinSuccessPercent)
+	}
+	if _, err := regexp.Compile(probe.BodyRegex); err != nil {
+		return fieldErrorf("bodyRegex", "invalid body regex: %v", err)
+	}
+	return nil
+}
+
+// attestorPattern matches the names of the Binary Authorization attestors.
+var attestorPattern = regexp.MustCompile(`^projects/[^/]+/attestors/[^/]+$`)
+
+func validateAttestation(attestation Attestation) error {
+	if len(attestation.Attestors) == 0 {
+		return fieldErrorf("attestors", "at least one attestor must be specified")
+	}
+	for i, attestor := range attestation.Attestors {
+		if !attestorPattern.MatchString(attestor) {
+			return fieldErrorf(fmt.Sprintf("attestors[%d]", i), "invalid attestor %q, must be projects/PROJECT/attestors/ATTESTOR", attestor)
+		}
+	}
+	return nil
+}
+
+func validateVulnerabilityScan(scan VulnerabilityScan) error {
+	for _, severity := range Severities {
+		if scan.MaxSeverity == severity {
+			return nil
+		}
+	}
+	return fieldErrorf("maxSeverity", "invalid severity %q, must be one of %s", scan.MaxSeverity, strings.Join(Severities, ", "))
+}
+
+func validateWarmUp(warmUp WarmUp) error {
+	if warmUp.RPS <= 0 {
+		return fieldErrorf("rps", "requests per second must be positive, got %d", warmUp.RPS)
+	}
+	if warmUp.Duration <= 0 {
+		return fieldErrorf("duration", "duration must be positive, got %v", warmUp.Duration)
+	}
+	if warmUp.Method == "" {
+		return fieldErrorf("method", "method must be specified")
+	}
+	if !strings.HasPrefix(warmUp.Path, "/") {
+		return fieldErrorf("path", "path must start with /, got %q", warmUp.Path)
+	}
+	return nil
+}
+
+func validateShadow(shadow Shadow) error {
+	if _, err := url.ParseRequestURI(shadow.ControlURL); err != nil {
+		return fieldErrorf("controlURL", "invalid control URL %q", shadow.ControlURL)
+	}
+	if shadow.SamplePercent <= 0 || shadow.SamplePercent > 100 {
+		return fieldErrorf("samplePercent", "sample percent must be greater than 0 and not greater than 100, got %.2f", shadow.SamplePercent)
+	}
+	if shadow.Duration <= 0 {
+		return fieldErrorf("duration", "duration must be positive, got %v", shadow.Duration)
+	}
+	return nil
+}
+
+func validateJobCanary(canary JobCanary) error {
+	if canary.Timeout < 0 {
+		return fieldErrorf("timeout", "timeout cannot be negative, got %s", canary.Timeout)
+	}
+	if canary.MinSuccessPercent <= 0 || canary.MinSuccessPercent > 100 {
+		return fieldErrorf("minSuccessPercent", "min success percent must be greater than 0 and not greater than 100, got %.2f", canary.MinSuccessPercent)
+	}
+	if canary.MaxDuration < 0 {
+		return fieldErrorf("maxDuration", "max duration cannot be negative, got %s", canary.MaxDuration)
+	}
 	return nil
 }
 
 func validateTarget(target Target) error {
-	if target.Project == "" {
-		return errors.Errorf("project must be specified")
+	switch target.Platform {
+	case "", ManagedPlatform:
+		if target.Namespace != "" {
+			return fieldErrorf("namespace", "namespace only applies to the %q platform", KubernetesPlatform)
+		}
+	case KubernetesPlatform:
+		if target.Namespace == "" {
+			return fieldErrorf("namespace", "namespace must be specified for the %q platform", KubernetesPlatform)
+		}
+		if target.Project == "" {
+			return fieldErrorf("project", "project must be specified for the %q platform", KubernetesPlatform)
+		}
+		if len(target.Regions) != 1 {
+			return fieldErrorf("regions", "the location of the cluster must be the only region for the %q platform", KubernetesPlatform)
+		}
+	default:
+		return fieldErrorf("platform", "invalid platform %q, must be %q or %q", target.Platform, ManagedPlatform, KubernetesPlatform)
+	}
+
+	var scopes int
+	for _, scope := range []string{target.Project, target.Folder, target.Organization} {
+		if scope != "" {
+			scopes++
+		}
+	}
+	if scopes == 0 {
+		return fieldErrorf("project", "project, folder or organization must be specified")
+	}
+	if scopes > 1 {
+		return fieldErrorf("project", "only one of project, folder or organization can be specified")
+	}
+	if target.ProjectFilter != "" && target.Project != "" {
+		return fieldErrorf("projectFilter", "project filter only applies to a folder or an organization")
 	}
 	if target.LabelSelector == "" {
-		return errors.Errorf("label must be specified")
+		return fieldErrorf("labelSelector", "label must be specified")
+	}
+	for i, region := range target.Regions {
+		if region == "" {
+			return fieldErrorf(fmt.Sprintf("regions[%d]", i), "region cannot be empty")
+		}
+	}
+	patterns := map[string][]string{
+		"includeRegions": target.IncludeRegions,
+		"excludeRegions": target.ExcludeRegions,
+	}
+	for _, field := range []string{"includeRegions", "excludeRegions"} {
+		if len(patterns[field]) != 0 && len(target.Regions) != 0 {
+			return fieldErrorf(field, "region patterns only apply when no regions are specified")
+		}
+		for i, pattern := range patterns[field] {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return fieldErrorf(fmt.Sprintf("%s[%d]", field, i), "invalid region pattern %q", pattern)
+			}
+		}
+	}
+	for i, name := range target.IncludeServices {
+		if contains(target.ExcludeServices, name) {
+			return fieldErrorf(fmt.Sprintf("includeServices[%d]", i), "service %q is also excluded", name)
+		}
+	}
+	if _, err := regexp.Compile(target.ServiceNameRegex); err != nil {
+		return fieldErrorf("serviceNameRegex", "invalid service name regex: %v", err)
+	}
+	if _, err := regexp.Compile(target.ExcludeServiceNameRegex); err != nil {
+		return fieldErrorf("excludeServiceNameRegex", "invalid service name regex: %v", err)
+	}
+	if target.ImpersonateServiceAccount != "" && !strings.Contains(target.ImpersonateServiceAccount, "@") {
+		return fieldErrorf("impersonateServiceAccount", "invalid service account %q, must be an email", target.ImpersonateServiceAccount)
 	}
 	return nil
 }
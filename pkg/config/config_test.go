@@ -123,6 +123,93 @@ func TestStrategy_Validate(t *testing.T) {
 			},
 			shouldErr: true,
 		},
+		{
+			name:                "correct trace criteria",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.TraceErrorRateMetricsCheck, Operation: "db.query", Threshold: 1},
+				{Metric: config.TraceLatencyMetricsCheck, Operation: "db.query", Percentile: 95, Threshold: 100},
+			},
+			shouldErr: false,
+		},
+		{
+			name:                "missing trace operation",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.TraceErrorRateMetricsCheck, Threshold: 1},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "invalid trace latency percentile",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.TraceLatencyMetricsCheck, Operation: "db.query", Percentile: 90, Threshold: 100},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "duplicate criteria",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 500},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "percentile of non-latency criterion",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.ErrorRateMetricsCheck, Percentile: 99, Threshold: 1},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "zero latency threshold",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "fractional request count",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.RequestCountMetricsCheck, Threshold: 10.5},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "negative time between rollouts",
+			target:              config.NewTarget("myproject", []string{"us-east1", "us-west1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: -time.Minute,
+			shouldErr:           true,
+		},
 	}
 
 	for _, test := range tests {
@@ -137,3 +224,536 @@ func TestStrategy_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestStrategy_ValidateMetricsTimeout(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	strategy.MetricsTimeout = time.Minute
+	assert.Nil(t, strategy.Validate())
+	strategy.MetricsTimeout = -time.Minute
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateConsecutiveHealthyChecks(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	strategy.ConsecutiveHealthyChecks = 3
+	assert.Nil(t, strategy.Validate())
+	strategy.ConsecutiveHealthyChecks = -1
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateTrafficSplitTolerance(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	strategy.TrafficSplitTolerance = 10
+	assert.Nil(t, strategy.Validate())
+	strategy.TrafficSplitTolerance = -1
+	assert.NotNil(t, strategy.Validate())
+	strategy.TrafficSplitTolerance = 101
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateProtocol(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	for _, protocol := range []config.Protocol{"", config.HTTPProtocol, config.GRPCProtocol} {
+		strategy.Protocol = protocol
+		assert.Nil(t, strategy.Validate())
+	}
+	strategy.Protocol = "websocket"
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateOnUnhealthy(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	for _, action := range []config.UnhealthyAction{"", config.RollbackOnUnhealthy, config.NotifyOnUnhealthy, config.PauseOnUnhealthy} {
+		strategy.OnUnhealthy = action
+		assert.Nil(t, strategy.Validate())
+	}
+	strategy.OnUnhealthy = "ignore"
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateReportFormat(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	for _, format := range []config.ReportFormat{"", config.TextReportFormat, config.MarkdownReportFormat, config.HTMLReportFormat} {
+		strategy.ReportFormat = format
+		assert.Nil(t, strategy.Validate())
+	}
+	strategy.ReportFormat = "pdf"
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     config.Probe
+		shouldErr bool
+	}{
+		{
+			name:  "correct probe",
+			probe: config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 10, MinSuccessPercent: 100, BodyRegex: "ok"},
+		},
+		{
+			name:      "path without leading slash",
+			probe:     config.Probe{Path: "healthz", ExpectedStatus: 200, Requests: 10},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid status code",
+			probe:     config.Probe{Path: "/healthz", ExpectedStatus: 1000, Requests: 10},
+			shouldErr: true,
+		},
+		{
+			name:      "no requests",
+			probe:     config.Probe{Path: "/healthz", ExpectedStatus: 200},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid min success percent",
+			probe:     config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 10, MinSuccessPercent: 101},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid body regex",
+			probe:     config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 10, BodyRegex: "(ok"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.NewTarget("myproject", nil, "team=backend")
+			strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			probe := test.probe
+			strategy.Probe = &probe
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestStrategy_ValidateWarmUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		warmUp    config.WarmUp
+		shouldErr bool
+	}{
+		{
+			name:   "correct warm-up",
+			warmUp: config.WarmUp{RPS: 5, Duration: time.Minute, Method: "POST", Path: "/api", Body: "{}"},
+		},
+		{
+			name:      "non-positive rps",
+			warmUp:    config.WarmUp{Duration: time.Minute, Method: "GET", Path: "/"},
+			shouldErr: true,
+		},
+		{
+			name:      "non-positive duration",
+			warmUp:    config.WarmUp{RPS: 5, Method: "GET", Path: "/"},
+			shouldErr: true,
+		},
+		{
+			name:      "missing method",
+			warmUp:    config.WarmUp{RPS: 5, Duration: time.Minute, Path: "/"},
+			shouldErr: true,
+		},
+		{
+			name:      "path without leading slash",
+			warmUp:    config.WarmUp{RPS: 5, Duration: time.Minute, Method: "GET", Path: "api"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.NewTarget("myproject", nil, "team=backend")
+			strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			warmUp := test.warmUp
+			strategy.WarmUp = &warmUp
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestStrategy_ValidateShadow(t *testing.T) {
+	tests := []struct {
+		name      string
+		shadow    config.Shadow
+		shouldErr bool
+	}{
+		{
+			name:   "correct shadow",
+			shadow: config.Shadow{ControlURL: "http://mirror:8081", SamplePercent: 10, Duration: time.Hour},
+		},
+		{
+			name:      "invalid control URL",
+			shadow:    config.Shadow{ControlURL: "mirror", SamplePercent: 10, Duration: time.Hour},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid sample percent",
+			shadow:    config.Shadow{ControlURL: "http://mirror:8081", SamplePercent: 0, Duration: time.Hour},
+			shouldErr: true,
+		},
+		{
+			name:      "non-positive duration",
+			shadow:    config.Shadow{ControlURL: "http://mirror:8081", SamplePercent: 10},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.NewTarget("myproject", nil, "team=backend")
+			strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			shadow := test.shadow
+			strategy.Shadow = &shadow
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestStrategy_ValidateAttestation(t *testing.T) {
+	tests := []struct {
+		name        string
+		attestation config.Attestation
+		shouldErr   bool
+	}{
+		{
+			name:        "correct attestation",
+			attestation: config.Attestation{Attestors: []string{"projects/myproject/attestors/built-by-ci"}},
+		},
+		{
+			name:      "no attestor",
+			shouldErr: true,
+		},
+		{
+			name:        "invalid attestor",
+			attestation: config.Attestation{Attestors: []string{"built-by-ci"}},
+			shouldErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.NewTarget("myproject", nil, "team=backend")
+			strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			attestation := test.attestation
+			strategy.Attestation = &attestation
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestStrategy_ValidateVulnerabilityScan(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	for _, severity := range config.Severities {
+		strategy.VulnerabilityScan = &config.VulnerabilityScan{MaxSeverity: severity}
+		assert.Nil(t, strategy.Validate(), severity)
+	}
+	strategy.VulnerabilityScan = &config.VulnerabilityScan{MaxSeverity: "high"}
+	assert.NotNil(t, strategy.Validate())
+	strategy.VulnerabilityScan = &config.VulnerabilityScan{}
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestStrategy_ValidateJobCanary(t *testing.T) {
+	tests := []struct {
+		name      string
+		canary    config.JobCanary
+		platform  config.Platform
+		shouldErr bool
+	}{
+		{
+			name:   "correct job canary",
+			canary: config.JobCanary{Args: []string{"--dry-run"}, Timeout: time.Hour, MinSuccessPercent: 100, MaxDuration: 10 * time.Minute},
+		},
+		{
+			name:      "invalid min success percent",
+			canary:    config.JobCanary{Timeout: time.Hour},
+			shouldErr: true,
+		},
+		{
+			name:      "negative max duration",
+			canary:    config.JobCanary{MinSuccessPercent: 100, MaxDuration: -time.Minute},
+			shouldErr: true,
+		},
+		{
+			name:      "kubernetes platform",
+			canary:    config.JobCanary{MinSuccessPercent: 100},
+			platform:  config.KubernetesPlatform,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.NewTarget("myproject", nil, "team=backend")
+			target.Platform = test.platform
+			strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			canary := test.canary
+			strategy.JobCanary = &canary
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestStrategy_ValidateFieldError(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck, Threshold: 100},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 101},
+	})
+	cfg := config.Config{Strategies: []config.Strategy{strategy}}
+	err := cfg.Validate()
+	assert.Equal(t, &config.FieldError{
+		Field:   "strategies[0].healthCriteria[1].threshold",
+		Message: `threshold must be between 0 and 100 for "error-rate-percent", got 101.00`,
+	}, err)
+}
+
+func TestConfig_StrategiesByPrecedence(t *testing.T) {
+	cfg := config.Config{Strategies: []config.Strategy{
+		{Name: "default"},
+		{Name: "conservative", Priority: 10},
+		{Name: "aggressive"},
+		{Name: "critical", Priority: 20},
+	}}
+	var names []string
+	for _, strategy := range cfg.StrategiesByPrecedence() {
+		names = append(names, strategy.Name)
+	}
+	assert.Equal(t, []string{"critical", "conservative", "default", "aggressive"}, names)
+	assert.Equal(t, "default", cfg.Strategies[0].Name)
+}
+
+func TestConfig_ValidateNames(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	strategy.Name = "backend"
+	cfg := config.Config{Strategies: []config.Strategy{strategy, strategy}}
+	err := cfg.Validate()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `strategies[1].name: name "backend" is already used by the strategy at index 0`, err.Error())
+	}
+
+	cfg.Strategies[1].Name = "frontend"
+	assert.Nil(t, cfg.Validate())
+}
+
+func TestStrategy_ValidateTargetScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    config.Target
+		shouldErr bool
+	}{
+		{
+			name:   "folder",
+			target: config.Target{Folder: "123", LabelSelector: "team=backend"},
+		},
+		{
+			name:   "organization with project filter",
+			target: config.Target{Organization: "456", ProjectFilter: "labels.env:prod", LabelSelector: "team=backend"},
+		},
+		{
+			name:   "kubernetes platform",
+			target: config.Target{Platform: config.KubernetesPlatform, Project: "myproject", Namespace: "default", Regions: []string{"us-east1"}, LabelSelector: "team=backend"},
+		},
+		{
+			name:      "kubernetes platform without namespace",
+			target:    config.Target{Platform: config.KubernetesPlatform, Project: "myproject", Regions: []string{"us-east1"}, LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+		{
+			name:      "kubernetes platform without cluster location",
+			target:    config.Target{Platform: config.KubernetesPlatform, Project: "myproject", Namespace: "default", LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+		{
+			name:      "namespace for managed platform",
+			target:    config.Target{Project: "myproject", Namespace: "default", LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+		{
+			name:      "invalid platform",
+			target:    config.Target{Platform: "gke", Project: "myproject", LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+		{
+			name:      "project and folder",
+			target:    config.Target{Project: "myproject", Folder: "123", LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+		{
+			name:   "impersonated service account",
+			target: config.Target{Project: "myproject", LabelSelector: "team=backend", ImpersonateServiceAccount: "operator@myproject.iam.gserviceaccount.com"},
+		},
+		{
+			name:      "invalid impersonated service account",
+			target:    config.Target{Project: "myproject", LabelSelector: "team=backend", ImpersonateServiceAccount: "operator"},
+			shouldErr: true,
+		},
+		{
+			name:      "project filter with project",
+			target:    config.Target{Project: "myproject", ProjectFilter: "labels.env:prod", LabelSelector: "team=backend"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			strategy := config.NewStrategy(test.target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+			err := strategy.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestTarget_FilterRegions(t *testing.T) {
+	regions := []string{"us-central1", "us-east1", "europe-west1", "asia-east1"}
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:     "no patterns",
+			expected: regions,
+		},
+		{
+			name:     "include",
+			include:  []string{"us-*", "europe-*"},
+			expected: []string{"us-central1", "us-east1", "europe-west1"},
+		},
+		{
+			name:     "include and exclude",
+			include:  []string{"us-*"},
+			exclude:  []string{"*-east1"},
+			expected: []string{"us-central1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			target := config.Target{IncludeRegions: test.include, ExcludeRegions: test.exclude}
+			assert.Equal(tt, test.expected, target.FilterRegions(regions))
+		})
+	}
+}
+
+func TestStrategy_ValidateRegionPatterns(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	target.IncludeRegions = []string{"us-*"}
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	assert.Nil(t, strategy.Validate())
+
+	strategy.Target.ExcludeRegions = []string{"us-[east1"}
+	err := strategy.Validate()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `target.excludeRegions[0]: invalid region pattern "us-[east1"`, err.Error())
+	}
+
+	strategy.Target.ExcludeRegions = nil
+	strategy.Target.Regions = []string{"us-east1"}
+	assert.NotNil(t, strategy.Validate())
+}
+
+func TestTarget_MatchesService(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   config.Target
+		service  string
+		expected bool
+	}{
+		{
+			name:     "no filters",
+			service:  "backend",
+			expected: true,
+		},
+		{
+			name:     "not in allowlist",
+			target:   config.Target{IncludeServices: []string{"frontend"}},
+			service:  "backend",
+			expected: false,
+		},
+		{
+			name:     "in denylist",
+			target:   config.Target{ExcludeServices: []string{"billing"}},
+			service:  "billing",
+			expected: false,
+		},
+		{
+			name:     "matches regex",
+			target:   config.Target{ServiceNameRegex: "^api-"},
+			service:  "api-users",
+			expected: true,
+		},
+		{
+			name:     "does not match regex",
+			target:   config.Target{ServiceNameRegex: "^api-"},
+			service:  "worker",
+			expected: false,
+		},
+		{
+			name:     "matches exclude regex",
+			target:   config.Target{ServiceNameRegex: "^api-", ExcludeServiceNameRegex: "-legacy$"},
+			service:  "api-users-legacy",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, test.target.MatchesService(test.service))
+		})
+	}
+}
+
+func TestStrategy_ValidateServiceFilters(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	target.IncludeServices = []string{"api", "billing"}
+	target.ExcludeServices = []string{"billing"}
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, nil)
+	err := strategy.Validate()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `target.includeServices[1]: service "billing" is also excluded`, err.Error())
+	}
+
+	strategy.Target.ExcludeServices = nil
+	strategy.Target.ServiceNameRegex = "api-("
+	assert.NotNil(t, strategy.Validate())
+}
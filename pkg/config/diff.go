@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Diff describes the changes between two configurations, one line per
+// changed field (e.g. strategies[0].steps: [5 30 60] -> [10 50]).
+func Diff(old, new *Config) []string {
+	var changes []string
+	diffValues(reflect.ValueOf(*old), reflect.ValueOf(*new), "", &changes)
+	return changes
+}
+
+func diffValues(old, new reflect.Value, path string, changes *[]string) {
+	switch old.Kind() {
+	case reflect.Struct:
+		t := old.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			diffValues(old.Field(i), new.Field(i), fieldPath, changes)
+		}
+	case reflect.Ptr:
+		switch {
+		case old.IsNil() && new.IsNil():
+		case old.IsNil():
+			*changes = append(*changes, fmt.Sprintf("%s: added", path))
+		case new.IsNil():
+			*changes = append(*changes, fmt.Sprintf("%s: removed", path))
+		default:
+			diffValues(old.Elem(), new.Elem(), path, changes)
+		}
+	case reflect.Slice:
+		if old.Type().Elem().Kind() != reflect.Struct {
+			if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+				*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, formatValue(old), formatValue(new)))
+			}
+			return
+		}
+		for i := 0; i < old.Len() || i < new.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= new.Len():
+				*changes = append(*changes, fmt.Sprintf("%s: removed", elemPath))
+			case i >= old.Len():
+				*changes = append(*changes, fmt.Sprintf("%s: added", elemPath))
+			default:
+				diffValues(old.Index(i), new.Index(i), elemPath, changes)
+			}
+		}
+	default:
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, formatValue(old), formatValue(new)))
+		}
+	}
+}
+
+// formatValue formats a field value, quoting strings so empty values are
+// visible.
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
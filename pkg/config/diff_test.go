@@ -0,0 +1,38 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	target := config.NewTarget("myproject", []string{"us-east1"}, "team=backend")
+	old := &config.Config{Strategies: []config.Strategy{
+		config.NewStrategy(target, []int64{5, 30, 60}, 20, 10*time.Minute, []config.HealthCriterion{
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 1},
+		}),
+	}}
+	assert.Empty(t, config.Diff(old, old))
+
+	newStrategy := config.NewStrategy(target, []int64{10, 50}, 20, 5*time.Minute, []config.HealthCriterion{
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 2},
+		{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+	})
+	newStrategy.ReportFormat = config.MarkdownReportFormat
+	newStrategy.Probe = &config.Probe{Path: "/", ExpectedStatus: 200, Requests: 1}
+	new := &config.Config{Strategies: []config.Strategy{newStrategy, newStrategy}}
+
+	expected := []string{
+		"strategies[0].steps: [5 30 60] -> [10 50]",
+		"strategies[0].healthCriteria[0].threshold: 1 -> 2",
+		"strategies[0].healthCriteria[1]: added",
+		"strategies[0].timeBetweenRollouts: 10m0s -> 5m0s",
+		`strategies[0].reportFormat: "" -> "markdown"`,
+		"strategies[0].probe: added",
+		"strategies[1]: added",
+	}
+	assert.Equal(t, expected, config.Diff(old, new))
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of the configuration file.
+//
+// The defaults are merged into every strategy. A profile (e.g. prod) merges its
+// defaults over the shared ones and, if it has strategies, replaces the shared
+// strategies.
+type file struct {
+	Defaults   *Strategy          `yaml:"defaults"`
+	Strategies []Strategy         `yaml:"strategies"`
+	Profiles   map[string]profile `yaml:"profiles"`
+}
+
+// profile is an environment-specific part of the configuration file.
+type profile struct {
+	Defaults   *Strategy  `yaml:"defaults"`
+	Strategies []Strategy `yaml:"strategies"`
+}
+
+// Load parses and validates a YAML configuration file for the profile, which
+// might be empty to only use the shared part of the file. ${VAR} and
+// ${VAR:-default} are replaced with environment variables before parsing.
+// Fields that are not part of the configuration are rejected, so typos are not
+// silently ignored. Validation errors are *FieldError with the line of the
+// invalid field.
+func Load(data []byte, profileName string) (*Config, error) {
+	config, _, err := load(data, profileName)
+	return config, err
+}
+
+// LintFile loads the configuration file for the profile like Load and returns
+// its suspicious settings (see Config.Lint), which are *FieldError with the
+// line of the field.
+func LintFile(data []byte, profileName string) ([]error, error) {
+	config, merged, err := load(data, profileName)
+	if err != nil {
+		return nil, err
+	}
+	warnings := config.Lint()
+	for _, warning := range warnings {
+		if fieldErr, ok := warning.(*FieldError); ok {
+			fieldErr.Line = fieldLine(merged, fieldErr.Field)
+		}
+	}
+	return warnings, nil
+}
+
+// load parses and validates the configuration file for the profile, and
+// returns the merged document it was decoded from.
+func load(data []byte, profileName string) (*Config, *yaml.Node, error) {
+	data, err := expandEnv(data, os.LookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid YAML")
+	}
+
+	var f file
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && err != io.EOF {
+		return nil, nil, errors.Wrap(err, "invalid configuration")
+	}
+	if _, ok := f.Profiles[profileName]; profileName != "" && !ok {
+		return nil, nil, errors.Errorf("profile %q is not defined in the configuration", profileName)
+	}
+
+	merged := mergeProfile(&root, profileName)
+	var config Config
+	if err := merged.Decode(&config); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid configuration")
+	}
+
+	if err := config.Validate(); err != nil {
+		if fieldErr, ok := err.(*FieldError); ok {
+			fieldErr.Line = fieldLine(merged, fieldErr.Field)
+		}
+		return nil, nil, err
+	}
+	return &config, merged, nil
+}
+
+// ParseStrategy parses and validates a single strategy in YAML or JSON (e.g.
+// the spec of a Kubernetes resource). Validation errors are *FieldError.
+func ParseStrategy(data []byte) (Strategy, error) {
+	var strategy Strategy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&strategy); err != nil && err != io.EOF {
+		return Strategy{}, errors.Wrap(err, "invalid strategy")
+	}
+	if err := strategy.Validate(); err != nil {
+		return Strategy{}, err
+	}
+	return strategy, nil
+}
+
+// mergeProfile returns the document of the configuration of the profile, with
+// the defaults merged into the strategies. The nodes keep their line in the
+// file.
+func mergeProfile(root *yaml.Node, profileName string) *yaml.Node {
+	doc := root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) != 0 {
+		doc = doc.Content[0]
+	}
+	defaults := mappingValue(doc, "defaults")
+	strategies := mappingValue(doc, "strategies")
+	if profileName != "" {
+		profileNode := mappingValue(mappingValue(doc, "profiles"), profileName)
+		defaults = mergeNodes(defaults, mappingValue(profileNode, "defaults"))
+		if profileStrategies := mappingValue(profileNode, "strategies"); profileStrategies != nil {
+			strategies = profileStrategies
+		}
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Line: doc.Line}
+	if strategies == nil {
+		return merged
+	}
+	mergedStrategies := &yaml.Node{Kind: yaml.SequenceNode, Line: strategies.Line}
+	for _, strategy := range strategies.Content {
+		mergedStrategies.Content = append(mergedStrategies.Content, mergeNodes(defaults, strategy))
+	}
+	merged.Content = []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "strategies", Line: strategies.Line},
+		mergedStrategies,
+	}
+	return merged
+}
+
+// mergeNodes merges the override into the base: the fields of mappings are
+// merged recursively and other values (including sequences) are replaced.
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	if base != nil && base.Kind == yaml.AliasNode {
+		base = base.Alias
+	}
+	if override != nil && override.Kind == yaml.AliasNode {
+		override = override.Alias
+	}
+	if base == nil {
+		return override
+	}
+	if override == nil {
+		return base
+	}
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: override.Tag, Line: override.Line, Column: override.Column}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		if mappingValue(override, base.Content[i].Value) == nil {
+			merged.Content = append(merged.Content, base.Content[i], base.Content[i+1])
+		}
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key := override.Content[i]
+		merged.Content = append(merged.Content, key, mergeNodes(mappingValue(base, key.Value), override.Content[i+1]))
+	}
+	return merged
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil if the
+// node is not a mapping or the key is missing.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+var envVarRegexp = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} with the value of the environment variable and
+// ${VAR:-default} with the value or, if the variable is not set, the default.
+// $$ is replaced with $. Variables that are not set and have no default are
+// rejected, so typos are not silently replaced with empty values.
+func expandEnv(data []byte, lookupEnv func(string) (string, bool)) ([]byte, error) {
+	var (
+		expanded []byte
+		last     int
+	)
+	for _, match := range envVarRegexp.FindAllSubmatchIndex(data, -1) {
+		expanded = append(expanded, data[last:match[0]]...)
+		last = match[1]
+		if match[2] < 0 {
+			expanded = append(expanded, '$')
+			continue
+		}
+		name := string(data[match[2]:match[3]])
+		value, ok := lookupEnv(name)
+		if !ok {
+			if match[4] < 0 {
+				line := bytes.Count(data[:match[0]], []byte("\n")) + 1
+				return nil, errors.Errorf("line %d: environment variable %q is not set", line, name)
+			}
+			value = string(data[match[4]:match[5]])
+		}
+		expanded = append(expanded, value...)
+	}
+	return append(expanded, data[last:]...), nil
+}
+
+var fieldPathRegexp = regexp.MustCompile(`[^.\[\]]+|\[\d+\]`)
+
+// fieldLine returns the line of the field (e.g. strategies[0].steps[1]) in the
+// YAML document. If the field is missing, the line of its closest ancestor is
+// returned.
+func fieldLine(root *yaml.Node, field string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) != 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, segment := range fieldPathRegexp.FindAllString(field, -1) {
+		var next *yaml.Node
+		if strings.HasPrefix(segment, "[") {
+			i, _ := strconv.Atoi(strings.Trim(segment, "[]"))
+			if node.Kind == yaml.SequenceNode && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		} else {
+			next = mappingValue(node, segment)
+		}
+		if next == nil {
+			break
+		}
+		node, line = next, next.Line
+	}
+	return line
+}
@@ -0,0 +1,241 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	data := `
+strategies:
+- target:
+    project: myproject
+    regions: [us-east1]
+    labelSelector: team=backend
+  steps: [5, 30, 60]
+  healthOffsetMinute: 20
+  timeBetweenRollouts: 10m
+  healthCriteria:
+  - metric: request-latency
+    percentile: 99
+    threshold: 750
+  - metric: error-rate-percent
+    threshold: 1
+  probe:
+    path: /healthz
+    expectedStatus: 200
+    requests: 5
+    maxLatency: 500ms
+`
+	cfg, err := config.Load([]byte(data), "")
+	assert.Nil(t, err)
+	expected := &config.Config{Strategies: []config.Strategy{{
+		Target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+		Steps:               []int64{5, 30, 60},
+		HealthOffsetMinute:  20,
+		TimeBetweenRollouts: 10 * time.Minute,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 1},
+		},
+		Probe: &config.Probe{Path: "/healthz", ExpectedStatus: 200, Requests: 5, MaxLatency: 500 * time.Millisecond},
+	}}}
+	assert.Equal(t, expected, cfg)
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	data := `
+defaults:
+  target:
+    project: shared-project
+    labelSelector: rollout-strategy=gradual
+  steps: [5, 30, 60]
+  healthOffsetMinute: 20
+strategies:
+- name: default
+profiles:
+  staging:
+    defaults:
+      target: {project: staging-project}
+      steps: [50]
+  prod:
+    defaults:
+      healthOffsetMinute: 60
+    strategies:
+    - name: backend
+      target: {labelSelector: team=backend}
+    - name: frontend
+      target: {labelSelector: team=frontend}
+      steps: [1, 10]
+`
+	tests := []struct {
+		profile  string
+		expected []config.Strategy
+	}{
+		{
+			profile: "",
+			expected: []config.Strategy{
+				{Name: "default", Target: config.NewTarget("shared-project", nil, "rollout-strategy=gradual"), Steps: []int64{5, 30, 60}, HealthOffsetMinute: 20},
+			},
+		},
+		{
+			profile: "staging",
+			expected: []config.Strategy{
+				{Name: "default", Target: config.NewTarget("staging-project", nil, "rollout-strategy=gradual"), Steps: []int64{50}, HealthOffsetMinute: 20},
+			},
+		},
+		{
+			profile: "prod",
+			expected: []config.Strategy{
+				{Name: "backend", Target: config.NewTarget("shared-project", nil, "team=backend"), Steps: []int64{5, 30, 60}, HealthOffsetMinute: 60},
+				{Name: "frontend", Target: config.NewTarget("shared-project", nil, "team=frontend"), Steps: []int64{1, 10}, HealthOffsetMinute: 60},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.profile, func(tt *testing.T) {
+			cfg, err := config.Load([]byte(data), test.profile)
+			if assert.Nil(tt, err) {
+				assert.Equal(tt, test.expected, cfg.Strategies)
+			}
+		})
+	}
+
+	_, err := config.Load([]byte(data), "dev")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `profile "dev" is not defined in the configuration`, err.Error())
+	}
+}
+
+func TestLoad_EnvironmentVariables(t *testing.T) {
+	os.Setenv("ROLLOUT_TEST_PROJECT", "env-project")
+	defer os.Unsetenv("ROLLOUT_TEST_PROJECT")
+	data := `strategies:
+- target:
+    project: ${ROLLOUT_TEST_PROJECT}
+    labelSelector: ${ROLLOUT_TEST_LABEL:-team=backend}
+  steps: [5]
+  healthOffsetMinute: 20
+  probe:
+    path: /price?currency=$$USD
+    expectedStatus: 200
+    requests: 1
+`
+	cfg, err := config.Load([]byte(data), "")
+	if assert.Nil(t, err) {
+		assert.Equal(t, config.NewTarget("env-project", nil, "team=backend"), cfg.Strategies[0].Target)
+		assert.Equal(t, "/price?currency=$USD", cfg.Strategies[0].Probe.Path)
+	}
+
+	_, err = config.Load([]byte("strategies:\n- name: ${ROLLOUT_TEST_UNSET}\n"), "")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `line 2: environment variable "ROLLOUT_TEST_UNSET" is not set`, err.Error())
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name:     "invalid YAML",
+			data:     "strategies: [",
+			expected: "invalid YAML: yaml: line 1: did not find expected node content",
+		},
+		{
+			name:     "empty file",
+			data:     "",
+			expected: "strategies: at least one strategy must be specified",
+		},
+		{
+			name: "unknown field",
+			data: `strategies:
+- target: {project: myproject, labelSelector: team=backend}
+  steps: [5]
+  healthOfsetMinute: 20
+`,
+			expected: "invalid configuration: yaml: unmarshal errors:\n  line 4: field healthOfsetMinute not found in type config.Strategy",
+		},
+		{
+			name: "steps not in order",
+			data: `strategies:
+- target: {project: myproject, labelSelector: team=backend}
+  healthOffsetMinute: 20
+  steps:
+  - 5
+  - 60
+  - 30
+`,
+			expected: "line 7: strategies[0].steps[2]: steps must be in ascending order and not greater than 100, got 30 after 60",
+		},
+		{
+			name: "invalid percentile",
+			data: `strategies:
+- target: {project: myproject, labelSelector: team=backend}
+  healthOffsetMinute: 20
+  steps: [5]
+  healthCriteria:
+  - metric: request-latency
+    percentile: 90
+    threshold: 100
+`,
+			expected: "line 7: strategies[0].healthCriteria[0].percentile: invalid percentile 90.00, must be 50, 95 or 99",
+		},
+		{
+			name: "missing field",
+			data: `strategies:
+- target:
+    labelSelector: team=backend
+  healthOffsetMinute: 20
+  steps: [5]
+`,
+			expected: "line 3: strategies[0].target.project: project, folder or organization must be specified",
+		},
+		{
+			name: "invalid merged strategy",
+			data: `defaults:
+  target: {project: myproject, labelSelector: team=backend}
+  healthOffsetMinute: 20
+strategies:
+- name: backend
+  steps: [50, 5]
+`,
+			expected: "line 6: strategies[0].steps[1]: steps must be in ascending order and not greater than 100, got 5 after 50",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			_, err := config.Load([]byte(test.data), "")
+			if assert.NotNil(tt, err) {
+				assert.Equal(tt, test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	strategy, err := config.ParseStrategy([]byte(`{
+		"target": {"project": "myproject", "labelSelector": "team=backend"},
+		"steps": [5, 50],
+		"healthOffsetMinute": 20,
+		"timeBetweenRollouts": "10m"
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, config.NewStrategy(config.NewTarget("myproject", nil, "team=backend"), []int64{5, 50}, 20, 10*time.Minute, nil), strategy)
+
+	_, err = config.ParseStrategy([]byte(`{"target": {"project": "myproject", "labelSelector": "team=backend"}, "steps": [5, 50]}`))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "healthOffsetMinute: health check offset must be positive, got 0", err.Error())
+	}
+
+	_, err = config.ParseStrategy([]byte(`{"stepz": [5]}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// MonitoringIngestionDelayMinute is the time, in minutes, the metrics of
+// Cloud Run can take to be available in Cloud Monitoring.
+const MonitoringIngestionDelayMinute = 3
+
+// maxFinalStepJump is the largest increase in traffic, in percent, from the
+// last step to the promotion of the candidate that is not reported.
+const maxFinalStepJump = 50
+
+// Lint returns the suspicious settings of a valid configuration: settings
+// that are allowed but probably do not do what was intended. The errors are
+// *FieldError.
+func (config Config) Lint() []error {
+	var warnings []error
+	for i, strategy := range config.Strategies {
+		field := fmt.Sprintf("strategies[%d]", i)
+		for _, warning := range strategy.Lint() {
+			warnings = append(warnings, inField(field, warning))
+		}
+		for j, other := range config.Strategies {
+			if j != i && reflect.DeepEqual(other.Target, strategy.Target) && precedes(other, j, strategy, i) {
+				warnings = append(warnings, fieldErrorf(field+".target", "same target as the strategy at index %d, which takes precedence, so the strategy manages no service", j))
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// precedes determines if the strategy a at index i in the configuration takes
+// precedence over the strategy b at index j.
+func precedes(a Strategy, i int, b Strategy, j int) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return i < j
+}
+
+// Lint returns the suspicious settings of a valid strategy. The errors are
+// *FieldError.
+func (strategy Strategy) Lint() []error {
+	var warnings []error
+
+	last := strategy.Steps[len(strategy.Steps)-1]
+	if last < 100 && 100-last > maxFinalStepJump {
+		warnings = append(warnings, fieldErrorf(fmt.Sprintf("steps[%d]", len(strategy.Steps)-1),
+			"candidate goes from %d%% to 100%% of the traffic when promoted, add a higher step (e.g. 100)", last))
+	}
+
+	if strategy.HealthOffsetMinute <= MonitoringIngestionDelayMinute {
+		warnings = append(warnings, fieldErrorf("healthOffsetMinute",
+			"health check offset of %d minutes is not longer than the ingestion delay of Cloud Monitoring (%d minutes), so the diagnoses miss most of the metrics",
+			strategy.HealthOffsetMinute, MonitoringIngestionDelayMinute))
+	}
+	if offset := time.Duration(strategy.HealthOffsetMinute) * time.Minute; strategy.TimeBetweenRollouts < offset {
+		warnings = append(warnings, fieldErrorf("timeBetweenRollouts",
+			"time between rollouts (%s) is shorter than the health check offset (%s), so the diagnoses include metrics from before the last step",
+			strategy.TimeBetweenRollouts, offset))
+	}
+
+	if len(strategy.HealthCriteria) == 0 {
+		warnings = append(warnings, fieldErrorf("healthCriteria", "no health criteria, candidates with traffic cannot be diagnosed"))
+	} else if !hasCriterion(strategy.HealthCriteria, RequestCountMetricsCheck) {
+		warnings = append(warnings, fieldErrorf("healthCriteria", "no %q criterion, candidates with too few requests can be diagnosed healthy", RequestCountMetricsCheck))
+	}
+	return warnings
+}
+
+func hasCriterion(criteria []HealthCriterion, metric MetricsCheck) bool {
+	for _, criterion := range criteria {
+		if criterion.Metric == metric {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrategy_Lint(t *testing.T) {
+	requestCount := config.HealthCriterion{Metric: config.RequestCountMetricsCheck, Threshold: 100}
+	errorRate := config.HealthCriterion{Metric: config.ErrorRateMetricsCheck, Threshold: 1}
+	target := config.NewTarget("myproject", nil, "team=backend")
+
+	tests := []struct {
+		name     string
+		strategy config.Strategy
+		expected []string
+	}{
+		{
+			name:     "no warnings",
+			strategy: config.NewStrategy(target, []int64{5, 30, 60}, 20, 30*time.Minute, []config.HealthCriterion{requestCount, errorRate}),
+		},
+		{
+			name:     "large final jump",
+			strategy: config.NewStrategy(target, []int64{5, 20}, 20, 30*time.Minute, []config.HealthCriterion{requestCount}),
+			expected: []string{"steps[1]: candidate goes from 20% to 100% of the traffic when promoted, add a higher step (e.g. 100)"},
+		},
+		{
+			name:     "short health offset",
+			strategy: config.NewStrategy(target, []int64{5, 100}, 2, 30*time.Minute, []config.HealthCriterion{requestCount}),
+			expected: []string{"healthOffsetMinute: health check offset of 2 minutes is not longer than the ingestion delay of Cloud Monitoring (3 minutes), so the diagnoses miss most of the metrics"},
+		},
+		{
+			name:     "time between rollouts shorter than health offset",
+			strategy: config.NewStrategy(target, []int64{5, 100}, 20, 10*time.Minute, []config.HealthCriterion{requestCount}),
+			expected: []string{"timeBetweenRollouts: time between rollouts (10m0s) is shorter than the health check offset (20m0s), so the diagnoses include metrics from before the last step"},
+		},
+		{
+			name:     "no health criteria",
+			strategy: config.NewStrategy(target, []int64{5, 100}, 20, 30*time.Minute, nil),
+			expected: []string{"healthCriteria: no health criteria, candidates with traffic cannot be diagnosed"},
+		},
+		{
+			name:     "no request count criterion",
+			strategy: config.NewStrategy(target, []int64{5, 100}, 20, 30*time.Minute, []config.HealthCriterion{errorRate}),
+			expected: []string{`healthCriteria: no "request-count" criterion, candidates with too few requests can be diagnosed healthy`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var warnings []string
+			for _, warning := range test.strategy.Lint() {
+				warnings = append(warnings, warning.Error())
+			}
+			assert.Equal(tt, test.expected, warnings)
+		})
+	}
+}
+
+func TestConfig_LintShadowedStrategy(t *testing.T) {
+	target := config.NewTarget("myproject", nil, "team=backend")
+	strategy := config.NewStrategy(target, []int64{5, 30, 60}, 20, 30*time.Minute, []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck, Threshold: 100},
+	})
+	conservative := strategy
+	conservative.Priority = 10
+	cfg := config.Config{Strategies: []config.Strategy{strategy, conservative}}
+
+	warnings := cfg.Lint()
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, "strategies[0].target: same target as the strategy at index 1, which takes precedence, so the strategy manages no service", warnings[0].Error())
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	data := `
+strategies:
+- target:
+    project: myproject
+    labelSelector: team=backend
+  steps: [5, 30, 60]
+  healthOffsetMinute: 2
+  timeBetweenRollouts: 10m
+  healthCriteria:
+  - metric: request-count
+    threshold: 100
+`
+	warnings, err := config.LintFile([]byte(data), "")
+	assert.Nil(t, err)
+	assert.Equal(t, []error{&config.FieldError{
+		Field:   "strategies[0].healthOffsetMinute",
+		Line:    7,
+		Message: "health check offset of 2 minutes is not longer than the ingestion delay of Cloud Monitoring (3 minutes), so the diagnoses miss most of the metrics",
+	}}, warnings)
+
+	_, err = config.LintFile([]byte("strategies: []"), "")
+	assert.NotNil(t, err)
+}
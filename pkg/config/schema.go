@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// durationPattern matches the durations accepted by time.ParseDuration.
+const durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaConstraints are the constraints of the fields, by path, that cannot be
+// derived from their types.
+var schemaConstraints = map[string]map[string]interface{}{
+	"strategies":                            {"minItems": 1},
+	"strategies[].steps":                    {"minItems": 1},
+	"strategies[].steps[]":                  {"minimum": 1, "maximum": 100},
+	"strategies[].healthOffsetMinute":       {"minimum": 1},
+	"strategies[].trafficSplitTolerance":    {"minimum": 0, "maximum": 100},
+	"strategies[].consecutiveHealthyChecks": {"minimum": 0},
+	"strategies[].reportFormat":             {"enum": []ReportFormat{TextReportFormat, MarkdownReportFormat, HTMLReportFormat}},
+	"strategies[].protocol":                 {"enum": []Protocol{HTTPProtocol, GRPCProtocol}},
+	"strategies[].onUnhealthy":              {"enum": []UnhealthyAction{RollbackOnUnhealthy, NotifyOnUnhealthy, PauseOnUnhealthy}},
+	"strategies[].target.platform":          {"enum": []Platform{ManagedPlatform, KubernetesPlatform}},
+	"strategies[].healthCriteria[].metric": {"enum": []MetricsCheck{
+		RequestCountMetricsCheck, LatencyMetricsCheck, ErrorRateMetricsCheck, TraceErrorRateMetricsCheck, TraceLatencyMetricsCheck,
+	}},
+	"strategies[].healthCriteria[].percentile":   {"enum": []float64{50, 95, 99}},
+	"strategies[].healthCriteria[].threshold":    {"minimum": 0},
+	"strategies[].probe.expectedStatus":          {"minimum": 100, "maximum": 599},
+	"strategies[].probe.requests":                {"minimum": 1},
+	"strategies[].probe.minSuccessPercent":       {"minimum": 0, "maximum": 100},
+	"strategies[].warmUp.rps":                    {"minimum": 1},
+	"strategies[].shadow.samplePercent":          {"exclusiveMinimum": 0, "maximum": 100},
+	"strategies[].jobCanary.minSuccessPercent":   {"exclusiveMinimum": 0, "maximum": 100},
+	"strategies[].attestation.attestors":         {"minItems": 1},
+	"strategies[].vulnerabilityScan.maxSeverity": {"enum": Severities},
+}
+
+// schemaRequired are the required fields of the objects, by path. Most fields
+// of the strategies are not required in the schema since they can be set by
+// the defaults of the file.
+var schemaRequired = map[string][]string{
+	"strategies[].healthCriteria[]": {"metric"},
+}
+
+// JSONSchema returns the JSON Schema of the YAML configuration file, so
+// editors can validate it before deployment. It is generated from the
+// configuration types, so it is always up to date.
+func JSONSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(file{}), "")
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Cloud Run Release Operator configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of the type of the field at the path.
+func typeSchema(t reflect.Type, path string) map[string]interface{} {
+	schema := make(map[string]interface{})
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		schema["type"] = "string"
+		schema["pattern"] = durationPattern
+	case t.Kind() == reflect.Ptr:
+		return typeSchema(t.Elem(), path)
+	case t.Kind() == reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			properties[name] = typeSchema(field.Type, fieldPath)
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		if required, ok := schemaRequired[canonicalSchemaPath(path)]; ok {
+			schema["required"] = required
+		}
+	case t.Kind() == reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), path+"[]")
+	case t.Kind() == reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), path+"{}")
+	case t.Kind() == reflect.String:
+		schema["type"] = "string"
+	case t.Kind() == reflect.Bool:
+		schema["type"] = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema["type"] = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema["type"] = "number"
+	}
+	for key, value := range schemaConstraints[canonicalSchemaPath(path)] {
+		schema[key] = value
+	}
+	return schema
+}
+
+// canonicalSchemaPath returns the path of the field in the shared strategies
+// for the fields of the defaults and the profiles, so they have the same
+// constraints.
+func canonicalSchemaPath(path string) string {
+	path = strings.TrimPrefix(path, "profiles{}.")
+	if path == "defaults" || strings.HasPrefix(path, "defaults.") {
+		return "strategies[]" + strings.TrimPrefix(path, "defaults")
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package config_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	data, err := config.JSONSchema()
+	assert.Nil(t, err)
+
+	type strategySchema struct {
+		AdditionalProperties bool
+		Properties           map[string]map[string]interface{}
+	}
+	var schema struct {
+		Properties struct {
+			Defaults   strategySchema
+			Strategies struct {
+				Items strategySchema
+			}
+			Profiles struct {
+				AdditionalProperties struct {
+					Properties struct {
+						Defaults strategySchema
+					}
+				}
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(data, &schema))
+
+	strategy := schema.Properties.Strategies.Items
+	assert.False(t, strategy.AdditionalProperties)
+	assert.Equal(t, "string", strategy.Properties["timeBetweenRollouts"]["type"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": float64(1), "maximum": float64(100)}, strategy.Properties["steps"]["items"])
+
+	criterion := strategy.Properties["healthCriteria"]["items"].(map[string]interface{})
+	properties := criterion["properties"].(map[string]interface{})
+	assert.Equal(t, []interface{}{float64(50), float64(95), float64(99)}, properties["percentile"].(map[string]interface{})["enum"])
+	assert.Contains(t, properties["metric"].(map[string]interface{})["enum"], "request-latency")
+	assert.Equal(t, []interface{}{"metric"}, criterion["required"])
+
+	assert.Equal(t, strategy.Properties, schema.Properties.Defaults.Properties)
+	assert.Equal(t, strategy.Properties, schema.Properties.Profiles.AdditionalProperties.Properties.Defaults.Properties)
+}
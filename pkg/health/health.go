@@ -2,6 +2,8 @@ package health
 
 import (
 	"context"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
@@ -46,8 +48,24 @@ type CheckResult struct {
 	Threshold     float64
 	ActualValue   float64
 	IsCriteriaMet bool
+
+	// Reason explains why the criterion could not be evaluated. It is empty
+	// for evaluated criteria.
+	Reason string
+
+	// StableValue is the value of the metrics for the stable revision in the
+	// same window, if it was compared (see CompareWithStable).
+	StableValue *float64
 }
 
+// missingDataReason is the reason for criteria whose metrics could not be
+// attributed to the candidate revision or were not retrieved in time.
+const missingDataReason = "no metrics data for the candidate revision"
+
+// stableDegradedReason is the reason for unmet criteria that the stable
+// revision does not meet either.
+const stableDegradedReason = "stable revision equally degraded"
+
 // Diagnose attempts to determine the health of a revision.
 //
 // If no health criteria is specified or the size of the health criteria and the
@@ -57,6 +75,10 @@ type CheckResult struct {
 // If the minimum number of requests is not met, then health cannot be
 // determined and diagnosis is Inconclusive.
 //
+// If the metrics value for a criterion is missing (NaN) or the traffic split
+// skew exceeds its tolerance, the diagnosis is Inconclusive, unless another
+// criterion is unmet.
+//
 // Otherwise, all metrics criteria are checked to determine whether the revision
 // is healthy or not.
 func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actualValues []float64) (Diagnosis, error) {
@@ -70,6 +92,7 @@ func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actu
 
 	diagnosis := Unknown
 	var results []CheckResult
+	var missingData, skewed bool
 	for i, value := range actualValues {
 		criteria := healthCriteria[i]
 		logger := logger.WithFields(logrus.Fields{
@@ -78,6 +101,13 @@ func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actu
 			"threshold":   criteria.Threshold,
 			"actualValue": value,
 		})
+		if math.IsNaN(value) {
+			logger.Debug("missing metrics data for criterion")
+			missingData = true
+			results = append(results, CheckResult{Threshold: criteria.Threshold, ActualValue: value, Reason: missingDataReason})
+			continue
+		}
+
 		isMet := isCriteriaMet(criteria.Metric, criteria.Threshold, value)
 
 		// For unmet request count, return inconclusive and empty results.
@@ -89,6 +119,16 @@ func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actu
 		}
 
 		result := CheckResult{Threshold: criteria.Threshold, ActualValue: value}
+
+		// A skewed traffic split does not say anything about the candidate's
+		// health, but its metrics might not be representative.
+		if !isMet && criteria.Metric == config.TrafficSplitSkewMetricsCheck {
+			logger.Debug("unmet criterion")
+			skewed = true
+			results = append(results, result)
+			continue
+		}
+
 		if !isMet {
 			logger.Debug("unmet criterion")
 			diagnosis = Unhealthy
@@ -105,45 +145,184 @@ func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actu
 		logger.Debug("met criterion")
 	}
 
+	if (missingData || skewed) && diagnosis != Unhealthy && diagnosis != Inconclusive {
+		diagnosis = Inconclusive
+	}
 	return Diagnosis{diagnosis, results}, nil
 }
 
+// CompareWithStable compares the unhealthy diagnosis of the candidate with
+// the values of the metrics of the stable revision in the same window. If the
+// stable revision does not meet any of the criteria unmet by the candidate
+// either (e.g. during a platform-wide incident), the candidate is not to
+// blame and the diagnosis is Inconclusive. The values of the stable revision
+// are added to the results; the values of missing metrics are NaN.
+func CompareWithStable(healthCriteria []config.HealthCriterion, diagnosis Diagnosis, stableValues []float64) (Diagnosis, error) {
+	if len(diagnosis.CheckResults) != len(stableValues) {
+		return diagnosis, errors.New("the size of the check results is not the same to the size of the stable metrics values")
+	}
+	if diagnosis.OverallResult != Unhealthy {
+		return diagnosis, nil
+	}
+
+	results := make([]CheckResult, len(diagnosis.CheckResults))
+	degraded := true
+	for i, result := range diagnosis.CheckResults {
+		value := stableValues[i]
+		if !math.IsNaN(value) {
+			result.StableValue = &value
+		}
+		if !result.IsCriteriaMet && result.Reason == "" && healthCriteria[i].Metric != config.TrafficSplitSkewMetricsCheck &&
+			(math.IsNaN(value) || isCriteriaMet(healthCriteria[i].Metric, healthCriteria[i].Threshold, value)) {
+			degraded = false
+		}
+		results[i] = result
+	}
+	if !degraded {
+		return Diagnosis{diagnosis.OverallResult, results}, nil
+	}
+	for i, result := range results {
+		if !result.IsCriteriaMet && result.Reason == "" {
+			results[i].Reason = stableDegradedReason
+		}
+	}
+	return Diagnosis{Inconclusive, results}, nil
+}
+
+// Sample is the raw data used to compute the value of a health criterion.
+type Sample struct {
+	Criterion config.HealthCriterion
+
+	// Value is the metrics value for the criterion. It is NaN if the metrics
+	// could not be retrieved.
+	Value float64
+
+	// Offset is the time window of the metrics.
+	Offset time.Duration
+
+	// Queries are the queries sent to the metrics backend, if the provider
+	// records them.
+	Queries []metrics.Query
+}
+
 // CollectMetrics gets a metrics value for each of the given health criteria and
-// returns a result for each criterion.
-func CollectMetrics(ctx context.Context, provider metrics.Provider, offset time.Duration, healthCriteria []config.HealthCriterion) ([]float64, error) {
+// returns a result for each criterion. The metrics are queried concurrently and
+// each query can take up to the given timeout, unless it is zero.
+//
+// If the provider cannot attribute the metrics to the candidate revision or the
+// query times out, the value for the criterion is NaN.
+func CollectMetrics(ctx context.Context, provider metrics.Provider, offset, timeout time.Duration, healthCriteria []config.HealthCriterion) ([]float64, error) {
+	samples, err := CollectSamples(ctx, provider, offset, timeout, healthCriteria)
+	if err != nil {
+		return nil, err
+	}
+	return Values(samples), nil
+}
+
+// CollectSamples is like CollectMetrics, but it also returns the queries used
+// to compute the value of each criterion.
+func CollectSamples(ctx context.Context, provider metrics.Provider, offset, timeout time.Duration, healthCriteria []config.HealthCriterion) ([]Sample, error) {
 	if len(healthCriteria) == 0 {
 		return nil, errors.New("health criteria must be specified")
 	}
-	var metricsValues []float64
-	for _, criteria := range healthCriteria {
-		var metricsValue float64
-		var err error
-
-		switch criteria.Metric {
-		case config.RequestCountMetricsCheck:
-			metricsValue, err = requestCount(ctx, provider, offset)
-		case config.LatencyMetricsCheck:
-			metricsValue, err = latency(ctx, provider, offset, criteria.Percentile)
-		case config.ErrorRateMetricsCheck:
-			metricsValue, err = errorRatePercent(ctx, provider, offset)
-		default:
-			return nil, errors.Errorf("unimplemented metrics %q", criteria.Metric)
-		}
 
+	var wg sync.WaitGroup
+	samples := make([]Sample, len(healthCriteria))
+	errs := make([]error, len(healthCriteria))
+	for i, criteria := range healthCriteria {
+		wg.Add(1)
+		go func(i int, criteria config.HealthCriterion) {
+			defer wg.Done()
+			recorder := metrics.NewRecorder()
+			ctx := metrics.ContextWithRecorder(ctx, recorder)
+			value, err := collectMetricWithTimeout(ctx, provider, offset, timeout, criteria)
+			samples[i] = Sample{Criterion: criteria, Value: value, Offset: offset, Queries: recorder.Queries()}
+			errs[i] = err
+		}(i, criteria)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		criteria := healthCriteria[i]
+		logger := util.LoggerFrom(ctx).WithField("metrics", criteria.Metric)
+		if errors.Is(err, metrics.ErrMissingRevisionData) {
+			logger.Warnf("ignoring metrics: %v", err)
+			samples[i].Value, err = math.NaN(), nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			logger.WithField("timeout", timeout).Warn("ignoring metrics, query timed out")
+			samples[i].Value, err = math.NaN(), nil
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to obtain metrics %q", criteria.Metric)
 		}
-		metricsValues = append(metricsValues, metricsValue)
 	}
 
-	return metricsValues, nil
+	return samples, nil
+}
+
+// Values returns the metrics value of each sample.
+func Values(samples []Sample) []float64 {
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	return values
+}
+
+// collectMetricWithTimeout gets the metrics value for the criterion. If the
+// query takes longer than the timeout, context.DeadlineExceeded is returned
+// even if the provider does not honor the context.
+func collectMetricWithTimeout(ctx context.Context, provider metrics.Provider, offset, timeout time.Duration, criteria config.HealthCriterion) (float64, error) {
+	if timeout <= 0 {
+		return collectMetric(ctx, provider, offset, criteria)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		value float64
+		err   error
+	}
+	// The channel is buffered so that the query does not block if it finishes
+	// after the timeout.
+	done := make(chan result, 1)
+	go func() {
+		value, err := collectMetric(ctx, provider, offset, criteria)
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// collectMetric gets the metrics value for the criterion.
+func collectMetric(ctx context.Context, provider metrics.Provider, offset time.Duration, criteria config.HealthCriterion) (float64, error) {
+	switch criteria.Metric {
+	case config.RequestCountMetricsCheck:
+		return requestCount(ctx, provider, offset)
+	case config.LatencyMetricsCheck:
+		return latency(ctx, provider, offset, criteria.Percentile)
+	case config.ErrorRateMetricsCheck:
+		return errorRatePercent(ctx, provider, offset)
+	case config.TraceErrorRateMetricsCheck:
+		return spanErrorRatePercent(ctx, provider, offset, criteria.Operation)
+	case config.TraceLatencyMetricsCheck:
+		return spanLatency(ctx, provider, offset, criteria.Operation, criteria.Percentile)
+	default:
+		return 0, errors.Errorf("unimplemented metrics %q", criteria.Metric)
+	}
 }
 
 // isCriteriaMet concludes if metrics criteria was met.
 func isCriteriaMet(metricsType config.MetricsCheck, threshold float64, actualValue float64) bool {
-	// Of all the supported metrics, only the threshold for request count has an
-	// expected minimum value.
-	if metricsType == config.RequestCountMetricsCheck {
+	// Of all the supported metrics, only the thresholds for request count and
+	// probe and job success rates have an expected minimum value.
+	switch metricsType {
+	case config.RequestCountMetricsCheck, config.ProbeSuccessRateMetricsCheck, config.JobSuccessRateMetricsCheck:
 		return actualValue >= threshold
 	}
 	return actualValue <= threshold
@@ -189,3 +368,54 @@ func errorRatePercent(ctx context.Context, provider metrics.Provider, offset tim
 	logger.WithField("value", rate).Debug("error rate successfully retrieved")
 	return rate, nil
 }
+
+// spanProvider returns the span provider implemented by the metrics provider.
+func spanProvider(provider metrics.Provider) (metrics.SpanProvider, error) {
+	spans, ok := provider.(metrics.SpanProvider)
+	if !ok {
+		return nil, errors.New("metrics provider does not support trace metrics")
+	}
+	return spans, nil
+}
+
+// spanErrorRatePercent returns the percentage of spans for the operation with
+// errors during the given offset.
+func spanErrorRatePercent(ctx context.Context, provider metrics.Provider, offset time.Duration, operation string) (float64, error) {
+	spans, err := spanProvider(provider)
+	if err != nil {
+		return 0, err
+	}
+
+	logger := util.LoggerFrom(ctx).WithField("operation", operation)
+	logger.Debug("querying for span error rate")
+	rate, err := spans.SpanErrorRate(ctx, offset, operation)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get span error rate")
+	}
+
+	rate *= 100
+	logger.WithField("value", rate).Debug("span error rate successfully retrieved")
+	return rate, nil
+}
+
+// spanLatency returns the duration of the spans for the operation for the
+// given offset and percentile.
+func spanLatency(ctx context.Context, provider metrics.Provider, offset time.Duration, operation string, percentile float64) (float64, error) {
+	spans, err := spanProvider(provider)
+	if err != nil {
+		return 0, err
+	}
+	alignerReducer, err := metrics.PercentileToAlignReduce(percentile)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse percentile")
+	}
+
+	logger := util.LoggerFrom(ctx).WithFields(logrus.Fields{"operation": operation, "percentile": percentile})
+	logger.Debug("querying for span latency")
+	latency, err := spans.SpanLatency(ctx, offset, operation, alignerReducer)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get span latency")
+	}
+	logger.WithField("value", latency).Debug("span latency successfully retrieved")
+	return latency, nil
+}
@@ -57,6 +57,20 @@ func TestIsCriteriaMet(t *testing.T) {
 			actualValue: 1.01,
 			expected:    false,
 		},
+		{
+			name:        "met probe success rate",
+			metricsType: config.ProbeSuccessRateMetricsCheck,
+			threshold:   90,
+			actualValue: 100,
+			expected:    true,
+		},
+		{
+			name:        "unmet probe success rate",
+			metricsType: config.ProbeSuccessRateMetricsCheck,
+			threshold:   90,
+			actualValue: 80,
+			expected:    false,
+		},
 	}
 
 	for _, test := range tests {
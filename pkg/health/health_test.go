@@ -2,13 +2,17 @@ package health_test
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -131,6 +135,36 @@ func TestDiagnosis(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "skewed traffic split, inconclusive",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+				{Metric: config.TrafficSplitSkewMetricsCheck, Threshold: 10},
+			},
+			results: []float64{1.0, 25.0},
+			expected: health.Diagnosis{
+				OverallResult: health.Inconclusive,
+				CheckResults: []health.CheckResult{
+					{Threshold: 5, ActualValue: 1.0, IsCriteriaMet: true},
+					{Threshold: 10, ActualValue: 25.0},
+				},
+			},
+		},
+		{
+			name: "skewed traffic split, unhealthy revision",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+				{Metric: config.TrafficSplitSkewMetricsCheck, Threshold: 10},
+			},
+			results: []float64{10.0, 25.0},
+			expected: health.Diagnosis{
+				OverallResult: health.Unhealthy,
+				CheckResults: []health.CheckResult{
+					{Threshold: 5, ActualValue: 10.0},
+					{Threshold: 10, ActualValue: 25.0},
+				},
+			},
+		},
 		{
 			name: "should err, different sizes for criteria and results",
 			healthCriteria: []config.HealthCriterion{
@@ -181,7 +215,241 @@ func TestCollectMetrics(t *testing.T) {
 	}
 	expected := []float64{1000, 500.0, 1.0}
 
-	results, err := health.CollectMetrics(ctx, metricsMock, offset, healthCriteria)
+	results, err := health.CollectMetrics(ctx, metricsMock, offset, 0, healthCriteria)
 	assert.Nil(t, err)
 	assert.Equal(t, expected, results)
 }
+
+func TestDiagnosis_MissingData(t *testing.T) {
+	tests := []struct {
+		name           string
+		healthCriteria []config.HealthCriterion
+		results        []float64
+		expected       health.DiagnosisResult
+	}{
+		{
+			name: "missing data, inconclusive",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			results:  []float64{500, math.NaN()},
+			expected: health.Inconclusive,
+		},
+		{
+			name: "missing data and unmet criterion, unhealthy",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			results:  []float64{1000, math.NaN()},
+			expected: health.Unhealthy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			diagnosis, err := health.Diagnose(context.Background(), test.healthCriteria, test.results)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, diagnosis.OverallResult)
+			assert.Len(tt, diagnosis.CheckResults, len(test.results))
+
+			missing := diagnosis.CheckResults[1]
+			assert.True(tt, math.IsNaN(missing.ActualValue))
+			assert.False(tt, missing.IsCriteriaMet)
+			assert.NotEmpty(tt, missing.Reason)
+		})
+	}
+}
+
+func TestCompareWithStable(t *testing.T) {
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+	}
+	tests := []struct {
+		name         string
+		results      []float64
+		stableValues []float64
+		expected     health.DiagnosisResult
+	}{
+		{
+			name:         "stable equally degraded, inconclusive",
+			results:      []float64{500, 20},
+			stableValues: []float64{400, 18},
+			expected:     health.Inconclusive,
+		},
+		{
+			name:         "stable healthy, unhealthy",
+			results:      []float64{500, 20},
+			stableValues: []float64{400, 1},
+			expected:     health.Unhealthy,
+		},
+		{
+			name:         "stable degraded on other criteria only, unhealthy",
+			results:      []float64{1000, 20},
+			stableValues: []float64{1000, 1},
+			expected:     health.Unhealthy,
+		},
+		{
+			name:         "stable metrics missing, unhealthy",
+			results:      []float64{500, 20},
+			stableValues: []float64{400, math.NaN()},
+			expected:     health.Unhealthy,
+		},
+		{
+			name:         "healthy candidate, unchanged",
+			results:      []float64{500, 1},
+			stableValues: []float64{400, 18},
+			expected:     health.Healthy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			diagnosis, err := health.Diagnose(context.Background(), healthCriteria, test.results)
+			assert.Nil(tt, err)
+			diagnosis, err = health.CompareWithStable(healthCriteria, diagnosis, test.stableValues)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, diagnosis.OverallResult)
+			if test.expected == health.Healthy {
+				assert.Nil(tt, diagnosis.CheckResults[0].StableValue)
+				return
+			}
+
+			errorRate := diagnosis.CheckResults[1]
+			assert.Equal(tt, test.results[1], errorRate.ActualValue)
+			if math.IsNaN(test.stableValues[1]) {
+				assert.Nil(tt, errorRate.StableValue)
+			} else if assert.NotNil(tt, errorRate.StableValue) {
+				assert.Equal(tt, test.stableValues[1], *errorRate.StableValue)
+			}
+			assert.Equal(tt, test.expected == health.Inconclusive, errorRate.Reason != "")
+		})
+	}
+
+	_, err := health.CompareWithStable(healthCriteria, health.Diagnosis{OverallResult: health.Unhealthy}, []float64{1, 2})
+	assert.NotNil(t, err)
+}
+
+// TestCollectMetrics_MissingRevisionData tests that metrics that cannot be
+// attributed to the candidate revision are NaN.
+func TestCollectMetrics_MissingRevisionData(t *testing.T) {
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 1000, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0, errors.Wrap(metrics.ErrMissingRevisionData, "no time series")
+	}
+
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck},
+		{Metric: config.ErrorRateMetricsCheck},
+	}
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	results, err := health.CollectMetrics(ctx, metricsMock, 5*time.Minute, 0, healthCriteria)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000.0, results[0])
+	assert.True(t, math.IsNaN(results[1]))
+}
+
+// TestCollectMetrics_Timeout tests that metrics are queried concurrently and
+// that the metrics whose query times out are NaN.
+func TestCollectMetrics_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 1000, nil
+	}
+	metricsMock.LatencyFn = func(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+		// The provider does not honor the context.
+		<-release
+		return 500, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck},
+		{Metric: config.LatencyMetricsCheck, Percentile: 99},
+		{Metric: config.ErrorRateMetricsCheck},
+	}
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	start := time.Now()
+	results, err := health.CollectMetrics(ctx, metricsMock, 5*time.Minute, 50*time.Millisecond, healthCriteria)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 1000.0, results[0])
+	assert.True(t, math.IsNaN(results[1]))
+	assert.True(t, math.IsNaN(results[2]))
+
+	// Other errors are returned.
+	failingMock := &metricsMocker.Metrics{}
+	failingMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0, errors.New("backend unavailable")
+	}
+	_, err = health.CollectMetrics(ctx, failingMock, 5*time.Minute, 50*time.Millisecond, healthCriteria[2:])
+	assert.NotNil(t, err)
+}
+
+// TestCollectSamples tests that the queries recorded by the provider are
+// attributed to each criterion.
+func TestCollectSamples(t *testing.T) {
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		metrics.RecordQuery(ctx, metrics.Query{Query: "request_count"})
+		return 1000, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		metrics.RecordQuery(ctx, metrics.Query{Query: "error_rate"})
+		return 0, metrics.ErrMissingRevisionData
+	}
+
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck},
+		{Metric: config.ErrorRateMetricsCheck},
+	}
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	samples, err := health.CollectSamples(ctx, metricsMock, 5*time.Minute, 0, healthCriteria)
+	assert.Nil(t, err)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, health.Sample{
+		Criterion: healthCriteria[0],
+		Value:     1000,
+		Offset:    5 * time.Minute,
+		Queries:   []metrics.Query{{Query: "request_count"}},
+	}, samples[0])
+	assert.True(t, math.IsNaN(samples[1].Value))
+	assert.Equal(t, []metrics.Query{{Query: "error_rate"}}, samples[1].Queries)
+}
+
+// TestCollectMetrics_Traces tests that trace criteria are collected from the
+// span provider.
+func TestCollectMetrics_Traces(t *testing.T) {
+	spansMock := &metricsMocker.Spans{}
+	spansMock.SpanErrorRateFn = func(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+		assert.Equal(t, "db.query", operation)
+		return 0.02, nil
+	}
+	spansMock.SpanLatencyFn = func(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+		assert.Equal(t, metrics.Align95Reduce95, alignReduceType)
+		return 120, nil
+	}
+
+	ctx := util.ContextWithLogger(context.Background(), logrus.NewEntry(logrus.New()))
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.TraceErrorRateMetricsCheck, Operation: "db.query"},
+		{Metric: config.TraceLatencyMetricsCheck, Operation: "db.query", Percentile: 95},
+	}
+	results, err := health.CollectMetrics(ctx, spansMock, 5*time.Minute, 0, healthCriteria)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{2, 120}, results)
+
+	// Providers without span metrics cannot evaluate trace criteria.
+	_, err = health.CollectMetrics(ctx, &metricsMocker.Metrics{}, 5*time.Minute, 0, healthCriteria)
+	assert.NotNil(t, err)
+}
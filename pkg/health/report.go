@@ -1,11 +1,75 @@
 package health
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
 )
 
+// Report is the machine-readable report of a diagnosis.
+type Report struct {
+	Status string `json:"status"`
+
+	// Message explains the status when the candidate was not diagnosed.
+	Message string        `json:"message,omitempty"`
+	Checks  []CheckReport `json:"checks"`
+
+	// Window is the time window of the metrics used for the diagnosis.
+	Window string `json:"window,omitempty"`
+
+	// Candidate is the diagnosed revision and TrafficStep the percentage of
+	// traffic assigned to it after the diagnosis.
+	Candidate   string    `json:"candidate"`
+	TrafficStep int64     `json:"trafficStep"`
+	LastUpdate  time.Time `json:"lastUpdate"`
+
+	// Image is the container image of the candidate pinned to its digest,
+	// and CommitSHA and BuildURL the commit and the build it comes from, if
+	// known.
+	Image     string `json:"image,omitempty"`
+	CommitSHA string `json:"commitSha,omitempty"`
+	BuildURL  string `json:"buildUrl,omitempty"`
+
+	// Truncated is set if the report was truncated to fit in an annotation,
+	// in which case FullReport is the location of the full report, if it is
+	// archived.
+	Truncated  bool   `json:"truncated,omitempty"`
+	FullReport string `json:"fullReport,omitempty"`
+}
+
+// CheckReport is the machine-readable result of a criterion check.
+type CheckReport struct {
+	Criterion  string              `json:"criterion"`
+	Metric     config.MetricsCheck `json:"metric"`
+	Percentile float64             `json:"percentile,omitempty"`
+	Operation  string              `json:"operation,omitempty"`
+	Threshold  float64             `json:"threshold"`
+
+	// ActualValue is null if the metrics value is missing. StableValue is
+	// the value of the stable revision, if it was compared.
+	ActualValue   *float64 `json:"actualValue"`
+	StableValue   *float64 `json:"stableValue,omitempty"`
+	IsCriteriaMet bool     `json:"isCriteriaMet"`
+	Reason        string   `json:"reason,omitempty"`
+}
+
+// sampleRecord is the JSON representation of a sample.
+type sampleRecord struct {
+	Criterion string          `json:"criterion"`
+	Threshold float64         `json:"threshold"`
+	Value     *float64        `json:"value"`
+	Window    string          `json:"window"`
+	Queries   []metrics.Query `json:"queries"`
+}
+
 // StringReport returns a human-readable report of the diagnosis.
 func StringReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis) string {
 	report := fmt.Sprintf("status: %s\n", diagnosis.OverallResult.String())
@@ -13,9 +77,8 @@ func StringReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis)
 	for i, result := range diagnosis.CheckResults {
 		criteria := healthCriteria[i]
 
-		// Include percentile value for latency criteria.
-		if criteria.Metric == config.LatencyMetricsCheck {
-			report += fmt.Sprintf("\n- %s[p%.0f]: %.2f (needs %.2f)", criteria.Metric, criteria.Percentile, result.ActualValue, criteria.Threshold)
+		if result.Reason == missingDataReason {
+			report += fmt.Sprintf("\n- %s: %s", criteriaName(criteria), result.Reason)
 			continue
 		}
 
@@ -24,8 +87,296 @@ func StringReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis)
 			// No decimals for request count.
 			format = "\n- %s: %.0f (needs %.0f)"
 		}
-		report += fmt.Sprintf(format, criteria.Metric, result.ActualValue, criteria.Threshold)
+		report += fmt.Sprintf(format, criteriaName(criteria), result.ActualValue, criteria.Threshold)
+		if result.StableValue != nil {
+			report += fmt.Sprintf(" (stable: %s)", formatValue(criteria.Metric, *result.StableValue))
+		}
+		if result.Reason != "" {
+			report += ": " + result.Reason
+		}
 	}
 
 	return report
 }
+
+// NewReport returns the machine-readable report of the diagnosis. The rollout
+// information (e.g. the traffic step) is left for the caller to fill.
+func NewReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis) Report {
+	report := Report{
+		Status: diagnosis.OverallResult.String(),
+		Checks: make([]CheckReport, 0, len(diagnosis.CheckResults)),
+	}
+	for i, result := range diagnosis.CheckResults {
+		criteria := healthCriteria[i]
+		check := CheckReport{
+			Criterion:     criteriaName(criteria),
+			Metric:        criteria.Metric,
+			Percentile:    criteria.Percentile,
+			Operation:     criteria.Operation,
+			Threshold:     criteria.Threshold,
+			IsCriteriaMet: result.IsCriteriaMet,
+			Reason:        result.Reason,
+			StableValue:   result.StableValue,
+		}
+		if !math.IsNaN(result.ActualValue) {
+			value := result.ActualValue
+			check.ActualValue = &value
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// JSON returns the JSON encoding of the report.
+func (report Report) JSON() (string, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal report")
+	}
+	return string(data), nil
+}
+
+// FailedChecks returns a summary of the checks whose criterion was not met.
+func (report Report) FailedChecks() []string {
+	var failed []string
+	for _, check := range report.Checks {
+		if check.IsCriteriaMet || check.Reason != "" {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s (needs %s)", check.Criterion, check.value(), check.threshold()))
+	}
+	return failed
+}
+
+// RenderReport renders the report in Markdown or HTML. The steps of the
+// strategy are used to show the candidate's progress in a traffic timeline.
+func RenderReport(format config.ReportFormat, report Report, steps []int64) (string, error) {
+	switch format {
+	case config.MarkdownReportFormat:
+		return markdownReport(report, steps), nil
+	case config.HTMLReportFormat:
+		return htmlReport(report, steps)
+	default:
+		return "", errors.Errorf("unsupported report format %q", format)
+	}
+}
+
+// markdownReport renders the report in Markdown.
+func markdownReport(report Report, steps []int64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Status:** %s\n\n", report.Status)
+	if report.Message != "" {
+		fmt.Fprintf(&b, "%s\n\n", report.Message)
+	}
+	if report.Candidate != "" {
+		fmt.Fprintf(&b, "**Candidate:** `%s` (%d%% of traffic)\n\n", report.Candidate, report.TrafficStep)
+	}
+	if report.Image != "" {
+		fmt.Fprintf(&b, "**Image:** `%s`\n\n", report.Image)
+	}
+	if report.CommitSHA != "" || report.BuildURL != "" {
+		var build []string
+		if report.CommitSHA != "" {
+			build = append(build, fmt.Sprintf("commit `%s`", report.CommitSHA))
+		}
+		if report.BuildURL != "" {
+			build = append(build, fmt.Sprintf("[build](%s)", report.BuildURL))
+		}
+		fmt.Fprintf(&b, "**Build:** %s\n\n", strings.Join(build, ", "))
+	}
+
+	var timeline []string
+	for _, step := range trafficTimeline(report, steps) {
+		switch {
+		case step.current:
+			timeline = append(timeline, fmt.Sprintf("**%d%%**", step.percent))
+		case step.done:
+			timeline = append(timeline, fmt.Sprintf("✓ %d%%", step.percent))
+		default:
+			timeline = append(timeline, fmt.Sprintf("%d%%", step.percent))
+		}
+	}
+	fmt.Fprintf(&b, "**Traffic:** %s\n\n", strings.Join(timeline, " → "))
+
+	if len(report.Checks) != 0 {
+		window := ""
+		if report.Window != "" {
+			window = fmt.Sprintf(" (last %s)", report.Window)
+		}
+		fmt.Fprintf(&b, "**Checks%s:**\n\n", window)
+		b.WriteString("| Criterion | Value | Threshold | Result |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, check := range report.Checks {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownEscape(check.Criterion),
+				check.value(), check.threshold(), markdownEscape(check.result()))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "_Last update: %s_", report.LastUpdate.Format(time.RFC3339))
+	return b.String()
+}
+
+// markdownEscape escapes the characters that would break a table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<p><strong>Status:</strong> {{.Report.Status}}</p>
+{{- if .Report.Message}}
+<p>{{.Report.Message}}</p>
+{{- end}}
+{{- if .Report.Candidate}}
+<p><strong>Candidate:</strong> <code>{{.Report.Candidate}}</code> ({{.Report.TrafficStep}}% of traffic)</p>
+{{- end}}
+{{- if .Report.Image}}
+<p><strong>Image:</strong> <code>{{.Report.Image}}</code></p>
+{{- end}}
+{{- if or .Report.CommitSHA .Report.BuildURL}}
+<p><strong>Build:</strong>{{if .Report.CommitSHA}} commit <code>{{.Report.CommitSHA}}</code>{{end}}{{if .Report.BuildURL}}{{if .Report.CommitSHA}},{{end}} <a href="{{.Report.BuildURL}}">build</a>{{end}}</p>
+{{- end}}
+<p><strong>Traffic:</strong>
+{{- range $i, $step := .Timeline}}{{if $i}} &rarr;{{end}} {{if $step.Current}}<strong>{{$step.Percent}}%</strong>{{else if $step.Done}}&#10003; {{$step.Percent}}%{{else}}{{$step.Percent}}%{{end}}{{end}}</p>
+{{- if .Checks}}
+<table>
+<tr><th>Criterion</th><th>Value</th><th>Threshold</th><th>Result</th></tr>
+{{- range .Checks}}
+<tr><td>{{.Criterion}}</td><td>{{.Value}}</td><td>{{.Threshold}}</td><td>{{.Result}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<p><em>Last update: {{.LastUpdate}}</em></p>`))
+
+// htmlReport renders the report in HTML.
+func htmlReport(report Report, steps []int64) (string, error) {
+	type htmlCheck struct {
+		Criterion, Value, Threshold, Result string
+	}
+	type htmlStep struct {
+		Percent       int64
+		Done, Current bool
+	}
+	data := struct {
+		Report     Report
+		Timeline   []htmlStep
+		Checks     []htmlCheck
+		LastUpdate string
+	}{Report: report, LastUpdate: report.LastUpdate.Format(time.RFC3339)}
+	for _, step := range trafficTimeline(report, steps) {
+		data.Timeline = append(data.Timeline, htmlStep{Percent: step.percent, Done: step.done, Current: step.current})
+	}
+	for _, check := range report.Checks {
+		data.Checks = append(data.Checks, htmlCheck{
+			Criterion: check.Criterion,
+			Value:     check.value(),
+			Threshold: check.threshold(),
+			Result:    check.result(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "failed to render HTML report")
+	}
+	return buf.String(), nil
+}
+
+// timelineStep is a step of the traffic timeline.
+type timelineStep struct {
+	percent int64
+	done    bool
+	current bool
+}
+
+// trafficTimeline returns the steps of the rollout, up to 100%, marking the
+// steps the candidate went through and the one it is at.
+func trafficTimeline(report Report, steps []int64) []timelineStep {
+	if len(steps) == 0 || steps[len(steps)-1] != 100 {
+		steps = append(append([]int64(nil), steps...), 100)
+	}
+	var timeline []timelineStep
+	for _, step := range steps {
+		timeline = append(timeline, timelineStep{
+			percent: step,
+			done:    step < report.TrafficStep,
+			current: step == report.TrafficStep,
+		})
+	}
+	return timeline
+}
+
+// value returns the formatted value of the check.
+func (check CheckReport) value() string {
+	if check.ActualValue == nil {
+		return "-"
+	}
+	if check.StableValue != nil {
+		return fmt.Sprintf("%s (stable: %s)", formatValue(check.Metric, *check.ActualValue), formatValue(check.Metric, *check.StableValue))
+	}
+	return formatValue(check.Metric, *check.ActualValue)
+}
+
+// threshold returns the formatted threshold of the check.
+func (check CheckReport) threshold() string {
+	return formatValue(check.Metric, check.Threshold)
+}
+
+// result returns the outcome of the check.
+func (check CheckReport) result() string {
+	if check.Reason != "" {
+		return check.Reason
+	}
+	if check.IsCriteriaMet {
+		return "met"
+	}
+	return "not met"
+}
+
+// formatValue formats the value of a metric.
+func formatValue(metric config.MetricsCheck, value float64) string {
+	if metric == config.RequestCountMetricsCheck {
+		// No decimals for request count.
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// criteriaName returns the name of the criteria as shown in the report.
+func criteriaName(criteria config.HealthCriterion) string {
+	switch criteria.Metric {
+	case config.LatencyMetricsCheck:
+		// Include percentile value for latency criteria.
+		return fmt.Sprintf("%s[p%.0f]", criteria.Metric, criteria.Percentile)
+	case config.TraceLatencyMetricsCheck:
+		return fmt.Sprintf("%s[%s,p%.0f]", criteria.Metric, criteria.Operation, criteria.Percentile)
+	case config.TraceErrorRateMetricsCheck:
+		return fmt.Sprintf("%s[%s]", criteria.Metric, criteria.Operation)
+	default:
+		return string(criteria.Metric)
+	}
+}
+
+// SamplesReport returns a JSON report of the raw data used for a diagnosis. The
+// value of samples with missing metrics is null.
+func SamplesReport(samples []Sample) (string, error) {
+	records := make([]sampleRecord, 0, len(samples))
+	for _, sample := range samples {
+		record := sampleRecord{
+			Criterion: criteriaName(sample.Criterion),
+			Threshold: sample.Criterion.Threshold,
+			Window:    sample.Offset.String(),
+			Queries:   sample.Queries,
+		}
+		if !math.IsNaN(sample.Value) {
+			value := sample.Value
+			record.Value = &value
+		}
+		records = append(records, record)
+	}
+
+	report, err := json.Marshal(records)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal samples")
+	}
+	return string(report), nil
+}
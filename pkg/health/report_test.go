@@ -1,8 +1,11 @@
 package health_test
 
 import (
+	"math"
 	"testing"
+	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
 	"github.com/stretchr/testify/assert"
@@ -51,6 +54,60 @@ func TestStringReport(t *testing.T) {
 				"\n- request-latency[p99]: 500.00 (needs 750.00)" +
 				"\n- error-rate-percent: 2.00 (needs 5.00)",
 		},
+		{
+			name: "missing metrics data",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			diagnosis: health.Diagnosis{
+				OverallResult: health.Inconclusive,
+				CheckResults: []health.CheckResult{
+					{Threshold: 750, ActualValue: 500, IsCriteriaMet: true},
+					{Threshold: 5, Reason: "no metrics data for the candidate revision"},
+				},
+			},
+			expected: "status: inconclusive\n" +
+				"metrics:" +
+				"\n- request-latency[p99]: 500.00 (needs 750.00)" +
+				"\n- error-rate-percent: no metrics data for the candidate revision",
+		},
+		{
+			name: "trace metrics",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.TraceErrorRateMetricsCheck, Operation: "db.query", Threshold: 1},
+				{Metric: config.TraceLatencyMetricsCheck, Operation: "db.query", Percentile: 95, Threshold: 100},
+			},
+			diagnosis: health.Diagnosis{
+				OverallResult: health.Unhealthy,
+				CheckResults: []health.CheckResult{
+					{Threshold: 1, ActualValue: 0.5, IsCriteriaMet: true},
+					{Threshold: 100, ActualValue: 150},
+				},
+			},
+			expected: "status: unhealthy\n" +
+				"metrics:" +
+				"\n- trace-error-rate-percent[db.query]: 0.50 (needs 1.00)" +
+				"\n- trace-latency[db.query,p95]: 150.00 (needs 100.00)",
+		},
+		{
+			name: "compared with stable",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			diagnosis: health.Diagnosis{
+				OverallResult: health.Inconclusive,
+				CheckResults: []health.CheckResult{
+					{Threshold: 750, ActualValue: 500, IsCriteriaMet: true, StableValue: floatPtr(400)},
+					{Threshold: 5, ActualValue: 20, Reason: "stable revision equally degraded", StableValue: floatPtr(18)},
+				},
+			},
+			expected: "status: inconclusive\n" +
+				"metrics:" +
+				"\n- request-latency[p99]: 500.00 (needs 750.00) (stable: 400.00)" +
+				"\n- error-rate-percent: 20.00 (needs 5.00) (stable: 18.00): stable revision equally degraded",
+		},
 		{
 			name:     "no metrics",
 			expected: "status: unknown\nmetrics:",
@@ -64,3 +121,160 @@ func TestStringReport(t *testing.T) {
 		})
 	}
 }
+
+func TestSamplesReport(t *testing.T) {
+	end := time.Date(2020, 7, 1, 10, 30, 0, 0, time.UTC)
+	samples := []health.Sample{
+		{
+			Criterion: config.HealthCriterion{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+			Value:     500,
+			Offset:    30 * time.Minute,
+			Queries:   []metrics.Query{{Query: "latency", Start: end.Add(-30 * time.Minute), End: end}},
+		},
+		{
+			Criterion: config.HealthCriterion{Metric: config.ErrorRateMetricsCheck, Threshold: 1},
+			Value:     math.NaN(),
+			Offset:    30 * time.Minute,
+		},
+	}
+	expected := `[{"criterion":"request-latency[p99]","threshold":750,"value":500,"window":"30m0s",` +
+		`"queries":[{"query":"latency","start":"2020-07-01T10:00:00Z","end":"2020-07-01T10:30:00Z"}]},` +
+		`{"criterion":"error-rate-percent","threshold":1,"value":null,"window":"30m0s","queries":null}]`
+
+	report, err := health.SamplesReport(samples)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, report)
+}
+
+func TestNewReport(t *testing.T) {
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+	}
+	diagnosis := health.Diagnosis{
+		OverallResult: health.Inconclusive,
+		CheckResults: []health.CheckResult{
+			{Threshold: 750, ActualValue: 500, IsCriteriaMet: true},
+			{Threshold: 5, ActualValue: math.NaN(), Reason: "no metrics data for the candidate revision"},
+		},
+	}
+	expected := `{"status":"inconclusive","checks":[` +
+		`{"criterion":"request-latency[p99]","metric":"request-latency","percentile":99,"threshold":750,"actualValue":500,"isCriteriaMet":true},` +
+		`{"criterion":"error-rate-percent","metric":"error-rate-percent","threshold":5,"actualValue":null,"isCriteriaMet":false,"reason":"no metrics data for the candidate revision"}],` +
+		`"candidate":"","trafficStep":0,"lastUpdate":"0001-01-01T00:00:00Z"}`
+
+	report, err := health.NewReport(healthCriteria, diagnosis).JSON()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, report)
+}
+
+func TestRenderReport(t *testing.T) {
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck, Threshold: 100},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+	}
+	diagnosis := health.Diagnosis{
+		OverallResult: health.Inconclusive,
+		CheckResults: []health.CheckResult{
+			{Threshold: 100, ActualValue: 250, IsCriteriaMet: true},
+			{Threshold: 5, ActualValue: math.NaN(), Reason: "no data | missing"},
+		},
+	}
+	report := health.NewReport(healthCriteria, diagnosis)
+	report.Candidate = "test-002"
+	report.TrafficStep = 20
+	report.Window = "5m0s"
+	report.LastUpdate = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	steps := []int64{5, 20, 50}
+
+	tests := []struct {
+		name     string
+		format   config.ReportFormat
+		report   health.Report
+		expected string
+	}{
+		{
+			name:   "markdown",
+			format: config.MarkdownReportFormat,
+			report: report,
+			expected: "**Status:** inconclusive\n\n" +
+				"**Candidate:** `test-002` (20% of traffic)\n\n" +
+				"**Traffic:** ✓ 5% → **20%** → 50% → 100%\n\n" +
+				"**Checks (last 5m0s):**\n\n" +
+				"| Criterion | Value | Threshold | Result |\n" +
+				"| --- | --- | --- | --- |\n" +
+				"| request-count | 250 | 100 | met |\n" +
+				"| error-rate-percent | - | 5.00 | no data \\| missing |\n\n" +
+				"_Last update: 2020-06-01T00:00:00Z_",
+		},
+		{
+			name:   "markdown message only",
+			format: config.MarkdownReportFormat,
+			report: health.Report{Status: "unknown", Message: "new candidate, no health report available yet"},
+			expected: "**Status:** unknown\n\n" +
+				"new candidate, no health report available yet\n\n" +
+				"**Traffic:** 5% → 20% → 50% → 100%\n\n" +
+				"_Last update: 0001-01-01T00:00:00Z_",
+		},
+		{
+			name:   "html",
+			format: config.HTMLReportFormat,
+			report: report,
+			expected: "<p><strong>Status:</strong> inconclusive</p>\n" +
+				"<p><strong>Candidate:</strong> <code>test-002</code> (20% of traffic)</p>\n" +
+				"<p><strong>Traffic:</strong> &#10003; 5% &rarr; <strong>20%</strong> &rarr; 50% &rarr; 100%</p>\n" +
+				"<table>\n" +
+				"<tr><th>Criterion</th><th>Value</th><th>Threshold</th><th>Result</th></tr>\n" +
+				"<tr><td>request-count</td><td>250</td><td>100</td><td>met</td></tr>\n" +
+				"<tr><td>error-rate-percent</td><td>-</td><td>5.00</td><td>no data | missing</td></tr>\n" +
+				"</table>\n" +
+				"<p><em>Last update: 2020-06-01T00:00:00Z</em></p>",
+		},
+		{
+			name:   "html escapes values",
+			format: config.HTMLReportFormat,
+			report: health.Report{Status: "unknown", Message: "<script>"},
+			expected: "<p><strong>Status:</strong> unknown</p>\n" +
+				"<p>&lt;script&gt;</p>\n" +
+				"<p><strong>Traffic:</strong> 5% &rarr; 20% &rarr; 50% &rarr; 100%</p>\n" +
+				"<p><em>Last update: 0001-01-01T00:00:00Z</em></p>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			rendered, err := health.RenderReport(test.format, test.report, steps)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, rendered)
+		})
+	}
+
+	_, err := health.RenderReport(config.TextReportFormat, report, steps)
+	assert.NotNil(t, err)
+}
+
+func TestReport_FailedChecks(t *testing.T) {
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck, Threshold: 1000},
+		{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+	}
+	diagnosis := health.Diagnosis{
+		OverallResult: health.Unhealthy,
+		CheckResults: []health.CheckResult{
+			{Threshold: 1000, ActualValue: 500, IsCriteriaMet: false},
+			{Threshold: 750, ActualValue: 1000, IsCriteriaMet: false},
+			{Threshold: 5, ActualValue: math.NaN(), Reason: "no metrics data for the candidate revision"},
+		},
+	}
+
+	failed := health.NewReport(healthCriteria, diagnosis).FailedChecks()
+	assert.Equal(t, []string{
+		"request-count: 500 (needs 1000)",
+		"request-latency[p99]: 1000.00 (needs 750.00)",
+	}, failed)
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,288 @@
+// Package jobrollout vets the new images of Cloud Run jobs with canary
+// executions before updating the jobs.
+//
+// Jobs have no traffic to shift, so a new image (set in the
+// CandidateImageAnnotation annotation of a job, e.g. by a CI pipeline) is run
+// once by a copy of the job, the canary job, with the canary arguments and
+// environment variables of the strategy. The job is updated to the image only
+// if the canary execution is healthy, i.e. enough of its tasks succeeded in
+// time.
+package jobrollout
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Annotations of the managed jobs.
+const (
+	// CandidateImageAnnotation is the image the job should be updated to.
+	CandidateImageAnnotation = "rollout.cloud.run/candidateImage"
+
+	// CanaryImageAnnotation and CanaryExecutionAnnotation are the image of the
+	// canary job and the name of its execution, once started.
+	CanaryImageAnnotation     = "rollout.cloud.run/canaryImage"
+	CanaryExecutionAnnotation = "rollout.cloud.run/canaryExecution"
+
+	// LastFailedCandidateImageAnnotation is the last candidate image whose
+	// canary execution was unhealthy. It is not run again.
+	LastFailedCandidateImageAnnotation = "rollout.cloud.run/lastFailedCandidateImage"
+
+	// CanaryOfAnnotation is set in the canary jobs to the name of their job.
+	CanaryOfAnnotation = "rollout.cloud.run/canaryOf"
+)
+
+// CanaryJobSuffix is appended to the name of a job to name its canary job.
+const CanaryJobSuffix = "-canary"
+
+// Decision is the outcome of a rollout cycle of a job.
+type Decision string
+
+// Possible decisions.
+const (
+	NoCandidateDecision     Decision = "noCandidate"
+	CanaryUpdatedDecision   Decision = "canaryUpdated"
+	CanaryStartedDecision   Decision = "canaryStarted"
+	UnchangedDecision       Decision = "unchanged"
+	PromotionDecision       Decision = "promotion"
+	RejectedDecision        Decision = "rejected"
+	FailedCandidateDecision Decision = "failedCandidate"
+)
+
+// Rollout is the rollout manager of a job.
+type Rollout struct {
+	ctx      context.Context
+	client   runapi.JobsClient
+	job      *runapi.Job
+	project  string
+	region   string
+	canary   config.JobCanary
+	notifier notify.Notifier
+	log      *logrus.Entry
+	time     clockwork.Clock
+}
+
+// New returns a new rollout manager of the job.
+func New(ctx context.Context, client runapi.JobsClient, job *runapi.Job, project, region string, canary config.JobCanary) *Rollout {
+	return &Rollout{
+		ctx:     ctx,
+		client:  client,
+		job:     job,
+		project: project,
+		region:  region,
+		canary:  canary,
+		log:     logrus.NewEntry(logrus.New()),
+		time:    clockwork.NewRealClock(),
+	}
+}
+
+// WithNotifier updates the notifier alerted when the job is updated or its
+// candidate rejected in the rollout instance.
+func (r *Rollout) WithNotifier(notifier notify.Notifier) *Rollout {
+	r.notifier = notifier
+	return r
+}
+
+// WithLogger updates the logger in the rollout instance.
+func (r *Rollout) WithLogger(logger *logrus.Logger) *Rollout {
+	r.log = logger.WithField("project", r.project)
+	return r
+}
+
+// WithClock updates the clock in the rollout instance.
+func (r *Rollout) WithClock(clock clockwork.Clock) *Rollout {
+	r.time = clock
+	return r
+}
+
+// Rollout handles a step of the rollout of the candidate image of the job,
+// and returns the decision made.
+//
+// The steps are spread over several cycles, since the update of the canary
+// job and its execution are asynchronous: the canary job is first updated to
+// the candidate image, then run once the update is done, and the job is
+// finally updated or its candidate rejected once the execution completed.
+func (r *Rollout) Rollout() (Decision, error) {
+	job := r.job
+	r.log = r.log.WithFields(logrus.Fields{"job": job.ID(), "region": r.region})
+	stable, err := job.Image()
+	if err != nil {
+		return "", err
+	}
+	candidate := job.Annotations[CandidateImageAnnotation]
+	if candidate == "" || candidate == stable {
+		r.log.Debug("no candidate image")
+		return NoCandidateDecision, nil
+	}
+	r.log = r.log.WithFields(logrus.Fields{"stable": stable, "candidate": candidate})
+	if candidate == job.Annotations[LastFailedCandidateImageAnnotation] {
+		r.log.Debug("candidate image already failed, skipping")
+		return FailedCandidateDecision, nil
+	}
+
+	if job.Annotations[CanaryImageAnnotation] != candidate {
+		return CanaryUpdatedDecision, r.updateCanaryJob(candidate)
+	}
+	execution := job.Annotations[CanaryExecutionAnnotation]
+	if execution == "" {
+		return r.startCanary(stable, candidate)
+	}
+	return r.diagnoseCanary(execution, stable, candidate)
+}
+
+// canaryJobID returns the name of the canary job.
+func (r *Rollout) canaryJobID() string {
+	return r.job.ID() + CanaryJobSuffix
+}
+
+// updateCanaryJob creates or updates the canary job as a copy of the job with
+// the candidate image.
+func (r *Rollout) updateCanaryJob(candidate string) error {
+	canary := &runapi.Job{
+		Annotations: map[string]string{CanaryOfAnnotation: r.job.ID()},
+		Template:    r.job.Template,
+	}
+	if err := canary.SetImage(candidate); err != nil {
+		return err
+	}
+	r.log.WithField("canaryJob", r.canaryJobID()).Info("updating canary job to the candidate image")
+	if err := r.client.UpdateJob(r.project, r.canaryJobID(), canary); err != nil {
+		return errors.Wrap(err, "failed to update canary job")
+	}
+
+	setAnnotation(r.job, CanaryImageAnnotation, candidate)
+	delete(r.job.Annotations, CanaryExecutionAnnotation)
+	return errors.Wrap(r.client.UpdateJob(r.project, r.job.ID(), r.job), "failed to update job")
+}
+
+// startCanary runs the canary job once its update is done.
+func (r *Rollout) startCanary(stable, candidate string) (Decision, error) {
+	canary, err := r.client.Job(r.project, r.canaryJobID())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get canary job")
+	}
+	if image, err := canary.Image(); err != nil || image != candidate {
+		// The canary job was modified, it is updated again.
+		return CanaryUpdatedDecision, r.updateCanaryJob(candidate)
+	}
+	if canary.Reconciling {
+		r.log.Debug("canary job is being updated")
+		return UnchangedDecision, nil
+	}
+
+	execution, err := r.client.RunJob(r.project, r.canaryJobID(), r.canary.Args, r.canary.Env, r.canary.Timeout)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to run canary job")
+	}
+	r.log.WithField("execution", execution).Info("canary execution started")
+	setAnnotation(r.job, CanaryExecutionAnnotation, execution)
+	if err := r.client.UpdateJob(r.project, r.job.ID(), r.job); err != nil {
+		return "", errors.Wrap(err, "failed to update job")
+	}
+	r.notify(notify.CandidateDetectedEvent, stable, candidate, fmt.Sprintf("canary execution %s started", execution), health.Report{})
+	return CanaryStartedDecision, nil
+}
+
+// diagnoseCanary diagnoses the completed canary execution, and updates the job
+// to the candidate image if it is healthy.
+func (r *Rollout) diagnoseCanary(name, stable, candidate string) (Decision, error) {
+	execution, err := r.client.Execution(name)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get canary execution")
+	}
+	if execution.CompletionTime == "" {
+		r.log.WithField("execution", name).Debug("canary execution in progress")
+		return UnchangedDecision, nil
+	}
+
+	criteria, values := r.healthCriteria(execution)
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	diagnosis, err := health.Diagnose(ctx, criteria, values)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to diagnose canary execution")
+	}
+	report := health.StringReport(criteria, diagnosis)
+	r.log.WithField("diagnosis", diagnosis.OverallResult.String()).Info("canary execution completed")
+
+	delete(r.job.Annotations, CanaryImageAnnotation)
+	delete(r.job.Annotations, CanaryExecutionAnnotation)
+	setAnnotation(r.job, rollout.LastHealthReportAnnotation, report)
+	decision, eventType := PromotionDecision, notify.PromotionEvent
+	if diagnosis.OverallResult == health.Healthy {
+		if err := r.job.SetImage(candidate); err != nil {
+			return "", err
+		}
+		delete(r.job.Annotations, CandidateImageAnnotation)
+	} else {
+		setAnnotation(r.job, LastFailedCandidateImageAnnotation, candidate)
+		decision, eventType = RejectedDecision, notify.RollbackEvent
+	}
+	if err := r.client.UpdateJob(r.project, r.job.ID(), r.job); err != nil {
+		return "", errors.Wrap(err, "failed to update job")
+	}
+	r.notify(eventType, stable, candidate, report, health.NewReport(criteria, diagnosis))
+	return decision, nil
+}
+
+// healthCriteria returns the criteria the canary execution is diagnosed with,
+// and their values.
+func (r *Rollout) healthCriteria(execution *runapi.Execution) ([]config.HealthCriterion, []float64) {
+	successPercent := math.NaN()
+	if execution.TaskCount != 0 {
+		successPercent = 100 * float64(execution.SucceededCount) / float64(execution.TaskCount)
+	}
+	criteria := []config.HealthCriterion{{Metric: config.JobSuccessRateMetricsCheck, Threshold: r.canary.MinSuccessPercent}}
+	values := []float64{successPercent}
+	if r.canary.MaxDuration > 0 {
+		criteria = append(criteria, config.HealthCriterion{Metric: config.JobDurationMetricsCheck, Threshold: r.canary.MaxDuration.Seconds()})
+		values = append(values, execution.Duration().Seconds())
+	}
+	return criteria, values
+}
+
+// notify alerts the notifier about the candidate image. The service of the
+// event is the job.
+func (r *Rollout) notify(eventType notify.EventType, stable, candidate, report string, healthReport health.Report) {
+	if r.notifier == nil {
+		return
+	}
+
+	event := notify.Event{
+		Type:         eventType,
+		Project:      r.project,
+		Region:       r.region,
+		Service:      r.job.ID(),
+		Stable:       stable,
+		Candidate:    candidate,
+		Report:       report,
+		Time:         r.time.Now(),
+		Diagnosis:    healthReport.Status,
+		Checks:       healthReport.Checks,
+		FailedChecks: healthReport.FailedChecks(),
+	}
+	if eventType == notify.PromotionEvent {
+		event.CandidatePercent = 100
+	}
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	if err := r.notifier.Notify(ctx, event); err != nil {
+		r.log.Warnf("could not send %s notification: %v", event.Type, err)
+	}
+}
+
+func setAnnotation(job *runapi.Job, key, value string) {
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string)
+	}
+	job.Annotations[key] = value
+}
@@ -0,0 +1,161 @@
+package jobrollout_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	notifyMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify/mock"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/jobrollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/stretchr/testify/assert"
+)
+
+const executionName = "projects/myproject/locations/us-east1/jobs/etl-canary/executions/etl-canary-xyz"
+
+// jobsAPI is a fake jobs API keeping the jobs in memory.
+type jobsAPI struct {
+	*runMocker.JobsAPI
+	jobs map[string]*runapi.Job
+}
+
+func newJobsAPI(execution *runapi.Execution) *jobsAPI {
+	api := &jobsAPI{JobsAPI: &runMocker.JobsAPI{}, jobs: make(map[string]*runapi.Job)}
+	api.JobFn = func(project, jobID string) (*runapi.Job, error) {
+		return copyJob(api.jobs[jobID]), nil
+	}
+	api.UpdateJobFn = func(project, jobID string, job *runapi.Job) error {
+		job = copyJob(job)
+		job.Name = "projects/myproject/locations/us-east1/jobs/" + jobID
+		api.jobs[jobID] = job
+		return nil
+	}
+	api.RunJobFn = func(project, jobID string, args []string, env map[string]string, timeout time.Duration) (string, error) {
+		return executionName, nil
+	}
+	api.ExecutionFn = func(name string) (*runapi.Execution, error) {
+		return execution, nil
+	}
+	return api
+}
+
+func copyJob(job *runapi.Job) *runapi.Job {
+	data, _ := json.Marshal(job)
+	var c runapi.Job
+	json.Unmarshal(data, &c)
+	return &c
+}
+
+func newJob(image string, annotations map[string]string) *runapi.Job {
+	return &runapi.Job{
+		Name:        "projects/myproject/locations/us-east1/jobs/etl",
+		Annotations: annotations,
+		Template:    json.RawMessage(`{"template":{"containers":[{"image":"` + image + `"}]}}`),
+	}
+}
+
+func TestRollout(t *testing.T) {
+	tests := []struct {
+		name             string
+		execution        *runapi.Execution
+		expectedDecision jobrollout.Decision
+		expectedImage    string
+		expectedEvents   []notify.EventType
+	}{
+		{
+			name: "healthy canary",
+			execution: &runapi.Execution{Name: executionName, TaskCount: 2, SucceededCount: 2,
+				StartTime: "2020-06-01T10:00:00Z", CompletionTime: "2020-06-01T10:05:00Z"},
+			expectedDecision: jobrollout.PromotionDecision,
+			expectedImage:    "etl:v2",
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent, notify.PromotionEvent},
+		},
+		{
+			name: "failed task",
+			execution: &runapi.Execution{Name: executionName, TaskCount: 2, SucceededCount: 1, FailedCount: 1,
+				StartTime: "2020-06-01T10:00:00Z", CompletionTime: "2020-06-01T10:05:00Z"},
+			expectedDecision: jobrollout.RejectedDecision,
+			expectedImage:    "etl:v1",
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent, notify.RollbackEvent},
+		},
+		{
+			name: "too slow",
+			execution: &runapi.Execution{Name: executionName, TaskCount: 2, SucceededCount: 2,
+				StartTime: "2020-06-01T10:00:00Z", CompletionTime: "2020-06-01T11:00:00Z"},
+			expectedDecision: jobrollout.RejectedDecision,
+			expectedImage:    "etl:v1",
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent, notify.RollbackEvent},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			api := newJobsAPI(test.execution)
+			api.jobs["etl"] = newJob("etl:v1", map[string]string{jobrollout.CandidateImageAnnotation: "etl:v2"})
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			canary := config.JobCanary{Args: []string{"--dry-run"}, MinSuccessPercent: 100, MaxDuration: 10 * time.Minute}
+			roll := func() jobrollout.Decision {
+				r := jobrollout.New(context.TODO(), api, copyJob(api.jobs["etl"]), "myproject", "us-east1", canary).WithNotifier(notifier)
+				decision, err := r.Rollout()
+				assert.Nil(tt, err)
+				return decision
+			}
+
+			assert.Equal(tt, jobrollout.CanaryUpdatedDecision, roll())
+			image, _ := api.jobs["etl-canary"].Image()
+			assert.Equal(tt, "etl:v2", image)
+			assert.Equal(tt, "etl", api.jobs["etl-canary"].Annotations[jobrollout.CanaryOfAnnotation])
+
+			assert.Equal(tt, jobrollout.CanaryStartedDecision, roll())
+			assert.Equal(tt, executionName, api.jobs["etl"].Annotations[jobrollout.CanaryExecutionAnnotation])
+
+			assert.Equal(tt, test.expectedDecision, roll())
+			job := api.jobs["etl"]
+			image, _ = job.Image()
+			assert.Equal(tt, test.expectedImage, image)
+			assert.Empty(tt, job.Annotations[jobrollout.CanaryExecutionAnnotation])
+			assert.NotEmpty(tt, job.Annotations[rollout.LastHealthReportAnnotation])
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+
+			// A rejected candidate is not run again, and a promoted one is
+			// not a candidate anymore.
+			expected := jobrollout.NoCandidateDecision
+			if test.expectedDecision == jobrollout.RejectedDecision {
+				expected = jobrollout.FailedCandidateDecision
+			}
+			assert.Equal(tt, expected, roll())
+		})
+	}
+}
+
+func TestRollout_InProgress(t *testing.T) {
+	api := newJobsAPI(&runapi.Execution{Name: executionName, TaskCount: 1, StartTime: "2020-06-01T10:00:00Z"})
+	api.jobs["etl-canary"] = newJob("etl:v2", nil)
+	api.jobs["etl-canary"].Reconciling = true
+	job := newJob("etl:v1", map[string]string{
+		jobrollout.CandidateImageAnnotation: "etl:v2",
+		jobrollout.CanaryImageAnnotation:    "etl:v2",
+	})
+	canary := config.JobCanary{MinSuccessPercent: 100}
+
+	decision, err := jobrollout.New(context.TODO(), api, job, "myproject", "us-east1", canary).Rollout()
+	assert.Nil(t, err)
+	assert.Equal(t, jobrollout.UnchangedDecision, decision, "canary job must not run while it is updated")
+	assert.False(t, api.RunJobInvoked)
+
+	job.Annotations[jobrollout.CanaryExecutionAnnotation] = executionName
+	decision, err = jobrollout.New(context.TODO(), api, job, "myproject", "us-east1", canary).Rollout()
+	assert.Nil(t, err)
+	assert.Equal(t, jobrollout.UnchangedDecision, decision, "execution is not completed")
+	assert.False(t, api.UpdateJobInvoked)
+}
@@ -0,0 +1,67 @@
+package metricsplugin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// AddressEnv is the environment variable with the address where a launched
+// plugin binary must listen.
+const AddressEnv = "ROLLOUT_METRICS_PLUGIN_ADDR"
+
+// Process is a plugin binary launched by the operator.
+type Process struct {
+	Conn *grpc.ClientConn
+
+	cmd *exec.Cmd
+	dir string
+}
+
+// Launch starts the plugin binary and connects to it. The plugin must listen
+// on the Unix socket given in the AddressEnv environment variable.
+func Launch(ctx context.Context, path string, startTimeout time.Duration) (*Process, error) {
+	dir, err := ioutil.TempDir("", "metrics-plugin")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create directory for plugin socket")
+	}
+	address := "unix://" + filepath.Join(dir, "plugin.sock")
+
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), AddressEnv+"="+address)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrapf(err, "failed to start plugin %s", path)
+	}
+	process := &Process{cmd: cmd, dir: dir}
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	process.Conn, err = Dial(ctx, address, grpc.WithBlock())
+	if err != nil {
+		process.Close()
+		return nil, err
+	}
+	return process, nil
+}
+
+// Close closes the connection and stops the plugin.
+func (p *Process) Close() error {
+	if p.Conn != nil {
+		p.Conn.Close()
+	}
+	defer os.RemoveAll(p.dir)
+	if err := p.cmd.Process.Kill(); err != nil {
+		return errors.Wrap(err, "failed to stop plugin")
+	}
+	p.cmd.Wait()
+	return nil
+}
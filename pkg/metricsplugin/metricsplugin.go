@@ -0,0 +1,137 @@
+// Package metricsplugin defines the gRPC contract between the operator and
+// external metrics provider plugins, so proprietary metrics systems can be
+// supported without changes to the operator.
+//
+// The contract is described in metricsplugin.proto. It only uses well-known
+// protobuf types, so plugins can be implemented in any language. Plugins
+// written in Go can implement the Plugin interface and register it with
+// RegisterServer.
+package metricsplugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ServiceName is the fully-qualified name of the gRPC service.
+const ServiceName = "rollout.metrics.v1.MetricsProvider"
+
+// Method names of the gRPC service.
+const (
+	requestCountMethod = "RequestCount"
+	latencyMethod      = "Latency"
+	errorRateMethod    = "ErrorRate"
+	customMethod       = "Custom"
+)
+
+// ErrNoData should be returned by plugins when there is no metrics data for the
+// requested revision. It is sent as a NOT_FOUND status.
+var ErrNoData = metrics.ErrMissingRevisionData
+
+// Request is the request sent to the plugin for every metrics.
+type Request struct {
+	Project  string
+	Region   string
+	Service  string
+	Revision string
+	Offset   time.Duration
+
+	// Percentile is only set for latency (e.g. 99).
+	Percentile float64
+
+	// Name is only set for custom metrics.
+	Name string
+}
+
+// Plugin is the interface to implement in Go plugins.
+type Plugin interface {
+	RequestCount(ctx context.Context, req Request) (int64, error)
+	Latency(ctx context.Context, req Request) (float64, error)
+	ErrorRate(ctx context.Context, req Request) (float64, error)
+	Custom(ctx context.Context, req Request) (float64, error)
+}
+
+func (req Request) toStruct() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"project":       req.Project,
+		"region":        req.Region,
+		"service":       req.Service,
+		"revision":      req.Revision,
+		"offsetSeconds": req.Offset.Seconds(),
+		"percentile":    req.Percentile,
+		"name":          req.Name,
+	})
+}
+
+func requestFromStruct(s *structpb.Struct) Request {
+	fields := s.GetFields()
+	return Request{
+		Project:    fields["project"].GetStringValue(),
+		Region:     fields["region"].GetStringValue(),
+		Service:    fields["service"].GetStringValue(),
+		Revision:   fields["revision"].GetStringValue(),
+		Offset:     time.Duration(fields["offsetSeconds"].GetNumberValue() * float64(time.Second)),
+		Percentile: fields["percentile"].GetNumberValue(),
+		Name:       fields["name"].GetStringValue(),
+	}
+}
+
+// RegisterServer registers the plugin as the metrics provider service.
+func RegisterServer(s *grpc.Server, plugin Plugin) {
+	s.RegisterService(&serviceDesc, plugin)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Plugin)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: requestCountMethod, Handler: handler(requestCountMethod, func(p Plugin, ctx context.Context, req Request) (float64, error) {
+			count, err := p.RequestCount(ctx, req)
+			return float64(count), err
+		})},
+		{MethodName: latencyMethod, Handler: handler(latencyMethod, Plugin.Latency)},
+		{MethodName: errorRateMethod, Handler: handler(errorRateMethod, Plugin.ErrorRate)},
+		{MethodName: customMethod, Handler: handler(customMethod, Plugin.Custom)},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "metricsplugin.proto",
+}
+
+type pluginFunc func(p Plugin, ctx context.Context, req Request) (float64, error)
+
+// handler returns the gRPC method handler that calls the plugin function.
+func handler(method string, fn pluginFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req interface{}) (interface{}, error) {
+			value, err := fn(srv.(Plugin), ctx, requestFromStruct(req.(*structpb.Struct)))
+			if errors.Is(err, ErrNoData) {
+				return nil, status.Error(codes.NotFound, err.Error())
+			}
+			if err != nil {
+				return nil, err
+			}
+			return wrapperspb.Double(value), nil
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(method)}
+		return interceptor(ctx, in, info, call)
+	}
+}
+
+func fullMethod(method string) string {
+	return "/" + ServiceName + "/" + method
+}
@@ -0,0 +1,90 @@
+package metricsplugin_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/metricsplugin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakePlugin struct {
+	requests []metricsplugin.Request
+}
+
+func (p *fakePlugin) RequestCount(ctx context.Context, req metricsplugin.Request) (int64, error) {
+	p.requests = append(p.requests, req)
+	return 1500, nil
+}
+
+func (p *fakePlugin) Latency(ctx context.Context, req metricsplugin.Request) (float64, error) {
+	p.requests = append(p.requests, req)
+	if req.Percentile == 95 {
+		return 0, errors.Wrap(metricsplugin.ErrNoData, "no histogram")
+	}
+	return 250.5, nil
+}
+
+func (p *fakePlugin) ErrorRate(ctx context.Context, req metricsplugin.Request) (float64, error) {
+	p.requests = append(p.requests, req)
+	return 0, errors.New("backend unavailable")
+}
+
+func (p *fakePlugin) Custom(ctx context.Context, req metricsplugin.Request) (float64, error) {
+	p.requests = append(p.requests, req)
+	return 42, nil
+}
+
+func TestProvider(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	plugin := &fakePlugin{}
+	metricsplugin.RegisterServer(server, plugin)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	provider := metricsplugin.NewProvider(conn, "myproject", "us-east1", "mysvc")
+	provider.SetCandidateRevision("test-002")
+	offset := 30 * time.Minute
+
+	count, err := provider.RequestCount(ctx, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), count)
+	assert.Equal(t, metricsplugin.Request{
+		Project:  "myproject",
+		Region:   "us-east1",
+		Service:  "mysvc",
+		Revision: "test-002",
+		Offset:   offset,
+	}, plugin.requests[0])
+
+	latency, err := provider.Latency(ctx, offset, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.5, latency)
+	assert.Equal(t, 99.0, plugin.requests[1].Percentile)
+
+	_, err = provider.Latency(ctx, offset, metrics.Align95Reduce95)
+	assert.True(t, errors.Is(err, metrics.ErrMissingRevisionData))
+
+	_, err = provider.ErrorRate(ctx, offset)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, metrics.ErrMissingRevisionData))
+
+	value, err := provider.Custom(ctx, "queue-depth", offset)
+	assert.Nil(t, err)
+	assert.Equal(t, 42.0, value)
+	assert.Equal(t, "queue-depth", plugin.requests[4].Name)
+}
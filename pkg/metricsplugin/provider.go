@@ -0,0 +1,123 @@
+package metricsplugin
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Provider is a metrics provider that gets the metrics from a plugin.
+type Provider struct {
+	conn     grpc.ClientConnInterface
+	project  string
+	region   string
+	service  string
+	revision string
+}
+
+// NewProvider initializes the provider for a plugin.
+func NewProvider(conn grpc.ClientConnInterface, project, region, serviceName string) *Provider {
+	return &Provider{
+		conn:    conn,
+		project: project,
+		region:  region,
+		service: serviceName,
+	}
+}
+
+// Dial connects to a plugin listening on the address. Addresses of the form
+// unix:///path/to/socket are Unix domain sockets, any other address is
+// considered a TCP address (e.g. localhost:9000 for a sidecar).
+//
+// The connection is not encrypted since plugins are expected to run next to
+// the operator.
+func Dial(ctx context.Context, address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithInsecure())
+	if path := strings.TrimPrefix(address, "unix://"); path != address {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}))
+	}
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	return conn, errors.Wrapf(err, "failed to connect to metrics plugin at %s", address)
+}
+
+// SetCandidateRevision sets the candidate revision name for which the provider
+// should get metrics.
+func (p *Provider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+}
+
+// RequestCount returns the number of requests for the given offset.
+func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	value, err := p.call(ctx, requestCountMethod, p.request(offset))
+	if errors.Is(err, metrics.ErrMissingRevisionData) {
+		return 0, nil
+	}
+	return int64(value), err
+}
+
+// Latency returns the latency for the given offset, in milliseconds.
+func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	req := p.request(offset)
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		req.Percentile = 99
+	case metrics.Align95Reduce95:
+		req.Percentile = 95
+	case metrics.Align50Reduce50:
+		req.Percentile = 50
+	default:
+		return 0, errors.Errorf("unsupported align reduce type %v", alignReduceType)
+	}
+	return p.call(ctx, latencyMethod, req)
+}
+
+// ErrorRate returns the rate of errors for the given offset.
+func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	return p.call(ctx, errorRateMethod, p.request(offset))
+}
+
+// Custom returns the value of a metrics that is only known by the plugin.
+func (p *Provider) Custom(ctx context.Context, name string, offset time.Duration) (float64, error) {
+	req := p.request(offset)
+	req.Name = name
+	return p.call(ctx, customMethod, req)
+}
+
+func (p *Provider) request(offset time.Duration) Request {
+	return Request{
+		Project:  p.project,
+		Region:   p.region,
+		Service:  p.service,
+		Revision: p.revision,
+		Offset:   offset,
+	}
+}
+
+// call invokes the plugin method. A NOT_FOUND status is returned as
+// metrics.ErrMissingRevisionData.
+func (p *Provider) call(ctx context.Context, method string, req Request) (float64, error) {
+	in, err := req.toStruct()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to build plugin request")
+	}
+	out := new(wrapperspb.DoubleValue)
+	err = p.conn.Invoke(ctx, fullMethod(method), in, out)
+	if status.Code(err) == codes.NotFound {
+		return 0, errors.Wrapf(metrics.ErrMissingRevisionData, "plugin %s", method)
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "metrics plugin %s call failed", method)
+	}
+	return out.GetValue(), nil
+}
@@ -0,0 +1,215 @@
+// Package metricstest provides a fake metrics provider, so the diagnoses of
+// the candidates can be tested deterministically with rollout.New.
+//
+// The metrics of every candidate revision are scripted as series of values:
+// every query returns the next value of its series, and the last value is
+// repeated once the series is exhausted. The queries are recorded.
+package metricstest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/pkg/errors"
+)
+
+// Metrics of the provider, as recorded in the queries.
+const (
+	RequestCountMetric  = "RequestCount"
+	LatencyMetric       = "Latency"
+	ErrorRateMetric     = "ErrorRate"
+	SpanErrorRateMetric = "SpanErrorRate"
+	SpanLatencyMetric   = "SpanLatency"
+)
+
+// AnyRevision scripts the metrics of all the revisions without metrics of
+// their own.
+const AnyRevision = ""
+
+// Query is a query sent to the provider.
+type Query struct {
+	Metric   string
+	Revision string
+	Offset   time.Duration
+
+	// Percentile is the percentile of the latency queries.
+	Percentile float64
+
+	// Operation is the name of the spans of the span queries.
+	Operation string
+}
+
+// Provider is a fake metrics provider. It also gets metrics from traces, so
+// it can be used with the health criteria based on spans.
+type Provider struct {
+	mu       sync.Mutex
+	revision string
+	series   map[seriesKey]*series
+	queries  []Query
+}
+
+// seriesKey identifies the series of a metric of a revision.
+type seriesKey struct {
+	revision   string
+	metric     string
+	percentile float64
+	operation  string
+}
+
+// series are the scripted results of a metric, consumed in order.
+type series struct {
+	values []float64
+	errs   []error
+}
+
+// NewProvider initializes a fake provider without metrics. Querying a metric
+// that is not scripted fails.
+func NewProvider() *Provider {
+	return &Provider{series: make(map[seriesKey]*series)}
+}
+
+// WithRequestCount scripts the request counts of the revision.
+func (p *Provider) WithRequestCount(revision string, values ...int64) *Provider {
+	floats := make([]float64, len(values))
+	for i, value := range values {
+		floats[i] = float64(value)
+	}
+	return p.with(seriesKey{revision: revision, metric: RequestCountMetric}, floats)
+}
+
+// WithLatency scripts the latencies of the revision at the percentile (99, 95
+// or 50), in milliseconds.
+func (p *Provider) WithLatency(revision string, percentile float64, values ...float64) *Provider {
+	return p.with(seriesKey{revision: revision, metric: LatencyMetric, percentile: percentile}, values)
+}
+
+// WithErrorRate scripts the error rates of the revision, between 0 and 1.
+func (p *Provider) WithErrorRate(revision string, values ...float64) *Provider {
+	return p.with(seriesKey{revision: revision, metric: ErrorRateMetric}, values)
+}
+
+// WithSpanErrorRate scripts the error rates of the spans of the operation of
+// the revision, between 0 and 1.
+func (p *Provider) WithSpanErrorRate(revision, operation string, values ...float64) *Provider {
+	return p.with(seriesKey{revision: revision, metric: SpanErrorRateMetric, operation: operation}, values)
+}
+
+// WithSpanLatency scripts the latencies of the spans of the operation of the
+// revision at the percentile (99, 95 or 50), in milliseconds.
+func (p *Provider) WithSpanLatency(revision, operation string, percentile float64, values ...float64) *Provider {
+	return p.with(seriesKey{revision: revision, metric: SpanLatencyMetric, operation: operation, percentile: percentile}, values)
+}
+
+// FailNext makes the next queries of the metric of the revision fail with the
+// errors, one per query, before the scripted values are returned again. The
+// errors apply to every series of the metric (e.g. of every percentile).
+func (p *Provider) FailNext(revision, metric string, errs ...error) *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	found := false
+	for key, s := range p.series {
+		if key.revision == revision && key.metric == metric {
+			s.errs = append(s.errs, errs...)
+			found = true
+		}
+	}
+	if !found {
+		p.series[seriesKey{revision: revision, metric: metric}] = &series{errs: errs}
+	}
+	return p
+}
+
+func (p *Provider) with(key seriesKey, values []float64) *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series[key] = &series{values: values}
+	return p
+}
+
+// Queries returns the queries sent to the provider, in order.
+func (p *Provider) Queries() []Query {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Query(nil), p.queries...)
+}
+
+// SetCandidateRevision sets the revision whose metrics are returned.
+func (p *Provider) SetCandidateRevision(revisionName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revision = revisionName
+}
+
+// RequestCount returns the next request count of the candidate.
+func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	value, err := p.next(Query{Metric: RequestCountMetric, Offset: offset})
+	return int64(value), err
+}
+
+// Latency returns the next latency of the candidate.
+func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	return p.next(Query{Metric: LatencyMetric, Offset: offset, Percentile: percentile(alignReduceType)})
+}
+
+// ErrorRate returns the next error rate of the candidate.
+func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	return p.next(Query{Metric: ErrorRateMetric, Offset: offset})
+}
+
+// SpanErrorRate returns the next error rate of the spans of the candidate.
+func (p *Provider) SpanErrorRate(ctx context.Context, offset time.Duration, operation string) (float64, error) {
+	return p.next(Query{Metric: SpanErrorRateMetric, Offset: offset, Operation: operation})
+}
+
+// SpanLatency returns the next latency of the spans of the candidate.
+func (p *Provider) SpanLatency(ctx context.Context, offset time.Duration, operation string, alignReduceType metrics.AlignReduce) (float64, error) {
+	return p.next(Query{Metric: SpanLatencyMetric, Offset: offset, Operation: operation, Percentile: percentile(alignReduceType)})
+}
+
+// next records the query and returns the next result of its series, for the
+// candidate or for AnyRevision.
+func (p *Provider) next(query Query) (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	query.Revision = p.revision
+	p.queries = append(p.queries, query)
+
+	key := seriesKey{revision: p.revision, metric: query.Metric, percentile: query.Percentile, operation: query.Operation}
+	s, ok := p.series[key]
+	if !ok {
+		key.revision = AnyRevision
+		s, ok = p.series[key]
+	}
+	if !ok {
+		return 0, errors.Errorf("no %s scripted for revision %q", query.Metric, p.revision)
+	}
+	if len(s.errs) != 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return 0, err
+	}
+	if len(s.values) == 0 {
+		return 0, metrics.ErrMissingRevisionData
+	}
+	value := s.values[0]
+	if len(s.values) > 1 {
+		s.values = s.values[1:]
+	}
+	return value, nil
+}
+
+// percentile returns the percentile of the series aligner and cross series
+// reducer.
+func percentile(alignReduceType metrics.AlignReduce) float64 {
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+		return 99
+	case metrics.Align95Reduce95:
+		return 95
+	case metrics.Align50Reduce50:
+		return 50
+	}
+	return 0
+}
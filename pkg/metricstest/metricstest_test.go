@@ -0,0 +1,66 @@
+package metricstest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/metricstest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := metricstest.NewProvider().
+		WithRequestCount(metricstest.AnyRevision, 100).
+		WithRequestCount("checkout-002", 500, 1000).
+		WithLatency("checkout-002", 99, 250).
+		WithErrorRate("checkout-002").
+		FailNext("checkout-002", metricstest.LatencyMetric, errors.New("quota exceeded"))
+
+	provider.SetCandidateRevision("checkout-002")
+	for _, expected := range []int64{500, 1000, 1000} {
+		count, err := provider.RequestCount(ctx, 5*time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, count)
+	}
+
+	_, err := provider.Latency(ctx, 5*time.Minute, metrics.Align99Reduce99)
+	assert.NotNil(t, err, "scripted error")
+	latency, err := provider.Latency(ctx, 5*time.Minute, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.0, latency)
+	_, err = provider.Latency(ctx, 5*time.Minute, metrics.Align50Reduce50)
+	assert.NotNil(t, err, "percentile not scripted")
+
+	_, err = provider.ErrorRate(ctx, 5*time.Minute)
+	assert.Equal(t, metrics.ErrMissingRevisionData, err)
+
+	provider.SetCandidateRevision("checkout-003")
+	count, err := provider.RequestCount(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), count, "metrics of any revision")
+
+	queries := provider.Queries()
+	assert.Len(t, queries, 8)
+	assert.Equal(t, metricstest.Query{Metric: metricstest.LatencyMetric, Revision: "checkout-002", Offset: 5 * time.Minute, Percentile: 99}, queries[3])
+	assert.Equal(t, "checkout-003", queries[7].Revision)
+}
+
+func TestProvider_Spans(t *testing.T) {
+	ctx := context.Background()
+	var provider metrics.SpanProvider = metricstest.NewProvider().
+		WithSpanErrorRate(metricstest.AnyRevision, "checkout", 0.02).
+		WithSpanLatency(metricstest.AnyRevision, "checkout", 95, 120)
+
+	rate, err := provider.SpanErrorRate(ctx, time.Minute, "checkout")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.02, rate)
+	latency, err := provider.SpanLatency(ctx, time.Minute, "checkout", metrics.Align95Reduce95)
+	assert.Nil(t, err)
+	assert.Equal(t, 120.0, latency)
+	_, err = provider.SpanErrorRate(ctx, time.Minute, "cart")
+	assert.NotNil(t, err)
+}
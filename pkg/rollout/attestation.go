@@ -0,0 +1,92 @@
+package rollout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/attestation"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// AttestationRefusedAnnotation is set when a new candidate is refused any
+// traffic because its image lacks the attestations required by the strategy,
+// to the candidate and the reason (e.g. "myservice-002: image ... is not
+// attested by ..."). It is removed once the candidate is attested.
+const AttestationRefusedAnnotation = "rollout.cloud.run/attestationRefused"
+
+// WithAttestationVerifier updates the verifier of the attestations of the
+// images of the new candidates in the rollout instance.
+func (r *Rollout) WithAttestationVerifier(verifier attestation.Verifier) *Rollout {
+	r.attestationVerifier = verifier
+	return r
+}
+
+// attestationRefusal verifies that the image of the candidate, pinned to its
+// digest, was attested by all the attestors of the strategy. It returns the
+// reason the candidate is refused traffic, or an empty string if it is
+// attested.
+func (r *Rollout) attestationRefusal(candidate string) (string, error) {
+	if r.attestationVerifier == nil {
+		return "", configErrorf("attestation is configured but no attestation verifier was provided")
+	}
+	image, refusal, err := r.pinnedCandidateImage(candidate)
+	if image == "" {
+		return refusal, err
+	}
+
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	missing, err := r.attestationVerifier.Missing(ctx, image, r.strategy.Attestation.Attestors)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to verify attestations")
+	}
+	if len(missing) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("image %s is not attested by %s", image, strings.Join(missing, ", ")), nil
+}
+
+// pinnedCandidateImage returns the image of the candidate pinned to its
+// digest, e.g. us-docker.pkg.dev/myproject/myrepo/app@sha256:... If the
+// image is not resolved to a digest yet, the image is empty and the reason the
+// candidate is refused is returned instead.
+func (r *Rollout) pinnedCandidateImage(candidate string) (image, refusal string, err error) {
+	ref, digest := r.candidateImageDigest(candidate)
+	if ref == "" {
+		return "", "", errors.New("could not get the image of the candidate")
+	}
+	if digest == "" {
+		return "", fmt.Sprintf("image %s is not resolved to a digest", ref), nil
+	}
+	return ref + "@" + digest, "", nil
+}
+
+// refuseCandidate keeps the traffic of the candidate unchanged since its image
+// does not pass a check of the strategy (e.g. it is not attested). The first
+// time, the annotation of the check is set to the reason and the event is
+// sent, and the health report is set if the candidate has no traffic. The
+// image is checked again in the next rollout processes.
+func (r *Rollout) refuseCandidate(svc *run.Service, stable, candidate, annotation string, eventType notify.EventType, reason string) (*run.Service, error) {
+	lg := r.log.WithFields(logrus.Fields{"reason": reason, "percent": r.previousPercent})
+	r.denial = "refused: " + reason
+	refusal := candidate + ": " + reason
+	if svc.Metadata.Annotations[annotation] == refusal {
+		lg.Info("candidate still refused, waiting for its image to pass the checks")
+		return nil, nil
+	}
+
+	setAnnotation(svc, annotation, refusal)
+	if r.previousPercent == 0 {
+		r.setHealthMessageAnnotations(svc, candidate, "candidate refused traffic, "+reason)
+	}
+	lg.Warn("candidate refused, its image does not pass the checks")
+	if err := r.replaceService(svc); err != nil {
+		return nil, errors.Wrap(err, "failed to flag refused candidate")
+	}
+
+	r.notify(eventType, svc, stable, candidate, reason)
+	return svc, nil
+}
@@ -0,0 +1,121 @@
+package rollout
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// PausedAnnotation is set to the time the rollout of the service was paused.
+// The traffic of a paused service is kept as is until it is resumed.
+const PausedAnnotation = "rollout.cloud.run/paused"
+
+// Pause stops the rollout of the service, which keeps its current traffic
+// split until it is resumed.
+func (r *Rollout) Pause() error {
+	r.log = r.log.WithFields(logrus.Fields{"project": r.project, "service": r.serviceName, "region": r.region})
+	_, err := r.updateWithRetries(func(svc *run.Service) (*run.Service, error) {
+		if svc.Metadata.Annotations[PausedAnnotation] != "" {
+			return svc, nil
+		}
+		setAnnotation(svc, PausedAnnotation, r.time.Now().Format(time.RFC3339))
+		r.log.Info("pausing rollout")
+		return svc, r.replaceService(svc)
+	})
+	return errors.Wrap(classify(err), "failed to pause rollout")
+}
+
+// Resume resumes the rollout of a paused service.
+func (r *Rollout) Resume() error {
+	r.log = r.log.WithFields(logrus.Fields{"project": r.project, "service": r.serviceName, "region": r.region})
+	_, err := r.updateWithRetries(func(svc *run.Service) (*run.Service, error) {
+		if svc.Metadata.Annotations[PausedAnnotation] == "" {
+			return svc, nil
+		}
+		delete(svc.Metadata.Annotations, PausedAnnotation)
+		r.log.Info("resuming rollout")
+		return svc, r.replaceService(svc)
+	})
+	return errors.Wrap(classify(err), "failed to resume rollout")
+}
+
+// Promote makes the candidate the stable revision right away, skipping the
+// remaining steps and health checks.
+func (r *Rollout) Promote() error {
+	r.log = r.log.WithFields(logrus.Fields{"project": r.project, "service": r.serviceName, "region": r.region})
+	r.manual = true
+	svc, err := r.updateWithRetries(r.promote)
+	err = classify(err)
+	r.record(svc, err)
+	return errors.Wrap(err, "failed to promote candidate")
+}
+
+// promote updates the traffic and the annotations of the service for the
+// promotion of the candidate.
+func (r *Rollout) promote(svc *run.Service) (*run.Service, error) {
+	stable := DetectStableRevisionName(svc)
+	candidate := DetectCandidateRevisionName(svc, stable)
+	if candidate == "" {
+		return nil, errors.New("service has no candidate to promote")
+	}
+	r.stable, r.candidate = stable, candidate
+	r.previousPercent = revisionTraffic(svc, candidate)
+	r.promoteToStable = true
+
+	traffic := []*run.TrafficTarget{newTrafficTarget(candidate, 100, StableTag)}
+	svc.Spec.Traffic = append(traffic, inheritRevisionTags(svc)...)
+	r.log.WithField("candidate", candidate).Info("promoting candidate")
+
+	svc = r.updateAnnotations(svc, stable, candidate)
+	r.setHealthMessageAnnotations(svc, candidate, "candidate manually promoted")
+	err := r.replaceServiceAndNotify(svc, stable, candidate, notify.PromotionEvent)
+	return svc, errors.Wrap(err, "failed to replace service")
+}
+
+// Abort stops the rollout of the candidate and redirects all the traffic to
+// the stable revision, as if the candidate was unhealthy.
+func (r *Rollout) Abort() error {
+	r.log = r.log.WithFields(logrus.Fields{"project": r.project, "service": r.serviceName, "region": r.region})
+	r.manual = true
+	svc, err := r.updateWithRetries(func(svc *run.Service) (*run.Service, error) {
+		stable := DetectStableRevisionName(svc)
+		if stable == "" || DetectCandidateRevisionName(svc, stable) == "" {
+			return nil, errors.New("service has no rollout in progress")
+		}
+		return r.rollbackTo(svc, stable, "rollout manually aborted")
+	})
+	err = classify(err)
+	r.record(svc, err)
+	return errors.Wrap(err, "failed to abort rollout")
+}
+
+// updateWithRetries applies the change to the service, with its rollout state
+// loaded. If the service was modified concurrently, the change is applied
+// again to the latest version of the service.
+func (r *Rollout) updateWithRetries(change func(svc *run.Service) (*run.Service, error)) (*run.Service, error) {
+	for attempt := 0; ; attempt++ {
+		svc, err := r.applyChange(r.service, change)
+		if err == nil || !runapi.IsConflict(err) || attempt == maxConflictRetries {
+			return svc, err
+		}
+
+		r.log.Info("service was modified concurrently, retrying")
+		latest, err := r.runClient.Service(r.namespace, r.serviceName)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to retrieve the modified service")
+		}
+		r.resetState(latest)
+	}
+}
+
+// applyChange loads the rollout state of the service and applies the change.
+func (r *Rollout) applyChange(svc *run.Service, change func(svc *run.Service) (*run.Service, error)) (*run.Service, error) {
+	if err := r.loadState(svc); err != nil {
+		return nil, err
+	}
+	return change(svc)
+}
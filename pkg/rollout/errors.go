@@ -0,0 +1,153 @@
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// Kinds of the errors of the rollout cycles, so transient failures (e.g. a
+// quota blip) can be told apart from the ones that repeat until fixed (e.g. a
+// misconfiguration).
+const (
+	TransientErrorKind  = "transient"
+	ConflictErrorKind   = "conflict"
+	PermissionErrorKind = "permission"
+	ConfigErrorKind     = "config"
+	UnknownErrorKind    = "unknown"
+)
+
+// TransientAPIError is returned when a call to an API failed in a way that
+// is expected to succeed when retried (e.g. rate limited, unavailable or
+// timed out).
+type TransientAPIError struct{ Err error }
+
+// ConflictError is returned when the service was modified concurrently more
+// times than the update was retried.
+type ConflictError struct{ Err error }
+
+// PermissionError is returned when the operator is not allowed to read or
+// update a resource.
+type PermissionError struct{ Err error }
+
+// ConfigError is returned when the rollout cannot proceed because of the
+// configuration of the operator or of the service (e.g. an invalid traffic
+// configuration or corrupted annotations).
+type ConfigError struct{ Err error }
+
+func (e *TransientAPIError) Error() string { return e.Err.Error() }
+func (e *ConflictError) Error() string     { return e.Err.Error() }
+func (e *PermissionError) Error() string   { return e.Err.Error() }
+func (e *ConfigError) Error() string       { return e.Err.Error() }
+
+// Cause returns the underlying error, so errors.Cause sees through the typed
+// errors (e.g. for runapi.IsConflict).
+func (e *TransientAPIError) Cause() error { return e.Err }
+func (e *ConflictError) Cause() error     { return e.Err }
+func (e *PermissionError) Cause() error   { return e.Err }
+func (e *ConfigError) Cause() error       { return e.Err }
+
+// configErrorf returns a ConfigError with the formatted message.
+func configErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Err: errors.New(fmt.Sprintf(format, args...))}
+}
+
+// ErrorKind returns the kind of the error: the kind of the first typed error
+// of its chain, UnknownErrorKind if there is none, or an empty kind for a nil
+// error.
+func ErrorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	for err != nil {
+		switch err.(type) {
+		case *TransientAPIError:
+			return TransientErrorKind
+		case *ConflictError:
+			return ConflictErrorKind
+		case *PermissionError:
+			return PermissionErrorKind
+		case *ConfigError:
+			return ConfigErrorKind
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return UnknownErrorKind
+}
+
+// IsRetryable determines if the error is expected to go away on its own, so
+// the rollout can be retried on the next cycle as is. Permission,
+// configuration and unknown errors are terminal: they repeat until fixed.
+func IsRetryable(err error) bool {
+	kind := ErrorKind(err)
+	return kind == TransientErrorKind || kind == ConflictErrorKind
+}
+
+// classify types the error from its cause (e.g. the status code of a failed
+// API call), unless it is already typed or its cause is unknown.
+func classify(err error) error {
+	if err == nil || ErrorKind(err) != UnknownErrorKind {
+		return err
+	}
+	if runapi.IsConflict(err) {
+		return &ConflictError{Err: err}
+	}
+	if errors.Cause(err) == context.DeadlineExceeded {
+		return &TransientAPIError{Err: err}
+	}
+	code := 0
+	switch cause := errors.Cause(err).(type) {
+	case *googleapi.Error:
+		code = cause.Code
+	case *kube.StatusError:
+		code = cause.Code
+	case net.Error:
+		if cause.Timeout() {
+			return &TransientAPIError{Err: err}
+		}
+	}
+	switch {
+	case code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+		return &TransientAPIError{Err: err}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &PermissionError{Err: err}
+	case code == http.StatusBadRequest || code == http.StatusNotFound:
+		return &ConfigError{Err: err}
+	}
+	return err
+}
+
+// RolloutResult is the outcome of a rollout cycle of a service.
+type RolloutResult struct {
+	// Changed is set if the service was updated.
+	Changed bool
+
+	// Decision is the decision of the cycle (see the decisions of the archive
+	// package).
+	Decision string
+
+	// Err is the error of the cycle, if any, typed after its cause (see
+	// ErrorKind).
+	Err error
+}
+
+// ErrorKind returns the kind of the error of the cycle, if any.
+func (r RolloutResult) ErrorKind() string {
+	return ErrorKind(r.Err)
+}
+
+// Retryable determines if the cycle failed with an error that is expected to
+// go away on its own.
+func (r RolloutResult) Retryable() bool {
+	return IsRetryable(r.Err)
+}
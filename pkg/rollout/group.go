@@ -0,0 +1,277 @@
+package rollout
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// ReleaseGroupAnnotation is set by users in the services whose candidates
+// must advance in lockstep (e.g. api, worker and frontend). The release group
+// of a service is the value of the annotation, in the project of the service.
+const ReleaseGroupAnnotation = "rollout.cloud.run/releaseGroup"
+
+// DependsOnAnnotation is set by users in the members of a release group to
+// the names of the members, separated by commas, whose candidates must be
+// rolled out to 100% before the candidate of the service starts.
+const DependsOnAnnotation = "rollout.cloud.run/dependsOn"
+
+// ReleaseGroup coordinates the rollouts of the members of a release group
+// during a rollout cycle. The members are the services with the same
+// ReleaseGroupAnnotation in a project, in any region.
+//
+// The candidates of the members advance in lockstep: the traffic of a
+// candidate is only increased if no other candidate of the group is behind,
+// so the candidates ahead wait for the others at the same step. If the
+// candidate of a member is unhealthy, the candidates of all the members are
+// rolled back.
+//
+// A member can depend on other members (see DependsOnAnnotation): its
+// candidate is pending, and gets no traffic, until the candidates of its
+// dependencies are promoted. The pending candidates do not hold up the
+// others.
+//
+// The group only holds the state of a cycle, derived from the traffic of the
+// members at its start: it is created again for every cycle.
+type ReleaseGroup struct {
+	Name string
+
+	mu      sync.Mutex
+	step    int64
+	failed  string
+	members map[string]*GroupMember
+}
+
+// GroupMember is the status of a member of a release group in a cycle.
+type GroupMember struct {
+	// Member is the region and the name of the service (REGION/SERVICE).
+	Member    string `json:"member"`
+	Candidate string `json:"candidate,omitempty"`
+
+	// Percent is the traffic of the candidate at the start of the cycle,
+	// and Decision the decision of the cycle, once the member was handled.
+	Percent  int64  `json:"percent"`
+	Decision string `json:"decision,omitempty"`
+	Waiting  bool   `json:"waiting,omitempty"`
+
+	// DependsOn are the names of the services the member depends on, and
+	// Chain all its dependencies, direct or not, in the order they are rolled
+	// out. Pending is set if the candidate waits for its dependencies.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	Chain     []string `json:"chain,omitempty"`
+	Pending   bool     `json:"pending,omitempty"`
+}
+
+// NewReleaseGroup returns the release group of the services, in their state
+// at the start of the cycle. An error is returned if the dependencies of the
+// members are unknown or circular.
+func NewReleaseGroup(name string, services []*ServiceRecord) (*ReleaseGroup, error) {
+	g := &ReleaseGroup{Name: name, step: -1, members: make(map[string]*GroupMember)}
+	byName := make(map[string][]*GroupMember)
+	for _, service := range services {
+		member := &GroupMember{Member: groupMemberID(service.Region, service.Metadata.Name)}
+		g.members[member.Member] = member
+		byName[service.Metadata.Name] = append(byName[service.Metadata.Name], member)
+		for _, dependency := range strings.Split(service.Metadata.Annotations[DependsOnAnnotation], ",") {
+			if dependency = strings.TrimSpace(dependency); dependency != "" {
+				member.DependsOn = append(member.DependsOn, dependency)
+			}
+		}
+
+		stable := DetectStableRevisionName(service.Service)
+		if stable == "" {
+			continue
+		}
+		member.Candidate = DetectCandidateRevisionName(service.Service, stable)
+		if member.Candidate != "" {
+			member.Percent = revisionTraffic(service.Service, member.Candidate)
+		}
+	}
+
+	order, err := dependencyOrder(byName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid dependencies in release group %q", name)
+	}
+	position := make(map[string]int, len(order))
+	for i, service := range order {
+		position[service] = i
+	}
+	// The members are looked at in dependency order, so the chains of their
+	// dependencies are known. A candidate is pending if a dependency has a
+	// candidate, pending or not.
+	for _, service := range order {
+		for _, member := range byName[service] {
+			chain := make(map[string]bool)
+			for _, dependency := range member.DependsOn {
+				chain[dependency] = true
+				for _, d := range byName[dependency] {
+					for _, c := range d.Chain {
+						chain[c] = true
+					}
+					if d.Candidate != "" && member.Candidate != "" {
+						member.Pending = true
+					}
+				}
+			}
+			for c := range chain {
+				member.Chain = append(member.Chain, c)
+			}
+			sort.Slice(member.Chain, func(i, j int) bool { return position[member.Chain[i]] < position[member.Chain[j]] })
+		}
+	}
+	for _, member := range g.members {
+		if member.Candidate != "" && !member.Pending && (g.step == -1 || member.Percent < g.step) {
+			g.step = member.Percent
+		}
+	}
+	return g, nil
+}
+
+// dependencyOrder returns the names of the services of the members, in an
+// order where the dependencies come first.
+func dependencyOrder(byName map[string][]*GroupMember) ([]string, error) {
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		order []string
+		state = make(map[string]int)
+		visit func(name string, path []string) error
+	)
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return errors.Errorf("circular dependency %s", strings.Join(append(path, name), " > "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, member := range byName[name] {
+			for _, dependency := range member.DependsOn {
+				if _, ok := byName[dependency]; !ok {
+					return errors.Errorf("%s depends on %q, which is not in the group", member.Member, dependency)
+				}
+				if err := visit(dependency, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Step returns the traffic of the candidates furthest behind, from which
+// they can advance, or -1 if no member has a candidate.
+func (g *ReleaseGroup) Step() int64 {
+	return g.step
+}
+
+// Failed returns the member whose candidate was unhealthy during the cycle,
+// if any.
+func (g *ReleaseGroup) Failed() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.failed
+}
+
+// Members returns the status of the members, sorted by name.
+func (g *ReleaseGroup) Members() []GroupMember {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	members := make([]GroupMember, 0, len(g.members))
+	for _, member := range g.members {
+		members = append(members, *member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Member < members[j].Member })
+	return members
+}
+
+// Member returns the status of the member (REGION/SERVICE), if in the group.
+func (g *ReleaseGroup) Member(member string) (GroupMember, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status, ok := g.members[member]
+	if !ok {
+		return GroupMember{}, false
+	}
+	return *status, true
+}
+
+// pending determines if the candidate of the member waits for its
+// dependencies.
+func (g *ReleaseGroup) pending(member string) bool {
+	status, ok := g.Member(member)
+	return ok && status.Pending
+}
+
+// mayAdvance determines if the candidate of the member, with the traffic, can
+// advance to the next step, i.e. it is not pending and no other candidate of
+// the group is behind.
+func (g *ReleaseGroup) mayAdvance(member string, percent int64) bool {
+	return !g.pending(member) && percent <= g.step
+}
+
+// fail records that the candidate of the member is unhealthy.
+func (g *ReleaseGroup) fail(member string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failed == "" {
+		g.failed = member
+	}
+}
+
+// record updates the status of the member after its rollout cycle.
+func (g *ReleaseGroup) record(member, decision string, waiting bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if status, ok := g.members[member]; ok {
+		status.Decision = decision
+		status.Waiting = waiting
+	}
+}
+
+// WithReleaseGroup makes the candidate of the service advance in lockstep with
+// the candidates of the other members of the release group. The members of a
+// group must be handled sequentially by rollout instances sharing the group.
+func (r *Rollout) WithReleaseGroup(group *ReleaseGroup) *Rollout {
+	r.group = group
+	return r
+}
+
+// groupMember returns the ID of the service in its release group.
+func (r *Rollout) groupMember() string {
+	return groupMemberID(r.region, r.serviceName)
+}
+
+func groupMemberID(region, service string) string {
+	return path.Join(region, service)
+}
+
+// rollbackWithGroup rolls back the candidate because the candidate of another
+// member of the release group is unhealthy.
+func (r *Rollout) rollbackWithGroup(svc *run.Service, stable, candidate string) (*run.Service, error) {
+	failed := r.group.Failed()
+	r.log.WithFields(logrus.Fields{"releaseGroup": r.group.Name, "failedMember": failed}).Info("release group failed, rollback")
+	return r.rollbackTo(svc, stable, fmt.Sprintf("release group %s rolled back: candidate of %s is unhealthy", r.group.Name, failed))
+}
@@ -0,0 +1,167 @@
+package rollout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	notifyMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify/mock"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+// groupMember is a member of a release group in the tests, with its own
+// client, metrics and notifier.
+type groupMember struct {
+	record   *rollout.ServiceRecord
+	client   *runMocker.RunAPI
+	metrics  *metricsMocker.Metrics
+	notifier *notifyMocker.Notifier
+	replaced *run.Service
+}
+
+func newGroupMember(clock clockwork.Clock, name string, percent int64, errorRate float64) *groupMember {
+	m := &groupMember{client: &runMocker.RunAPI{}, metrics: &metricsMocker.Metrics{}, notifier: &notifyMocker.Notifier{}}
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.ReleaseGroupAnnotation:      "shop",
+			rollout.StableRevisionAnnotation:    name + "-001",
+			rollout.CandidateRevisionAnnotation: name + "-002",
+			rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clock, -60),
+		},
+		LatestReadyRevision: name + "-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: name + "-001", Percent: 100 - percent, Tag: rollout.StableTag},
+			{RevisionName: name + "-002", Percent: percent, Tag: rollout.CandidateTag},
+		},
+	})
+	svc.Metadata.Name = name
+	m.record = &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+
+	m.client.ServiceFn = func(namespace, serviceID string) (*run.Service, error) { return svc, nil }
+	m.client.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		m.replaced = svc
+		return svc, nil
+	}
+	m.client.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+	}
+	m.metrics.SetCandidateRevisionFn = func(revisionName string) {}
+	m.metrics.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return errorRate, nil
+	}
+	m.notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+	return m
+}
+
+func (m *groupMember) run(clock clockwork.Clock, group *rollout.ReleaseGroup) rollout.RolloutResult {
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+	}
+	return rollout.New(context.TODO(), m.metrics, m.record, strategy).WithClient(m.client).WithClock(clock).
+		WithNotifier(m.notifier).WithReleaseGroup(group).Run()
+}
+
+func (m *groupMember) candidatePercent() int64 {
+	for _, target := range m.replaced.Spec.Traffic {
+		if target.RevisionName == m.record.Metadata.Name+"-002" {
+			return target.Percent
+		}
+	}
+	return 0
+}
+
+func TestReleaseGroup_Lockstep(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	api := newGroupMember(clock, "api", 10, 0.01)
+	worker := newGroupMember(clock, "worker", 40, 0.01)
+	group, err := rollout.NewReleaseGroup("shop", []*rollout.ServiceRecord{api.record, worker.record})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), group.Step())
+
+	assert.Nil(t, api.run(clock, group).Err)
+	assert.Nil(t, worker.run(clock, group).Err)
+	if assert.NotNil(t, api.replaced) {
+		assert.Equal(t, int64(40), api.candidatePercent(), "the candidate behind must advance")
+		assert.Equal(t, "shop", api.notifier.Events[0].ReleaseGroup)
+	}
+	assert.Nil(t, worker.replaced, "the candidate ahead must wait")
+	assert.Equal(t, []rollout.GroupMember{
+		{Member: "us-east1/api", Candidate: "api-002", Percent: 10, Decision: "rollForward"},
+		{Member: "us-east1/worker", Candidate: "worker-002", Percent: 40, Decision: "unchanged", Waiting: true},
+	}, group.Members())
+}
+
+func TestReleaseGroup_Rollback(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	api := newGroupMember(clock, "api", 10, 0.01)
+	worker := newGroupMember(clock, "worker", 10, 20)
+	frontend := newGroupMember(clock, "frontend", 10, 0.01)
+	group, err := rollout.NewReleaseGroup("shop", []*rollout.ServiceRecord{api.record, worker.record, frontend.record})
+	assert.Nil(t, err)
+
+	assert.Nil(t, api.run(clock, group).Err)
+	assert.Equal(t, int64(40), api.candidatePercent())
+	assert.Nil(t, worker.run(clock, group).Err)
+	assert.Equal(t, "us-east1/worker", group.Failed())
+	assert.Equal(t, int64(0), worker.candidatePercent())
+
+	// The members handled after the failure are rolled back right away, and
+	// those handled before are handled again.
+	assert.Nil(t, frontend.run(clock, group).Err)
+	assert.Equal(t, int64(0), frontend.candidatePercent())
+	api.record.Service = api.replaced
+	assert.Nil(t, api.run(clock, group).Err)
+	assert.Equal(t, int64(0), api.candidatePercent())
+
+	for _, m := range []*groupMember{api, worker, frontend} {
+		events := m.notifier.Events
+		if assert.NotEmpty(t, events) {
+			assert.Equal(t, notify.RollbackEvent, events[len(events)-1].Type, m.record.Metadata.Name)
+		}
+		assert.Equal(t, m.record.Metadata.Name+"-002", m.replaced.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation])
+	}
+	assert.Contains(t, frontend.replaced.Metadata.Annotations[rollout.LastHealthReportAnnotation], "candidate of us-east1/worker is unhealthy")
+}
+
+func TestNewReleaseGroup_Dependencies(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	db := newGroupMember(clock, "db", 40, 0.01)
+	backend := newGroupMember(clock, "backend", 0, 0.01)
+	backend.record.Metadata.Annotations[rollout.DependsOnAnnotation] = "db"
+	frontend := newGroupMember(clock, "frontend", 0, 0.01)
+	frontend.record.Metadata.Annotations[rollout.DependsOnAnnotation] = "backend, db"
+	frontend.record.Spec.Traffic = frontend.record.Spec.Traffic[:1]
+	frontend.record.Spec.Traffic[0].Percent = 100
+	frontend.record.Status.LatestReadyRevisionName = "frontend-001"
+
+	group, err := rollout.NewReleaseGroup("shop", []*rollout.ServiceRecord{frontend.record, backend.record, db.record})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(40), group.Step(), "pending candidates must not hold up the others")
+	member, _ := group.Member("us-east1/backend")
+	assert.True(t, member.Pending)
+	assert.Equal(t, []string{"db"}, member.Chain)
+	member, _ = group.Member("us-east1/frontend")
+	assert.False(t, member.Pending, "a member without candidate is not pending")
+	assert.Equal(t, []string{"db", "backend"}, member.Chain)
+
+	assert.Nil(t, backend.run(clock, group).Err)
+	assert.Nil(t, backend.replaced, "a pending candidate must get no traffic")
+
+	backend.record.Metadata.Annotations[rollout.DependsOnAnnotation] = "frontend"
+	frontend.record.Metadata.Annotations[rollout.DependsOnAnnotation] = "backend"
+	_, err = rollout.NewReleaseGroup("shop", []*rollout.ServiceRecord{frontend.record, backend.record, db.record})
+	assert.Contains(t, err.Error(), "circular dependency backend > frontend > backend")
+
+	backend.record.Metadata.Annotations[rollout.DependsOnAnnotation] = "cache"
+	_, err = rollout.NewReleaseGroup("shop", []*rollout.ServiceRecord{backend.record})
+	assert.NotNil(t, err, "dependencies must be members")
+}
@@ -0,0 +1,109 @@
+package rollout
+
+import (
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"google.golang.org/api/run/v1"
+)
+
+// Annotations set to the metadata of the container image of the last
+// candidate, if an image inspector is configured: the image pinned to its
+// digest, and the commit and the build it comes from, read from its OCI
+// labels.
+const (
+	CandidateImageAnnotation     = "rollout.cloud.run/candidateImage"
+	CandidateCommitSHAAnnotation = "rollout.cloud.run/candidateCommitSha"
+	CandidateBuildURLAnnotation  = "rollout.cloud.run/candidateBuildUrl"
+)
+
+// WithImageInspector updates the inspector of the container images of the
+// candidates in the rollout instance, so the annotations, the health reports
+// and the notifications link to the commit and the build of the candidate.
+func (r *Rollout) WithImageInspector(inspector image.Inspector) *Rollout {
+	r.imageInspector = inspector
+	return r
+}
+
+// candidateRevision returns the candidate revision, retrieved once, or nil if
+// it could not be retrieved.
+func (r *Rollout) candidateRevision(candidate string) *run.Revision {
+	if r.revisionLookedUp || candidate == "" {
+		return r.revision
+	}
+	r.revisionLookedUp = true
+
+	revision, err := r.runClient.Revision(r.namespace, candidate)
+	if err != nil {
+		r.log.Warnf("could not get candidate revision: %v", err)
+		return nil
+	}
+	if revision != nil && revision.Metadata != nil {
+		r.revision = revision
+	}
+	return r.revision
+}
+
+// candidateImage returns the metadata of the container image of the
+// candidate, inspected once, or nil if there is no image inspector or the
+// image could not be inspected.
+func (r *Rollout) candidateImage(candidate string) *image.Metadata {
+	if r.imageInspector == nil || r.imageLookedUp || candidate == "" {
+		return r.image
+	}
+	r.imageLookedUp = true
+
+	ref, digest := r.candidateImageDigest(candidate)
+	if ref == "" {
+		return nil
+	}
+	metadata, err := r.imageInspector.Inspect(util.ContextWithLogger(r.ctx, r.log), ref, digest)
+	if err != nil {
+		r.log.WithField("image", ref).Warnf("could not inspect candidate image: %v", err)
+		return nil
+	}
+	r.image = metadata
+	return r.image
+}
+
+// candidateImageDigest returns the container image of the candidate and the
+// digest it was resolved to, if known, or empty strings if the candidate
+// revision could not be retrieved.
+func (r *Rollout) candidateImageDigest(candidate string) (ref, digest string) {
+	revision := r.candidateRevision(candidate)
+	if revision == nil || revision.Spec == nil || len(revision.Spec.Containers) == 0 {
+		return "", ""
+	}
+	ref = revision.Spec.Containers[0].Image
+	if revision.Status != nil {
+		// The resolved digest is usually the image pinned to its digest.
+		resolved := revision.Status.ImageDigest
+		if at := strings.LastIndex(resolved, "@"); at != -1 {
+			ref, digest = resolved[:at], resolved[at+1:]
+		} else {
+			digest = resolved
+		}
+	}
+	return ref, digest
+}
+
+// setCandidateImageAnnotations sets the annotations of the metadata of the
+// container image of the candidate, if known.
+func (r *Rollout) setCandidateImageAnnotations(svc *run.Service, candidate string) {
+	metadata := r.candidateImage(candidate)
+	if metadata == nil {
+		return
+	}
+	setAnnotation(svc, CandidateImageAnnotation, metadata.Reference())
+	for key, value := range map[string]string{
+		CandidateCommitSHAAnnotation: metadata.CommitSHA,
+		CandidateBuildURLAnnotation:  metadata.BuildURL,
+	} {
+		if value == "" {
+			delete(svc.Metadata.Annotations, key)
+			continue
+		}
+		setAnnotation(svc, key, value)
+	}
+}
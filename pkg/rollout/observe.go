@@ -0,0 +1,26 @@
+package rollout
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// observe diagnoses the candidate without changing the service, while the
+// traffic changes are paused fleet-wide. The cycle is recorded as paused,
+// with the diagnosis, if any.
+func (r *Rollout) observe(svc *run.Service, candidate string) error {
+	r.paused = true
+	if isNewCandidate(svc, candidate) {
+		r.log.Info("fleet-wide pause, new candidate gets no traffic")
+		return nil
+	}
+
+	diagnosis, err := r.diagnoseCandidate(candidate, r.strategy.HealthCriteria)
+	if err != nil {
+		return errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
+	}
+	r.report = health.NewReport(r.strategy.HealthCriteria, diagnosis)
+	r.log.WithField("diagnosis", r.report.Status).Info("fleet-wide pause, traffic kept")
+	return nil
+}
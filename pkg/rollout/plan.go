@@ -0,0 +1,91 @@
+package rollout
+
+import (
+	"context"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"google.golang.org/api/run/v1"
+)
+
+// PlanResult is the traffic change the next rollout cycle of a service
+// intends to make.
+type PlanResult struct {
+	// Decision and Err are the outcome of the planned cycle.
+	Decision string
+	Err      error
+
+	// Before and After are the traffic of the service before and after the
+	// cycle, and Changed is set if they differ.
+	Before  []*run.TrafficTarget
+	After   []*run.TrafficTarget
+	Changed bool
+}
+
+// Plan runs the next rollout cycle of the service without changing it: the
+// service is not replaced, and no notification is sent, no cycle archived and
+// no state saved. The service is still modified in place, so it should be a
+// copy.
+//
+// The pre-traffic checks are run if they are configured in the strategy, so
+// they are usually removed from the strategy to plan as if they pass.
+func (r *Rollout) Plan() PlanResult {
+	client := &planClient{Client: r.runClient}
+	r.runClient = client
+	r.notifier, r.archive, r.reconciliationTimeout = nil, nil, 0
+	if r.stateStore != nil {
+		r.stateStore = readOnlyStateStore{r.stateStore}
+	}
+
+	before := copyTraffic(r.service)
+	res := r.Run()
+	after := before
+	if client.replaced != nil {
+		after = copyTraffic(client.replaced)
+	}
+	return PlanResult{
+		Decision: res.Decision,
+		Err:      res.Err,
+		Before:   trafficTargets(before),
+		After:    trafficTargets(after),
+		Changed:  !sameTraffic(before, after),
+	}
+}
+
+// trafficTargets returns the traffic targets as pointers.
+func trafficTargets(traffic []run.TrafficTarget) []*run.TrafficTarget {
+	targets := make([]*run.TrafficTarget, len(traffic))
+	for i := range traffic {
+		targets[i] = &traffic[i]
+	}
+	return targets
+}
+
+// planClient is a Cloud Run client that does not apply the changes of the
+// services, but records the last one so they can be planned.
+type planClient struct {
+	runapi.Client
+	replaced *run.Service
+}
+
+func (c *planClient) Service(namespace, serviceID string) (*run.Service, error) {
+	if c.replaced != nil {
+		return c.replaced, nil
+	}
+	return c.Client.Service(namespace, serviceID)
+}
+
+func (c *planClient) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	c.replaced = svc
+	return svc, nil
+}
+
+// readOnlyStateStore is a state store whose changes are discarded, so the
+// rollouts can be planned from the saved state without changing it.
+type readOnlyStateStore struct {
+	state.Store
+}
+
+func (readOnlyStateStore) Put(ctx context.Context, key string, st *state.State) error {
+	return nil
+}
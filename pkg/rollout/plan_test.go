@@ -0,0 +1,129 @@
+package rollout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	notifyMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify/mock"
+	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	stateMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestPlan(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	tests := []struct {
+		name             string
+		candidatePercent int64
+		lastRollout      int
+		errorRate        float64
+		expectedDecision string
+		expectedAfter    []*run.TrafficTarget
+		expectedChanged  bool
+	}{
+		{
+			name:             "roll forward",
+			candidatePercent: 10,
+			lastRollout:      -20,
+			errorRate:        0.01,
+			expectedDecision: archive.RollForwardDecision,
+			expectedAfter: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expectedChanged: true,
+		},
+		{
+			name:             "rollback",
+			candidatePercent: 10,
+			lastRollout:      -20,
+			errorRate:        0.5,
+			expectedDecision: archive.RollbackDecision,
+			expectedAfter: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expectedChanged: true,
+		},
+		{
+			name:             "not enough time since the last step",
+			candidatePercent: 10,
+			lastRollout:      -1,
+			errorRate:        0.01,
+			expectedDecision: archive.UnchangedDecision,
+			expectedAfter: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			before := []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100 - test.candidatePercent, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: test.candidatePercent, Tag: rollout.CandidateTag},
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation:    "test-001",
+					rollout.CandidateRevisionAnnotation: "test-002",
+					rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, test.lastRollout),
+				},
+				LatestReadyRevision: "test-002",
+				Traffic:             before,
+			})
+			runclient := &runMocker.RunAPI{}
+			runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+				return generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: before}), nil
+			}
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+				return 1000, nil
+			}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return test.errorRate, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			store := &stateMocker.Store{
+				GetFn: func(ctx context.Context, key string) (*state.State, error) { return nil, nil },
+			}
+			strategy := config.Strategy{
+				Steps:               []int64{10, 40, 70},
+				HealthOffsetMinute:  5,
+				TimeBetweenRollouts: 10 * time.Minute,
+				HealthCriteria: []config.HealthCriterion{
+					{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+				},
+			}
+
+			r := rollout.New(context.TODO(), metricsMock, &rollout.ServiceRecord{Service: svc}, strategy).
+				WithClient(runclient).WithClock(clockMock).WithNotifier(notifier).
+				WithStateStore(store, "myproject/us-east1/mysvc")
+			res := r.Plan()
+			assert.Nil(tt, res.Err)
+			assert.Equal(tt, test.expectedDecision, res.Decision)
+			assert.Equal(tt, before, res.Before)
+			assert.Equal(tt, test.expectedAfter, res.After)
+			assert.Equal(tt, test.expectedChanged, res.Changed)
+
+			// Nothing is changed, notified or saved.
+			assert.False(tt, runclient.ReplaceServiceInvoked)
+			assert.Empty(tt, notifier.Events)
+			assert.False(tt, store.PutInvoked)
+		})
+	}
+}
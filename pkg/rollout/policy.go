@@ -0,0 +1,107 @@
+package rollout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// PolicyDeniedError is returned when the policy denies a change of the
+// traffic of the service, which is kept unchanged.
+type PolicyDeniedError struct {
+	Action  string
+	Reasons []string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return fmt.Sprintf("%s denied by policy: %s", e.Action, strings.Join(e.Reasons, "; "))
+}
+
+// IsPolicyDenied determines if the error is caused by a denial of the policy.
+func IsPolicyDenied(err error) bool {
+	_, ok := errors.Cause(err).(*PolicyDeniedError)
+	return ok
+}
+
+// WithPolicy updates the policy evaluated before every change of the traffic
+// in the rollout instance.
+func (r *Rollout) WithPolicy(evaluator policy.Evaluator) *Rollout {
+	r.policy = evaluator
+	return r
+}
+
+// checkPolicy evaluates the policy, if any, for the traffic of the service
+// prepared for the event. A *PolicyDeniedError is returned if the change is
+// denied, after the denial is reported to the notifier.
+//
+// If the policy cannot be evaluated, the change is blocked too, except a
+// rollback, since keeping an unhealthy candidate is worse than bypassing the
+// guardrails.
+func (r *Rollout) checkPolicy(svc *run.Service, stable, candidate string, eventType notify.EventType) error {
+	if r.policy == nil {
+		return nil
+	}
+	input := policy.Input{
+		Action:         policyAction(eventType),
+		Manual:         r.manual,
+		Project:        r.project,
+		Region:         r.region,
+		Service:        r.serviceName,
+		Labels:         svc.Metadata.Labels,
+		Stable:         stable,
+		Candidate:      candidate,
+		CurrentPercent: r.previousPercent,
+		TargetPercent:  revisionTraffic(svc, candidate),
+		Diagnosis:      r.report.Status,
+		FailedChecks:   r.report.FailedChecks(),
+		Steps:          r.strategy.Steps,
+		Time:           r.time.Now(),
+	}
+	if r.namespace != r.project {
+		input.Namespace = r.namespace
+	}
+	if eventType == notify.PromotionEvent {
+		input.TargetPercent = 100
+	}
+	lg := r.log.WithFields(logrus.Fields{"action": input.Action, "targetPercent": input.TargetPercent})
+
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	decision, err := r.policy.Evaluate(ctx, input)
+	if err != nil {
+		if input.Action == archive.RollbackDecision {
+			lg.Warnf("could not evaluate policy, rolling back anyway: %v", err)
+			return nil
+		}
+		return errors.Wrap(err, "failed to evaluate policy")
+	}
+	if decision.Allowed {
+		lg.Debug("action allowed by policy")
+		return nil
+	}
+
+	denied := &PolicyDeniedError{Action: input.Action, Reasons: decision.Reasons}
+	lg.WithField("reasons", decision.Reasons).Warn("action denied by policy")
+	r.denial = denied.Error()
+	r.notify(notify.PolicyDeniedEvent, svc, stable, candidate, r.denial)
+	return denied
+}
+
+// policyAction returns the action of the policy input for the event, named
+// after the decisions of the archive package.
+func policyAction(eventType notify.EventType) string {
+	switch eventType {
+	case notify.PromotionEvent:
+		return archive.PromotionDecision
+	case notify.RollbackEvent:
+		return archive.RollbackDecision
+	default:
+		return archive.RollForwardDecision
+	}
+}
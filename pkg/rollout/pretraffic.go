@@ -0,0 +1,245 @@
+package rollout
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// hasPreTrafficChecks determines if new candidates must be vetted before they
+// receive any real traffic.
+func (r *Rollout) hasPreTrafficChecks() bool {
+	return r.strategy.Probe != nil || r.strategy.WarmUp != nil || r.strategy.Shadow != nil
+}
+
+// handlePreTrafficCandidate vets a new candidate through synthetic probes,
+// synthetic load and/or shadow traffic before it receives any real traffic.
+//
+// The candidate is first tagged with 0% of the traffic so that it gets a tag
+// URL. Once the URL is available, the candidate is diagnosed: if healthy, it is
+// assigned the first step; if unhealthy, it is rolled back; if inconclusive,
+// it is diagnosed again in the next rollout process.
+//
+// If shadow traffic is configured, it starts once the other checks pass and
+// the candidate is diagnosed with its own metrics after the shadow duration.
+func (r *Rollout) handlePreTrafficCandidate(svc *run.Service, stable, candidate string) (*run.Service, error) {
+	url := candidateTagURL(svc, candidate)
+	if url == "" {
+		if findRevisionWithTag(svc, CandidateTag) == candidate {
+			r.log.Debug("candidate's tag URL is not available yet")
+			return nil, nil
+		}
+
+		r.log.Debug("new candidate, tag it for pre-traffic checks")
+		svc = r.PrepareProbe(svc, stable, candidate)
+		svc = r.updateAnnotations(svc, stable, candidate)
+		r.setHealthMessageAnnotations(svc, candidate, "new candidate, waiting for pre-traffic checks")
+
+		err := r.replaceServiceAndNotify(svc, stable, candidate, notify.CandidateDetectedEvent)
+		return svc, errors.Wrap(err, "failed to replace service")
+	}
+
+	if r.strategy.Shadow != nil {
+		if shadowStarted := svc.Metadata.Annotations[ShadowStartedAnnotation]; shadowStarted != "" {
+			return r.handleShadowCandidate(svc, stable, candidate, shadowStarted)
+		}
+	}
+
+	var (
+		criteria  []config.HealthCriterion
+		diagnosis = health.Diagnosis{OverallResult: health.Healthy}
+		err       error
+	)
+	if r.strategy.Probe != nil || r.strategy.WarmUp != nil {
+		criteria, diagnosis, err = r.diagnosePreTraffic(url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to run pre-traffic checks for candidate %q", candidate)
+		}
+	}
+
+	if diagnosis.OverallResult == health.Healthy && r.strategy.Shadow != nil {
+		return r.startShadow(svc, stable, candidate, url)
+	}
+	return r.applyPreTrafficDiagnosis(svc, stable, candidate, criteria, diagnosis)
+}
+
+// applyPreTrafficDiagnosis updates the service based on the diagnosis of a
+// candidate with no traffic.
+func (r *Rollout) applyPreTrafficDiagnosis(svc *run.Service, stable, candidate string, criteria []config.HealthCriterion, diagnosis health.Diagnosis) (*run.Service, error) {
+	switch diagnosis.OverallResult {
+	case health.Inconclusive:
+		r.log.Debug("pre-traffic checks inconclusive")
+		r.notifyInconclusive(svc, stable, candidate, criteria, diagnosis)
+		return nil, nil
+	case health.Healthy:
+		r.log.Debug("candidate passed pre-traffic checks, assign some traffic")
+		svc = r.PrepareRollForward(svc, stable, candidate)
+	case health.Unhealthy:
+		r.log.Info("candidate failed pre-traffic checks, rollback")
+		r.shouldRollback = true
+		svc = r.PrepareRollback(svc, stable, candidate)
+	default:
+		return nil, errors.Errorf("invalid pre-traffic diagnosis %v", diagnosis.OverallResult)
+	}
+
+	svc = r.updateAnnotations(svc, stable, candidate)
+	r.setHealthReportAnnotations(svc, candidate, criteria, diagnosis)
+
+	err := r.replaceServiceAndNotify(svc, stable, candidate, r.trafficEventType())
+	return svc, errors.Wrap(err, "failed to replace service")
+}
+
+// startShadow instructs the mirroring proxy to replay a sample of the
+// production requests to the candidate and records the start time.
+func (r *Rollout) startShadow(svc *run.Service, stable, candidate, url string) (*run.Service, error) {
+	if r.mirrorController == nil {
+		return nil, configErrorf("shadow is configured but no mirror controller was provided")
+	}
+
+	r.log.WithField("url", url).Info("starting shadow traffic for candidate")
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	if err := r.mirrorController.Start(ctx, r.serviceName, url, r.strategy.Shadow.SamplePercent); err != nil {
+		return nil, errors.Wrap(err, "failed to start mirroring requests")
+	}
+
+	svc = r.updateAnnotations(svc, stable, candidate)
+	setAnnotation(svc, ShadowStartedAnnotation, r.time.Now().Format(time.RFC3339))
+	r.setHealthMessageAnnotations(svc, candidate, "new candidate, receiving shadow traffic")
+
+	err := r.replaceServiceAndNotify(svc, stable, candidate, notify.ShadowStartedEvent)
+	return svc, errors.Wrap(err, "failed to replace service")
+}
+
+// handleShadowCandidate diagnoses a candidate receiving shadow traffic once the
+// shadow duration has elapsed.
+//
+// Since the candidate does not receive real traffic, its metrics only reflect
+// the mirrored requests.
+func (r *Rollout) handleShadowCandidate(svc *run.Service, stable, candidate, shadowStarted string) (*run.Service, error) {
+	enoughTime, err := r.hasEnoughTimeElapsed(shadowStarted, r.strategy.Shadow.Duration)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not determine if shadow traffic is complete")
+	}
+	if !enoughTime {
+		r.log.WithField("shadowStarted", shadowStarted).Debug("candidate is still receiving shadow traffic")
+		return nil, nil
+	}
+
+	diagnosis, err := r.diagnoseCandidate(candidate, r.strategy.HealthCriteria)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
+	}
+	if diagnosis.OverallResult == health.Inconclusive {
+		r.log.Debug("shadow traffic diagnosis inconclusive, keep mirroring")
+		r.notifyInconclusive(svc, stable, candidate, r.strategy.HealthCriteria, diagnosis)
+		return nil, nil
+	}
+
+	if r.mirrorController == nil {
+		return nil, configErrorf("shadow is configured but no mirror controller was provided")
+	}
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	if err := r.mirrorController.Stop(ctx, r.serviceName); err != nil {
+		return nil, errors.Wrap(err, "failed to stop mirroring requests")
+	}
+	delete(svc.Metadata.Annotations, ShadowStartedAnnotation)
+
+	return r.applyPreTrafficDiagnosis(svc, stable, candidate, r.strategy.HealthCriteria, diagnosis)
+}
+
+// PrepareProbe keeps all the traffic in the stable revision and tags the
+// candidate so it can be reached through its tag URL.
+func (r *Rollout) PrepareProbe(svc *run.Service, stable, candidate string) *run.Service {
+	traffic := []*run.TrafficTarget{
+		newTrafficTarget(stable, 100, StableTag),
+		newTrafficTarget(candidate, 0, CandidateTag),
+	}
+	traffic = append(traffic, inheritRevisionTags(svc)...)
+
+	svc.Spec.Traffic = traffic
+	return svc
+}
+
+// diagnosePreTraffic runs the configured pre-traffic checks against the
+// candidate's tag URL and returns the diagnosis along with the criteria that
+// were evaluated.
+//
+// Probes run first. If they fail, the synthetic load is not generated.
+func (r *Rollout) diagnosePreTraffic(url string) ([]config.HealthCriterion, health.Diagnosis, error) {
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+
+	var (
+		criteria []config.HealthCriterion
+		values   []float64
+	)
+	if r.strategy.Probe != nil {
+		if r.prober == nil {
+			return nil, health.Diagnosis{}, configErrorf("probe is configured but no prober was provided")
+		}
+
+		r.log.WithField("url", url).Debug("probing candidate")
+		result, err := r.prober.Probe(ctx, url)
+		if err != nil {
+			return nil, health.Diagnosis{}, errors.Wrap(err, "failed to probe")
+		}
+		criteria = append(criteria, config.HealthCriterion{
+			Metric: config.ProbeSuccessRateMetricsCheck, Threshold: r.strategy.Probe.MinSuccessPercent,
+		})
+		values = append(values, result.SuccessPercent())
+
+		diagnosis, err := health.Diagnose(ctx, criteria, values)
+		if err != nil {
+			return nil, health.Diagnosis{}, errors.Wrap(err, "failed to diagnose probe results")
+		}
+		if diagnosis.OverallResult != health.Healthy || r.strategy.WarmUp == nil {
+			return criteria, diagnosis, nil
+		}
+	}
+
+	if r.loadGenerator == nil {
+		return nil, health.Diagnosis{}, configErrorf("warm-up is configured but no load generator was provided")
+	}
+	r.log.WithField("url", url).Debug("generating synthetic load for candidate")
+	result, err := r.loadGenerator.Generate(ctx, url)
+	if err != nil {
+		return nil, health.Diagnosis{}, errors.Wrap(err, "failed to generate synthetic load")
+	}
+
+	// Trace metrics are not available for synthetic load.
+	var warmUpCriteria []config.HealthCriterion
+	for _, criterion := range r.strategy.HealthCriteria {
+		if criterion.Metric != config.TraceErrorRateMetricsCheck && criterion.Metric != config.TraceLatencyMetricsCheck {
+			warmUpCriteria = append(warmUpCriteria, criterion)
+		}
+	}
+	samples, err := health.CollectSamples(ctx, result, r.strategy.WarmUp.Duration, r.strategy.MetricsTimeout, warmUpCriteria)
+	if err != nil {
+		return nil, health.Diagnosis{}, errors.Wrap(err, "failed to collect metrics from synthetic load")
+	}
+	r.samples = samples
+	criteria = append(criteria, warmUpCriteria...)
+	values = append(values, health.Values(samples)...)
+
+	diagnosis, err := health.Diagnose(ctx, criteria, values)
+	return criteria, diagnosis, errors.Wrap(err, "failed to diagnose synthetic load results")
+}
+
+// candidateTagURL returns the URL of the candidate tag if the tag was already
+// assigned to the candidate.
+func candidateTagURL(svc *run.Service, candidate string) string {
+	if svc.Status == nil {
+		return ""
+	}
+	for _, target := range svc.Status.Traffic {
+		if target.Tag == CandidateTag && target.RevisionName == candidate {
+			return target.Url
+		}
+	}
+
+	return ""
+}
@@ -1,6 +1,7 @@
 package rollout
 
 import (
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
 	"google.golang.org/api/run/v1"
 )
 
@@ -9,7 +10,15 @@ import (
 // It first checks if there's a revision with the tag "stable". If such a
 // revision does not exist, it checks for a revision with 100% of the traffic
 // and considers it stable.
+//
+// A deployment of a Cloud Functions (2nd gen) function sends all the traffic
+// to the latest revision, so the stable revision of a function-backed service
+// is the one recorded before the deployment, if any.
 func DetectStableRevisionName(svc *run.Service) string {
+	if stable := functionStableRevisionName(svc); stable != "" {
+		return stable
+	}
+
 	stableRevision := findRevisionWithTag(svc, StableTag)
 	if stableRevision == "" {
 		stableRevision = find100PercentServingRevisionName(svc)
@@ -48,6 +57,24 @@ func DetectCandidateRevisionName(svc *run.Service, stable string) string {
 	return latestRevision
 }
 
+// functionStableRevisionName returns the stable revision recorded in the
+// annotations of the function-backed service if a deployment of the function
+// sent all the traffic to a newer revision.
+func functionStableRevisionName(svc *run.Service) string {
+	if !runapi.IsFunction(svc) || len(svc.Spec.Traffic) != 1 {
+		return ""
+	}
+	target := svc.Spec.Traffic[0]
+	if !target.LatestRevision || target.Percent != 100 {
+		return ""
+	}
+	stable := svc.Metadata.Annotations[StableRevisionAnnotation]
+	if stable == svc.Status.LatestReadyRevisionName {
+		return ""
+	}
+	return stable
+}
+
 // find100PercentServingRevisionName scans the service and retrieves a revision
 // with 100% traffic.
 func find100PercentServingRevisionName(svc *run.Service) string {
@@ -0,0 +1,79 @@
+package rollout
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// serviceLabel is the label set by Cloud Run on the revisions to the name of
+// their service.
+const serviceLabel = "serving.knative.dev/service"
+
+// RollbackTo redirects all the traffic of the service to a previous revision
+// and makes it the stable revision, as an operator-driven alternative to
+// changing the traffic by hand.
+//
+// The latest ready revision, if it is not the target, is considered a failed
+// candidate so it is not rolled out again until a new revision is deployed.
+func (r *Rollout) RollbackTo(revision string) error {
+	r.log = r.log.WithFields(logrus.Fields{
+		"project":  r.project,
+		"service":  r.serviceName,
+		"region":   r.region,
+		"revision": revision,
+	})
+	r.manual = true
+
+	svc, err := r.updateWithRetries(func(svc *run.Service) (*run.Service, error) {
+		return r.rollbackTo(svc, revision, fmt.Sprintf("manual rollback to revision %s", revision))
+	})
+	err = classify(err)
+	r.record(svc, err)
+	return errors.Wrapf(err, "failed to roll back to revision %q", revision)
+}
+
+// rollbackTo updates the traffic and the annotations of the service for the
+// rollback to the revision. The message is set as the health report.
+func (r *Rollout) rollbackTo(svc *run.Service, revision, message string) (*run.Service, error) {
+	rev, err := r.runClient.Revision(r.namespace, revision)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not retrieve revision %q", revision)
+	}
+	if rev == nil || rev.Metadata == nil {
+		return nil, configErrorf("revision %q not found", revision)
+	}
+	if service := rev.Metadata.Labels[serviceLabel]; service != "" && service != r.serviceName {
+		return nil, configErrorf("revision %q belongs to service %q", revision, service)
+	}
+	r.stable = revision
+	if latest := svc.Status.LatestReadyRevisionName; latest != revision {
+		r.candidate = latest
+	}
+	r.previousPercent = revisionTraffic(svc, r.candidate)
+	r.shouldRollback = r.candidate != ""
+
+	traffic := []*run.TrafficTarget{newTrafficTarget(revision, 100, StableTag)}
+	if r.candidate != "" {
+		traffic = append(traffic, newTrafficTarget(r.candidate, 0, CandidateTag))
+	}
+	svc.Spec.Traffic = append(traffic, inheritRevisionTags(svc)...)
+	r.log.Info("rolling back")
+
+	if r.shouldRollback {
+		svc = r.updateAnnotations(svc, revision, r.candidate)
+	} else {
+		// The target is the latest revision, so there's no candidate to
+		// block anymore.
+		r.promoteToStable = true
+		svc = r.updateAnnotations(svc, revision, revision)
+		delete(svc.Metadata.Annotations, LastFailedCandidateRevisionAnnotation)
+	}
+	r.setHealthMessageAnnotations(svc, r.candidate, message)
+
+	err = r.replaceServiceAndNotify(svc, revision, r.candidate, notify.RollbackEvent)
+	return svc, errors.Wrap(err, "failed to replace service")
+}
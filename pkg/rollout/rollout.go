@@ -2,13 +2,26 @@ package rollout
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/attestation"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/mirror"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe"
 	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/tracing"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
 	"github.com/jonboulle/clockwork"
@@ -17,6 +30,13 @@ import (
 	"google.golang.org/api/run/v1"
 )
 
+// DecisionEvent is the value of the event field of the log entry of every
+// rollout decision. The entry has the fields event, project, region, service,
+// stable, candidate, percent (of the candidate after the decision), decision
+// (see the decisions of the archive package) and, if set, namespace,
+// diagnosis, failedChecks, error and errorKind (see ErrorKind).
+const DecisionEvent = "rolloutDecision"
+
 // Annotations name for information related to the rollout.
 const (
 	StableRevisionAnnotation              = "rollout.cloud.run/stableRevision"
@@ -24,35 +44,144 @@ const (
 	LastFailedCandidateRevisionAnnotation = "rollout.cloud.run/lastFailedCandidateRevision"
 	LastRolloutAnnotation                 = "rollout.cloud.run/lastRollout"
 	LastHealthReportAnnotation            = "rollout.cloud.run/lastHealthReport"
+	LastHealthReportJSONAnnotation        = "rollout.cloud.run/lastHealthReportJSON"
+	ShadowStartedAnnotation               = "rollout.cloud.run/shadowStarted"
+	LastHealthSamplesAnnotation           = "rollout.cloud.run/lastHealthSamples"
+
+	// CommitSHAAnnotation is set by users in the revision template to the
+	// commit the revision is built from.
+	CommitSHAAnnotation = "rollout.cloud.run/commitSha"
 )
 
+// CommitSHALabel is an alternative to CommitSHAAnnotation, since labels can be
+// set when deploying with gcloud (e.g. --labels=commit-sha=$COMMIT_SHA).
+const CommitSHALabel = "commit-sha"
+
 // ServiceRecord holds a service object and information about it.
 type ServiceRecord struct {
 	*run.Service
 	Project string
 	Region  string
+
+	// Namespace is the namespace of the service in the API. Empty means the
+	// project, as in Cloud Run (fully managed).
+	Namespace string
+}
+
+// APINamespace returns the namespace of the service in the API.
+func (s *ServiceRecord) APINamespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+	return s.Project
 }
 
 // Rollout is the rollout manager.
 type Rollout struct {
-	ctx             context.Context
-	metricsProvider metrics.Provider
-	service         *run.Service
-	serviceName     string
-	project         string
-	region          string
-	strategy        config.Strategy
-	runClient       runapi.Client
-	log             *logrus.Entry
-	time            clockwork.Clock
+	ctx              context.Context
+	metricsProvider  metrics.Provider
+	service          *run.Service
+	serviceName      string
+	project          string
+	region           string
+	namespace        string
+	strategy         config.Strategy
+	runClient        runapi.Client
+	prober           probe.Prober
+	loadGenerator    loadgen.Generator
+	mirrorController mirror.Controller
+	notifier         notify.Notifier
+	policy           policy.Evaluator
+	log              *logrus.Entry
+	time             clockwork.Clock
+
+	// Traffic of the service when it was retrieved, or last updated by the
+	// operator, to detect the concurrent changes to the traffic.
+	readTraffic []run.TrafficTarget
 
 	// Used to determine if candidate should become stable during update.
 	promoteToStable bool
 
 	// Used to update annotations when rollback should occur.
 	shouldRollback bool
+
+	// Set if the rollout of the service is paused, and if the traffic changes
+	// are paused fleet-wide.
+	paused      bool
+	fleetPaused bool
+
+	// Release group of the service, if any, and whether the candidate waits
+	// for the other members of the group.
+	group   *ReleaseGroup
+	waiting bool
+
+	// Set if the change was requested by a user (e.g. a manual promotion).
+	manual bool
+
+	// Reason the policy denied the change of the traffic, if it did.
+	denial string
+
+	// Raw data used for the last diagnosis, and its JSON report if recorded.
+	samples       []health.Sample
+	samplesReport string
+
+	// Last health report set in the service, its rendered version and the
+	// format it was rendered in.
+	report         health.Report
+	renderedReport string
+	renderedFormat config.ReportFormat
+
+	// Time of the record of the rollout cycle, once fixed (see recordTime).
+	recordedAt time.Time
+
+	// Revisions detected in the last update of the service.
+	stable, candidate string
+
+	// Candidate's traffic before the update.
+	previousPercent int64
+
+	// Set when the healthy streak of the candidate changed in the service
+	// but was not saved yet.
+	unsavedStreak bool
+
+	// Commit of the candidate, looked up once for the notifications.
+	commitSHA      string
+	commitLookedUp bool
+
+	// Candidate revision and the metadata of its container image, looked up
+	// once.
+	revision         *run.Revision
+	revisionLookedUp bool
+	imageInspector   image.Inspector
+	image            *image.Metadata
+	imageLookedUp    bool
+
+	// Verifier of the attestations and scanner of the vulnerabilities of the
+	// images of the candidates.
+	attestationVerifier  attestation.Verifier
+	vulnerabilityScanner vulnerability.Scanner
+
+	// Maximum time to wait for the traffic split to be applied after the
+	// update of the service, zero to not wait.
+	reconciliationTimeout time.Duration
+
+	// Store of the rollout state, if any, and the state of the service.
+	stateStore state.Store
+	stateKey   string
+	state      *state.State
+
+	// Archive of the rollout cycles, if any.
+	archive archive.Archive
 }
 
+// maxConflictRetries is the maximum number of times the rollout of a service
+// is re-evaluated because the service was modified concurrently.
+const maxConflictRetries = 3
+
+// reconciliationInterval is the time between the checks of the traffic split
+// applied to the service.
+const reconciliationInterval = 2 * time.Second
+
 // Automatic tags.
 const (
 	StableTag    = "stable"
@@ -69,9 +198,11 @@ func New(ctx context.Context, metricsProvider metrics.Provider, svcRecord *Servi
 		ctx:             ctx,
 		metricsProvider: metricsProvider,
 		service:         svcRecord.Service,
+		readTraffic:     copyTraffic(svcRecord.Service),
 		serviceName:     svcRecord.Metadata.Name,
 		project:         svcRecord.Project,
 		region:          svcRecord.Region,
+		namespace:       svcRecord.APINamespace(),
 		strategy:        strategy,
 		log:             logrus.NewEntry(logrus.New()),
 		time:            clockwork.NewRealClock(),
@@ -84,6 +215,66 @@ func (r *Rollout) WithClient(client runapi.Client) *Rollout {
 	return r
 }
 
+// WithProber updates the prober used to vet new candidates in the rollout
+// instance.
+func (r *Rollout) WithProber(prober probe.Prober) *Rollout {
+	r.prober = prober
+	return r
+}
+
+// WithLoadGenerator updates the generator of synthetic load used to vet new
+// candidates in the rollout instance.
+func (r *Rollout) WithLoadGenerator(generator loadgen.Generator) *Rollout {
+	r.loadGenerator = generator
+	return r
+}
+
+// WithMirrorController updates the controller of the mirroring proxy used to
+// send shadow traffic to new candidates in the rollout instance.
+func (r *Rollout) WithMirrorController(controller mirror.Controller) *Rollout {
+	r.mirrorController = controller
+	return r
+}
+
+// WithNotifier updates the notifier alerted when the traffic to the candidate
+// changes in the rollout instance.
+func (r *Rollout) WithNotifier(notifier notify.Notifier) *Rollout {
+	r.notifier = notifier
+	return r
+}
+
+// WithReconciliationTimeout updates the maximum time the rollout instance
+// waits for the traffic split to be applied after updating the service. Zero
+// disables the wait.
+func (r *Rollout) WithReconciliationTimeout(timeout time.Duration) *Rollout {
+	r.reconciliationTimeout = timeout
+	return r
+}
+
+// WithStateStore updates the store of the rollout state in the rollout
+// instance. The state of the service is saved with the key, and the
+// annotations of the service only mirror it.
+func (r *Rollout) WithStateStore(store state.Store, key string) *Rollout {
+	r.stateStore = store
+	r.stateKey = key
+	return r
+}
+
+// WithArchive updates the archive where the outcome of the rollout cycle is
+// recorded in the rollout instance.
+func (r *Rollout) WithArchive(archive archive.Archive) *Rollout {
+	r.archive = archive
+	return r
+}
+
+// WithFleetPause pauses the traffic changes of the rollout instance, as part
+// of a fleet-wide pause (e.g. during a major incident): the candidate is still
+// diagnosed and the cycle recorded, but the service is left untouched.
+func (r *Rollout) WithFleetPause(paused bool) *Rollout {
+	r.fleetPaused = paused
+	return r
+}
+
 // WithLogger updates the logger in the rollout instance.
 func (r *Rollout) WithLogger(logger *logrus.Logger) *Rollout {
 	r.log = logger.WithField("project", r.project)
@@ -96,31 +287,206 @@ func (r *Rollout) WithClock(clock clockwork.Clock) *Rollout {
 	return r
 }
 
-// Rollout handles the gradual rollout.
+// Rollout handles the gradual rollout. It returns true if the service was
+// updated.
 func (r *Rollout) Rollout() (bool, error) {
+	result := r.Run()
+	return result.Changed, result.Err
+}
+
+// Run handles the gradual rollout and returns the outcome of the cycle, with
+// its error typed after its cause.
+func (r *Rollout) Run() (result RolloutResult) {
 	r.log = r.log.WithFields(logrus.Fields{
 		"project": r.project,
 		"service": r.serviceName,
 		"region":  r.region,
 	})
+	if r.group != nil {
+		defer func() { r.group.record(r.groupMember(), result.Decision, r.waiting) }()
+	}
 
-	svc, err := r.UpdateService(r.service)
-	if err != nil {
-		return false, errors.Wrapf(err, "failed to perform rollout")
+	// The update is rejected if the service was modified since it was
+	// retrieved (e.g. by a deployment), so the rollout is re-evaluated for
+	// the latest version of the service instead of overwriting the changes.
+	for attempt := 0; ; attempt++ {
+		svc, err := r.UpdateService(r.service)
+		if IsPolicyDenied(err) {
+			// The denial is part of the decision, not a failure.
+			return RolloutResult{Decision: r.record(nil, nil)}
+		}
+		if err == nil {
+			// Service is non-nil only when the replacement of the service succeded.
+			return RolloutResult{Changed: svc != nil, Decision: r.record(svc, nil)}
+		}
+		if !runapi.IsConflict(err) || attempt == maxConflictRetries {
+			err = classify(err)
+			return RolloutResult{Decision: r.record(svc, err), Err: errors.Wrap(err, "failed to perform rollout")}
+		}
+
+		r.log.Info("service was modified concurrently, re-evaluating rollout")
+		svc, err = r.runClient.Service(r.namespace, r.serviceName)
+		if err != nil {
+			err = classify(errors.Wrap(err, "failed to retrieve the modified service"))
+			return RolloutResult{Decision: archive.ErrorDecision, Err: err}
+		}
+		r.resetState(svc)
+	}
+}
+
+// resetState discards the state of a rollout attempt before the rollout of
+// the service is re-evaluated.
+func (r *Rollout) resetState(svc *run.Service) {
+	r.service = svc
+	r.readTraffic = copyTraffic(svc)
+	r.promoteToStable = false
+	r.shouldRollback = false
+	r.paused = false
+	r.waiting = false
+	r.unsavedStreak = false
+	r.denial = ""
+	r.samples = nil
+	r.samplesReport = ""
+	r.report = health.Report{}
+	r.renderedReport = ""
+	r.renderedFormat = ""
+	r.recordedAt = time.Time{}
+	r.stable, r.candidate = "", ""
+	r.revision, r.revisionLookedUp = nil, false
+	r.image, r.imageLookedUp = nil, false
+}
+
+// record logs the outcome of the rollout cycle and writes it to the archive,
+// if any, and returns its decision. The service is nil if it was not updated.
+// Failing to write the record does not fail the rollout.
+func (r *Rollout) record(svc *run.Service, err error) string {
+	record := archive.Record{
+		Time:             r.recordTime(),
+		Project:          r.project,
+		Region:           r.region,
+		Service:          r.serviceName,
+		Stable:           r.stable,
+		Candidate:        r.candidate,
+		CandidatePercent: r.previousPercent,
+		RenderedReport:   r.renderedReport,
+	}
+	if r.namespace != r.project {
+		record.Namespace = r.namespace
+	}
+	if r.report.Status != "" {
+		report := r.report
+		record.Report = &report
+	}
+	if r.samplesReport != "" {
+		record.Samples = json.RawMessage(r.samplesReport)
+	}
+	switch {
+	case err != nil:
+		record.Decision, record.Error, record.ErrorKind = archive.ErrorDecision, err.Error(), ErrorKind(err)
+	case r.paused:
+		record.Decision = archive.PausedDecision
+	case r.denial != "":
+		record.Decision, record.Denial = archive.DeniedDecision, r.denial
+	case r.candidate == "":
+		record.Decision = archive.NoCandidateDecision
+	case svc == nil:
+		record.Decision = archive.UnchangedDecision
+	case r.promoteToStable:
+		record.Decision = archive.PromotionDecision
+	case r.shouldRollback:
+		record.Decision = archive.RollbackDecision
+	default:
+		record.Decision = archive.RollForwardDecision
+	}
+	if svc != nil && err == nil {
+		record.CandidatePercent = revisionTraffic(svc, r.candidate)
 	}
 
-	// Service is non-nil only when the replacement of the service succeded.
-	return (svc != nil), nil
+	r.logDecision(record)
+	if r.archive == nil {
+		return record.Decision
+	}
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	if err := r.archive.Record(ctx, record); err != nil {
+		r.log.Warnf("could not archive rollout cycle: %v", err)
+	}
+	return record.Decision
+}
+
+// recordTime returns the time of the record of the rollout cycle. It is fixed
+// the first time it is needed, so the record can be located before it is
+// archived (see fullReportLocation).
+func (r *Rollout) recordTime() time.Time {
+	if r.recordedAt.IsZero() {
+		r.recordedAt = r.time.Now()
+	}
+	return r.recordedAt
+}
+
+// logDecision logs the decision of the rollout cycle with the fields of the
+// DecisionEvent schema. Cycles that change nothing are logged at debug level.
+func (r *Rollout) logDecision(record archive.Record) {
+	fields := logrus.Fields{
+		"event":     DecisionEvent,
+		"project":   record.Project,
+		"region":    record.Region,
+		"service":   record.Service,
+		"stable":    record.Stable,
+		"candidate": record.Candidate,
+		"percent":   record.CandidatePercent,
+		"decision":  record.Decision,
+	}
+	if record.Namespace != "" {
+		fields["namespace"] = record.Namespace
+	}
+	if record.Report != nil {
+		fields["diagnosis"] = record.Report.Status
+		if failed := record.Report.FailedChecks(); len(failed) != 0 {
+			fields["failedChecks"] = failed
+		}
+	}
+	lg := r.log.WithFields(fields)
+	switch record.Decision {
+	case archive.ErrorDecision:
+		lg.WithFields(logrus.Fields{"error": record.Error, "errorKind": record.ErrorKind}).Warn("rollout decision")
+	case archive.NoCandidateDecision, archive.UnchangedDecision:
+		lg.Debug("rollout decision")
+	default:
+		lg.Info("rollout decision")
+	}
 }
 
 // UpdateService changes the traffic configuration for the revisions and update
 // the service.
 func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, error) {
+	updated, err := r.updateService(svc)
+	if err == nil && r.unsavedStreak {
+		// The cycle made no other change of the service to save the streak
+		// with, e.g. the traffic is kept until the streak is complete.
+		err = errors.Wrap(r.replaceService(svc), "failed to save healthy streak")
+	}
+	return updated, err
+}
+
+// updateService handles the rollout of the service, which is replaced if its
+// traffic or annotations change.
+func (r *Rollout) updateService(svc *run.Service) (*run.Service, error) {
+	if err := r.loadState(svc); err != nil {
+		return nil, err
+	}
+
+	if paused := svc.Metadata.Annotations[PausedAnnotation]; paused != "" {
+		r.log.WithField("pausedSince", paused).Info("rollout paused")
+		r.paused = true
+		return nil, nil
+	}
+
 	stable := DetectStableRevisionName(svc)
 	if stable == "" {
 		r.log.Info("could not determine stable revision")
 		return nil, nil
 	}
+	r.stable = stable
 
 	candidate := DetectCandidateRevisionName(svc, stable)
 	if candidate == "" {
@@ -128,15 +494,58 @@ func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, error) {
 		return nil, nil
 	}
 	r.log = r.log.WithFields(logrus.Fields{"stable": stable, "candidate": candidate})
+	r.candidate = candidate
+	r.previousPercent = revisionTraffic(svc, candidate)
+
+	if r.fleetPaused {
+		return nil, r.observe(svc, candidate)
+	}
+
+	if r.group != nil {
+		if failed := r.group.Failed(); failed != "" && failed != r.groupMember() {
+			return r.rollbackWithGroup(svc, stable, candidate)
+		}
+		// A pending candidate with traffic is still diagnosed, so it can be
+		// rolled back, but a new one gets no traffic.
+		if r.group.pending(r.groupMember()) && isNewCandidate(svc, candidate) {
+			r.log.WithField("releaseGroup", r.group.Name).Info("candidate pending on its dependencies")
+			r.waiting = true
+			return nil, nil
+		}
+	}
 
 	// A new candidate does not have metrics yet, so it can't be diagnosed.
 	if isNewCandidate(svc, candidate) {
+		if r.strategy.Attestation != nil {
+			reason, err := r.attestationRefusal(candidate)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to verify attestations of candidate %q", candidate)
+			}
+			if reason != "" {
+				return r.refuseCandidate(svc, stable, candidate, AttestationRefusedAnnotation, notify.AttestationRefusedEvent, reason)
+			}
+			delete(svc.Metadata.Annotations, AttestationRefusedAnnotation)
+		}
+		if r.strategy.VulnerabilityScan != nil {
+			reason, err := r.vulnerabilityRefusal(candidate)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check vulnerabilities of candidate %q", candidate)
+			}
+			if reason != "" {
+				return r.refuseCandidate(svc, stable, candidate, VulnerabilitiesRefusedAnnotation, notify.VulnerabilitiesRefusedEvent, reason)
+			}
+			delete(svc.Metadata.Annotations, VulnerabilitiesRefusedAnnotation)
+		}
+		if r.hasPreTrafficChecks() {
+			return r.handlePreTrafficCandidate(svc, stable, candidate)
+		}
+
 		r.log.Debug("new candidate, assign some traffic")
 		svc = r.PrepareRollForward(svc, stable, candidate)
 		svc = r.updateAnnotations(svc, stable, candidate)
-		r.setHealthReportAnnotation(svc, "new candidate, no health report available yet")
+		r.setHealthMessageAnnotations(svc, candidate, "new candidate, no health report available yet")
 
-		err := r.replaceService(svc)
+		err := r.replaceServiceAndNotify(svc, stable, candidate, notify.CandidateDetectedEvent)
 		return svc, errors.Wrap(err, "failed to replace service")
 	}
 
@@ -145,7 +554,49 @@ func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, error) {
 		r.log.Error("could not diagnose candidate's health")
 		return nil, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
 	}
+	healthCriteria, diagnosis, err := r.verifyTrafficSplit(svc, stable, candidate, r.strategy.HealthCriteria, diagnosis)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
+	}
+	diagnosis, err = r.compareWithStable(stable, candidate, healthCriteria, diagnosis)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
+	}
+
+	if diagnosis.OverallResult == health.Inconclusive {
+		r.notifyInconclusive(svc, stable, candidate, healthCriteria, diagnosis)
+	}
+	if !r.countHealthyStreak(svc, diagnosis.OverallResult) {
+		return nil, r.checkStuck(svc, stable, candidate)
+	}
+	if diagnosis.OverallResult == health.Unhealthy && r.holdsUnhealthy() {
+		return nil, r.holdUnhealthy(svc, stable, candidate, healthCriteria, diagnosis)
+	}
 
+	// Vulnerabilities can be found after the candidate received traffic,
+	// since the images are scanned continuously, so the scan is checked
+	// again before each traffic increase.
+	if diagnosis.OverallResult == health.Healthy && r.strategy.VulnerabilityScan != nil {
+		ready, err := r.readyToRollForward(svc)
+		if err != nil {
+			return nil, err
+		}
+		if ready {
+			reason, err := r.vulnerabilityRefusal(candidate)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check vulnerabilities of candidate %q", candidate)
+			}
+			if reason != "" && r.previousPercent >= 100 {
+				return r.rollbackRefusedCandidate(svc, stable, candidate, reason)
+			}
+			if reason != "" {
+				return r.refuseCandidate(svc, stable, candidate, VulnerabilitiesRefusedAnnotation, notify.VulnerabilitiesRefusedEvent, reason)
+			}
+			delete(svc.Metadata.Annotations, VulnerabilitiesRefusedAnnotation)
+		}
+	}
+
+	current := svc
 	svc, err = r.updateServiceBasedOnDiagnosis(svc, diagnosis.OverallResult, stable, candidate)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to update service after diagnosis")
@@ -154,17 +605,41 @@ func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, error) {
 		// If service was unchanged, nil is returned.
 		// TODO(gvso): This should go away once we start getting traffic config
 		// object from updateServiceBasedOnDiagnosis.
-		return nil, nil
+		return nil, r.checkStuck(current, stable, candidate)
 	}
 
 	svc = r.updateAnnotations(svc, stable, candidate)
-	report := health.StringReport(r.strategy.HealthCriteria, diagnosis)
-	r.setHealthReportAnnotation(svc, report)
+	r.setHealthReportAnnotations(svc, candidate, healthCriteria, diagnosis)
 
-	err = r.replaceService(svc)
+	err = r.replaceServiceAndNotify(svc, stable, candidate, r.trafficEventType())
 	return svc, errors.Wrap(err, "failed to replace service")
 }
 
+// readyToRollForward checks whether the traffic of a healthy candidate can be
+// increased: enough time elapsed since the last rollout, and the other members
+// of its release group, if any, caught up.
+func (r *Rollout) readyToRollForward(svc *run.Service) (bool, error) {
+	lastRollout := svc.Metadata.Annotations[LastRolloutAnnotation]
+	enoughTime, err := r.hasEnoughTimeElapsed(lastRollout, r.strategy.TimeBetweenRollouts)
+	if err != nil {
+		return false, errors.Wrap(err, "could not determine if roll out is allowed")
+	}
+	if !enoughTime {
+		r.log.WithField("lastRollout", lastRollout).Debug("no enough time elapsed since last roll out")
+		return false, nil
+	}
+	if r.group != nil && !r.group.mayAdvance(r.groupMember(), r.previousPercent) {
+		r.log.WithFields(logrus.Fields{
+			"releaseGroup": r.group.Name,
+			"groupStep":    r.group.Step(),
+			"pending":      r.group.pending(r.groupMember()),
+		}).Info("waiting for the other members of the release group")
+		r.waiting = true
+		return false, nil
+	}
+	return true, nil
+}
+
 // PrepareRollForward changes the traffic configuration of the service to
 // increase the traffic to the candidate.
 //
@@ -230,20 +705,18 @@ func (r *Rollout) updateServiceBasedOnDiagnosis(svc *run.Service, diagnosis heal
 		return nil, nil
 	case health.Healthy:
 		r.log.Debug("healthy candidate")
-		lastRollout := svc.Metadata.Annotations[LastRolloutAnnotation]
-		enoughTime, err := r.hasEnoughTimeElapsed(lastRollout, r.strategy.TimeBetweenRollouts)
-		if err != nil {
-			return nil, errors.Wrap(err, "could not determine if roll out is allowed")
-		}
-		if !enoughTime {
-			r.log.WithField("lastRollout", lastRollout).Debug("no enough time elapsed since last roll out")
-			return nil, nil
+		ready, err := r.readyToRollForward(svc)
+		if !ready || err != nil {
+			return nil, err
 		}
 		r.log.Debug("rolling forward")
 		svc = r.PrepareRollForward(svc, stable, candidate)
 	case health.Unhealthy:
 		r.log.Info("unhealthy candidate, rollback")
 		r.shouldRollback = true
+		if r.group != nil {
+			r.group.fail(r.groupMember())
+		}
 		svc = r.PrepareRollback(svc, stable, candidate)
 	default:
 		return nil, errors.Errorf("invalid candidate's health diagnosis %v", diagnosis)
@@ -252,10 +725,336 @@ func (r *Rollout) updateServiceBasedOnDiagnosis(svc *run.Service, diagnosis heal
 	return svc, nil
 }
 
+// serviceAnnotations are the annotations of the service managed by the
+// operator.
+var serviceAnnotations = []string{
+	StableRevisionAnnotation,
+	CandidateRevisionAnnotation,
+	LastFailedCandidateRevisionAnnotation,
+	LastRolloutAnnotation,
+	LastHealthReportAnnotation,
+	LastHealthReportJSONAnnotation,
+	ShadowStartedAnnotation,
+	LastHealthSamplesAnnotation,
+	PausedAnnotation,
+	StuckSinceAnnotation,
+	UnhealthySinceAnnotation,
+	HealthyStreakAnnotation,
+	CandidateImageAnnotation,
+	CandidateCommitSHAAnnotation,
+	CandidateBuildURLAnnotation,
+	AttestationRefusedAnnotation,
+	VulnerabilitiesRefusedAnnotation,
+}
+
 // replaceService updates the service object in Cloud Run.
+//
+// Only the traffic and the annotations of the operator are applied, onto the
+// latest version of the service retrieved right before the update, so
+// concurrent changes to the rest of the service (e.g. environment variables)
+// are not undone. If a new revision became ready in the meantime, the traffic
+// computed for the previous revisions is obsolete and runapi.ErrConflict is
+// returned. The same goes if the traffic was changed (e.g. by hand) since the
+// service was retrieved, so the change is not overwritten.
 func (r *Rollout) replaceService(svc *run.Service) error {
-	_, err := r.runClient.ReplaceService(r.project, r.serviceName, svc)
-	return errors.Wrapf(err, "could not update service %q", r.serviceName)
+	latest, err := r.runClient.Service(r.namespace, r.serviceName)
+	if err != nil {
+		return errors.Wrapf(err, "could not retrieve latest version of service %q", r.serviceName)
+	}
+	if latest.Status.LatestReadyRevisionName != svc.Status.LatestReadyRevisionName {
+		return errors.Wrapf(runapi.ErrConflict, "revision %q became ready", latest.Status.LatestReadyRevisionName)
+	}
+	// The traffic might already be the new one, which overwrites nothing.
+	if traffic := copyTraffic(latest); !sameTraffic(traffic, r.readTraffic) && !sameTraffic(traffic, copyTraffic(svc)) {
+		return errors.Wrap(runapi.ErrConflict, "traffic of the service was changed")
+	}
+
+	latest.Spec.Traffic = svc.Spec.Traffic
+	if latest.Metadata.Annotations == nil {
+		latest.Metadata.Annotations = make(map[string]string)
+	}
+	for _, key := range serviceAnnotations {
+		if value, ok := svc.Metadata.Annotations[key]; ok {
+			latest.Metadata.Annotations[key] = value
+		} else {
+			delete(latest.Metadata.Annotations, key)
+		}
+	}
+
+	_, span := tracing.Start(r.ctx, "ReplaceService")
+	_, err = r.runClient.ReplaceService(r.namespace, r.serviceName, latest)
+	span.End(err)
+	if err != nil {
+		return errors.Wrapf(err, "could not update service %q", r.serviceName)
+	}
+	r.readTraffic = copyTraffic(latest)
+	r.unsavedStreak = false
+	if err := r.saveState(svc); err != nil {
+		return err
+	}
+	return r.waitForTraffic(latest.Spec.Traffic)
+}
+
+// copyTraffic returns a copy of the traffic targets of the service.
+func copyTraffic(svc *run.Service) []run.TrafficTarget {
+	if svc == nil || svc.Spec == nil {
+		return nil
+	}
+	traffic := make([]run.TrafficTarget, 0, len(svc.Spec.Traffic))
+	for _, target := range svc.Spec.Traffic {
+		if target != nil {
+			traffic = append(traffic, *target)
+		}
+	}
+	return traffic
+}
+
+// sameTraffic determines if the traffic targets are the same, in the same
+// order.
+func sameTraffic(a, b []run.TrafficTarget) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].RevisionName != b[i].RevisionName || a[i].Percent != b[i].Percent ||
+			a[i].LatestRevision != b[i].LatestRevision || a[i].Tag != b[i].Tag ||
+			a[i].ConfigurationName != b[i].ConfigurationName {
+			return false
+		}
+	}
+	return true
+}
+
+// stateAnnotations are the annotations of the service that mirror the state
+// in the store.
+var stateAnnotations = map[string]func(*state.State) *string{
+	StableRevisionAnnotation:              func(s *state.State) *string { return &s.Stable },
+	CandidateRevisionAnnotation:           func(s *state.State) *string { return &s.Candidate },
+	LastFailedCandidateRevisionAnnotation: func(s *state.State) *string { return &s.LastFailedCandidate },
+	LastRolloutAnnotation:                 func(s *state.State) *string { return &s.LastRollout },
+	HealthyStreakAnnotation:               func(s *state.State) *string { return &s.HealthyStreak },
+}
+
+// loadState retrieves the state of the service from the store, if any, and
+// mirrors it in the annotations, overriding changes made by users. Services
+// without state yet, or whose state only has a past quarantine, are migrated
+// from their annotations.
+func (r *Rollout) loadState(svc *run.Service) error {
+	if r.stateStore == nil {
+		return nil
+	}
+	st, err := r.stateStore.Get(r.ctx, r.stateKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve rollout state")
+	}
+	if st == nil || st.Stable == "" && st.Candidate == "" && st.LastRollout == "" {
+		r.log.Debug("no rollout state, using the annotations")
+		if st == nil {
+			st = &state.State{}
+		}
+		for key, field := range stateAnnotations {
+			*field(st) = svc.Metadata.Annotations[key]
+		}
+	}
+	r.state = st
+
+	for key, field := range stateAnnotations {
+		if value := *field(st); value != "" {
+			setAnnotation(svc, key, value)
+		} else {
+			delete(svc.Metadata.Annotations, key)
+		}
+	}
+	return nil
+}
+
+// saveState records the updated service in the state and saves it in the
+// store, if any.
+func (r *Rollout) saveState(svc *run.Service) error {
+	if r.stateStore == nil {
+		return nil
+	}
+	if r.state == nil {
+		r.state = &state.State{}
+	}
+	for key, field := range stateAnnotations {
+		*field(r.state) = svc.Metadata.Annotations[key]
+	}
+
+	step := state.Step{Candidate: r.state.Candidate, Time: r.time.Now()}
+	switch {
+	case r.promoteToStable:
+		step.Candidate, step.Outcome = r.state.Stable, state.PromotedOutcome
+		r.state.FailureStreak = 0
+	case r.shouldRollback:
+		step.Outcome = state.RolledBackOutcome
+		r.state.FailureStreak++
+	}
+	for _, target := range svc.Spec.Traffic {
+		if target.RevisionName == step.Candidate {
+			step.Percent += target.Percent
+		}
+	}
+	r.state.AddStep(step)
+
+	return errors.Wrap(r.stateStore.Put(r.ctx, r.stateKey, r.state), "failed to save rollout state")
+}
+
+// waitForTraffic polls the service until its status reports the traffic split
+// of the spec, so the next diagnosis is not based on a split that never took
+// effect. The time it took is logged.
+func (r *Rollout) waitForTraffic(traffic []*run.TrafficTarget) error {
+	if r.reconciliationTimeout == 0 {
+		return nil
+	}
+	start := r.time.Now()
+	for {
+		svc, err := r.runClient.Service(r.namespace, r.serviceName)
+		if err != nil {
+			return errors.Wrapf(err, "could not retrieve service %q", r.serviceName)
+		}
+		if trafficReconciled(traffic, svc.Status.Traffic) {
+			r.log.WithField("reconciliationLatency", r.time.Since(start).String()).Info("traffic split applied")
+			return nil
+		}
+		if r.time.Since(start) >= r.reconciliationTimeout {
+			return &TransientAPIError{Err: errors.Errorf("traffic split of service %q not applied after %s", r.serviceName, r.reconciliationTimeout)}
+		}
+		if err := r.ctx.Err(); err != nil {
+			return errors.Wrapf(err, "stopped waiting for traffic split of service %q", r.serviceName)
+		}
+		r.time.Sleep(reconciliationInterval)
+	}
+}
+
+// trafficReconciled determines if the traffic split reported in the status
+// matches the split of the spec. The targets are compared by revision, the
+// latest revision being the one marked as such in both.
+func trafficReconciled(spec, status []*run.TrafficTarget) bool {
+	percents := func(traffic []*run.TrafficTarget) map[string]int64 {
+		split := make(map[string]int64)
+		for _, target := range traffic {
+			if target.Percent == 0 {
+				continue
+			}
+			revision := target.RevisionName
+			if target.LatestRevision {
+				revision = ""
+			}
+			split[revision] += target.Percent
+		}
+		return split
+	}
+	return reflect.DeepEqual(percents(spec), percents(status))
+}
+
+// replaceServiceAndNotify updates the service object in Cloud Run, if the
+// policy allows it, and alerts the notifier about the event.
+func (r *Rollout) replaceServiceAndNotify(svc *run.Service, stable, candidate string, eventType notify.EventType) error {
+	if err := r.checkPolicy(svc, stable, candidate, eventType); err != nil {
+		return err
+	}
+	if err := r.replaceService(svc); err != nil {
+		return err
+	}
+	r.notify(eventType, svc, stable, candidate, svc.Metadata.Annotations[LastHealthReportAnnotation])
+	return nil
+}
+
+// trafficEventType returns the type of the event for the traffic
+// configuration prepared for the candidate.
+func (r *Rollout) trafficEventType() notify.EventType {
+	if r.promoteToStable {
+		return notify.PromotionEvent
+	}
+	if r.shouldRollback {
+		return notify.RollbackEvent
+	}
+	return notify.StepAdvancedEvent
+}
+
+// notifyInconclusive alerts the notifier that the candidate's diagnosis was
+// inconclusive, so the service is kept unchanged.
+func (r *Rollout) notifyInconclusive(svc *run.Service, stable, candidate string, healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) {
+	r.report = health.NewReport(healthCriteria, diagnosis)
+	r.renderedReport = health.StringReport(healthCriteria, diagnosis)
+	r.notify(notify.InconclusiveEvent, svc, stable, candidate, r.renderedReport)
+}
+
+// notify sends the event to the notifier, if any. Failing to send the
+// notification does not fail the rollout.
+func (r *Rollout) notify(eventType notify.EventType, svc *run.Service, stable, candidate, report string) {
+	if r.notifier == nil {
+		return
+	}
+
+	event := notify.Event{
+		Type:             eventType,
+		Project:          r.project,
+		Region:           r.region,
+		Service:          r.serviceName,
+		Stable:           stable,
+		Candidate:        candidate,
+		CandidatePercent: revisionTraffic(svc, candidate),
+		Report:           report,
+		Time:             r.time.Now(),
+		PreviousPercent:  r.previousPercent,
+		Diagnosis:        r.report.Status,
+		Checks:           r.report.Checks,
+		FailedChecks:     r.report.FailedChecks(),
+		CommitSHA:        r.candidateCommitSHA(candidate),
+		Steps:            r.strategy.Steps,
+	}
+	if metadata := r.candidateImage(candidate); metadata != nil {
+		event.Image, event.BuildURL = metadata.Reference(), metadata.BuildURL
+	}
+	if r.group != nil {
+		event.ReleaseGroup = r.group.Name
+	}
+	if report != "" && report == svc.Metadata.Annotations[LastHealthReportAnnotation] {
+		event.ReportFormat = r.reportFormat()
+	}
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	if err := r.notifier.Notify(ctx, event); err != nil {
+		r.log.Warnf("could not send %s notification: %v", event.Type, err)
+	}
+}
+
+// reportFormat returns the format of the health report annotation: the one it
+// was rendered in during this cycle, or else the one of the strategy.
+func (r *Rollout) reportFormat() config.ReportFormat {
+	if r.renderedFormat != "" {
+		return r.renderedFormat
+	}
+	if r.strategy.ReportFormat == "" {
+		return config.TextReportFormat
+	}
+	return r.strategy.ReportFormat
+}
+
+// candidateCommitSHA returns the commit the candidate was built from, set in
+// the revision's CommitSHAAnnotation annotation or CommitSHALabel label, or
+// else in the OCI labels of its image if an image inspector is configured. An
+// empty string is returned if the commit is unknown.
+func (r *Rollout) candidateCommitSHA(candidate string) string {
+	if r.commitLookedUp || candidate == "" {
+		return r.commitSHA
+	}
+	r.commitLookedUp = true
+
+	revision := r.candidateRevision(candidate)
+	if revision == nil {
+		return ""
+	}
+	if sha := revision.Metadata.Annotations[CommitSHAAnnotation]; sha != "" {
+		r.commitSHA = sha
+	} else {
+		r.commitSHA = revision.Metadata.Labels[CommitSHALabel]
+	}
+	if metadata := r.candidateImage(candidate); r.commitSHA == "" && metadata != nil {
+		r.commitSHA = metadata.CommitSHA
+	}
+	return r.commitSHA
 }
 
 // newCandidateTraffic returns the next candidate's traffic configuration.
@@ -266,7 +1065,9 @@ func (r *Rollout) newCandidateTraffic(svc *run.Service, candidate string) (*run.
 	var promoteToStable bool
 	var candidatePercent int64
 	candidateTarget := r.currentCandidateTraffic(svc, candidate)
-	if candidateTarget == nil {
+	// The traffic sent to the candidate by the deployment of a function is
+	// not a step of the rollout.
+	if candidateTarget == nil || functionStableRevisionName(svc) != "" {
 		candidatePercent = r.strategy.Steps[0]
 	} else {
 		candidatePercent = r.nextCandidateTraffic(candidateTarget.Percent)
@@ -336,6 +1137,14 @@ func (r *Rollout) nextCandidateTraffic(current int64) int64 {
 func (r *Rollout) updateAnnotations(svc *run.Service, stable, candidate string) *run.Service {
 	now := r.time.Now().Format(time.RFC3339)
 	setAnnotation(svc, LastRolloutAnnotation, now)
+	delete(svc.Metadata.Annotations, StuckSinceAnnotation)
+	delete(svc.Metadata.Annotations, HealthyStreakAnnotation)
+	// A rollout paused on an unhealthy candidate is resumed once a human
+	// promoted or aborted the candidate.
+	if paused := svc.Metadata.Annotations[PausedAnnotation]; paused != "" && paused == svc.Metadata.Annotations[UnhealthySinceAnnotation] {
+		delete(svc.Metadata.Annotations, PausedAnnotation)
+	}
+	delete(svc.Metadata.Annotations, UnhealthySinceAnnotation)
 
 	// The candidate has become the stable revision.
 	if r.promoteToStable {
@@ -361,26 +1170,130 @@ func setAnnotation(svc *run.Service, key, value string) {
 	svc.Metadata.Annotations[key] = value
 }
 
+// setHealthReportAnnotations sets the health report annotations for the
+// diagnosis.
+func (r *Rollout) setHealthReportAnnotations(svc *run.Service, candidate string, healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) {
+	report := health.StringReport(healthCriteria, diagnosis)
+	r.setHealthReportAnnotation(svc, candidate, report, health.NewReport(healthCriteria, diagnosis))
+}
+
+// setHealthMessageAnnotations sets the health report annotations when the
+// candidate was not diagnosed.
+func (r *Rollout) setHealthMessageAnnotations(svc *run.Service, candidate, message string) {
+	r.setHealthReportAnnotation(svc, candidate, message, health.Report{
+		Status:  health.Unknown.String(),
+		Message: message,
+	})
+}
+
 // setHealthReportAnnotation appends the current time to the report and sets
-// the health report annotation.
-func (r *Rollout) setHealthReportAnnotation(svc *run.Service, report string) {
-	report += fmt.Sprintf("\nlastUpdate: %s", r.time.Now().Format(time.RFC3339))
-	setAnnotation(svc, LastHealthReportAnnotation, report)
+// the health report annotation. The JSON report is completed with the rollout
+// information and set in its own annotation.
+//
+// If a Markdown or HTML report format is configured, the health report
+// annotation is rendered in that format instead of plain text.
+func (r *Rollout) setHealthReportAnnotation(svc *run.Service, candidate, report string, jsonReport health.Report) {
+	now := r.time.Now()
+	jsonReport.Candidate = candidate
+	jsonReport.TrafficStep = revisionTraffic(svc, candidate)
+	jsonReport.LastUpdate = now
+	if len(r.samples) != 0 {
+		jsonReport.Window = r.samples[0].Offset.String()
+	}
+	if metadata := r.candidateImage(candidate); metadata != nil {
+		jsonReport.Image, jsonReport.CommitSHA, jsonReport.BuildURL = metadata.Reference(), r.candidateCommitSHA(candidate), metadata.BuildURL
+		r.setCandidateImageAnnotations(svc, candidate)
+		report += fmt.Sprintf("\nimage: %s", jsonReport.Image)
+		if jsonReport.CommitSHA != "" {
+			report += fmt.Sprintf("\ncommit: %s", jsonReport.CommitSHA)
+		}
+		if jsonReport.BuildURL != "" {
+			report += fmt.Sprintf("\nbuild: %s", jsonReport.BuildURL)
+		}
+	}
+	r.report = jsonReport
+
+	report += fmt.Sprintf("\nlastUpdate: %s", now.Format(time.RFC3339))
+	r.renderedFormat = config.TextReportFormat
+	switch r.strategy.ReportFormat {
+	case config.MarkdownReportFormat, config.HTMLReportFormat:
+		rendered, err := health.RenderReport(r.strategy.ReportFormat, jsonReport, r.strategy.Steps)
+		if err != nil {
+			r.log.Warnf("could not render %s health report, using text: %v", r.strategy.ReportFormat, err)
+			break
+		}
+		report = rendered
+		r.renderedFormat = r.strategy.ReportFormat
+	}
+	r.setReportAnnotation(svc, LastHealthReportAnnotation, report)
+	r.renderedReport = report
+	if err := r.setJSONReportAnnotation(svc, jsonReport); err != nil {
+		r.log.Warnf("could not set JSON health report: %v", err)
+	}
+
+	if r.strategy.RecordSamples {
+		r.setHealthSamplesAnnotation(svc)
+	}
+}
+
+// revisionTraffic returns the percentage of traffic assigned to the revision.
+func revisionTraffic(svc *run.Service, revision string) int64 {
+	var percent int64
+	for _, target := range svc.Spec.Traffic {
+		if target.RevisionName == revision {
+			percent += target.Percent
+		}
+	}
+	return percent
+}
+
+// setHealthSamplesAnnotation sets the annotation with the raw data used for
+// the last diagnosis. If no metrics were collected, the annotation is removed
+// so that it does not refer to a previous candidate. If the samples exceed
+// MaxReportAnnotationSize, their queries are left out of the annotation, and
+// only kept in the archive.
+func (r *Rollout) setHealthSamplesAnnotation(svc *run.Service) {
+	if len(r.samples) == 0 {
+		delete(svc.Metadata.Annotations, LastHealthSamplesAnnotation)
+		return
+	}
+	report, err := health.SamplesReport(r.samples)
+	if err != nil {
+		r.log.Warnf("could not record health samples: %v", err)
+		return
+	}
+	r.samplesReport = report
+	if len(report) > MaxReportAnnotationSize {
+		samples := make([]health.Sample, len(r.samples))
+		for i, sample := range r.samples {
+			sample.Queries = nil
+			samples[i] = sample
+		}
+		r.log.Warnf("health samples of %d bytes recorded without their queries, full samples: %q", len(report), r.fullReportLocation())
+		if report, err = health.SamplesReport(samples); err != nil || len(report) > MaxReportAnnotationSize {
+			delete(svc.Metadata.Annotations, LastHealthSamplesAnnotation)
+			return
+		}
+	}
+	setAnnotation(svc, LastHealthSamplesAnnotation, report)
 }
 
 // diagnoseCandidate returns the candidate's diagnosis based on metrics.
 func (r *Rollout) diagnoseCandidate(candidate string, healthCriteria []config.HealthCriterion) (d health.Diagnosis, err error) {
 	healthCheckOffset := time.Duration(r.strategy.HealthOffsetMinute) * time.Minute
 	r.log.Debug("collecting metrics from API")
-	ctx := util.ContextWithLogger(r.ctx, r.log)
+	ctx, span := tracing.Start(util.ContextWithLogger(r.ctx, r.log), "diagnosis")
+	span.SetAttribute("revision", candidate)
+	defer func() { span.End(err) }()
 	r.metricsProvider.SetCandidateRevision(candidate)
-	metricsValues, err := health.CollectMetrics(ctx, r.metricsProvider, healthCheckOffset, healthCriteria)
+	samples, err := health.CollectSamples(ctx, r.metricsProvider, healthCheckOffset, r.strategy.MetricsTimeout, healthCriteria)
 	if err != nil {
 		return d, errors.Wrap(err, "failed to collect metrics")
 	}
+	r.samples = samples
 
 	r.log.Debug("diagnosing candidate's health")
-	d, err = health.Diagnose(ctx, healthCriteria, metricsValues)
+	d, err = health.Diagnose(ctx, healthCriteria, health.Values(samples))
 	return d, errors.Wrap(err, "failed to diagnose candidate's health")
 }
 
@@ -390,11 +1303,11 @@ func (r *Rollout) diagnoseCandidate(candidate string, healthCriteria []config.He
 // TODO: what if lastRolloutStr is always invalid?
 func (r *Rollout) hasEnoughTimeElapsed(lastRolloutStr string, timeBetweenRollouts time.Duration) (bool, error) {
 	if lastRolloutStr == "" {
-		return false, errors.Errorf("%s annotation is missing", LastRolloutAnnotation)
+		return false, configErrorf("%s annotation is missing", LastRolloutAnnotation)
 	}
 	lastRollout, err := time.Parse(time.RFC3339, lastRolloutStr)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to parse last roll out time")
+		return false, &ConfigError{Err: errors.Wrap(err, "failed to parse last roll out time")}
 	}
 
 	currentTime := r.time.Now()
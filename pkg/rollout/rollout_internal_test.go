@@ -1,10 +1,16 @@
 package rollout
 
 import (
+	"context"
+	"net/http"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/kube"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
 )
 
 func TestNextCandidateTraffic100(t *testing.T) {
@@ -31,3 +37,91 @@ func TestNextCandidateTraffic100(t *testing.T) {
 		assert.Equal(t, test.out, next)
 	}
 }
+
+func TestTruncateText(t *testing.T) {
+	var tests = []struct {
+		name     string
+		text     string
+		location string
+		max      int
+		expected string
+	}{
+		{name: "short text", text: "status: healthy", max: 20, expected: "status: healthy"},
+		{name: "at line end", text: "status: unhealthy\nerror-rate: 5\nlatency: 700", max: 35, expected: "status: unhealthy\n[truncated]"},
+		{name: "with location", text: "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7", location: "gs://b/o", max: 45, expected: "line 1\n[truncated, full report: gs://b/o]"},
+		{name: "no line end", text: "ééééééééééééééé", max: 20, expected: "éééé\n[truncated]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			truncated := truncateText(test.text, test.location, test.max)
+			assert.Equal(tt, test.expected, truncated)
+			assert.LessOrEqual(tt, len(truncated), test.max)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      string
+		retryable bool
+	}{
+		{
+			name:      "quota exceeded",
+			err:       errors.Wrap(&googleapi.Error{Code: http.StatusTooManyRequests}, "failed to collect metrics"),
+			kind:      TransientErrorKind,
+			retryable: true,
+		},
+		{
+			name:      "unavailable Knative Serving API",
+			err:       &kube.StatusError{Code: http.StatusServiceUnavailable},
+			kind:      TransientErrorKind,
+			retryable: true,
+		},
+		{
+			name:      "deadline exceeded",
+			err:       errors.Wrap(context.DeadlineExceeded, "could not retrieve service"),
+			kind:      TransientErrorKind,
+			retryable: true,
+		},
+		{
+			name:      "concurrent modification",
+			err:       errors.Wrap(runapi.ErrConflict, "revision became ready"),
+			kind:      ConflictErrorKind,
+			retryable: true,
+		},
+		{
+			name: "permission denied",
+			err:  &googleapi.Error{Code: http.StatusForbidden},
+			kind: PermissionErrorKind,
+		},
+		{
+			name: "invalid traffic configuration",
+			err:  &googleapi.Error{Code: http.StatusBadRequest},
+			kind: ConfigErrorKind,
+		},
+		{
+			name: "wrapped config error",
+			err:  errors.Wrap(configErrorf("%s annotation is missing", LastRolloutAnnotation), "failed to replace service"),
+			kind: ConfigErrorKind,
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("connection refused"),
+			kind: UnknownErrorKind,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			err := classify(test.err)
+			assert.Equal(tt, test.kind, ErrorKind(err))
+			assert.Equal(tt, test.retryable, IsRetryable(err))
+			assert.Equal(tt, test.err.Error(), err.Error())
+			assert.Equal(tt, errors.Cause(test.err), errors.Cause(err))
+		})
+	}
+	assert.Equal(t, "", ErrorKind(nil))
+}
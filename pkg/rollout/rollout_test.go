@@ -2,18 +2,43 @@ package rollout_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	archiveMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive/mock"
+	attestationMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/attestation/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image"
+	imageMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/image/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen"
+	loadgenMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/loadgen/mock"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
 	metricsMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics/mock"
+	mirrorMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/mirror/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	notifyMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy"
+	policyMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/policy/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe"
+	probeMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/probe/mock"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
 	runMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state"
+	stateMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/state/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
+	vulnerabilityMocker "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability/mock"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
 	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
 	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/run/v1"
 )
 
@@ -40,6 +65,13 @@ func generateService(opts *ServiceOpts) *run.Service {
 	}
 }
 
+// latestService makes the client return the service as its latest version.
+func latestService(client *runMocker.RunAPI, svc *run.Service) {
+	client.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+		return svc, nil
+	}
+}
+
 func makeLastRolloutAnnotation(clock clockwork.Clock, offsetFromNowMinute int) string {
 	offset := time.Duration(offsetFromNowMinute) * time.Minute
 	return clock.Now().Add(offset).Format(time.RFC3339)
@@ -327,6 +359,7 @@ func TestUpdateService(t *testing.T) {
 			Traffic:             test.traffic,
 		}
 		svc := generateService(opts)
+		latestService(runclient, svc)
 		svcRecord := &rollout.ServiceRecord{Service: svc}
 
 		strategy.HealthCriteria = test.healthCriteria
@@ -341,6 +374,10 @@ func TestUpdateService(t *testing.T) {
 			} else if test.nilService {
 				assert.Nil(tt, svc)
 			} else {
+				// The JSON report is tested in TestUpdateService_HealthReportJSON.
+				_, ok := svc.Metadata.Annotations[rollout.LastHealthReportJSONAnnotation]
+				assert.True(tt, ok)
+				delete(svc.Metadata.Annotations, rollout.LastHealthReportJSONAnnotation)
 				assert.Equal(tt, test.outAnnotations, svc.Metadata.Annotations)
 				assert.Equal(tt, test.outTraffic, svc.Spec.Traffic)
 			}
@@ -349,158 +386,2540 @@ func TestUpdateService(t *testing.T) {
 	}
 }
 
-func TestPrepareRollForward(t *testing.T) {
+func TestUpdateService_HealthReportJSON(t *testing.T) {
 	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	clockMock := clockwork.NewFakeClock()
 	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 1000, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
 	strategy := config.Strategy{
-		Steps: []int64{5, 30, 60},
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 500},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+		},
+	}
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+	annotations := map[string]string{
+		rollout.StableRevisionAnnotation:    "test-001",
+		rollout.CandidateRevisionAnnotation: "test-002",
+		rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -20),
 	}
 
-	var tests = []struct {
-		name      string
-		stable    string
-		candidate string
-		traffic   []*run.TrafficTarget
-		expected  []*run.TrafficTarget
+	svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+	latestService(runclient, svc)
+	svcRecord := &rollout.ServiceRecord{Service: svc}
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock)
+
+	svc, err := r.UpdateService(svc)
+	assert.Nil(t, err)
+	expected := `{"status":"healthy","checks":[` +
+		`{"criterion":"request-count","metric":"request-count","threshold":500,"actualValue":1000,"isCriteriaMet":true},` +
+		`{"criterion":"error-rate-percent","metric":"error-rate-percent","threshold":5,"actualValue":1,"isCriteriaMet":true}],` +
+		fmt.Sprintf(`"window":"5m0s","candidate":"test-002","trafficStep":40,"lastUpdate":%q}`, clockMock.Now().Format(time.RFC3339Nano))
+	assert.Equal(t, expected, svc.Metadata.Annotations[rollout.LastHealthReportJSONAnnotation])
+}
+
+func TestUpdateService_Notify(t *testing.T) {
+	tests := []struct {
+		name             string
+		candidatePercent int64
+		requestCount     int64
+		errorRate        float64
+		reportFormat     config.ReportFormat
+		notifyErr        error
+		expectedType     notify.EventType
+		expectedPercent  int64
+		expectedFailed   []string
+		expectedFormat   config.ReportFormat
 	}{
-		// There's a new candidate. Restart rollout process
 		{
-			name:      "new candidate, restart rollout",
-			stable:    "test-001",
-			candidate: "test-003",
-			traffic: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 50},
-				{RevisionName: "test-001", Tag: "tag1"},
-				{RevisionName: "test-002", Percent: 50, Tag: rollout.CandidateTag},
-				{RevisionName: "test-002", Tag: "tag2"},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-			},
-			expected: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 95, Tag: rollout.StableTag},
-				{RevisionName: "test-003", Percent: 5, Tag: rollout.CandidateTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-				{RevisionName: "test-001", Tag: "tag1"},
-				{RevisionName: "test-002", Tag: "tag2"},
-			},
+			name:             "new candidate",
+			candidatePercent: 0,
+			expectedType:     notify.CandidateDetectedEvent,
+			expectedPercent:  10,
+			expectedFormat:   config.TextReportFormat,
 		},
-		// Candidate is the same. Continue rolling forward.
 		{
-			name:      "continue rolling out candidate",
-			stable:    "test-001",
-			candidate: "test-003",
-			traffic: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Percent: 30, Tag: rollout.CandidateTag},
-				{RevisionName: "test-003", Tag: "tag2"},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-			},
-			expected: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
-				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Tag: "tag2"},
-			},
+			name:             "roll forward",
+			candidatePercent: 10,
+			requestCount:     1000,
+			errorRate:        0.01,
+			expectedType:     notify.StepAdvancedEvent,
+			expectedPercent:  40,
+			expectedFormat:   config.TextReportFormat,
 		},
-		// Candidate is the same. Continue rolling forward to 100%.
 		{
-			name:      "roll out to 100%",
-			stable:    "test-001",
-			candidate: "test-003",
-			traffic: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
-				{RevisionName: "test-003", Tag: "tag2"},
-			},
-			expected: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
-				{RevisionName: "test-003", Percent: 100, Tag: rollout.CandidateTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Tag: "tag2"},
-			},
+			name:             "promotion",
+			candidatePercent: 100,
+			requestCount:     1000,
+			errorRate:        0.01,
+			expectedType:     notify.PromotionEvent,
+			expectedPercent:  100,
+			expectedFormat:   config.TextReportFormat,
 		},
-		// Candidate has proven able to handle 100%, make it stable.
 		{
-			name:      "make candidate stable",
-			stable:    "test-001",
-			candidate: "test-003",
-			traffic: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Percent: 100, Tag: rollout.CandidateTag},
-				{RevisionName: "test-003", Tag: "tag2"},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-			},
-			expected: []*run.TrafficTarget{
-				{RevisionName: "test-003", Percent: 100, Tag: rollout.StableTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Tag: "tag2"},
-			},
+			name:             "promotion with HTML report",
+			candidatePercent: 100,
+			requestCount:     1000,
+			errorRate:        0.01,
+			reportFormat:     config.HTMLReportFormat,
+			expectedType:     notify.PromotionEvent,
+			expectedPercent:  100,
+			expectedFormat:   config.HTMLReportFormat,
 		},
-		// Two targets for the same stable and candidate revisions.
 		{
-			name:      "two targets for same revision",
-			stable:    "test-001",
-			candidate: "test-003",
-			traffic: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 70},
-				{RevisionName: "test-001", Tag: rollout.StableTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-				{RevisionName: "test-003", Percent: 30},
-				{RevisionName: "test-003", Tag: rollout.CandidateTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-			},
-			expected: []*run.TrafficTarget{
-				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
-				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
-				{LatestRevision: true, Tag: rollout.LatestTag},
-				{RevisionName: "test-002", Tag: "tag1"},
-			},
+			name:             "rollback",
+			candidatePercent: 10,
+			requestCount:     1000,
+			errorRate:        0.5,
+			expectedType:     notify.RollbackEvent,
+			expectedPercent:  0,
+			expectedFailed:   []string{"error-rate-percent: 50.00 (needs 5.00)"},
+			expectedFormat:   config.TextReportFormat,
+		},
+		{
+			name:             "inconclusive",
+			candidatePercent: 10,
+			requestCount:     100,
+			errorRate:        0.01,
+			expectedType:     notify.InconclusiveEvent,
+			expectedPercent:  10,
+		},
+		{
+			name:             "failed notification does not fail rollout",
+			candidatePercent: 10,
+			requestCount:     1000,
+			errorRate:        0.01,
+			notifyErr:        fmt.Errorf("webhook returned status 500"),
+			expectedType:     notify.StepAdvancedEvent,
+			expectedPercent:  40,
+			expectedFormat:   config.TextReportFormat,
 		},
 	}
 
 	for _, test := range tests {
-		opts := &ServiceOpts{
-			Traffic: test.traffic,
-		}
-		svc := generateService(opts)
-		svcRecord := &rollout.ServiceRecord{Service: svc}
+		t.Run(test.name, func(tt *testing.T) {
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				assert.Equal(tt, "myproject", namespace)
+				assert.Equal(tt, "test-002", revisionID)
+				return &run.Revision{Metadata: &run.ObjectMeta{
+					Labels: map[string]string{rollout.CommitSHALabel: "abc123"},
+				}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+				return test.requestCount, nil
+			}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return test.errorRate, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error {
+				return test.notifyErr
+			}
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria: []config.HealthCriterion{
+					{Metric: config.RequestCountMetricsCheck, Threshold: 500},
+					{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+				},
+				ReportFormat: test.reportFormat,
+			}
+			traffic := []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100 - test.candidatePercent, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: test.candidatePercent, Tag: rollout.CandidateTag},
+			}
+			annotations := map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -20),
+			}
 
-		r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient)
+			svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
 
-		t.Run(test.name, func(tt *testing.T) {
-			svc = r.PrepareRollForward(svc, test.stable, test.candidate)
-			assert.Equal(tt, test.expected, svc.Spec.Traffic)
+			_, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.Len(tt, notifier.Events, 1)
+			event := notifier.Events[0]
+			assert.Equal(tt, test.expectedType, event.Type)
+			assert.Equal(tt, "myproject", event.Project)
+			assert.Equal(tt, "us-east1", event.Region)
+			assert.Equal(tt, "test-001", event.Stable)
+			assert.Equal(tt, "test-002", event.Candidate)
+			assert.Equal(tt, test.expectedPercent, event.CandidatePercent)
+			assert.Equal(tt, test.candidatePercent, event.PreviousPercent)
+			assert.NotEmpty(tt, event.Report)
+			assert.Equal(tt, clockMock.Now(), event.Time)
+			assert.Equal(tt, test.expectedFailed, event.FailedChecks)
+			assert.Equal(tt, "abc123", event.CommitSHA)
+			assert.Equal(tt, test.expectedFormat, event.ReportFormat)
 		})
 	}
 }
 
-func TestPrepareRollback(t *testing.T) {
+func TestUpdateService_CandidateImage(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	var replaced *run.Service
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		replaced = svc
+		return svc, nil
+	}
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{
+			Metadata: &run.ObjectMeta{},
+			Spec:     &run.RevisionSpec{Containers: []*run.Container{{Image: "us-docker.pkg.dev/myproject/myrepo/app:v2"}}},
+			Status:   &run.RevisionStatus{ImageDigest: "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc"},
+		}, nil
+	}
+	inspector := &imageMocker.Inspector{}
+	inspector.InspectFn = func(ctx context.Context, ref, digest string) (*image.Metadata, error) {
+		assert.Equal(t, "us-docker.pkg.dev/myproject/myrepo/app", ref)
+		assert.Equal(t, "sha256:abc", digest, "the resolved digest of the revision must be used")
+		return &image.Metadata{Image: ref, Digest: digest, CommitSHA: "def456", BuildURL: "https://example.com/builds/42"}, nil
+	}
+	clockMock := clockwork.NewFakeClock()
 	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
+	notifier := &notifyMocker.Notifier{}
+	notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+	}
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation:    "test-001",
+			rollout.CandidateRevisionAnnotation: "test-002",
+			rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -20),
+		},
+		LatestReadyRevision: "test-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+			{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+		},
+	})
+	latestService(runclient, svc)
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).
+		WithNotifier(notifier).WithImageInspector(inspector)
 
-	stable := "test-001"
-	candidate := "test-003"
-	traffic := []*run.TrafficTarget{
-		{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
-		{RevisionName: "test-002", Tag: "tag1"},
-		{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
-		{RevisionName: "test-003", Tag: "tag2"},
+	_, err := r.UpdateService(svc)
+	assert.Nil(t, err)
+	if assert.NotNil(t, replaced) {
+		annotations := replaced.Metadata.Annotations
+		assert.Equal(t, "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc", annotations[rollout.CandidateImageAnnotation])
+		assert.Equal(t, "def456", annotations[rollout.CandidateCommitSHAAnnotation])
+		assert.Equal(t, "https://example.com/builds/42", annotations[rollout.CandidateBuildURLAnnotation])
+		assert.Contains(t, annotations[rollout.LastHealthReportAnnotation], "commit: def456")
+		assert.Contains(t, annotations[rollout.LastHealthReportJSONAnnotation], `"buildUrl":"https://example.com/builds/42"`)
 	}
-	expectedTraffic := []*run.TrafficTarget{
-		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
-		{RevisionName: "test-003", Percent: 0, Tag: rollout.CandidateTag},
-		{LatestRevision: true, Tag: rollout.LatestTag},
-		{RevisionName: "test-002", Tag: "tag1"},
-		{RevisionName: "test-003", Tag: "tag2"},
+	if assert.Len(t, notifier.Events, 1) {
+		event := notifier.Events[0]
+		assert.Equal(t, "def456", event.CommitSHA, "the commit must default to the label of the image")
+		assert.Equal(t, "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc", event.Image)
+		assert.Equal(t, "https://example.com/builds/42", event.BuildURL)
 	}
-	svc := generateService(&ServiceOpts{Traffic: traffic})
-	svcRecord := &rollout.ServiceRecord{Service: svc}
+}
 
-	r := rollout.New(context.TODO(), metricsMock, svcRecord, config.Strategy{})
-	svc = r.PrepareRollback(svc, stable, candidate)
-	assert.Equal(t, expectedTraffic, svc.Spec.Traffic)
+func TestUpdateService_Stuck(t *testing.T) {
+	tests := []struct {
+		name              string
+		lastRolloutMinute int
+		stuckSince        string
+		expectedEvents    []notify.EventType
+	}{
+		{
+			name:              "stuck",
+			lastRolloutMinute: -120,
+			expectedEvents:    []notify.EventType{notify.InconclusiveEvent, notify.StuckEvent},
+		},
+		{
+			name:              "not stuck yet",
+			lastRolloutMinute: -20,
+			expectedEvents:    []notify.EventType{notify.InconclusiveEvent},
+		},
+		{
+			name:              "already flagged",
+			lastRolloutMinute: -120,
+			stuckSince:        "2020-06-01T10:00:00Z",
+			expectedEvents:    []notify.EventType{notify.InconclusiveEvent},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var replaced *run.Service
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+				return 100, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.RequestCountMetricsCheck, Threshold: 500}},
+				StuckAfter:         time.Hour,
+			}
+			traffic := []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+			}
+			lastRollout := makeLastRolloutAnnotation(clockMock, test.lastRolloutMinute)
+			annotations := map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       lastRollout,
+			}
+			if test.stuckSince != "" {
+				annotations[rollout.StuckSinceAnnotation] = test.stuckSince
+			}
+
+			svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			updated, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.Nil(tt, updated, "traffic must be unchanged")
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+
+			if len(types) < 2 {
+				assert.Nil(tt, replaced)
+				return
+			}
+			assert.Equal(tt, lastRollout, replaced.Metadata.Annotations[rollout.StuckSinceAnnotation])
+			assert.Equal(tt, traffic, replaced.Spec.Traffic)
+			stuck := notifier.Events[1]
+			assert.Equal(tt, int64(10), stuck.CandidatePercent)
+			assert.Contains(tt, stuck.Report, "since "+lastRollout)
+		})
+	}
+}
+
+func TestUpdateService_OnUnhealthy(t *testing.T) {
+	tests := []struct {
+		name            string
+		onUnhealthy     config.UnhealthyAction
+		unhealthySince  string
+		expectedEvents  []notify.EventType
+		expectedPaused  bool
+		expectedChanged bool
+	}{
+		{
+			name:            "rollback",
+			expectedEvents:  []notify.EventType{notify.RollbackEvent},
+			expectedChanged: true,
+		},
+		{
+			name:           "notify",
+			onUnhealthy:    config.NotifyOnUnhealthy,
+			expectedEvents: []notify.EventType{notify.UnhealthyEvent},
+		},
+		{
+			name:           "pause",
+			onUnhealthy:    config.PauseOnUnhealthy,
+			expectedEvents: []notify.EventType{notify.UnhealthyEvent},
+			expectedPaused: true,
+		},
+		{
+			name:           "already notified",
+			onUnhealthy:    config.NotifyOnUnhealthy,
+			unhealthySince: "2020-06-01T10:00:00Z",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var replaced *run.Service
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return 20, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+				OnUnhealthy:        test.onUnhealthy,
+			}
+			traffic := []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+			}
+			annotations := map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+			}
+			if test.unhealthySince != "" {
+				annotations[rollout.UnhealthySinceAnnotation] = test.unhealthySince
+			}
+
+			svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			result := r.Run()
+			assert.Nil(tt, result.Err)
+			assert.Equal(tt, test.expectedChanged, result.Changed)
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+			if test.expectedChanged || test.unhealthySince != "" {
+				return
+			}
+
+			if assert.NotNil(tt, replaced) {
+				assert.Equal(tt, traffic, replaced.Spec.Traffic, "traffic must be kept")
+				now := clockMock.Now().Format(time.RFC3339)
+				assert.Equal(tt, now, replaced.Metadata.Annotations[rollout.UnhealthySinceAnnotation])
+				assert.Equal(tt, test.expectedPaused, replaced.Metadata.Annotations[rollout.PausedAnnotation] == now)
+				assert.Empty(tt, replaced.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation])
+				assert.Contains(tt, replaced.Metadata.Annotations[rollout.LastHealthReportAnnotation], "unhealthy")
+				assert.Equal(tt, int64(40), notifier.Events[0].CandidatePercent)
+			}
+		})
+	}
+}
+
+func TestUpdateService_Attestation(t *testing.T) {
+	const image = "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc"
+	tests := []struct {
+		name             string
+		missing          []string
+		verifyErr        error
+		refused          string
+		expectedEvents   []notify.EventType
+		expectedPercent  int64
+		expectedRefusal  string
+		expectedDecision string
+		shouldErr        bool
+	}{
+		{
+			name:             "attested",
+			refused:          "test-002: image " + image + " is not attested by projects/myproject/attestors/qa",
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent},
+			expectedPercent:  10,
+			expectedDecision: archive.RollForwardDecision,
+		},
+		{
+			name:             "not attested",
+			missing:          []string{"projects/myproject/attestors/qa"},
+			expectedEvents:   []notify.EventType{notify.AttestationRefusedEvent},
+			expectedRefusal:  "test-002: image " + image + " is not attested by projects/myproject/attestors/qa",
+			expectedDecision: archive.DeniedDecision,
+		},
+		{
+			name:             "already refused",
+			missing:          []string{"projects/myproject/attestors/qa"},
+			refused:          "test-002: image " + image + " is not attested by projects/myproject/attestors/qa",
+			expectedRefusal:  "test-002: image " + image + " is not attested by projects/myproject/attestors/qa",
+			expectedDecision: archive.DeniedDecision,
+		},
+		{
+			name:             "verification failed",
+			verifyErr:        errors.New("permission denied"),
+			expectedDecision: archive.ErrorDecision,
+			shouldErr:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var replaced *run.Service
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{
+					Metadata: &run.ObjectMeta{},
+					Spec:     &run.RevisionSpec{Containers: []*run.Container{{Image: "us-docker.pkg.dev/myproject/myrepo/app:v2"}}},
+					Status:   &run.RevisionStatus{ImageDigest: image},
+				}, nil
+			}
+			verifier := &attestationMocker.Verifier{}
+			verifier.MissingFn = func(ctx context.Context, ref string, attestors []string) ([]string, error) {
+				assert.Equal(tt, image, ref)
+				assert.Equal(tt, []string{"projects/myproject/attestors/built-by-ci", "projects/myproject/attestors/qa"}, attestors)
+				return test.missing, test.verifyErr
+			}
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				Attestation: &config.Attestation{
+					Attestors: []string{"projects/myproject/attestors/built-by-ci", "projects/myproject/attestors/qa"},
+				},
+			}
+			annotations := map[string]string{rollout.StableRevisionAnnotation: "test-001"}
+			if test.refused != "" {
+				annotations[rollout.AttestationRefusedAnnotation] = test.refused
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations:         annotations,
+				LatestReadyRevision: "test-002",
+				Traffic:             []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}},
+			})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).
+				WithNotifier(notifier).WithAttestationVerifier(verifier)
+
+			result := r.Run()
+			assert.True(tt, verifier.MissingInvoked)
+			assert.Equal(tt, test.shouldErr, result.Err != nil)
+			assert.Equal(tt, test.expectedDecision, result.Decision)
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+			if replaced == nil {
+				return
+			}
+			var percent int64
+			for _, target := range replaced.Spec.Traffic {
+				if target.RevisionName == "test-002" {
+					percent = target.Percent
+				}
+			}
+			assert.Equal(tt, test.expectedPercent, percent, "an unattested candidate must not receive traffic")
+			assert.Equal(tt, test.expectedRefusal, replaced.Metadata.Annotations[rollout.AttestationRefusedAnnotation])
+		})
+	}
+}
+
+func TestUpdateService_VulnerabilityScan(t *testing.T) {
+	const image = "us-docker.pkg.dev/myproject/myrepo/app@sha256:abc"
+	critical := []vulnerability.Vulnerability{
+		{ID: "CVE-2020-1234", Severity: "CRITICAL"},
+		{ID: "CVE-2020-5678", Severity: "CRITICAL"},
+		{ID: "CVE-2020-9012", Severity: "MEDIUM"},
+	}
+	tests := []struct {
+		name             string
+		candidatePercent int64
+		report           vulnerability.Report
+		expectedEvents   []notify.EventType
+		expectedPercent  int64
+		expectedRefusal  string
+		expectedDecision string
+	}{
+		{
+			name:             "new candidate without vulnerabilities",
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus},
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent},
+			expectedPercent:  10,
+			expectedDecision: archive.RollForwardDecision,
+		},
+		{
+			name:             "new candidate with ignored vulnerability",
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus, Vulnerabilities: critical[:1]},
+			expectedEvents:   []notify.EventType{notify.CandidateDetectedEvent},
+			expectedPercent:  10,
+			expectedDecision: archive.RollForwardDecision,
+		},
+		{
+			name:             "new candidate not scanned yet",
+			report:           vulnerability.Report{Status: vulnerability.ScanningStatus},
+			expectedEvents:   []notify.EventType{notify.VulnerabilitiesRefusedEvent},
+			expectedRefusal:  "test-002: vulnerability scan of image " + image + " is not finished",
+			expectedDecision: archive.DeniedDecision,
+		},
+		{
+			name:             "traffic increase refused",
+			candidatePercent: 10,
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus, Vulnerabilities: critical},
+			expectedEvents:   []notify.EventType{notify.VulnerabilitiesRefusedEvent},
+			expectedPercent:  10,
+			expectedRefusal:  "test-002: image " + image + " has 1 vulnerabilities more severe than HIGH: CVE-2020-5678 (CRITICAL)",
+			expectedDecision: archive.DeniedDecision,
+		},
+		{
+			name:             "step to all the traffic refused",
+			candidatePercent: 70,
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus, Vulnerabilities: critical},
+			expectedEvents:   []notify.EventType{notify.VulnerabilitiesRefusedEvent},
+			expectedPercent:  70,
+			expectedRefusal:  "test-002: image " + image + " has 1 vulnerabilities more severe than HIGH: CVE-2020-5678 (CRITICAL)",
+			expectedDecision: archive.DeniedDecision,
+		},
+		{
+			name:             "traffic increase without vulnerabilities",
+			candidatePercent: 70,
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus},
+			expectedEvents:   []notify.EventType{notify.StepAdvancedEvent},
+			expectedPercent:  100,
+			expectedDecision: archive.RollForwardDecision,
+		},
+		{
+			name:             "promotion refused",
+			candidatePercent: 100,
+			report:           vulnerability.Report{Status: vulnerability.FinishedStatus, Vulnerabilities: critical},
+			expectedEvents:   []notify.EventType{notify.RollbackEvent},
+			expectedPercent:  0,
+			expectedRefusal:  "test-002: image " + image + " has 1 vulnerabilities more severe than HIGH: CVE-2020-5678 (CRITICAL)",
+			expectedDecision: archive.RollbackDecision,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var replaced *run.Service
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{
+					Metadata: &run.ObjectMeta{},
+					Spec:     &run.RevisionSpec{Containers: []*run.Container{{Image: "us-docker.pkg.dev/myproject/myrepo/app:v2"}}},
+					Status:   &run.RevisionStatus{ImageDigest: image},
+				}, nil
+			}
+			scanner := &vulnerabilityMocker.Scanner{}
+			scanner.ScanFn = func(ctx context.Context, ref string) (*vulnerability.Report, error) {
+				assert.Equal(tt, image, ref)
+				report := test.report
+				return &report, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return 0.01, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+				VulnerabilityScan:  &config.VulnerabilityScan{MaxSeverity: "HIGH", Ignore: []string{"CVE-2020-1234"}},
+			}
+			traffic := []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}}
+			if test.candidatePercent != 0 {
+				traffic = []*run.TrafficTarget{
+					{RevisionName: "test-001", Percent: 100 - test.candidatePercent, Tag: rollout.StableTag},
+					{RevisionName: "test-002", Percent: test.candidatePercent, Tag: rollout.CandidateTag},
+				}
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation:    "test-001",
+					rollout.CandidateRevisionAnnotation: "test-002",
+					rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+				},
+				LatestReadyRevision: "test-002",
+				Traffic:             traffic,
+			})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).
+				WithNotifier(notifier).WithVulnerabilityScanner(scanner)
+
+			result := r.Run()
+			assert.Nil(tt, result.Err)
+			assert.True(tt, scanner.ScanInvoked)
+			assert.Equal(tt, test.expectedDecision, result.Decision)
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+			if assert.NotNil(tt, replaced) {
+				var percent int64
+				for _, target := range replaced.Spec.Traffic {
+					if target.RevisionName == "test-002" {
+						percent = target.Percent
+					}
+				}
+				assert.Equal(tt, test.expectedPercent, percent)
+				assert.Equal(tt, test.expectedRefusal, replaced.Metadata.Annotations[rollout.VulnerabilitiesRefusedAnnotation])
+			}
+		})
+	}
+}
+
+func TestUpdateService_HealthyStreak(t *testing.T) {
+	tests := []struct {
+		name            string
+		errorRate       float64
+		healthyStreak   string
+		expectedPercent int64
+		expectedStreak  string
+	}{
+		{
+			name:            "first healthy diagnosis",
+			errorRate:       0.01,
+			expectedPercent: 40,
+			expectedStreak:  "1",
+		},
+		{
+			name:            "streak continued",
+			errorRate:       0.01,
+			healthyStreak:   "1",
+			expectedPercent: 40,
+			expectedStreak:  "2",
+		},
+		{
+			name:            "streak complete",
+			errorRate:       0.01,
+			healthyStreak:   "2",
+			expectedPercent: 70,
+		},
+		{
+			name:            "streak broken",
+			errorRate:       20,
+			healthyStreak:   "2",
+			expectedPercent: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var (
+				replaced *run.Service
+				replaces int
+			)
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				replaces++
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return test.errorRate, nil
+			}
+			strategy := config.Strategy{
+				Steps:                    []int64{10, 40, 70},
+				HealthOffsetMinute:       5,
+				HealthCriteria:           []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+				ConsecutiveHealthyChecks: 3,
+			}
+			annotations := map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+			}
+			if test.healthyStreak != "" {
+				annotations[rollout.HealthyStreakAnnotation] = test.healthyStreak
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations:         annotations,
+				LatestReadyRevision: "test-002",
+				Traffic: []*run.TrafficTarget{
+					{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+					{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+				},
+			})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock)
+
+			assert.Nil(tt, r.Run().Err)
+			assert.Equal(tt, 1, replaces, "the service is replaced once per cycle")
+			if assert.NotNil(tt, replaced) {
+				var percent int64
+				for _, target := range replaced.Spec.Traffic {
+					if target.RevisionName == "test-002" {
+						percent = target.Percent
+					}
+				}
+				assert.Equal(tt, test.expectedPercent, percent)
+				assert.Equal(tt, test.expectedStreak, replaced.Metadata.Annotations[rollout.HealthyStreakAnnotation])
+			}
+		})
+	}
+}
+
+func TestUpdateService_CompareWithStable(t *testing.T) {
+	tests := []struct {
+		name            string
+		stableErrorRate float64
+		expectedEvents  []notify.EventType
+	}{
+		{
+			name:            "stable equally degraded",
+			stableErrorRate: 0.18,
+			expectedEvents:  []notify.EventType{notify.InconclusiveEvent},
+		},
+		{
+			name:            "stable healthy",
+			stableErrorRate: 0.005,
+			expectedEvents:  []notify.EventType{notify.RollbackEvent},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			revision := ""
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) { revision = revisionName }
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				if revision == "test-001" {
+					return test.stableErrorRate, nil
+				}
+				return 0.2, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+				CompareWithStable:  true,
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation:    "test-001",
+					rollout.CandidateRevisionAnnotation: "test-002",
+					rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+				},
+				LatestReadyRevision: "test-002",
+				Traffic: []*run.TrafficTarget{
+					{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+					{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+				},
+			})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			assert.Nil(tt, r.Run().Err)
+			assert.Equal(tt, "test-002", revision, "the provider must be pointed back at the candidate")
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+			if test.expectedEvents[0] == notify.InconclusiveEvent {
+				assert.Contains(tt, notifier.Events[0].Report, "(stable: 18.00): stable revision equally degraded")
+			}
+		})
+	}
+}
+
+func TestRollout_FleetPause(t *testing.T) {
+	tests := []struct {
+		name              string
+		traffic           []*run.TrafficTarget
+		expectedDiagnosis string
+	}{
+		{
+			name: "unhealthy candidate",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+			},
+			expectedDiagnosis: health.Unhealthy.String(),
+		},
+		{
+			name:    "new candidate",
+			traffic: []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				tt.Error("service must not be updated")
+				return svc, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return 0.2, nil
+			}
+			archiver := &archiveMocker.Archive{}
+			strategy := config.Strategy{
+				Steps:              []int64{10, 40, 70},
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation:    "test-001",
+					rollout.CandidateRevisionAnnotation: "test-002",
+					rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+				},
+				LatestReadyRevision: "test-002",
+				Traffic:             test.traffic,
+			})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).
+				WithArchive(archiver).WithFleetPause(true)
+
+			result := r.Run()
+			assert.Nil(tt, result.Err)
+			assert.False(tt, result.Changed)
+			assert.Equal(tt, archive.PausedDecision, result.Decision)
+			if assert.Len(tt, archiver.Records, 1) && test.expectedDiagnosis != "" {
+				assert.Equal(tt, test.expectedDiagnosis, archiver.Records[0].Report.Status)
+			}
+		})
+	}
+}
+
+func TestAbort_Unhealthy(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation:    "test-001",
+			rollout.CandidateRevisionAnnotation: "test-002",
+			rollout.UnhealthySinceAnnotation:    "2020-06-01T10:00:00Z",
+			rollout.PausedAnnotation:            "2020-06-01T10:00:00Z",
+		},
+		LatestReadyRevision: "test-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+			{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+		},
+	})
+	runclient := &runMocker.RunAPI{}
+	latestService(runclient, svc)
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+	}
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{Steps: []int64{30, 60}}).
+		WithClient(runclient).WithClock(clockMock)
+
+	assert.Nil(t, r.Abort())
+	assert.NotContains(t, svc.Metadata.Annotations, rollout.UnhealthySinceAnnotation)
+	assert.NotContains(t, svc.Metadata.Annotations, rollout.PausedAnnotation, "the pause on the unhealthy candidate must be lifted")
+}
+
+func TestUpdateService_TrafficSplit(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestCounts  map[string]int64
+		missingStable  bool
+		expectedResult string
+		expectedEvents []notify.EventType
+	}{
+		{
+			name:           "split within tolerance",
+			requestCounts:  map[string]int64{"test-001": 880, "test-002": 120},
+			expectedResult: "healthy",
+			expectedEvents: []notify.EventType{notify.StepAdvancedEvent},
+		},
+		{
+			name:           "skewed split",
+			requestCounts:  map[string]int64{"test-001": 700, "test-002": 300},
+			expectedResult: "inconclusive",
+			expectedEvents: []notify.EventType{notify.InconclusiveEvent},
+		},
+		{
+			name:           "missing request count of the stable revision",
+			requestCounts:  map[string]int64{"test-002": 120},
+			missingStable:  true,
+			expectedResult: "inconclusive",
+			expectedEvents: []notify.EventType{notify.InconclusiveEvent},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			runclient := &runMocker.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{}}, nil
+			}
+			clockMock := clockwork.NewFakeClock()
+			var revision string
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) { revision = revisionName }
+			metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+				if test.missingStable && revision == "test-001" {
+					return 0, metrics.ErrMissingRevisionData
+				}
+				return test.requestCounts[revision], nil
+			}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return 0.01, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+			strategy := config.Strategy{
+				Steps:                 []int64{10, 40, 70},
+				HealthOffsetMinute:    5,
+				HealthCriteria:        []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+				TrafficSplitTolerance: 5,
+			}
+			traffic := []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+			}
+			annotations := map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -120),
+			}
+
+			svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+			latestService(runclient, svc)
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			_, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.Equal(tt, "test-002", revision, "provider must be reset to the candidate")
+			var types []notify.EventType
+			for _, event := range notifier.Events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(tt, test.expectedEvents, types)
+
+			if len(notifier.Events) == 0 {
+				return
+			}
+			event := notifier.Events[0]
+			assert.Equal(tt, test.expectedResult, event.Diagnosis)
+			if assert.Len(tt, event.Checks, 2) {
+				assert.Equal(tt, config.TrafficSplitSkewMetricsCheck, event.Checks[1].Metric)
+			}
+		})
+	}
+}
+
+func TestUpdateService_Function(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	var replaced *run.Service
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		replaced = svc
+		return svc, nil
+	}
+	metricsMock := &metricsMocker.Metrics{}
+	strategy := config.Strategy{Steps: []int64{10, 40, 70}, HealthOffsetMinute: 5}
+
+	// A deployment of the function sent all the traffic to the new revision.
+	svc := &run.Service{
+		Metadata: &run.ObjectMeta{
+			Name:   "my-function",
+			Labels: map[string]string{runapi.FunctionManagedByLabel: runapi.FunctionManagedByValue},
+			Annotations: map[string]string{
+				runapi.FunctionIDAnnotation:      "my_function",
+				rollout.StableRevisionAnnotation: "my-function-001",
+			},
+		},
+		Spec: &run.ServiceSpec{Traffic: []*run.TrafficTarget{{LatestRevision: true, Percent: 100}}},
+		Status: &run.ServiceStatus{
+			LatestReadyRevisionName: "my-function-002",
+			Traffic:                 []*run.TrafficTarget{{RevisionName: "my-function-002", Percent: 100, LatestRevision: true}},
+		},
+	}
+	latestService(runclient, svc)
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient)
+
+	_, err := r.UpdateService(svc)
+	assert.Nil(t, err)
+	if assert.NotNil(t, replaced, "service must be updated") {
+		assert.Equal(t, []*run.TrafficTarget{
+			{RevisionName: "my-function-001", Percent: 90, Tag: rollout.StableTag},
+			{RevisionName: "my-function-002", Percent: 10, Tag: rollout.CandidateTag},
+			{LatestRevision: true, Tag: rollout.LatestTag},
+		}, replaced.Spec.Traffic, "the rollout must start over from the first step")
+		assert.Equal(t, "my_function", replaced.Metadata.Annotations[runapi.FunctionIDAnnotation], "the annotations of the function must be kept")
+	}
+}
+
+func TestPrepareRollForward(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	metricsMock := &metricsMocker.Metrics{}
+	strategy := config.Strategy{
+		Steps: []int64{5, 30, 60},
+	}
+
+	var tests = []struct {
+		name      string
+		stable    string
+		candidate string
+		traffic   []*run.TrafficTarget
+		expected  []*run.TrafficTarget
+	}{
+		// There's a new candidate. Restart rollout process
+		{
+			name:      "new candidate, restart rollout",
+			stable:    "test-001",
+			candidate: "test-003",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 50},
+				{RevisionName: "test-001", Tag: "tag1"},
+				{RevisionName: "test-002", Percent: 50, Tag: rollout.CandidateTag},
+				{RevisionName: "test-002", Tag: "tag2"},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expected: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 95, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 5, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-001", Tag: "tag1"},
+				{RevisionName: "test-002", Tag: "tag2"},
+			},
+		},
+		// Candidate is the same. Continue rolling forward.
+		{
+			name:      "continue rolling out candidate",
+			stable:    "test-001",
+			candidate: "test-003",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Percent: 30, Tag: rollout.CandidateTag},
+				{RevisionName: "test-003", Tag: "tag2"},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expected: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Tag: "tag2"},
+			},
+		},
+		// Candidate is the same. Continue rolling forward to 100%.
+		{
+			name:      "roll out to 100%",
+			stable:    "test-001",
+			candidate: "test-003",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
+				{RevisionName: "test-003", Tag: "tag2"},
+			},
+			expected: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 100, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Tag: "tag2"},
+			},
+		},
+		// Candidate has proven able to handle 100%, make it stable.
+		{
+			name:      "make candidate stable",
+			stable:    "test-001",
+			candidate: "test-003",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Percent: 100, Tag: rollout.CandidateTag},
+				{RevisionName: "test-003", Tag: "tag2"},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expected: []*run.TrafficTarget{
+				{RevisionName: "test-003", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Tag: "tag2"},
+			},
+		},
+		// Two targets for the same stable and candidate revisions.
+		{
+			name:      "two targets for same revision",
+			stable:    "test-001",
+			candidate: "test-003",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 70},
+				{RevisionName: "test-001", Tag: rollout.StableTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+				{RevisionName: "test-003", Percent: 30},
+				{RevisionName: "test-003", Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expected: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-002", Tag: "tag1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		opts := &ServiceOpts{
+			Traffic: test.traffic,
+		}
+		svc := generateService(opts)
+		latestService(runclient, svc)
+		svcRecord := &rollout.ServiceRecord{Service: svc}
+
+		r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient)
+
+		t.Run(test.name, func(tt *testing.T) {
+			svc = r.PrepareRollForward(svc, test.stable, test.candidate)
+			assert.Equal(tt, test.expected, svc.Spec.Traffic)
+		})
+	}
+}
+
+func TestPrepareRollback(t *testing.T) {
+	metricsMock := &metricsMocker.Metrics{}
+
+	stable := "test-001"
+	candidate := "test-003"
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 40, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Tag: "tag1"},
+		{RevisionName: "test-003", Percent: 60, Tag: rollout.CandidateTag},
+		{RevisionName: "test-003", Tag: "tag2"},
+	}
+	expectedTraffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-003", Percent: 0, Tag: rollout.CandidateTag},
+		{LatestRevision: true, Tag: rollout.LatestTag},
+		{RevisionName: "test-002", Tag: "tag1"},
+		{RevisionName: "test-003", Tag: "tag2"},
+	}
+	svc := generateService(&ServiceOpts{Traffic: traffic})
+	svcRecord := &rollout.ServiceRecord{Service: svc}
+
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, config.Strategy{})
+	svc = r.PrepareRollback(svc, stable, candidate)
+	assert.Equal(t, expectedTraffic, svc.Spec.Traffic)
+}
+
+func TestUpdateService_Probe(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsMocker.Metrics{}
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		Probe: &config.Probe{
+			Path:              "/healthz",
+			ExpectedStatus:    200,
+			Requests:          4,
+			MinSuccessPercent: 75,
+		},
+	}
+
+	var tests = []struct {
+		name       string
+		spec       []*run.TrafficTarget
+		status     []*run.TrafficTarget
+		succeeded  int
+		outReport  string
+		outTraffic []*run.TrafficTarget
+		nilService bool
+	}{
+		{
+			name: "new candidate is tagged for probing",
+			spec: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			outReport: "new candidate, waiting for pre-traffic checks",
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name: "tag URL not available yet",
+			spec: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+			},
+			nilService: true,
+		},
+		{
+			name: "candidate passes probes",
+			spec: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+			},
+			status: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag, Url: "https://candidate---mysvc.a.run.app"},
+			},
+			succeeded: 3,
+			outReport: "status: healthy\n" +
+				"metrics:" +
+				"\n- probe-success-percent: 75.00 (needs 75.00)",
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name: "candidate fails probes",
+			spec: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+			},
+			status: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag, Url: "https://candidate---mysvc.a.run.app"},
+			},
+			succeeded: 1,
+			outReport: "status: unhealthy\n" +
+				"metrics:" +
+				"\n- probe-success-percent: 25.00 (needs 75.00)",
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			prober := &probeMocker.Prober{}
+			prober.ProbeFn = func(ctx context.Context, url string) (probe.Result, error) {
+				assert.Equal(tt, "https://candidate---mysvc.a.run.app", url)
+				return probe.Result{Total: 4, Succeeded: test.succeeded}, nil
+			}
+
+			svc := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: test.spec})
+			latestService(runclient, svc)
+			svc.Metadata.Name = "mysvc"
+			svc.Status.Traffic = test.status
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithProber(prober).WithClock(clockMock)
+
+			svc, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			if test.nilService {
+				assert.Nil(tt, svc)
+				assert.False(tt, prober.ProbeInvoked)
+				return
+			}
+			report := test.outReport + fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339))
+			assert.Equal(tt, report, svc.Metadata.Annotations[rollout.LastHealthReportAnnotation])
+			assert.Equal(tt, test.outTraffic, svc.Spec.Traffic)
+		})
+	}
+}
+
+func TestUpdateService_RecordSamples(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		metrics.RecordQuery(ctx, metrics.Query{Query: "error_rate", Start: clockMock.Now().Add(-offset), End: clockMock.Now()})
+		return 0.01, nil
+	}
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+		},
+		RecordSamples: true,
+	}
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+	annotations := map[string]string{
+		rollout.StableRevisionAnnotation:    "test-001",
+		rollout.CandidateRevisionAnnotation: "test-002",
+		rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -20),
+	}
+
+	svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+	latestService(runclient, svc)
+	svcRecord := &rollout.ServiceRecord{Service: svc}
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock)
+
+	svc, err := r.UpdateService(svc)
+	assert.Nil(t, err)
+	start := clockMock.Now().Add(-5 * time.Minute).Format(time.RFC3339Nano)
+	end := clockMock.Now().Format(time.RFC3339Nano)
+	expected := `[{"criterion":"error-rate-percent","threshold":5,"value":1,"window":"5m0s",` +
+		fmt.Sprintf(`"queries":[{"query":"error_rate","start":%q,"end":%q}]}]`, start, end)
+	assert.Equal(t, expected, svc.Metadata.Annotations[rollout.LastHealthSamplesAnnotation])
+}
+
+func TestUpdateService_WarmUp(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsMocker.Metrics{}
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 3},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 30},
+		},
+		WarmUp: &config.WarmUp{RPS: 1, Duration: time.Minute, Method: "GET", Path: "/"},
+	}
+	spec := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+	}
+	status := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag, Url: "https://candidate---mysvc.a.run.app"},
+	}
+
+	var tests = []struct {
+		name       string
+		samples    []loadgen.Sample
+		outReport  string
+		outTraffic []*run.TrafficTarget
+		nilService bool
+	}{
+		{
+			name:       "not enough synthetic requests",
+			samples:    []loadgen.Sample{{StatusCode: 200}},
+			nilService: true,
+		},
+		{
+			name:    "healthy synthetic traffic",
+			samples: []loadgen.Sample{{StatusCode: 200}, {StatusCode: 200}, {StatusCode: 200}, {StatusCode: 500}},
+			outReport: "status: healthy\n" +
+				"metrics:" +
+				"\n- request-count: 4 (needs 3)" +
+				"\n- error-rate-percent: 25.00 (needs 30.00)",
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name:    "unhealthy synthetic traffic",
+			samples: []loadgen.Sample{{StatusCode: 200}, {StatusCode: 500}, {Failed: true}},
+			outReport: "status: unhealthy\n" +
+				"metrics:" +
+				"\n- request-count: 3 (needs 3)" +
+				"\n- error-rate-percent: 66.67 (needs 30.00)",
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			generator := &loadgenMocker.Generator{}
+			generator.GenerateFn = func(ctx context.Context, url string) (*loadgen.Result, error) {
+				return &loadgen.Result{Samples: test.samples}, nil
+			}
+
+			svc := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: spec})
+			latestService(runclient, svc)
+			svc.Status.Traffic = status
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithLoadGenerator(generator).WithClock(clockMock)
+
+			svc, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.True(tt, generator.GenerateInvoked)
+			if test.nilService {
+				assert.Nil(tt, svc)
+				return
+			}
+			report := test.outReport + fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339))
+			assert.Equal(tt, report, svc.Metadata.Annotations[rollout.LastHealthReportAnnotation])
+			assert.Equal(tt, test.outTraffic, svc.Spec.Traffic)
+		})
+	}
+}
+
+func TestUpdateService_Shadow(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+	}
+	clockMock := clockwork.NewFakeClock()
+	strategy := config.Strategy{
+		Steps:              []int64{10, 40, 70},
+		HealthOffsetMinute: 5,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+		},
+		Shadow: &config.Shadow{ControlURL: "http://mirror", SamplePercent: 10, Duration: 30 * time.Minute},
+	}
+	spec := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+	}
+	status := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag, Url: "https://candidate---mysvc.a.run.app"},
+	}
+
+	var tests = []struct {
+		name          string
+		shadowStarted string
+		errorRate     float64
+		outStart      bool
+		outStop       bool
+		outTraffic    []*run.TrafficTarget
+		outEvent      notify.EventType
+		nilService    bool
+	}{
+		{
+			name:     "start shadow traffic",
+			outStart: true,
+			outEvent: notify.ShadowStartedEvent,
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+			},
+		},
+		{
+			name:          "shadow duration has not elapsed",
+			shadowStarted: makeLastRolloutAnnotation(clockMock, -10),
+			nilService:    true,
+		},
+		{
+			name:          "healthy with shadow traffic",
+			shadowStarted: makeLastRolloutAnnotation(clockMock, -30),
+			errorRate:     0.01,
+			outStop:       true,
+			outEvent:      notify.StepAdvancedEvent,
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name:          "unhealthy with shadow traffic",
+			shadowStarted: makeLastRolloutAnnotation(clockMock, -30),
+			errorRate:     0.1,
+			outStop:       true,
+			outEvent:      notify.RollbackEvent,
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return test.errorRate, nil
+			}
+			controller := &mirrorMocker.Controller{}
+			controller.StartFn = func(ctx context.Context, service, targetURL string, percent float64) error {
+				assert.Equal(tt, "https://candidate---mysvc.a.run.app", targetURL)
+				return nil
+			}
+			controller.StopFn = func(ctx context.Context, service string) error { return nil }
+			notifier := &notifyMocker.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notify.Event) error { return nil }
+
+			annotations := map[string]string{}
+			if test.shadowStarted != "" {
+				annotations[rollout.ShadowStartedAnnotation] = test.shadowStarted
+			}
+			svc := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: spec, Annotations: annotations})
+			latestService(runclient, svc)
+			svc.Status.Traffic = status
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithMirrorController(controller).WithClock(clockMock).WithNotifier(notifier)
+
+			svc, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outStart, controller.StartInvoked)
+			assert.Equal(tt, test.outStop, controller.StopInvoked)
+			if test.nilService {
+				assert.Nil(tt, svc)
+				assert.Empty(tt, notifier.Events)
+				return
+			}
+			assert.Equal(tt, test.outTraffic, svc.Spec.Traffic)
+			if assert.Len(tt, notifier.Events, 1) {
+				assert.Equal(tt, test.outEvent, notifier.Events[0].Type)
+			}
+			_, shadowing := svc.Metadata.Annotations[rollout.ShadowStartedAnnotation]
+			assert.Equal(tt, test.outStart, shadowing)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	var tests = []struct {
+		name           string
+		latestRevision string
+		errorRate      float64
+		expectedStatus string
+		expectedFailed []string
+		shouldErr      bool
+	}{
+		{
+			name:           "healthy revision",
+			latestRevision: "test-002",
+			errorRate:      0.01,
+			expectedStatus: "healthy",
+		},
+		{
+			name:           "unhealthy revision",
+			latestRevision: "test-002",
+			errorRate:      0.1,
+			expectedStatus: "unhealthy",
+			expectedFailed: []string{"error-rate-percent: 10.00 (needs 5.00)"},
+		},
+		{
+			name:      "no ready revision",
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			metricsMock := &metricsMocker.Metrics{}
+			metricsMock.SetCandidateRevisionFn = func(revisionName string) {
+				assert.Equal(tt, test.latestRevision, revisionName)
+			}
+			metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+				return test.errorRate, nil
+			}
+			strategy := config.Strategy{
+				HealthOffsetMinute: 5,
+				HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 5}},
+			}
+			traffic := []*run.TrafficTarget{{RevisionName: test.latestRevision, Percent: 100}}
+			svc := generateService(&ServiceOpts{LatestReadyRevision: test.latestRevision, Traffic: traffic})
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClock(clockMock)
+
+			report, err := r.Verify()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expectedStatus, report.Status)
+			assert.Equal(tt, test.expectedFailed, report.FailedChecks())
+			assert.Equal(tt, test.latestRevision, report.Candidate)
+			assert.Equal(tt, int64(100), report.TrafficStep)
+			assert.Equal(tt, clockMock.Now(), report.LastUpdate)
+		})
+	}
+}
+
+func TestRollout_Conflict(t *testing.T) {
+	stableTraffic := []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}}
+	tests := []struct {
+		name              string
+		deployedBefore    bool
+		editedTraffic     []*run.TrafficTarget
+		replaceErrs       []error
+		shouldErr         bool
+		expectedReplaces  int
+		expectedCandidate string
+	}{
+		{
+			name:              "no conflict",
+			replaceErrs:       []error{nil},
+			expectedReplaces:  1,
+			expectedCandidate: "test-002",
+		},
+		{
+			name:              "deployment before update",
+			deployedBefore:    true,
+			replaceErrs:       []error{nil},
+			expectedReplaces:  1,
+			expectedCandidate: "test-003",
+		},
+		{
+			name:              "conflict with deployment",
+			replaceErrs:       []error{&googleapi.Error{Code: 409}, nil},
+			expectedReplaces:  2,
+			expectedCandidate: "test-003",
+		},
+		{
+			name:              "traffic edited by hand",
+			editedTraffic:     []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}, {RevisionName: "test-001", Tag: "pinned"}},
+			replaceErrs:       []error{nil},
+			expectedReplaces:  1,
+			expectedCandidate: "test-002",
+		},
+		{
+			name:             "other error",
+			replaceErrs:      []error{&googleapi.Error{Code: 400}},
+			shouldErr:        true,
+			expectedReplaces: 1,
+		},
+		{
+			name: "persistent conflict",
+			replaceErrs: []error{&googleapi.Error{Code: 409}, &googleapi.Error{Code: 409},
+				&googleapi.Error{Code: 409}, &googleapi.Error{Code: 409}},
+			shouldErr:        true,
+			expectedReplaces: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			// The latest version of the service has changes made after it
+			// was retrieved by the operator, which must be preserved.
+			latest := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: stableTraffic})
+			latest.Spec.Template = &run.RevisionTemplate{Metadata: &run.ObjectMeta{Name: "test-003"}}
+			deploy := func() {
+				latest = generateService(&ServiceOpts{LatestReadyRevision: "test-003", Traffic: stableTraffic})
+			}
+			if test.deployedBefore {
+				deploy()
+			}
+			if test.editedTraffic != nil {
+				latest = generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: test.editedTraffic})
+				latest.Metadata.ResourceVersion = "2"
+			}
+
+			var replaced []*run.Service
+			runclient := &runMocker.RunAPI{}
+			runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+				return latest, nil
+			}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				err := test.replaceErrs[len(replaced)]
+				replaced = append(replaced, svc)
+				if err != nil {
+					deploy()
+				}
+				return svc, err
+			}
+
+			svc := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: stableTraffic})
+			strategy := config.Strategy{Steps: []int64{10, 40, 70}}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, &rollout.ServiceRecord{Service: svc}, strategy).
+				WithClient(runclient)
+
+			changed, err := r.Rollout()
+			assert.Len(tt, replaced, test.expectedReplaces)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.True(tt, changed)
+			last := replaced[len(replaced)-1]
+			assert.Equal(tt, latest, last)
+			assert.Equal(tt, test.expectedCandidate, last.Metadata.Annotations[rollout.CandidateRevisionAnnotation])
+			assert.Equal(tt, test.expectedCandidate, last.Spec.Traffic[1].RevisionName)
+			if test.editedTraffic != nil {
+				assert.Contains(tt, last.Spec.Traffic, test.editedTraffic[1])
+			}
+		})
+	}
+}
+
+func TestUpdateService_Reconciliation(t *testing.T) {
+	tests := []struct {
+		name      string
+		appliedAt int
+		timeout   time.Duration
+		polls     int
+		shouldErr bool
+	}{
+		{name: "applied on first check", appliedAt: 1, timeout: time.Minute, polls: 1},
+		{name: "applied after some time", appliedAt: 3, timeout: time.Minute, polls: 3},
+		{name: "not applied", timeout: 5 * time.Second, polls: 4, shouldErr: true},
+		{name: "no wait", appliedAt: 1, polls: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			svc := generateService(&ServiceOpts{
+				LatestReadyRevision: "test-002",
+				Traffic:             []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}},
+			})
+
+			// The first lookup is done before the update.
+			var polls int
+			runclient := &runMocker.RunAPI{}
+			runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+				if runclient.ReplaceServiceInvoked {
+					polls++
+				}
+				if test.appliedAt == 0 || polls < test.appliedAt {
+					return svc, nil
+				}
+				applied := *svc
+				applied.Status = &run.ServiceStatus{Traffic: []*run.TrafficTarget{
+					{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+					{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				}}
+				return &applied, nil
+			}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+
+			strategy := config.Strategy{Steps: []int64{10, 40, 70}}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, &rollout.ServiceRecord{Service: svc}, strategy).
+				WithClient(runclient).WithClock(clockMock).WithReconciliationTimeout(test.timeout)
+
+			done := make(chan error)
+			go func() {
+				_, err := r.UpdateService(svc)
+				done <- err
+			}()
+			for i := 1; i < test.polls; i++ {
+				clockMock.BlockUntil(1)
+				clockMock.Advance(2 * time.Second)
+			}
+			err := <-done
+			assert.Equal(tt, test.polls, polls)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestUpdateService_StateStore(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	traffic := []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}}
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		stored        *state.State
+		shouldReplace bool
+		expectedState *state.State
+	}{
+		{
+			name:          "no state, new candidate",
+			annotations:   map[string]string{rollout.LastFailedCandidateRevisionAnnotation: "test-000"},
+			shouldReplace: true,
+			expectedState: &state.State{
+				Stable:              "test-001",
+				Candidate:           "test-002",
+				LastFailedCandidate: "test-000",
+				LastRollout:         clockMock.Now().Format(time.RFC3339),
+				Steps:               []state.Step{{Candidate: "test-002", Percent: 10, Time: clockMock.Now()}},
+			},
+		},
+		{
+			name:          "state of a past quarantine only",
+			annotations:   map[string]string{rollout.StableRevisionAnnotation: "test-001"},
+			stored:        &state.State{FailureStreak: 1},
+			shouldReplace: true,
+			expectedState: &state.State{
+				Stable:        "test-001",
+				Candidate:     "test-002",
+				LastRollout:   clockMock.Now().Format(time.RFC3339),
+				FailureStreak: 1,
+				Steps:         []state.Step{{Candidate: "test-002", Percent: 10, Time: clockMock.Now()}},
+			},
+		},
+		{
+			name: "annotation edited by user",
+			// The failed candidate was removed from the annotations, but
+			// the stored state prevails.
+			annotations: map[string]string{rollout.StableRevisionAnnotation: "test-001"},
+			stored:      &state.State{Stable: "test-001", LastFailedCandidate: "test-002", FailureStreak: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{Annotations: test.annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+			runclient := &runMocker.RunAPI{}
+			latestService(runclient, svc)
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			var saved *state.State
+			store := &stateMocker.Store{
+				GetFn: func(ctx context.Context, key string) (*state.State, error) {
+					assert.Equal(tt, "myproject/us-east1/mysvc", key)
+					return test.stored, nil
+				},
+				PutFn: func(ctx context.Context, key string, st *state.State) error {
+					assert.Equal(tt, "myproject/us-east1/mysvc", key)
+					saved = st
+					return nil
+				},
+			}
+
+			strategy := config.Strategy{Steps: []int64{10, 40, 70}}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, &rollout.ServiceRecord{Service: svc}, strategy).
+				WithClient(runclient).WithClock(clockMock).WithStateStore(store, "myproject/us-east1/mysvc")
+			_, err := r.UpdateService(svc)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.shouldReplace, runclient.ReplaceServiceInvoked)
+			assert.Equal(tt, test.expectedState, saved)
+			if test.stored != nil {
+				assert.Equal(tt, test.stored.LastFailedCandidate, svc.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation])
+			}
+		})
+	}
+}
+
+func TestRollout_Archive(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	traffic := []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}}
+	tests := []struct {
+		name       string
+		lastReady  string
+		replaceErr error
+		expected   archive.Record
+	}{
+		{
+			name:      "no candidate",
+			lastReady: "test-001",
+			expected:  archive.Record{Stable: "test-001", Decision: archive.NoCandidateDecision},
+		},
+		{
+			name:      "new candidate",
+			lastReady: "test-002",
+			expected: archive.Record{
+				Stable:           "test-001",
+				Candidate:        "test-002",
+				CandidatePercent: 10,
+				Decision:         archive.RollForwardDecision,
+				Report: &health.Report{
+					Status:      health.Unknown.String(),
+					Message:     "new candidate, no health report available yet",
+					Candidate:   "test-002",
+					TrafficStep: 10,
+					LastUpdate:  clockMock.Now(),
+				},
+				RenderedReport: "new candidate, no health report available yet\nlastUpdate: " + clockMock.Now().Format(time.RFC3339),
+			},
+		},
+		{
+			name:       "error",
+			lastReady:  "test-002",
+			replaceErr: &googleapi.Error{Code: 400, Message: "invalid"},
+			expected: archive.Record{
+				Stable:    "test-001",
+				Candidate: "test-002",
+				Decision:  archive.ErrorDecision,
+				Report: &health.Report{
+					Status:      health.Unknown.String(),
+					Message:     "new candidate, no health report available yet",
+					Candidate:   "test-002",
+					TrafficStep: 10,
+					LastUpdate:  clockMock.Now(),
+				},
+				RenderedReport: "new candidate, no health report available yet\nlastUpdate: " + clockMock.Now().Format(time.RFC3339),
+				Error:          "failed to replace service: could not update service \"mysvc\": googleapi: Error 400: invalid",
+				ErrorKind:      rollout.ConfigErrorKind,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{LatestReadyRevision: test.lastReady, Traffic: traffic})
+			svc.Metadata.Name = "mysvc"
+			runclient := &runMocker.RunAPI{}
+			latestService(runclient, svc)
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, test.replaceErr
+			}
+			archiver := &archiveMocker.Archive{}
+
+			strategy := config.Strategy{Steps: []int64{10, 40, 70}}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, strategy).
+				WithClient(runclient).WithClock(clockMock).WithArchive(archiver)
+			r.Rollout()
+
+			expected := test.expected
+			expected.Time = clockMock.Now()
+			expected.Project, expected.Region, expected.Service = "myproject", "us-east1", "mysvc"
+			assert.Equal(tt, []archive.Record{expected}, archiver.Records)
+		})
+	}
+}
+
+func TestRollout_TruncatedReport(t *testing.T) {
+	runclient := &runMocker.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
+	strategy := config.Strategy{Steps: []int64{10, 40, 70}, HealthOffsetMinute: 5, RecordSamples: true}
+	for i := 0; i < 1000; i++ {
+		strategy.HealthCriteria = append(strategy.HealthCriteria, config.HealthCriterion{Metric: config.ErrorRateMetricsCheck, Threshold: float64(5 + i)})
+	}
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+	annotations := map[string]string{
+		rollout.StableRevisionAnnotation:    "test-001",
+		rollout.CandidateRevisionAnnotation: "test-002",
+		rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -20),
+	}
+	svc := generateService(&ServiceOpts{Annotations: annotations, LatestReadyRevision: "test-002", Traffic: traffic})
+	svc.Metadata.Name = "mysvc"
+	latestService(runclient, svc)
+	archiver := &archiveMocker.Archive{LocateFn: func(record archive.Record) string {
+		return fmt.Sprintf("gs://mybucket/%s/%s/%d.json", record.Project, record.Service, record.Time.Unix())
+	}}
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).
+		WithClient(runclient).WithClock(clockMock).WithArchive(archiver)
+
+	_, err := r.Rollout()
+	assert.Nil(t, err)
+	location := fmt.Sprintf("gs://mybucket/myproject/mysvc/%d.json", clockMock.Now().Unix())
+	updated := svc.Metadata.Annotations
+	assert.LessOrEqual(t, len(updated[rollout.LastHealthReportAnnotation]), rollout.MaxReportAnnotationSize)
+	assert.True(t, strings.HasSuffix(updated[rollout.LastHealthReportAnnotation], "\n[truncated, full report: "+location+"]"))
+
+	var report health.Report
+	assert.Nil(t, json.Unmarshal([]byte(updated[rollout.LastHealthReportJSONAnnotation]), &report))
+	assert.Equal(t, health.Healthy.String(), report.Status)
+	assert.Empty(t, report.Checks)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, location, report.FullReport)
+	assert.LessOrEqual(t, len(updated[rollout.LastHealthSamplesAnnotation]), rollout.MaxReportAnnotationSize)
+
+	// The full report is archived at the location.
+	if assert.Len(t, archiver.Records, 1) {
+		record := archiver.Records[0]
+		assert.Equal(t, location, archiver.Locate(record))
+		assert.Len(t, record.Report.Checks, 1000)
+		assert.False(t, record.Report.Truncated)
+		assert.Greater(t, len(record.RenderedReport), rollout.MaxReportAnnotationSize)
+		assert.NotEmpty(t, record.Samples)
+	}
+}
+
+func TestRollout_Policy(t *testing.T) {
+	tests := []struct {
+		name         string
+		decision     policy.Decision
+		evaluateErr  error
+		expectedErr  bool
+		expectedType notify.EventType
+	}{
+		{
+			name:         "allowed",
+			decision:     policy.Decision{Allowed: true},
+			expectedType: notify.CandidateDetectedEvent,
+		},
+		{
+			name:         "denied",
+			decision:     policy.Decision{Reasons: []string{"no rollouts on Fridays"}},
+			expectedType: notify.PolicyDeniedEvent,
+		},
+		{
+			name:        "evaluation error",
+			evaluateErr: errors.New("connection refused"),
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			traffic := []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}}
+			svc := generateService(&ServiceOpts{LatestReadyRevision: "test-002", Traffic: traffic})
+			svc.Metadata.Labels = map[string]string{"tier": "0"}
+			runclient := &runMocker.RunAPI{}
+			latestService(runclient, svc)
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+			}
+			var input policy.Input
+			evaluator := &policyMocker.Evaluator{EvaluateFn: func(ctx context.Context, in policy.Input) (policy.Decision, error) {
+				input = in
+				return test.decision, test.evaluateErr
+			}}
+			notifier := &notifyMocker.Notifier{}
+			archiver := &archiveMocker.Archive{}
+
+			strategy := config.Strategy{Steps: []int64{10, 40, 70}}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, strategy).
+				WithClient(runclient).WithClock(clockMock).WithNotifier(notifier).WithArchive(archiver).WithPolicy(evaluator)
+			changed, err := r.Rollout()
+			if test.expectedErr {
+				assert.NotNil(tt, err)
+				assert.False(tt, runclient.ReplaceServiceInvoked)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, policy.Input{
+				Action:         archive.RollForwardDecision,
+				Project:        "myproject",
+				Region:         "us-east1",
+				Labels:         map[string]string{"tier": "0"},
+				Stable:         "test-001",
+				Candidate:      "test-002",
+				CurrentPercent: 0,
+				TargetPercent:  10,
+				Diagnosis:      health.Unknown.String(),
+				Steps:          []int64{10, 40, 70},
+				Time:           clockMock.Now(),
+			}, input)
+			assert.Equal(tt, test.decision.Allowed, changed)
+			assert.Equal(tt, test.decision.Allowed, runclient.ReplaceServiceInvoked)
+			if assert.Len(tt, notifier.Events, 1) {
+				assert.Equal(tt, test.expectedType, notifier.Events[0].Type)
+			}
+			if assert.Len(tt, archiver.Records, 1) && !test.decision.Allowed {
+				assert.Equal(tt, archive.DeniedDecision, archiver.Records[0].Decision)
+				assert.Equal(tt, "rollForward denied by policy: no rollouts on Fridays", archiver.Records[0].Denial)
+			}
+		})
+	}
+}
+
+func TestPromote_PolicyDenied(t *testing.T) {
+	svc := generateService(&ServiceOpts{
+		Annotations:         map[string]string{rollout.StableRevisionAnnotation: "test-001"},
+		LatestReadyRevision: "test-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+			{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+		},
+	})
+	runclient := &runMocker.RunAPI{}
+	latestService(runclient, svc)
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+	}
+	var input policy.Input
+	evaluator := &policyMocker.Evaluator{EvaluateFn: func(ctx context.Context, in policy.Input) (policy.Decision, error) {
+		input = in
+		return policy.Decision{Reasons: []string{"no promotions on Fridays"}}, nil
+	}}
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{Steps: []int64{30, 60}}).
+		WithClient(runclient).WithPolicy(evaluator)
+
+	err := r.Promote()
+	assert.True(t, rollout.IsPolicyDenied(err))
+	assert.False(t, runclient.ReplaceServiceInvoked)
+	assert.Equal(t, archive.PromotionDecision, input.Action)
+	assert.True(t, input.Manual)
+	assert.Equal(t, int64(30), input.CurrentPercent)
+	assert.Equal(t, int64(100), input.TargetPercent)
+}
+
+func TestServiceRecord_APINamespace(t *testing.T) {
+	managed := &rollout.ServiceRecord{Project: "myproject", Region: "us-east1"}
+	assert.Equal(t, "myproject", managed.APINamespace())
+
+	knative := &rollout.ServiceRecord{Project: "myproject", Region: "us-east1", Namespace: "default"}
+	assert.Equal(t, "default", knative.APINamespace())
+}
+
+func TestRollbackTo(t *testing.T) {
+	tests := []struct {
+		name               string
+		revision           string
+		revisionService    string
+		expectedTraffic    []*run.TrafficTarget
+		expectedCandidate  string
+		expectedLastFailed string
+		shouldErr          bool
+	}{
+		{
+			name:     "previous revision",
+			revision: "test-001",
+			expectedTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			expectedCandidate:  "test-003",
+			expectedLastFailed: "test-003",
+		},
+		{
+			name:     "latest revision",
+			revision: "test-003",
+			expectedTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-003", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name:            "revision of another service",
+			revision:        "other-001",
+			revisionService: "other",
+			shouldErr:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			svc := generateService(&ServiceOpts{
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation:              "test-002",
+					rollout.CandidateRevisionAnnotation:           "test-003",
+					rollout.LastFailedCandidateRevisionAnnotation: "test-001",
+				},
+				LatestReadyRevision: "test-003",
+				Traffic: []*run.TrafficTarget{
+					{RevisionName: "test-002", Percent: 70, Tag: rollout.StableTag},
+					{RevisionName: "test-003", Percent: 30, Tag: rollout.CandidateTag},
+				},
+			})
+			svc.Metadata.Name = "test"
+
+			runclient := &runMocker.RunAPI{}
+			latestService(runclient, svc)
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				labels := map[string]string{"serving.knative.dev/service": "test"}
+				if test.revisionService != "" {
+					labels["serving.knative.dev/service"] = test.revisionService
+				}
+				return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID, Labels: labels}}, nil
+			}
+			var replaced *run.Service
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = svc
+				return svc, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{}).
+				WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			err := r.RollbackTo(test.revision)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				assert.False(tt, runclient.ReplaceServiceInvoked)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expectedTraffic, replaced.Spec.Traffic)
+			annotations := replaced.Metadata.Annotations
+			assert.Equal(tt, test.revision, annotations[rollout.StableRevisionAnnotation])
+			assert.Equal(tt, test.expectedCandidate, annotations[rollout.CandidateRevisionAnnotation])
+			assert.Equal(tt, test.expectedLastFailed, annotations[rollout.LastFailedCandidateRevisionAnnotation])
+			assert.Equal(tt, clockMock.Now().Format(time.RFC3339), annotations[rollout.LastRolloutAnnotation])
+			assert.Contains(tt, annotations[rollout.LastHealthReportAnnotation], "manual rollback to revision "+test.revision)
+			if assert.Len(tt, notifier.Events, 1) {
+				assert.Equal(tt, notify.RollbackEvent, notifier.Events[0].Type)
+				assert.Equal(tt, test.revision, notifier.Events[0].Stable)
+			}
+		})
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+	}
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation:    "test-001",
+			rollout.CandidateRevisionAnnotation: "test-002",
+			rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -60),
+		},
+		LatestReadyRevision: "test-002",
+		Traffic:             traffic,
+	})
+	runclient := &runMocker.RunAPI{}
+	latestService(runclient, svc)
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	metricsMock := &metricsMocker.Metrics{}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		t.Error("paused service must not be diagnosed")
+		return 0, nil
+	}
+	strategy := config.Strategy{
+		Steps:              []int64{30, 60},
+		HealthOffsetMinute: 5,
+		HealthCriteria:     []config.HealthCriterion{{Metric: config.RequestCountMetricsCheck, Threshold: 100}},
+	}
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	newRollout := func() *rollout.Rollout {
+		return rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithClock(clockMock)
+	}
+
+	assert.Nil(t, newRollout().Pause())
+	assert.True(t, runclient.ReplaceServiceInvoked)
+	assert.Equal(t, clockMock.Now().Format(time.RFC3339), svc.Metadata.Annotations[rollout.PausedAnnotation])
+	assert.Equal(t, traffic, svc.Spec.Traffic)
+
+	changed, err := newRollout().Rollout()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	runclient.ReplaceServiceInvoked = false
+	assert.Nil(t, newRollout().Pause())
+	assert.False(t, runclient.ReplaceServiceInvoked, "already paused")
+
+	assert.Nil(t, newRollout().Resume())
+	assert.True(t, runclient.ReplaceServiceInvoked)
+	_, ok := svc.Metadata.Annotations[rollout.PausedAnnotation]
+	assert.False(t, ok)
+}
+
+func TestPromote(t *testing.T) {
+	tests := []struct {
+		name        string
+		traffic     []*run.TrafficTarget
+		latestReady string
+		shouldErr   bool
+	}{
+		{
+			name: "rollout in progress",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+			},
+			latestReady: "test-002",
+		},
+		{
+			name:        "no candidate",
+			traffic:     []*run.TrafficTarget{{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag}},
+			latestReady: "test-001",
+			shouldErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			svc := generateService(&ServiceOpts{
+				Annotations:         map[string]string{rollout.StableRevisionAnnotation: "test-001"},
+				LatestReadyRevision: test.latestReady,
+				Traffic:             test.traffic,
+			})
+			runclient := &runMocker.RunAPI{}
+			latestService(runclient, svc)
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+				return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+			}
+			notifier := &notifyMocker.Notifier{}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{Steps: []int64{30, 60}}).
+				WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+			err := r.Promote()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				assert.False(tt, runclient.ReplaceServiceInvoked)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			}, svc.Spec.Traffic)
+			assert.Equal(tt, "test-002", svc.Metadata.Annotations[rollout.StableRevisionAnnotation])
+			assert.Empty(tt, svc.Metadata.Annotations[rollout.CandidateRevisionAnnotation])
+			if assert.Len(tt, notifier.Events, 1) {
+				assert.Equal(tt, notify.PromotionEvent, notifier.Events[0].Type)
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation:    "test-001",
+			rollout.CandidateRevisionAnnotation: "test-002",
+		},
+		LatestReadyRevision: "test-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+			{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+		},
+	})
+	runclient := &runMocker.RunAPI{}
+	latestService(runclient, svc)
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+	}
+	notifier := &notifyMocker.Notifier{}
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{Steps: []int64{30, 60}}).
+		WithClient(runclient).WithClock(clockMock).WithNotifier(notifier)
+
+	assert.Nil(t, r.Abort())
+	assert.Equal(t, []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+		{LatestRevision: true, Tag: rollout.LatestTag},
+	}, svc.Spec.Traffic)
+	assert.Equal(t, "test-002", svc.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation])
+	assert.Contains(t, svc.Metadata.Annotations[rollout.LastHealthReportAnnotation], "rollout manually aborted")
+	if assert.Len(t, notifier.Events, 1) {
+		assert.Equal(t, notify.RollbackEvent, notifier.Events[0].Type)
+	}
+
+	// The candidate was rolled back, so there's no rollout to abort anymore.
+	assert.NotNil(t, rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{}).
+		WithClient(runclient).WithClock(clockMock).Abort())
+}
+
+func TestDecisionLog(t *testing.T) {
+	svc := generateService(&ServiceOpts{
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation:    "test-001",
+			rollout.CandidateRevisionAnnotation: "test-002",
+		},
+		LatestReadyRevision: "test-002",
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 70, Tag: rollout.StableTag},
+			{RevisionName: "test-002", Percent: 30, Tag: rollout.CandidateTag},
+		},
+	})
+	runclient := &runMocker.RunAPI{}
+	latestService(runclient, svc)
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	runclient.RevisionFn = func(namespace, revisionID string) (*run.Revision, error) {
+		return &run.Revision{Metadata: &run.ObjectMeta{Name: revisionID}}, nil
+	}
+	logger, hook := logtest.NewNullLogger()
+	svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	r := rollout.New(context.TODO(), &metricsMocker.Metrics{}, svcRecord, config.Strategy{Steps: []int64{30, 60}}).
+		WithClient(runclient).WithClock(clockwork.NewFakeClock()).WithLogger(logger)
+
+	assert.Nil(t, r.Promote())
+	var decision *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["event"] == rollout.DecisionEvent {
+			decision = entry
+		}
+	}
+	if assert.NotNil(t, decision) {
+		assert.Equal(t, logrus.InfoLevel, decision.Level)
+		for field, value := range map[string]interface{}{
+			"project":   "myproject",
+			"region":    "us-east1",
+			"stable":    "test-001",
+			"candidate": "test-002",
+			"percent":   int64(100),
+			"decision":  archive.PromotionDecision,
+		} {
+			assert.Equal(t, value, decision.Data[field], field)
+		}
+	}
 }
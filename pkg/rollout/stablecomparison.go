@@ -0,0 +1,41 @@
+package rollout
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+)
+
+// compareWithStable compares the unhealthy diagnosis of the candidate with the
+// metrics of the stable revision in the same window, if the strategy says so.
+// If the stable revision is equally degraded, e.g. during a platform-wide
+// incident, the diagnosis is inconclusive rather than the candidate rolled
+// back.
+func (r *Rollout) compareWithStable(stable, candidate string, healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) (health.Diagnosis, error) {
+	if !r.strategy.CompareWithStable || diagnosis.OverallResult != health.Unhealthy {
+		return diagnosis, nil
+	}
+
+	// The provider gets the metrics of the candidate revision, so it is
+	// pointed at the stable revision for the comparison.
+	offset := time.Duration(r.strategy.HealthOffsetMinute) * time.Minute
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	r.metricsProvider.SetCandidateRevision(stable)
+	values, err := health.CollectMetrics(ctx, r.metricsProvider, offset, r.strategy.MetricsTimeout, healthCriteria)
+	r.metricsProvider.SetCandidateRevision(candidate)
+	if err != nil {
+		return diagnosis, errors.Wrap(err, "failed to collect metrics of the stable revision")
+	}
+
+	diagnosis, err = health.CompareWithStable(healthCriteria, diagnosis, values)
+	if err != nil {
+		return diagnosis, errors.Wrap(err, "failed to compare with the stable revision")
+	}
+	if diagnosis.OverallResult == health.Inconclusive {
+		r.log.Warn("stable revision equally degraded, diagnosis inconclusive")
+	}
+	return diagnosis, nil
+}
@@ -0,0 +1,51 @@
+package rollout
+
+import (
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// HealthyStreakAnnotation is set to the number of consecutive healthy
+// diagnoses of the candidate at its current step, while it is short of the
+// ConsecutiveHealthyChecks of the strategy. It is removed on the next change
+// of the traffic, or when a diagnosis is not healthy.
+const HealthyStreakAnnotation = "rollout.cloud.run/healthyStreak"
+
+// countHealthyStreak counts the diagnosis in the streak of healthy diagnoses
+// of the candidate at its current step, and determines if the rollout goes on
+// with the diagnosis. A healthy diagnosis short of the ConsecutiveHealthyChecks
+// of the strategy only counts the streak, so the traffic is kept.
+//
+// The streak is set in the annotations of the service, which are saved with
+// the next change of the service in the cycle, or at the end of the cycle if
+// there is none (see UpdateService).
+func (r *Rollout) countHealthyStreak(svc *run.Service, diagnosis health.DiagnosisResult) bool {
+	if r.strategy.ConsecutiveHealthyChecks <= 1 {
+		return true
+	}
+	value, counted := svc.Metadata.Annotations[HealthyStreakAnnotation]
+	if diagnosis != health.Healthy {
+		if counted {
+			r.log.WithField("healthyStreak", value).Debug("healthy streak broken")
+			delete(svc.Metadata.Annotations, HealthyStreakAnnotation)
+			r.unsavedStreak = true
+		}
+		return true
+	}
+
+	streak, _ := strconv.Atoi(value)
+	streak++
+	if streak >= r.strategy.ConsecutiveHealthyChecks {
+		return true
+	}
+	r.log.WithFields(logrus.Fields{
+		"healthyStreak": streak,
+		"required":      r.strategy.ConsecutiveHealthyChecks,
+	}).Info("healthy candidate, waiting for more consecutive healthy diagnoses")
+	setAnnotation(svc, HealthyStreakAnnotation, strconv.Itoa(streak))
+	r.unsavedStreak = true
+	return false
+}
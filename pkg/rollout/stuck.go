@@ -0,0 +1,45 @@
+package rollout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// StuckSinceAnnotation is set when the candidate is kept at the same traffic
+// step for longer than the StuckAfter delay of the strategy, to the time of
+// the last change of the traffic. It is removed on the next change.
+const StuckSinceAnnotation = "rollout.cloud.run/stuckSince"
+
+// checkStuck flags the candidate of the unchanged service as stuck if the
+// traffic was not changed for longer than the StuckAfter delay of the
+// strategy: the StuckSinceAnnotation annotation is set and a stuck event is
+// sent, once per step.
+func (r *Rollout) checkStuck(svc *run.Service, stable, candidate string) error {
+	if r.strategy.StuckAfter <= 0 || svc.Metadata.Annotations[StuckSinceAnnotation] != "" {
+		return nil
+	}
+	lastRollout, err := time.Parse(time.RFC3339, svc.Metadata.Annotations[LastRolloutAnnotation])
+	if err != nil || r.time.Since(lastRollout) < r.strategy.StuckAfter {
+		return nil
+	}
+
+	stuckSince := lastRollout.Format(time.RFC3339)
+	percent := revisionTraffic(svc, candidate)
+	r.log.WithFields(logrus.Fields{"stuckSince": stuckSince, "percent": percent}).Warn("candidate stuck at the same traffic step")
+	setAnnotation(svc, StuckSinceAnnotation, stuckSince)
+	if err := r.replaceService(svc); err != nil {
+		return errors.Wrap(err, "failed to flag stuck candidate")
+	}
+
+	report := fmt.Sprintf("candidate stuck at %d%% of the traffic since %s", percent, stuckSince)
+	if r.report.Status != "" {
+		report += fmt.Sprintf(", last diagnosis: %s", r.report.Status)
+	}
+	r.notify(notify.StuckEvent, svc, stable, candidate, report)
+	return nil
+}
@@ -0,0 +1,96 @@
+package rollout
+
+import (
+	"math"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// verifyTrafficSplit adds the traffic split skew of the candidate to its
+// diagnosis if the strategy has a traffic split tolerance, and diagnoses the
+// candidate again. It returns the criteria of the new diagnosis.
+//
+// Only healthy candidates are verified: a skewed split cannot make a diagnosis
+// more conclusive.
+func (r *Rollout) verifyTrafficSplit(svc *run.Service, stable, candidate string, healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) ([]config.HealthCriterion, health.Diagnosis, error) {
+	if r.strategy.TrafficSplitTolerance <= 0 || diagnosis.OverallResult != health.Healthy {
+		return healthCriteria, diagnosis, nil
+	}
+
+	skew, err := r.trafficSplitSkew(svc, stable, candidate)
+	if err != nil {
+		return nil, health.Diagnosis{}, errors.Wrap(err, "failed to verify traffic split")
+	}
+
+	// The criteria of the strategy must not be modified.
+	criteria := make([]config.HealthCriterion, 0, len(healthCriteria)+1)
+	criteria = append(criteria, healthCriteria...)
+	criteria = append(criteria, config.HealthCriterion{
+		Metric: config.TrafficSplitSkewMetricsCheck, Threshold: r.strategy.TrafficSplitTolerance,
+	})
+	values := append(health.Values(r.samples), skew)
+
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	diagnosis, err = health.Diagnose(ctx, criteria, values)
+	if err != nil {
+		return nil, health.Diagnosis{}, errors.Wrap(err, "failed to diagnose traffic split")
+	}
+	return criteria, diagnosis, nil
+}
+
+// trafficSplitSkew returns the difference, in percentage points, between the
+// share of the requests served by the candidate and the share of the traffic
+// assigned to it, among the candidate and stable revisions.
+//
+// It is NaN if no request was served or the request count of a revision is
+// missing.
+func (r *Rollout) trafficSplitSkew(svc *run.Service, stable, candidate string) (float64, error) {
+	candidatePercent, stablePercent := revisionTraffic(svc, candidate), revisionTraffic(svc, stable)
+	if candidatePercent+stablePercent == 0 {
+		return math.NaN(), nil
+	}
+
+	offset := time.Duration(r.strategy.HealthOffsetMinute) * time.Minute
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	candidateCount, err := r.metricsProvider.RequestCount(ctx, offset)
+	if errors.Is(err, metrics.ErrMissingRevisionData) {
+		r.log.Warnf("ignoring traffic split: %v", err)
+		return math.NaN(), nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get request count of the candidate")
+	}
+
+	// The provider gets the metrics of the candidate revision, so it is
+	// pointed at the stable revision for a single query.
+	r.metricsProvider.SetCandidateRevision(stable)
+	stableCount, err := r.metricsProvider.RequestCount(ctx, offset)
+	r.metricsProvider.SetCandidateRevision(candidate)
+	if errors.Is(err, metrics.ErrMissingRevisionData) {
+		r.log.Warnf("ignoring traffic split: %v", err)
+		return math.NaN(), nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get request count of the stable revision")
+	}
+	if candidateCount+stableCount == 0 {
+		return math.NaN(), nil
+	}
+
+	requested := 100 * float64(candidatePercent) / float64(candidatePercent+stablePercent)
+	actual := 100 * float64(candidateCount) / float64(candidateCount+stableCount)
+	skew := math.Abs(actual - requested)
+	r.log.WithFields(logrus.Fields{
+		"requestedShare": requested,
+		"actualShare":    actual,
+		"skew":           skew,
+	}).Debug("traffic split verified")
+	return skew, nil
+}
@@ -0,0 +1,100 @@
+package rollout
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/archive"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"google.golang.org/api/run/v1"
+)
+
+// MaxReportAnnotationSize is the maximum size, in bytes, of each of the health
+// report annotations (text, JSON and samples). The annotations of a service
+// are limited to 256 KiB in total, so larger reports are truncated instead of
+// failing the update of the service.
+const MaxReportAnnotationSize = 32 * 1024
+
+// fullReportLocation returns where the full health report of the rollout
+// cycle is archived, or an empty location without archive.
+func (r *Rollout) fullReportLocation() string {
+	if r.archive == nil {
+		return ""
+	}
+	return r.archive.Locate(archive.Record{
+		Time:    r.recordTime(),
+		Project: r.project,
+		Region:  r.region,
+		Service: r.serviceName,
+	})
+}
+
+// setReportAnnotation sets the annotation to the text report, truncated if it
+// exceeds MaxReportAnnotationSize.
+func (r *Rollout) setReportAnnotation(svc *run.Service, key, report string) {
+	if len(report) > MaxReportAnnotationSize {
+		location := r.fullReportLocation()
+		r.log.Warnf("health report of %d bytes truncated in annotation %s, full report: %q", len(report), key, location)
+		report = truncateText(report, location, MaxReportAnnotationSize)
+	}
+	setAnnotation(svc, key, report)
+}
+
+// setJSONReportAnnotation sets the annotation to the JSON report. If it
+// exceeds MaxReportAnnotationSize, only the failed checks are kept, then none,
+// and the report is marked as truncated.
+func (r *Rollout) setJSONReportAnnotation(svc *run.Service, report health.Report) error {
+	value, err := report.JSON()
+	if err != nil || len(value) <= MaxReportAnnotationSize {
+		if err == nil {
+			setAnnotation(svc, LastHealthReportJSONAnnotation, value)
+		}
+		return err
+	}
+
+	size := len(value)
+	report.Truncated, report.FullReport = true, r.fullReportLocation()
+	report.Message = truncateText(report.Message, "", MaxReportAnnotationSize/2)
+	failed := make([]health.CheckReport, 0)
+	for _, check := range report.Checks {
+		if !check.IsCriteriaMet {
+			failed = append(failed, check)
+		}
+	}
+	for _, checks := range [][]health.CheckReport{failed, {}} {
+		report.Checks = checks
+		if value, err = report.JSON(); err != nil || len(value) <= MaxReportAnnotationSize {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	r.log.Warnf("JSON health report of %d bytes truncated, full report: %q", size, report.FullReport)
+	setAnnotation(svc, LastHealthReportJSONAnnotation, value)
+	return nil
+}
+
+// truncateText truncates the text to at most max bytes, at the end of a line
+// if possible, and appends a note with the location of the full text, if any.
+func truncateText(text, location string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	note := "\n[truncated]"
+	if location != "" {
+		note = fmt.Sprintf("\n[truncated, full report: %s]", location)
+	}
+	cut := max - len(note)
+	if cut < 0 {
+		cut = 0
+	}
+	if i := strings.LastIndexByte(text[:cut], '\n'); i > 0 {
+		cut = i
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + note
+}
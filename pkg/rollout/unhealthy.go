@@ -0,0 +1,52 @@
+package rollout
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/notify"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// UnhealthySinceAnnotation is set to the time an unhealthy candidate was kept
+// at its traffic instead of being rolled back, as set by the OnUnhealthy
+// action of the strategy. It is removed on the next change of the traffic.
+const UnhealthySinceAnnotation = "rollout.cloud.run/unhealthySince"
+
+// holdsUnhealthy determines if the unhealthy candidates are kept at their
+// traffic, for a human to decide, instead of being rolled back.
+func (r *Rollout) holdsUnhealthy() bool {
+	return r.strategy.OnUnhealthy == config.NotifyOnUnhealthy || r.strategy.OnUnhealthy == config.PauseOnUnhealthy
+}
+
+// holdUnhealthy keeps the unhealthy candidate at its traffic. The first time,
+// the UnhealthySinceAnnotation annotation and the health report are set, the
+// rollout is paused if the strategy says so, and an unhealthy event is sent.
+// The candidate can then be promoted or aborted, or rolls forward again once
+// healthy if the rollout is not paused.
+func (r *Rollout) holdUnhealthy(svc *run.Service, stable, candidate string, healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) error {
+	lg := r.log.WithField("onUnhealthy", r.strategy.OnUnhealthy)
+	if since := svc.Metadata.Annotations[UnhealthySinceAnnotation]; since != "" {
+		r.report = health.NewReport(healthCriteria, diagnosis)
+		lg.WithField("unhealthySince", since).Info("unhealthy candidate kept at its traffic")
+		return r.checkStuck(svc, stable, candidate)
+	}
+
+	now := r.time.Now().Format(time.RFC3339)
+	setAnnotation(svc, UnhealthySinceAnnotation, now)
+	if r.strategy.OnUnhealthy == config.PauseOnUnhealthy {
+		setAnnotation(svc, PausedAnnotation, now)
+		r.paused = true
+	}
+	r.setHealthReportAnnotations(svc, candidate, healthCriteria, diagnosis)
+	lg.WithFields(logrus.Fields{"percent": r.previousPercent, "paused": r.paused}).Warn("unhealthy candidate, keeping its traffic")
+	if err := r.replaceService(svc); err != nil {
+		return errors.Wrap(err, "failed to flag unhealthy candidate")
+	}
+
+	r.notify(notify.UnhealthyEvent, svc, stable, candidate, svc.Metadata.Annotations[LastHealthReportAnnotation])
+	return nil
+}
@@ -0,0 +1,38 @@
+package rollout
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/health"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Verify diagnoses the latest ready revision of the service once without
+// changing its traffic, so the operator's verdict can be used by external
+// delivery pipelines (e.g. as a Cloud Deploy verification).
+//
+// Unlike Rollout, the revision is diagnosed even if it serves all the traffic,
+// since pipelines usually shift the traffic themselves.
+func (r *Rollout) Verify() (health.Report, error) {
+	revision := r.service.Status.LatestReadyRevisionName
+	if revision == "" {
+		return health.Report{}, errors.New("service has no ready revision")
+	}
+	r.log = r.log.WithFields(logrus.Fields{
+		"service":  r.serviceName,
+		"region":   r.region,
+		"revision": revision,
+	})
+
+	diagnosis, err := r.diagnoseCandidate(revision, r.strategy.HealthCriteria)
+	if err != nil {
+		return health.Report{}, errors.Wrapf(err, "failed to diagnose health for revision %q", revision)
+	}
+	report := health.NewReport(r.strategy.HealthCriteria, diagnosis)
+	report.Candidate = revision
+	report.TrafficStep = revisionTraffic(r.service, revision)
+	report.LastUpdate = r.time.Now()
+	if len(r.samples) != 0 {
+		report.Window = r.samples[0].Offset.String()
+	}
+	return report, nil
+}
@@ -0,0 +1,93 @@
+package rollout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/util"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/vulnerability"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// VulnerabilitiesRefusedAnnotation is set when a candidate is refused traffic
+// or rolled back because its image has vulnerabilities more severe than
+// allowed by the strategy, to the candidate and the reason. It is removed once
+// the image passes the scan.
+const VulnerabilitiesRefusedAnnotation = "rollout.cloud.run/vulnerabilitiesRefused"
+
+// maxReportedVulnerabilities is the maximum number of vulnerabilities listed
+// in the reason a candidate is refused, to keep the annotation short.
+const maxReportedVulnerabilities = 5
+
+// WithVulnerabilityScanner updates the scanner of the vulnerabilities of the
+// images of the candidates in the rollout instance.
+func (r *Rollout) WithVulnerabilityScanner(scanner vulnerability.Scanner) *Rollout {
+	r.vulnerabilityScanner = scanner
+	return r
+}
+
+// vulnerabilityRefusal checks the scan of the image of the candidate, pinned
+// to its digest. It returns the reason the candidate is refused, or an empty
+// string if the scan is finished and found no vulnerability more severe than
+// the maximum severity of the strategy, except the ignored ones.
+func (r *Rollout) vulnerabilityRefusal(candidate string) (string, error) {
+	if r.vulnerabilityScanner == nil {
+		return "", configErrorf("vulnerability scan is configured but no vulnerability scanner was provided")
+	}
+	image, refusal, err := r.pinnedCandidateImage(candidate)
+	if image == "" {
+		return refusal, err
+	}
+
+	ctx := util.ContextWithLogger(r.ctx, r.log)
+	report, err := r.vulnerabilityScanner.Scan(ctx, image)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get vulnerabilities")
+	}
+	switch report.Status {
+	case vulnerability.FinishedStatus:
+	case "", vulnerability.PendingStatus, vulnerability.ScanningStatus:
+		return fmt.Sprintf("vulnerability scan of image %s is not finished", image), nil
+	default:
+		return fmt.Sprintf("vulnerability scan of image %s failed (%s)", image, report.Status), nil
+	}
+
+	scan := r.strategy.VulnerabilityScan
+	ignored := make(map[string]bool)
+	for _, id := range scan.Ignore {
+		ignored[id] = true
+	}
+	var found []string
+	for _, v := range report.Vulnerabilities {
+		if !ignored[v.ID] && vulnerability.Exceeds(v.Severity, scan.MaxSeverity) {
+			found = append(found, fmt.Sprintf("%s (%s)", v.ID, v.Severity))
+		}
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	listed := found
+	if len(listed) > maxReportedVulnerabilities {
+		listed = append(listed[:maxReportedVulnerabilities:maxReportedVulnerabilities], fmt.Sprintf("%d more", len(found)-maxReportedVulnerabilities))
+	}
+	return fmt.Sprintf("image %s has %d vulnerabilities more severe than %s: %s", image, len(found), scan.MaxSeverity, strings.Join(listed, ", ")), nil
+}
+
+// rollbackRefusedCandidate rolls back a candidate whose image is refused once
+// it already serves all the traffic, e.g. a vulnerability was found after its
+// last traffic increase, instead of keeping all the traffic on it.
+func (r *Rollout) rollbackRefusedCandidate(svc *run.Service, stable, candidate, reason string) (*run.Service, error) {
+	r.log.WithField("reason", reason).Warn("candidate serving all the traffic refused, rollback")
+	r.shouldRollback = true
+	if r.group != nil {
+		r.group.fail(r.groupMember())
+	}
+	setAnnotation(svc, VulnerabilitiesRefusedAnnotation, candidate+": "+reason)
+	svc = r.PrepareRollback(svc, stable, candidate)
+	svc = r.updateAnnotations(svc, stable, candidate)
+	r.setHealthMessageAnnotations(svc, candidate, "candidate rolled back, "+reason)
+
+	err := r.replaceServiceAndNotify(svc, stable, candidate, r.trafficEventType())
+	return svc, errors.Wrap(err, "failed to replace service")
+}
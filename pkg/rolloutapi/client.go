@@ -0,0 +1,95 @@
+package rolloutapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// Client is a client of the rollout service.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient initializes a client on the connection to the operator.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// ListRollouts returns the managed services and the state of their rollout.
+func (c *Client) ListRollouts(ctx context.Context, opts ...grpc.CallOption) ([]*RolloutState, error) {
+	resp := new(ListRolloutsResponse)
+	if err := c.conn.Invoke(ctx, fullMethod(listMethod), new(ListRolloutsRequest), resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp.Rollouts, nil
+}
+
+// GetRollout returns the state of the rollout of the service and the current
+// diagnosis of its latest ready revision.
+func (c *Client) GetRollout(ctx context.Context, ref *RolloutRef, opts ...grpc.CallOption) (*Rollout, error) {
+	resp := new(Rollout)
+	if err := c.conn.Invoke(ctx, fullMethod(getMethod), ref, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// PauseRollout pauses the rollout of the service.
+func (c *Client) PauseRollout(ctx context.Context, ref *RolloutRef, opts ...grpc.CallOption) (*RolloutState, error) {
+	return c.control(ctx, pauseMethod, ref, opts...)
+}
+
+// ResumeRollout resumes the paused rollout of the service.
+func (c *Client) ResumeRollout(ctx context.Context, ref *RolloutRef, opts ...grpc.CallOption) (*RolloutState, error) {
+	return c.control(ctx, resumeMethod, ref, opts...)
+}
+
+// PromoteRollout promotes the candidate of the service to stable.
+func (c *Client) PromoteRollout(ctx context.Context, ref *RolloutRef, opts ...grpc.CallOption) (*RolloutState, error) {
+	return c.control(ctx, promoteMethod, ref, opts...)
+}
+
+// AbortRollout aborts the rollout of the candidate of the service.
+func (c *Client) AbortRollout(ctx context.Context, ref *RolloutRef, opts ...grpc.CallOption) (*RolloutState, error) {
+	return c.control(ctx, abortMethod, ref, opts...)
+}
+
+func (c *Client) control(ctx context.Context, method string, ref *RolloutRef, opts ...grpc.CallOption) (*RolloutState, error) {
+	resp := new(RolloutState)
+	if err := c.conn.Invoke(ctx, fullMethod(method), ref, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Watcher receives the states of the watched rollouts.
+type Watcher struct {
+	stream grpc.ClientStream
+}
+
+// Recv waits for the next state. It returns io.EOF when the operator ended
+// the watch.
+func (w *Watcher) Recv() (*RolloutState, error) {
+	state := new(RolloutState)
+	if err := w.stream.RecvMsg(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// WatchRollouts watches the rollouts of the matching services, until the
+// context is canceled.
+func (c *Client) WatchRollouts(ctx context.Context, req *WatchRolloutsRequest, opts ...grpc.CallOption) (*Watcher, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], fullMethod(watchMethod), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &Watcher{stream: stream}, nil
+}
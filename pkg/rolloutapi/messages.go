@@ -0,0 +1,174 @@
+package rolloutapi
+
+import (
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The messages of rolloutapi.proto. The struct tags describe their fields to
+// the protobuf runtime, so they are encoded like the generated messages.
+
+// RolloutRef identifies a managed service.
+type RolloutRef struct {
+	Project   string `protobuf:"bytes,1,opt,name=project,proto3"`
+	Region    string `protobuf:"bytes,2,opt,name=region,proto3"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3"`
+	Service   string `protobuf:"bytes,4,opt,name=service,proto3"`
+}
+
+// ListRolloutsRequest is the request to list the managed services.
+type ListRolloutsRequest struct{}
+
+// ListRolloutsResponse is the list of the managed services.
+type ListRolloutsResponse struct {
+	Rollouts []*RolloutState `protobuf:"bytes,1,rep,name=rollouts,proto3"`
+}
+
+// Phase is the phase of the rollout of a service.
+type Phase int32
+
+// Phases of the rollouts.
+const (
+	PhaseUnspecified Phase = 0
+	PhaseStable      Phase = 1
+	PhaseRollingOut  Phase = 2
+	PhaseRolledBack  Phase = 3
+	PhasePaused      Phase = 4
+	PhaseUnhealthy   Phase = 5
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseStable:
+		return "STABLE"
+	case PhaseRollingOut:
+		return "ROLLING_OUT"
+	case PhaseRolledBack:
+		return "ROLLED_BACK"
+	case PhasePaused:
+		return "PAUSED"
+	case PhaseUnhealthy:
+		return "UNHEALTHY"
+	default:
+		return "PHASE_UNSPECIFIED"
+	}
+}
+
+// RolloutState is the state of the rollout of a managed service.
+type RolloutState struct {
+	Project   string `protobuf:"bytes,1,opt,name=project,proto3"`
+	Region    string `protobuf:"bytes,2,opt,name=region,proto3"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3"`
+	Service   string `protobuf:"bytes,4,opt,name=service,proto3"`
+
+	// Strategy is the name of the strategy managing the service.
+	Strategy string `protobuf:"bytes,5,opt,name=strategy,proto3"`
+
+	Phase            Phase  `protobuf:"varint,6,opt,name=phase,proto3,enum=rollout.api.v1.Phase"`
+	Stable           string `protobuf:"bytes,7,opt,name=stable,proto3"`
+	Candidate        string `protobuf:"bytes,8,opt,name=candidate,proto3"`
+	CandidatePercent int64  `protobuf:"varint,9,opt,name=candidate_percent,json=candidatePercent,proto3"`
+
+	// LastRollout is the time of the last rollout (RFC 3339).
+	LastRollout string `protobuf:"bytes,10,opt,name=last_rollout,json=lastRollout,proto3"`
+}
+
+// Ref returns the reference to the service of the state.
+func (m *RolloutState) Ref() *RolloutRef {
+	return &RolloutRef{Project: m.Project, Region: m.Region, Namespace: m.Namespace, Service: m.Service}
+}
+
+// Rollout is the state of the rollout of a service and the current diagnosis
+// of its latest ready revision.
+type Rollout struct {
+	State     *RolloutState `protobuf:"bytes,1,opt,name=state,proto3"`
+	Diagnosis *Diagnosis    `protobuf:"bytes,2,opt,name=diagnosis,proto3"`
+}
+
+// Diagnosis is the result of the health checks of a revision.
+type Diagnosis struct {
+	// Status is healthy, unhealthy, inconclusive or unknown.
+	Status string `protobuf:"bytes,1,opt,name=status,proto3"`
+
+	// Message explains the status when the candidate was not diagnosed.
+	Message string   `protobuf:"bytes,2,opt,name=message,proto3"`
+	Checks  []*Check `protobuf:"bytes,3,rep,name=checks,proto3"`
+
+	// Window is the time window of the metrics used for the diagnosis.
+	Window string `protobuf:"bytes,4,opt,name=window,proto3"`
+
+	Candidate   string `protobuf:"bytes,5,opt,name=candidate,proto3"`
+	TrafficStep int64  `protobuf:"varint,6,opt,name=traffic_step,json=trafficStep,proto3"`
+}
+
+// Check is the result of the check of a health criterion.
+type Check struct {
+	Criterion  string  `protobuf:"bytes,1,opt,name=criterion,proto3"`
+	Metric     string  `protobuf:"bytes,2,opt,name=metric,proto3"`
+	Percentile float64 `protobuf:"fixed64,3,opt,name=percentile,proto3"`
+	Operation  string  `protobuf:"bytes,4,opt,name=operation,proto3"`
+	Threshold  float64 `protobuf:"fixed64,5,opt,name=threshold,proto3"`
+
+	// ActualValue is nil if the metrics value is missing.
+	ActualValue *wrapperspb.DoubleValue `protobuf:"bytes,6,opt,name=actual_value,json=actualValue,proto3"`
+
+	IsCriteriaMet bool   `protobuf:"varint,7,opt,name=is_criteria_met,json=isCriteriaMet,proto3"`
+	Reason        string `protobuf:"bytes,8,opt,name=reason,proto3"`
+}
+
+// WatchRolloutsRequest is the request to watch the rollouts of the matching
+// services. Empty fields match any service.
+type WatchRolloutsRequest struct {
+	Project   string `protobuf:"bytes,1,opt,name=project,proto3"`
+	Region    string `protobuf:"bytes,2,opt,name=region,proto3"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3"`
+	Service   string `protobuf:"bytes,4,opt,name=service,proto3"`
+}
+
+// Matches determines if the state is the one of a watched service.
+func (m *WatchRolloutsRequest) Matches(state *RolloutState) bool {
+	return (m.Project == "" || m.Project == state.Project) &&
+		(m.Region == "" || m.Region == state.Region) &&
+		(m.Namespace == "" || m.Namespace == state.Namespace) &&
+		(m.Service == "" || m.Service == state.Service)
+}
+
+// Methods of the messages required by the protobuf runtime.
+
+// text returns the text format of the message.
+func text(m interface{}) string {
+	return prototext.Format(protoimpl.X.ProtoMessageV2Of(m))
+}
+
+func (m *RolloutRef) Reset()         { *m = RolloutRef{} }
+func (m *RolloutRef) String() string { return text(m) }
+func (*RolloutRef) ProtoMessage()    {}
+
+func (m *ListRolloutsRequest) Reset()         { *m = ListRolloutsRequest{} }
+func (m *ListRolloutsRequest) String() string { return text(m) }
+func (*ListRolloutsRequest) ProtoMessage()    {}
+
+func (m *ListRolloutsResponse) Reset()         { *m = ListRolloutsResponse{} }
+func (m *ListRolloutsResponse) String() string { return text(m) }
+func (*ListRolloutsResponse) ProtoMessage()    {}
+
+func (m *RolloutState) Reset()         { *m = RolloutState{} }
+func (m *RolloutState) String() string { return text(m) }
+func (*RolloutState) ProtoMessage()    {}
+
+func (m *Rollout) Reset()         { *m = Rollout{} }
+func (m *Rollout) String() string { return text(m) }
+func (*Rollout) ProtoMessage()    {}
+
+func (m *Diagnosis) Reset()         { *m = Diagnosis{} }
+func (m *Diagnosis) String() string { return text(m) }
+func (*Diagnosis) ProtoMessage()    {}
+
+func (m *Check) Reset()         { *m = Check{} }
+func (m *Check) String() string { return text(m) }
+func (*Check) ProtoMessage()    {}
+
+func (m *WatchRolloutsRequest) Reset()         { *m = WatchRolloutsRequest{} }
+func (m *WatchRolloutsRequest) String() string { return text(m) }
+func (*WatchRolloutsRequest) ProtoMessage()    {}
@@ -0,0 +1,142 @@
+// Package rolloutapi defines the gRPC API of the operator, so internal
+// platforms can inspect, steer and watch the rollouts of the managed services
+// with typed messages instead of the JSON of the admin API.
+//
+// The API is described in rolloutapi.proto, from which clients in any language
+// can be generated. Clients written in Go can use Client, and the operator
+// registers its implementation of Server with RegisterServer.
+package rolloutapi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the fully-qualified name of the gRPC service.
+const ServiceName = "rollout.api.v1.RolloutService"
+
+// Method names of the gRPC service.
+const (
+	listMethod    = "ListRollouts"
+	getMethod     = "GetRollout"
+	pauseMethod   = "PauseRollout"
+	resumeMethod  = "ResumeRollout"
+	promoteMethod = "PromoteRollout"
+	abortMethod   = "AbortRollout"
+	watchMethod   = "WatchRollouts"
+)
+
+// ErrNotFound should be returned by the server when the service is not
+// managed by the operator. It is sent as a NOT_FOUND status.
+var ErrNotFound = errors.New("service is not managed by the operator")
+
+// Server is the interface implemented by the operator.
+type Server interface {
+	ListRollouts(ctx context.Context) ([]*RolloutState, error)
+	GetRollout(ctx context.Context, ref *RolloutRef) (*Rollout, error)
+	PauseRollout(ctx context.Context, ref *RolloutRef) (*RolloutState, error)
+	ResumeRollout(ctx context.Context, ref *RolloutRef) (*RolloutState, error)
+	PromoteRollout(ctx context.Context, ref *RolloutRef) (*RolloutState, error)
+	AbortRollout(ctx context.Context, ref *RolloutRef) (*RolloutState, error)
+
+	// WatchRollouts sends the state of the rollouts of the watched services,
+	// then their new state every time it changes, until the context is done.
+	WatchRollouts(ctx context.Context, req *WatchRolloutsRequest, send func(*RolloutState) error) error
+}
+
+// RegisterServer registers the implementation of the rollout service.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: listMethod, Handler: handler(listMethod, func() interface{} { return new(ListRolloutsRequest) },
+			func(srv Server, ctx context.Context, _ interface{}) (interface{}, error) {
+				rollouts, err := srv.ListRollouts(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return &ListRolloutsResponse{Rollouts: rollouts}, nil
+			})},
+		{MethodName: getMethod, Handler: refHandler(getMethod, func(srv Server, ctx context.Context, ref *RolloutRef) (interface{}, error) {
+			return srv.GetRollout(ctx, ref)
+		})},
+		{MethodName: pauseMethod, Handler: refHandler(pauseMethod, stateFunc(Server.PauseRollout))},
+		{MethodName: resumeMethod, Handler: refHandler(resumeMethod, stateFunc(Server.ResumeRollout))},
+		{MethodName: promoteMethod, Handler: refHandler(promoteMethod, stateFunc(Server.PromoteRollout))},
+		{MethodName: abortMethod, Handler: refHandler(abortMethod, stateFunc(Server.AbortRollout))},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: watchMethod, Handler: watchHandler, ServerStreams: true},
+	},
+	Metadata: "rolloutapi.proto",
+}
+
+type serverFunc func(srv Server, ctx context.Context, req interface{}) (interface{}, error)
+
+type refFunc func(srv Server, ctx context.Context, ref *RolloutRef) (interface{}, error)
+
+// stateFunc adapts a control method of the server.
+func stateFunc(fn func(Server, context.Context, *RolloutRef) (*RolloutState, error)) refFunc {
+	return func(srv Server, ctx context.Context, ref *RolloutRef) (interface{}, error) {
+		return fn(srv, ctx, ref)
+	}
+}
+
+// refHandler returns the handler of a method that receives a RolloutRef.
+func refHandler(method string, fn refFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return handler(method, func() interface{} { return new(RolloutRef) }, func(srv Server, ctx context.Context, req interface{}) (interface{}, error) {
+		return fn(srv, ctx, req.(*RolloutRef))
+	})
+}
+
+// handler returns the gRPC method handler that decodes the request created by
+// newReq and calls the server function.
+func handler(method string, newReq func() interface{}, fn serverFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newReq()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req interface{}) (interface{}, error) {
+			resp, err := fn(srv.(Server), ctx, req)
+			return resp, statusError(err)
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(method)}
+		return interceptor(ctx, in, info, call)
+	}
+}
+
+// watchHandler is the gRPC stream handler of WatchRollouts.
+func watchHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(WatchRolloutsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	err := srv.(Server).WatchRollouts(stream.Context(), req, func(state *RolloutState) error {
+		return stream.SendMsg(state)
+	})
+	return statusError(err)
+}
+
+// statusError converts the errors of the server to gRPC statuses.
+func statusError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
+
+func fullMethod(method string) string {
+	return "/" + ServiceName + "/" + method
+}
@@ -0,0 +1,157 @@
+package rolloutapi_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rolloutapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type fakeServer struct {
+	states  []*rolloutapi.RolloutState
+	actions []string
+}
+
+func (s *fakeServer) find(ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	for _, state := range s.states {
+		if state.Project == ref.Project && state.Region == ref.Region && state.Namespace == ref.Namespace && state.Service == ref.Service {
+			return state, nil
+		}
+	}
+	return nil, rolloutapi.ErrNotFound
+}
+
+func (s *fakeServer) ListRollouts(ctx context.Context) ([]*rolloutapi.RolloutState, error) {
+	return s.states, nil
+}
+
+func (s *fakeServer) GetRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.Rollout, error) {
+	state, err := s.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &rolloutapi.Rollout{
+		State: state,
+		Diagnosis: &rolloutapi.Diagnosis{
+			Status:    "unhealthy",
+			Candidate: state.Candidate,
+			Checks: []*rolloutapi.Check{
+				{Criterion: "error-rate-percent", Metric: "error-rate-percent", Threshold: 1, ActualValue: wrapperspb.Double(2.5)},
+				{Criterion: "latency-ms-p99", Metric: "latency-ms", Percentile: 99, Threshold: 500, Reason: "no metrics data for the candidate revision"},
+			},
+		},
+	}, nil
+}
+
+func (s *fakeServer) control(action string, ref *rolloutapi.RolloutRef, phase rolloutapi.Phase) (*rolloutapi.RolloutState, error) {
+	state, err := s.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	s.actions = append(s.actions, action)
+	state.Phase = phase
+	return state, nil
+}
+
+func (s *fakeServer) PauseRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control("pause", ref, rolloutapi.PhasePaused)
+}
+
+func (s *fakeServer) ResumeRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control("resume", ref, rolloutapi.PhaseRollingOut)
+}
+
+func (s *fakeServer) PromoteRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control("promote", ref, rolloutapi.PhaseStable)
+}
+
+func (s *fakeServer) AbortRollout(ctx context.Context, ref *rolloutapi.RolloutRef) (*rolloutapi.RolloutState, error) {
+	return s.control("abort", ref, rolloutapi.PhaseRolledBack)
+}
+
+func (s *fakeServer) WatchRollouts(ctx context.Context, req *rolloutapi.WatchRolloutsRequest, send func(*rolloutapi.RolloutState) error) error {
+	for _, state := range s.states {
+		if !req.Matches(state) {
+			continue
+		}
+		if err := send(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	srv := &fakeServer{states: []*rolloutapi.RolloutState{
+		{Project: "myproject", Region: "us-east1", Service: "checkout", Strategy: "default", Phase: rolloutapi.PhaseRollingOut, Stable: "checkout-001", Candidate: "checkout-002", CandidatePercent: 20, LastRollout: "2020-07-01T10:00:00Z"},
+		{Project: "myproject", Region: "us-west1", Service: "checkout", Strategy: "default", Phase: rolloutapi.PhaseStable, Stable: "checkout-003"},
+		{Project: "myproject", Region: "us-east1", Service: "cart", Strategy: "default", Phase: rolloutapi.PhaseStable, Stable: "cart-001"},
+	}}
+	rolloutapi.RegisterServer(server, srv)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := rolloutapi.NewClient(conn)
+
+	rollouts, err := client.ListRollouts(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, srv.states, rollouts)
+
+	ref := srv.states[0].Ref()
+	rollout, err := client.GetRollout(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, srv.states[0], rollout.State)
+	assert.Equal(t, "checkout-002", rollout.Diagnosis.Candidate)
+	assert.Equal(t, 2.5, rollout.Diagnosis.Checks[0].ActualValue.GetValue())
+	assert.Nil(t, rollout.Diagnosis.Checks[1].ActualValue)
+	assert.Equal(t, 99.0, rollout.Diagnosis.Checks[1].Percentile)
+
+	state, err := client.PauseRollout(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, rolloutapi.PhasePaused, state.Phase)
+	state, err = client.ResumeRollout(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, rolloutapi.PhaseRollingOut, state.Phase)
+	state, err = client.AbortRollout(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, rolloutapi.PhaseRolledBack, state.Phase)
+	state, err = client.PromoteRollout(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, rolloutapi.PhaseStable, state.Phase)
+	assert.Equal(t, []string{"pause", "resume", "abort", "promote"}, srv.actions)
+
+	_, err = client.PauseRollout(ctx, &rolloutapi.RolloutRef{Project: "myproject", Region: "us-east1", Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	watcher, err := client.WatchRollouts(ctx, &rolloutapi.WatchRolloutsRequest{Service: "checkout"})
+	assert.Nil(t, err)
+	var watched []string
+	for {
+		state, err := watcher.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		watched = append(watched, state.Region+"/"+state.Service)
+	}
+	assert.Equal(t, []string{"us-east1/checkout", "us-west1/checkout"}, watched)
+}
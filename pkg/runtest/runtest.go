@@ -0,0 +1,260 @@
+// Package runtest provides a fake client of the Cloud Run API, so the rollout
+// of services can be tested deterministically with rollout.Rollout.WithClient.
+//
+// The fake keeps the services and the revisions in memory and records the
+// calls. The states of a service can be scripted, e.g. to simulate a
+// deployment while the rollout is evaluated, and so can the errors of the
+// calls.
+package runtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/run/v1"
+)
+
+// Methods of the client, as recorded in the calls.
+const (
+	ServiceMethod                   = "Service"
+	ReplaceServiceMethod            = "ReplaceService"
+	RevisionMethod                  = "Revision"
+	ServicesWithLabelSelectorMethod = "ServicesWithLabelSelector"
+)
+
+// Call is a call to the client.
+type Call struct {
+	Method    string
+	Namespace string
+
+	// Name is the name of the service or revision, or the label selector.
+	Name string
+
+	// Service is a copy of the service sent to ReplaceService.
+	Service *run.Service
+}
+
+// Client is a fake client of the Cloud Run API (or Knative Serving).
+//
+// The namespace of the services and revisions is the project for Cloud Run
+// (fully managed). Every service and revision returned is a copy, so the
+// callers cannot change the state of the fake.
+type Client struct {
+	mu        sync.Mutex
+	services  map[string]*fakeService
+	revisions map[string]*run.Revision
+	errors    map[string][]error
+	calls     []Call
+}
+
+// fakeService is the current state of a service and its scripted states.
+type fakeService struct {
+	current *run.Service
+	next    []*run.Service
+}
+
+// NewClient initializes a fake client without services.
+func NewClient() *Client {
+	return &Client{
+		services:  make(map[string]*fakeService),
+		revisions: make(map[string]*run.Revision),
+		errors:    make(map[string][]error),
+	}
+}
+
+// WithService adds the service to the namespace with its states: the first
+// state is the current state of the service, and the next ones replace it one
+// by one every time the service is retrieved, before it is returned, as if the
+// service was modified concurrently (e.g. by a deployment).
+func (c *Client) WithService(namespace string, states ...*run.Service) *Client {
+	if len(states) == 0 {
+		panic("runtest: WithService requires at least one state")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	svc := &fakeService{current: copyService(states[0])}
+	for _, state := range states[1:] {
+		svc.next = append(svc.next, copyService(state))
+	}
+	c.services[path.Join(namespace, states[0].Metadata.Name)] = svc
+	return c
+}
+
+// WithRevision adds the revision to the namespace.
+func (c *Client) WithRevision(namespace string, revision *run.Revision) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revisions[path.Join(namespace, revision.Metadata.Name)] = copyRevision(revision)
+	return c
+}
+
+// FailNext makes the next calls of the method fail with the errors, one per
+// call (e.g. Conflict to simulate a concurrent update).
+func (c *Client) FailNext(method string, errs ...error) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[method] = append(c.errors[method], errs...)
+	return c
+}
+
+// Current returns a copy of the current state of the service, or nil if there
+// is no such service.
+func (c *Client) Current(namespace, name string) *run.Service {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	svc, ok := c.services[path.Join(namespace, name)]
+	if !ok {
+		return nil
+	}
+	return copyService(svc.current)
+}
+
+// Calls returns the calls to the client, in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// CallCount returns the number of calls of the method.
+func (c *Client) CallCount(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, call := range c.calls {
+		if call.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// NotFound returns the error of the API for a missing resource.
+func NotFound(name string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("%s not found", name)}
+}
+
+// Conflict returns the error of the API for an update with an outdated
+// resource version.
+func Conflict(name string) error {
+	return &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("%s was modified concurrently", name)}
+}
+
+// Service returns the service, after applying its next scripted state, if
+// any.
+func (c *Client) Service(namespace, serviceID string) (*run.Service, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record(Call{Method: ServiceMethod, Namespace: namespace, Name: serviceID}); err != nil {
+		return nil, err
+	}
+	svc, ok := c.services[path.Join(namespace, serviceID)]
+	if !ok {
+		return nil, NotFound(serviceID)
+	}
+	if len(svc.next) != 0 {
+		svc.current, svc.next = svc.next[0], svc.next[1:]
+	}
+	return copyService(svc.current), nil
+}
+
+// ReplaceService replaces the current state of the service. The update is
+// rejected with a Conflict error if the resource version of the service is
+// set and outdated. The resource version of the replaced service is
+// incremented.
+func (c *Client) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record(Call{Method: ReplaceServiceMethod, Namespace: namespace, Name: serviceID, Service: copyService(svc)}); err != nil {
+		return nil, err
+	}
+	existing, ok := c.services[path.Join(namespace, serviceID)]
+	if !ok {
+		return nil, NotFound(serviceID)
+	}
+	current := existing.current.Metadata.ResourceVersion
+	if version := svc.Metadata.ResourceVersion; version != "" && version != current {
+		return nil, Conflict(serviceID)
+	}
+	replaced := copyService(svc)
+	version, _ := strconv.Atoi(current)
+	replaced.Metadata.ResourceVersion = strconv.Itoa(version + 1)
+	existing.current = replaced
+	return copyService(replaced), nil
+}
+
+// Revision returns the revision.
+func (c *Client) Revision(namespace, revisionID string) (*run.Revision, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record(Call{Method: RevisionMethod, Namespace: namespace, Name: revisionID}); err != nil {
+		return nil, err
+	}
+	revision, ok := c.revisions[path.Join(namespace, revisionID)]
+	if !ok {
+		return nil, NotFound(revisionID)
+	}
+	return copyRevision(revision), nil
+}
+
+// ServicesWithLabelSelector returns the current state of the services of the
+// namespace that match the label selector (key=value, key!=value or key
+// requirements, separated by commas), sorted by name.
+func (c *Client) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record(Call{Method: ServicesWithLabelSelectorMethod, Namespace: namespace, Name: labelSelector}); err != nil {
+		return nil, err
+	}
+	var svcs []*run.Service
+	for key, svc := range c.services {
+		if path.Dir(key) == namespace && runapi.MatchesLabelSelector(svc.current.Metadata.Labels, labelSelector) {
+			svcs = append(svcs, copyService(svc.current))
+		}
+	}
+	sort.Slice(svcs, func(i, j int) bool { return svcs[i].Metadata.Name < svcs[j].Metadata.Name })
+	return svcs, nil
+}
+
+// record records the call and returns its scripted error, if any. The lock
+// must be held.
+func (c *Client) record(call Call) error {
+	c.calls = append(c.calls, call)
+	errs := c.errors[call.Method]
+	if len(errs) == 0 {
+		return nil
+	}
+	c.errors[call.Method] = errs[1:]
+	return errs[0]
+}
+
+// copyService returns a deep copy of the service.
+func copyService(svc *run.Service) *run.Service {
+	var copied run.Service
+	mustCopy(svc, &copied)
+	return &copied
+}
+
+// copyRevision returns a deep copy of the revision.
+func copyRevision(revision *run.Revision) *run.Revision {
+	var copied run.Revision
+	mustCopy(revision, &copied)
+	return &copied
+}
+
+func mustCopy(from, to interface{}) {
+	data, err := json.Marshal(from)
+	if err == nil {
+		err = json.Unmarshal(data, to)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("runtest: could not copy %T: %v", from, err))
+	}
+}
@@ -0,0 +1,107 @@
+package runtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/metricstest"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/runtest"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func service(name, latestReady string, labels map[string]string, traffic ...*run.TrafficTarget) *run.Service {
+	return &run.Service{
+		Metadata: &run.ObjectMeta{Name: name, Labels: labels},
+		Spec:     &run.ServiceSpec{Traffic: traffic},
+		Status:   &run.ServiceStatus{LatestReadyRevisionName: latestReady, Traffic: traffic},
+	}
+}
+
+func TestClient(t *testing.T) {
+	checkout := service("checkout", "checkout-001", map[string]string{"rollout-strategy": "gradual"})
+	deployed := service("checkout", "checkout-002", map[string]string{"rollout-strategy": "gradual"})
+	client := runtest.NewClient().
+		WithService("myproject", checkout, deployed).
+		WithService("myproject", service("cart", "cart-001", nil)).
+		WithRevision("myproject", &run.Revision{Metadata: &run.ObjectMeta{Name: "checkout-001"}})
+
+	svcs, err := client.ServicesWithLabelSelector("myproject", "rollout-strategy=gradual")
+	assert.Nil(t, err)
+	if assert.Len(t, svcs, 1) {
+		assert.Equal(t, "checkout-001", svcs[0].Status.LatestReadyRevisionName)
+	}
+	svcs, _ = client.ServicesWithLabelSelector("myproject", "")
+	assert.Len(t, svcs, 2)
+
+	// The next scripted state is applied when the service is retrieved.
+	svc, err := client.Service("myproject", "checkout")
+	assert.Nil(t, err)
+	assert.Equal(t, "checkout-002", svc.Status.LatestReadyRevisionName)
+	svc.Metadata.Annotations = map[string]string{"modified": "true"}
+	assert.Nil(t, client.Current("myproject", "checkout").Metadata.Annotations, "copy modified")
+
+	replaced, err := client.ReplaceService("myproject", "checkout", svc)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", replaced.Metadata.ResourceVersion)
+	_, err = client.ReplaceService("myproject", "checkout", replaced)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", client.Current("myproject", "checkout").Metadata.ResourceVersion)
+	_, err = client.ReplaceService("myproject", "checkout", replaced)
+	assert.True(t, runapi.IsConflict(err), "outdated resource version")
+
+	client.FailNext(runtest.ServiceMethod, runtest.Conflict("checkout"))
+	_, err = client.Service("myproject", "checkout")
+	assert.NotNil(t, err)
+	_, err = client.Service("myproject", "checkout")
+	assert.Nil(t, err)
+	_, err = client.Service("otherproject", "checkout")
+	assert.NotNil(t, err)
+
+	revision, err := client.Revision("myproject", "checkout-001")
+	assert.Nil(t, err)
+	assert.Equal(t, "checkout-001", revision.Metadata.Name)
+
+	assert.Equal(t, 4, client.CallCount(runtest.ServiceMethod))
+	calls := client.Calls()
+	assert.Equal(t, runtest.ReplaceServiceMethod, calls[3].Method)
+	assert.Equal(t, "true", calls[3].Service.Metadata.Annotations["modified"])
+	assert.Equal(t, 3, client.CallCount(runtest.ReplaceServiceMethod))
+}
+
+func TestRollout_WithFakes(t *testing.T) {
+	traffic := []*run.TrafficTarget{
+		{RevisionName: "checkout-001", Percent: 100, Tag: rollout.StableTag},
+		{LatestRevision: true, Tag: rollout.LatestTag},
+	}
+	client := runtest.NewClient().WithService("myproject", service("checkout", "checkout-002", nil, traffic...))
+	provider := metricstest.NewProvider().
+		WithRequestCount(metricstest.AnyRevision, 1000).
+		WithErrorRate(metricstest.AnyRevision, 0.001)
+	strategy := config.Strategy{
+		Steps:              []int64{10, 50},
+		HealthOffsetMinute: 5,
+		HealthCriteria:     []config.HealthCriterion{{Metric: config.ErrorRateMetricsCheck, Threshold: 1}},
+	}
+
+	svc := client.Current("myproject", "checkout")
+	record := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+	changed, err := rollout.New(context.Background(), provider, record, strategy).
+		WithClient(client).WithClock(clockwork.NewFakeClockAt(time.Unix(1600000000, 0))).Rollout()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+
+	current := client.Current("myproject", "checkout")
+	assert.Equal(t, "checkout-002", current.Metadata.Annotations[rollout.CandidateRevisionAnnotation])
+	for _, target := range current.Spec.Traffic {
+		if target.RevisionName == "checkout-002" {
+			assert.Equal(t, int64(10), target.Percent)
+		}
+	}
+	assert.Equal(t, 1, client.CallCount(runtest.ReplaceServiceMethod))
+}
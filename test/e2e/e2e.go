@@ -0,0 +1,376 @@
+// Package e2e drives the operator against disposable services of a sandbox
+// project, so the traffic logic can be validated against the real Cloud Run
+// API.
+//
+// The tests only build with the e2e tag (make e2e) and are skipped unless
+// E2E_PROJECT is set. The services are deployed to E2E_REGION (default:
+// us-central1) with the E2E_IMAGE image (default: the hello sample), and are
+// deleted at the end of their test. The credentials are the Application
+// Default Credentials, which need the Cloud Run Admin and Monitoring Viewer
+// roles in the sandbox project. The sandbox project must allow
+// unauthenticated services, so the probes can reach the candidates.
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-operator/internal/run"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+const (
+	defaultRegion = "us-central1"
+	defaultImage  = "gcr.io/cloudrun/hello"
+
+	// runLabel is the label of the services deployed by a run of the tests,
+	// so the operator only targets them.
+	runLabel = "rollout-e2e"
+
+	// generationEnv is the environment variable changed to deploy new
+	// revisions.
+	generationEnv = "E2E_GENERATION"
+
+	readyTimeout = 5 * time.Minute
+	pollInterval = 5 * time.Second
+)
+
+// Outcomes of the rollout of a service, as written in the summary of the
+// operator.
+const (
+	RollingOutOutcome = "rollingOut"
+	PromotedOutcome   = "promoted"
+	RolledBackOutcome = "rolledBack"
+)
+
+// Summary is the summary of a run of the operator (-out).
+type Summary struct {
+	ExitCode int       `json:"exitCode"`
+	Services []Outcome `json:"services"`
+	Errors   []string  `json:"errors"`
+}
+
+// Outcome is the outcome of the rollout of a service in a summary.
+type Outcome struct {
+	Service          string `json:"service"`
+	Stable           string `json:"stable"`
+	Candidate        string `json:"candidate"`
+	CandidatePercent int64  `json:"candidatePercent"`
+	Decision         string `json:"decision"`
+	Outcome          string `json:"outcome"`
+	Error            string `json:"error"`
+}
+
+// Sandbox deploys the services of a test to the sandbox project and runs the
+// operator against them.
+type Sandbox struct {
+	Project string
+	Region  string
+	Image   string
+
+	// RunID is the value of the label of the services of this run.
+	RunID string
+
+	// OperatorArgs are the additional flags of the operator (e.g. -chaos).
+	OperatorArgs []string
+
+	t   *testing.T
+	api *runapi.API
+}
+
+var (
+	buildOnce   sync.Once
+	operatorBin string
+	buildErr    error
+)
+
+// NewSandbox initializes a sandbox for the test, or skips the test if no
+// sandbox project is configured. The operator is built once per run of the
+// tests.
+func NewSandbox(t *testing.T) *Sandbox {
+	t.Helper()
+	project := os.Getenv("E2E_PROJECT")
+	if project == "" {
+		t.Skip("E2E_PROJECT not set")
+	}
+	s := &Sandbox{
+		Project: project,
+		Region:  getenv("E2E_REGION", defaultRegion),
+		Image:   getenv("E2E_IMAGE", defaultImage),
+		RunID:   strconv.FormatInt(time.Now().Unix(), 36) + strconv.Itoa(rand.Intn(1000)),
+		t:       t,
+	}
+
+	api, err := runapi.NewAPIClient(context.Background(), s.Region)
+	if err != nil {
+		t.Fatalf("could not initialize client: %v", err)
+	}
+	s.api = api
+
+	buildOnce.Do(func() {
+		operatorBin, buildErr = buildOperator()
+	})
+	if buildErr != nil {
+		t.Fatalf("could not build the operator: %v", buildErr)
+	}
+	return s
+}
+
+// buildOperator builds the operator to a temporary directory.
+func buildOperator() (string, error) {
+	dir, err := ioutil.TempDir("", "rollout-e2e")
+	if err != nil {
+		return "", errors.Wrap(err, "could not create build directory")
+	}
+	bin := filepath.Join(dir, "operator")
+	cmd := exec.Command("go", "build", "-o", bin, "github.com/GoogleCloudPlatform/cloud-run-release-operator/cmd/operator")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Wrapf(err, "go build failed: %s", out)
+	}
+	return bin, nil
+}
+
+// LabelSelector is the label selector of the services of the sandbox.
+func (s *Sandbox) LabelSelector() string {
+	return runLabel + "=" + s.RunID
+}
+
+// DeployService deploys a public service, named after the prefix, whose
+// first revision serves 100% of the traffic, and deletes it at the end of
+// the test. It returns the name of the service.
+func (s *Sandbox) DeployService(prefix string) string {
+	s.t.Helper()
+	name := fmt.Sprintf("%s-%s", prefix, s.RunID)
+	svc := &run.Service{
+		ApiVersion: "serving.knative.dev/v1",
+		Kind:       "Service",
+		Metadata: &run.ObjectMeta{
+			Name:      name,
+			Namespace: s.Project,
+			Labels:    map[string]string{runLabel: s.RunID},
+		},
+		Spec: &run.ServiceSpec{
+			Template: &run.RevisionTemplate{
+				Spec: &run.RevisionSpec{
+					Containers: []*run.Container{{
+						Image: s.Image,
+						Env:   []*run.EnvVar{{Name: generationEnv, Value: "1"}},
+					}},
+				},
+			},
+		},
+	}
+	if _, err := s.api.Client.Namespaces.Services.Create("namespaces/"+s.Project, svc).Do(); err != nil {
+		s.t.Fatalf("could not create service %s: %v", name, err)
+	}
+	s.t.Cleanup(func() {
+		if _, err := s.api.Client.Namespaces.Services.Delete(s.serviceName(name)).Do(); err != nil {
+			s.t.Logf("could not delete service %s: %v", name, err)
+		}
+	})
+
+	policy := &run.SetIamPolicyRequest{Policy: &run.Policy{
+		Bindings: []*run.Binding{{Role: "roles/run.invoker", Members: []string{"allUsers"}}},
+	}}
+	resource := fmt.Sprintf("projects/%s/locations/%s/services/%s", s.Project, s.Region, name)
+	if _, err := s.api.Client.Projects.Locations.Services.SetIamPolicy(resource, policy).Do(); err != nil {
+		s.t.Fatalf("could not make service %s public: %v", name, err)
+	}
+
+	// The traffic is pinned to the first revision, so the next revisions are
+	// deployed without traffic, as with --no-traffic.
+	ready := s.waitReady(name)
+	ready.Spec.Traffic = []*run.TrafficTarget{{RevisionName: ready.Status.LatestReadyRevisionName, Percent: 100}}
+	if _, err := s.api.ReplaceService(s.Project, name, ready); err != nil {
+		s.t.Fatalf("could not pin the traffic of service %s: %v", name, err)
+	}
+	s.waitReady(name)
+	return name
+}
+
+// DeployRevision deploys a new revision of the service without traffic, and
+// returns its name.
+func (s *Sandbox) DeployRevision(name string) string {
+	s.t.Helper()
+	svc := s.Service(name)
+	container := svc.Spec.Template.Spec.Containers[0]
+	generation := 0
+	for _, env := range container.Env {
+		if env.Name == generationEnv {
+			generation, _ = strconv.Atoi(env.Value)
+			env.Value = strconv.Itoa(generation + 1)
+		}
+	}
+	svc.Spec.Template.Metadata = nil
+	if _, err := s.api.ReplaceService(s.Project, name, svc); err != nil {
+		s.t.Fatalf("could not deploy revision of service %s: %v", name, err)
+	}
+	return s.waitReady(name).Status.LatestReadyRevisionName
+}
+
+// Service returns the current state of the service.
+func (s *Sandbox) Service(name string) *run.Service {
+	s.t.Helper()
+	svc, err := s.api.Service(s.Project, name)
+	if err != nil {
+		s.t.Fatalf("could not get service %s: %v", name, err)
+	}
+	return svc
+}
+
+// Traffic returns the percent of the traffic of the service served by the
+// revision.
+func (s *Sandbox) Traffic(name, revision string) int64 {
+	s.t.Helper()
+	var percent int64
+	for _, target := range s.Service(name).Status.Traffic {
+		if target.RevisionName == revision {
+			percent += target.Percent
+		}
+	}
+	return percent
+}
+
+// Annotation returns the rollout annotation of the service (e.g.
+// rollout.StableRevisionAnnotation).
+func (s *Sandbox) Annotation(name, annotation string) string {
+	s.t.Helper()
+	return s.Service(name).Metadata.Annotations[annotation]
+}
+
+// waitReady waits until the last update of the service is ready, and returns
+// the service.
+func (s *Sandbox) waitReady(name string) *run.Service {
+	s.t.Helper()
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		svc := s.Service(name)
+		if svc.Status != nil && svc.Status.ObservedGeneration == svc.Metadata.Generation {
+			for _, condition := range svc.Status.Conditions {
+				if condition.Type != "Ready" {
+					continue
+				}
+				if condition.Status == "True" {
+					return svc
+				}
+				if condition.Status == "False" {
+					s.t.Fatalf("service %s is not ready: %s", name, condition.Message)
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("service %s not ready after %s", name, readyTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// RunOperator runs the operator once (-once) with the configuration file and
+// returns its summary. The operator failing is not fatal, since its exit code
+// reflects the outcomes of the rollouts.
+func (s *Sandbox) RunOperator(config string) Summary {
+	s.t.Helper()
+	dir, err := ioutil.TempDir("", "rollout-e2e")
+	if err != nil {
+		s.t.Fatalf("could not create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	summaryFile := filepath.Join(dir, "summary.json")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0644); err != nil {
+		s.t.Fatalf("could not write configuration: %v", err)
+	}
+
+	args := append([]string{"-once", "-config=" + configFile, "-out=" + summaryFile}, s.OperatorArgs...)
+	cmd := exec.Command(operatorBin, args...)
+	out, err := cmd.CombinedOutput()
+	s.t.Logf("operator: %s", out)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		s.t.Fatalf("could not run the operator: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(summaryFile)
+	if err != nil {
+		s.t.Fatalf("could not read summary: %v", err)
+	}
+	var summary Summary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		s.t.Fatalf("could not parse summary: %v", err)
+	}
+	return summary
+}
+
+// RolloutUntil runs the operator until the rollout of the service reaches
+// one of the outcomes, waiting between the runs, and returns its last
+// outcome. The test fails if no such outcome is reached after maxRuns runs.
+func (s *Sandbox) RolloutUntil(config, name string, wait time.Duration, maxRuns int, outcomes ...string) Outcome {
+	s.t.Helper()
+	var last Outcome
+	for i := 0; i < maxRuns; i++ {
+		if i > 0 {
+			time.Sleep(wait)
+		}
+		summary := s.RunOperator(config)
+		for _, outcome := range summary.Services {
+			if outcome.Service != name {
+				continue
+			}
+			last = outcome
+			s.t.Logf("run %d: %s at %d%% (%s)", i+1, outcome.Outcome, outcome.CandidatePercent, outcome.Decision)
+			for _, want := range outcomes {
+				if outcome.Outcome == want {
+					return outcome
+				}
+			}
+		}
+	}
+	s.t.Fatalf("rollout of service %s did not reach %v after %d runs, last outcome: %+v", name, outcomes, maxRuns, last)
+	return last
+}
+
+// Config returns a configuration file with a single strategy targeting the
+// services of the sandbox, whose candidates are probed with the body regex
+// before they receive traffic.
+func (s *Sandbox) Config(bodyRegex string, steps ...int64) string {
+	stepsJSON, _ := json.Marshal(steps)
+	return fmt.Sprintf(`strategies:
+- target:
+    project: %s
+    regions: [%s]
+    labelSelector: %s
+  steps: %s
+  healthOffsetMinute: 1
+  timeBetweenRollouts: 0s
+  healthCriteria:
+  - metric: error-rate-percent
+    threshold: 100
+  probe:
+    path: /
+    expectedStatus: 200
+    bodyRegex: %q
+    requests: 3
+    minSuccessPercent: 100
+`, s.Project, s.Region, s.LabelSelector(), stepsJSON, bodyRegex)
+}
+
+func (s *Sandbox) serviceName(name string) string {
+	return fmt.Sprintf("namespaces/%s/services/%s", s.Project, name)
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
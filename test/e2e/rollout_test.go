@@ -0,0 +1,67 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/pkg/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-operator/test/e2e"
+	"github.com/stretchr/testify/assert"
+)
+
+// healthOffset is the wait between the runs of the operator, so the candidate
+// gets metrics for the health offset of the strategies.
+const healthOffset = time.Minute
+
+func TestPromotion(t *testing.T) {
+	sandbox := e2e.NewSandbox(t)
+	svc := sandbox.DeployService("promote")
+	stable := sandbox.Service(svc).Status.LatestReadyRevisionName
+	candidate := sandbox.DeployRevision(svc)
+	assert.Equal(t, int64(0), sandbox.Traffic(svc, candidate))
+
+	// The probe always passes.
+	config := sandbox.Config(".", 50)
+	outcome := sandbox.RolloutUntil(config, svc, healthOffset, 6, e2e.PromotedOutcome, e2e.RolledBackOutcome)
+
+	assert.Equal(t, e2e.PromotedOutcome, outcome.Outcome)
+	assert.Equal(t, int64(100), sandbox.Traffic(svc, candidate))
+	assert.Equal(t, int64(0), sandbox.Traffic(svc, stable))
+	assert.Equal(t, candidate, sandbox.Annotation(svc, rollout.StableRevisionAnnotation))
+}
+
+func TestRollback(t *testing.T) {
+	sandbox := e2e.NewSandbox(t)
+	svc := sandbox.DeployService("rollback")
+	stable := sandbox.Service(svc).Status.LatestReadyRevisionName
+	candidate := sandbox.DeployRevision(svc)
+
+	// The probe never passes, so the candidate is rolled back before it
+	// receives any traffic.
+	config := sandbox.Config("^never matched by the hello sample$", 50)
+	outcome := sandbox.RolloutUntil(config, svc, healthOffset, 6, e2e.PromotedOutcome, e2e.RolledBackOutcome)
+
+	assert.Equal(t, e2e.RolledBackOutcome, outcome.Outcome)
+	assert.Equal(t, int64(100), sandbox.Traffic(svc, stable))
+	assert.Equal(t, int64(0), sandbox.Traffic(svc, candidate))
+	assert.Equal(t, candidate, sandbox.Annotation(svc, rollout.LastFailedCandidateRevisionAnnotation))
+}
+
+func TestPromotion_WithFaults(t *testing.T) {
+	sandbox := e2e.NewSandbox(t)
+	// Conflicts are retried, rate limited calls are retried in the next runs
+	// and missing metrics make the diagnoses inconclusive, so the candidate
+	// is eventually promoted, in more runs.
+	sandbox.OperatorArgs = []string{"-chaos=latency=200ms,conflict=0.3,ratelimit=0.1,missingdata=0.3"}
+	svc := sandbox.DeployService("chaos")
+	candidate := sandbox.DeployRevision(svc)
+
+	config := sandbox.Config(".", 50)
+	outcome := sandbox.RolloutUntil(config, svc, healthOffset, 15, e2e.PromotedOutcome, e2e.RolledBackOutcome)
+
+	assert.Equal(t, e2e.PromotedOutcome, outcome.Outcome)
+	assert.Equal(t, int64(100), sandbox.Traffic(svc, candidate))
+}